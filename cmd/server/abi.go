@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+)
+
+// Embedded assets that carry the WASM ABI marker
+const (
+	jsBundlePath = "js/client.bundle.min.js"
+	wasmPath     = "js/rle/rle.wasm"
+)
+
+// abiMarkerPattern matches the marker defined in web/src/js/wasm.js and
+// web/src/wasm/main.go.
+var abiMarkerPattern = regexp.MustCompile(`go-rdp-wasm-abi:[0-9]+`)
+
+// checkAssetABI verifies that the embedded JS bundle and WASM module were
+// built against the same ABI, catching partial frontend rebuilds that would
+// otherwise break the UI silently. Assets carrying no marker at all (e.g. not
+// yet built) are not checked.
+func checkAssetABI(staticFS fs.FS) error {
+	jsMarker, err := findABIMarker(staticFS, jsBundlePath)
+	if err != nil {
+		return err
+	}
+	wasmMarker, err := findABIMarker(staticFS, wasmPath)
+	if err != nil {
+		return err
+	}
+
+	if jsMarker == wasmMarker {
+		return nil
+	}
+	return fmt.Errorf("embedded web assets are stale: %s expects %s but %s provides %s; rebuild with 'make build-frontend'",
+		jsBundlePath, markerOrNone(jsMarker), wasmPath, markerOrNone(wasmMarker))
+}
+
+// findABIMarker returns the ABI marker in the named file, or "" if the file
+// is missing or carries none.
+func findABIMarker(fsys fs.FS, name string) (string, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return string(abiMarkerPattern.Find(data)), nil
+}
+
+func markerOrNone(marker string) string {
+	if marker == "" {
+		return "no ABI marker"
+	}
+	return marker
+}
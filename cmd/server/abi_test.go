@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func assetsWithMarkers(jsMarker, wasmMarker string) fstest.MapFS {
+	return fstest.MapFS{
+		jsBundlePath: {Data: []byte(`const A="` + jsMarker + `";goRLE.abi!==A&&fail();`)},
+		wasmPath:     {Data: append([]byte{0x00, 0x61, 0x73, 0x6d, 0x01}, wasmMarker...)},
+	}
+}
+
+func TestCheckAssetABI_Match(t *testing.T) {
+	assert.NoError(t, checkAssetABI(assetsWithMarkers("go-rdp-wasm-abi:2", "go-rdp-wasm-abi:2")))
+}
+
+func TestCheckAssetABI_Mismatch(t *testing.T) {
+	err := checkAssetABI(assetsWithMarkers("go-rdp-wasm-abi:3", "go-rdp-wasm-abi:2"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "go-rdp-wasm-abi:3")
+	assert.Contains(t, err.Error(), "go-rdp-wasm-abi:2")
+	assert.Contains(t, err.Error(), "make build-frontend")
+}
+
+func TestCheckAssetABI_MissingMarker(t *testing.T) {
+	err := checkAssetABI(assetsWithMarkers("go-rdp-wasm-abi:2", ""))
+	require.Error(t, err, "a WASM module predating the marker is stale")
+	assert.Contains(t, err.Error(), "no ABI marker")
+
+	// Unbuilt placeholder assets carry no markers and are not checked
+	assert.NoError(t, checkAssetABI(assetsWithMarkers("", "")))
+	assert.NoError(t, checkAssetABI(fstest.MapFS{}))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/rcarmo/go-rdp/internal/config"
+	"github.com/rcarmo/go-rdp/internal/handler"
+	"github.com/rcarmo/go-rdp/internal/logging"
+)
+
+// createAdminServer returns the server for the admin API, or nil when
+// ADMIN_ADDR is not set. It listens apart from the gateway so the API is
+// never exposed through the public port or its reverse proxy. With
+// SESSION_TOKEN_TTL set it also issues the session tokens /connect then
+// requires.
+func createAdminServer(cfg *config.Config) *http.Server {
+	if cfg == nil || cfg.Server.AdminAddr == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/sessions", handler.ListSessions)
+	mux.HandleFunc("DELETE /admin/sessions/{id}", handler.TerminateSession)
+	mux.HandleFunc("/admin/metrics/udp", udpMetricsHandler)
+	if cfg.Security.SessionTokenTTL > 0 {
+		tokens := handler.NewTokenCredentialProvider(cfg.Security.SessionTokenTTL, nil)
+		handler.SetCredentialProvider(tokens)
+		mux.HandleFunc("POST /admin/tokens", tokens.IssueToken)
+	}
+
+	return &http.Server{
+		Addr:         cfg.Server.AdminAddr,
+		Handler:      requestLoggingMiddleware(adminAuthMiddleware(mux, cfg.Security.AdminToken)),
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	}
+}
+
+// adminAuthMiddleware requires "Authorization: Bearer <token>" on every
+// request when token is set. Without a token the listener is loopback-only,
+// which config validation enforces.
+func adminAuthMiddleware(next http.Handler, token string) http.Handler {
+	if token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="go-rdp admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serveAdmin runs the admin server until it is closed.
+func serveAdmin(server *http.Server) {
+	logging.Info("Admin API listening on %s", server.Addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logging.Error("Admin API: %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcarmo/go-rdp/internal/config"
+	"github.com/rcarmo/go-rdp/internal/handler"
+)
+
+func TestCreateAdminServer(t *testing.T) {
+	assert.Nil(t, createAdminServer(&config.Config{}), "the admin API is off without ADMIN_ADDR")
+	assert.Nil(t, createAdminServer(nil))
+
+	cfg := &config.Config{
+		Server:   config.ServerConfig{AdminAddr: "127.0.0.1:9090"},
+		Security: config.SecurityConfig{AdminToken: "s3cret"},
+	}
+	server := createAdminServer(cfg)
+	require.NotNil(t, server)
+	assert.Equal(t, "127.0.0.1:9090", server.Addr)
+
+	request := func(method, path, auth string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/admin/sessions", ""))
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/admin/sessions", "Bearer wrong"))
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/admin/sessions", "Bearer s3cret"))
+	assert.Equal(t, http.StatusNotFound, request(http.MethodDelete, "/admin/sessions/none", "Bearer s3cret"))
+	assert.Equal(t, http.StatusMethodNotAllowed, request(http.MethodPost, "/admin/sessions", "Bearer s3cret"))
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/admin/metrics/udp", ""))
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/admin/metrics/udp", "Bearer s3cret"))
+}
+
+func TestCreateAdminServer_SessionTokens(t *testing.T) {
+	t.Cleanup(func() { handler.SetCredentialProvider(nil) })
+
+	server := createAdminServer(&config.Config{Server: config.ServerConfig{AdminAddr: "127.0.0.1:9090"}})
+	require.NotNil(t, server)
+	rec := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/tokens", strings.NewReader(`{"user":"alice"}`)))
+	assert.Equal(t, http.StatusNotFound, rec.Code, "tokens are only issued with SESSION_TOKEN_TTL")
+
+	server = createAdminServer(&config.Config{
+		Server:   config.ServerConfig{AdminAddr: "127.0.0.1:9090"},
+		Security: config.SecurityConfig{AdminToken: "s3cret", SessionTokenTTL: time.Minute},
+	})
+	require.NotNil(t, server)
+
+	issue := func(auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/tokens", strings.NewReader(`{"domain":"CORP","user":"alice","password":"secret","host":"desktop.example"}`))
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+	assert.Equal(t, http.StatusUnauthorized, issue("").Code)
+
+	rec = issue("Bearer s3cret")
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var resp struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+
+	// The gateway's /connect now resolves credentials from the issued token
+	// and refuses requests without one
+	rec = httptest.NewRecorder()
+	handler.Connect(rec, httptest.NewRequest(http.MethodGet, "/connect?width=800&height=600", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestAdminAuthMiddleware_NoToken(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	rec := httptest.NewRecorder()
+	adminAuthMiddleware(next, "").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/sessions", nil))
+	assert.Equal(t, http.StatusTeapot, rec.Code, "loopback listeners without a token are open")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"io/fs"
+	"net/http"
+	"time"
+)
+
+// mountAt serves h under basePath, stripping the prefix before dispatch.
+// An empty basePath mounts h at the root.
+func mountAt(basePath string, h http.Handler) http.Handler {
+	if basePath == "" {
+		return h
+	}
+	mux := http.NewServeMux()
+	mux.Handle(basePath+"/", http.StripPrefix(basePath, h))
+	mux.Handle(basePath, http.RedirectHandler(basePath+"/", http.StatusMovedPermanently))
+	return mux
+}
+
+// staticHandler serves the embedded assets. The index page gets a <base>
+// element so its relative asset and WebSocket URLs resolve under basePath.
+func staticHandler(staticFS fs.FS, basePath string) http.Handler {
+	files := http.FileServerFS(staticFS)
+
+	page, err := fs.ReadFile(staticFS, "index.html")
+	if err != nil {
+		return files
+	}
+	baseTag := []byte(`<base href="` + html.EscapeString(basePath+"/") + `">`)
+	page = bytes.Replace(page, []byte("<head>"), append([]byte("<head>\n    "), baseTag...), 1)
+	modTime := time.Now()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			files.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		http.ServeContent(w, r, "index.html", modTime, bytes.NewReader(page))
+	})
+}
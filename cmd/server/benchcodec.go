@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rcarmo/go-rdp/internal/codec"
+	"github.com/rcarmo/go-rdp/internal/codec/rfx"
+)
+
+// benchSize is the width and height of the bitmaps used by bench-codec,
+// matching the 64x64 tiles servers typically send.
+const benchSize = 64
+
+// codecBenchmark is one function measured by bench-codec. run performs a
+// single decode or conversion and bytes is the output size of that call,
+// used to report throughput.
+type codecBenchmark struct {
+	name  string
+	bytes int
+	run   func() error
+}
+
+// codecBenchResult is the measurement for one codecBenchmark.
+type codecBenchResult struct {
+	name    string
+	ops     int
+	nsPerOp float64
+	mbPerS  float64
+}
+
+// benchCodecCommand measures the decoders and color converters in
+// internal/codec and prints ns/op and MB/s for each.
+func benchCodecCommand(args []string) error {
+	fs := flag.NewFlagSet("bench-codec", flag.ContinueOnError)
+	duration := fs.Duration("time", time.Second, "minimum run time per function")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 || *duration <= 0 {
+		return errors.New("usage: go-rdp bench-codec [-time duration]")
+	}
+	return runCodecBench(os.Stdout, *duration)
+}
+
+// runCodecBench runs every codec benchmark for at least d and writes a
+// table of results to w.
+func runCodecBench(w io.Writer, d time.Duration) error {
+	benchmarks, err := codecBenchmarks()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Codec benchmark: %dx%d bitmaps, MB/s counts output bytes\n\n", benchSize, benchSize)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "function\tops\tns/op\tMB/s\t")
+	for _, b := range benchmarks {
+		r, err := measure(b, d)
+		if err != nil {
+			return fmt.Errorf("%s: %w", b.name, err)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%.0f\t%.1f\t\n", r.name, r.ops, r.nsPerOp, r.mbPerS)
+	}
+	return tw.Flush()
+}
+
+// measure calls b.run in growing batches until d has elapsed.
+func measure(b codecBenchmark, d time.Duration) (codecBenchResult, error) {
+	// Warm up and surface input errors before timing
+	if err := b.run(); err != nil {
+		return codecBenchResult{}, err
+	}
+
+	ops, batch := 0, 1
+	start := time.Now()
+	elapsed := time.Duration(0)
+	for elapsed < d {
+		for i := 0; i < batch; i++ {
+			if err := b.run(); err != nil {
+				return codecBenchResult{}, err
+			}
+		}
+		ops += batch
+		elapsed = time.Since(start)
+		if batch < 1<<20 {
+			batch *= 2
+		}
+	}
+
+	ns := float64(elapsed.Nanoseconds())
+	return codecBenchResult{
+		name:    b.name,
+		ops:     ops,
+		nsPerOp: ns / float64(ops),
+		mbPerS:  float64(b.bytes) * float64(ops) / ns * 1e3,
+	}, nil
+}
+
+// errBenchDecode is returned when a codec rejects a benchmark input.
+var errBenchDecode = errors.New("decode failed")
+
+// codecBenchmarks builds representative inputs and the functions to measure.
+func codecBenchmarks() ([]codecBenchmark, error) {
+	const pixels = benchSize * benchSize
+	rng := rand.New(rand.NewSource(1)) // #nosec G404 -- deterministic benchmark data
+
+	rle := rleBenchBitmap16(rng)
+	raw16 := make([]byte, pixels*2)
+	if !codec.RLEDecompress16(rle, raw16, benchSize*2) {
+		return nil, fmt.Errorf("RLE input: %w", errBenchDecode)
+	}
+	raw24 := make([]byte, pixels*3)
+	raw32 := make([]byte, pixels*4)
+	rng.Read(raw24)
+	rng.Read(raw32)
+	rgba := make([]byte, pixels*4)
+
+	tile := rfxBenchTile(rng)
+	quant := rfx.DefaultQuant()
+	yCoeff := make([]int16, rfx.TilePixels)
+	cbCoeff := make([]int16, rfx.TilePixels)
+	crCoeff := make([]int16, rfx.TilePixels)
+	tileRGBA := make([]byte, rfx.TileRGBASize)
+
+	ySamples := make([]int16, rfx.TilePixels)
+	cbSamples := make([]int16, rfx.TilePixels)
+	crSamples := make([]int16, rfx.TilePixels)
+	for i := range ySamples {
+		ySamples[i] = int16(rng.Intn(256) - 128)  // #nosec G115 -- within int16
+		cbSamples[i] = int16(rng.Intn(256) - 128) // #nosec G115 -- within int16
+		crSamples[i] = int16(rng.Intn(256) - 128) // #nosec G115 -- within int16
+	}
+
+	return []codecBenchmark{
+		{"RLEDecompress16", len(raw16), func() error {
+			if !codec.RLEDecompress16(rle, raw16, benchSize*2) {
+				return errBenchDecode
+			}
+			return nil
+		}},
+		{"ProcessBitmap", pixels * 4, func() error {
+			if codec.ProcessBitmap(rle, benchSize, benchSize, 16, true, benchSize*2, false) == nil {
+				return errBenchDecode
+			}
+			return nil
+		}},
+		{"rfx.DecodeTile", rfx.TileRGBASize, func() error {
+			_, _, err := rfx.DecodeTileWithBuffers(tile, rfx.DefaultEntropyMode, quant, quant, quant, yCoeff, cbCoeff, crCoeff, tileRGBA)
+			return err
+		}},
+		{"RGB565ToRGBA", len(rgba), func() error {
+			codec.RGB565ToRGBA(raw16, rgba)
+			return nil
+		}},
+		{"BGR24ToRGBA", len(rgba), func() error {
+			codec.BGR24ToRGBA(raw24, rgba)
+			return nil
+		}},
+		{"BGRA32ToRGBA", len(rgba), func() error {
+			codec.BGRA32ToRGBA(raw32, rgba)
+			return nil
+		}},
+		{"rfx.YCbCrToRGBA", rfx.TileRGBASize, func() error {
+			rfx.YCbCrToRGBA(ySamples, cbSamples, crSamples, tileRGBA)
+			return nil
+		}},
+	}, nil
+}
+
+// rleBenchBitmap16 builds an interleaved RLE stream for a 16bpp bitmap that
+// mixes the orders typical of desktop content: solid color runs, foreground
+// runs and literal color images. Regular orders carry the order code in the
+// top three bits and a run length of 1-31 pixels in the low five.
+func rleBenchBitmap16(rng *rand.Rand) []byte {
+	const (
+		regularFgRun      = 0x1 << 5
+		regularColorRun   = 0x3 << 5
+		regularColorImage = 0x4 << 5
+	)
+	var src []byte
+	for y := 0; y < benchSize; y++ {
+		src = append(src, regularColorRun|16, byte(rng.Intn(256)), byte(rng.Intn(256)))
+		src = append(src, regularFgRun|16)
+		for n := 0; n < 2; n++ {
+			src = append(src, regularColorImage|16)
+			for i := 0; i < 16*2; i++ {
+				src = append(src, byte(rng.Intn(256)))
+			}
+		}
+	}
+	return src
+}
+
+// rfxBenchTile builds a CBT_TILE block whose components carry pseudo-random
+// RLGR data, sized like a moderately detailed tile.
+func rfxBenchTile(rng *rand.Rand) []byte {
+	const yLen, cbLen, crLen = 2048, 1024, 1024
+	tile := make([]byte, 19+yLen+cbLen+crLen)
+	binary.LittleEndian.PutUint16(tile[0:], rfx.CBT_TILE)
+	binary.LittleEndian.PutUint32(tile[2:], uint32(len(tile))) // #nosec G115 -- fixed size
+	binary.LittleEndian.PutUint16(tile[13:], yLen)
+	binary.LittleEndian.PutUint16(tile[15:], cbLen)
+	binary.LittleEndian.PutUint16(tile[17:], crLen)
+	rng.Read(tile[19:])
+	return tile
+}
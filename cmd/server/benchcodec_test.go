@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunCodecBench(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, runCodecBench(&out, time.Millisecond))
+
+	results := make(map[string][]string)
+	for _, line := range strings.Split(out.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) == 4 {
+			results[fields[0]] = fields[1:]
+		}
+	}
+	for _, name := range []string{"RLEDecompress16", "ProcessBitmap", "rfx.DecodeTile", "RGB565ToRGBA", "BGR24ToRGBA", "BGRA32ToRGBA", "rfx.YCbCrToRGBA"} {
+		fields, ok := results[name]
+		require.True(t, ok, "missing result for %s in:\n%s", name, out.String())
+		for i, unit := range []string{"ops", "ns/op", "MB/s"} {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			require.NoError(t, err, "%s %s", name, unit)
+			assert.Positive(t, v, "%s %s", name, unit)
+		}
+	}
+}
+
+func TestBenchCodecCommand_Usage(t *testing.T) {
+	handled, err := runSubcommand([]string{"bench-codec", "extra"})
+	assert.True(t, handled)
+	assert.Error(t, err)
+
+	_, err = runSubcommand([]string{"bench-codec", "-time", "0s"})
+	assert.Error(t, err)
+}
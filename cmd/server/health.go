@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+)
+
+// readiness is the JSON body of /readyz.
+type readiness struct {
+	Ready    bool   `json:"ready"`
+	Assets   bool   `json:"assets"`
+	Draining bool   `json:"draining"`
+	Version  string `json:"version"`
+}
+
+// healthzHandler reports that the process is up. It always answers 200.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// readyzHandler reports whether the gateway should receive new sessions: the
+// embedded assets must have loaded and draining must report false. It answers
+// 503 otherwise.
+func readyzHandler(staticFS fs.FS, draining func() bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := readiness{
+			Assets:   assetsLoaded(staticFS),
+			Draining: draining(),
+			Version:  appVersion,
+		}
+		status.Ready = status.Assets && !status.Draining
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if !status.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(status)
+	}
+}
+
+// assetsLoaded reports whether staticFS holds the index page.
+func assetsLoaded(staticFS fs.FS) bool {
+	if staticFS == nil {
+		return false
+	}
+	_, err := fs.Stat(staticFS, "index.html")
+	return err == nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcarmo/go-rdp/internal/config"
+)
+
+func TestHealthzHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	healthzHandler(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ok\n", rec.Body.String())
+}
+
+func TestReadyzHandler(t *testing.T) {
+	assets := fstest.MapFS{"index.html": {Data: []byte("<html></html>")}}
+
+	tests := []struct {
+		name     string
+		assets   fstest.MapFS
+		draining bool
+		want     int
+	}{
+		{name: "ready", assets: assets, want: http.StatusOK},
+		{name: "draining", assets: assets, draining: true, want: http.StatusServiceUnavailable},
+		{name: "missing assets", assets: fstest.MapFS{}, want: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := readyzHandler(tt.assets, func() bool { return tt.draining })
+			rec := httptest.NewRecorder()
+			h(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+			var body readiness
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			assert.Equal(t, tt.want == http.StatusOK, body.Ready)
+			assert.Equal(t, tt.draining, body.Draining)
+			assert.Equal(t, len(tt.assets) > 0, body.Assets)
+			assert.Equal(t, appVersion, body.Version)
+		})
+	}
+}
+
+func TestCreateServer_HealthBypassesMiddleware(t *testing.T) {
+	cfg := &config.Config{
+		Server: config.ServerConfig{BasePath: "/rdp"},
+		Security: config.SecurityConfig{
+			AllowedOrigins:     []string{"https://allowed.example"},
+			EnableRateLimit:    true,
+			RateLimitPerMinute: 1,
+		},
+	}
+	h := createServer(cfg).Handler
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Origin", "https://allowed.example")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 3; i++ {
+		rec := get("/healthz")
+		assert.Equal(t, http.StatusOK, rec.Code, "healthz is not rate limited")
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"), "healthz skips CORS")
+		assert.NotEqual(t, http.StatusTooManyRequests, get("/readyz").Code, "readyz is not rate limited")
+	}
+
+	assert.Equal(t, http.StatusOK, get("/rdp/").Code)
+	assert.Equal(t, http.StatusTooManyRequests, get("/rdp/").Code, "other routes are still rate limited")
+}
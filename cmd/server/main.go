@@ -3,6 +3,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -11,10 +12,14 @@ import (
 	"net/http"
 	_ "net/http/pprof" // #nosec G108 -- pprof is intentionally exposed for diagnostics
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/rcarmo/go-rdp/internal/codec/rfx"
 	"github.com/rcarmo/go-rdp/internal/config"
 	"github.com/rcarmo/go-rdp/internal/handler"
 	"github.com/rcarmo/go-rdp/internal/logging"
@@ -27,6 +32,13 @@ var (
 )
 
 func main() {
+	if handled, err := runSubcommand(os.Args[1:]); handled {
+		if err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
 	args, action := parseFlags()
 	if action != "" {
 		return
@@ -41,6 +53,7 @@ type parsedArgs struct {
 	host             string
 	port             string
 	logLevel         string
+	configFile       string
 	skipTLS          bool
 	allowAnyTLS      bool
 	tlsServerName    string
@@ -48,6 +61,7 @@ type parsedArgs struct {
 	enableRFX        *bool // nil = use default, non-nil = override
 	enableUDP        *bool // nil = use default, non-nil = override
 	preferPCMAudio   *bool // nil = use default, non-nil = override
+	enableAudio      *bool // nil = use default, non-nil = override
 }
 
 // parseFlags parses command line flags and returns the parsed args.
@@ -63,6 +77,7 @@ func parseFlagsWithArgs(args []string) (parsedArgs, string) {
 	hostFlag := fs.String("host", "", "RDP HTML5 server host")
 	portFlag := fs.String("port", "", "RDP HTML5 server port")
 	logLevelFlag := fs.String("log-level", "", "log level (debug, info, warn, error)")
+	configFileFlag := fs.String("config", "", "YAML or JSON config file with per-host connection profiles")
 	skipTLS := fs.Bool("tls-skip-verify", false, "skip TLS certificate validation")
 	allowAnyTLS := fs.Bool("tls-allow-any-server-name", false, "allow overriding server name to any host (disables SNI enforcement)")
 	tlsServerName := fs.String("tls-server-name", "", "override TLS server name")
@@ -70,6 +85,7 @@ func parseFlagsWithArgs(args []string) (parsedArgs, string) {
 	noRFX := fs.Bool("no-rfx", false, "disable RemoteFX codec support")
 	enableUDP := fs.Bool("udp", false, "enable UDP transport (experimental)")
 	preferPCMAudio := fs.Bool("prefer-pcm-audio", false, "prefer PCM audio (best quality, high bandwidth) over compressed formats")
+	noAudio := fs.Bool("no-audio", false, "disable audio output")
 	helpFlag := fs.Bool("help", false, "show help")
 	versionFlag := fs.Bool("version", false, "show version")
 
@@ -106,6 +122,13 @@ func parseFlagsWithArgs(args []string) (parsedArgs, string) {
 		preferPCMAudioPtr = &pcmValue
 	}
 
+	// Handle audio flag - only set if explicitly disabled
+	var enableAudioPtr *bool
+	if *noAudio {
+		audioValue := false
+		enableAudioPtr = &audioValue
+	}
+
 	var useNLAPtr *bool
 	if *useNLA {
 		nlaValue := true
@@ -116,6 +139,7 @@ func parseFlagsWithArgs(args []string) (parsedArgs, string) {
 		host:           strings.TrimSpace(*hostFlag),
 		port:           strings.TrimSpace(*portFlag),
 		logLevel:       strings.TrimSpace(*logLevelFlag),
+		configFile:     strings.TrimSpace(*configFileFlag),
 		skipTLS:        *skipTLS,
 		allowAnyTLS:    *allowAnyTLS,
 		tlsServerName:  strings.TrimSpace(*tlsServerName),
@@ -123,22 +147,38 @@ func parseFlagsWithArgs(args []string) (parsedArgs, string) {
 		enableRFX:      enableRFXPtr,
 		enableUDP:      enableUDPPtr,
 		preferPCMAudio: preferPCMAudioPtr,
+		enableAudio:    enableAudioPtr,
 	}, ""
 }
 
+// featureOverrides collects the feature toggles set on the command line
+func featureOverrides(args parsedArgs) map[string]bool {
+	overrides := make(map[string]bool)
+	for name, value := range map[string]*bool{
+		config.FeatureNLA:      args.useNLA,
+		config.FeatureRFX:      args.enableRFX,
+		config.FeatureUDP:      args.enableUDP,
+		config.FeaturePCMAudio: args.preferPCMAudio,
+		config.FeatureAudio:    args.enableAudio,
+	} {
+		if value != nil {
+			overrides[name] = *value
+		}
+	}
+	return overrides
+}
+
 // run starts the server with the given arguments
 func run(args parsedArgs) error {
 	opts := config.LoadOptions{
 		Host:              args.host,
 		Port:              args.port,
 		LogLevel:          args.logLevel,
+		ConfigFile:        args.configFile,
 		SkipTLSValidation: args.skipTLS,
 		AllowAnyTLSServer: args.allowAnyTLS,
 		TLSServerName:     args.tlsServerName,
-		UseNLA:            args.useNLA,
-		EnableRFX:         args.enableRFX,
-		EnableUDP:         args.enableUDP,
-		PreferPCMAudio:    args.preferPCMAudio,
+		Features:          featureOverrides(args),
 	}
 
 	cfg, err := config.LoadWithOverrides(opts)
@@ -147,10 +187,11 @@ func run(args parsedArgs) error {
 	}
 
 	setupLogging(cfg.Logging)
+	rfx.SetMaxDecodeWorkers(cfg.RDP.MaxDecodeWorkers)
 
 	server := createServer(cfg)
 	rfxStatus := "enabled"
-	if !cfg.RDP.EnableRFX {
+	if !cfg.Features.Enabled(config.FeatureRFX) {
 		rfxStatus = "disabled"
 	}
 	logging.Info("Starting server on %s:%s (TLS=%t, RFX=%s)", cfg.Server.Host, cfg.Server.Port, cfg.Security.EnableTLS, rfxStatus)
@@ -169,13 +210,22 @@ func createServer(cfg *config.Config) *http.Server {
 	if err != nil {
 		log.Fatalf("failed to load embedded assets: %v", err)
 	}
+	if err := checkAssetABI(staticFS); err != nil {
+		log.Fatalf("%v", err)
+	}
 
 	mux := http.NewServeMux()
-	mux.Handle("/", http.FileServerFS(staticFS))
+	mux.Handle("/", staticHandler(staticFS, cfg.Server.BasePath))
 	mux.HandleFunc("/connect", handler.Connect)
+	mux.HandleFunc("/snapshot", handler.Snapshot)
 
-	h := applySecurityMiddleware(mux, cfg)
-	h = requestLoggingMiddleware(h)
+	// Health probes stay at the root and skip rate limiting and CORS so an
+	// orchestrator can always reach them
+	root := http.NewServeMux()
+	root.HandleFunc("/healthz", healthzHandler)
+	root.HandleFunc("/readyz", readyzHandler(staticFS, handler.Draining))
+	root.Handle("/", applySecurityMiddleware(mountAt(cfg.Server.BasePath, mux), cfg))
+	h := requestLoggingMiddleware(root)
 
 	return &http.Server{
 		Addr:         addr,
@@ -188,14 +238,14 @@ func createServer(cfg *config.Config) *http.Server {
 
 func applySecurityMiddleware(next http.Handler, cfg *config.Config) http.Handler {
 	if cfg == nil {
-		return securityHeadersMiddleware(corsMiddleware(next, nil))
+		return securityHeadersMiddleware(corsMiddleware(next, nil, defaultCORSMaxAge))
 	}
 
 	h := next
 	if cfg.Security.EnableRateLimit {
-		h = rateLimitMiddleware(h, cfg.Security.RateLimitPerMinute)
+		h = rateLimitMiddleware(h, cfg.Security.RateLimitPerMinute, cfg.Security.RateLimitIdleTTL)
 	}
-	h = corsMiddleware(h, cfg.Security.AllowedOrigins)
+	h = corsMiddleware(h, cfg.Security.AllowedOrigins, cfg.Security.CORSMaxAge)
 	h = securityHeadersMiddleware(h)
 
 	return h
@@ -216,21 +266,29 @@ func securityHeadersMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func corsMiddleware(next http.Handler, allowedOrigins []string) http.Handler {
+// defaultCORSMaxAge is how long browsers may cache a preflight response
+// when no configuration is given
+const defaultCORSMaxAge = 10 * time.Minute
+
+// corsMiddleware sets CORS headers for allowed origins only; any other origin
+// gets none, so browsers refuse its cross-origin reads. Responses vary by
+// Origin so shared caches keep them apart, and preflight responses may be
+// reused by the browser for maxAge (0 = not sent).
+func corsMiddleware(next http.Handler, allowedOrigins []string, maxAge time.Duration) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+
 		origin := r.Header.Get("Origin")
-		if origin != "" {
-			if len(allowedOrigins) == 0 {
-				log.Printf("CORS: allowing origin %q without allowlist (dev mode)", origin)
-			} else {
-				log.Printf("CORS: allowing origin %q without strict allowlist enforcement (proxy mode)", origin)
-			}
-		}
 		if isOriginAllowed(origin, allowedOrigins, r.Host) {
 			w.Header().Set("Access-Control-Allow-Origin", origin)
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
 			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			if r.Method == http.MethodOptions && maxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge/time.Second)))
+			}
+		} else if origin != "" {
+			logging.Debug("CORS: origin %q not in ALLOWED_ORIGINS, no CORS headers sent", origin)
 		}
 
 		if r.Method == http.MethodOptions {
@@ -242,6 +300,8 @@ func corsMiddleware(next http.Handler, allowedOrigins []string) http.Handler {
 	})
 }
 
+// isOriginAllowed checks origin against ALLOWED_ORIGINS, allowing any origin
+// when the list is empty (development mode)
 func isOriginAllowed(origin string, allowedOrigins []string, host string) bool {
 	if origin == "" {
 		return false
@@ -261,12 +321,14 @@ type rateLimiter struct {
 	last     time.Time
 }
 
-func newRateLimiter(ratePerMinute int) *rateLimiter {
+// newRateLimiter returns a full bucket whose refill starts at now, on the
+// same clock later passed to allow
+func newRateLimiter(ratePerMinute int, now time.Time) *rateLimiter {
 	capacity := float64(ratePerMinute)
 	if capacity <= 0 {
 		capacity = 1
 	}
-	return &rateLimiter{capacity: capacity, tokens: capacity, last: time.Now()}
+	return &rateLimiter{capacity: capacity, tokens: capacity, last: now}
 }
 
 func (rl *rateLimiter) allow(now time.Time, refillPerSecond float64) bool {
@@ -287,9 +349,74 @@ func (rl *rateLimiter) allow(now time.Time, refillPerSecond float64) bool {
 	return false
 }
 
-func rateLimitMiddleware(next http.Handler, ratePerMinute int) http.Handler {
+// defaultRateLimitIdleTTL is how long a client's limiter is kept without
+// requests when no TTL is configured
+const defaultRateLimitIdleTTL = 10 * time.Minute
+
+// idle returns how long the limiter has gone without a request
+func (rl *rateLimiter) idle(now time.Time) time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return now.Sub(rl.last)
+}
+
+// rateLimiterSet holds one rateLimiter per client and forgets clients idle
+// for longer than ttl, so a gateway scanned from many addresses does not grow
+// without bound. A forgotten client starts again with a full bucket, which
+// it would have refilled to while idle anyway.
+type rateLimiterSet struct {
+	clients       sync.Map // client key -> *rateLimiter
+	ratePerMinute int
+	ttl           time.Duration
+
+	mu        sync.Mutex
+	nextSweep time.Time
+}
+
+func newRateLimiterSet(ratePerMinute int, ttl time.Duration, now time.Time) *rateLimiterSet {
+	if ttl <= 0 {
+		ttl = defaultRateLimitIdleTTL
+	}
+	return &rateLimiterSet{ratePerMinute: ratePerMinute, ttl: ttl, nextSweep: now.Add(ttl)}
+}
+
+// get returns the limiter for key, creating it on first use. Idle clients are
+// swept at most once per ttl.
+func (s *rateLimiterSet) get(key string, now time.Time) *rateLimiter {
+	s.mu.Lock()
+	sweep := !now.Before(s.nextSweep)
+	if sweep {
+		s.nextSweep = now.Add(s.ttl)
+	}
+	s.mu.Unlock()
+	if sweep {
+		s.sweep(now)
+	}
+
+	if value, ok := s.clients.Load(key); ok {
+		return value.(*rateLimiter)
+	}
+	value, _ := s.clients.LoadOrStore(key, newRateLimiter(s.ratePerMinute, now))
+	return value.(*rateLimiter)
+}
+
+// sweep drops limiters idle for longer than ttl and returns how many remain
+func (s *rateLimiterSet) sweep(now time.Time) int {
+	remaining := 0
+	s.clients.Range(func(key, value any) bool {
+		if value.(*rateLimiter).idle(now) > s.ttl {
+			s.clients.CompareAndDelete(key, value)
+		} else {
+			remaining++
+		}
+		return true
+	})
+	return remaining
+}
+
+func rateLimitMiddleware(next http.Handler, ratePerMinute int, idleTTL time.Duration) http.Handler {
 	refillPerSecond := float64(ratePerMinute) / 60.0
-	var clients sync.Map
+	clients := newRateLimiterSet(ratePerMinute, idleTTL, time.Now())
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if ratePerMinute <= 0 {
@@ -302,9 +429,8 @@ func rateLimitMiddleware(next http.Handler, ratePerMinute int) http.Handler {
 			key = host
 		}
 
-		value, _ := clients.LoadOrStore(key, newRateLimiter(ratePerMinute))
-		limiter := value.(*rateLimiter)
-		if !limiter.allow(time.Now(), refillPerSecond) {
+		now := time.Now()
+		if !clients.get(key, now).allow(now, refillPerSecond) {
 			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
 			return
 		}
@@ -323,6 +449,7 @@ func setupLogging(cfg config.LoggingConfig) {
 		level = "info"
 	}
 	logging.SetLevelFromString(level)
+	logging.SetFormatFromString(cfg.Format)
 }
 
 func requestLoggingMiddleware(next http.Handler) http.Handler {
@@ -333,27 +460,76 @@ func requestLoggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func startServer(server *http.Server, _ *config.Config) error {
+func startServer(server *http.Server, cfg *config.Config) error {
 	if server == nil {
 		return fmt.Errorf("server is nil")
 	}
 
-	err := server.ListenAndServe()
-	if errors.Is(err, http.ErrServerClosed) {
-		return nil
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if admin := createAdminServer(cfg); admin != nil {
+		go serveAdmin(admin)
+		defer func() { _ = admin.Close() }()
+	}
+
+	var shutdownTimeout time.Duration
+	if cfg != nil {
+		shutdownTimeout = cfg.Server.ShutdownTimeout
 	}
+	return serveUntilDone(ctx, server, shutdownTimeout)
+}
 
-	return err
+// serveUntilDone runs server until it fails or ctx is done, then drains
+// active sessions for up to shutdownTimeout before shutting it down.
+func serveUntilDone(ctx context.Context, server *http.Server, shutdownTimeout time.Duration) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	logging.Info("Shutting down, draining active sessions for up to %v", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Keep serving while sessions drain so /connect answers 503 rather than
+	// refusing connections outright
+	handler.BeginDrain()
+	if err := handler.WaitForSessions(shutdownCtx); err != nil {
+		logging.Warn("Shutdown timeout reached with sessions still active")
+	}
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		_ = server.Close()
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
 
 func showHelp() {
 	fmt.Println(appName)
 	fmt.Println("USAGE: go-rdp [options]")
+	fmt.Println("       go-rdp <command> [args]")
+	fmt.Println("")
+	fmt.Println("COMMANDS:")
+	fmt.Println("  export-assets <dir>        Write the embedded web assets to <dir> (for CDN hosting)")
 	fmt.Println("")
 	fmt.Println("OPTIONS:")
 	fmt.Println("  Server:")
 	fmt.Println("    -host <addr>             Server listen host (default: 0.0.0.0)")
 	fmt.Println("    -port <port>             Server listen port (default: 8080)")
+	fmt.Println("    -config <file>           YAML/JSON file with per-host connection profiles")
 	fmt.Println("")
 	fmt.Println("  Logging:")
 	fmt.Println("    -log-level <level>       Log level: debug, info, warn, error (default: info)")
@@ -372,15 +548,16 @@ func showHelp() {
 	fmt.Println("  Audio:")
 	fmt.Println("    -prefer-pcm-audio        Prefer PCM (best quality, ~1.4 Mbps)")
 	fmt.Println("                             Default: prefer AAC/MP3 (~128-192 kbps)")
+	fmt.Println("    -no-audio                Disable audio output")
 	fmt.Println("")
 	fmt.Println("  Info:")
 	fmt.Println("    -version                 Show version information")
 	fmt.Println("    -help                    Show this help message")
 	fmt.Println("")
 	fmt.Println("ENVIRONMENT VARIABLES:")
-	fmt.Println("  SERVER_HOST, SERVER_PORT, LOG_LEVEL")
+	fmt.Println("  SERVER_HOST, SERVER_PORT, LOG_LEVEL, CONFIG_FILE")
 	fmt.Println("  TLS_SKIP_VERIFY, TLS_SERVER_NAME, TLS_ALLOW_ANY_SERVER_NAME")
-	fmt.Println("  USE_NLA, RDP_ENABLE_RFX, RDP_ENABLE_UDP, RDP_PREFER_PCM_AUDIO")
+	fmt.Println("  USE_NLA, RDP_ENABLE_RFX, RDP_RFX_MODE, RDP_ENABLE_UDP, RDP_PREFER_PCM_AUDIO, ENABLE_AUDIO, PRIMARY_MONITOR_ONLY")
 	fmt.Println("")
 	fmt.Println("EXAMPLES:")
 	fmt.Println("  go-rdp")
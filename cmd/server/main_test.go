@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
@@ -142,7 +143,7 @@ func TestCorsMiddleware(t *testing.T) {
 			allowedOrigins: []string{"https://example.com"},
 			requestOrigin:  "https://malicious.com",
 			requestHost:    "example.com:8080",
-			expectAllowed:  true,
+			expectAllowed:  false,
 		},
 		{
 			name:           "same origin when no list configured",
@@ -169,7 +170,7 @@ func TestCorsMiddleware(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			middleware := corsMiddleware(testHandler, tt.allowedOrigins)
+			middleware := corsMiddleware(testHandler, tt.allowedOrigins, defaultCORSMaxAge)
 
 			req := httptest.NewRequest("GET", "/", nil)
 			req.Header.Set("Origin", tt.requestOrigin)
@@ -189,7 +190,12 @@ func TestCorsMiddleware(t *testing.T) {
 			if tt.expectAllowed {
 				assert.Equal(t, "GET, POST, OPTIONS", rr.Header().Get("Access-Control-Allow-Methods"))
 				assert.Equal(t, "Content-Type, Authorization", rr.Header().Get("Access-Control-Allow-Headers"))
+			} else {
+				assert.Empty(t, rr.Header().Get("Access-Control-Allow-Methods"))
+				assert.Empty(t, rr.Header().Get("Access-Control-Allow-Credentials"))
 			}
+			assert.Equal(t, "Origin", rr.Header().Get("Vary"))
+			assert.Empty(t, rr.Header().Get("Access-Control-Max-Age"), "max age is only sent on preflight")
 		})
 	}
 }
@@ -296,6 +302,47 @@ func TestStartServer(t *testing.T) {
 	}
 }
 
+func TestServeUntilDone_Shutdown(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	_ = listener.Close()
+
+	server := &http.Server{
+		Addr: addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- serveUntilDone(ctx, server, time.Second)
+	}()
+
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + addr)
+		if err != nil {
+			return false
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+
+	// Cancelling stands in for SIGINT/SIGTERM
+	cancel()
+	select {
+	case err := <-serverErr:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+
+	_, err = http.Get("http://" + addr)
+	assert.Error(t, err, "listener is closed after shutdown")
+}
+
 func TestShowHelp(t *testing.T) {
 	// Capture stdout
 	oldStdout := os.Stdout
@@ -357,7 +404,7 @@ func TestRateLimitMiddleware(t *testing.T) {
 		_, _ = w.Write([]byte("OK"))
 	})
 
-	middleware := rateLimitMiddleware(testHandler, cfg.Security.RateLimitPerMinute)
+	middleware := rateLimitMiddleware(testHandler, cfg.Security.RateLimitPerMinute, cfg.Security.RateLimitIdleTTL)
 	require.NotNil(t, middleware)
 
 	req := httptest.NewRequest("GET", "/", nil)
@@ -371,7 +418,7 @@ func TestRateLimitMiddleware(t *testing.T) {
 func TestRateLimitMiddleware_Exceeded(t *testing.T) {
 	middleware := rateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
-	}), 1)
+	}), 1, 0)
 
 	req := httptest.NewRequest("GET", "/", nil)
 	req.RemoteAddr = "127.0.0.1:1234"
@@ -385,6 +432,41 @@ func TestRateLimitMiddleware_Exceeded(t *testing.T) {
 	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
 }
 
+func TestRateLimiterSet_SweepsIdleClients(t *testing.T) {
+	const clients = 5
+	ttl := time.Minute
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	set := newRateLimiterSet(60, ttl, start)
+
+	for i := 0; i < clients; i++ {
+		set.get(fmt.Sprintf("10.0.0.%d", i), start)
+	}
+	assert.Equal(t, clients, set.sweep(start), "fresh clients should be kept")
+
+	// One client stays active through the idle window
+	active := set.get("192.0.2.1", start)
+	require.True(t, active.allow(start.Add(ttl), 1))
+
+	// The first request after the window sweeps everyone else
+	set.get("192.0.2.2", start.Add(ttl+time.Second))
+	remaining := 0
+	set.clients.Range(func(key, _ any) bool {
+		remaining++
+		return true
+	})
+	assert.Equal(t, 2, remaining, "only the active client and the new one should remain")
+}
+
+func TestRateLimiter_StartsOnCallerClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rl := newRateLimiter(1, start)
+	assert.Equal(t, time.Second, rl.idle(start.Add(time.Second)))
+
+	require.True(t, rl.allow(start, 1.0/60))
+	assert.False(t, rl.allow(start.Add(time.Second), 1.0/60), "a second has not refilled a token")
+	assert.True(t, rl.allow(start.Add(time.Minute+time.Second), 1.0/60))
+}
+
 func TestParseFlags_UsesOsArgs(t *testing.T) {
 	originalArgs := os.Args
 	defer func() { os.Args = originalArgs }()
@@ -419,7 +501,7 @@ func TestCorsMiddlewareOptionsRequest(t *testing.T) {
 		_, _ = w.Write([]byte("OK"))
 	})
 
-	middleware := corsMiddleware(testHandler, []string{"https://example.com"})
+	middleware := corsMiddleware(testHandler, []string{"https://example.com"}, defaultCORSMaxAge)
 
 	// Test OPTIONS preflight request
 	req := httptest.NewRequest(http.MethodOptions, "/", nil)
@@ -432,17 +514,72 @@ func TestCorsMiddlewareOptionsRequest(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Equal(t, "https://example.com", rr.Header().Get("Access-Control-Allow-Origin"))
 	assert.Equal(t, "GET, POST, OPTIONS", rr.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "600", rr.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, "Origin", rr.Header().Get("Vary"))
 	// Body should be empty for OPTIONS
 	assert.Empty(t, rr.Body.String())
 }
 
+func TestCorsMiddlewarePreflight(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("preflight must not reach the next handler")
+	})
+
+	preflight := func(h http.Handler, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodOptions, "/connect", nil)
+		req.Host = "gateway.example.com"
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("allowed origin is cached for the configured max age", func(t *testing.T) {
+		rr := preflight(corsMiddleware(next, []string{"https://app.example.com"}, 2*time.Hour), "https://app.example.com")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "https://app.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "Content-Type, Authorization", rr.Header().Get("Access-Control-Allow-Headers"))
+		assert.Equal(t, "true", rr.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, "7200", rr.Header().Get("Access-Control-Max-Age"))
+		assert.Equal(t, []string{"Origin"}, rr.Header().Values("Vary"))
+	})
+
+	t.Run("disallowed origin gets no CORS headers", func(t *testing.T) {
+		rr := preflight(corsMiddleware(next, []string{"https://app.example.com"}, 2*time.Hour), "https://evil.example.net")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		for _, name := range []string{
+			"Access-Control-Allow-Origin",
+			"Access-Control-Allow-Methods",
+			"Access-Control-Allow-Headers",
+			"Access-Control-Allow-Credentials",
+			"Access-Control-Max-Age",
+		} {
+			assert.Empty(t, rr.Header().Get(name), name)
+		}
+		assert.Equal(t, "Origin", rr.Header().Get("Vary"), "caches must still key on Origin")
+	})
+
+	t.Run("same origin is allowed with an allowlist", func(t *testing.T) {
+		rr := preflight(corsMiddleware(next, []string{"https://app.example.com"}, 0), "https://gateway.example.com")
+		assert.Equal(t, "https://gateway.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, rr.Header().Get("Access-Control-Max-Age"), "zero max age is not sent")
+	})
+
+	t.Run("malformed origin is refused in development mode", func(t *testing.T) {
+		rr := preflight(corsMiddleware(next, nil, defaultCORSMaxAge), "null")
+		assert.Empty(t, rr.Header().Get("Access-Control-Allow-Origin"))
+	})
+}
+
 func TestCorsMiddlewareEmptyOrigin(t *testing.T) {
 	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("OK"))
 	})
 
-	middleware := corsMiddleware(testHandler, []string{"https://example.com"})
+	middleware := corsMiddleware(testHandler, []string{"https://example.com"}, defaultCORSMaxAge)
 
 	// Test request with no Origin header
 	req := httptest.NewRequest("GET", "/", nil)
@@ -483,7 +620,7 @@ func TestIsOriginAllowed(t *testing.T) {
 			origin:         "https://malicious.com",
 			allowedOrigins: []string{"https://example.com"},
 			host:           "localhost",
-			expected:       true,
+			expected:       false,
 		},
 		{
 			name:           "empty allowed list allows all (dev mode)",
@@ -497,6 +634,34 @@ func TestIsOriginAllowed(t *testing.T) {
 			origin:         "http://example.com",
 			allowedOrigins: []string{"https://example.com"},
 			host:           "localhost",
+			expected:       false,
+		},
+		{
+			name:           "port mismatch rejected",
+			origin:         "https://example.com:8443",
+			allowedOrigins: []string{"https://example.com"},
+			host:           "localhost",
+			expected:       false,
+		},
+		{
+			name:           "case and trailing slash ignored",
+			origin:         "https://App.Example.com",
+			allowedOrigins: []string{"https://app.example.com/"},
+			host:           "localhost",
+			expected:       true,
+		},
+		{
+			name:           "same origin allowed outside the list",
+			origin:         "https://gateway.example.com:8443",
+			allowedOrigins: []string{"https://example.com"},
+			host:           "gateway.example.com:8443",
+			expected:       true,
+		},
+		{
+			name:           "wildcard entry allows any origin",
+			origin:         "https://any-origin.com",
+			allowedOrigins: []string{"https://example.com", "*"},
+			host:           "localhost",
 			expected:       true,
 		},
 		{
@@ -649,6 +814,18 @@ func TestParsedArgsStruct(t *testing.T) {
 	assert.True(t, *args.enableRFX)
 }
 
+func TestFeatureOverrides(t *testing.T) {
+	assert.Empty(t, featureOverrides(parsedArgs{}))
+
+	enabled, disabled := true, false
+	args := parsedArgs{useNLA: &enabled, enableRFX: &disabled, enableUDP: &enabled}
+	assert.Equal(t, map[string]bool{
+		config.FeatureNLA: true,
+		config.FeatureRFX: false,
+		config.FeatureUDP: true,
+	}, featureOverrides(args))
+}
+
 func TestRunWithValidConfig(t *testing.T) {
 	// Start a listener to determine a free port
 	listener, err := net.Listen("tcp", "127.0.0.1:0")
@@ -742,6 +919,14 @@ func TestParseFlagsWithArgs(t *testing.T) {
 				assert.True(t, *args.useNLA)
 			},
 		},
+		{
+			name:           "config file flag",
+			args:           []string{"-config", " hosts.yaml "},
+			expectedAction: "",
+			checkArgs: func(t *testing.T, args parsedArgs) {
+				assert.Equal(t, "hosts.yaml", args.configFile)
+			},
+		},
 		{
 			name:           "no-rfx flag disables RFX",
 			args:           []string{"-no-rfx"},
@@ -751,6 +936,15 @@ func TestParseFlagsWithArgs(t *testing.T) {
 				assert.False(t, *args.enableRFX)
 			},
 		},
+		{
+			name:           "no-audio flag disables audio",
+			args:           []string{"-no-audio"},
+			expectedAction: "",
+			checkArgs: func(t *testing.T, args parsedArgs) {
+				require.NotNil(t, args.enableAudio)
+				assert.False(t, *args.enableAudio)
+			},
+		},
 		{
 			name:           "udp flag enables UDP transport",
 			args:           []string{"-udp"},
@@ -802,3 +996,62 @@ func TestParseFlagsWithArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestUDPMetricsHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/admin/metrics/udp", nil)
+	rec := httptest.NewRecorder()
+	udpMetricsHandler(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var body struct {
+		Connections []udpConnectionMetrics `json:"connections"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.NotNil(t, body.Connections, "connections is an empty array, not null")
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/metrics/udp", nil)
+	rec = httptest.NewRecorder()
+	udpMetricsHandler(rec, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestCreateServer_BasePath(t *testing.T) {
+	cfg := &config.Config{
+		Server: config.ServerConfig{
+			Host:     "localhost",
+			Port:     "8080",
+			BasePath: "/rdp",
+		},
+	}
+	ts := httptest.NewServer(createServer(cfg).Handler)
+	defer ts.Close()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	get := func(path string) (int, string) {
+		resp, err := client.Get(ts.URL + path)
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	status := func(path string) int {
+		code, _ := get(path)
+		return code
+	}
+
+	code, body := get("/rdp/")
+	require.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `<base href="/rdp/">`, "index page resolves assets under the base path")
+
+	assert.Equal(t, http.StatusNotFound, status("/rdp/metrics/udp"), "UDP metrics are only served on the admin listener")
+	assert.NotEqual(t, http.StatusNotFound, status("/rdp/connect"))
+	assert.Equal(t, http.StatusMovedPermanently, status("/rdp"))
+
+	for _, path := range []string{"/", "/connect", "/metrics/udp", "/index.html"} {
+		assert.Equal(t, http.StatusNotFound, status(path), "%s should not be served at the root", path)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/rcarmo/go-rdp/internal/transport/udp"
+)
+
+// udpConnectionMetrics is the JSON form of a UDP connection snapshot.
+type udpConnectionMetrics struct {
+	LocalAddr        string    `json:"localAddr,omitempty"`
+	RemoteAddr       string    `json:"remoteAddr,omitempty"`
+	State            string    `json:"state"`
+	PacketsSent      uint64    `json:"packetsSent"`
+	PacketsReceived  uint64    `json:"packetsReceived"`
+	BytesSent        uint64    `json:"bytesSent"`
+	BytesReceived    uint64    `json:"bytesReceived"`
+	Retransmits      uint64    `json:"retransmits"`
+	PacketsLost      uint64    `json:"packetsLost"`
+	CongestionEvents uint64    `json:"congestionEvents"`
+	CongestionWindow int       `json:"congestionWindow"`
+	SlowStartThresh  int       `json:"slowStartThreshold"`
+	RTTMillis        float64   `json:"rttMs"`
+	LastRecvTime     time.Time `json:"lastRecvTime"`
+}
+
+// udpMetricsHandler reports statistics for all active RDPEUDP connections.
+// It is served on the admin listener only, as it names the peers' addresses.
+func udpMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	snaps := udp.ActiveConnections()
+	metrics := make([]udpConnectionMetrics, 0, len(snaps))
+	for _, s := range snaps {
+		metrics = append(metrics, udpConnectionMetrics{
+			LocalAddr:        s.LocalAddr,
+			RemoteAddr:       s.RemoteAddr,
+			State:            s.State,
+			PacketsSent:      s.Stats.PacketsSent,
+			PacketsReceived:  s.Stats.PacketsReceived,
+			BytesSent:        s.Stats.BytesSent,
+			BytesReceived:    s.Stats.BytesReceived,
+			Retransmits:      s.Stats.Retransmits,
+			PacketsLost:      s.Stats.PacketsLost,
+			CongestionEvents: s.Stats.CongestionEvents,
+			CongestionWindow: s.CongestionWindow,
+			SlowStartThresh:  s.Stats.SlowStartThreshold,
+			RTTMillis:        float64(s.RTT) / float64(time.Millisecond),
+			LastRecvTime:     s.LastRecvTime,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(struct {
+		Connections []udpConnectionMetrics `json:"connections"`
+	}{metrics})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/rcarmo/go-rdp/web"
+)
+
+// subcommands maps subcommand names to their entry points. Each receives
+// the arguments following the subcommand name.
+var subcommands = map[string]func(args []string) error{
+	"bench-codec":   benchCodecCommand,
+	"export-assets": exportAssetsCommand,
+}
+
+// runSubcommand dispatches args to a subcommand if the first argument names
+// one. It reports whether a subcommand was run.
+func runSubcommand(args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+	cmd, ok := subcommands[args[0]]
+	if !ok {
+		return false, nil
+	}
+	return true, cmd(args[1:])
+}
+
+// exportAssetsCommand writes the embedded web assets to a directory so they
+// can be served from a CDN or another web server.
+func exportAssetsCommand(args []string) error {
+	if len(args) != 1 || args[0] == "" {
+		return errors.New("usage: go-rdp export-assets <dir>")
+	}
+
+	staticFS, err := web.DistFS()
+	if err != nil {
+		return fmt.Errorf("failed to load embedded assets: %w", err)
+	}
+
+	count, err := exportAssets(staticFS, args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d files to %s\n", count, args[0])
+	return nil
+}
+
+// exportAssets copies every file in src into dir, preserving the directory
+// structure, and returns the number of files written.
+func exportAssets(src fs.FS, dir string) (int, error) {
+	count := 0
+	err := fs.WalkDir(src, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(path))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755) // #nosec G301 -- exported assets are public web content
+		}
+
+		data, err := fs.ReadFile(src, path)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, data, 0o644); err != nil { // #nosec G306 -- exported assets are public web content
+			return err
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return count, fmt.Errorf("export assets: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunSubcommand_NotASubcommand(t *testing.T) {
+	handled, err := runSubcommand(nil)
+	assert.False(t, handled)
+	assert.NoError(t, err)
+
+	handled, err = runSubcommand([]string{"-port", "8080"})
+	assert.False(t, handled)
+	assert.NoError(t, err)
+}
+
+func TestExportAssets(t *testing.T) {
+	src := fstest.MapFS{
+		"index.html":          {Data: []byte("<html></html>")},
+		"js/client.bundle.js": {Data: []byte("var RDP;")},
+		"js/rle/rle.wasm":     {Data: []byte{0x00, 0x61, 0x73, 0x6d}},
+	}
+	dir := t.TempDir()
+
+	count, err := exportAssets(src, dir)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	for name, file := range src {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		require.NoError(t, err, "missing exported file %s", name)
+		assert.Equal(t, file.Data, data)
+	}
+}
+
+func TestExportAssetsCommand(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "assets")
+
+	handled, err := runSubcommand([]string{"export-assets", dir})
+	assert.True(t, handled)
+	require.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "index.html"))
+	assert.NoError(t, err, "embedded index.html should be exported")
+}
+
+func TestExportAssetsCommand_Usage(t *testing.T) {
+	handled, err := runSubcommand([]string{"export-assets"})
+	assert.True(t, handled)
+	assert.Error(t, err)
+}
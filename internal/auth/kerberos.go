@@ -0,0 +1,312 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/client"
+	krbconfig "github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/chksumtype"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// ErrKerberosRejected is returned when the server refuses the Kerberos
+// AP-REQ, either through SPNEGO or with a KRB-ERROR.
+var ErrKerberosRejected = errors.New("kerberos authentication rejected")
+
+// GSS-API context flags requested in the authenticator checksum (RFC 4121
+// Section 4.1.1.1)
+const kerberosContextFlags = gssapi.ContextFlagMutual | gssapi.ContextFlagReplay |
+	gssapi.ContextFlagSequence | gssapi.ContextFlagConf | gssapi.ContextFlagInteg
+
+// Wrap token layout (RFC 4121 Section 4.2.6.2)
+const (
+	wrapHeaderSize         = 16
+	wrapFlagSentByAcceptor = 0x01
+	wrapFlagSealed         = 0x02
+	wrapFlagAcceptorSubkey = 0x04
+)
+
+// Kerberos authenticates CredSSP with Kerberos through SPNEGO: an AP-REQ
+// for the server's TERMSRV service in a NegTokenInit, then the AP-REP in
+// the server's NegTokenResp completes a mutually authenticated context.
+type Kerberos struct {
+	domain, user, password string
+
+	client        *client.Client
+	ticket        messages.Ticket
+	sessionKey    types.EncryptionKey
+	authenticator types.Authenticator
+}
+
+// NewKerberos creates a Kerberos context for user in realm, finding the
+// realm's KDCs in krb5conf. An empty realm uses the krb5.conf default
+// realm. domain is only sent in the CredSSP credentials.
+func NewKerberos(domain, user, password, realm string, krb5conf *krbconfig.Config) *Kerberos {
+	return &Kerberos{
+		domain:   domain,
+		user:     user,
+		password: password,
+		client:   client.NewWithPassword(user, realm, password, krb5conf, client.DisablePAFXFAST(true)),
+	}
+}
+
+// GetServiceTicket logs in to the KDC and obtains a ticket for spn, such as
+// TERMSRV/host.example.com. Only the AES enctypes are supported, as they are
+// the ones using the RFC 4121 wrap tokens.
+func (k *Kerberos) GetServiceTicket(spn string) error {
+	if err := k.client.Login(); err != nil {
+		return fmt.Errorf("kerberos login: %w", err)
+	}
+	ticket, key, err := k.client.GetServiceTicket(spn)
+	if err != nil {
+		return fmt.Errorf("kerberos service ticket for %s: %w", spn, err)
+	}
+	if !isAESEtype(key.KeyType) {
+		return fmt.Errorf("kerberos service ticket for %s: unsupported session key enctype %d", spn, key.KeyType)
+	}
+	k.ticket = ticket
+	k.sessionKey = key
+	return nil
+}
+
+// GetNegTokenInit returns the SPNEGO NegTokenInit carrying an AP-REQ for
+// the service ticket, requesting mutual authentication. GetServiceTicket
+// must have succeeded.
+func (k *Kerberos) GetNegTokenInit() ([]byte, error) {
+	if len(k.sessionKey.KeyValue) == 0 {
+		return nil, errors.New("kerberos: no service ticket")
+	}
+
+	authenticator, err := types.NewAuthenticator(k.client.Credentials.Domain(), k.client.Credentials.CName())
+	if err != nil {
+		return nil, fmt.Errorf("kerberos authenticator: %w", err)
+	}
+	authenticator.Cksum = types.Checksum{
+		CksumType: chksumtype.GSSAPI,
+		Checksum:  gssChecksum(kerberosContextFlags),
+	}
+	etype, err := crypto.GetEtype(k.sessionKey.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	if err := authenticator.GenerateSeqNumberAndSubKey(k.sessionKey.KeyType, etype.GetKeyByteSize()); err != nil {
+		return nil, fmt.Errorf("kerberos subkey: %w", err)
+	}
+
+	apReq, err := messages.NewAPReq(k.ticket, k.sessionKey, authenticator)
+	if err != nil {
+		return nil, fmt.Errorf("kerberos AP-REQ: %w", err)
+	}
+	types.SetFlag(&apReq.APOptions, flags.APOptionMutualRequired)
+	apReqBytes, err := apReq.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("kerberos AP-REQ: %w", err)
+	}
+	k.authenticator = authenticator
+
+	// InitialContextToken: the mechanism OID, TOK_ID 01 00 and the AP-REQ
+	// (RFC 4121 Section 4.1)
+	mechToken, _ := asn1.Marshal(gssapi.OIDKRB5.OID())
+	mechToken = append(mechToken, 0x01, 0x00)
+	mechToken = asn1tools.AddASNAppTag(append(mechToken, apReqBytes...), 0)
+
+	token := spnego.SPNEGOToken{
+		Init: true,
+		NegTokenInit: spnego.NegTokenInit{
+			MechTypes:      []asn1.ObjectIdentifier{gssapi.OIDKRB5.OID()},
+			MechTokenBytes: mechToken,
+		},
+	}
+	return token.Marshal()
+}
+
+// ProcessNegTokenResp checks the server's SPNEGO NegTokenResp and the AP-REP
+// it carries, returning the security context for pubKeyAuth and authInfo.
+func (k *Kerberos) ProcessNegTokenResp(data []byte) (*KerberosSecurity, error) {
+	if len(k.authenticator.SubKey.KeyValue) == 0 {
+		return nil, errors.New("kerberos: no AP-REQ sent")
+	}
+
+	var token spnego.SPNEGOToken
+	if err := token.Unmarshal(data); err != nil {
+		return nil, fmt.Errorf("kerberos: %w", err)
+	}
+	if !token.Resp {
+		return nil, errors.New("kerberos: server token is not a NegTokenResp")
+	}
+	resp := token.NegTokenResp
+	if resp.State() == spnego.NegStateReject {
+		return nil, ErrKerberosRejected
+	}
+	if len(resp.ResponseToken) == 0 {
+		return nil, errors.New("kerberos: server sent no AP-REP")
+	}
+
+	var mechToken spnego.KRB5Token
+	if err := mechToken.Unmarshal(resp.ResponseToken); err != nil {
+		return nil, fmt.Errorf("kerberos: %w", err)
+	}
+	if mechToken.IsKRBError() {
+		return nil, fmt.Errorf("%w: %s", ErrKerberosRejected, mechToken.KRBError.Error())
+	}
+	if !mechToken.IsAPRep() {
+		return nil, errors.New("kerberos: server token is not an AP-REP")
+	}
+
+	plain, err := crypto.DecryptEncPart(mechToken.APRep.EncPart, k.sessionKey, keyusage.AP_REP_ENCPART)
+	if err != nil {
+		return nil, fmt.Errorf("kerberos AP-REP: %w", err)
+	}
+	var part messages.EncAPRepPart
+	if err := part.Unmarshal(plain); err != nil {
+		return nil, err
+	}
+	// The AP-REP proves the server read our authenticator by echoing its time
+	if part.CTime.Unix() != k.authenticator.CTime.Unix() || part.Cusec != k.authenticator.Cusec {
+		return nil, errors.New("kerberos AP-REP does not match the authenticator")
+	}
+
+	security := &KerberosSecurity{
+		initiatorKey: k.authenticator.SubKey,
+		sendSeq:      uint64(k.authenticator.SeqNumber), // #nosec G115 -- generated non-negative
+		recvSeq:      uint64(part.SequenceNumber),       // #nosec G115 -- sequence numbers are unsigned
+	}
+	if len(part.Subkey.KeyValue) > 0 {
+		if !isAESEtype(part.Subkey.KeyType) {
+			return nil, fmt.Errorf("kerberos AP-REP: unsupported subkey enctype %d", part.Subkey.KeyType)
+		}
+		security.acceptorKey = part.Subkey
+	}
+	return security, nil
+}
+
+// GetCredSSPCredentials returns domain, user, password as UTF-16LE for CredSSP TSCredentials
+func (k *Kerberos) GetCredSSPCredentials() ([]byte, []byte, []byte) {
+	return unicodeEncode(k.domain), unicodeEncode(k.user), unicodeEncode(k.password)
+}
+
+// KerberosSecurity seals and unseals CredSSP messages with RFC 4121 wrap
+// tokens, under the acceptor's subkey when the AP-REP asserted one and our
+// authenticator subkey otherwise.
+type KerberosSecurity struct {
+	initiatorKey types.EncryptionKey
+	acceptorKey  types.EncryptionKey
+	sendSeq      uint64
+	recvSeq      uint64
+}
+
+// GssEncrypt seals data in a wrap token, returning nil on failure
+func (s *KerberosSecurity) GssEncrypt(data []byte) []byte {
+	key, tokenFlags := s.initiatorKey, byte(wrapFlagSealed)
+	if len(s.acceptorKey.KeyValue) > 0 {
+		key, tokenFlags = s.acceptorKey, tokenFlags|wrapFlagAcceptorSubkey
+	}
+	token, err := wrapToken(key, keyusage.GSSAPI_INITIATOR_SEAL, tokenFlags, s.sendSeq, 0, data)
+	if err != nil {
+		return nil
+	}
+	s.sendSeq++
+	return token
+}
+
+// GssDecrypt unseals a wrap token from the server, returning nil when it is
+// malformed, out of sequence or fails its integrity check
+func (s *KerberosSecurity) GssDecrypt(data []byte) []byte {
+	if len(data) < wrapHeaderSize || data[0] != 0x05 || data[1] != 0x04 || data[3] != 0xFF {
+		return nil
+	}
+	tokenFlags := data[2]
+	if tokenFlags&wrapFlagSentByAcceptor == 0 || tokenFlags&wrapFlagSealed == 0 {
+		return nil
+	}
+	key := s.initiatorKey
+	if tokenFlags&wrapFlagAcceptorSubkey != 0 {
+		if len(s.acceptorKey.KeyValue) == 0 {
+			return nil
+		}
+		key = s.acceptorKey
+	}
+	ec := int(binary.BigEndian.Uint16(data[4:6]))
+	rrc := int(binary.BigEndian.Uint16(data[6:8]))
+	if binary.BigEndian.Uint64(data[8:16]) != s.recvSeq {
+		return nil
+	}
+
+	// Undo the right rotation applied after the header (RFC 4121 Section 4.2.5)
+	body := data[wrapHeaderSize:]
+	if len(body) == 0 {
+		return nil
+	}
+	rrc %= len(body)
+	body = append(append([]byte{}, body[rrc:]...), body[:rrc]...)
+
+	plain, err := crypto.DecryptMessage(body, key, keyusage.GSSAPI_ACCEPTOR_SEAL)
+	if err != nil || len(plain) < wrapHeaderSize+ec {
+		return nil
+	}
+	// The sealed copy of the header has a zero RRC
+	header := append([]byte{}, data[:wrapHeaderSize]...)
+	header[6], header[7] = 0, 0
+	if !bytes.Equal(plain[len(plain)-wrapHeaderSize:], header) {
+		return nil
+	}
+
+	s.recvSeq++
+	return plain[:len(plain)-wrapHeaderSize-ec]
+}
+
+// wrapToken builds a sealed wrap token with no filler, encrypting data and a
+// copy of the header, then rotating the ciphertext right by rrc bytes
+func wrapToken(key types.EncryptionKey, usage uint32, tokenFlags byte, seq uint64, rrc uint16, data []byte) ([]byte, error) {
+	header := make([]byte, wrapHeaderSize)
+	header[0], header[1] = 0x05, 0x04
+	header[2] = tokenFlags
+	header[3] = 0xFF
+	binary.BigEndian.PutUint64(header[8:], seq)
+
+	etype, err := crypto.GetEtype(key.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	plain := append(append([]byte{}, data...), header...)
+	_, sealed, err := etype.EncryptMessage(key.KeyValue, plain, usage)
+	if err != nil {
+		return nil, err
+	}
+
+	binary.BigEndian.PutUint16(header[6:8], rrc)
+	n := int(rrc) % len(sealed)
+	rotated := append(append([]byte{}, sealed[len(sealed)-n:]...), sealed[:len(sealed)-n]...)
+	return append(header, rotated...), nil
+}
+
+// gssChecksum builds the authenticator checksum of RFC 4121 Section 4.1.1:
+// the length of the (empty) channel bindings hash, the hash, then the flags
+func gssChecksum(contextFlags uint32) []byte {
+	checksum := make([]byte, 24)
+	binary.LittleEndian.PutUint32(checksum[0:4], 16)
+	binary.LittleEndian.PutUint32(checksum[20:24], contextFlags)
+	return checksum
+}
+
+// isAESEtype reports whether etype is one of the AES enctypes (RFC 3962, RFC 8009)
+func isAESEtype(etype int32) bool {
+	switch etype {
+	case etypeID.AES128_CTS_HMAC_SHA1_96, etypeID.AES256_CTS_HMAC_SHA1_96,
+		etypeID.AES128_CTS_HMAC_SHA256_128, etypeID.AES256_CTS_HMAC_SHA384_192:
+		return true
+	}
+	return false
+}
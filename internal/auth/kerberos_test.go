@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	krbconfig "github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+func testAESKey(fill byte) types.EncryptionKey {
+	return types.EncryptionKey{
+		KeyType:  etypeID.AES256_CTS_HMAC_SHA1_96,
+		KeyValue: bytes.Repeat([]byte{fill}, 32),
+	}
+}
+
+// newTestKerberos returns a Kerberos context holding a service ticket, as
+// GetServiceTicket leaves it, without contacting a KDC
+func newTestKerberos(t *testing.T) *Kerberos {
+	t.Helper()
+	k := NewKerberos("EXAMPLE", "alice", "secret", "EXAMPLE.COM", krbconfig.New())
+	k.sessionKey = testAESKey(0x11)
+	encPart, err := crypto.GetEncryptedData([]byte("ticket"), testAESKey(0x22), keyusage.KDC_REP_TICKET, 1)
+	if err != nil {
+		t.Fatalf("GetEncryptedData() error = %v", err)
+	}
+	k.ticket = messages.Ticket{
+		TktVNO:  5,
+		Realm:   "EXAMPLE.COM",
+		SName:   types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "TERMSRV/host.example.com"),
+		EncPart: encPart,
+	}
+	return k
+}
+
+// apRepToken builds the server's NegTokenResp carrying an AP-REP for part
+func apRepToken(t *testing.T, sessionKey types.EncryptionKey, part messages.EncAPRepPart) []byte {
+	t.Helper()
+	partBytes, err := asn1.Marshal(part)
+	if err != nil {
+		t.Fatalf("marshal EncAPRepPart: %v", err)
+	}
+	partBytes = asn1tools.AddASNAppTag(partBytes, asnAppTag.EncAPRepPart)
+	encPart, err := crypto.GetEncryptedData(partBytes, sessionKey, keyusage.AP_REP_ENCPART, 0)
+	if err != nil {
+		t.Fatalf("GetEncryptedData() error = %v", err)
+	}
+	apRep, err := asn1.Marshal(messages.APRep{PVNO: 5, MsgType: msgtype.KRB_AP_REP, EncPart: encPart})
+	if err != nil {
+		t.Fatalf("marshal AP-REP: %v", err)
+	}
+	apRep = asn1tools.AddASNAppTag(apRep, asnAppTag.APREP)
+
+	mechToken, _ := asn1.Marshal(gssapi.OIDKRB5.OID())
+	mechToken = append(mechToken, 0x02, 0x00)
+	mechToken = asn1tools.AddASNAppTag(append(mechToken, apRep...), 0)
+
+	token := spnego.SPNEGOToken{
+		Resp: true,
+		NegTokenResp: spnego.NegTokenResp{
+			NegState:      asn1.Enumerated(spnego.NegStateAcceptCompleted),
+			SupportedMech: gssapi.OIDKRB5.OID(),
+			ResponseToken: mechToken,
+		},
+	}
+	data, err := token.Marshal()
+	if err != nil {
+		t.Fatalf("marshal NegTokenResp: %v", err)
+	}
+	return data
+}
+
+func TestKerberos_GetNegTokenInit(t *testing.T) {
+	k := newTestKerberos(t)
+
+	data, err := k.GetNegTokenInit()
+	if err != nil {
+		t.Fatalf("GetNegTokenInit() error = %v", err)
+	}
+
+	var token spnego.SPNEGOToken
+	if err := token.Unmarshal(data); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !token.Init {
+		t.Fatal("token is not a NegTokenInit")
+	}
+	mechTypes := token.NegTokenInit.MechTypes
+	if len(mechTypes) != 1 || !mechTypes[0].Equal(gssapi.OIDKRB5.OID()) {
+		t.Errorf("MechTypes = %v, want Kerberos 5 only", mechTypes)
+	}
+
+	var mechToken spnego.KRB5Token
+	if err := mechToken.Unmarshal(token.NegTokenInit.MechTokenBytes); err != nil {
+		t.Fatalf("mechToken Unmarshal() error = %v", err)
+	}
+	if !mechToken.IsAPReq() {
+		t.Fatal("mechToken is not an AP-REQ")
+	}
+	if !types.IsFlagSet(&mechToken.APReq.APOptions, flags.APOptionMutualRequired) {
+		t.Error("AP-REQ does not request mutual authentication")
+	}
+	if err := mechToken.APReq.DecryptAuthenticator(k.sessionKey); err != nil {
+		t.Fatalf("DecryptAuthenticator() error = %v", err)
+	}
+	authenticator := mechToken.APReq.Authenticator
+	if len(authenticator.SubKey.KeyValue) != 32 {
+		t.Errorf("authenticator subkey is %d bytes, want 32", len(authenticator.SubKey.KeyValue))
+	}
+	if got := binary.LittleEndian.Uint32(authenticator.Cksum.Checksum[20:24]); got != kerberosContextFlags {
+		t.Errorf("checksum flags = %#x, want %#x", got, kerberosContextFlags)
+	}
+}
+
+func TestKerberos_GetNegTokenInitWithoutTicket(t *testing.T) {
+	k := NewKerberos("EXAMPLE", "alice", "secret", "EXAMPLE.COM", krbconfig.New())
+	if _, err := k.GetNegTokenInit(); err == nil {
+		t.Error("GetNegTokenInit() without a service ticket succeeded")
+	}
+}
+
+func TestKerberos_ProcessNegTokenResp(t *testing.T) {
+	k := newTestKerberos(t)
+	if _, err := k.GetNegTokenInit(); err != nil {
+		t.Fatalf("GetNegTokenInit() error = %v", err)
+	}
+	acceptorKey := testAESKey(0x33)
+	part := messages.EncAPRepPart{
+		CTime:          k.authenticator.CTime,
+		Cusec:          k.authenticator.Cusec,
+		Subkey:         acceptorKey,
+		SequenceNumber: 500,
+	}
+
+	security, err := k.ProcessNegTokenResp(apRepToken(t, k.sessionKey, part))
+	if err != nil {
+		t.Fatalf("ProcessNegTokenResp() error = %v", err)
+	}
+	if !bytes.Equal(security.acceptorKey.KeyValue, acceptorKey.KeyValue) {
+		t.Error("security context does not use the acceptor subkey")
+	}
+	if security.recvSeq != 500 {
+		t.Errorf("recvSeq = %d, want 500 from the AP-REP", security.recvSeq)
+	}
+	if security.sendSeq != uint64(k.authenticator.SeqNumber) {
+		t.Errorf("sendSeq = %d, want %d from the authenticator", security.sendSeq, k.authenticator.SeqNumber)
+	}
+}
+
+func TestKerberos_ProcessNegTokenRespErrors(t *testing.T) {
+	k := newTestKerberos(t)
+	if _, err := k.GetNegTokenInit(); err != nil {
+		t.Fatalf("GetNegTokenInit() error = %v", err)
+	}
+
+	// An AP-REP that does not echo our authenticator is not from the server
+	stale := messages.EncAPRepPart{CTime: k.authenticator.CTime.Add(-time.Hour), Cusec: k.authenticator.Cusec}
+	if _, err := k.ProcessNegTokenResp(apRepToken(t, k.sessionKey, stale)); err == nil {
+		t.Error("ProcessNegTokenResp() accepted an AP-REP for another authenticator")
+	}
+
+	// An AP-REP sealed under another key fails to decrypt
+	part := messages.EncAPRepPart{CTime: k.authenticator.CTime, Cusec: k.authenticator.Cusec}
+	if _, err := k.ProcessNegTokenResp(apRepToken(t, testAESKey(0x44), part)); err == nil {
+		t.Error("ProcessNegTokenResp() accepted an AP-REP under the wrong key")
+	}
+
+	reject := spnego.SPNEGOToken{Resp: true, NegTokenResp: spnego.NegTokenResp{NegState: asn1.Enumerated(spnego.NegStateReject)}}
+	data, err := reject.Marshal()
+	if err != nil {
+		t.Fatalf("marshal NegTokenResp: %v", err)
+	}
+	if _, err := k.ProcessNegTokenResp(data); !errors.Is(err, ErrKerberosRejected) {
+		t.Errorf("ProcessNegTokenResp(reject) error = %v, want ErrKerberosRejected", err)
+	}
+}
+
+func TestKerberosSecurity_GssEncrypt(t *testing.T) {
+	security := &KerberosSecurity{initiatorKey: testAESKey(0x11), acceptorKey: testAESKey(0x33), sendSeq: 7}
+
+	token := security.GssEncrypt([]byte("pubKeyAuth"))
+	if token == nil {
+		t.Fatal("GssEncrypt() returned nil")
+	}
+	if token[0] != 0x05 || token[1] != 0x04 || token[3] != 0xFF {
+		t.Fatalf("header = % x, want a wrap token", token[:4])
+	}
+	if token[2] != wrapFlagSealed|wrapFlagAcceptorSubkey {
+		t.Errorf("flags = %#x, want sealed under the acceptor subkey", token[2])
+	}
+	if seq := binary.BigEndian.Uint64(token[8:16]); seq != 7 {
+		t.Errorf("SND_SEQ = %d, want 7", seq)
+	}
+
+	plain, err := crypto.DecryptMessage(token[wrapHeaderSize:], testAESKey(0x33), keyusage.GSSAPI_INITIATOR_SEAL)
+	if err != nil {
+		t.Fatalf("DecryptMessage() error = %v", err)
+	}
+	if !bytes.Equal(plain[:len(plain)-wrapHeaderSize], []byte("pubKeyAuth")) {
+		t.Errorf("sealed data = %q, want %q", plain[:len(plain)-wrapHeaderSize], "pubKeyAuth")
+	}
+	if !bytes.Equal(plain[len(plain)-wrapHeaderSize:], token[:wrapHeaderSize]) {
+		t.Error("sealed header copy does not match the token header")
+	}
+	if security.sendSeq != 8 {
+		t.Errorf("sendSeq = %d after one token, want 8", security.sendSeq)
+	}
+}
+
+func TestKerberosSecurity_GssDecrypt(t *testing.T) {
+	acceptorKey := testAESKey(0x33)
+	acceptorFlags := byte(wrapFlagSentByAcceptor | wrapFlagSealed | wrapFlagAcceptorSubkey)
+	security := &KerberosSecurity{initiatorKey: testAESKey(0x11), acceptorKey: acceptorKey, recvSeq: 500}
+
+	// Windows rotates sealed tokens by 28 bytes
+	token, err := wrapToken(acceptorKey, keyusage.GSSAPI_ACCEPTOR_SEAL, acceptorFlags, 500, 28, []byte("server pubKeyAuth"))
+	if err != nil {
+		t.Fatalf("wrapToken() error = %v", err)
+	}
+	if got := security.GssDecrypt(token); !bytes.Equal(got, []byte("server pubKeyAuth")) {
+		t.Fatalf("GssDecrypt() = %q, want %q", got, "server pubKeyAuth")
+	}
+
+	// Replaying the token is out of sequence
+	if got := security.GssDecrypt(token); got != nil {
+		t.Error("GssDecrypt() accepted a replayed token")
+	}
+
+	next, _ := wrapToken(acceptorKey, keyusage.GSSAPI_ACCEPTOR_SEAL, acceptorFlags, 501, 0, []byte("credentials ack"))
+	tampered := append([]byte{}, next...)
+	tampered[len(tampered)-1] ^= 0xFF
+	if got := security.GssDecrypt(tampered); got != nil {
+		t.Error("GssDecrypt() accepted a tampered token")
+	}
+
+	// Our own tokens are not sent by the acceptor
+	own, _ := wrapToken(acceptorKey, keyusage.GSSAPI_INITIATOR_SEAL, wrapFlagSealed|wrapFlagAcceptorSubkey, 501, 0, []byte("reflected"))
+	if got := security.GssDecrypt(own); got != nil {
+		t.Error("GssDecrypt() accepted a token sent by the initiator")
+	}
+
+	if got := security.GssDecrypt(next); !bytes.Equal(got, []byte("credentials ack")) {
+		t.Errorf("GssDecrypt() = %q, want %q", got, "credentials ack")
+	}
+}
@@ -0,0 +1,111 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/rcarmo/go-rdp/internal/codec/h264"
+)
+
+// ErrInvalidAVC420Metablock is returned when an RFX_AVC420_METABLOCK is
+// truncated or malformed.
+var ErrInvalidAVC420Metablock = errors.New("invalid AVC420 metablock")
+
+// AVC420Region is one entry of the RFX_AVC420_METABLOCK (MS-RDPEGFX
+// 2.2.4.4.1): a changed rectangle (right and bottom exclusive) and the
+// quantization and quality the encoder used for it.
+type AVC420Region struct {
+	Left, Top, Right, Bottom uint16
+	QP                       uint8
+	Progressive              bool
+	Quality                  uint8
+}
+
+// AVC420Metablock is a parsed RFX_AVC420_METABLOCK and the H.264 Annex B
+// bitstream that follows it.
+type AVC420Metablock struct {
+	Regions   []AVC420Region
+	Bitstream []byte
+}
+
+// ParseAVC420Metablock parses an RFX_AVC420_BITMAP_STREAM.
+func ParseAVC420Metablock(data []byte) (*AVC420Metablock, error) {
+	if len(data) < 4 {
+		return nil, ErrInvalidAVC420Metablock
+	}
+	numRects := int(binary.LittleEndian.Uint32(data))
+	if numRects > (len(data)-4)/10 {
+		return nil, ErrInvalidAVC420Metablock
+	}
+
+	rects := data[4:]
+	quant := rects[numRects*8:]
+	m := &AVC420Metablock{
+		Regions:   make([]AVC420Region, numRects),
+		Bitstream: quant[numRects*2:],
+	}
+	for i := range m.Regions {
+		r := &m.Regions[i]
+		r.Left = binary.LittleEndian.Uint16(rects[i*8:])
+		r.Top = binary.LittleEndian.Uint16(rects[i*8+2:])
+		r.Right = binary.LittleEndian.Uint16(rects[i*8+4:])
+		r.Bottom = binary.LittleEndian.Uint16(rects[i*8+6:])
+		if r.Right < r.Left || r.Bottom < r.Top {
+			return nil, ErrInvalidAVC420Metablock
+		}
+		r.QP = quant[i*2] & 0x3F
+		r.Progressive = quant[i*2]&0x80 != 0
+		r.Quality = quant[i*2+1]
+	}
+	return m, nil
+}
+
+// DecodeAVC420ToRGBA decodes an AVC420 bitmap stream (metablock followed by
+// an H.264 Annex B bitstream) to width x height RGBA pixels. Only pixels
+// inside the metablock's region rectangles are opaque; the rest are left
+// transparent so the result can be composited over the existing surface.
+// Returns nil if the stream is malformed or uses H.264 features beyond the
+// Baseline intra subset (e.g. CABAC or P slices), so callers can fall back
+// to another codec.
+func DecodeAVC420ToRGBA(src []byte, width, height int) []byte {
+	if width <= 0 || height <= 0 {
+		return nil
+	}
+	m, err := ParseAVC420Metablock(src)
+	if err != nil {
+		return nil
+	}
+	frame, err := h264.DecodeFrame(m.Bitstream)
+	if err != nil {
+		return nil
+	}
+	if frame.Width < width || frame.Height < height {
+		return nil
+	}
+
+	rgba := make([]byte, width*height*4)
+	for _, r := range m.Regions {
+		right, bottom := min(int(r.Right), width), min(int(r.Bottom), height)
+		for y := int(r.Top); y < bottom; y++ {
+			yRow := frame.Y[y*frame.YStride:]
+			cRow := (y / 2) * frame.CStride
+			for x := int(r.Left); x < right; x++ {
+				i := (y*width + x) * 4
+				yuvToRGBA(rgba[i:i+4], yRow[x], frame.Cb[cRow+x/2], frame.Cr[cRow+x/2])
+			}
+		}
+	}
+	return rgba
+}
+
+// yuvToRGBA converts one full-range BT.709 sample, as MS-RDPEGFX AVC420
+// frames are encoded, to an opaque RGBA pixel.
+func yuvToRGBA(dst []byte, y, u, v byte) {
+	c := 256 * int(y)
+	d := int(u) - 128
+	e := int(v) - 128
+	dst[0] = byte(clamp((c + 403*e) >> 8))
+	dst[1] = byte(clamp((c - 48*d - 120*e) >> 8))
+	dst[2] = byte(clamp((c + 475*d) >> 8))
+	dst[3] = 255
+}
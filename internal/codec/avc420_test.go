@@ -0,0 +1,92 @@
+package codec
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// avc420Stream wraps an H.264 bitstream in an RFX_AVC420_METABLOCK.
+func avc420Stream(regions []AVC420Region, bitstream []byte) []byte {
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(len(regions))) // #nosec G115 -- test data
+	for _, r := range regions {
+		buf = binary.LittleEndian.AppendUint16(buf, r.Left)
+		buf = binary.LittleEndian.AppendUint16(buf, r.Top)
+		buf = binary.LittleEndian.AppendUint16(buf, r.Right)
+		buf = binary.LittleEndian.AppendUint16(buf, r.Bottom)
+	}
+	for _, r := range regions {
+		qp := r.QP
+		if r.Progressive {
+			qp |= 0x80
+		}
+		buf = append(buf, qp, r.Quality)
+	}
+	return append(buf, bitstream...)
+}
+
+func TestParseAVC420Metablock(t *testing.T) {
+	regions := []AVC420Region{
+		{Left: 0, Top: 0, Right: 64, Bottom: 32, QP: 22, Quality: 100},
+		{Left: 16, Top: 32, Right: 48, Bottom: 48, QP: 30, Progressive: true, Quality: 50},
+	}
+	m, err := ParseAVC420Metablock(avc420Stream(regions, []byte{0, 0, 0, 1, 0x67}))
+	require.NoError(t, err)
+	assert.Equal(t, regions, m.Regions)
+	assert.Equal(t, []byte{0, 0, 0, 1, 0x67}, m.Bitstream)
+
+	_, err = ParseAVC420Metablock([]byte{1, 0})
+	assert.ErrorIs(t, err, ErrInvalidAVC420Metablock)
+
+	_, err = ParseAVC420Metablock([]byte{2, 0, 0, 0, 1, 2, 3})
+	assert.ErrorIs(t, err, ErrInvalidAVC420Metablock, "region count exceeds data")
+
+	inverted := avc420Stream([]AVC420Region{{Left: 10, Right: 5, Bottom: 1}}, nil)
+	_, err = ParseAVC420Metablock(inverted)
+	assert.ErrorIs(t, err, ErrInvalidAVC420Metablock)
+}
+
+func TestDecodeAVC420ToRGBA(t *testing.T) {
+	bitstream, err := os.ReadFile("h264/testdata/intra_48x40.264")
+	require.NoError(t, err)
+	yuv, err := os.ReadFile("h264/testdata/intra_48x40.yuv")
+	require.NoError(t, err)
+
+	src := avc420Stream([]AVC420Region{{Left: 8, Top: 4, Right: 40, Bottom: 40}}, bitstream)
+	rgba := DecodeAVC420ToRGBA(src, 48, 40)
+	require.Len(t, rgba, 48*40*4)
+
+	// Outside the region: transparent
+	assert.Equal(t, []byte{0, 0, 0, 0}, rgba[0:4])
+	assert.Equal(t, byte(0), rgba[(3*48+20)*4+3])
+
+	// Inside: the reference frame converted to RGB
+	cb, cr := yuv[48*40:], yuv[48*40+24*20:]
+	for _, p := range [][2]int{{8, 4}, {20, 17}, {39, 39}} {
+		x, y := p[0], p[1]
+		want := make([]byte, 4)
+		yuvToRGBA(want, yuv[y*48+x], cb[(y/2)*24+x/2], cr[(y/2)*24+x/2])
+		i := (y*48 + x) * 4
+		assert.Equal(t, want, rgba[i:i+4], "pixel (%d,%d)", x, y)
+	}
+
+	// Regions extending past the surface are clipped
+	src = avc420Stream([]AVC420Region{{Right: 1000, Bottom: 1000}}, bitstream)
+	rgba = DecodeAVC420ToRGBA(src, 48, 40)
+	require.NotNil(t, rgba)
+	assert.Equal(t, byte(255), rgba[len(rgba)-1])
+}
+
+func TestDecodeAVC420ToRGBA_Unsupported(t *testing.T) {
+	bitstream, err := os.ReadFile("h264/testdata/intra_48x40.264")
+	require.NoError(t, err)
+	region := []AVC420Region{{Right: 48, Bottom: 40}}
+
+	assert.Nil(t, DecodeAVC420ToRGBA(avc420Stream(region, bitstream), 64, 64), "surface larger than the frame")
+	assert.Nil(t, DecodeAVC420ToRGBA(avc420Stream(region, []byte{0, 0, 1, 0x67, 100}), 48, 40), "High profile")
+	assert.Nil(t, DecodeAVC420ToRGBA(avc420Stream(region, nil), 48, 40), "no picture")
+	assert.Nil(t, DecodeAVC420ToRGBA(nil, 48, 40))
+}
@@ -0,0 +1,101 @@
+// Package bulk implements RDP bulk decompression (MS-RDPBCGR 3.1.8) for
+// server-to-client PDUs. The RDP 4.0 (MPPC-8K) and RDP 5.0 (MPPC-64K)
+// compression types are supported; RDP 6.0 and 6.1 (NCRUSH, XCRUSH) are not.
+package bulk
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Compression flags carried in the fast-path compressionFlags field and the
+// slow-path compressedType field (MS-RDPBCGR 2.2.8.1.1.1.2)
+const (
+	// TypeMask selects the compression type (PACKET_COMPR_TYPE_*)
+	TypeMask uint8 = 0x0F
+
+	// FlagCompressed PACKET_COMPRESSED
+	FlagCompressed uint8 = 0x20
+
+	// FlagAtFront PACKET_AT_FRONT
+	FlagAtFront uint8 = 0x40
+
+	// FlagFlushed PACKET_FLUSHED
+	FlagFlushed uint8 = 0x80
+)
+
+// Compression types (MS-RDPBCGR 2.2.1.11.1.1)
+const (
+	Type8K    uint8 = 0x0 // PACKET_COMPR_TYPE_8K (RDP 4.0)
+	Type64K   uint8 = 0x1 // PACKET_COMPR_TYPE_64K (RDP 5.0)
+	TypeRDP6  uint8 = 0x2 // PACKET_COMPR_TYPE_RDP6
+	TypeRDP61 uint8 = 0x3 // PACKET_COMPR_TYPE_RDP61
+)
+
+const (
+	historySize8K  = 8192
+	historySize64K = 65536
+)
+
+var (
+	// ErrUnsupportedType is returned for compression types other than 8K and 64K.
+	ErrUnsupportedType = errors.New("bulk: unsupported compression type")
+
+	// ErrCorrupt is returned when compressed data references data outside the history buffer.
+	ErrCorrupt = errors.New("bulk: corrupt compressed data")
+)
+
+// Decompressor holds the MPPC history buffer shared by consecutive PDUs.
+// The server compresses fast-path and slow-path output with one context, so
+// a connection must use a single Decompressor for both. It is not safe for
+// concurrent use.
+type Decompressor struct {
+	history       [historySize64K]byte
+	historyOffset int
+	historySize   int
+}
+
+// NewDecompressor creates a decompressor with an empty history
+func NewDecompressor() *Decompressor {
+	return &Decompressor{historySize: historySize64K}
+}
+
+// Decompress decodes src according to flags and returns the uncompressed
+// data. Data without FlagCompressed is returned unchanged after applying the
+// flush and at-front flags. The returned slice is only valid until the next call.
+func (d *Decompressor) Decompress(src []byte, flags uint8) ([]byte, error) {
+	var size int
+	switch flags & TypeMask {
+	case Type8K:
+		size = historySize8K
+	case Type64K:
+		size = historySize64K
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedType, flags&TypeMask)
+	}
+
+	if size != d.historySize {
+		d.historySize = size
+		flags |= FlagFlushed
+	}
+
+	if flags&FlagFlushed != 0 {
+		clear(d.history[:])
+		d.historyOffset = 0
+	}
+
+	if flags&FlagAtFront != 0 {
+		d.historyOffset = 0
+	}
+
+	if flags&FlagCompressed == 0 {
+		return src, nil
+	}
+
+	start := d.historyOffset
+	if err := d.decode(src); err != nil {
+		return nil, err
+	}
+
+	return d.history[start:d.historyOffset], nil
+}
@@ -0,0 +1,244 @@
+package bulk
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bells is the example text compressed in MS-RDPBCGR 3.1.8.4.1.2 and 3.1.8.4.2.2
+const bells = "for.whom.the.bell.tolls,.the.bell.tolls.for.thee!"
+
+var (
+	bellsRDP4 = []byte("for.whom.the.bell.tolls,\xf4\x37\x2e\x66\xfa\x1f\x19\x94\x84")
+	bellsRDP5 = []byte("for.whom.the.bell.tolls,\xfa\x1b\x97\x33\x7e\x87\xe3\x32\x90\x80")
+)
+
+// bitWriter writes an MSB-first bit stream
+type bitWriter struct {
+	buf   []byte
+	nbits int
+}
+
+func (w *bitWriter) writeBits(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.nbits%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>i&1 == 1 {
+			w.buf[len(w.buf)-1] |= 0x80 >> (w.nbits % 8)
+		}
+		w.nbits++
+	}
+}
+
+// mppcEncoder is a greedy MPPC compressor used to produce test streams
+type mppcEncoder struct {
+	history []byte
+	size    int
+}
+
+// compress encodes data, restarting at the front of the history when it
+// would overflow, and returns the stream with the flags to send it with
+func (e *mppcEncoder) compress(data []byte) ([]byte, uint8) {
+	var (
+		w     bitWriter
+		flags = FlagCompressed
+	)
+	if len(e.history)+len(data) > e.size {
+		e.history = e.history[:0]
+		flags |= FlagAtFront
+	}
+	start := len(e.history)
+	e.history = append(e.history, data...)
+
+	for pos := start; pos < len(e.history); {
+		bestLen, bestOff := 0, 0
+		for src := max(0, pos-e.size+1); src < pos; src++ {
+			n := 0
+			for pos+n < len(e.history) && e.history[src+n] == e.history[pos+n] {
+				n++
+			}
+			if n > bestLen {
+				bestLen, bestOff = n, pos-src
+			}
+		}
+
+		if bestLen < 3 {
+			if b := e.history[pos]; b < 0x80 {
+				w.writeBits(int(b), 8)
+			} else {
+				w.writeBits(0x2, 2)
+				w.writeBits(int(b&0x7F), 7)
+			}
+			pos++
+			continue
+		}
+
+		e.writeOffset(&w, bestOff)
+		writeLength(&w, bestLen)
+		pos += bestLen
+	}
+	return w.buf, flags
+}
+
+func (e *mppcEncoder) writeOffset(w *bitWriter, off int) {
+	switch {
+	case off < 64 && e.size == historySize8K:
+		w.writeBits(0xF, 4)
+		w.writeBits(off, 6)
+	case off < 64:
+		w.writeBits(0x1F, 5)
+		w.writeBits(off, 6)
+	case off < 320 && e.size == historySize8K:
+		w.writeBits(0xE, 4)
+		w.writeBits(off-64, 8)
+	case off < 320:
+		w.writeBits(0x1E, 5)
+		w.writeBits(off-64, 8)
+	case e.size == historySize8K:
+		w.writeBits(0x6, 3)
+		w.writeBits(off-320, 13)
+	case off < 2368:
+		w.writeBits(0xE, 4)
+		w.writeBits(off-320, 11)
+	default:
+		w.writeBits(0x6, 3)
+		w.writeBits(off-2368, 16)
+	}
+}
+
+func writeLength(w *bitWriter, n int) {
+	if n == 3 {
+		w.writeBits(0, 1)
+		return
+	}
+	k := 1
+	for 1<<(k+2) <= n {
+		k++
+	}
+	w.writeBits(1<<(k+1)-2, k+1) // k ones and a zero
+	w.writeBits(n-1<<(k+1), k+1)
+}
+
+func TestDecompress_SpecExamples(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags uint8
+		data  []byte
+	}{
+		{"RDP4", Type8K, bellsRDP4},
+		{"RDP5", Type64K, bellsRDP5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := NewDecompressor().Decompress(tt.data, tt.flags|FlagCompressed|FlagFlushed)
+			require.NoError(t, err)
+			assert.Equal(t, bells, string(out))
+		})
+	}
+}
+
+func TestDecompress_RoundTrip(t *testing.T) {
+	// Packets share one history, so later ones reference earlier output
+	packets := [][]byte{
+		[]byte(bells),
+		bytes.Repeat([]byte{0xFF, 0x00, 0x80}, 700),
+		[]byte(bells + bells),
+		bytes.Repeat([]byte("abcdefghijklmnopqrstuvwxyz0123456789"), 120),
+	}
+	for i := range 256 {
+		packets = append(packets, []byte(fmt.Sprintf("row %d: %x", i, i*i)))
+	}
+
+	for _, typ := range []uint8{Type8K, Type64K} {
+		t.Run(fmt.Sprintf("type%d", typ), func(t *testing.T) {
+			size := historySize8K
+			if typ == Type64K {
+				size = historySize64K
+			}
+			enc := &mppcEncoder{size: size}
+			dec := NewDecompressor()
+
+			for i, packet := range packets {
+				data, flags := enc.compress(packet)
+				if i == 0 {
+					flags |= FlagFlushed
+				}
+				out, err := dec.Decompress(data, typ|flags)
+				require.NoError(t, err, "packet %d", i)
+				require.Equal(t, packet, out, "packet %d", i)
+			}
+		})
+	}
+}
+
+func TestDecompress_AtFront(t *testing.T) {
+	dec := NewDecompressor()
+	enc := &mppcEncoder{size: historySize8K}
+
+	data, flags := enc.compress(bytes.Repeat([]byte(bells), 150))
+	_, err := dec.Decompress(data, Type8K|flags|FlagFlushed)
+	require.NoError(t, err)
+
+	// The next packet does not fit, so the encoder restarts at the front
+	data, flags = enc.compress(bytes.Repeat([]byte("the.bell."), 100))
+	require.Equal(t, FlagCompressed|FlagAtFront, flags)
+	out, err := dec.Decompress(data, Type8K|flags)
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte("the.bell."), 100), out)
+}
+
+func TestDecompress_Uncompressed(t *testing.T) {
+	dec := NewDecompressor()
+	_, err := dec.Decompress(bellsRDP5, Type64K|FlagCompressed|FlagFlushed)
+	require.NoError(t, err)
+
+	// Uncompressed data passes through without touching the history
+	out, err := dec.Decompress([]byte("raw"), Type64K)
+	require.NoError(t, err)
+	assert.Equal(t, "raw", string(out))
+
+	// A copy-offset of 8 with length 8 still refers to the compressed packet
+	var w bitWriter
+	w.writeBits(0x1F, 5)
+	w.writeBits(8, 6)
+	writeLength(&w, 8)
+	out, err = dec.Decompress(w.buf, Type64K|FlagCompressed)
+	require.NoError(t, err)
+	assert.Equal(t, "or.thee!", string(out))
+}
+
+func TestDecompress_Errors(t *testing.T) {
+	t.Run("unsupported type", func(t *testing.T) {
+		_, err := NewDecompressor().Decompress(bellsRDP5, TypeRDP61|FlagCompressed)
+		assert.ErrorIs(t, err, ErrUnsupportedType)
+	})
+
+	t.Run("offset before history", func(t *testing.T) {
+		var w bitWriter
+		w.writeBits('a', 8)
+		w.writeBits(0x1F, 5)
+		w.writeBits(2, 6) // only one byte of history
+		writeLength(&w, 3)
+		_, err := NewDecompressor().Decompress(w.buf, Type64K|FlagCompressed|FlagFlushed)
+		assert.ErrorIs(t, err, ErrCorrupt)
+	})
+
+	t.Run("history overflow", func(t *testing.T) {
+		// One packet larger than the 8K history
+		enc := &mppcEncoder{size: historySize8K}
+		data, _ := enc.compress(bytes.Repeat([]byte{'x'}, 9000))
+		_, err := NewDecompressor().Decompress(data, Type8K|FlagCompressed|FlagFlushed)
+		assert.ErrorIs(t, err, ErrCorrupt)
+	})
+
+	t.Run("truncated copy tuple", func(t *testing.T) {
+		_, err := NewDecompressor().Decompress([]byte{0xF8}, Type64K|FlagCompressed|FlagFlushed)
+		assert.ErrorIs(t, err, ErrCorrupt)
+	})
+}
@@ -0,0 +1,152 @@
+package bulk
+
+// bitReader reads an MSB-first bit stream
+type bitReader struct {
+	data []byte
+	pos  int // bit position
+}
+
+// remaining returns the number of unread bits
+func (r *bitReader) remaining() int {
+	return len(r.data)*8 - r.pos
+}
+
+// readBits reads n bits (up to 16); bits past the end read as zero
+func (r *bitReader) readBits(n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		v <<= 1
+		if byteIdx := r.pos >> 3; byteIdx < len(r.data) && r.data[byteIdx]&(0x80>>(r.pos&7)) != 0 {
+			v |= 1
+		}
+		r.pos++
+	}
+	return v
+}
+
+// peekBits returns the next n bits without consuming them
+func (r *bitReader) peekBits(n int) int {
+	pos := r.pos
+	v := r.readBits(n)
+	r.pos = pos
+	return v
+}
+
+// readOnes counts leading one bits up to max, consuming the terminating zero
+// when one is found before max
+func (r *bitReader) readOnes(max int) int {
+	n := 0
+	for n < max && r.readBits(1) == 1 {
+		n++
+	}
+	return n
+}
+
+// decode expands an MPPC bit stream (MS-RDPBCGR 3.1.8.4.1 and 3.1.8.4.2)
+// into the history buffer at historyOffset
+func (d *Decompressor) decode(src []byte) error {
+	r := bitReader{data: src}
+
+	// Every literal and copy tuple is at least 8 bits; anything shorter is padding
+	for r.remaining() >= 8 {
+		switch {
+		case r.peekBits(1) == 0: // 0xxxxxxx
+			if err := d.putLiteral(byte(r.readBits(8))); err != nil {
+				return err
+			}
+		case r.peekBits(2) == 0x2: // 10xxxxxxx
+			r.readBits(2)
+			if err := d.putLiteral(0x80 | byte(r.readBits(7))); err != nil {
+				return err
+			}
+		default:
+			offset, err := d.readCopyOffset(&r)
+			if err != nil {
+				return err
+			}
+			length, err := readLengthOfMatch(&r)
+			if err != nil {
+				return err
+			}
+			if err := d.copyMatch(offset, length); err != nil {
+				return err
+			}
+		}
+
+		if r.remaining() < 0 {
+			return ErrCorrupt
+		}
+	}
+
+	return nil
+}
+
+// putLiteral appends one byte to the history
+func (d *Decompressor) putLiteral(b byte) error {
+	if d.historyOffset >= d.historySize {
+		return ErrCorrupt
+	}
+	d.history[d.historyOffset] = b
+	d.historyOffset++
+	return nil
+}
+
+// readCopyOffset decodes a copy-offset. The 8K encoding (RDP 4.0) has three
+// ranges and the 64K encoding (RDP 5.0) four.
+func (d *Decompressor) readCopyOffset(r *bitReader) (int, error) {
+	if d.historySize == historySize8K {
+		switch r.readOnes(3) {
+		case 3:
+			if r.readBits(1) == 1 { // 1111 + 6 bits
+				return r.readBits(6), nil
+			}
+			return 64 + r.readBits(8), nil // 1110 + 8 bits
+		case 2:
+			return 320 + r.readBits(13), nil // 110 + 13 bits
+		}
+		return 0, ErrCorrupt
+	}
+
+	switch r.readOnes(4) {
+	case 4:
+		if r.readBits(1) == 1 { // 11111 + 6 bits
+			return r.readBits(6), nil
+		}
+		return 64 + r.readBits(8), nil // 11110 + 8 bits
+	case 3:
+		return 320 + r.readBits(11), nil // 1110 + 11 bits
+	case 2:
+		return 2368 + r.readBits(16), nil // 110 + 16 bits
+	}
+	return 0, ErrCorrupt
+}
+
+// readLengthOfMatch decodes a length-of-match: a single 0 bit for 3, otherwise
+// k one bits, a zero and k+1 value bits for 2^(k+1) + value
+func readLengthOfMatch(r *bitReader) (int, error) {
+	if r.remaining() < 1 {
+		return 0, ErrCorrupt
+	}
+	ones := r.readOnes(15)
+	if ones == 0 {
+		return 3, nil
+	}
+	if ones > 14 || r.remaining() < ones+1 {
+		return 0, ErrCorrupt
+	}
+	return 1<<(ones+1) + r.readBits(ones+1), nil
+}
+
+// copyMatch appends length bytes starting offset bytes back in the history.
+// Overlapping matches repeat the bytes just written.
+func (d *Decompressor) copyMatch(offset, length int) error {
+	src := d.historyOffset - offset
+	if offset == 0 || src < 0 || d.historyOffset+length > d.historySize {
+		return ErrCorrupt
+	}
+	for i := 0; i < length; i++ {
+		d.history[d.historyOffset+i] = d.history[src+i]
+	}
+	d.historyOffset += length
+	return nil
+}
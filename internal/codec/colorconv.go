@@ -0,0 +1,59 @@
+package codec
+
+// Scalar color converters, one pixel per iteration. They define the expected
+// output of the chunked converters and handle the pixels left over after the
+// last full chunk. All converters stop at whichever of src and dst runs out
+// first.
+
+// rgb565ToRGBAScalar converts 16-bit RGB565 to 32-bit RGBA
+func rgb565ToRGBAScalar(src []byte, dst []byte) {
+	srcIdx := 0
+	dstIdx := 0
+
+	for srcIdx+1 < len(src) && dstIdx+3 < len(dst) {
+		pel := uint16(src[srcIdx]) | (uint16(src[srcIdx+1]) << 8)
+
+		r := (pel & 0xF800) >> 11
+		g := (pel & 0x07E0) >> 5
+		b := pel & 0x001F
+
+		// Expand 5/6/5 to 8/8/8
+		r = (r << 3) | (r >> 2)
+		g = (g << 2) | (g >> 4)
+		b = (b << 3) | (b >> 2)
+
+		dst[dstIdx] = byte(r)
+		dst[dstIdx+1] = byte(g)
+		dst[dstIdx+2] = byte(b)
+		dst[dstIdx+3] = 255
+
+		srcIdx += 2
+		dstIdx += 4
+	}
+}
+
+// bgr24ToRGBAScalar converts 24-bit BGR to 32-bit RGBA
+func bgr24ToRGBAScalar(src []byte, dst []byte) {
+	srcIdx := 0
+	dstIdx := 0
+
+	for srcIdx+2 < len(src) && dstIdx+3 < len(dst) {
+		dst[dstIdx] = src[srcIdx+2]   // R
+		dst[dstIdx+1] = src[srcIdx+1] // G
+		dst[dstIdx+2] = src[srcIdx]   // B
+		dst[dstIdx+3] = 255
+
+		srcIdx += 3
+		dstIdx += 4
+	}
+}
+
+// bgra32ToRGBAScalar converts 32-bit BGRA to 32-bit RGBA
+func bgra32ToRGBAScalar(src []byte, dst []byte) {
+	for i := 0; i+3 < len(src) && i+3 < len(dst); i += 4 {
+		dst[i] = src[i+2]   // R
+		dst[i+1] = src[i+1] // G
+		dst[i+2] = src[i]   // B
+		dst[i+3] = 255
+	}
+}
@@ -0,0 +1,18 @@
+//go:build purego
+
+package codec
+
+// RGB565ToRGBA converts 16-bit RGB565 to 32-bit RGBA
+func RGB565ToRGBA(src []byte, dst []byte) {
+	rgb565ToRGBAScalar(src, dst)
+}
+
+// BGR24ToRGBA converts 24-bit BGR to 32-bit RGBA
+func BGR24ToRGBA(src []byte, dst []byte) {
+	bgr24ToRGBAScalar(src, dst)
+}
+
+// BGRA32ToRGBA converts 32-bit BGRA to 32-bit RGBA
+func BGRA32ToRGBA(src []byte, dst []byte) {
+	bgra32ToRGBAScalar(src, dst)
+}
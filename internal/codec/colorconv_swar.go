@@ -0,0 +1,93 @@
+//go:build !purego
+
+package codec
+
+import "encoding/binary"
+
+// The converters in this file work on several pixels per iteration using
+// 64-bit loads and stores, treating each word as packed 8-bit lanes (SWAR).
+// This needs no assembly, so it applies on every architecture including
+// WebAssembly. Build with -tags purego to use the scalar converters instead.
+
+// rgb565Lo and rgb565Hi map the low and high bytes of an RGB565 pixel to the
+// bits they contribute to the packed little-endian RGBA value. The 5/6/5 to
+// 8/8/8 expansion (x<<3|x>>2, g<<2|g>>4) touches disjoint bits for each
+// byte, so a pixel converts as rgb565Lo[lo] | rgb565Hi[hi].
+var rgb565Lo, rgb565Hi = rgb565Tables()
+
+func rgb565Tables() (lo, hi [256]uint32) {
+	for i := 0; i < 256; i++ {
+		v := uint32(i)
+
+		// Low byte: blue in bits 0-4, green bits 0-2 in bits 5-7
+		b := v & 0x1F
+		lo[i] = (v>>5)<<2<<8 | (b<<3|b>>2)<<16
+
+		// High byte: green bits 3-5 in bits 0-2, red in bits 3-7
+		g := v & 0x07
+		r := v >> 3
+		hi[i] = (r<<3 | r>>2) | (g<<5|g>>1)<<8 | 0xFF<<24
+	}
+	return lo, hi
+}
+
+// RGB565ToRGBA converts 16-bit RGB565 to 32-bit RGBA
+func RGB565ToRGBA(src []byte, dst []byte) {
+	n := min(len(src)/2, len(dst)/4)
+
+	i := 0
+	for ; i+4 <= n; i += 4 {
+		v := binary.LittleEndian.Uint64(src[i*2:])
+		d := dst[i*4 : i*4+16]
+		binary.LittleEndian.PutUint64(d, uint64(rgb565Lo[byte(v)]|rgb565Hi[byte(v>>8)])|
+			uint64(rgb565Lo[byte(v>>16)]|rgb565Hi[byte(v>>24)])<<32)
+		binary.LittleEndian.PutUint64(d[8:], uint64(rgb565Lo[byte(v>>32)]|rgb565Hi[byte(v>>40)])|
+			uint64(rgb565Lo[byte(v>>48)]|rgb565Hi[byte(v>>56)])<<32)
+	}
+	rgb565ToRGBAScalar(src[i*2:n*2], dst[i*4:])
+}
+
+// BGR24ToRGBA converts 24-bit BGR to 32-bit RGBA
+func BGR24ToRGBA(src []byte, dst []byte) {
+	n := min(len(src)/3, len(dst)/4)
+	alpha := opaqueAlpha
+
+	i := 0
+	for ; i+4 <= n; i += 4 {
+		// Four pixels: 12 source bytes, read as one 8-byte and one 4-byte word
+		s := src[i*3 : i*3+12]
+		a := binary.LittleEndian.Uint64(s)
+		b := uint64(binary.LittleEndian.Uint32(s[8:]))
+		d := dst[i*4 : i*4+16]
+		binary.LittleEndian.PutUint64(d, bgrToRGBA(a)|bgrToRGBA(a>>24)<<32|alpha)
+		binary.LittleEndian.PutUint64(d[8:], bgrToRGBA(a>>48|b<<16)|bgrToRGBA(b>>8)<<32|alpha)
+	}
+	bgr24ToRGBAScalar(src[i*3:n*3], dst[i*4:])
+}
+
+// bgrToRGBA converts the BGR pixel in the low 24 bits of v to packed RGB,
+// leaving the alpha byte zero.
+func bgrToRGBA(v uint64) uint64 {
+	return (v>>16)&0xFF | v&0xFF00 | (v&0xFF)<<16
+}
+
+// opaqueAlpha sets the alpha byte of two packed RGBA pixels. It is a
+// variable rather than a constant so the compiler keeps each 64-bit store
+// whole instead of splitting out the constant alpha bytes; converters copy
+// it to a local so it is not reloaded after every store.
+var opaqueAlpha uint64 = 0xFF000000FF000000
+
+// BGRA32ToRGBA converts 32-bit BGRA to 32-bit RGBA
+func BGRA32ToRGBA(src []byte, dst []byte) {
+	n := min(len(src)/4, len(dst)/4)
+	alpha := opaqueAlpha
+
+	i := 0
+	for ; i+2 <= n; i += 2 {
+		// Two pixels per word: swap the B and R lanes, force alpha opaque
+		v := binary.LittleEndian.Uint64(src[i*4:])
+		v = v&0x0000FF000000FF00 | (v>>16)&0x000000FF000000FF | (v&0x000000FF000000FF)<<16 | alpha
+		binary.LittleEndian.PutUint64(dst[i*4:], v)
+	}
+	bgra32ToRGBAScalar(src[i*4:n*4], dst[i*4:])
+}
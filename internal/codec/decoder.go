@@ -351,9 +351,9 @@ func aycoCgToRGBA(luma, co, cg, alpha []byte, planeWidth, planeHeight, imgWidth,
 			rgba[rgbaIdx+1] = byte(g)
 			rgba[rgbaIdx+2] = byte(b)
 
-			// Alpha
-			if alpha != nil && planeIdx < len(alpha) {
-				rgba[rgbaIdx+3] = alpha[planeIdx]
+			// Alpha, which is never padded or subsampled
+			if alphaIdx := y*imgWidth + x; alphaIdx < len(alpha) {
+				rgba[rgbaIdx+3] = alpha[alphaIdx]
 			} else {
 				rgba[rgbaIdx+3] = 255
 			}
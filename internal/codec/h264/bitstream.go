@@ -0,0 +1,155 @@
+package h264
+
+import "math/bits"
+
+// splitNALUnits splits an Annex B byte stream into NAL units, dropping the
+// start codes and any trailing zero bytes.
+func splitNALUnits(data []byte) [][]byte {
+	var nals [][]byte
+	start := -1
+	for i := 0; i+2 < len(data); {
+		if data[i] == 0 && data[i+1] == 0 && data[i+2] == 1 {
+			if start >= 0 {
+				nals = appendNAL(nals, data[start:i])
+			}
+			i += 3
+			start = i
+			continue
+		}
+		i++
+	}
+	if start >= 0 {
+		nals = appendNAL(nals, data[start:])
+	}
+	return nals
+}
+
+func appendNAL(nals [][]byte, nal []byte) [][]byte {
+	for len(nal) > 0 && nal[len(nal)-1] == 0 {
+		nal = nal[:len(nal)-1]
+	}
+	if len(nal) == 0 {
+		return nals
+	}
+	return append(nals, nal)
+}
+
+// unescapeRBSP removes emulation prevention bytes (0x000003 -> 0x0000).
+func unescapeRBSP(nal []byte) []byte {
+	out := make([]byte, 0, len(nal))
+	zeros := 0
+	for _, b := range nal {
+		if zeros >= 2 && b == 3 {
+			zeros = 0
+			continue
+		}
+		out = append(out, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
+
+// bitReader reads H.264 RBSP syntax elements. Errors are sticky: after the
+// first out-of-range read every read returns zero and err is set.
+type bitReader struct {
+	data    []byte
+	pos     int // bit position
+	stopBit int // bit position of rbsp_stop_one_bit
+	err     error
+}
+
+func newBitReader(rbsp []byte) *bitReader {
+	r := &bitReader{data: rbsp, stopBit: -1}
+	for i := len(rbsp) - 1; i >= 0; i-- {
+		if rbsp[i] != 0 {
+			r.stopBit = i*8 + 7 - bits.TrailingZeros8(rbsp[i])
+			break
+		}
+	}
+	return r
+}
+
+// u reads an n-bit unsigned integer (n <= 32).
+func (r *bitReader) u(n int) uint32 {
+	if r.err != nil {
+		return 0
+	}
+	if r.pos+n > len(r.data)*8 {
+		r.err = errTruncated
+		return 0
+	}
+	var v uint32
+	for i := 0; i < n; i++ {
+		b := r.data[r.pos>>3] >> (7 - uint(r.pos&7)) & 1
+		v = v<<1 | uint32(b)
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) flag() bool {
+	return r.u(1) == 1
+}
+
+// ue reads an unsigned Exp-Golomb code.
+func (r *bitReader) ue() uint32 {
+	zeros := 0
+	for r.u(1) == 0 {
+		if r.err != nil {
+			return 0
+		}
+		zeros++
+		if zeros > 31 {
+			r.err = errInvalid
+			return 0
+		}
+	}
+	return (1<<zeros - 1) + r.u(zeros)
+}
+
+// se reads a signed Exp-Golomb code.
+func (r *bitReader) se() int32 {
+	k := r.ue()
+	if k&1 == 1 {
+		return int32((k + 1) / 2) // #nosec G115 -- k < 2^32
+	}
+	return -int32(k / 2) // #nosec G115 -- k < 2^32
+}
+
+// leadingZeros counts zero bits up to and including the next one bit, as
+// used by level_prefix.
+func (r *bitReader) leadingZeros() int {
+	n := 0
+	for r.u(1) == 0 {
+		if r.err != nil {
+			return 0
+		}
+		n++
+		if n > 32 {
+			r.err = errInvalid
+			return 0
+		}
+	}
+	return n
+}
+
+func (r *bitReader) skip(n int) {
+	if r.pos+n > len(r.data)*8 {
+		r.err = errTruncated
+		return
+	}
+	r.pos += n
+}
+
+func (r *bitReader) align() {
+	r.pos = (r.pos + 7) &^ 7
+}
+
+// moreRBSPData reports whether syntax elements remain before the stop bit.
+func (r *bitReader) moreRBSPData() bool {
+	return r.err == nil && r.pos < r.stopBit
+}
@@ -0,0 +1,342 @@
+package h264
+
+// vlcTable decodes a prefix code by walking a binary trie.
+type vlcTable struct {
+	nodes []vlcNode
+}
+
+type vlcNode struct {
+	child [2]int32 // 0 = no child
+	value int32    // -1 for interior nodes
+}
+
+// newVLCTable builds a table from parallel code length and code value
+// arrays; entries with zero length are unused. Decoding entry i yields i.
+func newVLCTable(lens, codes []uint8) *vlcTable {
+	t := &vlcTable{nodes: []vlcNode{{value: -1}}}
+	for i, n := range lens {
+		if n == 0 {
+			continue
+		}
+		node := 0
+		for b := int(n) - 1; b >= 0; b-- {
+			bit := codes[i] >> uint(b) & 1 // codes longer than 8 bits have leading zeros
+			if t.nodes[node].child[bit] == 0 {
+				t.nodes = append(t.nodes, vlcNode{value: -1})
+				t.nodes[node].child[bit] = int32(len(t.nodes) - 1) // #nosec G115 -- tables have < 200 nodes
+			}
+			node = int(t.nodes[node].child[bit])
+		}
+		t.nodes[node].value = int32(i) // #nosec G115 -- tables have < 70 entries
+	}
+	return t
+}
+
+// decode reads one codeword and returns its entry index, or -1 with r.err
+// set if the bits do not form a valid codeword.
+func (t *vlcTable) decode(r *bitReader) int {
+	node := 0
+	for r.err == nil {
+		next := t.nodes[node].child[r.u(1)]
+		if next == 0 {
+			r.err = errInvalid
+			break
+		}
+		node = int(next)
+		if v := t.nodes[node].value; v >= 0 {
+			return int(v)
+		}
+	}
+	return -1
+}
+
+// coeff_token tables (Table 9-5), indexed by TotalCoeff*4 + TrailingOnes.
+var (
+	coeffTokenLen = [4][17 * 4]uint8{
+		{ // 0 <= nC < 2
+			1, 0, 0, 0, 6, 2, 0, 0, 8, 6, 3, 0, 9, 8, 7, 5,
+			10, 9, 8, 6, 11, 10, 9, 7, 13, 11, 10, 8, 13, 13, 11, 9,
+			13, 13, 13, 10, 14, 14, 13, 11, 14, 14, 14, 13, 15, 15, 14, 14,
+			15, 15, 15, 14, 16, 15, 15, 15, 16, 16, 16, 15, 16, 16, 16, 16,
+			16, 16, 16, 16,
+		},
+		{ // 2 <= nC < 4
+			2, 0, 0, 0, 6, 2, 0, 0, 6, 5, 3, 0, 7, 6, 6, 4,
+			8, 6, 6, 4, 8, 7, 7, 5, 9, 8, 8, 6, 11, 9, 9, 6,
+			11, 11, 11, 7, 12, 11, 11, 9, 12, 12, 12, 11, 12, 12, 12, 11,
+			13, 13, 13, 12, 13, 13, 13, 13, 13, 14, 13, 13, 14, 14, 14, 13,
+			14, 14, 14, 14,
+		},
+		{ // 4 <= nC < 8
+			4, 0, 0, 0, 6, 4, 0, 0, 6, 5, 4, 0, 6, 5, 5, 4,
+			7, 5, 5, 4, 7, 5, 5, 4, 7, 6, 6, 4, 7, 6, 6, 4,
+			8, 7, 7, 5, 8, 8, 7, 6, 9, 8, 8, 7, 9, 9, 8, 8,
+			9, 9, 9, 8, 10, 9, 9, 9, 10, 10, 10, 10, 10, 10, 10, 10,
+			10, 10, 10, 10,
+		},
+		{ // nC == -1 (chroma DC), TotalCoeff <= 4
+			2, 0, 0, 0, 6, 1, 0, 0, 6, 6, 3, 0, 6, 7, 7, 6,
+			6, 8, 8, 7,
+		},
+	}
+	coeffTokenCode = [4][17 * 4]uint8{
+		{
+			1, 0, 0, 0, 5, 1, 0, 0, 7, 4, 1, 0, 7, 6, 5, 3,
+			7, 6, 5, 3, 7, 6, 5, 4, 15, 6, 5, 4, 11, 14, 5, 4,
+			8, 10, 13, 4, 15, 14, 9, 4, 11, 10, 13, 12, 15, 14, 9, 12,
+			11, 10, 13, 8, 15, 1, 9, 12, 11, 14, 13, 8, 7, 10, 9, 12,
+			4, 6, 5, 8,
+		},
+		{
+			3, 0, 0, 0, 11, 2, 0, 0, 7, 7, 3, 0, 7, 10, 9, 5,
+			7, 6, 5, 4, 4, 6, 5, 6, 7, 6, 5, 8, 15, 6, 5, 4,
+			11, 14, 13, 4, 15, 10, 9, 4, 11, 14, 13, 12, 8, 10, 9, 8,
+			15, 14, 13, 12, 11, 10, 9, 12, 7, 11, 6, 8, 9, 8, 10, 1,
+			7, 6, 5, 4,
+		},
+		{
+			15, 0, 0, 0, 15, 14, 0, 0, 11, 15, 13, 0, 8, 12, 14, 12,
+			15, 10, 11, 11, 11, 8, 9, 10, 9, 14, 13, 9, 8, 10, 9, 8,
+			15, 14, 13, 13, 11, 14, 10, 12, 15, 10, 13, 12, 11, 14, 9, 12,
+			8, 10, 13, 8, 13, 7, 9, 12, 9, 12, 11, 10, 5, 8, 7, 6,
+			1, 4, 3, 2,
+		},
+		{
+			1, 0, 0, 0, 7, 1, 0, 0, 4, 6, 1, 0, 3, 3, 2, 5,
+			2, 3, 2, 0,
+		},
+	}
+
+	// total_zeros for 4x4 blocks (Tables 9-7, 9-8), indexed by TotalCoeff-1
+	totalZerosLen = [15][16]uint8{
+		{1, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 9},
+		{3, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 6, 6, 6, 6},
+		{4, 3, 3, 3, 4, 4, 3, 3, 4, 5, 5, 6, 5, 6},
+		{5, 3, 4, 4, 3, 3, 3, 4, 3, 4, 5, 5, 5},
+		{4, 4, 4, 3, 3, 3, 3, 3, 4, 5, 4, 5},
+		{6, 5, 3, 3, 3, 3, 3, 3, 4, 3, 6},
+		{6, 5, 3, 3, 3, 2, 3, 4, 3, 6},
+		{6, 4, 5, 3, 2, 2, 3, 3, 6},
+		{6, 6, 4, 2, 2, 3, 2, 5},
+		{5, 5, 3, 2, 2, 2, 4},
+		{4, 4, 3, 3, 1, 3},
+		{4, 4, 2, 1, 3},
+		{3, 3, 1, 2},
+		{2, 2, 1},
+		{1, 1},
+	}
+	totalZerosCode = [15][16]uint8{
+		{1, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 1},
+		{7, 6, 5, 4, 3, 5, 4, 3, 2, 3, 2, 3, 2, 1, 0},
+		{5, 7, 6, 5, 4, 3, 4, 3, 2, 3, 2, 1, 1, 0},
+		{3, 7, 5, 4, 6, 5, 4, 3, 3, 2, 2, 1, 0},
+		{5, 4, 3, 7, 6, 5, 4, 3, 2, 1, 1, 0},
+		{1, 1, 7, 6, 5, 4, 3, 2, 1, 1, 0},
+		{1, 1, 5, 4, 3, 3, 2, 1, 1, 0},
+		{1, 1, 1, 3, 3, 2, 2, 1, 0},
+		{1, 0, 1, 3, 2, 1, 1, 1},
+		{1, 0, 1, 3, 2, 1, 1},
+		{0, 1, 1, 2, 1, 3},
+		{0, 1, 1, 1, 1},
+		{0, 1, 1, 1},
+		{0, 1, 1},
+		{0, 1},
+	}
+
+	// total_zeros for chroma DC (Table 9-9a), indexed by TotalCoeff-1
+	chromaDCTotalZerosLen = [3][4]uint8{
+		{1, 2, 3, 3},
+		{1, 2, 2},
+		{1, 1},
+	}
+	chromaDCTotalZerosCode = [3][4]uint8{
+		{1, 1, 1, 0},
+		{1, 1, 0},
+		{1, 0},
+	}
+
+	// run_before (Table 9-10), indexed by min(zerosLeft, 7)-1
+	runBeforeLen = [7][16]uint8{
+		{1, 1},
+		{1, 2, 2},
+		{2, 2, 2, 2},
+		{2, 2, 2, 3, 3},
+		{2, 2, 3, 3, 3, 3},
+		{2, 3, 3, 3, 3, 3, 3},
+		{3, 3, 3, 3, 3, 3, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	}
+	runBeforeCode = [7][16]uint8{
+		{1, 0},
+		{1, 1, 0},
+		{3, 2, 1, 0},
+		{3, 2, 1, 1, 0},
+		{3, 2, 3, 2, 1, 0},
+		{3, 0, 1, 3, 2, 5, 4},
+		{7, 6, 5, 4, 3, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1},
+	}
+)
+
+var (
+	coeffTokenTables   [3]*vlcTable
+	chromaDCCoeffToken *vlcTable
+	totalZerosTables   [15]*vlcTable
+	chromaDCTotalZeros [3]*vlcTable
+	runBeforeTables    [7]*vlcTable
+)
+
+func init() {
+	for i := range coeffTokenTables {
+		coeffTokenTables[i] = newVLCTable(coeffTokenLen[i][:], coeffTokenCode[i][:])
+	}
+	chromaDCCoeffToken = newVLCTable(coeffTokenLen[3][:5*4], coeffTokenCode[3][:5*4])
+	for i := range totalZerosTables {
+		totalZerosTables[i] = newVLCTable(totalZerosLen[i][:], totalZerosCode[i][:])
+	}
+	for i := range chromaDCTotalZeros {
+		chromaDCTotalZeros[i] = newVLCTable(chromaDCTotalZerosLen[i][:], chromaDCTotalZerosCode[i][:])
+	}
+	for i := range runBeforeTables {
+		runBeforeTables[i] = newVLCTable(runBeforeLen[i][:], runBeforeCode[i][:])
+	}
+}
+
+// readCoeffToken decodes coeff_token for the given nC (-1 for chroma DC)
+// and returns TotalCoeff and TrailingOnes.
+func readCoeffToken(r *bitReader, nC int) (totalCoeff, trailingOnes int) {
+	var idx int
+	switch {
+	case nC == -1:
+		idx = chromaDCCoeffToken.decode(r)
+	case nC < 2:
+		idx = coeffTokenTables[0].decode(r)
+	case nC < 4:
+		idx = coeffTokenTables[1].decode(r)
+	case nC < 8:
+		idx = coeffTokenTables[2].decode(r)
+	default:
+		// 6-bit fixed length code
+		v := int(r.u(6))
+		if v == 3 {
+			return 0, 0
+		}
+		totalCoeff, trailingOnes = v>>2+1, v&3
+		if trailingOnes > totalCoeff {
+			r.err = errInvalid
+		}
+		return totalCoeff, trailingOnes
+	}
+	if idx < 0 {
+		return 0, 0
+	}
+	return idx / 4, idx % 4
+}
+
+// readResidualBlock parses residual_block_cavlc (7.3.5.3.2) into coeffs,
+// which holds maxNumCoeff levels in scan order, and returns TotalCoeff.
+func readResidualBlock(r *bitReader, coeffs []int32, nC int) int {
+	maxNumCoeff := len(coeffs)
+	totalCoeff, trailingOnes := readCoeffToken(r, nC)
+	if r.err != nil || totalCoeff == 0 {
+		return 0
+	}
+	if totalCoeff > maxNumCoeff {
+		r.err = errInvalid
+		return 0
+	}
+
+	var levels [16]int32
+	suffixLength := 0
+	if totalCoeff > 10 && trailingOnes < 3 {
+		suffixLength = 1
+	}
+	for i := 0; i < totalCoeff; i++ {
+		if i < trailingOnes {
+			levels[i] = 1 - 2*int32(r.u(1)) // #nosec G115 -- single bit
+			continue
+		}
+
+		levelPrefix := r.leadingZeros()
+		levelCode := min(15, levelPrefix) << uint(suffixLength)
+		levelSuffixSize := suffixLength
+		if levelPrefix == 14 && suffixLength == 0 {
+			levelSuffixSize = 4
+		}
+		if levelPrefix >= 15 {
+			levelSuffixSize = levelPrefix - 3
+		}
+		if levelSuffixSize > 0 {
+			levelCode += int(r.u(levelSuffixSize))
+		}
+		if levelPrefix >= 15 && suffixLength == 0 {
+			levelCode += 15
+		}
+		if levelPrefix >= 16 {
+			levelCode += (1 << uint(levelPrefix-3)) - 4096
+		}
+		if i == trailingOnes && trailingOnes < 3 {
+			levelCode += 2
+		}
+
+		if levelCode%2 == 0 {
+			levels[i] = int32((levelCode + 2) >> 1) // #nosec G115 -- bounded by level_prefix
+		} else {
+			levels[i] = int32((-levelCode - 1) >> 1) // #nosec G115 -- bounded by level_prefix
+		}
+
+		if suffixLength == 0 {
+			suffixLength = 1
+		}
+		if abs32(levels[i]) > 3<<uint(suffixLength-1) && suffixLength < 6 {
+			suffixLength++
+		}
+	}
+
+	zerosLeft := 0
+	if totalCoeff < maxNumCoeff {
+		var idx int
+		if maxNumCoeff == 4 {
+			idx = chromaDCTotalZeros[totalCoeff-1].decode(r)
+		} else {
+			idx = totalZerosTables[totalCoeff-1].decode(r)
+		}
+		if idx < 0 {
+			return 0
+		}
+		zerosLeft = idx
+		if zerosLeft > maxNumCoeff-totalCoeff {
+			r.err = errInvalid
+			return 0
+		}
+	}
+
+	var runs [16]int
+	for i := 0; i < totalCoeff-1; i++ {
+		if zerosLeft > 0 {
+			run := runBeforeTables[min(zerosLeft, 7)-1].decode(r)
+			if run < 0 {
+				return 0
+			}
+			if run > zerosLeft {
+				r.err = errInvalid
+				return 0
+			}
+			runs[i] = run
+			zerosLeft -= run
+		}
+	}
+	runs[totalCoeff-1] = zerosLeft
+
+	coeffNum := -1
+	for i := totalCoeff - 1; i >= 0; i-- {
+		coeffNum += runs[i] + 1
+		coeffs[coeffNum] = levels[i]
+	}
+	return totalCoeff
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,85 @@
+package h264
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checkPrefixCode verifies that a code table is prefix-free and satisfies
+// the Kraft inequality, catching transcription errors in the tables.
+func checkPrefixCode(t *testing.T, name string, lens, codes []uint8, complete bool) {
+	t.Helper()
+	type cw struct{ len, code int }
+	var words []cw
+	kraft := 0.0
+	for i, n := range lens {
+		if n == 0 {
+			continue
+		}
+		require.Less(t, int(codes[i]), 1<<n, "%s[%d]: code wider than its length", name, i)
+		words = append(words, cw{int(n), int(codes[i])})
+		kraft += 1 / float64(uint(1)<<n)
+	}
+	for i, a := range words {
+		for j, b := range words {
+			if i == j || a.len > b.len {
+				continue
+			}
+			assert.NotEqual(t, a.code, b.code>>uint(b.len-a.len), "%s: code %d is a prefix of code %d", name, i, j)
+		}
+	}
+	if complete {
+		assert.InDelta(t, 1.0, kraft, 1e-12, "%s: incomplete code", name)
+	} else {
+		assert.LessOrEqual(t, kraft, 1.0, "%s: Kraft sum exceeds 1", name)
+	}
+}
+
+func TestVLCTables_PrefixFree(t *testing.T) {
+	for i := 0; i < 3; i++ {
+		checkPrefixCode(t, fmt.Sprintf("coeff_token[%d]", i), coeffTokenLen[i][:], coeffTokenCode[i][:], false)
+	}
+	checkPrefixCode(t, "coeff_token[chroma DC]", coeffTokenLen[3][:20], coeffTokenCode[3][:20], false)
+	for i := range totalZerosLen {
+		// Only the TotalCoeff = 1 table leaves a codeword (all zeros) unused
+		checkPrefixCode(t, fmt.Sprintf("total_zeros[%d]", i+1), totalZerosLen[i][:16-i], totalZerosCode[i][:16-i], i > 0)
+	}
+	for i := range chromaDCTotalZerosLen {
+		checkPrefixCode(t, fmt.Sprintf("chroma DC total_zeros[%d]", i+1), chromaDCTotalZerosLen[i][:4-i], chromaDCTotalZerosCode[i][:4-i], true)
+	}
+	for i := range runBeforeLen {
+		n := i + 2
+		if i == 6 {
+			n = 15
+		}
+		checkPrefixCode(t, fmt.Sprintf("run_before[%d]", i+1), runBeforeLen[i][:n], runBeforeCode[i][:n], i < 6)
+	}
+}
+
+func TestIntraCBP_Permutation(t *testing.T) {
+	seen := make(map[uint8]bool)
+	for _, cbp := range intraCBP {
+		assert.Less(t, cbp, uint8(48))
+		assert.False(t, seen[cbp], "duplicate cbp %d", cbp)
+		seen[cbp] = true
+	}
+}
+
+func TestReadResidualBlock(t *testing.T) {
+	// Worked example from the CAVLC literature: levels 0,3,-1,0 / 0,-1,1,0 /
+	// 1,0,0,0 / 0,0,0,0 in zig-zag order are 0,3,0,1,-1,-1,0,1, coded with
+	// nC = 0 as 000010001110010111101101.
+	w := &bitWriter{}
+	w.u(24, 0x08E5ED)
+	r := newBitReader(w.bytes())
+
+	coeffs := make([]int32, 16)
+	n := readResidualBlock(r, coeffs, 0)
+	require.NoError(t, r.err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, []int32{0, 3, 0, 1, -1, -1, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0}, coeffs)
+	assert.Equal(t, 24, r.pos)
+}
@@ -0,0 +1,203 @@
+package h264
+
+// Deblocking filter thresholds (Tables 8-16, 8-17), indexed by indexA/B
+var (
+	alphaTable = [52]int32{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		4, 4, 5, 6, 7, 8, 9, 10, 12, 13, 15, 17, 20, 22, 25, 28,
+		32, 36, 40, 45, 50, 56, 63, 71, 80, 90, 101, 113, 127, 144, 162, 182,
+		203, 226, 255, 255,
+	}
+	betaTable = [52]int32{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 6, 6, 7, 7, 8, 8,
+		9, 9, 10, 10, 11, 11, 12, 12, 13, 13, 14, 14, 15, 15, 16, 16,
+		17, 17, 18, 18,
+	}
+	// tC0 for bS = 3, the only bS < 4 that occurs in intra pictures
+	tc0Table = [52]int32{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 3,
+		3, 3, 4, 4, 4, 5, 6, 6, 7, 8, 9, 10, 11, 13, 14, 16,
+		18, 20, 23, 25,
+	}
+)
+
+// edgeParams are the per-edge filter parameters (8.7.2.2).
+type edgeParams struct {
+	bS          int
+	alpha, beta int32
+	tc0         int32
+}
+
+// deblock applies the loop filter to the whole picture (8.7). In an intra
+// picture every macroblock edge has bS 4 and every internal edge bS 3.
+func (p *picture) deblock() {
+	yStride, cStride := p.mbW*16, p.mbW*8
+
+	for addr := range p.mbs {
+		mb := &p.mbs[addr]
+		h := p.slices[mb.slice-1]
+		if h.disableDeblock == 1 {
+			continue
+		}
+		mbX, mbY := addr%p.mbW, addr/p.mbW
+		offsetC := h.pps.chromaQPIndexOffset
+
+		var left, top *macroblock
+		if mbX > 0 {
+			left = &p.mbs[addr-1]
+		}
+		if mbY > 0 {
+			top = &p.mbs[addr-p.mbW]
+		}
+		if h.disableDeblock == 2 {
+			if left != nil && left.slice != mb.slice {
+				left = nil
+			}
+			if top != nil && top.slice != mb.slice {
+				top = nil
+			}
+		}
+
+		params := func(bS int, qpP, qpQ int) edgeParams {
+			qpAv := (qpP + qpQ + 1) >> 1
+			indexA := clip3(0, 51, qpAv+h.filterOffsetA)
+			indexB := clip3(0, 51, qpAv+h.filterOffsetB)
+			return edgeParams{bS: bS, alpha: alphaTable[indexA], beta: betaTable[indexB], tc0: tc0Table[indexA]}
+		}
+		lumaQP := func(n *macroblock) int { return n.qp }
+		cQP := func(n *macroblock) int { return chromaQP(n.qp, offsetC) }
+
+		yOff := mbY*16*yStride + mbX*16
+		cOff := mbY*8*cStride + mbX*8
+
+		// Luma: vertical edges left to right, then horizontal edges
+		for e := 0; e < 4; e++ {
+			if e == 0 && left == nil {
+				continue
+			}
+			ep := params(3, mb.qp, mb.qp)
+			if e == 0 {
+				ep = params(4, lumaQP(left), mb.qp)
+			}
+			filterEdge(p.y, yOff+e*4, 1, yStride, 16, ep, false)
+		}
+		for e := 0; e < 4; e++ {
+			if e == 0 && top == nil {
+				continue
+			}
+			ep := params(3, mb.qp, mb.qp)
+			if e == 0 {
+				ep = params(4, lumaQP(top), mb.qp)
+			}
+			filterEdge(p.y, yOff+e*4*yStride, yStride, 1, 16, ep, false)
+		}
+
+		// Chroma: edges 0 and 2 of the luma grid map to chroma edges 0 and 1
+		for _, plane := range [][]byte{p.cb, p.cr} {
+			qpC := cQP(mb)
+			for e := 0; e < 2; e++ {
+				if e == 0 && left == nil {
+					continue
+				}
+				ep := params(3, qpC, qpC)
+				if e == 0 {
+					ep = params(4, cQP(left), qpC)
+				}
+				filterEdge(plane, cOff+e*4, 1, cStride, 8, ep, true)
+			}
+			for e := 0; e < 2; e++ {
+				if e == 0 && top == nil {
+					continue
+				}
+				ep := params(3, qpC, qpC)
+				if e == 0 {
+					ep = params(4, cQP(top), qpC)
+				}
+				filterEdge(plane, cOff+e*4*cStride, cStride, 1, 8, ep, true)
+			}
+		}
+	}
+}
+
+// filterEdge filters n lines across one edge. q0 of the first line is at
+// off; step moves across the edge (towards q) and lineStep along it.
+func filterEdge(plane []byte, off, step, lineStep, n int, ep edgeParams, chroma bool) {
+	if ep.alpha == 0 || ep.beta == 0 {
+		return
+	}
+	for i := 0; i < n; i++ {
+		q := off + i*lineStep
+		p0, q0 := int32(plane[q-step]), int32(plane[q])
+		p1, q1 := int32(plane[q-2*step]), int32(plane[q+step])
+		if abs32(p0-q0) >= ep.alpha || abs32(p1-p0) >= ep.beta || abs32(q1-q0) >= ep.beta {
+			continue
+		}
+
+		if chroma {
+			if ep.bS == 4 {
+				plane[q-step] = byte((2*p1 + p0 + q1 + 2) >> 2)
+				plane[q] = byte((2*q1 + q0 + p1 + 2) >> 2)
+			} else {
+				tc := ep.tc0 + 1
+				delta := clip3i32(-tc, tc, ((q0-p0)<<2+(p1-q1)+4)>>3)
+				plane[q-step] = clip1(p0 + delta)
+				plane[q] = clip1(q0 - delta)
+			}
+			continue
+		}
+
+		p2, q2 := int32(plane[q-3*step]), int32(plane[q+2*step])
+		ap := abs32(p2-p0) < ep.beta
+		aq := abs32(q2-q0) < ep.beta
+
+		if ep.bS == 4 {
+			strong := abs32(p0-q0) < (ep.alpha>>2)+2
+			if ap && strong {
+				p3 := int32(plane[q-4*step])
+				plane[q-step] = byte((p2 + 2*p1 + 2*p0 + 2*q0 + q1 + 4) >> 3)
+				plane[q-2*step] = byte((p2 + p1 + p0 + q0 + 2) >> 2)
+				plane[q-3*step] = byte((2*p3 + 3*p2 + p1 + p0 + q0 + 4) >> 3)
+			} else {
+				plane[q-step] = byte((2*p1 + p0 + q1 + 2) >> 2)
+			}
+			if aq && strong {
+				q3 := int32(plane[q+3*step])
+				plane[q] = byte((p1 + 2*p0 + 2*q0 + 2*q1 + q2 + 4) >> 3)
+				plane[q+step] = byte((p0 + q0 + q1 + q2 + 2) >> 2)
+				plane[q+2*step] = byte((2*q3 + 3*q2 + q1 + q0 + p0 + 4) >> 3)
+			} else {
+				plane[q] = byte((2*q1 + q0 + p1 + 2) >> 2)
+			}
+			continue
+		}
+
+		tc := ep.tc0
+		if ap {
+			tc++
+		}
+		if aq {
+			tc++
+		}
+		delta := clip3i32(-tc, tc, ((q0-p0)<<2+(p1-q1)+4)>>3)
+		plane[q-step] = clip1(p0 + delta)
+		plane[q] = clip1(q0 - delta)
+		if ap {
+			plane[q-2*step] = byte(p1 + clip3i32(-ep.tc0, ep.tc0, (p2+(p0+q0+1)>>1-p1<<1)>>1))
+		}
+		if aq {
+			plane[q+step] = byte(q1 + clip3i32(-ep.tc0, ep.tc0, (q2+(p0+q0+1)>>1-q1<<1)>>1))
+		}
+	}
+}
+
+func clip3i32(lo, hi, v int32) int32 {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,97 @@
+// Package h264 implements a minimal H.264 (ITU-T H.264 / ISO 14496-10)
+// decoder for the intra-coded frames carried by RDPEGFX AVC420 surface
+// commands. Only the Baseline profile with CAVLC entropy coding, 4:2:0
+// chroma, 8-bit samples, progressive frames and a single slice group is
+// supported; anything else is rejected with ErrUnsupported.
+package h264
+
+import "errors"
+
+// Errors returned by DecodeFrame
+var (
+	ErrUnsupported = errors.New("h264: unsupported bitstream feature")
+	ErrNoPicture   = errors.New("h264: no complete picture in bitstream")
+
+	errTruncated = errors.New("h264: truncated bitstream")
+	errInvalid   = errors.New("h264: invalid bitstream")
+)
+
+// Profiles accepted by the decoder
+const (
+	ProfileBaseline = 66
+)
+
+// NAL unit types (Table 7-1)
+const (
+	nalSlice    = 1
+	nalSliceIDR = 5
+	nalSPS      = 7
+	nalPPS      = 8
+)
+
+// maxFrameMBs bounds the picture size accepted from an SPS (Level 5.1 MaxFS).
+const maxFrameMBs = 36864
+
+// Frame is a decoded picture in planar YCbCr 4:2:0, cropped to the display
+// size signalled in the sequence parameter set.
+type Frame struct {
+	Width, Height int
+	Y, Cb, Cr     []byte
+	YStride       int
+	CStride       int
+}
+
+// DecodeFrame decodes the last complete picture in an Annex B byte stream.
+// Parameter sets must be present in the same stream, as they are in every
+// AVC420 frame sent by Windows hosts.
+func DecodeFrame(annexB []byte) (*Frame, error) {
+	d := &decoder{
+		spss: make(map[uint32]*sps),
+		ppss: make(map[uint32]*pps),
+	}
+	var last *Frame
+
+	for _, nal := range splitNALUnits(annexB) {
+		if nal[0]&0x80 != 0 {
+			return nil, errInvalid
+		}
+		nalType := nal[0] & 0x1F
+		refIdc := nal[0] >> 5 & 3
+		rbsp := unescapeRBSP(nal[1:])
+
+		switch nalType {
+		case nalSPS:
+			s, err := parseSPS(rbsp)
+			if err != nil {
+				return nil, err
+			}
+			d.spss[s.id] = s
+		case nalPPS:
+			p, err := parsePPS(rbsp)
+			if err != nil {
+				return nil, err
+			}
+			d.ppss[p.id] = p
+		case nalSlice, nalSliceIDR:
+			if err := d.decodeSlice(rbsp, nalType == nalSliceIDR, refIdc); err != nil {
+				return nil, err
+			}
+			if d.pic.complete() {
+				last = d.pic.finish()
+				d.pic = nil
+			}
+		}
+	}
+
+	if last == nil {
+		return nil, ErrNoPicture
+	}
+	return last, nil
+}
+
+// decoder holds parameter sets and the picture being reconstructed.
+type decoder struct {
+	spss map[uint32]*sps
+	ppss map[uint32]*pps
+	pic  *picture
+}
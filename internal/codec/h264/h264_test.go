@@ -0,0 +1,246 @@
+package h264
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testdata/intra_48x40.264 was produced by x264 (Baseline profile, one IDR
+// frame in two slices, Intra4x4 and Intra16x16 macroblocks, deblocking with
+// offsets, chroma QP offset 2, frame cropping from 48x48 to 48x40).
+// testdata/intra_48x40.yuv is x264's own I420 reconstruction of that frame,
+// so a conforming decoder must match it bit for bit.
+func loadVector(t *testing.T) (stream, yuv []byte) {
+	t.Helper()
+	stream, err := os.ReadFile("testdata/intra_48x40.264")
+	require.NoError(t, err)
+	yuv, err = os.ReadFile("testdata/intra_48x40.yuv")
+	require.NoError(t, err)
+	return stream, yuv
+}
+
+func TestDecodeFrame_MatchesReference(t *testing.T) {
+	stream, yuv := loadVector(t)
+
+	f, err := DecodeFrame(stream)
+	require.NoError(t, err)
+	assert.Equal(t, 48, f.Width)
+	assert.Equal(t, 40, f.Height)
+
+	ySize, cSize := 48*40, 24*20
+	require.Len(t, yuv, ySize+2*cSize)
+	assert.True(t, bytes.Equal(yuv[:ySize], f.Y), "luma differs from reference")
+	assert.True(t, bytes.Equal(yuv[ySize:ySize+cSize], f.Cb), "Cb differs from reference")
+	assert.True(t, bytes.Equal(yuv[ySize+cSize:], f.Cr), "Cr differs from reference")
+}
+
+func TestDecodeFrame_Unsupported(t *testing.T) {
+	stream, _ := loadVector(t)
+
+	// Patch profile_idc in the SPS to High (100)
+	high := append([]byte(nil), stream...)
+	sps := bytes.Index(high, []byte{0, 0, 1, 0x67})
+	require.GreaterOrEqual(t, sps, 0)
+	high[sps+4] = 100
+	_, err := DecodeFrame(high)
+	assert.ErrorIs(t, err, ErrUnsupported)
+
+	// A P slice
+	w := &bitWriter{}
+	w.ue(0) // first_mb_in_slice
+	w.ue(5) // slice_type P
+	w.ue(0) // pic_parameter_set_id
+	_, err = DecodeFrame(append(testParameterSets(), w.nal(0x41)...))
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestDecodeFrame_Incomplete(t *testing.T) {
+	stream, _ := loadVector(t)
+
+	// Drop the second slice
+	last := bytes.LastIndex(stream, []byte{0, 0, 1, 0x65})
+	require.Greater(t, last, 0)
+	_, err := DecodeFrame(stream[:last])
+	assert.ErrorIs(t, err, ErrNoPicture)
+
+	// Truncate inside the first slice
+	first := bytes.Index(stream, []byte{0, 0, 1, 0x65})
+	_, err = DecodeFrame(stream[:first+40])
+	assert.Error(t, err)
+
+	_, err = DecodeFrame(nil)
+	assert.ErrorIs(t, err, ErrNoPicture)
+}
+
+func TestDecodeFrame_PCM(t *testing.T) {
+	w := &bitWriter{}
+	w.ue(0)   // first_mb_in_slice
+	w.ue(7)   // slice_type I (all slices)
+	w.ue(0)   // pic_parameter_set_id
+	w.u(4, 0) // frame_num
+	w.ue(0)   // idr_pic_id
+	w.u(2, 0) // dec_ref_pic_marking
+	w.se(0)   // slice_qp_delta
+	w.ue(1)   // disable_deblocking_filter_idc
+	w.ue(25)  // mb_type I_PCM
+	w.alignZero()
+	for i := 0; i < 256+128; i++ {
+		w.u(8, uint32(16+i%200))
+	}
+
+	f, err := DecodeFrame(append(testParameterSets(), w.nal(0x65)...))
+	require.NoError(t, err)
+	require.Equal(t, 16, f.Width)
+	for i := 0; i < 256; i++ {
+		assert.Equal(t, byte(16+i%200), f.Y[i])
+	}
+	assert.Equal(t, byte(16+256%200), f.Cb[0])
+	assert.Equal(t, byte(16+(256+64)%200), f.Cr[0])
+}
+
+func TestSplitNALUnits(t *testing.T) {
+	data := []byte{0, 0, 0, 1, 0x67, 1, 2, 0, 0, 1, 0x68, 3, 0, 0, 0, 0, 1, 0x65, 4}
+	nals := splitNALUnits(data)
+	require.Len(t, nals, 3)
+	assert.Equal(t, []byte{0x67, 1, 2}, nals[0])
+	assert.Equal(t, []byte{0x68, 3}, nals[1])
+	assert.Equal(t, []byte{0x65, 4}, nals[2])
+}
+
+func TestUnescapeRBSP(t *testing.T) {
+	assert.Equal(t, []byte{0, 0, 1, 0, 0, 0, 2}, unescapeRBSP([]byte{0, 0, 3, 1, 0, 0, 3, 0, 2}))
+	assert.Equal(t, []byte{0, 3, 0, 3}, unescapeRBSP([]byte{0, 3, 0, 3}))
+}
+
+func TestBitReader_ExpGolomb(t *testing.T) {
+	w := &bitWriter{}
+	for _, v := range []uint32{0, 1, 2, 7, 255, 65535} {
+		w.ue(v)
+	}
+	for _, v := range []int32{0, 1, -1, 17, -300} {
+		w.se(v)
+	}
+	w.u(1, 1)
+
+	r := newBitReader(w.bytes())
+	for _, v := range []uint32{0, 1, 2, 7, 255, 65535} {
+		assert.Equal(t, v, r.ue())
+	}
+	for _, v := range []int32{0, 1, -1, 17, -300} {
+		assert.Equal(t, v, r.se())
+	}
+	assert.False(t, r.moreRBSPData())
+	assert.NoError(t, r.err)
+
+	r.u(8)
+	assert.Error(t, r.err, "reading past the end sets a sticky error")
+}
+
+// testParameterSets returns an SPS and PPS for a 16x16 Baseline stream
+// (poc type 2, deblocking control present).
+func testParameterSets() []byte {
+	sps := &bitWriter{}
+	sps.u(8, ProfileBaseline)
+	sps.u(8, 0)  // constraint flags
+	sps.u(8, 30) // level_idc
+	sps.ue(0)    // seq_parameter_set_id
+	sps.ue(0)    // log2_max_frame_num_minus4
+	sps.ue(2)    // pic_order_cnt_type
+	sps.ue(1)    // max_num_ref_frames
+	sps.u(1, 0)  // gaps_in_frame_num_value_allowed_flag
+	sps.ue(0)    // pic_width_in_mbs_minus1
+	sps.ue(0)    // pic_height_in_map_units_minus1
+	sps.u(1, 1)  // frame_mbs_only_flag
+	sps.u(1, 1)  // direct_8x8_inference_flag
+	sps.u(1, 0)  // frame_cropping_flag
+	sps.u(1, 0)  // vui_parameters_present_flag
+
+	pps := &bitWriter{}
+	pps.ue(0)   // pic_parameter_set_id
+	pps.ue(0)   // seq_parameter_set_id
+	pps.u(1, 0) // entropy_coding_mode_flag
+	pps.u(1, 0) // bottom_field_pic_order_in_frame_present_flag
+	pps.ue(0)   // num_slice_groups_minus1
+	pps.ue(0)   // num_ref_idx_l0_default_active_minus1
+	pps.ue(0)   // num_ref_idx_l1_default_active_minus1
+	pps.u(3, 0) // weighted_pred_flag, weighted_bipred_idc
+	pps.se(0)   // pic_init_qp_minus26
+	pps.se(0)   // pic_init_qs_minus26
+	pps.se(0)   // chroma_qp_index_offset
+	pps.u(1, 1) // deblocking_filter_control_present_flag
+	pps.u(1, 0) // constrained_intra_pred_flag
+	pps.u(1, 0) // redundant_pic_cnt_present_flag
+
+	return append(sps.nal(0x67), pps.nal(0x68)...)
+}
+
+// bitWriter builds RBSP payloads for tests.
+type bitWriter struct {
+	buf  []byte
+	bits int
+}
+
+func (w *bitWriter) u(n int, v uint32) {
+	for i := n - 1; i >= 0; i-- {
+		if w.bits%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 == 1 {
+			w.buf[len(w.buf)-1] |= 0x80 >> uint(w.bits%8)
+		}
+		w.bits++
+	}
+}
+
+func (w *bitWriter) ue(v uint32) {
+	n := 0
+	for (v+1)>>uint(n+1) != 0 {
+		n++
+	}
+	w.u(n, 0)
+	w.u(n+1, v+1)
+}
+
+func (w *bitWriter) se(v int32) {
+	if v > 0 {
+		w.ue(uint32(2*v - 1))
+	} else {
+		w.ue(uint32(-2 * v))
+	}
+}
+
+func (w *bitWriter) alignZero() {
+	for w.bits%8 != 0 {
+		w.u(1, 0)
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	return w.buf
+}
+
+// nal appends rbsp_trailing_bits and returns an Annex B NAL unit with
+// emulation prevention applied.
+func (w *bitWriter) nal(header byte) []byte {
+	w.u(1, 1)
+	w.alignZero()
+	out := []byte{0, 0, 0, 1, header}
+	zeros := 0
+	for _, b := range w.buf {
+		if zeros >= 2 && b <= 3 {
+			out = append(out, 3)
+			zeros = 0
+		}
+		out = append(out, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
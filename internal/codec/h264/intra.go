@@ -0,0 +1,374 @@
+package h264
+
+// Intra prediction modes
+const (
+	predVertical   = 0
+	predHorizontal = 1
+	predDC         = 2
+	predPlane      = 3 // Intra16x16 only
+
+	// Intra4x4 directional modes
+	predDiagDownLeft  = 3
+	predDiagDownRight = 4
+	predVerticalRight = 5
+	predHorizDown     = 6
+	predVerticalLeft  = 7
+	predHorizUp       = 8
+)
+
+// Intra chroma prediction modes (Table 7-16)
+const (
+	chromaPredDC         = 0
+	chromaPredHorizontal = 1
+	chromaPredVertical   = 2
+	chromaPredPlane      = 3
+)
+
+// neighbors holds the reconstructed samples around a block. top extends
+// twice the block width to cover the above-right samples.
+type neighbors struct {
+	top             [32]int32
+	left            [16]int32
+	topLeft         int32
+	hasTop, hasLeft bool
+	hasTopLeft      bool
+}
+
+// gather reads the neighbouring samples of the n x n block at off. When
+// topRight is false, the above-right samples replicate the last top sample.
+func (nb *neighbors) gather(plane []byte, off, stride, n int, topRight bool) {
+	if nb.hasTop {
+		for x := 0; x < n; x++ {
+			nb.top[x] = int32(plane[off-stride+x])
+		}
+		for x := n; x < 2*n; x++ {
+			if topRight {
+				nb.top[x] = int32(plane[off-stride+x])
+			} else {
+				nb.top[x] = nb.top[n-1]
+			}
+		}
+	}
+	if nb.hasLeft {
+		for y := 0; y < n; y++ {
+			nb.left[y] = int32(plane[off+y*stride-1])
+		}
+	}
+	if nb.hasTopLeft {
+		nb.topLeft = int32(plane[off-stride-1])
+	}
+}
+
+// predict4x4 writes the Intra4x4 prediction for mode into dst (8.3.1.2).
+// It reports false if the mode needs samples that are not available.
+func predict4x4(nb *neighbors, mode int, dst []byte, off, stride int) bool {
+	// p returns p[x, y] for the neighbour samples, x or y == -1
+	p := func(x, y int) int32 {
+		switch {
+		case x == -1 && y == -1:
+			return nb.topLeft
+		case y == -1:
+			return nb.top[x]
+		default:
+			return nb.left[y]
+		}
+	}
+
+	var pred [16]int32
+	switch mode {
+	case predVertical:
+		if !nb.hasTop {
+			return false
+		}
+		for i := range pred {
+			pred[i] = nb.top[i&3]
+		}
+	case predHorizontal:
+		if !nb.hasLeft {
+			return false
+		}
+		for i := range pred {
+			pred[i] = nb.left[i>>2]
+		}
+	case predDC:
+		var s int32
+		switch {
+		case nb.hasTop && nb.hasLeft:
+			s = (nb.top[0] + nb.top[1] + nb.top[2] + nb.top[3] + nb.left[0] + nb.left[1] + nb.left[2] + nb.left[3] + 4) >> 3
+		case nb.hasLeft:
+			s = (nb.left[0] + nb.left[1] + nb.left[2] + nb.left[3] + 2) >> 2
+		case nb.hasTop:
+			s = (nb.top[0] + nb.top[1] + nb.top[2] + nb.top[3] + 2) >> 2
+		default:
+			s = 128
+		}
+		for i := range pred {
+			pred[i] = s
+		}
+	case predDiagDownLeft:
+		if !nb.hasTop {
+			return false
+		}
+		t := &nb.top
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				if x == 3 && y == 3 {
+					pred[15] = (t[6] + 3*t[7] + 2) >> 2
+				} else {
+					pred[y*4+x] = (t[x+y] + 2*t[x+y+1] + t[x+y+2] + 2) >> 2
+				}
+			}
+		}
+	case predDiagDownRight:
+		if !nb.hasTop || !nb.hasLeft || !nb.hasTopLeft {
+			return false
+		}
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				switch {
+				case x > y:
+					pred[y*4+x] = (p(x-y-2, -1) + 2*p(x-y-1, -1) + p(x-y, -1) + 2) >> 2
+				case x < y:
+					pred[y*4+x] = (p(-1, y-x-2) + 2*p(-1, y-x-1) + p(-1, y-x) + 2) >> 2
+				default:
+					pred[y*4+x] = (p(0, -1) + 2*p(-1, -1) + p(-1, 0) + 2) >> 2
+				}
+			}
+		}
+	case predVerticalRight:
+		if !nb.hasTop || !nb.hasLeft || !nb.hasTopLeft {
+			return false
+		}
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				z := 2*x - y
+				switch {
+				case z >= 0 && z&1 == 0:
+					pred[y*4+x] = (p(x-(y>>1)-1, -1) + p(x-(y>>1), -1) + 1) >> 1
+				case z >= 0:
+					pred[y*4+x] = (p(x-(y>>1)-2, -1) + 2*p(x-(y>>1)-1, -1) + p(x-(y>>1), -1) + 2) >> 2
+				case z == -1:
+					pred[y*4+x] = (p(-1, 0) + 2*p(-1, -1) + p(0, -1) + 2) >> 2
+				default:
+					pred[y*4+x] = (p(-1, y-1) + 2*p(-1, y-2) + p(-1, y-3) + 2) >> 2
+				}
+			}
+		}
+	case predHorizDown:
+		if !nb.hasTop || !nb.hasLeft || !nb.hasTopLeft {
+			return false
+		}
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				z := 2*y - x
+				switch {
+				case z >= 0 && z&1 == 0:
+					pred[y*4+x] = (p(-1, y-(x>>1)-1) + p(-1, y-(x>>1)) + 1) >> 1
+				case z >= 0:
+					pred[y*4+x] = (p(-1, y-(x>>1)-2) + 2*p(-1, y-(x>>1)-1) + p(-1, y-(x>>1)) + 2) >> 2
+				case z == -1:
+					pred[y*4+x] = (p(-1, 0) + 2*p(-1, -1) + p(0, -1) + 2) >> 2
+				default:
+					pred[y*4+x] = (p(x-1, -1) + 2*p(x-2, -1) + p(x-3, -1) + 2) >> 2
+				}
+			}
+		}
+	case predVerticalLeft:
+		if !nb.hasTop {
+			return false
+		}
+		t := &nb.top
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				i := x + y>>1
+				if y&1 == 0 {
+					pred[y*4+x] = (t[i] + t[i+1] + 1) >> 1
+				} else {
+					pred[y*4+x] = (t[i] + 2*t[i+1] + t[i+2] + 2) >> 2
+				}
+			}
+		}
+	case predHorizUp:
+		if !nb.hasLeft {
+			return false
+		}
+		l := &nb.left
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				z := x + 2*y
+				i := y + x>>1
+				switch {
+				case z > 5:
+					pred[y*4+x] = l[3]
+				case z == 5:
+					pred[y*4+x] = (l[2] + 3*l[3] + 2) >> 2
+				case z&1 == 0:
+					pred[y*4+x] = (l[i] + l[i+1] + 1) >> 1
+				default:
+					pred[y*4+x] = (l[i] + 2*l[i+1] + l[i+2] + 2) >> 2
+				}
+			}
+		}
+	default:
+		return false
+	}
+
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			dst[off+y*stride+x] = byte(pred[y*4+x])
+		}
+	}
+	return true
+}
+
+// predict16x16 writes the Intra16x16 luma prediction (8.3.3).
+func predict16x16(nb *neighbors, mode int, dst []byte, off, stride int) bool {
+	switch mode {
+	case predVertical:
+		if !nb.hasTop {
+			return false
+		}
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 16; x++ {
+				dst[off+y*stride+x] = byte(nb.top[x])
+			}
+		}
+	case predHorizontal:
+		if !nb.hasLeft {
+			return false
+		}
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 16; x++ {
+				dst[off+y*stride+x] = byte(nb.left[y])
+			}
+		}
+	case predDC:
+		var sTop, sLeft int32
+		for i := 0; i < 16; i++ {
+			sTop += nb.top[i]
+			sLeft += nb.left[i]
+		}
+		s := int32(128)
+		switch {
+		case nb.hasTop && nb.hasLeft:
+			s = (sTop + sLeft + 16) >> 5
+		case nb.hasLeft:
+			s = (sLeft + 8) >> 4
+		case nb.hasTop:
+			s = (sTop + 8) >> 4
+		}
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 16; x++ {
+				dst[off+y*stride+x] = byte(s)
+			}
+		}
+	case predPlane:
+		if !nb.hasTop || !nb.hasLeft || !nb.hasTopLeft {
+			return false
+		}
+		planePredict(nb, 16, dst, off, stride)
+	default:
+		return false
+	}
+	return true
+}
+
+// predictChroma writes the 8x8 intra chroma prediction for 4:2:0 (8.3.4).
+func predictChroma(nb *neighbors, mode int, dst []byte, off, stride int) bool {
+	switch mode {
+	case chromaPredDC:
+		for blk := 0; blk < 4; blk++ {
+			xO, yO := (blk&1)*4, (blk>>1)*4
+			var sTop, sLeft int32
+			for i := 0; i < 4; i++ {
+				sTop += nb.top[xO+i]
+				sLeft += nb.left[yO+i]
+			}
+			// The corner blocks prefer both edges; the others prefer
+			// the edge they touch directly.
+			useTop, useLeft := nb.hasTop, nb.hasLeft
+			switch {
+			case xO == 4 && yO == 0 && nb.hasTop:
+				useLeft = false
+			case xO == 0 && yO == 4 && nb.hasLeft:
+				useTop = false
+			}
+			s := int32(128)
+			switch {
+			case useTop && useLeft:
+				s = (sTop + sLeft + 4) >> 3
+			case useLeft:
+				s = (sLeft + 2) >> 2
+			case useTop:
+				s = (sTop + 2) >> 2
+			}
+			for y := 0; y < 4; y++ {
+				for x := 0; x < 4; x++ {
+					dst[off+(yO+y)*stride+xO+x] = byte(s)
+				}
+			}
+		}
+	case chromaPredHorizontal:
+		if !nb.hasLeft {
+			return false
+		}
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 8; x++ {
+				dst[off+y*stride+x] = byte(nb.left[y])
+			}
+		}
+	case chromaPredVertical:
+		if !nb.hasTop {
+			return false
+		}
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 8; x++ {
+				dst[off+y*stride+x] = byte(nb.top[x])
+			}
+		}
+	case chromaPredPlane:
+		if !nb.hasTop || !nb.hasLeft || !nb.hasTopLeft {
+			return false
+		}
+		planePredict(nb, 8, dst, off, stride)
+	default:
+		return false
+	}
+	return true
+}
+
+// planePredict implements plane prediction for a 16x16 luma or 8x8 chroma
+// block.
+func planePredict(nb *neighbors, n int, dst []byte, off, stride int) {
+	half := n / 2
+	p := func(i int, s *[32]int32) int32 {
+		if i < 0 {
+			return nb.topLeft
+		}
+		return s[i]
+	}
+	var left [32]int32
+	copy(left[:], nb.left[:])
+
+	var h, v int32
+	for i := 0; i < half; i++ {
+		h += int32(i+1) * (p(half+i, &nb.top) - p(half-2-i, &nb.top))
+		v += int32(i+1) * (p(half+i, &left) - p(half-2-i, &left))
+	}
+
+	a := 16 * (nb.left[n-1] + nb.top[n-1])
+	var b, c int32
+	if n == 16 {
+		b = (5*h + 32) >> 6
+		c = (5*v + 32) >> 6
+	} else {
+		b = (34*h + 32) >> 6
+		c = (34*v + 32) >> 6
+	}
+	mid := int32(half - 1)
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			dst[off+y*stride+x] = clip1((a + b*(int32(x)-mid) + c*(int32(y)-mid) + 16) >> 5)
+		}
+	}
+}
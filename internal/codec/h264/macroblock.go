@@ -0,0 +1,384 @@
+package h264
+
+// mbDecoder parses and reconstructs one macroblock (7.3.5, 8.3, 8.5).
+type mbDecoder struct {
+	pic   *picture
+	r     *bitReader
+	h     *sliceHeader
+	slice int
+	addr  int
+	mb    *macroblock
+
+	mbX, mbY int
+	blkDone  [16]bool // raster 4x4 blocks reconstructed so far
+
+	chromaMode int
+	cbpLuma    int
+	cbpChroma  int
+
+	lumaDC   [16]int32
+	luma     [16][16]int32 // scan-order levels by luma4x4BlkIdx
+	chromaDC [2][4]int32
+	chromaAC [2][4][15]int32
+}
+
+func (m *mbDecoder) decode(qp *int) error {
+	pic, r := m.pic, m.r
+	m.mb = &pic.mbs[m.addr]
+	m.mb.slice = m.slice
+	m.mbX, m.mbY = m.addr%pic.mbW, m.addr/pic.mbW
+
+	mbType := r.ue()
+	if r.err != nil {
+		return r.err
+	}
+	switch {
+	case mbType == mbTypeIPCM:
+		return m.decodePCM()
+	case mbType > mbTypeIPCM:
+		return errInvalid
+	}
+
+	intra16Mode := 0
+	if mbType == mbTypeINxN {
+		m.mb.intra4x4 = true
+		m.parseIntra4x4Modes()
+	} else {
+		t := int(mbType) - 1
+		intra16Mode = t % 4
+		m.cbpChroma = t / 4 % 3
+		if t >= 12 {
+			m.cbpLuma = 15
+		}
+	}
+	m.chromaMode = int(r.ue())
+	if m.chromaMode > chromaPredPlane {
+		return errInvalid
+	}
+	if m.mb.intra4x4 {
+		code := r.ue()
+		if code >= uint32(len(intraCBP)) {
+			return errInvalid
+		}
+		cbp := int(intraCBP[code])
+		m.cbpLuma, m.cbpChroma = cbp&15, cbp>>4
+	}
+
+	if !m.mb.intra4x4 || m.cbpLuma > 0 || m.cbpChroma > 0 {
+		delta := int(r.se())
+		if delta < -26 || delta > 25 {
+			return errInvalid
+		}
+		*qp = (*qp + delta + 52) % 52
+	}
+	m.mb.qp = *qp
+
+	m.parseResidual()
+	if r.err != nil {
+		return r.err
+	}
+
+	if m.mb.intra4x4 {
+		if !m.reconstructIntra4x4() {
+			return errInvalid
+		}
+	} else if !m.reconstructIntra16x16(intra16Mode) {
+		return errInvalid
+	}
+	if !m.reconstructChroma() {
+		return errInvalid
+	}
+	return nil
+}
+
+// decodePCM copies raw samples into the picture (7.3.5, mb_type I_PCM).
+func (m *mbDecoder) decodePCM() error {
+	pic, r, mb := m.pic, m.r, m.mb
+	r.align()
+	yStride, cStride := pic.mbW*16, pic.mbW*8
+	yOff := m.mbY*16*yStride + m.mbX*16
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			pic.y[yOff+y*yStride+x] = byte(r.u(8))
+		}
+	}
+	cOff := m.mbY*8*cStride + m.mbX*8
+	for _, plane := range [][]byte{pic.cb, pic.cr} {
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 8; x++ {
+				plane[cOff+y*cStride+x] = byte(r.u(8))
+			}
+		}
+	}
+
+	mb.pcm = true
+	mb.qp = 0
+	for i := range mb.nzLuma {
+		mb.nzLuma[i] = 16
+	}
+	for c := range mb.nzChroma {
+		for i := range mb.nzChroma[c] {
+			mb.nzChroma[c][i] = 16
+		}
+	}
+	return r.err
+}
+
+// neighborMB returns the macroblock at the given offset from the current
+// one if it lies in the picture and in the current slice.
+func (m *mbDecoder) neighborMB(dx, dy int) *macroblock {
+	x, y := m.mbX+dx, m.mbY+dy
+	if x < 0 || y < 0 || x >= m.pic.mbW {
+		return nil
+	}
+	n := &m.pic.mbs[y*m.pic.mbW+x]
+	if n.slice != m.slice {
+		return nil
+	}
+	return n
+}
+
+// lumaAvailable reports whether the luma sample at (x, y), relative to the
+// macroblock origin, has been reconstructed and may be used for prediction.
+func (m *mbDecoder) lumaAvailable(x, y int) bool {
+	switch {
+	case y >= 16 || (x >= 16 && y >= 0):
+		return false
+	case x >= 0 && y >= 0:
+		return m.blkDone[(y>>2)*4+x>>2]
+	case y < 0 && x < 0:
+		return m.neighborMB(-1, -1) != nil
+	case y < 0 && x < 16:
+		return m.neighborMB(0, -1) != nil
+	case y < 0:
+		return m.neighborMB(1, -1) != nil
+	default:
+		return m.neighborMB(-1, 0) != nil
+	}
+}
+
+func (m *mbDecoder) parseIntra4x4Modes() {
+	r, mb := m.r, m.mb
+	left, top := m.neighborMB(-1, 0), m.neighborMB(0, -1)
+
+	for blk := 0; blk < 16; blk++ {
+		pos := blkRaster[blk]
+		bx, by := pos&3, pos>>2
+
+		modeA, okA := 0, true
+		if bx > 0 {
+			modeA = int(mb.modes[pos-1])
+		} else if left == nil {
+			okA = false
+		} else if left.intra4x4 {
+			modeA = int(left.modes[pos+3])
+		} else {
+			modeA = predDC
+		}
+		modeB, okB := 0, true
+		if by > 0 {
+			modeB = int(mb.modes[pos-4])
+		} else if top == nil {
+			okB = false
+		} else if top.intra4x4 {
+			modeB = int(top.modes[pos+12])
+		} else {
+			modeB = predDC
+		}
+
+		pred := predDC
+		if okA && okB {
+			pred = min(modeA, modeB)
+		}
+		if r.flag() { // prev_intra4x4_pred_mode_flag
+			mb.modes[pos] = uint8(pred) // #nosec G115 -- mode <= 8
+			continue
+		}
+		rem := int(r.u(3))
+		if rem >= pred {
+			rem++
+		}
+		mb.modes[pos] = uint8(rem) // #nosec G115 -- mode <= 8
+	}
+}
+
+// lumaNC computes nC for the luma 4x4 block at raster position pos (9.2.1).
+func (m *mbDecoder) lumaNC(pos int) int {
+	bx, by := pos&3, pos>>2
+	var nA, nB int
+	okA, okB := true, true
+	if bx > 0 {
+		nA = int(m.mb.nzLuma[pos-1])
+	} else if left := m.neighborMB(-1, 0); left != nil {
+		nA = int(left.nzLuma[pos+3])
+	} else {
+		okA = false
+	}
+	if by > 0 {
+		nB = int(m.mb.nzLuma[pos-4])
+	} else if top := m.neighborMB(0, -1); top != nil {
+		nB = int(top.nzLuma[pos+12])
+	} else {
+		okB = false
+	}
+	return combineNC(nA, nB, okA, okB)
+}
+
+// chromaNC computes nC for chroma AC block blk (raster 2x2) of component c.
+func (m *mbDecoder) chromaNC(c, blk int) int {
+	bx, by := blk&1, blk>>1
+	var nA, nB int
+	okA, okB := true, true
+	if bx > 0 {
+		nA = int(m.mb.nzChroma[c][blk-1])
+	} else if left := m.neighborMB(-1, 0); left != nil {
+		nA = int(left.nzChroma[c][blk+1])
+	} else {
+		okA = false
+	}
+	if by > 0 {
+		nB = int(m.mb.nzChroma[c][blk-2])
+	} else if top := m.neighborMB(0, -1); top != nil {
+		nB = int(top.nzChroma[c][blk+2])
+	} else {
+		okB = false
+	}
+	return combineNC(nA, nB, okA, okB)
+}
+
+func combineNC(nA, nB int, okA, okB bool) int {
+	switch {
+	case okA && okB:
+		return (nA + nB + 1) >> 1
+	case okA:
+		return nA
+	case okB:
+		return nB
+	}
+	return 0
+}
+
+// parseResidual reads residual( 0, 15 ) for a CAVLC intra macroblock.
+func (m *mbDecoder) parseResidual() {
+	r, mb := m.r, m.mb
+
+	if !mb.intra4x4 {
+		readResidualBlock(r, m.lumaDC[:], m.lumaNC(0))
+	}
+	for blk := 0; blk < 16; blk++ {
+		if m.cbpLuma&(1<<uint(blk/4)) == 0 {
+			continue
+		}
+		pos := blkRaster[blk]
+		var n int
+		if mb.intra4x4 {
+			n = readResidualBlock(r, m.luma[blk][:], m.lumaNC(pos))
+		} else {
+			n = readResidualBlock(r, m.luma[blk][:15], m.lumaNC(pos))
+		}
+		mb.nzLuma[pos] = uint8(n) // #nosec G115 -- n <= 16
+	}
+
+	if m.cbpChroma == 0 {
+		return
+	}
+	for c := 0; c < 2; c++ {
+		readResidualBlock(r, m.chromaDC[c][:], -1)
+	}
+	if m.cbpChroma < 2 {
+		return
+	}
+	for c := 0; c < 2; c++ {
+		for blk := 0; blk < 4; blk++ {
+			n := readResidualBlock(r, m.chromaAC[c][blk][:], m.chromaNC(c, blk))
+			mb.nzChroma[c][blk] = uint8(n) // #nosec G115 -- n <= 15
+		}
+	}
+}
+
+func (m *mbDecoder) reconstructIntra4x4() bool {
+	pic, mb := m.pic, m.mb
+	stride := pic.mbW * 16
+	base := m.mbY*16*stride + m.mbX*16
+
+	for blk := 0; blk < 16; blk++ {
+		pos := blkRaster[blk]
+		x, y := (pos&3)*4, (pos>>2)*4
+		off := base + y*stride + x
+
+		nb := neighbors{
+			hasTop:     m.lumaAvailable(x, y-1),
+			hasLeft:    m.lumaAvailable(x-1, y),
+			hasTopLeft: m.lumaAvailable(x-1, y-1),
+		}
+		nb.gather(pic.y, off, stride, 4, m.lumaAvailable(x+4, y-1))
+		if !predict4x4(&nb, int(mb.modes[pos]), pic.y, off, stride) {
+			return false
+		}
+
+		if mb.nzLuma[pos] > 0 {
+			var d [16]int32
+			dequantBlock(&d, m.luma[blk][:], 0, mb.qp)
+			idct4x4Add(&d, pic.y, off, stride)
+		}
+		m.blkDone[pos] = true
+	}
+	return true
+}
+
+func (m *mbDecoder) reconstructIntra16x16(mode int) bool {
+	pic, mb := m.pic, m.mb
+	stride := pic.mbW * 16
+	base := m.mbY*16*stride + m.mbX*16
+
+	nb := neighbors{
+		hasTop:     m.lumaAvailable(0, -1),
+		hasLeft:    m.lumaAvailable(-1, 0),
+		hasTopLeft: m.lumaAvailable(-1, -1),
+	}
+	nb.gather(pic.y, base, stride, 16, false)
+	if !predict16x16(&nb, mode, pic.y, base, stride) {
+		return false
+	}
+
+	dc := lumaDCTransform(&m.lumaDC, mb.qp)
+	for blk := 0; blk < 16; blk++ {
+		pos := blkRaster[blk]
+		var d [16]int32
+		d[0] = dc[pos]
+		dequantBlock(&d, m.luma[blk][:15], 1, mb.qp)
+		idct4x4Add(&d, pic.y, base+(pos>>2)*4*stride+(pos&3)*4, stride)
+	}
+	return true
+}
+
+func (m *mbDecoder) reconstructChroma() bool {
+	pic, mb := m.pic, m.mb
+	stride := pic.mbW * 8
+	base := m.mbY*8*stride + m.mbX*8
+
+	qpc := chromaQP(mb.qp, m.h.pps.chromaQPIndexOffset)
+	for c, plane := range [][]byte{pic.cb, pic.cr} {
+		nb := neighbors{
+			hasTop:     m.neighborMB(0, -1) != nil,
+			hasLeft:    m.neighborMB(-1, 0) != nil,
+			hasTopLeft: m.neighborMB(-1, -1) != nil,
+		}
+		nb.gather(plane, base, stride, 8, false)
+		if !predictChroma(&nb, m.chromaMode, plane, base, stride) {
+			return false
+		}
+		if m.cbpChroma == 0 {
+			continue
+		}
+
+		dc := chromaDCTransform(&m.chromaDC[c], qpc)
+		for blk := 0; blk < 4; blk++ {
+			var d [16]int32
+			d[0] = dc[blk]
+			dequantBlock(&d, m.chromaAC[c][blk][:], 1, qpc)
+			idct4x4Add(&d, plane, base+(blk>>1)*4*stride+(blk&1)*4, stride)
+		}
+	}
+	return true
+}
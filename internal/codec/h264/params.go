@@ -0,0 +1,135 @@
+package h264
+
+// sps holds the sequence parameter set fields the decoder needs (7.3.2.1).
+type sps struct {
+	id                      uint32
+	profileIDC              uint8
+	log2MaxFrameNum         int
+	pocType                 uint32
+	log2MaxPocLsb           int
+	deltaPicOrderAlwaysZero bool
+	mbWidth, mbHeight       int
+	cropLeft, cropRight     int
+	cropTop, cropBottom     int
+}
+
+// pps holds the picture parameter set fields the decoder needs (7.3.2.2).
+type pps struct {
+	id                             uint32
+	spsID                          uint32
+	bottomFieldPicOrderPresent     bool
+	picInitQP                      int
+	chromaQPIndexOffset            int
+	deblockingFilterControlPresent bool
+	redundantPicCntPresent         bool
+}
+
+func parseSPS(rbsp []byte) (*sps, error) {
+	r := newBitReader(rbsp)
+	s := &sps{}
+
+	s.profileIDC = uint8(r.u(8)) // #nosec G115 -- 8-bit read
+	r.skip(8)                    // constraint_set flags, reserved_zero_2bits
+	r.skip(8)                    // level_idc
+	s.id = r.ue()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if s.profileIDC != ProfileBaseline {
+		return nil, ErrUnsupported
+	}
+	if s.id > 31 {
+		return nil, errInvalid
+	}
+
+	s.log2MaxFrameNum = int(r.ue()) + 4
+	s.pocType = r.ue()
+	switch s.pocType {
+	case 0:
+		s.log2MaxPocLsb = int(r.ue()) + 4
+	case 1:
+		s.deltaPicOrderAlwaysZero = r.flag()
+		r.se() // offset_for_non_ref_pic
+		r.se() // offset_for_top_to_bottom_field
+		n := r.ue()
+		if n > 255 {
+			return nil, errInvalid
+		}
+		for i := uint32(0); i < n; i++ {
+			r.se() // offset_for_ref_frame
+		}
+	case 2:
+	default:
+		return nil, errInvalid
+	}
+	if s.log2MaxFrameNum > 16 || s.log2MaxPocLsb > 16 {
+		return nil, errInvalid
+	}
+
+	r.ue()    // max_num_ref_frames
+	r.skip(1) // gaps_in_frame_num_value_allowed_flag
+	s.mbWidth = int(r.ue()) + 1
+	s.mbHeight = int(r.ue()) + 1
+	if !r.flag() { // frame_mbs_only_flag
+		return nil, ErrUnsupported
+	}
+	r.skip(1) // direct_8x8_inference_flag
+	if r.flag() {
+		s.cropLeft = int(r.ue()) * 2
+		s.cropRight = int(r.ue()) * 2
+		s.cropTop = int(r.ue()) * 2
+		s.cropBottom = int(r.ue()) * 2
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if s.mbWidth*s.mbHeight > maxFrameMBs || s.mbWidth > maxFrameMBs || s.mbHeight > maxFrameMBs {
+		return nil, ErrUnsupported
+	}
+	if s.cropLeft+s.cropRight >= s.mbWidth*16 || s.cropTop+s.cropBottom >= s.mbHeight*16 {
+		return nil, errInvalid
+	}
+	return s, nil
+}
+
+func parsePPS(rbsp []byte) (*pps, error) {
+	r := newBitReader(rbsp)
+	p := &pps{}
+
+	p.id = r.ue()
+	p.spsID = r.ue()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if p.id > 255 || p.spsID > 31 {
+		return nil, errInvalid
+	}
+	if r.flag() { // entropy_coding_mode_flag (CABAC)
+		return nil, ErrUnsupported
+	}
+	p.bottomFieldPicOrderPresent = r.flag()
+	if r.ue() != 0 { // num_slice_groups_minus1
+		return nil, ErrUnsupported
+	}
+	r.ue()    // num_ref_idx_l0_default_active_minus1
+	r.ue()    // num_ref_idx_l1_default_active_minus1
+	r.skip(3) // weighted_pred_flag, weighted_bipred_idc
+	p.picInitQP = 26 + int(r.se())
+	r.se() // pic_init_qs_minus26
+	p.chromaQPIndexOffset = int(r.se())
+	p.deblockingFilterControlPresent = r.flag()
+	r.skip(1) // constrained_intra_pred_flag: no inter macroblocks to constrain
+	p.redundantPicCntPresent = r.flag()
+	if r.moreRBSPData() && r.flag() { // transform_8x8_mode_flag
+		return nil, ErrUnsupported
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if p.picInitQP < 0 || p.picInitQP > 51 || p.chromaQPIndexOffset < -12 || p.chromaQPIndexOffset > 12 {
+		return nil, errInvalid
+	}
+	return p, nil
+}
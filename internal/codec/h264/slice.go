@@ -0,0 +1,233 @@
+package h264
+
+// Macroblock types in I slices (Table 7-11)
+const (
+	mbTypeINxN  = 0
+	mbTypeIPCM  = 25
+	sliceTypeI  = 2
+	sliceTypeSI = 4
+)
+
+// blkRaster maps luma4x4BlkIdx (z-order) to the raster position of the
+// 4x4 block within its macroblock.
+var blkRaster = [16]int{0, 1, 4, 5, 2, 3, 6, 7, 8, 9, 12, 13, 10, 11, 14, 15}
+
+// intraCBP maps codeNum to coded_block_pattern for intra macroblocks
+// (Table 9-4, ChromaArrayType 1).
+var intraCBP = [48]uint8{
+	47, 31, 15, 0, 23, 27, 29, 30, 7, 11, 13, 14, 39, 43, 45, 46,
+	16, 3, 5, 10, 12, 19, 21, 26, 28, 35, 37, 42, 44, 1, 2, 4,
+	8, 17, 18, 20, 24, 6, 9, 22, 25, 32, 33, 34, 36, 40, 38, 41,
+}
+
+// sliceHeader holds the slice header fields that affect reconstruction.
+type sliceHeader struct {
+	pps            *pps
+	sps            *sps
+	firstMB        int
+	qp             int
+	disableDeblock uint32
+	filterOffsetA  int
+	filterOffsetB  int
+}
+
+// macroblock records per-macroblock state needed by neighbouring
+// macroblocks and the deblocking filter.
+type macroblock struct {
+	slice    int // 1-based slice number; 0 while not yet decoded
+	intra4x4 bool
+	pcm      bool
+	qp       int
+	modes    [16]uint8 // Intra4x4PredMode by raster 4x4 position
+	nzLuma   [16]uint8 // TotalCoeff by raster 4x4 position
+	nzChroma [2][4]uint8
+}
+
+// picture is a frame under reconstruction, padded to whole macroblocks.
+type picture struct {
+	sps      *sps
+	mbW, mbH int
+	y, cb    []byte
+	cr       []byte
+	mbs      []macroblock
+	slices   []*sliceHeader
+	decoded  int
+}
+
+func newPicture(s *sps) *picture {
+	w, h := s.mbWidth*16, s.mbHeight*16
+	return &picture{
+		sps: s,
+		mbW: s.mbWidth,
+		mbH: s.mbHeight,
+		y:   make([]byte, w*h),
+		cb:  make([]byte, w*h/4),
+		cr:  make([]byte, w*h/4),
+		mbs: make([]macroblock, s.mbWidth*s.mbHeight),
+	}
+}
+
+func (p *picture) complete() bool {
+	return p != nil && p.decoded == len(p.mbs)
+}
+
+// finish deblocks the picture and returns it cropped.
+func (p *picture) finish() *Frame {
+	p.deblock()
+
+	s := p.sps
+	yStride, cStride := p.mbW*16, p.mbW*8
+	w := yStride - s.cropLeft - s.cropRight
+	h := p.mbH*16 - s.cropTop - s.cropBottom
+	f := &Frame{
+		Width:   w,
+		Height:  h,
+		YStride: w,
+		CStride: (w + 1) / 2,
+	}
+	f.Y = cropPlane(p.y, yStride, s.cropLeft, s.cropTop, w, h)
+	f.Cb = cropPlane(p.cb, cStride, s.cropLeft/2, s.cropTop/2, (w+1)/2, (h+1)/2)
+	f.Cr = cropPlane(p.cr, cStride, s.cropLeft/2, s.cropTop/2, (w+1)/2, (h+1)/2)
+	return f
+}
+
+func cropPlane(src []byte, stride, x, y, w, h int) []byte {
+	out := make([]byte, w*h)
+	for row := 0; row < h; row++ {
+		copy(out[row*w:(row+1)*w], src[(y+row)*stride+x:])
+	}
+	return out
+}
+
+func (d *decoder) parseSliceHeader(r *bitReader, idr bool, refIdc uint8) (*sliceHeader, error) {
+	h := &sliceHeader{}
+	h.firstMB = int(r.ue())
+	sliceType := r.ue()
+	ppsID := r.ue()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if sliceType > 9 {
+		return nil, errInvalid
+	}
+	if sliceType%5 != sliceTypeI {
+		return nil, ErrUnsupported
+	}
+	p, ok := d.ppss[ppsID]
+	if !ok {
+		return nil, errInvalid
+	}
+	s, ok := d.spss[p.spsID]
+	if !ok {
+		return nil, errInvalid
+	}
+	h.pps, h.sps = p, s
+
+	r.skip(s.log2MaxFrameNum) // frame_num
+	if idr {
+		r.ue() // idr_pic_id
+	}
+	switch s.pocType {
+	case 0:
+		r.skip(s.log2MaxPocLsb) // pic_order_cnt_lsb
+		if p.bottomFieldPicOrderPresent {
+			r.se() // delta_pic_order_cnt_bottom
+		}
+	case 1:
+		if !s.deltaPicOrderAlwaysZero {
+			r.se() // delta_pic_order_cnt[0]
+			if p.bottomFieldPicOrderPresent {
+				r.se() // delta_pic_order_cnt[1]
+			}
+		}
+	}
+	if p.redundantPicCntPresent && r.ue() != 0 {
+		// Redundant slices duplicate the primary picture
+		return nil, ErrUnsupported
+	}
+	if refIdc != 0 {
+		parseDecRefPicMarking(r, idr)
+	}
+	h.qp = p.picInitQP + int(r.se())
+	if p.deblockingFilterControlPresent {
+		h.disableDeblock = r.ue()
+		if h.disableDeblock != 1 {
+			h.filterOffsetA = int(r.se()) * 2
+			h.filterOffsetB = int(r.se()) * 2
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if h.qp < 0 || h.qp > 51 || h.disableDeblock > 2 ||
+		h.filterOffsetA < -12 || h.filterOffsetA > 12 || h.filterOffsetB < -12 || h.filterOffsetB > 12 {
+		return nil, errInvalid
+	}
+	return h, nil
+}
+
+// parseDecRefPicMarking skips dec_ref_pic_marking (7.3.3.3); reference
+// handling is irrelevant for intra-only decoding.
+func parseDecRefPicMarking(r *bitReader, idr bool) {
+	if idr {
+		r.skip(2) // no_output_of_prior_pics_flag, long_term_reference_flag
+		return
+	}
+	if !r.flag() { // adaptive_ref_pic_marking_mode_flag
+		return
+	}
+	for i := 0; i < 66 && r.err == nil; i++ {
+		op := r.ue()
+		if op == 0 {
+			return
+		}
+		if op == 1 || op == 3 {
+			r.ue() // difference_of_pic_nums_minus1
+		}
+		if op == 2 {
+			r.ue() // long_term_pic_num
+		}
+		if op == 3 || op == 6 {
+			r.ue() // long_term_frame_idx
+		}
+		if op == 4 {
+			r.ue() // max_long_term_frame_idx_plus1
+		}
+	}
+	r.err = errInvalid
+}
+
+func (d *decoder) decodeSlice(rbsp []byte, idr bool, refIdc uint8) error {
+	r := newBitReader(rbsp)
+	h, err := d.parseSliceHeader(r, idr, refIdc)
+	if err != nil {
+		return err
+	}
+
+	if d.pic == nil || h.firstMB == 0 {
+		d.pic = newPicture(h.sps)
+	}
+	pic := d.pic
+	if pic.sps != h.sps {
+		return errInvalid
+	}
+	pic.slices = append(pic.slices, h)
+	sliceNum := len(pic.slices)
+
+	qp := h.qp
+	for addr := h.firstMB; ; addr++ {
+		if addr >= len(pic.mbs) || pic.mbs[addr].slice != 0 {
+			return errInvalid
+		}
+		mbd := mbDecoder{pic: pic, r: r, h: h, slice: sliceNum, addr: addr}
+		if err := mbd.decode(&qp); err != nil {
+			return err
+		}
+		pic.decoded++
+		if !r.moreRBSPData() {
+			break
+		}
+	}
+	return r.err
+}
@@ -0,0 +1,162 @@
+package h264
+
+// zigzag4x4 maps frame zig-zag scan positions to raster positions (8.5.6).
+var zigzag4x4 = [16]int{0, 1, 4, 8, 5, 2, 3, 6, 9, 12, 13, 10, 7, 11, 14, 15}
+
+// normAdjust4x4 holds v(m, n) from 8.5.9, indexed by qP%6.
+var normAdjust4x4 = [6][3]int32{
+	{10, 16, 13},
+	{11, 18, 14},
+	{13, 20, 16},
+	{14, 23, 18},
+	{16, 25, 20},
+	{18, 29, 23},
+}
+
+// chromaQPTable maps qPI to QPC (Table 8-15).
+var chromaQPTable = [52]int{
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+	16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 29, 30,
+	31, 32, 32, 33, 34, 34, 35, 35, 36, 36, 37, 37, 37, 38, 38, 38,
+	39, 39, 39, 39,
+}
+
+// chromaQP derives QPC from QPY and chroma_qp_index_offset (8.5.8).
+func chromaQP(qpY, offset int) int {
+	return chromaQPTable[clip3(0, 51, qpY+offset)]
+}
+
+// levelScale returns LevelScale4x4(qP%6, raster position) with flat
+// scaling matrices, i.e. 16 * normAdjust4x4.
+func levelScale(qpRem, pos int) int32 {
+	x, y := pos&3, pos>>2
+	switch {
+	case x&1 == 0 && y&1 == 0:
+		return 16 * normAdjust4x4[qpRem][0]
+	case x&1 == 1 && y&1 == 1:
+		return 16 * normAdjust4x4[qpRem][1]
+	default:
+		return 16 * normAdjust4x4[qpRem][2]
+	}
+}
+
+// scaleCoeff scales one transform coefficient level for a 4x4 block (8.5.12.1).
+func scaleCoeff(c int32, qp, pos int) int32 {
+	ls := levelScale(qp%6, pos)
+	if qp >= 24 {
+		return c * ls << uint(qp/6-4)
+	}
+	return (c*ls + 1<<uint(3-qp/6)) >> uint(4-qp/6)
+}
+
+// dequantBlock places scan-order levels coeffs[start:] into the raster-order
+// block d, scaled for qp. The DC position is left untouched when start is 1.
+func dequantBlock(d *[16]int32, coeffs []int32, start, qp int) {
+	for i := start; i < 16; i++ {
+		if c := coeffs[i-start]; c != 0 {
+			pos := zigzag4x4[i]
+			d[pos] = scaleCoeff(c, qp, pos)
+		}
+	}
+}
+
+// lumaDCTransform inverts the Intra16x16 DC Hadamard transform and scales
+// the result (8.5.10). c holds the 16 levels in scan order; the result is in
+// raster order of the 4x4 blocks within the macroblock.
+func lumaDCTransform(c *[16]int32, qp int) [16]int32 {
+	var m [16]int32
+	for i, v := range c {
+		m[zigzag4x4[i]] = v
+	}
+
+	var f [16]int32
+	for i := 0; i < 4; i++ {
+		a, b, cc, d := m[i*4], m[i*4+1], m[i*4+2], m[i*4+3]
+		f[i*4] = a + b + cc + d
+		f[i*4+1] = a + b - cc - d
+		f[i*4+2] = a - b - cc + d
+		f[i*4+3] = a - b + cc - d
+	}
+	for j := 0; j < 4; j++ {
+		a, b, cc, d := f[j], f[4+j], f[8+j], f[12+j]
+		f[j] = a + b + cc + d
+		f[4+j] = a + b - cc - d
+		f[8+j] = a - b - cc + d
+		f[12+j] = a - b + cc - d
+	}
+
+	ls := levelScale(qp%6, 0)
+	for i := range f {
+		if qp >= 36 {
+			f[i] = f[i] * ls << uint(qp/6-6)
+		} else {
+			f[i] = (f[i]*ls + 1<<uint(5-qp/6)) >> uint(6-qp/6)
+		}
+	}
+	return f
+}
+
+// chromaDCTransform inverts the 2x2 chroma DC transform and scales the
+// result (8.5.11) for 4:2:0.
+func chromaDCTransform(c *[4]int32, qp int) [4]int32 {
+	a, b, cc, d := c[0], c[1], c[2], c[3]
+	f := [4]int32{
+		a + b + cc + d,
+		a - b + cc - d,
+		a + b - cc - d,
+		a - b - cc + d,
+	}
+	ls := levelScale(qp%6, 0)
+	for i := range f {
+		f[i] = (f[i] * ls << uint(qp/6)) >> 5
+	}
+	return f
+}
+
+// idct4x4Add applies the 4x4 inverse transform to the raster-order block d
+// (8.5.12.2) and adds the residual to dst.
+func idct4x4Add(d *[16]int32, dst []byte, off, stride int) {
+	var f [16]int32
+	for i := 0; i < 4; i++ {
+		r := d[i*4 : i*4+4]
+		e0 := r[0] + r[2]
+		e1 := r[0] - r[2]
+		e2 := r[1]>>1 - r[3]
+		e3 := r[1] + r[3]>>1
+		f[i*4] = e0 + e3
+		f[i*4+1] = e1 + e2
+		f[i*4+2] = e1 - e2
+		f[i*4+3] = e0 - e3
+	}
+	for j := 0; j < 4; j++ {
+		g0 := f[j] + f[8+j]
+		g1 := f[j] - f[8+j]
+		g2 := f[4+j]>>1 - f[12+j]
+		g3 := f[4+j] + f[12+j]>>1
+		h := [4]int32{g0 + g3, g1 + g2, g1 - g2, g0 - g3}
+		for i := 0; i < 4; i++ {
+			p := off + i*stride + j
+			dst[p] = clip1(int32(dst[p]) + (h[i]+32)>>6)
+		}
+	}
+}
+
+func clip1(v int32) byte {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return byte(v)
+}
+
+func clip3(lo, hi, v int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -80,3 +80,138 @@ func encodeNSCodecRaw(pixels []byte, width, height, stride int, bgra bool) ([]by
 	out = append(out, green...)
 	return out, true
 }
+
+// nscodecColorLossLevel is the chroma quantization EncodeNSCodec applies,
+// the level Windows servers use by default.
+const nscodecColorLossLevel = 3
+
+// EncodeNSCodec encodes top-down 32-bpp RGBA pixels as an
+// NSCODEC_BITMAP_STREAM the way a server does: 2x2 chroma subsampling,
+// colorLossLevel 3 and RLE planes. The result is lossy; DecodeNSCodecToRGBA
+// restores the image within the error of the subsampled, quantized chroma.
+// It returns nil if rgba is shorter than width*height pixels or the
+// dimensions are invalid.
+func EncodeNSCodec(rgba []byte, width, height int) []byte {
+	if width <= 0 || height <= 0 || width > (1<<24)/height || len(rgba) < width*height*4 {
+		return nil
+	}
+
+	// Luma rows are padded to a multiple of 8 by repeating the last pixel,
+	// and the chroma planes are half the padded size in each direction
+	lumaWidth := roundUpToMultiple(width, 8)
+	chromaWidth := lumaWidth / 2
+	chromaHeight := roundUpToMultiple(height, 2) / 2
+
+	luma := make([]byte, lumaWidth*height)
+	co := make([]int, lumaWidth*height)
+	cg := make([]int, lumaWidth*height)
+	alpha := make([]byte, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < lumaWidth; x++ {
+			si := (y*width + min(x, width-1)) * 4
+			r, g, b := int(rgba[si]), int(rgba[si+1]), int(rgba[si+2])
+
+			// The inverse of AYCoCgToRGBA: R = t + Co, B = t - Co,
+			// G = Y + Cg and t = Y - Cg
+			t := (r + b) / 2
+			i := y*lumaWidth + x
+			luma[i] = clampByteNS((g + t) / 2)
+			co[i] = (r - b) / 2
+			cg[i] = (g - t) / 2
+			if x < width {
+				alpha[y*width+x] = rgba[si+3]
+			}
+		}
+	}
+
+	shift := nscodecColorLossLevel - 1
+	orange := make([]byte, chromaWidth*chromaHeight)
+	green := make([]byte, chromaWidth*chromaHeight)
+	for y := 0; y < chromaHeight; y++ {
+		// The last row of an odd height pairs with itself
+		row0 := 2 * y * lumaWidth
+		row1 := min(2*y+1, height-1) * lumaWidth
+		for x := 0; x < chromaWidth; x++ {
+			i0, i1 := row0+2*x, row1+2*x
+			coSum := co[i0] + co[i0+1] + co[i1] + co[i1+1]
+			cgSum := cg[i0] + cg[i0+1] + cg[i1] + cg[i1+1]
+			// Round to the nearest quantization step
+			orange[y*chromaWidth+x] = clampByteNS(coSum/4+128+(1<<shift)/2) >> shift
+			green[y*chromaWidth+x] = clampByteNS(cgSum/4+128+(1<<shift)/2) >> shift
+		}
+	}
+
+	planes := [][]byte{
+		NSCodecRLECompress(luma),
+		NSCodecRLECompress(orange),
+		NSCodecRLECompress(green),
+		NSCodecRLECompress(alpha),
+	}
+	out := make([]byte, 20)
+	for i, plane := range planes {
+		binary.LittleEndian.PutUint32(out[i*4:], uint32(len(plane))) // #nosec G115 -- planes are below 2^24 pixels
+	}
+	out[16] = nscodecColorLossLevel
+	out[17] = 1 // chroma subsampling
+	for _, plane := range planes {
+		out = append(out, plane...)
+	}
+	return out
+}
+
+// NSCodecRLECompress compresses a plane for NSCodecRLEDecompress: run and
+// literal segments followed by the last 4 bytes raw (MS-RDPNSC 2.2.2.1).
+// Planes that would not shrink are returned as is, which the decoder reads
+// as raw.
+func NSCodecRLECompress(plane []byte) []byte {
+	const endSize = 4
+	if len(plane) <= endSize+1 {
+		return plane
+	}
+
+	body := plane[:len(plane)-endSize]
+	out := make([]byte, 0, len(plane))
+	literalStart := 0
+	flushLiterals := func(end int) {
+		for literalStart < end {
+			n := min(end-literalStart, 127+256)
+			if n < 128 {
+				out = append(out, byte(n))
+			} else {
+				out = append(out, 0x00, byte(n-128))
+			}
+			out = append(out, body[literalStart:literalStart+n]...)
+			literalStart += n
+		}
+	}
+
+	for i := 0; i < len(body); {
+		run := 1
+		for i+run < len(body) && body[i+run] == body[i] && run < 127+256 {
+			run++
+		}
+		if run < 3 {
+			i += run
+			continue
+		}
+		flushLiterals(i)
+		if run < 128 {
+			out = append(out, 0x80|byte(run))
+		} else {
+			out = append(out, 0x80, byte(run-128))
+		}
+		out = append(out, body[i])
+		i += run
+		literalStart = i
+		if len(out) >= len(plane) {
+			return plane
+		}
+	}
+	flushLiterals(len(body))
+
+	out = append(out, plane[len(body):]...)
+	if len(out) >= len(plane) {
+		return plane
+	}
+	return out
+}
@@ -1,6 +1,10 @@
 package codec
 
-import "testing"
+import (
+	"bytes"
+	"math"
+	"testing"
+)
 
 func TestEncodeNSCodecRawBGRA(t *testing.T) {
 	pixels := []byte{
@@ -54,3 +58,120 @@ func absByteDiff(a, b byte) int {
 	}
 	return int(b - a)
 }
+
+// testImage returns RGBA pixels of colour gradients with a few hard-edged
+// rectangles, like screen content, and an alpha gradient
+func testImage(width, height int) []byte {
+	rgba := make([]byte, width*height*4)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := (y*width + x) * 4
+			rgba[i] = byte(x * 255 / width)
+			rgba[i+1] = byte(y * 255 / height)
+			rgba[i+2] = byte((x + y) * 127 / (width + height))
+			rgba[i+3] = byte(255 - x*64/width)
+			if x/8%3 == 1 && y/8%2 == 1 {
+				rgba[i], rgba[i+1], rgba[i+2] = 240, 240, 240
+			}
+		}
+	}
+	return rgba
+}
+
+// psnr returns the peak signal-to-noise ratio of got against want in dB
+func psnr(want, got []byte) float64 {
+	var sum float64
+	for i := range want {
+		d := float64(want[i]) - float64(got[i])
+		sum += d * d
+	}
+	if sum == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/(sum/float64(len(want))))
+}
+
+func TestEncodeNSCodec_RoundTrip(t *testing.T) {
+	for _, size := range []struct{ width, height int }{
+		{64, 64},
+		{37, 23}, // padded luma rows and an odd chroma row
+		{1, 1},
+	} {
+		rgba := testImage(size.width, size.height)
+		encoded := EncodeNSCodec(rgba, size.width, size.height)
+		if encoded == nil {
+			t.Fatalf("%dx%d: EncodeNSCodec returned nil", size.width, size.height)
+		}
+		if encoded[16] != 3 || encoded[17] != 1 {
+			t.Fatalf("%dx%d: colorLossLevel %d, chromaSubsamplingLevel %d", size.width, size.height, encoded[16], encoded[17])
+		}
+
+		decoded := DecodeNSCodecToRGBA(encoded, size.width, size.height)
+		if len(decoded) != len(rgba) {
+			t.Fatalf("%dx%d: decoded %d bytes, want %d", size.width, size.height, len(decoded), len(rgba))
+		}
+		if got := psnr(rgba, decoded); got < 30 {
+			t.Errorf("%dx%d: PSNR %.1f dB, want at least 30 dB", size.width, size.height, got)
+		}
+
+		// Alpha is not subsampled, so it is exact
+		for i := 3; i < len(rgba); i += 4 {
+			if decoded[i] != rgba[i] {
+				t.Fatalf("%dx%d: alpha %d at byte %d, want %d", size.width, size.height, decoded[i], i, rgba[i])
+			}
+		}
+
+		viaDecode, err := Decode(encoded, size.width, size.height)
+		if err != nil {
+			t.Fatalf("%dx%d: Decode: %v", size.width, size.height, err)
+		}
+		if !bytes.Equal(viaDecode, decoded) {
+			t.Errorf("%dx%d: Decode and DecodeNSCodecToRGBA differ", size.width, size.height)
+		}
+	}
+}
+
+func TestEncodeNSCodec_CompressesFlatImage(t *testing.T) {
+	rgba := bytes.Repeat([]byte{0x20, 0x40, 0x60, 0xFF}, 256*256)
+	encoded := EncodeNSCodec(rgba, 256, 256)
+	if len(encoded) > len(rgba)/100 {
+		t.Fatalf("flat image encoded to %d bytes", len(encoded))
+	}
+	if got := psnr(rgba, DecodeNSCodecToRGBA(encoded, 256, 256)); got < 40 {
+		t.Errorf("PSNR %.1f dB, want at least 40 dB", got)
+	}
+}
+
+func TestEncodeNSCodec_RejectsInvalid(t *testing.T) {
+	if EncodeNSCodec(make([]byte, 15), 2, 2) != nil {
+		t.Fatal("expected short input to be rejected")
+	}
+	if EncodeNSCodec(nil, 0, 1) != nil {
+		t.Fatal("expected invalid dimensions to be rejected")
+	}
+}
+
+func TestNSCodecRLECompress_RoundTrip(t *testing.T) {
+	mixed := []byte{1, 2, 3}
+	mixed = append(mixed, bytes.Repeat([]byte{7}, 500)...) // longer than one run segment
+	for i := range 400 {                                   // longer than one literal segment
+		mixed = append(mixed, byte(i*7))
+	}
+	mixed = append(mixed, bytes.Repeat([]byte{9}, 130)...)
+	mixed = append(mixed, 4, 4, 5, 6, 6)
+
+	for _, plane := range [][]byte{
+		mixed,
+		bytes.Repeat([]byte{0xAB}, 1000),
+		{1, 2, 3, 4, 5, 6, 7, 8}, // incompressible, kept raw
+		{1, 2},
+	} {
+		compressed := NSCodecRLECompress(plane)
+		if len(compressed) > len(plane) {
+			t.Fatalf("compressed %d bytes to %d", len(plane), len(compressed))
+		}
+		if got := NSCodecRLEDecompress(compressed, len(plane)); !bytes.Equal(got, plane) {
+			t.Fatalf("round trip of %d bytes failed", len(plane))
+		}
+	}
+}
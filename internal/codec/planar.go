@@ -5,96 +5,75 @@ package codec
 
 const (
 	// Format header flags
-	PlanarFlagRLE     = 0x10 // Run Length Encoding
-	PlanarFlagNoAlpha = 0x20 // No Alpha plane
+	PlanarFlagColorLoss       = 0x07 // Color loss level mask (0 = RGB planes)
+	PlanarFlagChromaSubsample = 0x08 // Chroma planes subsampled 2x2
+	PlanarFlagRLE             = 0x10 // Run Length Encoding
+	PlanarFlagNoAlpha         = 0x20 // No Alpha plane
+	planarReservedMask        = 0xC0
 )
 
-// DecompressPlanar decompresses RDP6 Planar codec data to RGBA
-func DecompressPlanar(src []byte, width, height int) []byte {
-	if len(src) < 1 {
-		return nil
-	}
-	if width <= 0 || height <= 0 {
+// DecodePlanar decodes an RDP6 Planar bitmap (MS-RDPEGDI 2.2.2.5.1) to
+// top-down RGBA. The planes, raw or RLE encoded, are an optional alpha plane
+// followed by either red, green and blue planes or, at a non-zero color loss
+// level, luma, orange chroma and green chroma planes, the chroma planes
+// optionally subsampled to half width and height. Planes are bottom-up.
+//
+// It returns nil if the format header is invalid or src is too short.
+func DecodePlanar(src []byte, width, height int) []byte {
+	if len(src) < 1 || width <= 0 || height <= 0 {
 		return nil
 	}
 
 	formatHeader := src[0]
-	hasRLE := (formatHeader & PlanarFlagRLE) != 0
-	noAlpha := (formatHeader & PlanarFlagNoAlpha) != 0
-
-	srcIdx := 1
-	planeSize := width * height
-	if planeSize <= 0 {
+	colorLoss := int(formatHeader & PlanarFlagColorLoss)
+	subsampled := formatHeader&PlanarFlagChromaSubsample != 0
+	hasRLE := formatHeader&PlanarFlagRLE != 0
+	noAlpha := formatHeader&PlanarFlagNoAlpha != 0
+	if formatHeader&planarReservedMask != 0 || (subsampled && colorLoss == 0) {
 		return nil
 	}
 
-	// Allocate planes
-	planeR := make([]byte, planeSize)
-	planeG := make([]byte, planeSize)
-	planeB := make([]byte, planeSize)
-	planeA := make([]byte, planeSize)
-
-	// Initialize alpha to 255 if no alpha plane
-	if noAlpha {
-		for i := range planeA {
-			planeA[i] = 255
-		}
+	planeSize := width * height
+	chromaWidth, chromaHeight := width, height
+	if subsampled {
+		chromaWidth, chromaHeight = (width+1)/2, (height+1)/2
 	}
 
-	if hasRLE {
-		// RLE encoded planes: Alpha, Red, Green, Blue order
-		var consumed int
+	alpha := make([]byte, planeSize)
+	first := make([]byte, planeSize)
+	second := make([]byte, chromaWidth*chromaHeight)
+	third := make([]byte, chromaWidth*chromaHeight)
 
-		if !noAlpha {
-			consumed = decompressPlanarPlaneRLE(src[srcIdx:], planeA, width, height)
-			if consumed < 0 {
-				return nil
-			}
+	srcIdx := 1
+	readPlane := func(dst []byte, w, h int) bool {
+		if hasRLE {
+			consumed := decompressPlanarPlaneRLE(src[srcIdx:], dst, w, h)
 			srcIdx += consumed
+			return consumed >= 0
 		}
-
-		consumed = decompressPlanarPlaneRLE(src[srcIdx:], planeR, width, height)
-		if consumed < 0 {
-			return nil
-		}
-		srcIdx += consumed
-
-		consumed = decompressPlanarPlaneRLE(src[srcIdx:], planeG, width, height)
-		if consumed < 0 {
-			return nil
-		}
-		srcIdx += consumed
-
-		consumed = decompressPlanarPlaneRLE(src[srcIdx:], planeB, width, height)
-		if consumed < 0 {
-			return nil
-		}
-	} else {
-		// Raw planes
-		if !noAlpha {
-			if srcIdx+planeSize > len(src) {
-				return nil
-			}
-			copy(planeA, src[srcIdx:srcIdx+planeSize])
-			srcIdx += planeSize
-		}
-
-		if srcIdx+planeSize > len(src) {
-			return nil
-		}
-		copy(planeR, src[srcIdx:srcIdx+planeSize])
-		srcIdx += planeSize
-
-		if srcIdx+planeSize > len(src) {
-			return nil
+		if srcIdx+len(dst) > len(src) {
+			return false
 		}
-		copy(planeG, src[srcIdx:srcIdx+planeSize])
-		srcIdx += planeSize
+		srcIdx += copy(dst, src[srcIdx:srcIdx+len(dst)])
+		return true
+	}
 
-		if srcIdx+planeSize > len(src) {
-			return nil
+	if noAlpha {
+		for i := range alpha {
+			alpha[i] = 255
 		}
-		copy(planeB, src[srcIdx:srcIdx+planeSize])
+	} else if !readPlane(alpha, width, height) {
+		return nil
+	}
+	// Red/luma, green/orange chroma, then blue/green chroma
+	if !readPlane(first, width, height) ||
+		!readPlane(second, chromaWidth, chromaHeight) ||
+		!readPlane(third, chromaWidth, chromaHeight) {
+		return nil
+	}
+	if subsampled {
+		second = expandPlanarChroma(second, width, height)
+		third = expandPlanarChroma(third, width, height)
 	}
 
 	// Combine planes to RGBA with vertical flip (planar data is bottom-up)
@@ -103,18 +82,57 @@ func DecompressPlanar(src []byte, width, height int) []byte {
 		srcRow := (height - 1 - y) * width // Read from bottom
 		dstRow := y * width                // Write to top
 		for x := 0; x < width; x++ {
-			srcIdx := srcRow + x
-			dstIdx := (dstRow + x) * 4
-			rgba[dstIdx] = planeR[srcIdx]
-			rgba[dstIdx+1] = planeG[srcIdx]
-			rgba[dstIdx+2] = planeB[srcIdx]
-			rgba[dstIdx+3] = planeA[srcIdx]
+			i := srcRow + x
+			dst := rgba[(dstRow+x)*4 : (dstRow+x)*4+4]
+			if colorLoss == 0 {
+				dst[0], dst[1], dst[2] = first[i], second[i], third[i]
+			} else {
+				dst[0], dst[1], dst[2] = planarYCoCgToRGB(first[i], second[i], third[i], colorLoss)
+			}
+			dst[3] = alpha[i]
 		}
 	}
 
 	return rgba
 }
 
+// expandPlanarChroma scales a chroma plane subsampled to half width and
+// height back to width x height, repeating each sample over a 2x2 block.
+func expandPlanarChroma(plane []byte, width, height int) []byte {
+	subWidth := (width + 1) / 2
+	out := make([]byte, width*height)
+	for y := 0; y < height; y++ {
+		row := plane[(y/2)*subWidth:]
+		for x := 0; x < width; x++ {
+			out[y*width+x] = row[x/2]
+		}
+	}
+	return out
+}
+
+// planarYCoCgToRGB converts a YCoCg sample back to RGB (MS-RDPEGDI
+// 3.1.9.1.2). The chroma values were shifted right by the color loss level
+// minus one and are signed.
+func planarYCoCgToRGB(luma, co, cg byte, colorLoss int) (r, g, b byte) {
+	shift := colorLoss - 1
+	y := int(luma)
+	orange := int(int8(co << shift))
+	green := int(int8(cg << shift))
+
+	t := y - green
+	return clampByte(t + orange), clampByte(y + green), clampByte(t - orange)
+}
+
+func clampByte(v int) byte {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return byte(v)
+}
+
 // decompressPlanarPlaneRLE decompresses a single RLE-encoded plane
 // Returns number of bytes consumed, or -1 on error
 func decompressPlanarPlaneRLE(src []byte, dst []byte, width, height int) int {
@@ -192,23 +210,22 @@ func decompressPlanarPlaneRLE(src []byte, dst []byte, width, height int) int {
 						pixel = int16(deltaValue >> 1)
 					}
 
-					// Add delta to previous scanline value with saturation
-					dst[dstIdx] = clampPlanarDelta(previousScanline[x], pixel)
+					dst[dstIdx] = applyPlanarDelta(previousScanline[x], pixel)
 					dstIdx++
 					x++
 					cRawBytes--
 				}
 
-					// For run, add same delta to each previous scanline value
-					for nRunLength > 0 {
-						if dstIdx >= len(dst) {
-							return -1
-						}
-						dst[dstIdx] = clampPlanarDelta(previousScanline[x], pixel)
-						dstIdx++
-						x++
-						nRunLength--
+				// For run, add same delta to each previous scanline value
+				for nRunLength > 0 {
+					if dstIdx >= len(dst) {
+						return -1
 					}
+					dst[dstIdx] = applyPlanarDelta(previousScanline[x], pixel)
+					dstIdx++
+					x++
+					nRunLength--
+				}
 			}
 		}
 
@@ -218,13 +235,9 @@ func decompressPlanarPlaneRLE(src []byte, dst []byte, width, height int) int {
 	return srcIdx
 }
 
-func clampPlanarDelta(base byte, delta int16) byte {
-	value := int16(base) + delta
-	if value < 0 {
-		return 0
-	}
-	if value > 255 {
-		return 255
-	}
-	return byte(value)
+// applyPlanarDelta adds a scanline delta to the value above it. Encoders
+// compute deltas modulo 256 so that they fit the sign-magnitude byte, which
+// makes the sum wrap rather than saturate.
+func applyPlanarDelta(base byte, delta int16) byte {
+	return byte(int16(base) + delta)
 }
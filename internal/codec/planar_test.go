@@ -6,15 +6,15 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func TestDecompressPlanar_EmptyInput(t *testing.T) {
-	result := DecompressPlanar(nil, 10, 10)
+func TestDecodePlanar_EmptyInput(t *testing.T) {
+	result := DecodePlanar(nil, 10, 10)
 	require.Nil(t, result)
 
-	result = DecompressPlanar([]byte{}, 10, 10)
+	result = DecodePlanar([]byte{}, 10, 10)
 	require.Nil(t, result)
 }
 
-func TestDecompressPlanar_RawNoAlpha(t *testing.T) {
+func TestDecodePlanar_RawNoAlpha(t *testing.T) {
 	// Format header with NoAlpha flag, no RLE
 	width := 2
 	height := 2
@@ -37,7 +37,7 @@ func TestDecompressPlanar_RawNoAlpha(t *testing.T) {
 		input[1+2*planeSize+i] = 0x40
 	}
 
-	result := DecompressPlanar(input, width, height)
+	result := DecodePlanar(input, width, height)
 	require.NotNil(t, result)
 	require.Len(t, result, planeSize*4)
 
@@ -49,7 +49,7 @@ func TestDecompressPlanar_RawNoAlpha(t *testing.T) {
 	require.Equal(t, byte(0xFF), result[3]) // A (255 when NoAlpha)
 }
 
-func TestDecompressPlanar_RawWithAlpha(t *testing.T) {
+func TestDecodePlanar_RawWithAlpha(t *testing.T) {
 	// Format header without NoAlpha flag, no RLE
 	width := 2
 	height := 2
@@ -76,7 +76,7 @@ func TestDecompressPlanar_RawWithAlpha(t *testing.T) {
 		input[1+3*planeSize+i] = 0x40
 	}
 
-	result := DecompressPlanar(input, width, height)
+	result := DecodePlanar(input, width, height)
 	require.NotNil(t, result)
 	require.Len(t, result, planeSize*4)
 
@@ -87,11 +87,11 @@ func TestDecompressPlanar_RawWithAlpha(t *testing.T) {
 	require.Equal(t, byte(0xCC), result[3])  // A
 }
 
-func TestDecompressPlanar_InsufficientData(t *testing.T) {
+func TestDecodePlanar_InsufficientData(t *testing.T) {
 	// Header indicates raw planes but not enough data
 	input := []byte{PlanarFlagNoAlpha, 0xFF} // Only 2 bytes, needs more
 
-	result := DecompressPlanar(input, 10, 10)
+	result := DecodePlanar(input, 10, 10)
 	require.Nil(t, result)
 }
 
@@ -167,7 +167,9 @@ func TestDecompressPlanarPlaneRLE_Error(t *testing.T) {
 	require.Equal(t, -1, consumed)
 }
 
-func TestDecompressPlanarPlaneRLE_DeltaClamp(t *testing.T) {
+func TestDecompressPlanarPlaneRLE_DeltaWraps(t *testing.T) {
+	// Deltas are computed modulo 256 (MS-RDPEGDI 3.1.9.2.3), so 255 + 127
+	// encodes 126, not a saturated 255
 	width := 1
 	height := 2
 	src := []byte{
@@ -179,10 +181,10 @@ func TestDecompressPlanarPlaneRLE_DeltaClamp(t *testing.T) {
 	consumed := decompressPlanarPlaneRLE(src, dst, width, height)
 	require.Greater(t, consumed, 0)
 	require.Equal(t, byte(255), dst[0])
-	require.Equal(t, byte(255), dst[1])
+	require.Equal(t, byte(126), dst[1])
 }
 
-func TestDecompressPlanarPlaneRLE_DeltaClampNegative(t *testing.T) {
+func TestDecompressPlanarPlaneRLE_DeltaNegative(t *testing.T) {
 	width := 1
 	height := 2
 	src := []byte{
@@ -196,3 +198,103 @@ func TestDecompressPlanarPlaneRLE_DeltaClampNegative(t *testing.T) {
 	require.Equal(t, byte(1), dst[0])
 	require.Equal(t, byte(0), dst[1])
 }
+
+func TestDecodePlanar_RLEWithAlpha(t *testing.T) {
+	// 4x2, planes bottom-up; the second row of each plane holds deltas
+	input := []byte{
+		PlanarFlagRLE,
+		// Alpha: 0xFF repeated, then a zero-delta run
+		0x13, 0xFF, 0x04,
+		// Red: 4 raw values, then deltas -16 (wrapping 10 to 250), 0, 0, 0
+		0x40, 10, 20, 30, 40, 0x40, 0x1F, 0x00, 0x00, 0x00,
+		// Green: 0x80 repeated, then a zero-delta run
+		0x13, 0x80, 0x04,
+		// Blue: a run of zeros, then +5 repeated
+		0x04, 0x13, 0x0A,
+	}
+
+	result := DecodePlanar(input, 4, 2)
+	require.Equal(t, []byte{
+		250, 0x80, 5, 0xFF, 20, 0x80, 5, 0xFF, 30, 0x80, 5, 0xFF, 40, 0x80, 5, 0xFF,
+		10, 0x80, 0, 0xFF, 20, 0x80, 0, 0xFF, 30, 0x80, 0, 0xFF, 40, 0x80, 0, 0xFF,
+	}, result)
+}
+
+func TestDecodePlanar_ColorLoss(t *testing.T) {
+	// Y=100, Co=20, Cg=-10 is RGB (130, 90, 90); at color loss level 2 the
+	// chroma values are stored halved
+	input := []byte{PlanarFlagNoAlpha | 0x02, 100, 10, 0xFB}
+
+	result := DecodePlanar(input, 1, 1)
+	require.Equal(t, []byte{130, 90, 90, 0xFF}, result)
+}
+
+func TestDecodePlanar_ChromaSubsampling(t *testing.T) {
+	// 2x2 luma with one chroma sample shared by all four pixels
+	input := []byte{
+		PlanarFlagNoAlpha | PlanarFlagChromaSubsample | 0x01,
+		100, 110, 120, 130, // luma, bottom row first
+		20,   // orange chroma
+		0xF6, // green chroma (-10)
+	}
+
+	result := DecodePlanar(input, 2, 2)
+	require.Equal(t, []byte{
+		150, 110, 110, 0xFF, 160, 120, 120, 0xFF,
+		130, 90, 90, 0xFF, 140, 100, 100, 0xFF,
+	}, result)
+
+	// Odd sizes round the chroma planes up
+	input = []byte{
+		PlanarFlagNoAlpha | PlanarFlagChromaSubsample | 0x01,
+		100, 100, 100,
+		0, 20,
+		0, 0,
+	}
+	result = DecodePlanar(input, 3, 1)
+	require.Equal(t, []byte{100, 100, 100, 0xFF, 100, 100, 100, 0xFF, 120, 100, 80, 0xFF}, result)
+}
+
+func TestDecodePlanar_ColorLossSubsampledRLE(t *testing.T) {
+	// A 9x3 bitmap as a server encodes it (MS-RDPEGDI 3.1.9): RLE, an alpha
+	// plane, color loss level 3 and 2x2 chroma subsampling. The image is a
+	// flat blue strip with one translucent pixel, a red-to-yellow ramp, then
+	// white and black sharing one chroma sample, which bleeds into both.
+	// Planes are bottom-up; second and third scanlines hold deltas.
+	input := []byte{
+		PlanarFlagRLE | PlanarFlagChromaSubsample | 0x03,
+		// Alpha: 0xFF repeated; the middle row has a -127 delta at x=2
+		0x18, 0xFF,
+		0x45, 0x00, 0x00, 0xFD, 0x00,
+		0x45, 0x00, 0x00, 0xFE, 0x00,
+		// Luma: 88 four times, then 104, 136, 168, 255, 0; the upper rows
+		// step the ramp down by 8
+		0x13, 0x58, 0x50, 0x68, 0x88, 0xA8, 0xFF, 0x00,
+		0x04, 0x30, 0x0F, 0x0F, 0x0F, 0x20, 0x00, 0x00,
+		0x04, 0x30, 0x0F, 0x0F, 0x0F, 0x20, 0x00, 0x00,
+		// Orange chroma, 5x2: -20, -20, 28, 14, 0, then an unchanged row
+		0x50, 0xEC, 0xEC, 0x1C, 0x0E, 0x00,
+		0x05,
+		// Green chroma, 5x2: -6, -6, -3, 5, 0, then deltas 0, 0, -3, -2, 0
+		0x50, 0xFA, 0xFA, 0xFD, 0x05, 0x00,
+		0x50, 0x00, 0x00, 0x05, 0x03, 0x00,
+	}
+
+	result := DecodePlanar(input, 9, 3)
+	require.Equal(t, []byte{
+		32, 64, 192, 0xFF, 32, 64, 192, 0xFF, 32, 64, 192, 0xFF, 32, 64, 192, 0xFF, 224, 64, 0, 0xFF, 255, 96, 32, 0xFF, 196, 164, 84, 0xFF, 255, 255, 187, 0xFF, 0, 0, 0, 0xFF,
+		32, 64, 192, 0xFF, 32, 64, 192, 0xFF, 32, 64, 192, 0x80, 32, 64, 192, 0xFF, 220, 84, 0, 0xFF, 252, 116, 28, 0xFF, 196, 180, 84, 0xFF, 255, 255, 179, 0xFF, 0, 0, 0, 0xFF,
+		32, 64, 192, 0xFF, 32, 64, 192, 0xFF, 32, 64, 192, 0xFF, 32, 64, 192, 0xFF, 228, 92, 4, 0xFF, 255, 124, 36, 0xFF, 204, 188, 92, 0xFF, 255, 255, 179, 0xFF, 0, 0, 0, 0xFF,
+	}, result)
+}
+
+func TestDecodePlanar_InvalidHeader(t *testing.T) {
+	raw := make([]byte, 1+3*4)
+	raw[0] = PlanarFlagNoAlpha | 0x40
+	require.Nil(t, DecodePlanar(raw, 2, 2), "reserved bits set")
+
+	raw[0] = PlanarFlagNoAlpha | PlanarFlagChromaSubsample
+	require.Nil(t, DecodePlanar(raw, 2, 2), "subsampling without color loss")
+
+	require.Nil(t, DecodePlanar([]byte{PlanarFlagRLE | PlanarFlagNoAlpha, 0x40, 1}, 4, 1), "truncated RLE plane")
+}
@@ -0,0 +1,99 @@
+package codec
+
+// pointerRowBytes returns the length of a pointer mask scanline, which is
+// padded to a 2-byte boundary (MS-RDPBCGR 2.2.9.1.1.4.4)
+func pointerRowBytes(width, bpp int) int {
+	n := (width*bpp + 7) / 8
+	return n + n%2
+}
+
+// PointerToRGBA converts the bottom-up XOR and AND masks of a pointer shape
+// to top-down RGBA. The XOR mask may be 1, 8, 15, 16, 24 or 32 bpp; the AND
+// mask is 1 bpp and may be empty when the shape is fully opaque. A 32-bit
+// XOR mask with any non-zero alpha byte carries per-pixel alpha and the AND
+// mask is ignored.
+//
+// Pixels the AND mask makes transparent over a non-black XOR color invert
+// the screen beneath them, which an image cursor cannot do; they are drawn
+// opaque black so that I-beam and other inverting cursors stay visible.
+//
+// It returns nil if the masks are shorter than the dimensions require.
+func PointerToRGBA(xorMask, andMask []byte, width, height, bpp int) []byte {
+	if width <= 0 || height <= 0 {
+		return nil
+	}
+	switch bpp {
+	case 1, 8, 15, 16, 24, 32:
+	default:
+		return nil
+	}
+	xorStride := pointerRowBytes(width, bpp)
+	andStride := pointerRowBytes(width, 1)
+	if len(xorMask) < xorStride*height {
+		return nil
+	}
+	hasAnd := len(andMask) > 0
+	if hasAnd && len(andMask) < andStride*height {
+		return nil
+	}
+
+	xorAlpha := false
+	if bpp == 32 {
+		for i := 3; i < xorStride*height; i += 4 {
+			if xorMask[i] != 0 {
+				xorAlpha = true
+				break
+			}
+		}
+	}
+
+	out := make([]byte, width*height*4)
+	for y := 0; y < height; y++ {
+		srcY := height - 1 - y
+		xorRow := xorMask[srcY*xorStride : (srcY+1)*xorStride]
+		dst := out[y*width*4 : (y+1)*width*4]
+
+		switch bpp {
+		case 1:
+			for x := 0; x < width; x++ {
+				if xorRow[x/8]>>(7-x%8)&1 != 0 {
+					dst[x*4], dst[x*4+1], dst[x*4+2] = 0xff, 0xff, 0xff
+				}
+				dst[x*4+3] = 0xff
+			}
+		case 8:
+			Palette8ToRGBA(xorRow, dst)
+		case 15:
+			RGB555ToRGBA(xorRow, dst)
+		case 16:
+			RGB565ToRGBA(xorRow, dst)
+		case 24:
+			BGR24ToRGBA(xorRow, dst)
+		case 32:
+			BGRA32ToRGBA(xorRow, dst)
+			if xorAlpha {
+				for x := 0; x < width; x++ {
+					dst[x*4+3] = xorRow[x*4+3]
+				}
+				continue
+			}
+		}
+
+		if !hasAnd {
+			continue
+		}
+		andRow := andMask[srcY*andStride : (srcY+1)*andStride]
+		for x := 0; x < width; x++ {
+			if andRow[x/8]>>(7-x%8)&1 == 0 {
+				continue
+			}
+			px := dst[x*4 : x*4+4]
+			if px[0] == 0 && px[1] == 0 && px[2] == 0 {
+				px[3] = 0
+			} else {
+				px[0], px[1], px[2], px[3] = 0, 0, 0, 0xff
+			}
+		}
+	}
+	return out
+}
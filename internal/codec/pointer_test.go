@@ -0,0 +1,58 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPointerToRGBA_24bpp(t *testing.T) {
+	// 2x2 BGR, bottom-up with rows padded to 2 bytes
+	xor := []byte{
+		0x00, 0x00, 0x00, 0x00, 0x00, 0xff, // bottom row: black, red
+		0x00, 0xff, 0x00, 0xff, 0xff, 0xff, // top row: green, white
+	}
+	and := []byte{
+		0x80, 0x00, // bottom row: left set
+		0x40, 0x00, // top row: right set
+	}
+
+	got := PointerToRGBA(xor, and, 2, 2, 24)
+	assert.Equal(t, []byte{
+		0x00, 0xff, 0x00, 0xff, // green
+		0x00, 0x00, 0x00, 0xff, // white inverting the screen, drawn black
+		0x00, 0x00, 0x00, 0x00, // black under the AND mask is transparent
+		0xff, 0x00, 0x00, 0xff, // red
+	}, got)
+}
+
+func TestPointerToRGBA_Monochrome(t *testing.T) {
+	// 2x1: XOR white/black, AND clear/set
+	got := PointerToRGBA([]byte{0x80, 0x00}, []byte{0x40, 0x00}, 2, 1, 1)
+	assert.Equal(t, []byte{0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x00}, got)
+}
+
+func TestPointerToRGBA_32bppAlpha(t *testing.T) {
+	// Per-pixel alpha wins over the AND mask
+	xor := []byte{0x10, 0x20, 0x30, 0x80}
+	got := PointerToRGBA(xor, []byte{0x80, 0x00}, 1, 1, 32)
+	assert.Equal(t, []byte{0x30, 0x20, 0x10, 0x80}, got)
+
+	// Without alpha, the AND mask decides
+	got = PointerToRGBA([]byte{0, 0, 0, 0}, []byte{0x80, 0x00}, 1, 1, 32)
+	assert.Equal(t, []byte{0, 0, 0, 0}, got)
+	got = PointerToRGBA([]byte{0x10, 0x20, 0x30, 0}, nil, 1, 1, 32)
+	assert.Equal(t, []byte{0x30, 0x20, 0x10, 0xff}, got, "no AND mask means opaque")
+}
+
+func TestPointerToRGBA_16bpp(t *testing.T) {
+	got := PointerToRGBA([]byte{0x00, 0xf8}, nil, 1, 1, 16)
+	assert.Equal(t, []byte{0xff, 0x00, 0x00, 0xff}, got)
+}
+
+func TestPointerToRGBA_Invalid(t *testing.T) {
+	assert.Nil(t, PointerToRGBA(make([]byte, 11), nil, 2, 2, 24), "short XOR mask")
+	assert.Nil(t, PointerToRGBA(make([]byte, 12), []byte{0}, 2, 2, 24), "short AND mask")
+	assert.Nil(t, PointerToRGBA(make([]byte, 12), nil, 2, 2, 12), "unsupported depth")
+	assert.Nil(t, PointerToRGBA(nil, nil, 0, 0, 24), "empty shape")
+}
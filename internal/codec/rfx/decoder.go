@@ -0,0 +1,190 @@
+package rfx
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Decoder decodes tiles using its own coefficient and DWT buffers. The
+// package-level decode functions share one DWT buffer, so concurrent tile
+// decoding needs a Decoder per goroutine.
+type Decoder struct {
+	yCoeff  []int16
+	cbCoeff []int16
+	crCoeff []int16
+	dwtTemp []int16
+}
+
+// NewDecoder creates a Decoder with freshly allocated buffers.
+func NewDecoder() *Decoder {
+	return &Decoder{
+		yCoeff:  make([]int16, TilePixels),
+		cbCoeff: make([]int16, TilePixels),
+		crCoeff: make([]int16, TilePixels),
+		dwtTemp: make([]int16, TilePixels),
+	}
+}
+
+// DecodeTile decodes a single RFX tile, like the package-level DecodeTile.
+// The returned tile's RGBA buffer is newly allocated.
+func (d *Decoder) DecodeTile(data []byte, quantY, quantCb, quantCr *SubbandQuant) (*Tile, error) {
+	return d.DecodeTileMode(data, DefaultEntropyMode, quantY, quantCb, quantCr)
+}
+
+// DecodeTileMode is DecodeTile with an explicit entropy mode.
+func (d *Decoder) DecodeTileMode(data []byte, mode int, quantY, quantCb, quantCr *SubbandQuant) (*Tile, error) {
+	rgba := make([]byte, TileRGBASize)
+	xIdx, yIdx, err := decodeTileInto(data, mode, quantY, quantCb, quantCr, d.yCoeff, d.cbCoeff, d.crCoeff, d.dwtTemp, rgba)
+	if err != nil {
+		return nil, err
+	}
+	return &Tile{X: xIdx, Y: yIdx, RGBA: rgba}, nil
+}
+
+// tileJob is an encoded tile with the quantization tables and entropy mode
+// that apply to it.
+type tileJob struct {
+	data    []byte
+	quantY  *SubbandQuant
+	quantCb *SubbandQuant
+	quantCr *SubbandQuant
+	mode    int
+}
+
+// decodeTiles decodes jobs one after another. Tiles that fail to decode are
+// skipped.
+func decodeTiles(jobs []tileJob) []*Tile {
+	tiles := make([]*Tile, 0, len(jobs))
+	for _, job := range jobs {
+		tile, err := DecodeTileMode(job.data, job.mode, job.quantY, job.quantCb, job.quantCr)
+		if err != nil {
+			// Log error but continue with other tiles
+			continue
+		}
+		tiles = append(tiles, tile)
+	}
+	return tiles
+}
+
+// decodeTilesParallel decodes jobs on up to workers goroutines, each with
+// its own Decoder, and returns the tiles in stream order. Tiles that fail to
+// decode are skipped, as with decodeTiles. The goroutines are taken from the
+// process-wide worker limit, so concurrent callers share it.
+func decodeTilesParallel(jobs []tileJob, workers int) []*Tile {
+	workers = tileWorkers(workers, len(jobs))
+	if workers <= 1 {
+		return decodeTiles(jobs)
+	}
+
+	workers = decodeWorkers.acquire(workers)
+	defer decodeWorkers.release(workers)
+	if workers <= 1 {
+		return decodeTiles(jobs)
+	}
+
+	indices := make(chan int, len(jobs))
+	for i := range jobs {
+		indices <- i
+	}
+	close(indices)
+
+	decoded := make([]*Tile, len(jobs))
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dec := NewDecoder()
+			for i := range indices {
+				job := jobs[i]
+				if tile, err := dec.DecodeTileMode(job.data, job.mode, job.quantY, job.quantCb, job.quantCr); err == nil {
+					decoded[i] = tile
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Assemble the frame's tiles in their original order
+	tiles := make([]*Tile, 0, len(jobs))
+	for _, tile := range decoded {
+		if tile != nil {
+			tiles = append(tiles, tile)
+		}
+	}
+	return tiles
+}
+
+// tileWorkers bounds the requested worker count by GOMAXPROCS and the number
+// of tiles. A request of zero or less means GOMAXPROCS.
+func tileWorkers(workers, tiles int) int {
+	if procs := runtime.GOMAXPROCS(0); workers <= 0 || workers > procs {
+		workers = procs
+	}
+	return min(workers, tiles)
+}
+
+// decodeWorkers limits the parallel tile decode goroutines running at once
+// across all callers in the process.
+var decodeWorkers = &workerLimiter{}
+
+// SetMaxDecodeWorkers caps the number of goroutines that parallel tile
+// decoding may run at once across all sessions, so one busy session cannot
+// starve the others. A value of zero or less means GOMAXPROCS.
+func SetMaxDecodeWorkers(n int) {
+	decodeWorkers.setLimit(n)
+}
+
+// workerLimiter is a counting semaphore whose size can change while in use.
+type workerLimiter struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int // zero or less means GOMAXPROCS
+	active int
+	peak   int // highest active count seen
+}
+
+// setLimit changes the limit and wakes callers waiting for a slot.
+func (l *workerLimiter) setLimit(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = n
+	if l.cond != nil {
+		l.cond.Broadcast()
+	}
+}
+
+// capacity returns the effective limit. Callers must hold l.mu.
+func (l *workerLimiter) capacity() int {
+	if l.limit <= 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return l.limit
+}
+
+// acquire waits until a slot is free, then takes up to want slots and
+// returns how many it took.
+func (l *workerLimiter) acquire(want int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cond == nil {
+		l.cond = sync.NewCond(&l.mu)
+	}
+	for l.active >= l.capacity() {
+		l.cond.Wait()
+	}
+	n := min(want, l.capacity()-l.active)
+	l.active += n
+	l.peak = max(l.peak, l.active)
+	return n
+}
+
+// release returns n slots taken by acquire.
+func (l *workerLimiter) release(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active -= n
+	if l.cond != nil {
+		l.cond.Broadcast()
+	}
+}
@@ -0,0 +1,184 @@
+package rfx
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildTestTile builds a CBT_TILE block at the given tile index whose
+// components carry pseudo-random RLGR data that decodes without error.
+func buildTestTile(rng *rand.Rand, xIdx, yIdx uint16, quantIdx uint8) []byte {
+	return buildTestTileMode(rng, DefaultEntropyMode, xIdx, yIdx, quantIdx)
+}
+
+// buildTestTileMode is buildTestTile for the given entropy mode.
+func buildTestTileMode(rng *rand.Rand, mode int, xIdx, yIdx uint16, quantIdx uint8) []byte {
+	quant := DefaultQuant()
+	for {
+		tile := randomTestTile(rng, xIdx, yIdx, quantIdx)
+		if _, err := DecodeTileMode(tile, mode, quant, quant, quant); err == nil {
+			return tile
+		}
+	}
+}
+
+// randomTestTile builds a CBT_TILE block with pseudo-random component data.
+func randomTestTile(rng *rand.Rand, xIdx, yIdx uint16, quantIdx uint8) []byte {
+	const yLen, cbLen, crLen = 2048, 1024, 1024
+	tile := make([]byte, 19+yLen+cbLen+crLen)
+	binary.LittleEndian.PutUint16(tile[0:], CBT_TILE)
+	binary.LittleEndian.PutUint32(tile[2:], uint32(len(tile)))
+	tile[6], tile[7], tile[8] = quantIdx, quantIdx, quantIdx
+	binary.LittleEndian.PutUint16(tile[9:], xIdx)
+	binary.LittleEndian.PutUint16(tile[11:], yIdx)
+	binary.LittleEndian.PutUint16(tile[13:], yLen)
+	binary.LittleEndian.PutUint16(tile[15:], cbLen)
+	binary.LittleEndian.PutUint16(tile[17:], crLen)
+	rng.Read(tile[19:])
+	return tile
+}
+
+// testQuantTables are two valid packed quantization tables.
+var testQuantTables = []byte{
+	0x66, 0x66, 0x77, 0x88, 0x98,
+	0x76, 0x76, 0x87, 0x98, 0xA9,
+}
+
+// buildTestTileset builds an RFX message holding one tileset block with two
+// quantization tables and the given tiles.
+func buildTestTileset(tiles [][]byte) []byte {
+	return buildTestTilesetWithQuants(testQuantTables, tiles)
+}
+
+// buildTestTilesetWithQuants builds a tileset block with the given packed
+// quantization tables and tiles.
+func buildTestTilesetWithQuants(quants []byte, tiles [][]byte) []byte {
+	header := make([]byte, 22)
+	binary.LittleEndian.PutUint16(header[0:], WBT_TILESET)
+	binary.LittleEndian.PutUint16(header[6:], 0xCAC2) // CBT_TILESET
+	header[12] = byte(len(quants) / 5)
+	header[13] = TileSize
+	binary.LittleEndian.PutUint16(header[14:], uint16(len(tiles)))
+
+	block := append(header[:20], quants...)
+	for _, tile := range tiles {
+		block = append(block, tile...)
+	}
+	binary.LittleEndian.PutUint32(block[2:], uint32(len(block)))
+	binary.LittleEndian.PutUint32(block[16:], uint32(len(block)-20-len(quants)))
+	return block
+}
+
+func TestDecoder_MatchesDecodeTile(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	quant := DefaultQuant()
+	dec := NewDecoder()
+
+	for i := 0; i < 4; i++ {
+		data := buildTestTile(rng, uint16(i), 2, 0)
+		want, err := DecodeTile(data, quant, quant, quant)
+		require.NoError(t, err)
+		got, err := dec.DecodeTile(data, quant, quant, quant)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, "tile %d", i)
+	}
+
+	_, err := dec.DecodeTile([]byte{0x01}, quant, quant, quant)
+	assert.ErrorIs(t, err, ErrInvalidTileData)
+}
+
+func TestParseRFXMessageParallel_MatchesSerial(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	var tiles [][]byte
+	for y := uint16(0); y < 4; y++ {
+		for x := uint16(0); x < 6; x++ {
+			tiles = append(tiles, buildTestTile(rng, x, y, uint8(x%2)))
+		}
+	}
+	// A tile that fails to decode is skipped by both paths
+	broken := buildTestTile(rng, 7, 7, 0)
+	binary.LittleEndian.PutUint16(broken[13:], 0xFFFF)
+	tiles = append(tiles[:5], append([][]byte{broken}, tiles[5:]...)...)
+	data := buildTestTileset(tiles)
+
+	serial, err := ParseRFXMessage(data, NewContext())
+	require.NoError(t, err)
+	require.Len(t, serial.Tiles, len(tiles)-1)
+
+	for _, workers := range []int{0, 1, 2, 4, 64} {
+		parallel, err := ParseRFXMessageParallel(data, NewContext(), workers)
+		require.NoError(t, err)
+		assert.Equal(t, serial, parallel, "workers=%d", workers)
+	}
+}
+
+func TestTileWorkers(t *testing.T) {
+	procs := runtime.GOMAXPROCS(0)
+	assert.Equal(t, min(procs, 100), tileWorkers(0, 100))
+	assert.Equal(t, min(procs, 100), tileWorkers(procs+10, 100))
+	assert.Equal(t, 1, tileWorkers(1, 100))
+	assert.Equal(t, 0, tileWorkers(4, 0))
+	assert.LessOrEqual(t, tileWorkers(4, 3), 3)
+}
+
+func TestParseRFXMessageParallel_SharedWorkerLimit(t *testing.T) {
+	saved := decodeWorkers
+	t.Cleanup(func() { decodeWorkers = saved })
+	decodeWorkers = &workerLimiter{}
+	SetMaxDecodeWorkers(3)
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	rng := rand.New(rand.NewSource(3))
+	var tiles [][]byte
+	for x := uint16(0); x < 16; x++ {
+		tiles = append(tiles, buildTestTile(rng, x, 0, 0))
+	}
+	data := buildTestTileset(tiles)
+	serial, err := ParseRFXMessage(data, NewContext())
+	require.NoError(t, err)
+
+	// Several sessions each asking for more workers than the limit allows
+	const sessions = 8
+	var wg sync.WaitGroup
+	frames := make([]*Frame, sessions)
+	errs := make([]error, sessions)
+	for i := 0; i < sessions; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 5; n++ {
+				frames[i], errs[i] = ParseRFXMessageParallel(data, NewContext(), 16)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < sessions; i++ {
+		require.NoError(t, errs[i])
+		assert.Equal(t, serial, frames[i], "session %d", i)
+	}
+	assert.Equal(t, 3, decodeWorkers.peak, "decodes should use, and not exceed, the shared limit")
+	assert.Zero(t, decodeWorkers.active, "all workers should be released")
+}
+
+func TestWorkerLimiter_DefaultsToGOMAXPROCS(t *testing.T) {
+	l := &workerLimiter{}
+	got := l.acquire(1 << 20)
+	assert.Equal(t, runtime.GOMAXPROCS(0), got)
+	l.release(got)
+
+	// Raising the limit wakes a caller waiting for a slot
+	l.setLimit(1)
+	first := l.acquire(4)
+	require.Equal(t, 1, first)
+	done := make(chan int)
+	go func() { done <- l.acquire(4) }()
+	l.setLimit(2)
+	assert.Equal(t, 1, <-done)
+}
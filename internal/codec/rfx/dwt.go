@@ -24,13 +24,16 @@ var dwtTempBuffer [TilePixels]int16
 // Input: 4096 int16 coefficients in packed subband order
 // Output: 4096 int16 spatial-domain values (in-place, returns same slice)
 func InverseDWT2D(buffer []int16) []int16 {
+	return inverseDWT2D(buffer, dwtTempBuffer[:])
+}
+
+// inverseDWT2D is InverseDWT2D using temp (TilePixels elements) for
+// intermediate results.
+func inverseDWT2D(buffer, temp []int16) []int16 {
 	if len(buffer) < TilePixels {
 		return nil
 	}
 
-	// Use pre-allocated temp buffer
-	temp := dwtTempBuffer[:]
-
 	// Level 3: 8×8 → 16×16
 	// Input: HL3(@3840), LH3(@3904), HH3(@3968), LL3(@4032)
 	// Output: HL2-LH2-HH2 region starting at offset 3072
@@ -7,6 +7,18 @@ import (
 
 // ParseRFXMessage parses a complete RFX message and returns decoded tiles.
 func ParseRFXMessage(data []byte, ctx *Context) (*Frame, error) {
+	return parseRFXMessage(data, ctx, 1)
+}
+
+// ParseRFXMessageParallel is ParseRFXMessage with the tiles of each tileset
+// decoded concurrently on up to workers goroutines, bounded by GOMAXPROCS.
+// A workers value of zero or less uses GOMAXPROCS. The returned frame is
+// identical to the one ParseRFXMessage produces.
+func ParseRFXMessageParallel(data []byte, ctx *Context, workers int) (*Frame, error) {
+	return parseRFXMessage(data, ctx, workers)
+}
+
+func parseRFXMessage(data []byte, ctx *Context, workers int) (*Frame, error) {
 	if len(data) < 6 {
 		return nil, ErrInvalidBlockLength
 	}
@@ -36,12 +48,16 @@ func ParseRFXMessage(data []byte, ctx *Context) (*Frame, error) {
 			if err := parseSyncBlock(blockData); err != nil {
 				return nil, err
 			}
+			// A sync block restarts the stream; state from before it is stale
+			ctx.Reset()
 
 		case WBT_CODEC_VERSIONS:
 			// Contains codec version info, usually just verification
 
 		case WBT_CHANNELS:
-			// Contains channel info (usually just channel 0)
+			if err := parseChannelsBlock(blockData, ctx); err != nil {
+				return nil, err
+			}
 
 		case WBT_CONTEXT:
 			if err := parseContextBlock(blockData, ctx); err != nil {
@@ -63,11 +79,12 @@ func ParseRFXMessage(data []byte, ctx *Context) (*Frame, error) {
 			frame.Rects = rects
 
 		case WBT_TILESET:
-			tiles, err := parseTilesetBlock(blockData, ctx)
+			jobs, skipped, err := parseTileJobs(blockData, ctx)
 			if err != nil {
-				return nil, err
+				return nil, fmt.Errorf("tileset: %w", err)
 			}
-			frame.Tiles = append(frame.Tiles, tiles...)
+			frame.SkippedTiles += skipped
+			frame.Tiles = append(frame.Tiles, decodeTilesParallel(jobs, workers)...)
 
 		case WBT_FRAME_END:
 			// Frame complete
@@ -92,23 +109,54 @@ func parseSyncBlock(data []byte) error {
 	return nil
 }
 
-func parseContextBlock(data []byte, ctx *Context) error {
-	if len(data) < 13 {
+// parseChannelsBlock records the surface size of the first channel; RFX
+// uses a single channel.
+func parseChannelsBlock(data []byte, ctx *Context) error {
+	if len(data) < 7 {
 		return ErrInvalidBlockLength
 	}
 
-	offset := 6 // Skip block header
+	numChannels := data[6]
+	if numChannels == 0 {
+		return nil
+	}
+	if len(data) < 12 {
+		return ErrInvalidBlockLength
+	}
 
-	// ctxId := data[offset]
-	offset++
+	// channelId := data[7]
+	ctx.SurfaceWidth = binary.LittleEndian.Uint16(data[8:])
+	ctx.SurfaceHeight = binary.LittleEndian.Uint16(data[10:])
 
-	// tileSize := binary.LittleEndian.Uint16(data[offset:])
-	offset += 2
+	return nil
+}
 
-	ctx.Width = binary.LittleEndian.Uint16(data[offset:])
-	offset += 2
+// parseContextBlock reads TS_RFX_CONTEXT (MS-RDPRFX 2.2.2.2.4) and selects
+// the entropy coder for the tiles that follow. Its properties field packs
+// flags (3 bits), cct (2), xft (4), et (4) and qt (2), low bits first.
+func parseContextBlock(data []byte, ctx *Context) error {
+	if len(data) < 13 {
+		return ErrInvalidBlockLength
+	}
 
-	ctx.Height = binary.LittleEndian.Uint16(data[offset:])
+	// codecId := data[6]
+	// channelId := data[7]
+	// ctxId := data[8]
+	tileSize := binary.LittleEndian.Uint16(data[9:])
+	properties := binary.LittleEndian.Uint16(data[11:])
+
+	var mode int
+	switch et := uint8(properties>>9) & 0x0F; et {
+	case CLW_ENTROPY_RLGR1:
+		mode = RLGR1
+	case CLW_ENTROPY_RLGR3:
+		mode = RLGR3
+	default:
+		return fmt.Errorf("%w: et=%#x", ErrUnsupportedEntropy, et)
+	}
+
+	ctx.TileSize = tileSize
+	ctx.EntropyMode = mode
 
 	return nil
 }
@@ -137,9 +185,13 @@ func parseRegionBlock(data []byte) ([]Rect, error) {
 	numRects := binary.LittleEndian.Uint16(data[offset:])
 	offset += 2
 
+	if offset+int(numRects)*8 > len(data) {
+		return nil, fmt.Errorf("%w: region declares %d rects but holds %d", ErrInvalidBlockLength, numRects, (len(data)-offset)/8)
+	}
+
 	rects := make([]Rect, numRects)
 
-	for i := uint16(0); i < numRects && offset+8 <= len(data); i++ {
+	for i := uint16(0); i < numRects; i++ {
 		rects[i] = Rect{
 			X:      binary.LittleEndian.Uint16(data[offset:]),
 			Y:      binary.LittleEndian.Uint16(data[offset+2:]),
@@ -153,8 +205,19 @@ func parseRegionBlock(data []byte) ([]Rect, error) {
 }
 
 func parseTilesetBlock(data []byte, ctx *Context) ([]*Tile, error) {
+	jobs, _, err := parseTileJobs(data, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return decodeTiles(jobs), nil
+}
+
+// parseTileJobs splits a tileset block into its encoded tiles, each paired
+// with the quantization tables it references. It also returns how many tiles
+// it skipped for lying outside the surface.
+func parseTileJobs(data []byte, ctx *Context) ([]tileJob, int, error) {
 	if len(data) < 22 {
-		return nil, ErrInvalidBlockLength
+		return nil, 0, ErrInvalidBlockLength
 	}
 
 	offset := 6 // Skip block header
@@ -181,18 +244,25 @@ func parseTilesetBlock(data []byte, ctx *Context) ([]*Tile, error) {
 	offset += 4
 
 	// Parse quantization tables
+	if offset+int(numQuant)*5 > len(data) {
+		return nil, 0, fmt.Errorf("%w: tileset declares %d tables but holds %d", ErrInvalidQuantValues, numQuant, (len(data)-offset)/5)
+	}
 	quantTables := make([]*SubbandQuant, numQuant)
-	for i := uint8(0); i < numQuant && offset+5 <= len(data); i++ {
+	for i := range quantTables {
 		quant, err := ParseQuantValues(data[offset:])
+		if err == nil {
+			err = quant.Validate()
+		}
 		if err != nil {
-			return nil, err
+			return nil, 0, fmt.Errorf("quant table %d: %w", i, err)
 		}
 		quantTables[i] = quant
 		offset += 5
 	}
 
 	// Parse tiles
-	tiles := make([]*Tile, 0, numTiles)
+	jobs := make([]tileJob, 0, numTiles)
+	skipped := 0
 
 	for i := uint16(0); i < numTiles && offset < len(data); i++ {
 		if offset+6 > len(data) {
@@ -205,40 +275,40 @@ func parseTilesetBlock(data []byte, ctx *Context) ([]*Tile, error) {
 		}
 
 		tileBlockLen := int(binary.LittleEndian.Uint32(data[offset+2:]))
-		if offset+tileBlockLen > len(data) {
+		if tileBlockLen < 9 || offset+tileBlockLen > len(data) {
 			break
 		}
 
-		// Get quant indices from tile header
-		quantIdxY := data[offset+6]
-		quantIdxCb := data[offset+7]
-		quantIdxCr := data[offset+8]
-
-		// Get quant tables (with bounds checking)
-		quantY := DefaultQuant()
-		quantCb := DefaultQuant()
-		quantCr := DefaultQuant()
-
-		if int(quantIdxY) < len(quantTables) && quantTables[quantIdxY] != nil {
-			quantY = quantTables[quantIdxY]
-		}
-		if int(quantIdxCb) < len(quantTables) && quantTables[quantIdxCb] != nil {
-			quantCb = quantTables[quantIdxCb]
-		}
-		if int(quantIdxCr) < len(quantTables) && quantTables[quantIdxCr] != nil {
-			quantCr = quantTables[quantIdxCr]
+		// Skip tiles that would land outside the surface from the channels block
+		if tileBlockLen >= 13 {
+			xIdx := binary.LittleEndian.Uint16(data[offset+9:])
+			yIdx := binary.LittleEndian.Uint16(data[offset+11:])
+			if CheckTileBounds(xIdx, yIdx, int(ctx.SurfaceWidth), int(ctx.SurfaceHeight)) != nil {
+				skipped++
+				offset += tileBlockLen
+				continue
+			}
 		}
 
-		tile, err := DecodeTile(data[offset:offset+tileBlockLen], quantY, quantCb, quantCr)
-		if err != nil {
-			// Log error but continue with other tiles
-			offset += tileBlockLen
-			continue
+		// Look up the quant tables named in the tile header
+		var quants [3]*SubbandQuant
+		for c, idx := range data[offset+6 : offset+9] {
+			if int(idx) >= len(quantTables) {
+				return nil, 0, fmt.Errorf("%w: tile %d references table %d of %d", ErrInvalidQuantValues, i, idx, len(quantTables))
+			}
+			quants[c] = quantTables[idx]
 		}
-
-		tiles = append(tiles, tile)
+		quantY, quantCb, quantCr := quants[0], quants[1], quants[2]
+
+		jobs = append(jobs, tileJob{
+			data:    data[offset : offset+tileBlockLen],
+			quantY:  quantY,
+			quantCb: quantCb,
+			quantCr: quantCr,
+			mode:    ctx.EntropyMode,
+		})
 		offset += tileBlockLen
 	}
 
-	return tiles, nil
+	return jobs, skipped, nil
 }
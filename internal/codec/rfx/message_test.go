@@ -2,6 +2,7 @@ package rfx
 
 import (
 	"encoding/binary"
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -45,16 +46,17 @@ func TestParseRFXMessage_ContextBlock(t *testing.T) {
 	data := []byte{
 		0xC3, 0xCC, // WBT_CONTEXT
 		0x0D, 0x00, 0x00, 0x00, // length = 13
-		0x00,       // ctxId
+		0x01,       // codecId
+		0x00,       // channelId
+		0xFF,       // ctxId
 		0x40, 0x00, // tileSize = 64
-		0x00, 0x04, // width = 1024
-		0x00, 0x03, // height = 768
+		0x28, 0xA8, // properties: et = RLGR3
 	}
 	frame, err := ParseRFXMessage(data, ctx)
 	require.NoError(t, err)
 	assert.NotNil(t, frame)
-	assert.Equal(t, uint16(1024), ctx.Width)
-	assert.Equal(t, uint16(768), ctx.Height)
+	assert.Equal(t, uint16(64), ctx.TileSize)
+	assert.Equal(t, RLGR3, ctx.EntropyMode)
 }
 
 func TestParseRFXMessage_FrameBegin(t *testing.T) {
@@ -163,6 +165,8 @@ func TestParseRFXMessage_Channels(t *testing.T) {
 	frame, err := ParseRFXMessage(data, ctx)
 	require.NoError(t, err)
 	assert.NotNil(t, frame)
+	assert.Equal(t, uint16(1024), ctx.SurfaceWidth)
+	assert.Equal(t, uint16(768), ctx.SurfaceHeight)
 }
 
 func TestParseRFXMessage_Extension(t *testing.T) {
@@ -253,10 +257,11 @@ func TestParseRFXMessage_MultipleBlocks(t *testing.T) {
 	contextBlock := []byte{
 		0xC3, 0xCC, // WBT_CONTEXT
 		0x0D, 0x00, 0x00, 0x00, // length = 13
-		0x00,       // ctxId
+		0x01,       // codecId
+		0x00,       // channelId
+		0xFF,       // ctxId
 		0x40, 0x00, // tileSize = 64
-		0x80, 0x02, // width = 640
-		0xE0, 0x01, // height = 480
+		0x28, 0x02, // properties: et = RLGR1
 	}
 	data = append(data, contextBlock...)
 	
@@ -280,8 +285,7 @@ func TestParseRFXMessage_MultipleBlocks(t *testing.T) {
 	frame, err := ParseRFXMessage(data, ctx)
 	require.NoError(t, err)
 	assert.NotNil(t, frame)
-	assert.Equal(t, uint16(640), ctx.Width)
-	assert.Equal(t, uint16(480), ctx.Height)
+	assert.Equal(t, RLGR1, ctx.EntropyMode)
 	assert.Equal(t, uint32(1), frame.FrameIdx)
 }
 
@@ -566,3 +570,227 @@ func TestS_OperatingMode(t *testing.T) {
 		})
 	}
 }
+
+func TestParseRFXMessage_MalformedQuantTables(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	tile := buildTestTile(rng, 0, 0, 1)
+
+	// A valid tileset decodes
+	frame, err := ParseRFXMessage(buildTestTileset([][]byte{tile}), NewContext())
+	require.NoError(t, err)
+	require.Len(t, frame.Tiles, 1)
+
+	outOfRange := append([]byte{}, testQuantTables...)
+	outOfRange[6] = 0x63 // second table: HL3=3
+
+	tests := []struct {
+		name   string
+		data   []byte
+		expect string
+	}{
+		{
+			name:   "value out of range",
+			data:   buildTestTilesetWithQuants(outOfRange, [][]byte{tile}),
+			expect: "quant table 1",
+		},
+		{
+			name:   "tile references a missing table",
+			data:   buildTestTilesetWithQuants(testQuantTables[:5], [][]byte{tile}),
+			expect: "references table 1 of 1",
+		},
+		{
+			name: "tables truncated",
+			data: func() []byte {
+				data := buildTestTilesetWithQuants(testQuantTables, nil)
+				data = data[:len(data)-3]
+				binary.LittleEndian.PutUint32(data[2:], uint32(len(data)))
+				return data
+			}(),
+			expect: "declares 2 tables",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRFXMessage(tt.data, NewContext())
+			assert.ErrorIs(t, err, ErrInvalidQuantValues)
+			assert.ErrorContains(t, err, tt.expect)
+		})
+	}
+}
+
+func TestParseRFXMessage_TileBounds(t *testing.T) {
+	rng := rand.New(rand.NewSource(8))
+	channels := []byte{
+		0xC2, 0xCC, // WBT_CHANNELS
+		0x0C, 0x00, 0x00, 0x00, // length = 12
+		0x01,       // numChannels
+		0x00,       // channelId
+		0x90, 0x00, // width = 144
+		0x40, 0x00, // height = 64
+	}
+	tiles := [][]byte{
+		buildTestTile(rng, 0, 0, 0),
+		buildTestTile(rng, 2, 0, 0), // partial edge tile
+		buildTestTile(rng, 3, 0, 0), // starts at x=192
+		buildTestTile(rng, 0, 1, 0), // starts at y=64
+		buildTestTile(rng, 0xFFFF, 0xFFFF, 0),
+	}
+	data := append(channels, buildTestTileset(tiles)...)
+
+	frame, err := ParseRFXMessage(data, NewContext())
+	require.NoError(t, err)
+	require.Len(t, frame.Tiles, 2)
+	assert.Equal(t, uint16(0), frame.Tiles[0].X)
+	assert.Equal(t, uint16(2), frame.Tiles[1].X)
+
+	// Without a channels block the surface size is unknown
+	frame, err = ParseRFXMessage(buildTestTileset(tiles), NewContext())
+	require.NoError(t, err)
+	assert.Len(t, frame.Tiles, len(tiles))
+}
+
+// buildTestContext builds a WBT_CONTEXT block whose properties select the
+// given entropy algorithm (a CLW_ENTROPY_* value).
+func buildTestContext(et uint8) []byte {
+	block := make([]byte, 13)
+	binary.LittleEndian.PutUint16(block[0:], WBT_CONTEXT)
+	binary.LittleEndian.PutUint32(block[2:], uint32(len(block)))
+	block[6] = 0x01 // codecId
+	block[8] = 0xFF // ctxId
+	binary.LittleEndian.PutUint16(block[9:], TileSize)
+	properties := uint16(CLW_COL_CONV_ICT)<<3 | uint16(CLW_XFORM_DWT_53_A)<<5 | uint16(et)<<9
+	binary.LittleEndian.PutUint16(block[11:], properties)
+	return block
+}
+
+func TestParseRFXMessage_EntropyMode(t *testing.T) {
+	quant, err := ParseQuantValues(testQuantTables)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		et    uint8
+		mode  int
+		other int
+	}{
+		{"RLGR1", CLW_ENTROPY_RLGR1, RLGR1, RLGR3},
+		{"RLGR3", CLW_ENTROPY_RLGR3, RLGR3, RLGR1},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(int64(20 + i)))
+			tiles := [][]byte{
+				buildTestTileMode(rng, tt.mode, 0, 0, 0),
+				buildTestTileMode(rng, tt.mode, 1, 0, 0),
+			}
+			ctx := NewContext()
+
+			// The context selects the coder for every component of every tile
+			data := append(buildTestContext(tt.et), buildTestTileset(tiles)...)
+			frame, err := ParseRFXMessage(data, ctx)
+			require.NoError(t, err)
+			require.Len(t, frame.Tiles, len(tiles))
+			assert.Equal(t, tt.mode, ctx.EntropyMode)
+			for j, tile := range tiles {
+				want, err := DecodeTileMode(tile, tt.mode, quant, quant, quant)
+				require.NoError(t, err)
+				assert.Equal(t, want, frame.Tiles[j], "tile %d", j)
+
+				if other, err := DecodeTileMode(tile, tt.other, quant, quant, quant); err == nil {
+					assert.NotEqual(t, other.RGBA, frame.Tiles[j].RGBA, "tile %d decoded with the wrong coder", j)
+				}
+			}
+
+			// The mode persists into later messages without a context block
+			frame, err = ParseRFXMessageParallel(buildTestTileset(tiles), ctx, 2)
+			require.NoError(t, err)
+			require.Len(t, frame.Tiles, len(tiles))
+			want, err := DecodeTileMode(tiles[0], tt.mode, quant, quant, quant)
+			require.NoError(t, err)
+			assert.Equal(t, want, frame.Tiles[0])
+		})
+	}
+}
+
+func TestParseRFXMessage_SyncResetsContext(t *testing.T) {
+	sync := []byte{
+		0xC0, 0xCC, // WBT_SYNC
+		0x0C, 0x00, 0x00, 0x00, // length = 12
+		0xCA, 0xCA, 0xCC, 0xCA, // magic
+		0x00, 0x01, // version
+	}
+	channels := []byte{
+		0xC2, 0xCC, // WBT_CHANNELS
+		0x0C, 0x00, 0x00, 0x00, // length = 12
+		0x01,       // numChannels
+		0x00,       // channelId
+		0x40, 0x00, // width = 64
+		0x40, 0x00, // height = 64
+	}
+
+	ctx := NewContext()
+	assert.Equal(t, DefaultEntropyMode, ctx.EntropyMode)
+
+	_, err := ParseRFXMessage(append(channels, buildTestContext(CLW_ENTROPY_RLGR1)...), ctx)
+	require.NoError(t, err)
+	assert.Equal(t, RLGR1, ctx.EntropyMode)
+	assert.Equal(t, uint16(64), ctx.SurfaceWidth)
+
+	// A sync block restarts the stream with a fresh context
+	rng := rand.New(rand.NewSource(22))
+	tile := buildTestTile(rng, 3, 3, 0)
+	frame, err := ParseRFXMessage(append(sync, buildTestTileset([][]byte{tile})...), ctx)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultEntropyMode, ctx.EntropyMode)
+	assert.Equal(t, uint16(0), ctx.TileSize)
+	assert.Equal(t, uint16(0), ctx.SurfaceWidth)
+	assert.Equal(t, uint16(0), ctx.SurfaceHeight)
+	// The old 64x64 surface no longer bounds tile positions
+	require.Len(t, frame.Tiles, 1)
+	assert.Equal(t, uint16(3), frame.Tiles[0].X)
+
+	// A sync followed by a new context applies the new mode
+	_, err = ParseRFXMessage(append(sync, buildTestContext(CLW_ENTROPY_RLGR1)...), ctx)
+	require.NoError(t, err)
+	assert.Equal(t, RLGR1, ctx.EntropyMode)
+}
+
+func TestParseContextBlock_UnsupportedEntropy(t *testing.T) {
+	ctx := NewContext()
+	for _, et := range []uint8{0x00, 0x02, 0x03, 0x0F} {
+		err := parseContextBlock(buildTestContext(et), ctx)
+		assert.ErrorIs(t, err, ErrUnsupportedEntropy, "et=%#x", et)
+	}
+	assert.Equal(t, DefaultEntropyMode, ctx.EntropyMode)
+}
+
+func TestParseRFXMessage_SkipsTilesOutsideSurface(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	ctx := NewContext()
+	ctx.SurfaceWidth, ctx.SurfaceHeight = 128, 64
+
+	tiles := [][]byte{
+		buildTestTile(rng, 0, 0, 0),
+		buildTestTile(rng, 2, 0, 0), // right of the surface
+		buildTestTile(rng, 1, 0, 0),
+		buildTestTile(rng, 0, 1, 0), // below the surface
+	}
+	frame, err := ParseRFXMessage(buildTestTileset(tiles), ctx)
+	require.NoError(t, err)
+	require.Len(t, frame.Tiles, 2)
+	assert.Equal(t, [2]uint16{0, 0}, [2]uint16{frame.Tiles[0].X, frame.Tiles[0].Y})
+	assert.Equal(t, [2]uint16{1, 0}, [2]uint16{frame.Tiles[1].X, frame.Tiles[1].Y})
+	assert.Equal(t, 2, frame.SkippedTiles)
+}
+
+func TestParseRFXMessage_TilesetErrorIsWrapped(t *testing.T) {
+	rng := rand.New(rand.NewSource(12))
+	// The tile references quant table 1 of the single table in the tileset
+	data := buildTestTilesetWithQuants(testQuantTables[:5], [][]byte{buildTestTile(rng, 0, 0, 1)})
+
+	_, err := ParseRFXMessage(data, NewContext())
+	assert.ErrorIs(t, err, ErrInvalidQuantValues)
+	assert.ErrorContains(t, err, "tileset: ")
+}
@@ -0,0 +1,619 @@
+package rfx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// RemoteFX Progressive (MS-RDPEGFX section 2.2.4.2) reuses the RFX tile
+// pipeline but splits each tile into quality passes: a first pass carries
+// coarsely quantized coefficients, and upgrade passes refine them. Only the
+// first pass (TILE_FIRST) and single-pass tiles (TILE_SIMPLE) are decoded
+// here, which renders static content correctly at the first pass's quality.
+
+// Progressive block types (MS-RDPEGFX section 2.2.4.2.1)
+const (
+	PROGRESSIVE_WBT_SYNC         uint16 = 0xCCC0
+	PROGRESSIVE_WBT_FRAME_BEGIN  uint16 = 0xCCC1
+	PROGRESSIVE_WBT_FRAME_END    uint16 = 0xCCC2
+	PROGRESSIVE_WBT_CONTEXT      uint16 = 0xCCC3
+	PROGRESSIVE_WBT_REGION       uint16 = 0xCCC4
+	PROGRESSIVE_WBT_TILE_SIMPLE  uint16 = 0xCCC5
+	PROGRESSIVE_WBT_TILE_FIRST   uint16 = 0xCCC6
+	PROGRESSIVE_WBT_TILE_UPGRADE uint16 = 0xCCC7
+)
+
+// Progressive region and tile flags
+const (
+	RFX_DWT_REDUCE_EXTRAPOLATE uint8 = 0x01 // Region uses the reduce-extrapolate DWT
+	RFX_TILE_DIFFERENCE        uint8 = 0x01 // Tile coefficients are relative to the previous tile
+)
+
+// Progressive sizes and quality values
+const (
+	ProgressiveQuantSize   = 16   // RFX_PROGRESSIVE_CODEC_QUANT: quality + 3 × 5-byte tables
+	ProgressiveQualityFull = 0xFF // Tile quality that needs no progressive quant
+)
+
+// Header sizes of the progressive region and tile blocks
+const (
+	progressiveRegionHeaderSize = 18
+	progressiveSimpleHeaderSize = 22
+	progressiveFirstHeaderSize  = 23
+)
+
+// Subband offsets in the reduce-extrapolate layout. Each level keeps one
+// extra low-pass sample, so band sizes are not powers of two; a band ends
+// where the next one starts.
+const (
+	extOffsetHL1 = 0
+	extOffsetLH1 = 1023
+	extOffsetHH1 = 2046
+	extOffsetHL2 = 3007
+	extOffsetLH2 = 3279
+	extOffsetHH2 = 3551
+	extOffsetHL3 = 3807
+	extOffsetLH3 = 3879
+	extOffsetHH3 = 3951
+	extOffsetLL3 = 4015
+
+	extSizeLL3 = TilePixels - extOffsetLL3 // 9×9
+)
+
+// ErrProgressiveUnsupported is returned for progressive tiles that need state
+// from earlier passes: upgrade passes and difference tiles.
+var ErrProgressiveUnsupported = errors.New("rfx: unsupported progressive tile")
+
+// ProgressiveQuant is an RFX_PROGRESSIVE_CODEC_QUANT entry: the extra shift
+// applied to each subband at one quality level.
+type ProgressiveQuant struct {
+	Quality uint8
+	Y       SubbandQuant
+	Cb      SubbandQuant
+	Cr      SubbandQuant
+}
+
+// ProgressiveRegion is a parsed PROGRESSIVE_WBT_REGION block.
+type ProgressiveRegion struct {
+	Flags      uint8
+	Rects      []Rect
+	Quants     []SubbandQuant
+	ProgQuants []ProgressiveQuant
+	Tiles      [][]byte // Encoded tile blocks, in stream order
+}
+
+// Extrapolate reports whether the region's tiles use the reduce-extrapolate DWT.
+func (r *ProgressiveRegion) Extrapolate() bool {
+	return r.Flags&RFX_DWT_REDUCE_EXTRAPOLATE != 0
+}
+
+// ParseProgressiveQuantValues parses a 5-byte RFX_COMPONENT_CODEC_QUANT.
+// Unlike TS_RFX_CODEC_QUANT, it packs each level's HL value before LH:
+// LL3, HL3, LH3, HH3, HL2, LH2, HH2, HL1, LH1, HH1.
+func ParseProgressiveQuantValues(data []byte) (*SubbandQuant, error) {
+	q, err := ParseQuantValues(data)
+	if err != nil {
+		return nil, err
+	}
+	q.LH3, q.HL3 = q.HL3, q.LH3
+	q.LH2, q.HL2 = q.HL2, q.LH2
+	q.LH1, q.HL1 = q.HL1, q.LH1
+	return q, nil
+}
+
+// ParseProgressiveQuant parses a 16-byte RFX_PROGRESSIVE_CODEC_QUANT entry.
+// Progressive shifts may be zero, so the tables are not range-checked.
+func ParseProgressiveQuant(data []byte) (*ProgressiveQuant, error) {
+	if len(data) < ProgressiveQuantSize {
+		return nil, fmt.Errorf("%w: need %d bytes, got %d", ErrInvalidQuantValues, ProgressiveQuantSize, len(data))
+	}
+
+	pq := &ProgressiveQuant{Quality: data[0]}
+	for i, dst := range []*SubbandQuant{&pq.Y, &pq.Cb, &pq.Cr} {
+		q, err := ParseProgressiveQuantValues(data[1+i*5:])
+		if err != nil {
+			return nil, err
+		}
+		*dst = *q
+	}
+	return pq, nil
+}
+
+// ParseProgressiveRegion parses a PROGRESSIVE_WBT_REGION block, validating
+// its quantization tables the same way ParseRFXMessage does for a tileset.
+// The returned tiles alias data.
+func ParseProgressiveRegion(data []byte) (*ProgressiveRegion, error) {
+	if len(data) < progressiveRegionHeaderSize {
+		return nil, ErrInvalidBlockLength
+	}
+	if binary.LittleEndian.Uint16(data) != PROGRESSIVE_WBT_REGION {
+		return nil, ErrInvalidBlockType
+	}
+	blockLen := int(binary.LittleEndian.Uint32(data[2:]))
+	if blockLen < progressiveRegionHeaderSize || blockLen > len(data) {
+		return nil, ErrInvalidBlockLength
+	}
+	data = data[:blockLen]
+
+	offset := 6 // Skip block header
+
+	tileSize := data[offset]
+	offset++
+	if tileSize != TileSize {
+		return nil, fmt.Errorf("%w: tile size %d", ErrInvalidTileData, tileSize)
+	}
+
+	numRects := int(binary.LittleEndian.Uint16(data[offset:]))
+	offset += 2
+
+	numQuant := int(data[offset])
+	offset++
+
+	numProgQuant := int(data[offset])
+	offset++
+
+	region := &ProgressiveRegion{Flags: data[offset]}
+	offset++
+
+	numTiles := int(binary.LittleEndian.Uint16(data[offset:]))
+	offset += 2
+
+	tileDataSize := int(binary.LittleEndian.Uint32(data[offset:]))
+	offset += 4
+
+	// Parse rectangles
+	if offset+numRects*8 > len(data) {
+		return nil, fmt.Errorf("%w: region declares %d rects", ErrInvalidBlockLength, numRects)
+	}
+	region.Rects = make([]Rect, numRects)
+	for i := range region.Rects {
+		region.Rects[i] = Rect{
+			X:      binary.LittleEndian.Uint16(data[offset:]),
+			Y:      binary.LittleEndian.Uint16(data[offset+2:]),
+			Width:  binary.LittleEndian.Uint16(data[offset+4:]),
+			Height: binary.LittleEndian.Uint16(data[offset+6:]),
+		}
+		offset += 8
+	}
+
+	// Parse quantization tables
+	if offset+numQuant*5 > len(data) {
+		return nil, fmt.Errorf("%w: region declares %d tables but holds %d", ErrInvalidQuantValues, numQuant, (len(data)-offset)/5)
+	}
+	region.Quants = make([]SubbandQuant, numQuant)
+	for i := range region.Quants {
+		quant, err := ParseProgressiveQuantValues(data[offset:])
+		if err == nil {
+			err = quant.Validate()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("quant table %d: %w", i, err)
+		}
+		region.Quants[i] = *quant
+		offset += 5
+	}
+
+	// Parse progressive quality levels
+	if offset+numProgQuant*ProgressiveQuantSize > len(data) {
+		return nil, fmt.Errorf("%w: region declares %d quality levels", ErrInvalidQuantValues, numProgQuant)
+	}
+	region.ProgQuants = make([]ProgressiveQuant, numProgQuant)
+	for i := range region.ProgQuants {
+		pq, err := ParseProgressiveQuant(data[offset:])
+		if err != nil {
+			return nil, fmt.Errorf("quality level %d: %w", i, err)
+		}
+		region.ProgQuants[i] = *pq
+		offset += ProgressiveQuantSize
+	}
+
+	// Split the tile data into tile blocks
+	if offset+tileDataSize > len(data) {
+		return nil, fmt.Errorf("%w: tile data size %d", ErrInvalidBlockLength, tileDataSize)
+	}
+	tileData := data[offset : offset+tileDataSize]
+	region.Tiles = make([][]byte, 0, numTiles)
+	for i := 0; i < numTiles; i++ {
+		if len(tileData) < 6 {
+			return nil, fmt.Errorf("%w: region declares %d tiles but holds %d", ErrInvalidTileData, numTiles, i)
+		}
+		tileLen := int(binary.LittleEndian.Uint32(tileData[2:]))
+		if tileLen < 6 || tileLen > len(tileData) {
+			return nil, fmt.Errorf("%w: tile %d", ErrInvalidBlockLength, i)
+		}
+		region.Tiles = append(region.Tiles, tileData[:tileLen])
+		tileData = tileData[tileLen:]
+	}
+
+	return region, nil
+}
+
+// progressiveTile is the header and component data of a TILE_SIMPLE or
+// TILE_FIRST block.
+type progressiveTile struct {
+	quantIdx [3]uint8
+	xIdx     uint16
+	yIdx     uint16
+	flags    uint8
+	quality  uint8
+	yData    []byte
+	cbData   []byte
+	crData   []byte
+}
+
+// parseProgressiveTile parses a progressive tile block.
+func parseProgressiveTile(data []byte) (*progressiveTile, error) {
+	if len(data) < 6 {
+		return nil, ErrInvalidTileData
+	}
+
+	blockType := binary.LittleEndian.Uint16(data)
+	blockLen := int(binary.LittleEndian.Uint32(data[2:]))
+	if blockLen > len(data) {
+		return nil, ErrInvalidBlockLength
+	}
+	data = data[:blockLen]
+
+	headerSize := progressiveSimpleHeaderSize
+	switch blockType {
+	case PROGRESSIVE_WBT_TILE_SIMPLE:
+	case PROGRESSIVE_WBT_TILE_FIRST:
+		headerSize = progressiveFirstHeaderSize
+	case PROGRESSIVE_WBT_TILE_UPGRADE:
+		return nil, fmt.Errorf("%w: upgrade passes are not decoded", ErrProgressiveUnsupported)
+	default:
+		return nil, ErrInvalidBlockType
+	}
+	if len(data) < headerSize {
+		return nil, ErrInvalidTileData
+	}
+
+	tile := &progressiveTile{quality: ProgressiveQualityFull}
+	offset := 6 // Skip block header
+
+	copy(tile.quantIdx[:], data[offset:offset+3])
+	offset += 3
+
+	tile.xIdx = binary.LittleEndian.Uint16(data[offset:])
+	offset += 2
+
+	tile.yIdx = binary.LittleEndian.Uint16(data[offset:])
+	offset += 2
+
+	tile.flags = data[offset]
+	offset++
+
+	if blockType == PROGRESSIVE_WBT_TILE_FIRST {
+		tile.quality = data[offset]
+		offset++
+	}
+
+	yLen := int(binary.LittleEndian.Uint16(data[offset:]))
+	offset += 2
+
+	cbLen := int(binary.LittleEndian.Uint16(data[offset:]))
+	offset += 2
+
+	crLen := int(binary.LittleEndian.Uint16(data[offset:]))
+	offset += 2
+
+	tailLen := int(binary.LittleEndian.Uint16(data[offset:]))
+	offset += 2
+
+	if offset+yLen+cbLen+crLen+tailLen > len(data) {
+		return nil, ErrInvalidTileData
+	}
+
+	tile.yData = data[offset : offset+yLen]
+	offset += yLen
+
+	tile.cbData = data[offset : offset+cbLen]
+	offset += cbLen
+
+	tile.crData = data[offset : offset+crLen]
+
+	return tile, nil
+}
+
+// DecodeProgressiveTile decodes the first quality pass of a progressive tile
+// (TILE_SIMPLE or TILE_FIRST block) using the tables of the region it came
+// from. Upgrade passes and difference tiles return ErrProgressiveUnsupported.
+func DecodeProgressiveTile(data []byte, region *ProgressiveRegion) (*Tile, error) {
+	tile, err := parseProgressiveTile(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var quants [3]*SubbandQuant
+	for c, idx := range tile.quantIdx {
+		if int(idx) >= len(region.Quants) {
+			return nil, fmt.Errorf("%w: tile references table %d of %d", ErrInvalidQuantValues, idx, len(region.Quants))
+		}
+		quants[c] = &region.Quants[idx]
+	}
+
+	var progQuant *ProgressiveQuant
+	if tile.quality != ProgressiveQualityFull {
+		if int(tile.quality) >= len(region.ProgQuants) {
+			return nil, fmt.Errorf("%w: tile references quality %d of %d", ErrInvalidQuantValues, tile.quality, len(region.ProgQuants))
+		}
+		progQuant = &region.ProgQuants[tile.quality]
+	}
+
+	yCoeff := make([]int16, TilePixels)
+	cbCoeff := make([]int16, TilePixels)
+	crCoeff := make([]int16, TilePixels)
+	rgba := make([]byte, TileRGBASize)
+
+	err = decodeProgressiveTileInto(tile, quants[0], quants[1], quants[2], progQuant, region.Extrapolate(),
+		yCoeff, cbCoeff, crCoeff, dwtTempBuffer[:], rgba)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tile{
+		X:    tile.xIdx,
+		Y:    tile.yIdx,
+		RGBA: rgba,
+	}, nil
+}
+
+// DecodeProgressiveTileWithBuffers decodes a progressive tile using
+// pre-allocated buffers (for WASM). The caller supplies the tables the tile
+// header refers to; a nil progQuant decodes at full quality. regionFlags are
+// the flags of the enclosing region.
+func DecodeProgressiveTileWithBuffers(
+	data []byte,
+	quantY, quantCb, quantCr *SubbandQuant,
+	progQuant *ProgressiveQuant,
+	regionFlags uint8,
+	yCoeff, cbCoeff, crCoeff []int16,
+	rgba []byte,
+) (xIdx, yIdx uint16, err error) {
+	tile, err := parseProgressiveTile(data)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	extrapolate := regionFlags&RFX_DWT_REDUCE_EXTRAPOLATE != 0
+	err = decodeProgressiveTileInto(tile, quantY, quantCb, quantCr, progQuant, extrapolate,
+		yCoeff, cbCoeff, crCoeff, dwtTempBuffer[:], rgba)
+	if err != nil {
+		return 0, 0, err
+	}
+	return tile.xIdx, tile.yIdx, nil
+}
+
+// decodeProgressiveTileInto decodes the three components of a parsed tile and
+// color converts them into rgba.
+func decodeProgressiveTileInto(
+	tile *progressiveTile,
+	quantY, quantCb, quantCr *SubbandQuant,
+	progQuant *ProgressiveQuant,
+	extrapolate bool,
+	yCoeff, cbCoeff, crCoeff, dwtTemp []int16,
+	rgba []byte,
+) error {
+	if tile.flags&RFX_TILE_DIFFERENCE != 0 {
+		return fmt.Errorf("%w: difference tiles need the previous tile", ErrProgressiveUnsupported)
+	}
+
+	full := ProgressiveQuant{}
+	if progQuant == nil {
+		progQuant = &full
+	}
+
+	components := [...]struct {
+		data  []byte
+		quant *SubbandQuant
+		prog  *SubbandQuant
+		coeff []int16
+	}{
+		{tile.yData, quantY, &progQuant.Y, yCoeff},
+		{tile.cbData, quantCb, &progQuant.Cb, cbCoeff},
+		{tile.crData, quantCr, &progQuant.Cr, crCoeff},
+	}
+	for _, c := range components {
+		if err := decodeProgressiveComponent(c.data, c.quant, c.prog, extrapolate, c.coeff, dwtTemp); err != nil {
+			return err
+		}
+	}
+
+	YCbCrToRGBA(yCoeff, cbCoeff, crCoeff, rgba)
+	return nil
+}
+
+// decodeProgressiveComponent turns one component's first-pass data into
+// spatial-domain values in coeff. Every component is RLGR1 coded, and each
+// subband is shifted by its quant value plus its progressive quant value.
+func decodeProgressiveComponent(data []byte, quant, prog *SubbandQuant, extrapolate bool, coeff, temp []int16) error {
+	if err := RLGRDecode(data, RLGR1, coeff); err != nil {
+		return err
+	}
+
+	shift := addQuant(quant, prog)
+	if !extrapolate {
+		DifferentialDecode(coeff[OffsetLL3:], SizeL3)
+		Dequantize(coeff, &shift)
+		inverseDWT2D(coeff, temp)
+		return nil
+	}
+
+	DifferentialDecode(coeff[extOffsetLL3:], extSizeLL3)
+	dequantizeExtrapolate(coeff, &shift)
+	inverseDWT2DExtrapolate(coeff, temp)
+	return nil
+}
+
+// addQuant returns the per-subband sum of two quantization tables.
+func addQuant(a, b *SubbandQuant) SubbandQuant {
+	return SubbandQuant{
+		LL3: a.LL3 + b.LL3, LH3: a.LH3 + b.LH3, HL3: a.HL3 + b.HL3, HH3: a.HH3 + b.HH3,
+		LH2: a.LH2 + b.LH2, HL2: a.HL2 + b.HL2, HH2: a.HH2 + b.HH2,
+		LH1: a.LH1 + b.LH1, HL1: a.HL1 + b.HL1, HH1: a.HH1 + b.HH1,
+	}
+}
+
+// dequantizeExtrapolate is Dequantize for the reduce-extrapolate layout.
+func dequantizeExtrapolate(buffer []int16, quant *SubbandQuant) {
+	dequantBlock(buffer[extOffsetHL1:extOffsetLH1], quant.HL1)
+	dequantBlock(buffer[extOffsetLH1:extOffsetHH1], quant.LH1)
+	dequantBlock(buffer[extOffsetHH1:extOffsetHL2], quant.HH1)
+	dequantBlock(buffer[extOffsetHL2:extOffsetLH2], quant.HL2)
+	dequantBlock(buffer[extOffsetLH2:extOffsetHH2], quant.LH2)
+	dequantBlock(buffer[extOffsetHH2:extOffsetHL3], quant.HH2)
+	dequantBlock(buffer[extOffsetHL3:extOffsetLH3], quant.HL3)
+	dequantBlock(buffer[extOffsetLH3:extOffsetHH3], quant.LH3)
+	dequantBlock(buffer[extOffsetHH3:extOffsetLL3], quant.HH3)
+	dequantBlock(buffer[extOffsetLL3:TilePixels], quant.LL3)
+}
+
+// inverseDWT2DExtrapolate performs the 3-level inverse DWT on coefficients
+// in the reduce-extrapolate layout, leaving the 64×64 result in buffer.
+//
+// This follows FreeRDP's progressive_rfx_dwt_2d_decode_block.
+func inverseDWT2DExtrapolate(buffer, temp []int16) {
+	idwt2DBlockExtrapolate(buffer[extOffsetHL3:], temp, 3) // 9×9 + 8 → 17×17
+	idwt2DBlockExtrapolate(buffer[extOffsetHL2:], temp, 2) // 17×17 + 16 → 33×33
+	idwt2DBlockExtrapolate(buffer, temp, 1)                // 33×33 + 31 → 64×64
+}
+
+// extrapolateBandCounts returns the number of low- and high-pass samples per
+// row at a DWT level in the reduce-extrapolate layout.
+func extrapolateBandCounts(level int) (nLow, nHigh int) {
+	nLow = TileSize>>level + 1
+	if level == 1 {
+		nHigh = TileSize>>1 - 1
+	} else {
+		nHigh = (TileSize + 1<<(level-1)) >> level
+	}
+	return nLow, nHigh
+}
+
+// idwt2DBlockExtrapolate performs one level of the reduce-extrapolate inverse
+// DWT. The subbands are stored from the start of buffer as HL (nLow rows of
+// nHigh), LH (nHigh rows of nLow), HH (nHigh×nHigh) and LL (nLow×nLow); the
+// output replaces them as a square of side nLow+nHigh.
+func idwt2DBlockExtrapolate(buffer, temp []int16, level int) {
+	nLow, nHigh := extrapolateBandCounts(level)
+	hl := buffer
+	lh := hl[nLow*nHigh:]
+	hh := lh[nHigh*nLow:]
+	ll := hh[nHigh*nHigh:]
+
+	stride := nLow + nHigh
+	l := temp
+	h := temp[nLow*stride:]
+
+	// Horizontal pass: LL + HL → L, LH + HH → H
+	for y := 0; y < nLow; y++ {
+		idwt1DExtrapolate(ll[y*nLow:], 1, hl[y*nHigh:], 1, l[y*stride:], 1, nLow, nHigh)
+	}
+	for y := 0; y < nHigh; y++ {
+		idwt1DExtrapolate(lh[y*nLow:], 1, hh[y*nHigh:], 1, h[y*stride:], 1, nLow, nHigh)
+	}
+
+	// Vertical pass: L + H → output
+	for x := 0; x < stride; x++ {
+		idwt1DExtrapolate(l[x:], stride, h[x:], stride, buffer[x:], stride, nLow, nHigh)
+	}
+}
+
+// idwt1DExtrapolate reconstructs nLow+nHigh samples from nLow low-pass and
+// nHigh high-pass samples, each read and written with the given steps.
+// Intermediate values are truncated to int16 as in FreeRDP.
+func idwt1DExtrapolate(low []int16, lowStep int, high []int16, highStep int, dst []int16, dstStep int, nLow, nHigh int) {
+	h0 := int32(high[0])
+	x0 := int16(int32(low[0]) - h0)
+	x2 := x0
+
+	li, hi, di := lowStep, highStep, 0
+	for j := 0; j < nHigh-1; j++ {
+		h1 := int32(high[hi])
+		hi += highStep
+		l0 := int32(low[li])
+		li += lowStep
+
+		x2 = int16(l0 - (h0+h1)/2)
+		dst[di] = x0
+		dst[di+dstStep] = int16((int32(x0)+int32(x2))/2 + 2*h0)
+		di += 2 * dstStep
+
+		x0 = x2
+		h0 = h1
+	}
+
+	switch {
+	case nLow <= nHigh:
+		dst[di] = x2
+		dst[di+dstStep] = int16(int32(x2) + 2*h0)
+	case nLow == nHigh+1:
+		x0 = int16(int32(low[li]) - h0)
+		dst[di] = x2
+		dst[di+dstStep] = int16((int32(x0)+int32(x2))/2 + 2*h0)
+		dst[di+2*dstStep] = x0
+	default:
+		x0 = int16(int32(low[li]) - h0/2)
+		dst[di] = x2
+		dst[di+dstStep] = int16((int32(x0)+int32(x2))/2 + 2*h0)
+		dst[di+2*dstStep] = x0
+		dst[di+3*dstStep] = int16((int32(x0) + int32(low[li+lowStep])) / 2)
+	}
+}
+
+// ParseProgressiveMessage parses a RemoteFX Progressive stream and returns
+// the first-pass tiles of its regions. Tiles that cannot be decoded,
+// including upgrade passes, are skipped.
+func ParseProgressiveMessage(data []byte) (*Frame, error) {
+	if len(data) < 6 {
+		return nil, ErrInvalidBlockLength
+	}
+
+	frame := &Frame{
+		Tiles: make([]*Tile, 0),
+	}
+
+	offset := 0
+
+	for offset+6 <= len(data) {
+		blockType := binary.LittleEndian.Uint16(data[offset:])
+		blockLen := int(binary.LittleEndian.Uint32(data[offset+2:]))
+
+		if blockLen < 6 || offset+blockLen > len(data) {
+			return nil, fmt.Errorf("%w: block at offset %d", ErrInvalidBlockLength, offset)
+		}
+
+		blockData := data[offset : offset+blockLen]
+
+		switch blockType {
+		case PROGRESSIVE_WBT_FRAME_BEGIN:
+			if blockLen < 12 {
+				return nil, ErrInvalidBlockLength
+			}
+			frame.FrameIdx = binary.LittleEndian.Uint32(blockData[6:])
+			// regionCount := binary.LittleEndian.Uint16(blockData[10:])
+
+		case PROGRESSIVE_WBT_REGION:
+			region, err := ParseProgressiveRegion(blockData)
+			if err != nil {
+				return nil, err
+			}
+			frame.Rects = append(frame.Rects, region.Rects...)
+			for _, tileData := range region.Tiles {
+				tile, err := DecodeProgressiveTile(tileData, region)
+				if err != nil {
+					continue
+				}
+				frame.Tiles = append(frame.Tiles, tile)
+			}
+
+		case PROGRESSIVE_WBT_SYNC, PROGRESSIVE_WBT_CONTEXT, PROGRESSIVE_WBT_FRAME_END:
+			// Nothing to decode; subband diffing only affects upgrade passes
+		}
+
+		offset += blockLen
+	}
+
+	return frame, nil
+}
@@ -0,0 +1,322 @@
+package rfx
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testProgQuant is a progressive quality level adding one to every subband.
+var testProgQuant = []byte{
+	0x00,
+	0x11, 0x11, 0x11, 0x11, 0x11,
+	0x11, 0x11, 0x11, 0x11, 0x11,
+	0x11, 0x11, 0x11, 0x11, 0x11,
+}
+
+// buildProgressiveTile builds a TILE_SIMPLE (quality ProgressiveQualityFull)
+// or TILE_FIRST block with pseudo-random component data that RLGR1 decodes
+// without error.
+func buildProgressiveTile(rng *rand.Rand, xIdx, yIdx uint16, flags, quality uint8) []byte {
+	const yLen, cbLen, crLen = 2048, 1024, 1024
+	coeff := make([]int16, TilePixels)
+	for {
+		components := make([]byte, yLen+cbLen+crLen)
+		rng.Read(components)
+		if RLGRDecode(components[:yLen], RLGR1, coeff) != nil ||
+			RLGRDecode(components[yLen:yLen+cbLen], RLGR1, coeff) != nil ||
+			RLGRDecode(components[yLen+cbLen:], RLGR1, coeff) != nil {
+			continue
+		}
+
+		blockType, header := PROGRESSIVE_WBT_TILE_SIMPLE, progressiveSimpleHeaderSize
+		if quality != ProgressiveQualityFull {
+			blockType, header = PROGRESSIVE_WBT_TILE_FIRST, progressiveFirstHeaderSize
+		}
+		tile := make([]byte, header, header+len(components))
+		binary.LittleEndian.PutUint16(tile[0:], blockType)
+		binary.LittleEndian.PutUint32(tile[2:], uint32(header+len(components)))
+		binary.LittleEndian.PutUint16(tile[9:], xIdx)
+		binary.LittleEndian.PutUint16(tile[11:], yIdx)
+		tile[13] = flags
+		offset := 14
+		if blockType == PROGRESSIVE_WBT_TILE_FIRST {
+			tile[offset] = quality
+			offset++
+		}
+		binary.LittleEndian.PutUint16(tile[offset:], yLen)
+		binary.LittleEndian.PutUint16(tile[offset+2:], cbLen)
+		binary.LittleEndian.PutUint16(tile[offset+4:], crLen)
+		return append(tile, components...)
+	}
+}
+
+// buildProgressiveRegion builds a PROGRESSIVE_WBT_REGION block with one
+// rectangle and the given packed tables and tiles.
+func buildProgressiveRegion(flags uint8, quants, progQuants []byte, tiles [][]byte) []byte {
+	block := make([]byte, progressiveRegionHeaderSize)
+	binary.LittleEndian.PutUint16(block[0:], PROGRESSIVE_WBT_REGION)
+	block[6] = TileSize
+	binary.LittleEndian.PutUint16(block[7:], 1)
+	block[9] = byte(len(quants) / 5)
+	block[10] = byte(len(progQuants) / ProgressiveQuantSize)
+	block[11] = flags
+	binary.LittleEndian.PutUint16(block[12:], uint16(len(tiles)))
+
+	rect := make([]byte, 8)
+	binary.LittleEndian.PutUint16(rect[4:], 128)
+	binary.LittleEndian.PutUint16(rect[6:], 64)
+	block = append(block, rect...)
+	block = append(block, quants...)
+	block = append(block, progQuants...)
+
+	tileDataSize := 0
+	for _, tile := range tiles {
+		block = append(block, tile...)
+		tileDataSize += len(tile)
+	}
+	binary.LittleEndian.PutUint32(block[2:], uint32(len(block)))
+	binary.LittleEndian.PutUint32(block[14:], uint32(tileDataSize))
+	return block
+}
+
+// decodeProgressiveReference decodes a non-extrapolated tile with the
+// standard RFX steps, using RLGR1 and the given shift for every component.
+func decodeProgressiveReference(t *testing.T, data []byte, shift *SubbandQuant) []byte {
+	tile, err := parseProgressiveTile(data)
+	require.NoError(t, err)
+
+	var planes [3][]int16
+	for i, component := range [][]byte{tile.yData, tile.cbData, tile.crData} {
+		planes[i] = make([]int16, TilePixels)
+		require.NoError(t, RLGRDecode(component, RLGR1, planes[i]))
+		DifferentialDecode(planes[i][OffsetLL3:], SizeL3)
+		Dequantize(planes[i], shift)
+		InverseDWT2D(planes[i])
+	}
+	rgba := make([]byte, TileRGBASize)
+	YCbCrToRGBA(planes[0], planes[1], planes[2], rgba)
+	return rgba
+}
+
+func TestParseProgressiveQuantValues(t *testing.T) {
+	q, err := ParseProgressiveQuantValues([]byte{0x21, 0x43, 0x65, 0x87, 0xA9})
+	require.NoError(t, err)
+	assert.Equal(t, &SubbandQuant{
+		LL3: 1, HL3: 2, LH3: 3, HH3: 4,
+		HL2: 5, LH2: 6, HH2: 7,
+		HL1: 8, LH1: 9, HH1: 10,
+	}, q)
+
+	_, err = ParseProgressiveQuantValues([]byte{0x66})
+	assert.ErrorIs(t, err, ErrInvalidQuantValues)
+
+	pq, err := ParseProgressiveQuant(testProgQuant)
+	require.NoError(t, err)
+	assert.Equal(t, uint8(1), pq.Cr.HH1)
+
+	_, err = ParseProgressiveQuant(testProgQuant[:15])
+	assert.ErrorIs(t, err, ErrInvalidQuantValues)
+}
+
+func TestDecodeProgressiveTile_MatchesRFXPipeline(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	quant, err := ParseProgressiveQuantValues(testQuantTables)
+	require.NoError(t, err)
+
+	simple := buildProgressiveTile(rng, 3, 1, 0, ProgressiveQualityFull)
+	first := buildProgressiveTile(rng, 4, 1, 0, 0)
+	data := buildProgressiveRegion(0, testQuantTables[:5], testProgQuant, [][]byte{simple, first})
+
+	region, err := ParseProgressiveRegion(data)
+	require.NoError(t, err)
+	require.Len(t, region.Tiles, 2)
+	assert.False(t, region.Extrapolate())
+	assert.Equal(t, []Rect{{Width: 128, Height: 64}}, region.Rects)
+
+	// Full quality shifts by the quant table alone
+	tile, err := DecodeProgressiveTile(simple, region)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(3), tile.X)
+	assert.Equal(t, uint16(1), tile.Y)
+	assert.Equal(t, decodeProgressiveReference(t, simple, quant), tile.RGBA)
+
+	// Quality 0 adds one to every shift
+	tile, err = DecodeProgressiveTile(first, region)
+	require.NoError(t, err)
+	coarser := addQuant(quant, &SubbandQuant{1, 1, 1, 1, 1, 1, 1, 1, 1, 1})
+	assert.Equal(t, decodeProgressiveReference(t, first, &coarser), tile.RGBA)
+
+	// The buffer variant matches
+	yCoeff := make([]int16, TilePixels)
+	cbCoeff := make([]int16, TilePixels)
+	crCoeff := make([]int16, TilePixels)
+	rgba := make([]byte, TileRGBASize)
+	x, y, err := DecodeProgressiveTileWithBuffers(first, quant, quant, quant, &region.ProgQuants[0], 0,
+		yCoeff, cbCoeff, crCoeff, rgba)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(4), x)
+	assert.Equal(t, uint16(1), y)
+	assert.Equal(t, tile.RGBA, rgba)
+}
+
+func TestDecodeProgressiveTile_Extrapolate(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	tiles := [][]byte{
+		buildProgressiveTile(rng, 0, 0, 0, ProgressiveQualityFull),
+		buildProgressiveTile(rng, 1, 0, 0, 0),
+	}
+	region, err := ParseProgressiveRegion(buildProgressiveRegion(RFX_DWT_REDUCE_EXTRAPOLATE, testQuantTables, testProgQuant, tiles))
+	require.NoError(t, err)
+	assert.True(t, region.Extrapolate())
+
+	for i, data := range tiles {
+		tile, err := DecodeProgressiveTile(data, region)
+		require.NoError(t, err, "tile %d", i)
+		assert.Len(t, tile.RGBA, TileRGBASize)
+	}
+}
+
+func TestInverseDWT2DExtrapolate_DC(t *testing.T) {
+	// A flat LL3 band with no detail reconstructs a flat tile
+	buffer := make([]int16, TilePixels)
+	for i := extOffsetLL3; i < TilePixels; i++ {
+		buffer[i] = 100
+	}
+	inverseDWT2DExtrapolate(buffer, make([]int16, TilePixels))
+	for i, v := range buffer {
+		require.Equal(t, int16(100), v, "sample %d", i)
+	}
+}
+
+func TestExtrapolateBandCounts(t *testing.T) {
+	total := 0
+	for level := 1; level <= 3; level++ {
+		nLow, nHigh := extrapolateBandCounts(level)
+		total += 2*nLow*nHigh + nHigh*nHigh
+		if level == 3 {
+			total += nLow * nLow
+			assert.Equal(t, extSizeLL3, nLow*nLow)
+		}
+	}
+	assert.Equal(t, TilePixels, total)
+}
+
+func TestDecodeProgressiveTile_Errors(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	tile := buildProgressiveTile(rng, 0, 0, 0, 0)
+	region, err := ParseProgressiveRegion(buildProgressiveRegion(0, testQuantTables, testProgQuant, [][]byte{tile}))
+	require.NoError(t, err)
+
+	upgrade := make([]byte, 26)
+	binary.LittleEndian.PutUint16(upgrade[0:], PROGRESSIVE_WBT_TILE_UPGRADE)
+	binary.LittleEndian.PutUint32(upgrade[2:], 26)
+	_, err = DecodeProgressiveTile(upgrade, region)
+	assert.ErrorIs(t, err, ErrProgressiveUnsupported)
+
+	diff := buildProgressiveTile(rng, 0, 0, RFX_TILE_DIFFERENCE, 0)
+	_, err = DecodeProgressiveTile(diff, region)
+	assert.ErrorIs(t, err, ErrProgressiveUnsupported)
+
+	badQuant := append([]byte(nil), tile...)
+	badQuant[7] = 2
+	_, err = DecodeProgressiveTile(badQuant, region)
+	assert.ErrorIs(t, err, ErrInvalidQuantValues)
+
+	badQuality := append([]byte(nil), tile...)
+	badQuality[14] = 1
+	_, err = DecodeProgressiveTile(badQuality, region)
+	assert.ErrorIs(t, err, ErrInvalidQuantValues)
+
+	_, err = DecodeProgressiveTile(tile[:progressiveFirstHeaderSize], region)
+	assert.ErrorIs(t, err, ErrInvalidBlockLength)
+
+	truncated := append([]byte(nil), tile[:progressiveFirstHeaderSize]...)
+	binary.LittleEndian.PutUint32(truncated[2:], uint32(len(truncated)))
+	_, err = DecodeProgressiveTile(truncated, region)
+	assert.ErrorIs(t, err, ErrInvalidTileData)
+
+	_, err = DecodeProgressiveTile(buildTestTile(rng, 0, 0, 0), region)
+	assert.ErrorIs(t, err, ErrInvalidBlockType)
+}
+
+func TestParseProgressiveRegion_Errors(t *testing.T) {
+	rng := rand.New(rand.NewSource(6))
+	tiles := [][]byte{buildProgressiveTile(rng, 0, 0, 0, ProgressiveQualityFull)}
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"short", []byte{0xC4, 0xCC}, ErrInvalidBlockLength},
+		{"quant out of range", buildProgressiveRegion(0, []byte{0x65, 0x66, 0x66, 0x66, 0x66}, nil, tiles), ErrInvalidQuantValues},
+		{"wrong block", buildTestTileset(nil), ErrInvalidBlockType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseProgressiveRegion(tt.data)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	t.Run("truncated tables", func(t *testing.T) {
+		data := buildProgressiveRegion(0, testQuantTables, testProgQuant, nil)
+		data[9] = 8
+		_, err := ParseProgressiveRegion(data)
+		assert.ErrorIs(t, err, ErrInvalidQuantValues)
+	})
+
+	t.Run("wrong tile size", func(t *testing.T) {
+		data := buildProgressiveRegion(0, testQuantTables, nil, tiles)
+		data[6] = 32
+		_, err := ParseProgressiveRegion(data)
+		assert.ErrorIs(t, err, ErrInvalidTileData)
+	})
+
+	t.Run("missing tiles", func(t *testing.T) {
+		data := buildProgressiveRegion(0, testQuantTables, nil, tiles)
+		binary.LittleEndian.PutUint16(data[12:], 2)
+		_, err := ParseProgressiveRegion(data)
+		assert.ErrorIs(t, err, ErrInvalidTileData)
+	})
+}
+
+func TestParseProgressiveMessage(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	upgrade := make([]byte, 26)
+	binary.LittleEndian.PutUint16(upgrade[0:], PROGRESSIVE_WBT_TILE_UPGRADE)
+	binary.LittleEndian.PutUint32(upgrade[2:], 26)
+	region := buildProgressiveRegion(0, testQuantTables, testProgQuant, [][]byte{
+		buildProgressiveTile(rng, 0, 0, 0, ProgressiveQualityFull),
+		upgrade,
+		buildProgressiveTile(rng, 1, 0, 0, 0),
+	})
+
+	block := func(blockType uint16, body ...byte) []byte {
+		b := make([]byte, 6, 6+len(body))
+		binary.LittleEndian.PutUint16(b[0:], blockType)
+		binary.LittleEndian.PutUint32(b[2:], uint32(6+len(body)))
+		return append(b, body...)
+	}
+
+	var data []byte
+	data = append(data, block(PROGRESSIVE_WBT_SYNC, 0xCA, 0xAC, 0xCC, 0xCA, 0x00, 0x01)...)
+	data = append(data, block(PROGRESSIVE_WBT_FRAME_BEGIN, 42, 0, 0, 0, 1, 0)...)
+	data = append(data, block(PROGRESSIVE_WBT_CONTEXT, 0, 64, 0, 0)...)
+	data = append(data, region...)
+	data = append(data, block(PROGRESSIVE_WBT_FRAME_END)...)
+
+	frame, err := ParseProgressiveMessage(data)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(42), frame.FrameIdx)
+	assert.Len(t, frame.Rects, 1)
+	require.Len(t, frame.Tiles, 2, "upgrade pass is skipped")
+	assert.Equal(t, uint16(1), frame.Tiles[1].X)
+
+	_, err = ParseProgressiveMessage(data[:len(data)-10])
+	assert.ErrorIs(t, err, ErrInvalidBlockLength)
+}
@@ -0,0 +1,108 @@
+package rfx
+
+import "encoding/binary"
+
+// Update is the part of a decoded tile covered by one region rectangle,
+// positioned on the destination surface.
+type Update struct {
+	X, Y          int // Destination of the covered area
+	Width, Height int
+	TileX, TileY  int // Offset of the covered area within the tile
+	Tile          *Tile
+}
+
+// Updates positions the frame's tiles relative to the region origin
+// (originX, originY), normally the destination of the surface command that
+// carried the frame, and clips each tile to the region rectangles. Tiles
+// outside every rectangle produce no update. A frame without rectangles is
+// treated as covering all of its tiles.
+func (f *Frame) Updates(originX, originY int) []Update {
+	updates := make([]Update, 0, len(f.Tiles))
+
+	for _, tile := range f.Tiles {
+		tileX, tileY := int(tile.X)*TileSize, int(tile.Y)*TileSize
+
+		if len(f.Rects) == 0 {
+			updates = append(updates, Update{
+				X:      originX + tileX,
+				Y:      originY + tileY,
+				Width:  TileSize,
+				Height: TileSize,
+				Tile:   tile,
+			})
+			continue
+		}
+
+		for _, r := range f.Rects {
+			left := max(tileX, int(r.X))
+			top := max(tileY, int(r.Y))
+			right := min(tileX+TileSize, int(r.X)+int(r.Width))
+			bottom := min(tileY+TileSize, int(r.Y)+int(r.Height))
+			if left >= right || top >= bottom {
+				continue
+			}
+
+			updates = append(updates, Update{
+				X:      originX + left,
+				Y:      originY + top,
+				Width:  right - left,
+				Height: bottom - top,
+				TileX:  left - tileX,
+				TileY:  top - tileY,
+				Tile:   tile,
+			})
+		}
+	}
+
+	return updates
+}
+
+// RGBA returns the update's pixels, Width×Height in RGBA order. An update
+// covering the whole tile returns the tile's buffer without copying.
+func (u *Update) RGBA() []byte {
+	if u.Width == TileSize && u.Height == TileSize {
+		return u.Tile.RGBA
+	}
+
+	rowBytes := u.Width * 4
+	out := make([]byte, u.Height*rowBytes)
+	for row := 0; row < u.Height; row++ {
+		src := ((u.TileY+row)*TileSize + u.TileX) * 4
+		copy(out[row*rowBytes:], u.Tile.RGBA[src:src+rowBytes])
+	}
+	return out
+}
+
+// MessageRegion returns the region rectangles of an RFX message without
+// decoding its tiles. It reports false when the message carries tiles but
+// no region, or is malformed, since the area it paints is then unknown.
+func MessageRegion(data []byte) ([]Rect, bool) {
+	var rects []Rect
+	hasRegion, hasTiles := false, false
+
+	for offset := 0; offset+6 <= len(data); {
+		blockType := binary.LittleEndian.Uint16(data[offset:])
+		blockLen := int(binary.LittleEndian.Uint32(data[offset+2:]))
+		if blockLen < 6 || offset+blockLen > len(data) {
+			return nil, false
+		}
+
+		switch blockType {
+		case WBT_REGION:
+			region, err := parseRegionBlock(data[offset : offset+blockLen])
+			if err != nil {
+				return nil, false
+			}
+			rects = append(rects, region...)
+			hasRegion = true
+		case WBT_TILESET:
+			hasTiles = true
+		}
+		offset += blockLen
+	}
+
+	if hasTiles && !hasRegion {
+		return nil, false
+	}
+	return rects, true
+}
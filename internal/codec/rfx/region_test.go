@@ -0,0 +1,113 @@
+package rfx
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildTestRegion builds a WBT_REGION block holding the given rectangles.
+func buildTestRegion(rects ...Rect) []byte {
+	block := make([]byte, 9+8*len(rects))
+	binary.LittleEndian.PutUint16(block[0:], WBT_REGION)
+	binary.LittleEndian.PutUint32(block[2:], uint32(len(block)))
+	binary.LittleEndian.PutUint16(block[7:], uint16(len(rects)))
+	for i, r := range rects {
+		binary.LittleEndian.PutUint16(block[9+i*8:], r.X)
+		binary.LittleEndian.PutUint16(block[11+i*8:], r.Y)
+		binary.LittleEndian.PutUint16(block[13+i*8:], r.Width)
+		binary.LittleEndian.PutUint16(block[15+i*8:], r.Height)
+	}
+	return block
+}
+
+func TestFrameUpdates_Region(t *testing.T) {
+	rng := rand.New(rand.NewSource(9))
+	rects := []Rect{
+		{X: 0, Y: 0, Width: 128, Height: 64},   // tiles (0,0) and (1,0)
+		{X: 160, Y: 80, Width: 32, Height: 16}, // inside tile (2,1)
+	}
+	tiles := [][]byte{
+		buildTestTile(rng, 0, 0, 0),
+		buildTestTile(rng, 1, 0, 0),
+		buildTestTile(rng, 2, 1, 0),
+		buildTestTile(rng, 3, 3, 0), // outside every rect
+	}
+	data := append(buildTestRegion(rects...), buildTestTileset(tiles)...)
+
+	frame, err := ParseRFXMessage(data, NewContext())
+	require.NoError(t, err)
+	require.Equal(t, rects, frame.Rects)
+	require.Len(t, frame.Tiles, 4)
+
+	updates := frame.Updates(100, 50)
+	require.Len(t, updates, 3)
+
+	assert.Equal(t, Update{X: 100, Y: 50, Width: 64, Height: 64, Tile: frame.Tiles[0]}, updates[0])
+	assert.Equal(t, Update{X: 164, Y: 50, Width: 64, Height: 64, Tile: frame.Tiles[1]}, updates[1])
+	assert.Equal(t, Update{X: 260, Y: 130, Width: 32, Height: 16, TileX: 32, TileY: 16, Tile: frame.Tiles[2]}, updates[2])
+
+	// Full tiles are passed through, partial ones cropped
+	assert.Equal(t, frame.Tiles[0].RGBA, updates[0].RGBA())
+	cropped := updates[2].RGBA()
+	require.Len(t, cropped, 32*16*4)
+	for row := 0; row < 16; row++ {
+		src := ((16+row)*TileSize + 32) * 4
+		assert.Equal(t, frame.Tiles[2].RGBA[src:src+32*4], cropped[row*32*4:(row+1)*32*4], "row %d", row)
+	}
+}
+
+func TestFrameUpdates_NoRegion(t *testing.T) {
+	rng := rand.New(rand.NewSource(10))
+	frame, err := ParseRFXMessage(buildTestTileset([][]byte{buildTestTile(rng, 2, 3, 0)}), NewContext())
+	require.NoError(t, err)
+
+	updates := frame.Updates(10, 20)
+	require.Len(t, updates, 1)
+	assert.Equal(t, Update{X: 138, Y: 212, Width: 64, Height: 64, Tile: frame.Tiles[0]}, updates[0])
+}
+
+func TestFrameUpdates_OverlappingRects(t *testing.T) {
+	tile := &Tile{X: 0, Y: 0, RGBA: make([]byte, TileRGBASize)}
+	frame := &Frame{
+		Tiles: []*Tile{tile},
+		Rects: []Rect{{X: 0, Y: 0, Width: 48, Height: 64}, {X: 32, Y: 0, Width: 64, Height: 32}},
+	}
+
+	updates := frame.Updates(0, 0)
+	require.Len(t, updates, 2)
+	assert.Equal(t, Update{Width: 48, Height: 64, Tile: tile}, updates[0])
+	assert.Equal(t, Update{X: 32, Width: 32, Height: 32, TileX: 32, Tile: tile}, updates[1])
+}
+
+func TestParseRegionBlock_Truncated(t *testing.T) {
+	data := buildTestRegion(Rect{Width: 64, Height: 64}, Rect{X: 64, Width: 64, Height: 64})
+	binary.LittleEndian.PutUint16(data[7:], 3)
+
+	_, err := parseRegionBlock(data)
+	assert.ErrorIs(t, err, ErrInvalidBlockLength)
+}
+
+func TestMessageRegion(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	rects := []Rect{{X: 0, Y: 0, Width: 64, Height: 32}, {X: 64, Y: 64, Width: 16, Height: 16}}
+	tileset := buildTestTileset([][]byte{buildTestTile(rng, 0, 0, 0)})
+
+	got, ok := MessageRegion(append(buildTestRegion(rects...), tileset...))
+	require.True(t, ok)
+	assert.Equal(t, rects, got)
+
+	_, ok = MessageRegion(tileset)
+	assert.False(t, ok, "tiles without a region paint an unknown area")
+
+	truncated := buildTestRegion(rects...)
+	_, ok = MessageRegion(truncated[:len(truncated)-1])
+	assert.False(t, ok)
+
+	got, ok = MessageRegion(nil)
+	assert.True(t, ok, "a message without tiles paints nothing")
+	assert.Empty(t, got)
+}
@@ -2,7 +2,10 @@
 // RemoteFX is a tile-based wavelet codec used for efficient remote desktop graphics.
 package rfx
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // Tile dimensions (fixed by MS-RDPRFX specification)
 const (
@@ -40,10 +43,15 @@ const (
 	SizeL3 = 64   // 8×8
 )
 
-// RLGR coding modes
+// RLGR coding modes. The context block selects one for all three
+// components of every tile.
 const (
-	RLGR1 = 1 // Used for Y (luminance) component
-	RLGR3 = 3 // Used for Cb, Cr (chrominance) components
+	RLGR1 = 1
+	RLGR3 = 3
+
+	// DefaultEntropyMode applies until a context block selects a mode, and
+	// again after a codec reset
+	DefaultEntropyMode = RLGR3
 )
 
 // RLGR adaptive coding constants (from MS-RDPRFX section 3.1.8.1.7.1)
@@ -80,6 +88,12 @@ const (
 	CLW_ENTROPY_RLGR3  uint8  = 0x04
 )
 
+// Valid range of a subband quantization value (MS-RDPRFX section 2.2.2.1.5)
+const (
+	MinQuantValue = 6
+	MaxQuantValue = 15
+)
+
 // Errors
 var (
 	ErrInvalidBlockType   = errors.New("rfx: invalid block type")
@@ -88,6 +102,8 @@ var (
 	ErrRLGRDecodeError    = errors.New("rfx: RLGR decode error")
 	ErrBufferTooSmall     = errors.New("rfx: buffer too small")
 	ErrInvalidQuantValues = errors.New("rfx: invalid quantization values")
+	ErrTileOutOfBounds    = errors.New("rfx: tile outside surface")
+	ErrUnsupportedEntropy = errors.New("rfx: unsupported entropy algorithm")
 )
 
 // SubbandQuant holds quantization values for all 10 subbands.
@@ -117,6 +133,9 @@ type Frame struct {
 	FrameIdx uint32
 	Tiles    []*Tile
 	Rects    []Rect
+
+	// SkippedTiles counts tiles dropped for lying outside the surface
+	SkippedTiles int
 }
 
 // Rect represents a rectangular region
@@ -125,11 +144,14 @@ type Rect struct {
 	Width, Height uint16
 }
 
-// Context holds decoder state across frames
+// Context holds decoder state across frames. A sync block resets it.
 type Context struct {
-	Width       uint16
-	Height      uint16
-	EntropyMode uint8 // RLGR1 or RLGR3
+	TileSize    uint16 // From the context block; always 64
+	EntropyMode int    // RLGR1 or RLGR3, from the context block
+
+	// Surface size from the channels block; tiles must start inside it
+	SurfaceWidth  uint16
+	SurfaceHeight uint16
 
 	// Quantization tables (indexed by quantIdxY, quantIdxCb, quantIdxCr)
 	QuantTables []SubbandQuant
@@ -138,10 +160,22 @@ type Context struct {
 // NewContext creates a new RFX decoding context
 func NewContext() *Context {
 	return &Context{
+		EntropyMode: DefaultEntropyMode,
 		QuantTables: make([]SubbandQuant, 0, 8),
 	}
 }
 
+// Reset returns the context to its initial state. The server sends a sync
+// block to restart the stream, after which the channels and context blocks
+// must be sent again.
+func (c *Context) Reset() {
+	c.TileSize = 0
+	c.EntropyMode = DefaultEntropyMode
+	c.SurfaceWidth = 0
+	c.SurfaceHeight = 0
+	c.QuantTables = c.QuantTables[:0]
+}
+
 // DefaultQuant returns default quantization values (quality ~85%)
 func DefaultQuant() *SubbandQuant {
 	return &SubbandQuant{
@@ -160,7 +194,7 @@ func DefaultQuant() *SubbandQuant {
 // Byte 4: HL1 (low nibble), HH1 (high nibble)
 func ParseQuantValues(data []byte) (*SubbandQuant, error) {
 	if len(data) < 5 {
-		return nil, ErrInvalidQuantValues
+		return nil, fmt.Errorf("%w: need 5 bytes, got %d", ErrInvalidQuantValues, len(data))
 	}
 
 	return &SubbandQuant{
@@ -176,3 +210,23 @@ func ParseQuantValues(data []byte) (*SubbandQuant, error) {
 		HH1: (data[4] >> 4) & 0x0F,
 	}, nil
 }
+
+// Validate checks that every subband value lies within the range allowed by
+// MS-RDPRFX. ParseQuantValues accepts any nibble, so callers decoding server
+// data should validate before use.
+func (q *SubbandQuant) Validate() error {
+	subbands := [...]struct {
+		name  string
+		value uint8
+	}{
+		{"LL3", q.LL3}, {"LH3", q.LH3}, {"HL3", q.HL3}, {"HH3", q.HH3},
+		{"LH2", q.LH2}, {"HL2", q.HL2}, {"HH2", q.HH2},
+		{"LH1", q.LH1}, {"HL1", q.HL1}, {"HH1", q.HH1},
+	}
+	for _, sb := range subbands {
+		if sb.value < MinQuantValue || sb.value > MaxQuantValue {
+			return fmt.Errorf("%w: %s=%d outside %d-%d", ErrInvalidQuantValues, sb.name, sb.value, MinQuantValue, MaxQuantValue)
+		}
+	}
+	return nil
+}
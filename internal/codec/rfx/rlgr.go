@@ -129,12 +129,17 @@ func (bs *BitStream) RemainingBits() int {
 }
 
 // RLGRDecode decodes RLGR-encoded data into coefficient array.
-// mode: RLGR1 for Y component, RLGR3 for Cb/Cr
+// mode: RLGR1 or RLGR3, as selected by the context block. The two differ only
+// in GR mode (k == 0), where RLGR1 codes one value per code and RLGR3 codes a
+// pair.
 // output: pre-allocated int16 slice of size TilePixels (4096)
 func RLGRDecode(data []byte, mode int, output []int16) error {
 	if len(output) < TilePixels {
 		return ErrBufferTooSmall
 	}
+	if mode != RLGR1 && mode != RLGR3 {
+		return ErrUnsupportedEntropy
+	}
 
 	// Clear output buffer
 	for i := range output {
@@ -249,10 +254,10 @@ func RLGRDecode(data []byte, mode int, output []int16) error {
 			// GR mode (k == 0) - no run-length coding
 			if mode == RLGR1 {
 				// RLGR1: Single value coding with interleaved sign
-			nIdx := bs.CountLeadingOnes()
-			if bs.RemainingBits() == 0 && nIdx == 0 {
-				return ErrRLGRDecodeError
-			}
+				nIdx := bs.CountLeadingOnes()
+				if bs.RemainingBits() == 0 && nIdx == 0 {
+					return ErrRLGRDecodeError
+				}
 
 				mag := uint32(0)
 				if kr > 0 && bs.RemainingBits() >= int(kr) {
@@ -109,6 +109,72 @@ func TestRLGRDecode_RLGR3_BasicDecode(t *testing.T) {
 	}
 }
 
+// rlgrTestCoefficients are the leading coefficients of the known RLGR
+// vectors; the remaining coefficients of the tile are zero. They cover runs
+// in RL mode, both signs, and values large enough to grow kr in GR mode.
+var rlgrTestCoefficients = []int16{5, -3, 0, 0, 12, -1, 0, 1, 0, 0, 0, 0, 0, 0, -7, 2, 40, 0, -1, 0, 0, 0, 3}
+
+// Known encodings of rlgrTestCoefficients, produced with the encoder from
+// MS-RDPRFX 3.1.8.1.7.3 and padded with zero bits to a whole byte
+var (
+	rlgr1TestVector = []byte{
+		0x99, 0xA1, 0xFF, 0xE1, 0x08, 0x07, 0xE6, 0x7F, 0xFF, 0xFF, 0xFF, 0xFF,
+		0x80, 0x00, 0x80, 0x00, 0x08, 0x10, 0x00, 0x00, 0x00, 0x1F, 0xAC, 0x00,
+	}
+	rlgr3TestVector = []byte{
+		0x99, 0xB7, 0xFF, 0xC0, 0x0D, 0x41, 0xEB, 0xFF, 0xFF, 0xE0, 0x20, 0x40,
+		0x30, 0x00, 0x00, 0x01, 0xFB, 0x40,
+	}
+)
+
+func TestRLGRDecode_KnownVectors(t *testing.T) {
+	want := make([]int16, TilePixels)
+	copy(want, rlgrTestCoefficients)
+
+	tests := []struct {
+		name string
+		mode int
+		data []byte
+	}{
+		{"RLGR1", RLGR1, rlgr1TestVector},
+		{"RLGR3", RLGR3, rlgr3TestVector},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := make([]int16, TilePixels)
+			for i := range output {
+				output[i] = 0x7FFF // stale data from a previous tile
+			}
+			require.NoError(t, RLGRDecode(tt.data, tt.mode, output))
+			assert.Equal(t, want, output)
+		})
+	}
+}
+
+func TestRLGRDecode_ModeMismatch(t *testing.T) {
+	// The shared RL-mode prefix decodes alike; GR mode diverges
+	want := make([]int16, TilePixels)
+	copy(want, rlgrTestCoefficients)
+
+	output := make([]int16, TilePixels)
+	if err := RLGRDecode(rlgr1TestVector, RLGR3, output); err == nil {
+		assert.NotEqual(t, want, output)
+		assert.Equal(t, want[0], output[0])
+	}
+	if err := RLGRDecode(rlgr3TestVector, RLGR1, output); err == nil {
+		assert.NotEqual(t, want, output)
+		assert.Equal(t, want[0], output[0])
+	}
+}
+
+func TestRLGRDecode_UnsupportedMode(t *testing.T) {
+	output := make([]int16, TilePixels)
+	for _, mode := range []int{0, 2, 4, int(CLW_ENTROPY_RLGR3)} {
+		assert.ErrorIs(t, RLGRDecode(rlgr3TestVector, mode, output), ErrUnsupportedEntropy, "mode %d", mode)
+	}
+}
+
 // ============================================================================
 // Microsoft Protocol Test Suite Validation Tests
 // Reference: MS-RDPRFX_ClientTestDesignSpecification.md
@@ -2,12 +2,32 @@ package rfx
 
 import (
 	"encoding/binary"
+	"fmt"
 )
 
-// DecodeTile decodes a single RFX tile from compressed data.
+// CheckTileBounds verifies that the tile at index (xIdx, yIdx) starts inside
+// a surface of the given pixel dimensions. Tiles at the right and bottom
+// edges may extend past the surface, but must not start beyond it. A width or
+// height of zero or less means the surface size is unknown and is not checked.
+func CheckTileBounds(xIdx, yIdx uint16, width, height int) error {
+	x, y := int(xIdx)*TileSize, int(yIdx)*TileSize
+	if (width > 0 && x >= width) || (height > 0 && y >= height) {
+		return fmt.Errorf("%w: tile (%d,%d) at %d,%d outside %dx%d", ErrTileOutOfBounds, xIdx, yIdx, x, y, width, height)
+	}
+	return nil
+}
+
+// DecodeTile decodes a single RFX tile from compressed data using
+// DefaultEntropyMode.
 // data: raw tile data starting with CBT_TILE block header
 // quantY, quantCb, quantCr: quantization values for each component
 func DecodeTile(data []byte, quantY, quantCb, quantCr *SubbandQuant) (*Tile, error) {
+	return DecodeTileMode(data, DefaultEntropyMode, quantY, quantCb, quantCr)
+}
+
+// DecodeTileMode is DecodeTile with the entropy mode (RLGR1 or RLGR3) the
+// stream's context block selected.
+func DecodeTileMode(data []byte, mode int, quantY, quantCb, quantCr *SubbandQuant) (*Tile, error) {
 	if len(data) < 19 { // Minimum tile header size
 		return nil, ErrInvalidTileData
 	}
@@ -71,13 +91,13 @@ func DecodeTile(data []byte, quantY, quantCb, quantCr *SubbandQuant) (*Tile, err
 	crCoeff := make([]int16, TilePixels)
 
 	// RLGR decode each component
-	if err := RLGRDecode(yData, RLGR1, yCoeff); err != nil {
+	if err := RLGRDecode(yData, mode, yCoeff); err != nil {
 		return nil, err
 	}
-	if err := RLGRDecode(cbData, RLGR3, cbCoeff); err != nil {
+	if err := RLGRDecode(cbData, mode, cbCoeff); err != nil {
 		return nil, err
 	}
-	if err := RLGRDecode(crData, RLGR3, crCoeff); err != nil {
+	if err := RLGRDecode(crData, mode, crCoeff); err != nil {
 		return nil, err
 	}
 
@@ -111,9 +131,22 @@ func DecodeTile(data []byte, quantY, quantCb, quantCr *SubbandQuant) (*Tile, err
 // This avoids allocations in the hot path.
 func DecodeTileWithBuffers(
 	data []byte,
+	mode int,
 	quantY, quantCb, quantCr *SubbandQuant,
 	yCoeff, cbCoeff, crCoeff []int16,
 	rgba []byte,
+) (xIdx, yIdx uint16, err error) {
+	return decodeTileInto(data, mode, quantY, quantCb, quantCr, yCoeff, cbCoeff, crCoeff, dwtTempBuffer[:], rgba)
+}
+
+// decodeTileInto is DecodeTileWithBuffers with an explicit DWT temp buffer,
+// so callers with their own buffers can decode concurrently.
+func decodeTileInto(
+	data []byte,
+	mode int,
+	quantY, quantCb, quantCr *SubbandQuant,
+	yCoeff, cbCoeff, crCoeff, dwtTemp []int16,
+	rgba []byte,
 ) (xIdx, yIdx uint16, err error) {
 	if len(data) < 19 {
 		return 0, 0, ErrInvalidTileData
@@ -159,17 +192,17 @@ func DecodeTileWithBuffers(
 	}
 
 	// RLGR decode
-	if err := RLGRDecode(data[offset:offset+yLen], RLGR1, yCoeff); err != nil {
+	if err := RLGRDecode(data[offset:offset+yLen], mode, yCoeff); err != nil {
 		return 0, 0, err
 	}
 	offset += yLen
 
-	if err := RLGRDecode(data[offset:offset+cbLen], RLGR3, cbCoeff); err != nil {
+	if err := RLGRDecode(data[offset:offset+cbLen], mode, cbCoeff); err != nil {
 		return 0, 0, err
 	}
 	offset += cbLen
 
-	if err := RLGRDecode(data[offset:offset+crLen], RLGR3, crCoeff); err != nil {
+	if err := RLGRDecode(data[offset:offset+crLen], mode, crCoeff); err != nil {
 		return 0, 0, err
 	}
 
@@ -184,9 +217,9 @@ func DecodeTileWithBuffers(
 	Dequantize(crCoeff, quantCr)
 
 	// Inverse DWT
-	yPixels := InverseDWT2D(yCoeff)
-	cbPixels := InverseDWT2D(cbCoeff)
-	crPixels := InverseDWT2D(crCoeff)
+	yPixels := inverseDWT2D(yCoeff, dwtTemp)
+	cbPixels := inverseDWT2D(cbCoeff, dwtTemp)
+	crPixels := inverseDWT2D(crCoeff, dwtTemp)
 
 	// Color convert
 	YCbCrToRGBA(yPixels, cbPixels, crPixels, rgba)
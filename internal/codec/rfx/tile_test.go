@@ -102,7 +102,7 @@ func TestDecodeTileWithBuffers_TooShort(t *testing.T) {
 	crCoeff := make([]int16, TilePixels)
 	rgba := make([]byte, TileRGBASize)
 
-	_, _, err := DecodeTileWithBuffers(data, quant, quant, quant, yCoeff, cbCoeff, crCoeff, rgba)
+	_, _, err := DecodeTileWithBuffers(data, DefaultEntropyMode, quant, quant, quant, yCoeff, cbCoeff, crCoeff, rgba)
 	assert.Error(t, err)
 }
 
@@ -117,7 +117,7 @@ func TestDecodeTileWithBuffers_WrongBlockType(t *testing.T) {
 	crCoeff := make([]int16, TilePixels)
 	rgba := make([]byte, TileRGBASize)
 
-	_, _, err := DecodeTileWithBuffers(data, quant, quant, quant, yCoeff, cbCoeff, crCoeff, rgba)
+	_, _, err := DecodeTileWithBuffers(data, DefaultEntropyMode, quant, quant, quant, yCoeff, cbCoeff, crCoeff, rgba)
 	assert.Equal(t, ErrInvalidBlockType, err)
 }
 
@@ -139,7 +139,7 @@ func TestDecodeTileWithBuffers_InvalidBlockLength(t *testing.T) {
 	crCoeff := make([]int16, TilePixels)
 	rgba := make([]byte, TileRGBASize)
 
-	_, _, err := DecodeTileWithBuffers(data, quant, quant, quant, yCoeff, cbCoeff, crCoeff, rgba)
+	_, _, err := DecodeTileWithBuffers(data, DefaultEntropyMode, quant, quant, quant, yCoeff, cbCoeff, crCoeff, rgba)
 	assert.Equal(t, ErrInvalidBlockLength, err)
 }
 
@@ -161,7 +161,7 @@ func TestDecodeTileWithBuffers_InvalidComponentLengths(t *testing.T) {
 	crCoeff := make([]int16, TilePixels)
 	rgba := make([]byte, TileRGBASize)
 
-	_, _, err := DecodeTileWithBuffers(data, quant, quant, quant, yCoeff, cbCoeff, crCoeff, rgba)
+	_, _, err := DecodeTileWithBuffers(data, DefaultEntropyMode, quant, quant, quant, yCoeff, cbCoeff, crCoeff, rgba)
 	assert.Equal(t, ErrInvalidTileData, err)
 }
 
@@ -183,7 +183,7 @@ func TestDecodeTileWithBuffers_ValidMinimalTile(t *testing.T) {
 	crCoeff := make([]int16, TilePixels)
 	rgba := make([]byte, TileRGBASize)
 
-	xIdx, yIdx, err := DecodeTileWithBuffers(data, quant, quant, quant, yCoeff, cbCoeff, crCoeff, rgba)
+	xIdx, yIdx, err := DecodeTileWithBuffers(data, DefaultEntropyMode, quant, quant, quant, yCoeff, cbCoeff, crCoeff, rgba)
 	require.NoError(t, err)
 	assert.Equal(t, uint16(3), xIdx)
 	assert.Equal(t, uint16(4), yIdx)
@@ -240,3 +240,31 @@ func TestBlockTypeConstants(t *testing.T) {
 	assert.Equal(t, uint16(0xCAC2), WBT_TILESET)
 	assert.Equal(t, uint16(0xCAC3), CBT_TILE)
 }
+
+func TestCheckTileBounds(t *testing.T) {
+	tests := []struct {
+		name          string
+		xIdx, yIdx    uint16
+		width, height int
+		wantErr       bool
+	}{
+		{"origin", 0, 0, 1024, 768, false},
+		{"last full tile", 15, 11, 1024, 768, false},
+		{"partial edge tile", 15, 10, 1000, 700, false},
+		{"past right edge", 16, 0, 1024, 768, true},
+		{"past bottom edge", 0, 12, 1024, 768, true},
+		{"max index", 0xFFFF, 0xFFFF, 1024, 768, true},
+		{"unknown surface", 0xFFFF, 0xFFFF, 0, 0, false},
+		{"unknown height", 0, 0xFFFF, 1024, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckTileBounds(tt.xIdx, tt.yIdx, tt.width, tt.height)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrTileOutOfBounds)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
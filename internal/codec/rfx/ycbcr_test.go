@@ -273,10 +273,30 @@ func TestParseQuantValues_TooShort(t *testing.T) {
 	data := []byte{0x65, 0x87, 0xA9} // Only 3 bytes, need 5
 
 	quant, err := ParseQuantValues(data)
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, ErrInvalidQuantValues)
+	assert.Contains(t, err.Error(), "got 3")
 	assert.Nil(t, quant)
 }
 
+func TestSubbandQuant_Validate(t *testing.T) {
+	assert.NoError(t, DefaultQuant().Validate())
+
+	quant, err := ParseQuantValues([]byte{0x66, 0x66, 0x77, 0x88, 0xF9})
+	require.NoError(t, err)
+	assert.NoError(t, quant.Validate())
+
+	// LL3=5 is below the minimum of 6
+	quant, err = ParseQuantValues([]byte{0x65, 0x87, 0xA9, 0xCB, 0xED})
+	require.NoError(t, err)
+	err = quant.Validate()
+	assert.ErrorIs(t, err, ErrInvalidQuantValues)
+	assert.Contains(t, err.Error(), "LL3=5")
+
+	quant = DefaultQuant()
+	quant.HH1 = 0
+	assert.ErrorIs(t, quant.Validate(), ErrInvalidQuantValues)
+}
+
 func TestDefaultQuant(t *testing.T) {
 	quant := DefaultQuant()
 	require.NotNil(t, quant)
@@ -3,12 +3,17 @@
 package config
 
 import (
+	"crypto/tls"
 	"fmt"
+	"math"
+	"net"
 	"os"
+	"path"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf16"
 )
 
 // globalConfig stores the configuration loaded with command-line overrides
@@ -24,6 +29,13 @@ type Config struct {
 	RDP      RDPConfig      `json:"rdp"`
 	Security SecurityConfig `json:"security"`
 	Logging  LoggingConfig  `json:"logging"`
+
+	// Features holds the feature toggles merged from flags, env and the config file
+	Features Features `json:"-"`
+
+	// Hosts holds per-target connection profiles keyed by lowercase host name
+	// (optionally with a port), loaded from the config file
+	Hosts map[string]HostProfile `json:"hosts,omitempty"`
 }
 
 // LoadOptions holds command-line override options
@@ -35,10 +47,10 @@ type LoadOptions struct {
 	SkipTLSValidation bool
 	TLSServerName     string
 	AllowAnyTLSServer bool
-	UseNLA            *bool
-	EnableRFX         *bool // nil = use env/default, non-nil = override
-	EnableUDP         *bool // nil = use env/default, non-nil = override
-	PreferPCMAudio    *bool // nil = use env/default, non-nil = override
+
+	// Features overrides feature toggles by name (see FeatureNLA etc.);
+	// features not in the map keep their file/env/default value
+	Features map[string]bool
 }
 
 // ServerConfig holds server-specific configuration
@@ -48,21 +60,180 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration `json:"readTimeout" env:"SERVER_READ_TIMEOUT" default:"30s"`
 	WriteTimeout time.Duration `json:"writeTimeout" env:"SERVER_WRITE_TIMEOUT" default:"30s"`
 	IdleTimeout  time.Duration `json:"idleTimeout" env:"SERVER_IDLE_TIMEOUT" default:"120s"`
+
+	// ShutdownTimeout bounds how long active sessions are drained on SIGINT/SIGTERM
+	ShutdownTimeout time.Duration `json:"shutdownTimeout" env:"SERVER_SHUTDOWN_TIMEOUT" default:"30s"`
+
+	// UnknownMarkerPolicy controls how unrecognized browser control markers are handled
+	UnknownMarkerPolicy string `json:"unknownMarkerPolicy" env:"WS_UNKNOWN_MARKER_POLICY" default:"drop"`
+
+	// DedupPolicy controls duplicate WebSocket upgrades carrying the same client nonce
+	DedupPolicy string        `json:"dedupPolicy" env:"WS_DEDUP_POLICY" default:"off"`
+	DedupWindow time.Duration `json:"dedupWindow" env:"WS_DEDUP_WINDOW" default:"10s"`
+
+	// HeartbeatInterval pings the browser when no updates were sent for this long (0 = disabled)
+	HeartbeatInterval time.Duration `json:"heartbeatInterval" env:"WS_HEARTBEAT_INTERVAL" default:"0s"`
+
+	// MaxMessageSize closes sessions whose browser sends a WebSocket message larger than this many bytes (0 = 256 KiB)
+	MaxMessageSize int `json:"maxMessageSize" env:"WS_MAX_MESSAGE_SIZE" default:"262144"`
+
+	// FragmentSize splits updates to the browser larger than this many bytes into fragments (0 = disabled)
+	FragmentSize int `json:"fragmentSize" env:"WS_FRAGMENT_SIZE" default:"0"`
+
+	// AdminAddr serves the admin API on this host:port, separate from the gateway (empty = disabled)
+	AdminAddr string `json:"adminAddr" env:"ADMIN_ADDR" default:""`
+
+	// BasePath mounts all routes under a sub-path (e.g. /rdp) when behind a reverse proxy
+	BasePath string `json:"basePath" env:"BASE_PATH" default:""`
 }
 
+// Unknown WebSocket control marker policies
+const (
+	UnknownMarkerPolicyDrop  = "drop"  // log and drop the message, keep the session
+	UnknownMarkerPolicyClose = "close" // close the WebSocket with a protocol error
+)
+
+// Duplicate connection (same client nonce) policies
+const (
+	DedupPolicyOff     = "off"     // allow duplicate connections
+	DedupPolicyReplace = "replace" // the newer connection closes the earlier one
+	DedupPolicyReject  = "reject"  // the newer connection is refused
+)
+
 // RDPConfig holds RDP-specific configuration
 type RDPConfig struct {
-	DefaultWidth   int           `json:"defaultWidth" env:"RDP_DEFAULT_WIDTH" default:"1024"`
-	DefaultHeight  int           `json:"defaultHeight" env:"RDP_DEFAULT_HEIGHT" default:"768"`
-	MaxWidth       int           `json:"maxWidth" env:"RDP_MAX_WIDTH" default:"3840"`
-	MaxHeight      int           `json:"maxHeight" env:"RDP_MAX_HEIGHT" default:"2160"`
-	BufferSize     int           `json:"bufferSize" env:"RDP_BUFFER_SIZE" default:"65536"`
-	Timeout        time.Duration `json:"timeout" env:"RDP_TIMEOUT" default:"10s"`
-	EnableRFX      bool          `json:"enableRFX" env:"RDP_ENABLE_RFX" default:"true"`
-	EnableUDP      bool          `json:"enableUDP" env:"RDP_ENABLE_UDP" default:"false"`
-	PreferPCMAudio bool          `json:"preferPCMAudio" env:"RDP_PREFER_PCM_AUDIO" default:"false"`
+	DefaultWidth  int           `json:"defaultWidth" env:"RDP_DEFAULT_WIDTH" default:"1024"`
+	DefaultHeight int           `json:"defaultHeight" env:"RDP_DEFAULT_HEIGHT" default:"768"`
+	MaxWidth      int           `json:"maxWidth" env:"RDP_MAX_WIDTH" default:"3840"`
+	MaxHeight     int           `json:"maxHeight" env:"RDP_MAX_HEIGHT" default:"2160"`
+	BufferSize    int           `json:"bufferSize" env:"RDP_BUFFER_SIZE" default:"65536"`
+	Timeout       time.Duration `json:"timeout" env:"RDP_TIMEOUT" default:"10s"`
+
+	// ConnectRetries retries the connection sequence this many times when it fails with a transient server error
+	ConnectRetries int `json:"connectRetries" env:"RDP_CONNECT_RETRIES" default:"1"`
+
+	// ConnectRetryBackoff is the wait before the first retry, doubled for each further retry
+	ConnectRetryBackoff time.Duration `json:"connectRetryBackoff" env:"RDP_CONNECT_RETRY_BACKOFF" default:"1s"`
+
+	// DialTimeout bounds each TCP dial to the RDP host or gateway (0 = bounded by Timeout only)
+	DialTimeout time.Duration `json:"dialTimeout" env:"RDP_DIAL_TIMEOUT" default:"5s"`
+
+	// DialRetries redials this many times when the TCP connection times out, is refused or the host is unreachable
+	DialRetries int `json:"dialRetries" env:"RDP_DIAL_RETRIES" default:"0"`
+
+	// DialRetryBackoff is the wait before the first redial, doubled for each further one
+	DialRetryBackoff time.Duration `json:"dialRetryBackoff" env:"RDP_DIAL_RETRY_BACKOFF" default:"500ms"`
+
+	// RFXMode is the preferred RemoteFX mode advertised to the server ("image" or "video")
+	RFXMode string `json:"rfxMode" env:"RDP_RFX_MODE" default:"image"`
+
+	// NLAMechanism is the NLA authentication package: "ntlm", "kerberos" or "negotiate" (Kerberos, falling back to NTLM)
+	NLAMechanism string `json:"nlaMechanism" env:"RDP_NLA_MECHANISM" default:"ntlm"`
+
+	// KerberosConfig is the krb5.conf listing the Kerberos realms and their KDCs
+	KerberosConfig string `json:"kerberosConfig" env:"RDP_KRB5_CONFIG" default:"/etc/krb5.conf"`
+
+	// KerberosRealm is the users' Kerberos realm (empty = from the user name or the krb5.conf default realm)
+	KerberosRealm string `json:"kerberosRealm" env:"RDP_KERBEROS_REALM" default:""`
+
+	// PrimaryMonitorOnly advertises a single monitor and forwards only the primary monitor of server layouts
+	PrimaryMonitorOnly bool `json:"primaryMonitorOnly" env:"PRIMARY_MONITOR_ONLY" default:"false"`
+
+	// HandshakeTimeout fails a connection sequence that has not completed after this long (0 = no limit)
+	HandshakeTimeout time.Duration `json:"handshakeTimeout" env:"RDP_HANDSHAKE_TIMEOUT" default:"0s"`
+
+	// ConnectSplash sends the browser "still connecting" progress, repeated at this interval, until the first graphics arrive (0 = disabled)
+	ConnectSplash time.Duration `json:"connectSplash" env:"RDP_CONNECT_SPLASH" default:"0s"`
+
+	// UpdateWatchdogTimeout warns the browser when no updates or server heartbeats arrive for this long (0 = disabled)
+	UpdateWatchdogTimeout time.Duration `json:"updateWatchdogTimeout" env:"RDP_UPDATE_WATCHDOG_TIMEOUT" default:"0s"`
+
+	// ReadIdleTimeout closes the session when the RDP server sends nothing, not even a heartbeat, for this long (0 = disabled)
+	ReadIdleTimeout time.Duration `json:"readIdleTimeout" env:"RDP_READ_IDLE_TIMEOUT" default:"0s"`
+
+	// MaxDecodeWorkers caps the RemoteFX tile decode goroutines shared by all sessions (0 = GOMAXPROCS)
+	MaxDecodeWorkers int `json:"maxDecodeWorkers" env:"RDP_MAX_DECODE_WORKERS" default:"0"`
+
+	// MaxChannels caps the static virtual channels requested and joined per session (0 = protocol maximum)
+	MaxChannels int `json:"maxChannels" env:"RDP_MAX_CHANNELS" default:"0"`
+
+	// MaxUnacknowledgedFrames is how many frames the server may send before the browser acknowledges rendering one
+	MaxUnacknowledgedFrames int `json:"maxUnacknowledgedFrames" env:"RDP_MAX_UNACKNOWLEDGED_FRAMES" default:"2"`
+
+	// FrameReorderGrace is how many frames a late frame may trail the newest one and still be drawn; duplicates are always dropped
+	FrameReorderGrace int `json:"frameReorderGrace" env:"RDP_FRAME_REORDER_GRACE" default:"0"`
+
+	// BitmapCache negotiates in-memory revision 2 bitmap caches and renders cached MemBlt orders
+	BitmapCache bool `json:"bitmapCache" env:"RDP_BITMAP_CACHE" default:"false"`
+
+	// DrawingOrders negotiates the OpaqueRect and ScrBlt orders and forwards them to the browser
+	DrawingOrders bool `json:"drawingOrders" env:"RDP_DRAWING_ORDERS" default:"false"`
+
+	// DriveRoot redirects this directory to every session as a read-only drive (empty = no drive)
+	DriveRoot string `json:"driveRoot" env:"RDP_DRIVE_ROOT" default:""`
+
+	// DriveName is the name the server shows for the redirected drive
+	DriveName string `json:"driveName" env:"RDP_DRIVE_NAME" default:"SHARE"`
+
+	// Gateway tunnels all RDP connections through this RD Gateway host[:port] over HTTPS (empty = connect directly)
+	Gateway string `json:"gateway" env:"RDP_GATEWAY" default:""`
+
+	// DNSCacheTTL caches target host lookups shared by all sessions for this long (0 = resolve on every connection)
+	DNSCacheTTL time.Duration `json:"dnsCacheTTL" env:"RDP_DNS_CACHE_TTL" default:"30s"`
+
+	// DNSNegativeCacheTTL caches lookups of hosts that do not exist for this long (0 = not cached)
+	DNSNegativeCacheTTL time.Duration `json:"dnsNegativeCacheTTL" env:"RDP_DNS_NEGATIVE_CACHE_TTL" default:"5s"`
+
+	// ClientBuild is the client build number advertised to the server (0 = built-in default)
+	ClientBuild int `json:"clientBuild" env:"RDP_CLIENT_BUILD" default:"0"`
+
+	// ClientProductID is the client product ID advertised to the server, up to 31 characters (empty = none)
+	ClientProductID string `json:"clientProductId" env:"RDP_CLIENT_PRODUCT_ID" default:""`
+
+	// ClientOS is the client platform advertised to the server ("windows", "macos", "linux", "ios", "android" or "chromeos"; empty = built-in default)
+	ClientOS string `json:"clientOS" env:"RDP_CLIENT_OS" default:""`
 }
 
+// MaxConnectRetries bounds RDPConfig.ConnectRetries and DialRetries, so a
+// server that keeps failing with transient errors cannot hold a session open
+// for long.
+const MaxConnectRetries = 5
+
+// MaxChannels bounds RDPConfig.MaxChannels at the protocol's limit on static
+// virtual channels.
+const MaxChannels = 31
+
+// Preferred RemoteFX modes
+const (
+	RFXModeImage = "image" // image mode, suited to mostly static desktops
+	RFXModeVideo = "video" // video mode, suited to motion-heavy content
+)
+
+// NLA authentication packages
+const (
+	NLAMechanismNTLM      = "ntlm"      // NTLMv2 only
+	NLAMechanismKerberos  = "kerberos"  // Kerberos through SPNEGO only
+	NLAMechanismNegotiate = "negotiate" // Kerberos, falling back to NTLM when no service ticket can be obtained
+)
+
+// Client platforms that can be advertised to the server
+const (
+	ClientOSWindows  = "windows"
+	ClientOSMacOS    = "macos"
+	ClientOSLinux    = "linux"
+	ClientOSIOS      = "ios"
+	ClientOSAndroid  = "android"
+	ClientOSChromeOS = "chromeos"
+)
+
+// MaxClientProductIDLength bounds RDPConfig.ClientProductID at what fits in
+// the client core data.
+const MaxClientProductIDLength = 31
+
+// MaxDriveNameLength bounds RDPConfig.DriveName at the DOS name of a
+// device announce.
+const MaxDriveNameLength = 7
+
 // SecurityConfig holds security-related configuration
 type SecurityConfig struct {
 	AllowedOrigins     []string `json:"allowedOrigins" env:"ALLOWED_ORIGINS" default:""`
@@ -76,7 +247,35 @@ type SecurityConfig struct {
 	SkipTLSValidation  bool     `json:"skipTLSValidation" env:"TLS_SKIP_VERIFY" default:"false"`
 	TLSServerName      string   `json:"tlsServerName" env:"TLS_SERVER_NAME" default:""`
 	AllowAnyTLSServer  bool     `json:"allowAnyTLSServer" env:"TLS_ALLOW_ANY_SERVER_NAME" default:"false"`
-	UseNLA             bool     `json:"useNLA" env:"USE_NLA" default:"true"`
+
+	// ClientCertFile and ClientKeyFile hold the certificate and key presented
+	// to RDP servers requiring mutual TLS, as PEM file paths or inline PEM
+	ClientCertFile string `json:"clientCertFile" env:"TLS_CLIENT_CERT_FILE" default:""`
+	ClientKeyFile  string `json:"clientKeyFile" env:"TLS_CLIENT_KEY_FILE" default:""`
+
+	// MaxSessionDuration disconnects sessions that run longer than this (0 = unlimited)
+	MaxSessionDuration time.Duration `json:"maxSessionDuration" env:"MAX_SESSION_DURATION" default:"0s"`
+
+	// AdminToken is the bearer token the admin API requires; mandatory when ADMIN_ADDR is not a loopback address
+	AdminToken string `json:"-" env:"ADMIN_TOKEN" default:""`
+
+	// SessionTokenTTL makes /connect take its credentials from single-use tokens issued by POST /admin/tokens, valid this long (0 = disabled)
+	SessionTokenTTL time.Duration `json:"sessionTokenTTL" env:"SESSION_TOKEN_TTL" default:"0s"`
+
+	// RateLimitIdleTTL is how long a client's rate limit state is kept without requests
+	RateLimitIdleTTL time.Duration `json:"rateLimitIdleTTL" env:"RATE_LIMIT_IDLE_TTL" default:"10m"`
+
+	// CORSMaxAge is how long browsers may cache a CORS preflight response (0 = no Access-Control-Max-Age)
+	CORSMaxAge time.Duration `json:"corsMaxAge" env:"CORS_MAX_AGE" default:"10m"`
+
+	// AllowedTargets restricts RDP targets to these addresses, CIDR prefixes and host names (empty = any)
+	AllowedTargets []string `json:"allowedTargets" env:"ALLOWED_TARGETS" default:""`
+
+	// DeniedTargets refuses RDP targets matching these addresses, CIDR prefixes and host names
+	DeniedTargets []string `json:"deniedTargets" env:"DENIED_TARGETS" default:""`
+
+	// BlockPrivateTargets refuses loopback, private and link-local targets not in AllowedTargets
+	BlockPrivateTargets bool `json:"blockPrivateTargets" env:"BLOCK_PRIVATE_TARGETS" default:"false"`
 }
 
 // LoggingConfig holds logging configuration
@@ -102,6 +301,15 @@ func LoadWithOverrides(opts LoadOptions) (*Config, error) {
 	config.Server.ReadTimeout = getDurationWithDefault("SERVER_READ_TIMEOUT", 30*time.Second)
 	config.Server.WriteTimeout = getDurationWithDefault("SERVER_WRITE_TIMEOUT", 30*time.Second)
 	config.Server.IdleTimeout = getDurationWithDefault("SERVER_IDLE_TIMEOUT", 120*time.Second)
+	config.Server.ShutdownTimeout = getDurationWithDefault("SERVER_SHUTDOWN_TIMEOUT", 30*time.Second)
+	config.Server.UnknownMarkerPolicy = strings.ToLower(getEnvWithDefault("WS_UNKNOWN_MARKER_POLICY", UnknownMarkerPolicyDrop))
+	config.Server.DedupPolicy = strings.ToLower(getEnvWithDefault("WS_DEDUP_POLICY", DedupPolicyOff))
+	config.Server.DedupWindow = getDurationWithDefault("WS_DEDUP_WINDOW", 10*time.Second)
+	config.Server.HeartbeatInterval = getDurationWithDefault("WS_HEARTBEAT_INTERVAL", 0)
+	config.Server.MaxMessageSize = getIntWithDefault("WS_MAX_MESSAGE_SIZE", 256*1024)
+	config.Server.FragmentSize = getIntWithDefault("WS_FRAGMENT_SIZE", 0)
+	config.Server.AdminAddr = os.Getenv("ADMIN_ADDR")
+	config.Server.BasePath = normalizeBasePath(os.Getenv("BASE_PATH"))
 
 	// RDP config
 	config.RDP.DefaultWidth = getIntWithDefault("RDP_DEFAULT_WIDTH", 1024)
@@ -110,30 +318,45 @@ func LoadWithOverrides(opts LoadOptions) (*Config, error) {
 	config.RDP.MaxHeight = getIntWithDefault("RDP_MAX_HEIGHT", 2160)
 	config.RDP.BufferSize = getIntWithDefault("RDP_BUFFER_SIZE", 65536)
 	config.RDP.Timeout = getDurationWithDefault("RDP_TIMEOUT", 10*time.Second)
-	// RFX enabled by default; use --no-rfx or RDP_ENABLE_RFX=false to disable
-	if opts.EnableRFX != nil {
-		config.RDP.EnableRFX = *opts.EnableRFX
-	} else {
-		config.RDP.EnableRFX = getBoolWithDefault("RDP_ENABLE_RFX", true)
-	}
-	// UDP disabled by default (experimental); use --udp or RDP_ENABLE_UDP=true to enable
-	if opts.EnableUDP != nil {
-		config.RDP.EnableUDP = *opts.EnableUDP
-	} else {
-		config.RDP.EnableUDP = getBoolWithDefault("RDP_ENABLE_UDP", false)
-	}
-	// Prefer compressed audio by default; use --prefer-pcm-audio or RDP_PREFER_PCM_AUDIO=true for quality
-	if opts.PreferPCMAudio != nil {
-		config.RDP.PreferPCMAudio = *opts.PreferPCMAudio
-	} else {
-		config.RDP.PreferPCMAudio = getBoolWithDefault("RDP_PREFER_PCM_AUDIO", false)
-	}
+	config.RDP.ConnectRetries = getIntWithDefault("RDP_CONNECT_RETRIES", 1)
+	config.RDP.ConnectRetryBackoff = getDurationWithDefault("RDP_CONNECT_RETRY_BACKOFF", time.Second)
+	config.RDP.DialTimeout = getDurationWithDefault("RDP_DIAL_TIMEOUT", 5*time.Second)
+	config.RDP.DialRetries = getIntWithDefault("RDP_DIAL_RETRIES", 0)
+	config.RDP.DialRetryBackoff = getDurationWithDefault("RDP_DIAL_RETRY_BACKOFF", 500*time.Millisecond)
+	config.RDP.RFXMode = strings.ToLower(getEnvWithDefault("RDP_RFX_MODE", RFXModeImage))
+	config.RDP.NLAMechanism = strings.ToLower(getEnvWithDefault("RDP_NLA_MECHANISM", NLAMechanismNTLM))
+	config.RDP.KerberosConfig = getEnvWithDefault("RDP_KRB5_CONFIG", "/etc/krb5.conf")
+	config.RDP.KerberosRealm = getEnvWithDefault("RDP_KERBEROS_REALM", "")
+	config.RDP.PrimaryMonitorOnly = getBoolWithDefault("PRIMARY_MONITOR_ONLY", false)
+	config.RDP.HandshakeTimeout = getDurationWithDefault("RDP_HANDSHAKE_TIMEOUT", 0)
+	config.RDP.ConnectSplash = getDurationWithDefault("RDP_CONNECT_SPLASH", 0)
+	config.RDP.UpdateWatchdogTimeout = getDurationWithDefault("RDP_UPDATE_WATCHDOG_TIMEOUT", 0)
+	config.RDP.ReadIdleTimeout = getDurationWithDefault("RDP_READ_IDLE_TIMEOUT", 0)
+	config.RDP.MaxDecodeWorkers = getIntWithDefault("RDP_MAX_DECODE_WORKERS", 0)
+	config.RDP.MaxChannels = getIntWithDefault("RDP_MAX_CHANNELS", 0)
+	config.RDP.MaxUnacknowledgedFrames = getIntWithDefault("RDP_MAX_UNACKNOWLEDGED_FRAMES", 2)
+	config.RDP.FrameReorderGrace = getIntWithDefault("RDP_FRAME_REORDER_GRACE", 0)
+	config.RDP.BitmapCache = getBoolWithDefault("RDP_BITMAP_CACHE", false)
+	config.RDP.DrawingOrders = getBoolWithDefault("RDP_DRAWING_ORDERS", false)
+	config.RDP.DriveRoot = getEnvWithDefault("RDP_DRIVE_ROOT", "")
+	config.RDP.DriveName = getEnvWithDefault("RDP_DRIVE_NAME", "SHARE")
+	config.RDP.Gateway = getEnvWithDefault("RDP_GATEWAY", "")
+	config.RDP.DNSCacheTTL = getDurationWithDefault("RDP_DNS_CACHE_TTL", 30*time.Second)
+	config.RDP.DNSNegativeCacheTTL = getDurationWithDefault("RDP_DNS_NEGATIVE_CACHE_TTL", 5*time.Second)
+	config.RDP.ClientBuild = getIntWithDefault("RDP_CLIENT_BUILD", 0)
+	config.RDP.ClientProductID = getEnvWithDefault("RDP_CLIENT_PRODUCT_ID", "")
+	config.RDP.ClientOS = strings.ToLower(getEnvWithDefault("RDP_CLIENT_OS", ""))
 
 	// Security config
 	config.Security.AllowedOrigins = getStringSliceWithDefault("ALLOWED_ORIGINS", []string{})
+	config.Security.CORSMaxAge = getDurationWithDefault("CORS_MAX_AGE", 10*time.Minute)
 	config.Security.MaxConnections = getIntWithDefault("MAX_CONNECTIONS", 100)
 	config.Security.EnableRateLimit = getBoolWithDefault("ENABLE_RATE_LIMIT", true)
 	config.Security.RateLimitPerMinute = getIntWithDefault("RATE_LIMIT_PER_MINUTE", 60)
+	config.Security.RateLimitIdleTTL = getDurationWithDefault("RATE_LIMIT_IDLE_TTL", 10*time.Minute)
+	config.Security.AllowedTargets = getStringSliceWithDefault("ALLOWED_TARGETS", []string{})
+	config.Security.DeniedTargets = getStringSliceWithDefault("DENIED_TARGETS", []string{})
+	config.Security.BlockPrivateTargets = getBoolWithDefault("BLOCK_PRIVATE_TARGETS", false)
 	config.Security.EnableTLS = getBoolWithDefault("ENABLE_TLS", false)
 	config.Security.TLSCertFile = getEnvWithDefault("TLS_CERT_FILE", "")
 	config.Security.TLSKeyFile = getEnvWithDefault("TLS_KEY_FILE", "")
@@ -141,12 +364,11 @@ func LoadWithOverrides(opts LoadOptions) (*Config, error) {
 	config.Security.SkipTLSValidation = getBoolWithDefault("TLS_SKIP_VERIFY", false) || opts.SkipTLSValidation
 	config.Security.TLSServerName = getOverrideOrEnv(opts.TLSServerName, "TLS_SERVER_NAME", "")
 	config.Security.AllowAnyTLSServer = getBoolWithDefault("TLS_ALLOW_ANY_SERVER_NAME", false) || opts.AllowAnyTLSServer
-	// NLA enabled by default for security; set USE_NLA=false to disable
-	if opts.UseNLA != nil {
-		config.Security.UseNLA = *opts.UseNLA
-	} else {
-		config.Security.UseNLA = getBoolWithDefault("USE_NLA", true)
-	}
+	config.Security.ClientCertFile = getEnvWithDefault("TLS_CLIENT_CERT_FILE", "")
+	config.Security.ClientKeyFile = getEnvWithDefault("TLS_CLIENT_KEY_FILE", "")
+	config.Security.MaxSessionDuration = getDurationWithDefault("MAX_SESSION_DURATION", 0)
+	config.Security.AdminToken = os.Getenv("ADMIN_TOKEN")
+	config.Security.SessionTokenTTL = getDurationWithDefault("SESSION_TOKEN_TTL", 0)
 
 	// Logging config
 	config.Logging.Level = getOverrideOrEnv(opts.LogLevel, "LOG_LEVEL", "info")
@@ -154,6 +376,23 @@ func LoadWithOverrides(opts LoadOptions) (*Config, error) {
 	config.Logging.EnableCaller = getBoolWithDefault("LOG_ENABLE_CALLER", false)
 	config.Logging.File = getEnvWithDefault("LOG_FILE", "")
 
+	// Feature toggles and per-host connection profiles from the optional config file
+	var fileFeatures map[string]bool
+	if path := getOverrideOrEnv(opts.ConfigFile, "CONFIG_FILE", ""); path != "" {
+		fc, err := loadConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		fileFeatures = fc.Features
+		config.Hosts = fc.Hosts
+	}
+
+	features, err := resolveFeatures(fileFeatures, opts.Features)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	config.Features = features
+
 	// Validate configuration
 	if err := config.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
@@ -167,6 +406,41 @@ func LoadWithOverrides(opts LoadOptions) (*Config, error) {
 	return config, nil
 }
 
+// ClientCertificate loads the certificate and key presented to RDP servers
+// requiring mutual TLS. It returns nil when neither is configured.
+func (s *SecurityConfig) ClientCertificate() (*tls.Certificate, error) {
+	if s.ClientCertFile == "" && s.ClientKeyFile == "" {
+		return nil, nil
+	}
+	if s.ClientCertFile == "" || s.ClientKeyFile == "" {
+		return nil, fmt.Errorf("certificate and key must both be specified")
+	}
+
+	certPEM, err := readPEM(s.ClientCertFile)
+	if err != nil {
+		return nil, fmt.Errorf("read certificate: %w", err)
+	}
+	keyPEM, err := readPEM(s.ClientKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read key: %w", err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("load key pair: %w", err)
+	}
+	return &cert, nil
+}
+
+// readPEM returns value itself when it holds inline PEM, otherwise the
+// contents of the file it names.
+func readPEM(value string) ([]byte, error) {
+	if strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN") {
+		return []byte(value), nil
+	}
+	return os.ReadFile(value) // #nosec G304 -- path is supplied by the operator
+}
+
 // GetGlobalConfig returns the globally stored configuration
 // This should be used by packages that need access to the configuration
 // loaded by the server with command-line overrides
@@ -187,6 +461,48 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid server port: %s", c.Server.Port)
 	}
 
+	if c.Server.ShutdownTimeout < 0 {
+		return fmt.Errorf("shutdown timeout cannot be negative")
+	}
+
+	switch c.Server.UnknownMarkerPolicy {
+	case "", UnknownMarkerPolicyDrop, UnknownMarkerPolicyClose:
+	default:
+		return fmt.Errorf("invalid unknown marker policy: %s", c.Server.UnknownMarkerPolicy)
+	}
+
+	if c.Server.BasePath != normalizeBasePath(c.Server.BasePath) || strings.ContainsAny(c.Server.BasePath, "?#% ") {
+		return fmt.Errorf("invalid base path: %s", c.Server.BasePath)
+	}
+
+	switch c.Server.DedupPolicy {
+	case "", DedupPolicyOff, DedupPolicyReplace, DedupPolicyReject:
+	default:
+		return fmt.Errorf("invalid dedup policy: %s", c.Server.DedupPolicy)
+	}
+
+	if c.Server.HeartbeatInterval < 0 {
+		return fmt.Errorf("heartbeat interval cannot be negative")
+	}
+
+	if c.Server.MaxMessageSize < 0 {
+		return fmt.Errorf("max message size cannot be negative")
+	}
+
+	if c.Server.FragmentSize < 0 {
+		return fmt.Errorf("fragment size cannot be negative")
+	}
+
+	if c.Server.AdminAddr != "" {
+		host, _, err := net.SplitHostPort(c.Server.AdminAddr)
+		if err != nil {
+			return fmt.Errorf("invalid admin address: %w", err)
+		}
+		if !isLoopbackHost(host) && c.Security.AdminToken == "" {
+			return fmt.Errorf("admin API on a non-loopback address requires ADMIN_TOKEN")
+		}
+	}
+
 	// Validate RDP config
 	if c.RDP.DefaultWidth <= 0 || c.RDP.DefaultHeight <= 0 {
 		return fmt.Errorf("default dimensions must be positive")
@@ -200,6 +516,97 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("buffer size must be positive")
 	}
 
+	switch c.RDP.RFXMode {
+	case "", RFXModeImage, RFXModeVideo:
+	default:
+		return fmt.Errorf("invalid RemoteFX mode: %s", c.RDP.RFXMode)
+	}
+
+	switch c.RDP.NLAMechanism {
+	case "", NLAMechanismNTLM, NLAMechanismKerberos, NLAMechanismNegotiate:
+	default:
+		return fmt.Errorf("invalid NLA mechanism: %s", c.RDP.NLAMechanism)
+	}
+
+	if c.RDP.ConnectRetries < 0 || c.RDP.ConnectRetries > MaxConnectRetries {
+		return fmt.Errorf("connect retries must be between 0 and %d", MaxConnectRetries)
+	}
+
+	if c.RDP.ConnectRetryBackoff < 0 {
+		return fmt.Errorf("connect retry backoff cannot be negative")
+	}
+
+	if c.RDP.DialTimeout < 0 {
+		return fmt.Errorf("dial timeout cannot be negative")
+	}
+
+	if c.RDP.DialRetries < 0 || c.RDP.DialRetries > MaxConnectRetries {
+		return fmt.Errorf("dial retries must be between 0 and %d", MaxConnectRetries)
+	}
+
+	if c.RDP.DialRetryBackoff < 0 {
+		return fmt.Errorf("dial retry backoff cannot be negative")
+	}
+
+	if c.RDP.HandshakeTimeout < 0 {
+		return fmt.Errorf("handshake timeout cannot be negative")
+	}
+
+	if c.RDP.ConnectSplash < 0 {
+		return fmt.Errorf("connect splash interval cannot be negative")
+	}
+
+	if c.RDP.UpdateWatchdogTimeout < 0 {
+		return fmt.Errorf("update watchdog timeout cannot be negative")
+	}
+
+	if c.RDP.ReadIdleTimeout < 0 {
+		return fmt.Errorf("read idle timeout cannot be negative")
+	}
+
+	if c.RDP.DNSCacheTTL < 0 || c.RDP.DNSNegativeCacheTTL < 0 {
+		return fmt.Errorf("DNS cache TTLs cannot be negative")
+	}
+
+	if c.RDP.MaxDecodeWorkers < 0 {
+		return fmt.Errorf("max decode workers cannot be negative")
+	}
+
+	if c.RDP.MaxUnacknowledgedFrames < 0 {
+		return fmt.Errorf("max unacknowledged frames cannot be negative")
+	}
+
+	if c.RDP.FrameReorderGrace < 0 {
+		return fmt.Errorf("frame reorder grace cannot be negative")
+	}
+
+	if c.RDP.MaxChannels < 0 || c.RDP.MaxChannels > MaxChannels {
+		return fmt.Errorf("max channels must be between 0 and %d", MaxChannels)
+	}
+
+	if c.RDP.ClientBuild < 0 || int64(c.RDP.ClientBuild) > math.MaxUint32 {
+		return fmt.Errorf("client build must be between 0 and %d", uint32(math.MaxUint32))
+	}
+
+	if len(utf16.Encode([]rune(c.RDP.ClientProductID))) > MaxClientProductIDLength {
+		return fmt.Errorf("client product ID cannot be longer than %d characters", MaxClientProductIDLength)
+	}
+
+	if c.RDP.DriveRoot != "" {
+		if info, err := os.Stat(c.RDP.DriveRoot); err != nil || !info.IsDir() {
+			return fmt.Errorf("drive root is not a directory: %s", c.RDP.DriveRoot)
+		}
+		if !validDriveName(c.RDP.DriveName) {
+			return fmt.Errorf("drive name must be 1 to %d letters, digits, '-' or '_': %s", MaxDriveNameLength, c.RDP.DriveName)
+		}
+	}
+
+	switch c.RDP.ClientOS {
+	case "", ClientOSWindows, ClientOSMacOS, ClientOSLinux, ClientOSIOS, ClientOSAndroid, ClientOSChromeOS:
+	default:
+		return fmt.Errorf("invalid client OS: %s", c.RDP.ClientOS)
+	}
+
 	// Validate security config
 	if c.Security.EnableTLS {
 		if c.Security.TLSCertFile == "" || c.Security.TLSKeyFile == "" {
@@ -215,6 +622,14 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	if _, err := c.Security.TargetPolicy(); err != nil {
+		return err
+	}
+
+	if _, err := c.Security.ClientCertificate(); err != nil {
+		return fmt.Errorf("RDP client certificate: %w", err)
+	}
+
 	if c.Security.MaxConnections <= 0 {
 		return fmt.Errorf("max connections must be positive")
 	}
@@ -223,6 +638,36 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("rate limit per minute must be positive")
 	}
 
+	if c.Security.MaxSessionDuration < 0 {
+		return fmt.Errorf("max session duration cannot be negative")
+	}
+
+	if c.Security.SessionTokenTTL < 0 {
+		return fmt.Errorf("session token TTL cannot be negative")
+	}
+	if c.Security.SessionTokenTTL > 0 && c.Server.AdminAddr == "" {
+		return fmt.Errorf("session tokens require ADMIN_ADDR to issue them")
+	}
+
+	if c.Security.RateLimitIdleTTL < 0 {
+		return fmt.Errorf("rate limit idle TTL cannot be negative")
+	}
+
+	if c.Security.CORSMaxAge < 0 {
+		return fmt.Errorf("CORS max age cannot be negative")
+	}
+
+	for name, profile := range c.Hosts {
+		if name == "" || name != strings.ToLower(strings.TrimSpace(name)) {
+			return fmt.Errorf("invalid host profile name: %q", name)
+		}
+		switch profile.RFXMode {
+		case "", RFXModeImage, RFXModeVideo:
+		default:
+			return fmt.Errorf("invalid RemoteFX mode for host %s: %s", name, profile.RFXMode)
+		}
+	}
+
 	// Validate logging config
 	validLogLevels := map[string]bool{
 		"debug": true,
@@ -297,6 +742,20 @@ func getOverrideOrEnv(override, envKey, defaultValue string) string {
 	return getEnvWithDefault(envKey, defaultValue)
 }
 
+// normalizeBasePath turns a sub-path such as "rdp/" into "/rdp".
+// The root path normalizes to the empty string.
+func normalizeBasePath(p string) string {
+	p = strings.TrimSpace(p)
+	if p == "" {
+		return ""
+	}
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return ""
+	}
+	return p
+}
+
 func splitString(s, sep string) []string {
 	if s == "" {
 		return []string{}
@@ -310,3 +769,26 @@ func splitString(s, sep string) []string {
 	}
 	return result
 }
+
+// isLoopbackHost reports whether host only accepts local connections.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// validDriveName reports whether name fits the ASCII DOS name of a device
+// announce.
+func validDriveName(name string) bool {
+	if name == "" || len(name) > MaxDriveNameLength {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -1,7 +1,16 @@
 package config
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -9,10 +18,6 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func boolPtr(v bool) *bool {
-	return &v
-}
-
 func TestLoad(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -177,7 +182,7 @@ func TestLoadWithOverrides(t *testing.T) {
 			name:    "nla override false",
 			envVars: map[string]string{"USE_NLA": "true"},
 			opts: LoadOptions{
-				UseNLA: boolPtr(false),
+				Features: map[string]bool{FeatureNLA: false},
 			},
 			want: &Config{},
 		},
@@ -198,7 +203,7 @@ func TestLoadWithOverrides(t *testing.T) {
 				assert.Equal(t, tt.want.Server.Port, cfg.Server.Port)
 				assert.Equal(t, tt.want.Logging.Level, cfg.Logging.Level)
 			} else {
-				assert.False(t, cfg.Security.UseNLA)
+				assert.False(t, cfg.Features.Enabled(FeatureNLA))
 			}
 
 			// Clean up environment
@@ -538,20 +543,584 @@ func TestLoadWithOverrides_UDPFlag(t *testing.T) {
 	// Test default (UDP disabled)
 	cfg, err := LoadWithOverrides(LoadOptions{})
 	require.NoError(t, err)
-	assert.False(t, cfg.RDP.EnableUDP, "UDP should be disabled by default")
+	assert.False(t, cfg.Features.Enabled(FeatureUDP), "UDP should be disabled by default")
 
 	// Test with environment variable
 	_ = os.Setenv("RDP_ENABLE_UDP", "true")
 	cfg, err = LoadWithOverrides(LoadOptions{})
 	require.NoError(t, err)
-	assert.True(t, cfg.RDP.EnableUDP, "UDP should be enabled via env var")
+	assert.True(t, cfg.Features.Enabled(FeatureUDP), "UDP should be enabled via env var")
 	_ = os.Unsetenv("RDP_ENABLE_UDP")
 
 	// Test with CLI override (takes precedence)
 	_ = os.Setenv("RDP_ENABLE_UDP", "false")
-	udpTrue := true
-	cfg, err = LoadWithOverrides(LoadOptions{EnableUDP: &udpTrue})
+	cfg, err = LoadWithOverrides(LoadOptions{Features: map[string]bool{FeatureUDP: true}})
 	require.NoError(t, err)
-	assert.True(t, cfg.RDP.EnableUDP, "CLI flag should override env var")
+	assert.True(t, cfg.Features.Enabled(FeatureUDP), "CLI flag should override env var")
 	_ = os.Unsetenv("RDP_ENABLE_UDP")
 }
+
+func TestLoadWithOverrides_UnknownMarkerPolicy(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, UnknownMarkerPolicyDrop, cfg.Server.UnknownMarkerPolicy, "unknown markers should be dropped by default")
+
+	t.Setenv("WS_UNKNOWN_MARKER_POLICY", "CLOSE")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, UnknownMarkerPolicyClose, cfg.Server.UnknownMarkerPolicy)
+
+	t.Setenv("WS_UNKNOWN_MARKER_POLICY", "ignore")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestLoadWithOverrides_RFXMode(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, RFXModeImage, cfg.RDP.RFXMode, "RemoteFX should prefer image mode by default")
+
+	t.Setenv("RDP_RFX_MODE", "Video")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, RFXModeVideo, cfg.RDP.RFXMode)
+
+	t.Setenv("RDP_RFX_MODE", "lossless")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestLoadWithOverrides_NLAMechanism(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, NLAMechanismNTLM, cfg.RDP.NLAMechanism, "NLA should use NTLM by default")
+	assert.Equal(t, "/etc/krb5.conf", cfg.RDP.KerberosConfig)
+	assert.Empty(t, cfg.RDP.KerberosRealm)
+
+	t.Setenv("RDP_NLA_MECHANISM", "Negotiate")
+	t.Setenv("RDP_KRB5_CONFIG", "/opt/krb5/krb5.conf")
+	t.Setenv("RDP_KERBEROS_REALM", "EXAMPLE.COM")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, NLAMechanismNegotiate, cfg.RDP.NLAMechanism)
+	assert.Equal(t, "/opt/krb5/krb5.conf", cfg.RDP.KerberosConfig)
+	assert.Equal(t, "EXAMPLE.COM", cfg.RDP.KerberosRealm)
+
+	t.Setenv("RDP_NLA_MECHANISM", "digest")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestLoadWithOverrides_ClientIdentity(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Zero(t, cfg.RDP.ClientBuild, "the built-in client build should be advertised by default")
+	assert.Empty(t, cfg.RDP.ClientProductID)
+	assert.Empty(t, cfg.RDP.ClientOS)
+
+	t.Setenv("RDP_CLIENT_BUILD", "22621")
+	t.Setenv("RDP_CLIENT_PRODUCT_ID", "00330-80000-00000-AA123")
+	t.Setenv("RDP_CLIENT_OS", "Windows")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 22621, cfg.RDP.ClientBuild)
+	assert.Equal(t, "00330-80000-00000-AA123", cfg.RDP.ClientProductID)
+	assert.Equal(t, ClientOSWindows, cfg.RDP.ClientOS)
+
+	t.Setenv("RDP_CLIENT_OS", "beos")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+
+	t.Setenv("RDP_CLIENT_OS", "")
+	t.Setenv("RDP_CLIENT_PRODUCT_ID", strings.Repeat("9", MaxClientProductIDLength+1))
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+
+	t.Setenv("RDP_CLIENT_PRODUCT_ID", "")
+	t.Setenv("RDP_CLIENT_BUILD", "-1")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestLoadWithOverrides_PrimaryMonitorOnly(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.False(t, cfg.RDP.PrimaryMonitorOnly, "multi-monitor layouts should be forwarded by default")
+
+	t.Setenv("PRIMARY_MONITOR_ONLY", "true")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.True(t, cfg.RDP.PrimaryMonitorOnly)
+}
+
+func TestLoadWithOverrides_MaxDecodeWorkers(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Zero(t, cfg.RDP.MaxDecodeWorkers, "decode workers should default to GOMAXPROCS")
+
+	t.Setenv("RDP_MAX_DECODE_WORKERS", "4")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 4, cfg.RDP.MaxDecodeWorkers)
+
+	t.Setenv("RDP_MAX_DECODE_WORKERS", "-1")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestLoadWithOverrides_MaxChannels(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Zero(t, cfg.RDP.MaxChannels, "channels should default to the protocol maximum")
+
+	t.Setenv("RDP_MAX_CHANNELS", "4")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 4, cfg.RDP.MaxChannels)
+
+	for _, channels := range []string{"-1", "32"} {
+		t.Setenv("RDP_MAX_CHANNELS", channels)
+		_, err = LoadWithOverrides(LoadOptions{})
+		assert.Error(t, err, "channels %s", channels)
+	}
+}
+
+func TestLoadWithOverrides_MaxUnacknowledgedFrames(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, cfg.RDP.MaxUnacknowledgedFrames)
+
+	t.Setenv("RDP_MAX_UNACKNOWLEDGED_FRAMES", "8")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 8, cfg.RDP.MaxUnacknowledgedFrames)
+
+	t.Setenv("RDP_MAX_UNACKNOWLEDGED_FRAMES", "-1")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestLoadWithOverrides_DriveRedirection(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, cfg.RDP.DriveRoot, "no drive should be redirected by default")
+	assert.Equal(t, "SHARE", cfg.RDP.DriveName)
+
+	dir := t.TempDir()
+	t.Setenv("RDP_DRIVE_ROOT", dir)
+	t.Setenv("RDP_DRIVE_NAME", "docs")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, dir, cfg.RDP.DriveRoot)
+	assert.Equal(t, "docs", cfg.RDP.DriveName)
+
+	t.Setenv("RDP_DRIVE_NAME", "TOOLONGNAME")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+
+	t.Setenv("RDP_DRIVE_NAME", "SHARE")
+	t.Setenv("RDP_DRIVE_ROOT", filepath.Join(dir, "missing"))
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestLoadWithOverrides_FrameReorderGrace(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Zero(t, cfg.RDP.FrameReorderGrace, "frames older than the newest should be dropped by default")
+
+	t.Setenv("RDP_FRAME_REORDER_GRACE", "3")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, cfg.RDP.FrameReorderGrace)
+
+	t.Setenv("RDP_FRAME_REORDER_GRACE", "-1")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestLoadWithOverrides_ReadIdleTimeout(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Zero(t, cfg.RDP.ReadIdleTimeout, "the read idle timeout is off by default")
+
+	t.Setenv("RDP_READ_IDLE_TIMEOUT", "90s")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Second, cfg.RDP.ReadIdleTimeout)
+
+	t.Setenv("RDP_READ_IDLE_TIMEOUT", "-1s")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestLoadWithOverrides_ConnectSplash(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Zero(t, cfg.RDP.ConnectSplash, "the connect splash is off by default")
+	assert.Zero(t, cfg.RDP.HandshakeTimeout, "the handshake has no limit by default")
+
+	t.Setenv("RDP_CONNECT_SPLASH", "3s")
+	t.Setenv("RDP_HANDSHAKE_TIMEOUT", "2m")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 3*time.Second, cfg.RDP.ConnectSplash)
+	assert.Equal(t, 2*time.Minute, cfg.RDP.HandshakeTimeout)
+
+	t.Setenv("RDP_CONNECT_SPLASH", "-1s")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+
+	t.Setenv("RDP_CONNECT_SPLASH", "3s")
+	t.Setenv("RDP_HANDSHAKE_TIMEOUT", "-1s")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestLoadWithOverrides_DNSCacheTTL(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, cfg.RDP.DNSCacheTTL)
+	assert.Equal(t, 5*time.Second, cfg.RDP.DNSNegativeCacheTTL)
+
+	t.Setenv("RDP_DNS_CACHE_TTL", "0s")
+	t.Setenv("RDP_DNS_NEGATIVE_CACHE_TTL", "1m")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Zero(t, cfg.RDP.DNSCacheTTL)
+	assert.Equal(t, time.Minute, cfg.RDP.DNSNegativeCacheTTL)
+
+	t.Setenv("RDP_DNS_NEGATIVE_CACHE_TTL", "-1s")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestLoadWithOverrides_ConnectRetries(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, cfg.RDP.ConnectRetries, "transient errors should be retried once by default")
+	assert.Equal(t, time.Second, cfg.RDP.ConnectRetryBackoff)
+
+	t.Setenv("RDP_CONNECT_RETRIES", "3")
+	t.Setenv("RDP_CONNECT_RETRY_BACKOFF", "250ms")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, cfg.RDP.ConnectRetries)
+	assert.Equal(t, 250*time.Millisecond, cfg.RDP.ConnectRetryBackoff)
+
+	for _, retries := range []string{"-1", "6"} {
+		t.Setenv("RDP_CONNECT_RETRIES", retries)
+		_, err = LoadWithOverrides(LoadOptions{})
+		assert.Error(t, err, "retries %s", retries)
+	}
+
+	t.Setenv("RDP_CONNECT_RETRIES", "1")
+	t.Setenv("RDP_CONNECT_RETRY_BACKOFF", "-1s")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestLoadWithOverrides_DialRetries(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, cfg.RDP.DialTimeout)
+	assert.Zero(t, cfg.RDP.DialRetries, "failed dials should not be retried by default")
+	assert.Equal(t, 500*time.Millisecond, cfg.RDP.DialRetryBackoff)
+
+	t.Setenv("RDP_DIAL_TIMEOUT", "2s")
+	t.Setenv("RDP_DIAL_RETRIES", "2")
+	t.Setenv("RDP_DIAL_RETRY_BACKOFF", "1s")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Second, cfg.RDP.DialTimeout)
+	assert.Equal(t, 2, cfg.RDP.DialRetries)
+	assert.Equal(t, time.Second, cfg.RDP.DialRetryBackoff)
+
+	for _, retries := range []string{"-1", "6"} {
+		t.Setenv("RDP_DIAL_RETRIES", retries)
+		_, err = LoadWithOverrides(LoadOptions{})
+		assert.Error(t, err, "retries %s", retries)
+	}
+	t.Setenv("RDP_DIAL_RETRIES", "0")
+
+	for _, env := range []string{"RDP_DIAL_TIMEOUT", "RDP_DIAL_RETRY_BACKOFF"} {
+		t.Setenv(env, "-1s")
+		_, err = LoadWithOverrides(LoadOptions{})
+		assert.Error(t, err, env)
+		t.Setenv(env, "1s")
+	}
+}
+
+func TestLoadWithOverrides_BitmapCache(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.False(t, cfg.RDP.BitmapCache, "bitmap cache should be off by default")
+
+	t.Setenv("RDP_BITMAP_CACHE", "true")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.True(t, cfg.RDP.BitmapCache)
+}
+
+func TestLoadWithOverrides_DrawingOrders(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.False(t, cfg.RDP.DrawingOrders, "drawing orders should be off by default")
+
+	t.Setenv("RDP_DRAWING_ORDERS", "true")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.True(t, cfg.RDP.DrawingOrders)
+}
+
+func TestLoadWithOverrides_Gateway(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, cfg.RDP.Gateway, "connections should go direct by default")
+
+	t.Setenv("RDP_GATEWAY", "gateway.example.com:8443")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "gateway.example.com:8443", cfg.RDP.Gateway)
+}
+
+// clientKeyPairPEM returns a self-signed certificate and its key as PEM
+func clientKeyPairPEM(t *testing.T) (certPEM, keyPEM string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gateway-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+}
+
+func TestLoadWithOverrides_ClientCertificate(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	cert, err := cfg.Security.ClientCertificate()
+	require.NoError(t, err)
+	assert.Nil(t, cert, "no client certificate should be presented by default")
+
+	certPEM, keyPEM := clientKeyPairPEM(t)
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	require.NoError(t, os.WriteFile(certFile, []byte(certPEM), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, []byte(keyPEM), 0o600))
+
+	t.Run("files", func(t *testing.T) {
+		t.Setenv("TLS_CLIENT_CERT_FILE", certFile)
+		t.Setenv("TLS_CLIENT_KEY_FILE", keyFile)
+		cfg, err := LoadWithOverrides(LoadOptions{})
+		require.NoError(t, err)
+		cert, err := cfg.Security.ClientCertificate()
+		require.NoError(t, err)
+		require.NotNil(t, cert)
+		assert.Len(t, cert.Certificate, 1)
+	})
+
+	t.Run("inline", func(t *testing.T) {
+		t.Setenv("TLS_CLIENT_CERT_FILE", certPEM)
+		t.Setenv("TLS_CLIENT_KEY_FILE", keyPEM)
+		cfg, err := LoadWithOverrides(LoadOptions{})
+		require.NoError(t, err)
+		cert, err := cfg.Security.ClientCertificate()
+		require.NoError(t, err)
+		assert.NotNil(t, cert)
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		t.Setenv("TLS_CLIENT_CERT_FILE", certFile)
+		_, err := LoadWithOverrides(LoadOptions{})
+		assert.ErrorContains(t, err, "RDP client certificate: certificate and key must both be specified")
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Setenv("TLS_CLIENT_CERT_FILE", filepath.Join(dir, "absent.crt"))
+		t.Setenv("TLS_CLIENT_KEY_FILE", keyFile)
+		_, err := LoadWithOverrides(LoadOptions{})
+		assert.ErrorContains(t, err, "RDP client certificate: read certificate")
+	})
+
+	t.Run("mismatched key", func(t *testing.T) {
+		_, otherKeyPEM := clientKeyPairPEM(t)
+		t.Setenv("TLS_CLIENT_CERT_FILE", certFile)
+		t.Setenv("TLS_CLIENT_KEY_FILE", otherKeyPEM)
+		_, err := LoadWithOverrides(LoadOptions{})
+		assert.ErrorContains(t, err, "RDP client certificate: load key pair")
+	})
+}
+
+func TestLoadWithOverrides_MaxSessionDuration(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Zero(t, cfg.Security.MaxSessionDuration, "sessions should be unlimited by default")
+
+	t.Setenv("MAX_SESSION_DURATION", "8h")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 8*time.Hour, cfg.Security.MaxSessionDuration)
+
+	t.Setenv("MAX_SESSION_DURATION", "-1h")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestLoadWithOverrides_RateLimitIdleTTL(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, cfg.Security.RateLimitIdleTTL)
+
+	t.Setenv("RATE_LIMIT_IDLE_TTL", "30s")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, cfg.Security.RateLimitIdleTTL)
+
+	t.Setenv("RATE_LIMIT_IDLE_TTL", "-1s")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestLoadWithOverrides_CORSMaxAge(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, cfg.Security.CORSMaxAge)
+
+	t.Setenv("CORS_MAX_AGE", "2h")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Hour, cfg.Security.CORSMaxAge)
+
+	t.Setenv("CORS_MAX_AGE", "-1s")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestLoadWithOverrides_ShutdownTimeout(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, cfg.Server.ShutdownTimeout)
+
+	t.Setenv("SERVER_SHUTDOWN_TIMEOUT", "2m")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, cfg.Server.ShutdownTimeout)
+
+	t.Setenv("SERVER_SHUTDOWN_TIMEOUT", "-1s")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestLoadWithOverrides_HeartbeatInterval(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Zero(t, cfg.Server.HeartbeatInterval, "heartbeat should be disabled by default")
+
+	t.Setenv("WS_HEARTBEAT_INTERVAL", "25s")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 25*time.Second, cfg.Server.HeartbeatInterval)
+
+	t.Setenv("WS_HEARTBEAT_INTERVAL", "-1s")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestLoadWithOverrides_MessageSizes(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 256*1024, cfg.Server.MaxMessageSize)
+	assert.Zero(t, cfg.Server.FragmentSize, "fragmentation should be disabled by default")
+
+	t.Setenv("WS_MAX_MESSAGE_SIZE", "1048576")
+	t.Setenv("WS_FRAGMENT_SIZE", "65536")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1048576, cfg.Server.MaxMessageSize)
+	assert.Equal(t, 65536, cfg.Server.FragmentSize)
+
+	t.Setenv("WS_FRAGMENT_SIZE", "-1")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+
+	t.Setenv("WS_FRAGMENT_SIZE", "0")
+	t.Setenv("WS_MAX_MESSAGE_SIZE", "-1")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestLoadWithOverrides_AdminAddr(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Server.AdminAddr, "the admin API is off by default")
+
+	t.Setenv("ADMIN_ADDR", "127.0.0.1:9090")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:9090", cfg.Server.AdminAddr)
+	assert.Empty(t, cfg.Security.AdminToken, "loopback listeners need no token")
+
+	t.Setenv("ADMIN_ADDR", "0.0.0.0:9090")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.ErrorContains(t, err, "ADMIN_TOKEN")
+
+	t.Setenv("ADMIN_TOKEN", "s3cret")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", cfg.Security.AdminToken)
+
+	t.Setenv("ADMIN_ADDR", "9090")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err, "the address needs a port")
+}
+
+func TestLoadWithOverrides_SessionTokenTTL(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Zero(t, cfg.Security.SessionTokenTTL, "session tokens are off by default")
+
+	t.Setenv("SESSION_TOKEN_TTL", "30s")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.ErrorContains(t, err, "ADMIN_ADDR", "tokens are issued through the admin API")
+
+	t.Setenv("ADMIN_ADDR", "127.0.0.1:9090")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, cfg.Security.SessionTokenTTL)
+
+	t.Setenv("SESSION_TOKEN_TTL", "-1s")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestLoadWithOverrides_BasePath(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Server.BasePath, "routes are mounted at the root by default")
+
+	for input, want := range map[string]string{
+		"/rdp":    "/rdp",
+		"rdp/":    "/rdp",
+		"/a//b/":  "/a/b",
+		"/":       "",
+		" /rdp/ ": "/rdp",
+	} {
+		t.Setenv("BASE_PATH", input)
+		cfg, err = LoadWithOverrides(LoadOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, want, cfg.Server.BasePath, "BASE_PATH=%q", input)
+	}
+
+	t.Setenv("BASE_PATH", "/rdp?x=1")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+}
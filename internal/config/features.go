@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Feature names accepted by Features.Enabled, LoadOptions.Features and the
+// features section of the config file
+const (
+	FeatureNLA       = "nla"       // Network Level Authentication (CredSSP)
+	FeatureRFX       = "rfx"       // RemoteFX codec
+	FeatureUDP       = "udp"       // UDP multitransport (experimental)
+	FeaturePCMAudio  = "pcmAudio"  // prefer PCM audio over compressed formats
+	FeatureAudio     = "audio"     // audio output redirection
+	FeatureSnapshot  = "snapshot"  // server-side framebuffer for /snapshot
+	FeatureClipboard = "clipboard" // clipboard text sync over cliprdr
+)
+
+// featureDef describes a feature toggle and where its value comes from
+type featureDef struct {
+	name         string
+	env          string
+	defaultValue bool
+}
+
+// featureDefs lists every feature toggle. NLA, RFX, audio and clipboard are
+// on by default; UDP is experimental, compressed audio saves bandwidth and
+// snapshots cost memory and CPU per session, so those are off.
+var featureDefs = []featureDef{
+	{name: FeatureNLA, env: "USE_NLA", defaultValue: true},
+	{name: FeatureRFX, env: "RDP_ENABLE_RFX", defaultValue: true},
+	{name: FeatureUDP, env: "RDP_ENABLE_UDP", defaultValue: false},
+	{name: FeaturePCMAudio, env: "RDP_PREFER_PCM_AUDIO", defaultValue: false},
+	{name: FeatureAudio, env: "ENABLE_AUDIO", defaultValue: true},
+	{name: FeatureSnapshot, env: "ENABLE_SNAPSHOTS", defaultValue: false},
+	{name: FeatureClipboard, env: "ENABLE_CLIPBOARD", defaultValue: true},
+}
+
+// Features holds the resolved state of the feature toggles. The zero value
+// reports every feature at its default.
+type Features struct {
+	enabled map[string]bool
+}
+
+// Enabled reports whether the named feature is on. Unknown names are off.
+func (f Features) Enabled(name string) bool {
+	if v, ok := f.enabled[name]; ok {
+		return v
+	}
+	def, ok := lookupFeature(name)
+	return ok && def.defaultValue
+}
+
+// lookupFeature returns the definition of the named feature
+func lookupFeature(name string) (featureDef, bool) {
+	for _, def := range featureDefs {
+		if def.name == name {
+			return def, true
+		}
+	}
+	return featureDef{}, false
+}
+
+// checkFeatureNames rejects names that are not known features
+func checkFeatureNames(values map[string]bool) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := lookupFeature(name); !ok {
+			return fmt.Errorf("unknown feature %q", name)
+		}
+	}
+	return nil
+}
+
+// resolveFeatures merges the feature toggles from every source. Each source
+// overrides the previous one: default, config file, environment variable and
+// finally command-line flag.
+func resolveFeatures(file, flags map[string]bool) (Features, error) {
+	if err := checkFeatureNames(flags); err != nil {
+		return Features{}, err
+	}
+
+	enabled := make(map[string]bool, len(featureDefs))
+	for _, def := range featureDefs {
+		value := def.defaultValue
+		if v, ok := file[def.name]; ok {
+			value = v
+		}
+		value = getBoolWithDefault(def.env, value)
+		if v, ok := flags[def.name]; ok {
+			value = v
+		}
+		enabled[def.name] = value
+	}
+	return Features{enabled: enabled}, nil
+}
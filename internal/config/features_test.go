@@ -0,0 +1,83 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeatures_Defaults(t *testing.T) {
+	for _, def := range featureDefs {
+		t.Setenv(def.env, "")
+	}
+
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.True(t, cfg.Features.Enabled(FeatureNLA))
+	assert.True(t, cfg.Features.Enabled(FeatureRFX))
+	assert.False(t, cfg.Features.Enabled(FeatureUDP))
+	assert.False(t, cfg.Features.Enabled(FeaturePCMAudio))
+	assert.True(t, cfg.Features.Enabled(FeatureAudio))
+	assert.False(t, cfg.Features.Enabled(FeatureSnapshot))
+	assert.True(t, cfg.Features.Enabled(FeatureClipboard))
+	assert.False(t, cfg.Features.Enabled("bogus"))
+
+	// The zero value reports the same defaults
+	var zero Features
+	for _, def := range featureDefs {
+		assert.Equal(t, def.defaultValue, zero.Enabled(def.name), def.name)
+	}
+}
+
+func TestFeatures_MergePrecedence(t *testing.T) {
+	file := writeConfigFile(t, "features.yaml", `
+features:
+  nla: false
+  rfx: false
+  udp: true
+  pcmAudio: true
+`)
+
+	tests := []struct {
+		name    string
+		feature string
+		env     map[string]string
+		flags   map[string]bool
+		want    bool
+	}{
+		{"file overrides default", FeatureNLA, nil, nil, false},
+		{"env overrides file", FeatureNLA, map[string]string{"USE_NLA": "true"}, nil, true},
+		{"flag overrides env", FeatureNLA, map[string]string{"USE_NLA": "true"}, map[string]bool{FeatureNLA: false}, false},
+		{"file disables rfx", FeatureRFX, nil, nil, false},
+		{"flag overrides file", FeatureRFX, nil, map[string]bool{FeatureRFX: true}, true},
+		{"file enables udp", FeatureUDP, nil, nil, true},
+		{"env disables udp", FeatureUDP, map[string]string{"RDP_ENABLE_UDP": "false"}, nil, false},
+		{"invalid env keeps file value", FeaturePCMAudio, map[string]string{"RDP_PREFER_PCM_AUDIO": "maybe"}, nil, true},
+		{"flag overrides env and file", FeaturePCMAudio, map[string]string{"RDP_PREFER_PCM_AUDIO": "true"}, map[string]bool{FeaturePCMAudio: false}, false},
+		{"env disables audio", FeatureAudio, map[string]string{"ENABLE_AUDIO": "false"}, nil, false},
+		{"env enables snapshots", FeatureSnapshot, map[string]string{"ENABLE_SNAPSHOTS": "true"}, nil, true},
+		{"env disables clipboard", FeatureClipboard, map[string]string{"ENABLE_CLIPBOARD": "false"}, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, def := range featureDefs {
+				t.Setenv(def.env, tt.env[def.env])
+			}
+
+			cfg, err := LoadWithOverrides(LoadOptions{ConfigFile: file, Features: tt.flags})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cfg.Features.Enabled(tt.feature))
+		})
+	}
+}
+
+func TestFeatures_UnknownNames(t *testing.T) {
+	_, err := LoadWithOverrides(LoadOptions{Features: map[string]bool{"rfxx": true}})
+	assert.ErrorContains(t, err, `unknown feature "rfxx"`)
+
+	path := writeConfigFile(t, "features.json", `{"features": {"sound": true}}`)
+	_, err = LoadWithOverrides(LoadOptions{ConfigFile: path})
+	assert.ErrorContains(t, err, `unknown feature "sound"`)
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// HostProfile overrides connection settings for one RDP target host.
+// Unset fields keep the server-wide value.
+type HostProfile struct {
+	UseNLA            *bool  `json:"useNLA,omitempty" yaml:"useNLA,omitempty"`
+	EnableRFX         *bool  `json:"enableRFX,omitempty" yaml:"enableRFX,omitempty"`
+	RFXMode           string `json:"rfxMode,omitempty" yaml:"rfxMode,omitempty"`
+	SkipTLSValidation *bool  `json:"skipTLSValidation,omitempty" yaml:"skipTLSValidation,omitempty"`
+	TLSServerName     string `json:"tlsServerName,omitempty" yaml:"tlsServerName,omitempty"`
+}
+
+// fileConfig is the layout of the configuration file named by CONFIG_FILE.
+type fileConfig struct {
+	Features map[string]bool        `json:"features" yaml:"features"`
+	Hosts    map[string]HostProfile `json:"hosts" yaml:"hosts"`
+}
+
+// loadConfigFile reads a YAML or JSON configuration file. Files ending in
+// .json are parsed as JSON, anything else as YAML. Unknown fields are
+// rejected so that typos in setting names do not go unnoticed.
+func loadConfigFile(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path is supplied by the operator
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var fc fileConfig
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&fc)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&fc)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	if err := checkFeatureNames(fc.Features); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	hosts, err := normalizeHostProfiles(fc.Hosts)
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	fc.Hosts = hosts
+	return &fc, nil
+}
+
+// normalizeHostProfiles lowercases and trims profile host names, rejecting
+// empty names and names that collide once normalized.
+func normalizeHostProfiles(hosts map[string]HostProfile) (map[string]HostProfile, error) {
+	if len(hosts) == 0 {
+		return nil, nil
+	}
+	normalized := make(map[string]HostProfile, len(hosts))
+	for name, profile := range hosts {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if key == "" {
+			return nil, errors.New("host profile name cannot be empty")
+		}
+		if _, exists := normalized[key]; exists {
+			return nil, fmt.Errorf("duplicate host profile: %s", name)
+		}
+		profile.RFXMode = strings.ToLower(strings.TrimSpace(profile.RFXMode))
+		normalized[key] = profile
+	}
+	return normalized, nil
+}
+
+// ProfileFor returns the profile configured for an RDP target host. The
+// host may include a port; a profile for the exact host:port is preferred
+// over one for the bare host name. Matching is case-insensitive.
+func (c *Config) ProfileFor(host string) (HostProfile, bool) {
+	if c == nil || len(c.Hosts) == 0 {
+		return HostProfile{}, false
+	}
+
+	host = strings.ToLower(strings.TrimSpace(host))
+	if profile, ok := c.Hosts[host]; ok {
+		return profile, true
+	}
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		if profile, ok := c.Hosts[name]; ok {
+			return profile, true
+		}
+	}
+	return HostProfile{}, false
+}
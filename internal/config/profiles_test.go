@@ -0,0 +1,158 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeConfigFile writes content to a file with the given name in a
+// temporary directory and returns its path.
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadConfigFile_YAML(t *testing.T) {
+	path := writeConfigFile(t, "hosts.yaml", `
+hosts:
+  Legacy.Example.com:
+    useNLA: false
+    skipTLSValidation: true
+  rdp.example.com:3390:
+    enableRFX: false
+    tlsServerName: rdp.internal
+  cad.example.com:
+    rfxMode: Video
+`)
+
+	fc, err := loadConfigFile(path)
+	require.NoError(t, err)
+	require.Len(t, fc.Hosts, 3)
+
+	legacy := fc.Hosts["legacy.example.com"]
+	require.NotNil(t, legacy.UseNLA)
+	assert.False(t, *legacy.UseNLA)
+	require.NotNil(t, legacy.SkipTLSValidation)
+	assert.True(t, *legacy.SkipTLSValidation)
+	assert.Nil(t, legacy.EnableRFX)
+
+	rdp := fc.Hosts["rdp.example.com:3390"]
+	require.NotNil(t, rdp.EnableRFX)
+	assert.False(t, *rdp.EnableRFX)
+	assert.Equal(t, "rdp.internal", rdp.TLSServerName)
+
+	assert.Equal(t, RFXModeVideo, fc.Hosts["cad.example.com"].RFXMode)
+}
+
+func TestLoadConfigFile_JSON(t *testing.T) {
+	path := writeConfigFile(t, "hosts.json", `{"hosts": {"win2012": {"useNLA": false}}}`)
+
+	fc, err := loadConfigFile(path)
+	require.NoError(t, err)
+	require.Contains(t, fc.Hosts, "win2012")
+	assert.False(t, *fc.Hosts["win2012"].UseNLA)
+}
+
+func TestLoadConfigFile_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"unknown YAML profile field", "hosts.yaml", "hosts:\n  a:\n    useNla: false\n"},
+		{"unknown YAML section", "hosts.yaml", "servers: {}\n"},
+		{"unknown JSON profile field", "hosts.json", `{"hosts": {"a": {"enableUDP": true}}}`},
+		{"malformed JSON", "hosts.json", `{"hosts": `},
+		{"wrong type", "hosts.yaml", "hosts:\n  a:\n    useNLA: maybe\n"},
+		{"empty host name", "hosts.yaml", "hosts:\n  \" \":\n    useNLA: false\n"},
+		{"duplicate host name", "hosts.yaml", "hosts:\n  A:\n    useNLA: false\n  a:\n    useNLA: true\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadConfigFile(writeConfigFile(t, tt.file, tt.content))
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := loadConfigFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+
+	// An empty file has no profiles
+	fc, err := loadConfigFile(writeConfigFile(t, "empty.yaml", ""))
+	require.NoError(t, err)
+	assert.Empty(t, fc.Hosts)
+}
+
+func TestLoadWithOverrides_ConfigFile(t *testing.T) {
+	path := writeConfigFile(t, "hosts.yaml", "hosts:\n  legacy:\n    useNLA: false\n")
+
+	cfg, err := LoadWithOverrides(LoadOptions{ConfigFile: path})
+	require.NoError(t, err)
+	_, ok := cfg.ProfileFor("legacy")
+	assert.True(t, ok)
+
+	t.Setenv("CONFIG_FILE", path)
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Len(t, cfg.Hosts, 1)
+
+	t.Setenv("CONFIG_FILE", writeConfigFile(t, "bad.yaml", "hosts:\n  legacy:\n    nla: false\n"))
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+}
+
+func TestProfileFor(t *testing.T) {
+	noNLA := false
+	cfg := &Config{Hosts: map[string]HostProfile{
+		"legacy.example.com":      {UseNLA: &noNLA},
+		"legacy.example.com:3390": {TLSServerName: "alt"},
+	}}
+
+	profile, ok := cfg.ProfileFor("Legacy.Example.com")
+	require.True(t, ok)
+	assert.Same(t, &noNLA, profile.UseNLA)
+
+	// The bare host name matches any port without a more specific profile
+	profile, ok = cfg.ProfileFor("legacy.example.com:3389")
+	require.True(t, ok)
+	assert.NotNil(t, profile.UseNLA)
+
+	profile, ok = cfg.ProfileFor("legacy.example.com:3390")
+	require.True(t, ok)
+	assert.Equal(t, "alt", profile.TLSServerName)
+
+	_, ok = cfg.ProfileFor("other.example.com")
+	assert.False(t, ok)
+
+	_, ok = (&Config{}).ProfileFor("legacy.example.com")
+	assert.False(t, ok)
+}
+
+func TestValidate_HostProfileNames(t *testing.T) {
+	cfg, err := Load()
+	require.NoError(t, err)
+
+	cfg.Hosts = map[string]HostProfile{"Upper.Example.com": {}}
+	assert.Error(t, cfg.Validate())
+
+	cfg.Hosts = map[string]HostProfile{"lower.example.com": {}}
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidate_HostProfileRFXMode(t *testing.T) {
+	cfg, err := Load()
+	require.NoError(t, err)
+
+	cfg.Hosts = map[string]HostProfile{"cad.example.com": {RFXMode: RFXModeVideo}}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Hosts = map[string]HostProfile{"cad.example.com": {RFXMode: "lossless"}}
+	assert.Error(t, cfg.Validate())
+}
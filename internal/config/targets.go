@@ -0,0 +1,170 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// ErrTargetNotAllowed is returned for an RDP target the target policy refuses
+var ErrTargetNotAllowed = errors.New("target not allowed")
+
+// TargetPolicy decides which RDP hosts sessions may connect to, from the
+// ALLOWED_TARGETS and DENIED_TARGETS lists and BLOCK_PRIVATE_TARGETS.
+//
+// A rule is an IP address, a CIDR prefix, a host name or a "*.example.com"
+// pattern matching any subdomain. Denied rules always win. When allowed
+// rules are set, a target must match one of them. With private targets
+// blocked, loopback, private, link-local and unspecified addresses are
+// refused unless an allowed rule names them.
+type TargetPolicy struct {
+	allowed      []targetRule
+	denied       []targetRule
+	blockPrivate bool
+}
+
+// targetRule matches a host name or an address prefix
+type targetRule struct {
+	prefix   netip.Prefix
+	host     string
+	wildcard bool
+}
+
+// TargetPolicy parses the target allow and deny lists.
+func (s *SecurityConfig) TargetPolicy() (*TargetPolicy, error) {
+	p := &TargetPolicy{blockPrivate: s.BlockPrivateTargets}
+	var err error
+	if p.allowed, err = parseTargetRules(s.AllowedTargets); err != nil {
+		return nil, fmt.Errorf("invalid allowed target: %w", err)
+	}
+	if p.denied, err = parseTargetRules(s.DeniedTargets); err != nil {
+		return nil, fmt.Errorf("invalid denied target: %w", err)
+	}
+	return p, nil
+}
+
+func parseTargetRules(entries []string) ([]targetRule, error) {
+	var rules []targetRule
+	for _, entry := range entries {
+		rule, err := parseTargetRule(entry)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func parseTargetRule(entry string) (targetRule, error) {
+	entry = strings.TrimSpace(entry)
+	if prefix, err := netip.ParsePrefix(entry); err == nil {
+		return targetRule{prefix: prefix.Masked()}, nil
+	}
+	if addr, err := netip.ParseAddr(entry); err == nil {
+		addr = addr.Unmap()
+		return targetRule{prefix: netip.PrefixFrom(addr, addr.BitLen())}, nil
+	}
+
+	host := normalizeTargetHost(entry)
+	rule := targetRule{host: host}
+	if rest, ok := strings.CutPrefix(host, "*."); ok {
+		rule = targetRule{host: rest, wildcard: true}
+	}
+	if rule.host == "" || strings.ContainsAny(rule.host, "*/: ") {
+		return targetRule{}, fmt.Errorf("%q is not an address, CIDR prefix or host name", entry)
+	}
+	return rule, nil
+}
+
+// normalizeTargetHost lowercases a host name and drops any trailing dot
+func normalizeTargetHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+func (r targetRule) matchesHost(host string) bool {
+	if r.host == "" || host == "" {
+		return false
+	}
+	if r.wildcard {
+		return strings.HasSuffix(host, "."+r.host)
+	}
+	return host == r.host
+}
+
+func (r targetRule) matchesAddr(addr netip.Addr) bool {
+	return r.prefix.IsValid() && addr.IsValid() && r.prefix.Contains(addr)
+}
+
+// Active reports whether the policy restricts targets at all
+func (p *TargetPolicy) Active() bool {
+	return len(p.allowed) > 0 || len(p.denied) > 0 || p.blockPrivate
+}
+
+// NeedsAddresses reports whether deciding on host takes its resolved
+// addresses, rather than its name alone
+func (p *TargetPolicy) NeedsAddresses(host string) bool {
+	host = normalizeTargetHost(host)
+	if hasPrefixRule(p.denied) {
+		return true
+	}
+	if matchesHost(p.allowed, host) {
+		return false
+	}
+	return hasPrefixRule(p.allowed) || p.blockPrivate
+}
+
+// Check decides on a connection to host at addr. host is empty for a target
+// given as an address, and addr is the zero Addr when host was not resolved.
+// A refusal wraps ErrTargetNotAllowed.
+func (p *TargetPolicy) Check(host string, addr netip.Addr) error {
+	host = normalizeTargetHost(host)
+	addr = addr.Unmap().WithZone("")
+
+	if matchesHost(p.denied, host) || matchesAddr(p.denied, addr) {
+		return fmt.Errorf("%w: denied by policy", ErrTargetNotAllowed)
+	}
+
+	allowed := matchesHost(p.allowed, host) || matchesAddr(p.allowed, addr)
+	if len(p.allowed) > 0 && !allowed {
+		return fmt.Errorf("%w: not in the allowed targets", ErrTargetNotAllowed)
+	}
+	if p.blockPrivate && !allowed && addr.IsValid() && isPrivateTarget(addr) {
+		return fmt.Errorf("%w: private address %s", ErrTargetNotAllowed, addr)
+	}
+	return nil
+}
+
+// isPrivateTarget reports whether addr is on the gateway itself or a
+// private or link-local network
+func isPrivateTarget(addr netip.Addr) bool {
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsUnspecified()
+}
+
+func hasPrefixRule(rules []targetRule) bool {
+	for _, r := range rules {
+		if r.prefix.IsValid() {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesHost(rules []targetRule, host string) bool {
+	for _, r := range rules {
+		if r.matchesHost(host) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAddr(rules []targetRule, addr netip.Addr) bool {
+	for _, r := range rules {
+		if r.matchesAddr(addr) {
+			return true
+		}
+	}
+	return false
+}
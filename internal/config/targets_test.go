@@ -0,0 +1,108 @@
+package config
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func targetPolicy(t *testing.T, allowed, denied []string, blockPrivate bool) *TargetPolicy {
+	t.Helper()
+	s := &SecurityConfig{AllowedTargets: allowed, DeniedTargets: denied, BlockPrivateTargets: blockPrivate}
+	p, err := s.TargetPolicy()
+	require.NoError(t, err)
+	return p
+}
+
+func TestTargetPolicy_CIDRMatching(t *testing.T) {
+	p := targetPolicy(t, []string{"10.1.0.0/16", "2001:db8::/32", "192.0.2.7"}, []string{"10.1.99.0/24"}, false)
+
+	for _, addr := range []string{"10.1.0.1", "10.1.255.254", "::ffff:10.1.2.3", "2001:db8::1", "192.0.2.7", "fe80::1%eth0"} {
+		err := p.Check("", netip.MustParseAddr(addr))
+		if addr == "fe80::1%eth0" {
+			assert.ErrorIs(t, err, ErrTargetNotAllowed, addr)
+			continue
+		}
+		assert.NoError(t, err, addr)
+	}
+	for _, addr := range []string{"10.2.0.1", "192.0.2.8", "2001:db9::1", "10.1.99.5"} {
+		assert.ErrorIs(t, p.Check("", netip.MustParseAddr(addr)), ErrTargetNotAllowed, addr)
+	}
+
+	// A name resolving into an allowed prefix is allowed by its address
+	assert.NoError(t, p.Check("rdp.example.com", netip.MustParseAddr("10.1.0.5")))
+	assert.True(t, p.NeedsAddresses("rdp.example.com"))
+}
+
+func TestTargetPolicy_HostnameMatching(t *testing.T) {
+	p := targetPolicy(t, []string{"RDP.example.com", "*.corp.example"}, []string{"secret.corp.example."}, false)
+
+	for _, host := range []string{"rdp.example.com", "rdp.example.com.", "Desk01.CORP.example", "a.b.corp.example"} {
+		assert.NoError(t, p.Check(host, netip.Addr{}), host)
+	}
+	for _, host := range []string{"other.example.com", "corp.example", "evilcorp.example", "secret.corp.example", ""} {
+		assert.ErrorIs(t, p.Check(host, netip.Addr{}), ErrTargetNotAllowed, host)
+	}
+
+	// Names alone decide without address rules
+	assert.False(t, p.NeedsAddresses("rdp.example.com"))
+	assert.False(t, p.NeedsAddresses("other.example.com"))
+}
+
+func TestTargetPolicy_BlockPrivate(t *testing.T) {
+	private := []string{"127.0.0.1", "::1", "10.0.0.1", "172.16.5.4", "192.168.1.1", "169.254.169.254", "fe80::1", "fd00::1", "0.0.0.0"}
+	public := netip.MustParseAddr("203.0.113.10")
+
+	open := targetPolicy(t, nil, nil, false)
+	assert.False(t, open.Active())
+	for _, addr := range private {
+		assert.NoError(t, open.Check("", netip.MustParseAddr(addr)), addr)
+	}
+
+	blocked := targetPolicy(t, nil, nil, true)
+	assert.True(t, blocked.Active())
+	assert.True(t, blocked.NeedsAddresses("rdp.example.com"))
+	for _, addr := range private {
+		assert.ErrorIs(t, blocked.Check("", netip.MustParseAddr(addr)), ErrTargetNotAllowed, addr)
+	}
+	assert.NoError(t, blocked.Check("rdp.example.com", public))
+
+	// Allowed rules open holes in the private ranges
+	holes := targetPolicy(t, []string{"192.168.1.0/24", "lab.internal", "203.0.113.0/24"}, nil, true)
+	assert.NoError(t, holes.Check("", netip.MustParseAddr("192.168.1.20")))
+	assert.NoError(t, holes.Check("lab.internal", netip.MustParseAddr("10.9.9.9")))
+	assert.False(t, holes.NeedsAddresses("lab.internal"))
+	assert.ErrorIs(t, holes.Check("", netip.MustParseAddr("10.9.9.9")), ErrTargetNotAllowed)
+}
+
+func TestTargetPolicy_InvalidRules(t *testing.T) {
+	for _, entry := range []string{"10.0.0.0/33", "*", "*.", "host:3389", "a*b.example", "http://x"} {
+		_, err := (&SecurityConfig{AllowedTargets: []string{entry}}).TargetPolicy()
+		assert.Error(t, err, entry)
+		_, err = (&SecurityConfig{DeniedTargets: []string{entry}}).TargetPolicy()
+		assert.Error(t, err, entry)
+	}
+}
+
+func TestLoadWithOverrides_Targets(t *testing.T) {
+	cfg, err := LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Security.AllowedTargets)
+	assert.Empty(t, cfg.Security.DeniedTargets)
+	assert.False(t, cfg.Security.BlockPrivateTargets, "private targets should be allowed by default")
+
+	t.Setenv("ALLOWED_TARGETS", "10.0.0.0/8, *.corp.example")
+	t.Setenv("DENIED_TARGETS", "10.0.0.1")
+	t.Setenv("BLOCK_PRIVATE_TARGETS", "true")
+	cfg, err = LoadWithOverrides(LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.0/8", "*.corp.example"}, cfg.Security.AllowedTargets)
+	assert.Equal(t, []string{"10.0.0.1"}, cfg.Security.DeniedTargets)
+	assert.True(t, cfg.Security.BlockPrivateTargets)
+
+	t.Setenv("DENIED_TARGETS", "10.0.0.0/99")
+	_, err = LoadWithOverrides(LoadOptions{})
+	assert.Error(t, err)
+}
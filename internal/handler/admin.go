@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// reasonAdminTerminated is reported in the session summary when an operator
+// ends a session through the admin API.
+const reasonAdminTerminated = "admin_terminated"
+
+// SessionInfo describes an active session for the admin API.
+type SessionInfo struct {
+	ID         string    `json:"id"`
+	ClientAddr string    `json:"clientAddr"`
+	Target     string    `json:"target,omitempty"`
+	Started    time.Time `json:"started"`
+	DurationMs int64     `json:"durationMs"`
+	BytesIn    int64     `json:"bytesIn"`
+	BytesOut   int64     `json:"bytesOut"`
+	Frames     int64     `json:"frames"`
+}
+
+// describe records what the admin API reports about a session and the
+// function that ends it on request.
+func (d *sessionDrain) describe(session *drainSession, clientAddr string, stats *sessionStats, kill func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	session.clientAddr = clientAddr
+	session.stats = stats
+	session.kill = kill
+}
+
+// setTarget records the RDP host a session connects to, once known.
+func (d *sessionDrain) setTarget(session *drainSession, target string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	session.target = target
+}
+
+// list returns the active sessions, oldest first.
+func (d *sessionDrain) list(now time.Time) []SessionInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sessions := make([]SessionInfo, 0, len(d.sessions))
+	for session := range d.sessions {
+		info := SessionInfo{
+			ID:         session.id,
+			ClientAddr: session.clientAddr,
+			Target:     session.target,
+			Started:    session.start,
+			DurationMs: now.Sub(session.start).Milliseconds(),
+		}
+		if session.stats != nil {
+			info.BytesIn = session.stats.bytesIn.Load()
+			info.BytesOut = session.stats.bytesOut.Load()
+			info.Frames = session.stats.frames.Load()
+		}
+		sessions = append(sessions, info)
+	}
+	slices.SortFunc(sessions, func(a, b SessionInfo) int {
+		return a.Started.Compare(b.Started)
+	})
+	return sessions
+}
+
+// kill ends the session with the given ID. It returns false if no active
+// session has that ID or the session cannot be ended yet.
+func (d *sessionDrain) kill(id string) bool {
+	d.mu.Lock()
+	var kill func()
+	for session := range d.sessions {
+		if session.id == id {
+			kill = session.kill
+			break
+		}
+	}
+	d.mu.Unlock()
+
+	if kill == nil {
+		return false
+	}
+	kill()
+	return true
+}
+
+// ListSessions serves GET /admin/sessions: the active sessions with their
+// client address, target, duration and byte counts, as JSON.
+func ListSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(struct {
+		Sessions []SessionInfo `json:"sessions"`
+	}{activeSessions.list(time.Now())})
+}
+
+// TerminateSession serves DELETE /admin/sessions/{id}: it ends the session
+// by cancelling its context and answers 204, or 404 if there is no such
+// session.
+func TerminateSession(w http.ResponseWriter, r *http.Request) {
+	if !activeSessions.kill(r.PathValue("id")) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
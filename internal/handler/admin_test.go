@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newAdminMux routes the admin handlers as cmd/server does.
+func newAdminMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/sessions", ListSessions)
+	mux.HandleFunc("DELETE /admin/sessions/{id}", TerminateSession)
+	return mux
+}
+
+func TestAdminSessions_ListAndTerminate(t *testing.T) {
+	saved := activeSessions
+	activeSessions = newSessionDrain()
+	defer func() { activeSessions = saved }()
+
+	session, ok := activeSessions.add()
+	require.True(t, ok)
+	stats := newSessionStats(session.start)
+	stats.received(100)
+	stats.sent(2500)
+	killed := make(chan struct{})
+	activeSessions.describe(session, "192.0.2.10", stats, func() { close(killed) })
+	activeSessions.setTarget(session, "desktop.example:3389")
+
+	// A session still receiving credentials is listed without a target
+	_, ok = activeSessions.add()
+	require.True(t, ok)
+
+	mux := newAdminMux()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/sessions", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var body struct {
+		Sessions []SessionInfo `json:"sessions"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Len(t, body.Sessions, 2)
+	listed := body.Sessions[0]
+	assert.Equal(t, session.id, listed.ID)
+	assert.Equal(t, "192.0.2.10", listed.ClientAddr)
+	assert.Equal(t, "desktop.example:3389", listed.Target)
+	assert.Equal(t, int64(100), listed.BytesIn)
+	assert.Equal(t, int64(2500), listed.BytesOut)
+	assert.Equal(t, int64(1), listed.Frames)
+	assert.GreaterOrEqual(t, listed.DurationMs, int64(0))
+	assert.Empty(t, body.Sessions[1].Target)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/sessions/"+session.id, nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	select {
+	case <-killed:
+	case <-time.After(time.Second):
+		t.Fatal("session was not terminated")
+	}
+}
+
+func TestAdminSessions_TerminateUnknown(t *testing.T) {
+	saved := activeSessions
+	activeSessions = newSessionDrain()
+	defer func() { activeSessions = saved }()
+
+	// Sessions that are not described yet cannot be ended
+	session, ok := activeSessions.add()
+	require.True(t, ok)
+
+	mux := newAdminMux()
+	for _, id := range []string{"missing", session.id} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/sessions/"+id, nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code, id)
+	}
+}
+
+func TestSessionDrain_Kill(t *testing.T) {
+	d := newSessionDrain()
+	session, ok := d.add()
+	require.True(t, ok)
+
+	stats := newSessionStats(time.Now())
+	d.describe(session, "198.51.100.7", stats, func() { stats.ended(reasonAdminTerminated) })
+	require.True(t, d.kill(session.id))
+	assert.Equal(t, reasonAdminTerminated, stats.disconnectReason())
+
+	d.remove(session)
+	assert.False(t, d.kill(session.id), "ended sessions are gone")
+	assert.Empty(t, d.list(time.Now()))
+}
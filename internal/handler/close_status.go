@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/rcarmo/go-rdp/internal/config"
+	"github.com/rcarmo/go-rdp/internal/rdp"
+)
+
+// WebSocket close codes in the private range (RFC 6455 7.4.2) telling the
+// browser why a session ended, so it can decide whether to reconnect.
+const (
+	// closeStatusLogoff is sent when the RDP server logs off or ends the session
+	closeStatusLogoff = 4000
+
+	// closeStatusAuthFailed is sent when the RDP server rejects the credentials
+	closeStatusAuthFailed = 4001
+
+	// closeStatusHostUnreachable is sent when the RDP host cannot be reached
+	// or the connection sequence fails
+	closeStatusHostUnreachable = 4002
+
+	// closeStatusPolicyRejected is sent when gateway policy refuses or ends
+	// the session, such as invalid parameters, a disallowed target or the
+	// maximum session duration
+	closeStatusPolicyRejected = 4003
+
+	// closeStatusIdleTimeout is sent when the browser stops sending data
+	closeStatusIdleTimeout = 4004
+)
+
+// connectFailureStatus returns the close code for a failure to dial or
+// connect to the RDP host.
+func connectFailureStatus(err error) int {
+	switch {
+	case errors.Is(err, rdp.ErrAuthenticationFailed):
+		return closeStatusAuthFailed
+	case errors.Is(err, config.ErrTargetNotAllowed):
+		return closeStatusPolicyRejected
+	}
+	return closeStatusHostUnreachable
+}
+
+// connectFailureReason returns the close reason for a failure to dial or
+// connect to the RDP host, or "" when the close code says enough.
+func connectFailureReason(err error) string {
+	var dialErr *rdp.DialError
+	switch {
+	case errors.Is(err, config.ErrTargetNotAllowed):
+		return "target not allowed"
+	case errors.As(err, &dialErr):
+		return fmt.Sprintf("host unreachable after %d attempts", dialErr.Attempts)
+	case errors.Is(err, rdp.ErrHandshakeTimeout) || errors.Is(err, context.DeadlineExceeded) || isTimeout(err):
+		return "connection timed out"
+	default:
+		return ""
+	}
+}
+
+// closeCodec sends a close frame carrying a status and a reason, which
+// websocket.Conn.WriteClose cannot.
+var closeCodec = websocket.Codec{
+	Marshal: func(v any) ([]byte, byte, error) {
+		frame, ok := v.([]byte)
+		if !ok {
+			return nil, 0, fmt.Errorf("close frame: unexpected %T", v)
+		}
+		return frame, websocket.CloseFrame, nil
+	},
+}
+
+// maxCloseReason is the longest reason that fits a close frame's 125-byte
+// payload after the status (RFC 6455 5.5).
+const maxCloseReason = 123
+
+// writeCloseReason sends a close frame carrying status and, when set, reason.
+func writeCloseReason(wsConn *websocket.Conn, status int, reason string) error {
+	if reason == "" {
+		return wsConn.WriteClose(status)
+	}
+	if len(reason) > maxCloseReason {
+		reason = reason[:maxCloseReason]
+	}
+	frame := binary.BigEndian.AppendUint16(nil, uint16(status)) // #nosec G115 -- close codes are below 5000
+	return closeCodec.Send(wsConn, append(frame, reason...))
+}
+
+// isTimeout reports whether err is a network timeout.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// writeCloseWithMutex sends a close frame carrying status, serialized with
+// other writes on the connection.
+func writeCloseWithMutex(wsConn *websocket.Conn, wsMu *sync.Mutex, status int) {
+	wsMu.Lock()
+	defer wsMu.Unlock()
+	_ = wsConn.WriteClose(status)
+}
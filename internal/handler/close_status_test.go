@@ -0,0 +1,318 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/rcarmo/go-rdp/internal/config"
+	"github.com/rcarmo/go-rdp/internal/protocol/mcs"
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+	"github.com/rcarmo/go-rdp/internal/rdp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingConn keeps a copy of everything read from the server
+type recordingConn struct {
+	net.Conn
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (c *recordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.mu.Lock()
+	c.buf.Write(p[:n])
+	c.mu.Unlock()
+	return n, err
+}
+
+// dialRecording opens a WebSocket to path on the test server at url whose
+// raw server bytes are recorded
+func dialRecording(t *testing.T, url, path string) (*websocket.Conn, *recordingConn) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	rec := &recordingConn{Conn: conn}
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(url, "http")+path, "http://localhost/")
+	require.NoError(t, err)
+	ws, err := websocket.NewClient(config, rec)
+	require.NoError(t, err)
+	return ws, rec
+}
+
+// readCloseStatus reads until the server closes the WebSocket and returns the
+// status code of the first close frame it sent
+func readCloseStatus(t *testing.T, ws *websocket.Conn, rec *recordingConn) int {
+	t.Helper()
+	status, _ := readCloseFrame(t, ws, rec)
+	return status
+}
+
+// readCloseFrame reads until the server closes the WebSocket and returns the
+// status code and reason of the first close frame it sent
+func readCloseFrame(t *testing.T, ws *websocket.Conn, rec *recordingConn) (int, string) {
+	t.Helper()
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for {
+		var msg []byte
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
+			break
+		}
+	}
+
+	rec.mu.Lock()
+	data := rec.buf.Bytes()
+	rec.mu.Unlock()
+
+	end := bytes.Index(data, []byte("\r\n\r\n"))
+	require.GreaterOrEqual(t, end, 0, "handshake response not found")
+	frames := data[end+4:]
+	for len(frames) >= 2 {
+		opcode := frames[0] & 0x0F
+		length, header := int(frames[1]&0x7F), 2
+		switch length {
+		case 126:
+			length, header = int(binary.BigEndian.Uint16(frames[2:])), 4
+		case 127:
+			length, header = int(binary.BigEndian.Uint64(frames[2:])), 10 // #nosec G115
+		}
+		if opcode == 0x8 {
+			require.GreaterOrEqual(t, length, 2, "close frame without status")
+			return int(binary.BigEndian.Uint16(frames[header:])), string(frames[header+2 : header+length])
+		}
+		frames = frames[header+length:]
+	}
+	t.Fatal("no close frame received")
+	return 0, ""
+}
+
+// connectAndSendCredentials opens a session against Connect and sends credentials for host
+func connectAndSendCredentials(t *testing.T, host string) (*websocket.Conn, *recordingConn) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(Connect))
+	t.Cleanup(server.Close)
+
+	ws, rec := dialRecording(t, server.URL, "/connect?width=800&height=600")
+	creds, err := json.Marshal(connectionRequest{Type: "credentials", Host: host, User: "user", Password: "pass"})
+	require.NoError(t, err)
+	require.NoError(t, websocket.Message.Send(ws, string(creds)))
+	return ws, rec
+}
+
+func TestCloseStatus_InvalidTargetIsPolicyRejection(t *testing.T) {
+	ws, rec := connectAndSendCredentials(t, "bad host")
+	assert.Equal(t, closeStatusPolicyRejected, readCloseStatus(t, ws, rec))
+}
+
+func TestCloseStatus_InvalidParamsArePolicyRejection(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(Connect))
+	t.Cleanup(server.Close)
+
+	ws, rec := dialRecording(t, server.URL, "/connect?width=800&height=600&forceCodec=h264")
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var msg string
+	require.NoError(t, websocket.Message.Receive(ws, &msg))
+	assert.Contains(t, msg, `invalid forceCodec parameter \"h264\"`)
+	assert.Equal(t, closeStatusPolicyRejected, readCloseStatus(t, ws, rec))
+}
+
+func TestCloseStatus_HostUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	ws, rec := connectAndSendCredentials(t, addr)
+	assert.Equal(t, closeStatusHostUnreachable, readCloseStatus(t, ws, rec))
+}
+
+// loadConfigEnv reloads the global configuration with env set, restoring it
+// when the test ends.
+func loadConfigEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	// Registered first so it runs after t.Setenv restores the environment
+	t.Cleanup(func() { _, _ = config.Load() })
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	_, err := config.Load()
+	require.NoError(t, err)
+}
+
+func TestCloseStatus_DialRetriesExhausted(t *testing.T) {
+	loadConfigEnv(t, map[string]string{"RDP_DIAL_RETRIES": "1", "RDP_DIAL_RETRY_BACKOFF": "10ms"})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	ws, rec := connectAndSendCredentials(t, addr)
+	status, reason := readCloseFrame(t, ws, rec)
+	assert.Equal(t, closeStatusHostUnreachable, status)
+	assert.Equal(t, "host unreachable after 2 attempts", reason)
+}
+
+func TestCloseStatus_UnresponsiveHostTimesOut(t *testing.T) {
+	loadConfigEnv(t, map[string]string{"RDP_HANDSHAKE_TIMEOUT": "200ms"})
+
+	// The host accepts the TCP connection but never answers the X.224 request
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(io.Discard, conn)
+				_ = conn.Close()
+			}()
+		}
+	}()
+
+	start := time.Now()
+	ws, rec := connectAndSendCredentials(t, listener.Addr().String())
+	status, reason := readCloseFrame(t, ws, rec)
+	assert.Equal(t, closeStatusHostUnreachable, status)
+	assert.Equal(t, "connection timed out", reason)
+	assert.Less(t, time.Since(start), 3*time.Second)
+}
+
+func TestConnectFailureReason(t *testing.T) {
+	dialErr := fmt.Errorf("tcp connect: %w", &rdp.DialError{Attempts: 3, Err: errors.New("connection refused")})
+	assert.Equal(t, "host unreachable after 3 attempts", connectFailureReason(dialErr))
+	assert.Equal(t, "connection timed out", connectFailureReason(fmt.Errorf("licensing: %w after 1s", rdp.ErrHandshakeTimeout)))
+	assert.Equal(t, "connection timed out", connectFailureReason(fmt.Errorf("tcp connect: %w", context.DeadlineExceeded)))
+	assert.Empty(t, connectFailureReason(rdp.ErrAuthenticationFailed))
+}
+
+func TestWriteCloseReason(t *testing.T) {
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		_ = writeCloseReason(ws, closeStatusPolicyRejected, strings.Repeat("x", 200))
+	}))
+	defer server.Close()
+
+	ws, rec := dialRecording(t, server.URL, "/")
+	status, reason := readCloseFrame(t, ws, rec)
+	assert.Equal(t, closeStatusPolicyRejected, status)
+	assert.Len(t, reason, maxCloseReason, "reasons are cut to fit the close frame")
+}
+
+func TestConnectFailureStatus(t *testing.T) {
+	authErr := fmt.Errorf("secure settings exchange: %w", rdp.ErrAuthenticationFailed)
+	assert.Equal(t, closeStatusAuthFailed, connectFailureStatus(authErr))
+	assert.Equal(t, closeStatusHostUnreachable, connectFailureStatus(errors.New("tcp connect: connection refused")))
+
+	refused := fmt.Errorf("no redirection target reachable: %w", errors.Join(fmt.Errorf("%w: denied by policy", config.ErrTargetNotAllowed)))
+	assert.Equal(t, closeStatusPolicyRejected, connectFailureStatus(refused))
+	assert.Equal(t, "target not allowed", connectFailureReason(refused))
+}
+
+func TestCloseStatus_DeniedTargetIsPolicyRejection(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+	dialed := make(chan struct{}, 1)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			dialed <- struct{}{}
+			_ = conn.Close()
+		}
+	}()
+
+	loadConfigEnv(t, map[string]string{"BLOCK_PRIVATE_TARGETS": "true"})
+	ws, rec := connectAndSendCredentials(t, listener.Addr().String())
+	status, reason := readCloseFrame(t, ws, rec)
+	assert.Equal(t, closeStatusPolicyRejected, status)
+	assert.Equal(t, "target not allowed", reason)
+
+	select {
+	case <-dialed:
+		t.Fatal("a blocked target was dialed")
+	default:
+	}
+}
+
+func TestCloseStatus_ServerLogoff(t *testing.T) {
+	for name, updateErr := range map[string]error{
+		"deactivate all":       pdu.ErrDeactivateAll,
+		"disconnect ultimatum": mcs.ErrDisconnectUltimatum,
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+				var mu sync.Mutex
+				rdpToWsWithMutex(context.Background(), &mockRDPConnection{updateError: updateErr}, ws, &mu)
+			}))
+			defer server.Close()
+
+			ws, rec := dialRecording(t, server.URL, "/")
+			assert.Equal(t, closeStatusLogoff, readCloseStatus(t, ws, rec))
+		})
+	}
+}
+
+func TestCloseStatus_ServerUnresponsive(t *testing.T) {
+	stats := newSessionStats(time.Now())
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		var mu sync.Mutex
+		mockRDP := &mockRDPConnection{updateError: rdp.ErrServerUnresponsive}
+		rdpToWsWithOptions(context.Background(), mockRDP, ws, &mu, relayOptions{stats: stats})
+	}))
+	defer server.Close()
+
+	ws, rec := dialRecording(t, server.URL, "/")
+	var msg []byte
+	require.NoError(t, websocket.Message.Receive(ws, &msg))
+	assert.Contains(t, string(msg), "RDP server unresponsive")
+	assert.Equal(t, closeStatusHostUnreachable, readCloseStatus(t, ws, rec))
+	assert.Equal(t, reasonUnresponsive, stats.disconnectReason())
+}
+
+func TestCloseStatus_IdleTimeout(t *testing.T) {
+	mockRDP := &disconnectingRDPConnection{reasons: make(chan uint8, 1)}
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		wsToRdpWithOptions(ctx, ws, mockRDP, cancel, relayOptions{readTimeout: 50 * time.Millisecond})
+	}))
+	defer server.Close()
+
+	ws, rec := dialRecording(t, server.URL, "/")
+	assert.Equal(t, closeStatusIdleTimeout, readCloseStatus(t, ws, rec))
+	assert.Equal(t, mcs.RNProviderInitiated, <-mockRDP.reasons)
+}
+
+func TestCloseStatus_MaxSessionDuration(t *testing.T) {
+	clock := newFakeClock()
+	timer := newSessionTimer(time.Hour, clock.Now)
+	timer.interval = 10 * time.Millisecond
+	clock.Advance(time.Hour)
+
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		var mu sync.Mutex
+		enforceSessionDuration(context.Background(), ws, &mu, timer, func() {})
+	}))
+	defer server.Close()
+
+	ws, rec := dialRecording(t, server.URL, "/")
+	assert.Equal(t, closeStatusPolicyRejected, readCloseStatus(t, ws, rec))
+}
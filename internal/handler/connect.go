@@ -3,24 +3,33 @@
 package handler
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf16"
+	"unicode/utf8"
 
 	"golang.org/x/net/websocket"
 
 	"github.com/rcarmo/go-rdp/internal/config"
 	"github.com/rcarmo/go-rdp/internal/logging"
 	"github.com/rcarmo/go-rdp/internal/protocol/audio"
+	"github.com/rcarmo/go-rdp/internal/protocol/mcs"
 	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+	"github.com/rcarmo/go-rdp/internal/protocol/x224"
 	"github.com/rcarmo/go-rdp/internal/rdp"
 )
 
@@ -29,6 +38,18 @@ type rdpConn interface {
 	SendInputEvent(data []byte) error
 }
 
+// contextUpdater is implemented by connections whose update reads can be
+// interrupted by the session context
+type contextUpdater interface {
+	GetUpdateContext(ctx context.Context) (*rdp.Update, error)
+}
+
+// heartbeatNotifier is implemented by connections that report the server
+// heartbeats consumed while reading updates
+type heartbeatNotifier interface {
+	SetHeartbeatCallback(cb rdp.HeartbeatCallback)
+}
+
 // capabilitiesGetter interface for testing
 type capabilitiesGetter interface {
 	GetServerCapabilities() *rdp.ServerCapabilityInfo
@@ -52,9 +73,54 @@ func Connect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Refuse new sessions while the server drains for shutdown
+	if activeSessions.isDraining() {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Resolve server-side credentials before upgrading, so a bad session
+	// token is refused with a plain HTTP error
+	resolved, err := resolveCredentials(r)
+	if err != nil {
+		logging.Info("Rejecting connection: %v", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Collapse duplicate upgrades carrying the same client nonce
+	var claim *nonceClaim
+	cfg := currentConfig()
+	if nonce := r.URL.Query().Get("nonce"); nonce != "" && cfg.Server.DedupPolicy != "" && cfg.Server.DedupPolicy != config.DedupPolicyOff {
+		if len(nonce) > maxNonceLength {
+			http.Error(w, "Invalid nonce", http.StatusBadRequest)
+			return
+		}
+		var ok bool
+		claim, ok = sessionNonces.claim(nonce, cfg.Server.DedupPolicy, cfg.Server.DedupWindow)
+		if !ok {
+			logging.Info("Rejecting duplicate connection for nonce %q", nonce)
+			http.Error(w, "Duplicate connection", http.StatusConflict)
+			return
+		}
+		defer sessionNonces.release(nonce, claim)
+	}
+
+	maxMessageSize := cfg.Server.MaxMessageSize
+	if maxMessageSize == 0 {
+		maxMessageSize = defaultMaxMessageSize
+	}
+
 	// Create websocket handler
 	handler := func(wsConn *websocket.Conn) {
-		handleWebSocket(wsConn, r)
+		wsConn.MaxPayloadBytes = maxMessageSize
+		if claim != nil {
+			sessionNonces.attach(claim, func() {
+				logging.Info("Closing session replaced by a newer connection")
+				_ = wsConn.Close()
+			})
+		}
+		handleWebSocket(wsConn, r, resolved)
 	}
 
 	// Configure and serve websocket
@@ -76,18 +142,35 @@ type connectionParams struct {
 	colorDepth int
 	disableNLA bool
 	enableAudio bool
+	enableMicrophone bool
+	reconnectCookie []byte
+	monitors        []pdu.MonitorDef
+	forceCodec      rdp.ForcedCodec
 }
 
 // parseConnectionParams extracts and validates connection parameters from the request.
 func parseConnectionParams(r *http.Request) (*connectionParams, error) {
-	width, err := strconv.Atoi(r.URL.Query().Get("width"))
-	if err != nil || width <= 0 || width > 8192 {
-		return nil, errors.New("invalid width parameter (must be 1-8192)")
-	}
+	// A monitor layout sizes the desktop to its bounding box and replaces
+	// width and height
+	var width, height int
+	var monitors []pdu.MonitorDef
+	var err error
+	if layout := r.URL.Query().Get("monitors"); layout != "" {
+		monitors, err = parseMonitors(layout)
+		if err != nil {
+			return nil, err
+		}
+		width, height = pdu.ClientMonitorData{Monitors: monitors}.DesktopSize()
+	} else {
+		width, err = strconv.Atoi(r.URL.Query().Get("width"))
+		if err != nil || width <= 0 || width > 8192 {
+			return nil, errors.New("invalid width parameter (must be 1-8192)")
+		}
 
-	height, err := strconv.Atoi(r.URL.Query().Get("height"))
-	if err != nil || height <= 0 || height > 8192 {
-		return nil, errors.New("invalid height parameter (must be 1-8192)")
+		height, err = strconv.Atoi(r.URL.Query().Get("height"))
+		if err != nil || height <= 0 || height > 8192 {
+			return nil, errors.New("invalid height parameter (must be 1-8192)")
+		}
 	}
 
 	colorDepth := 16 // default to 16-bit
@@ -97,17 +180,108 @@ func parseConnectionParams(r *http.Request) (*connectionParams, error) {
 		}
 	}
 
+	// An auto-reconnect cookie from a previous session lets the server skip
+	// a full logon
+	var reconnectCookie []byte
+	if cookie := r.URL.Query().Get("reconnect"); cookie != "" {
+		reconnectCookie, err = base64.StdEncoding.DecodeString(cookie)
+		if err == nil {
+			_, err = pdu.ParseARCSCPrivatePacket(reconnectCookie)
+		}
+		if err != nil {
+			return nil, errors.New("invalid reconnect parameter")
+		}
+	}
+
+	forceCodec, err := parseForceCodec(r.URL.Query().Get("forceCodec"))
+	if err != nil {
+		return nil, err
+	}
+
 	return &connectionParams{
 		width:       width,
 		height:      height,
 		colorDepth:  colorDepth,
 		disableNLA:  r.URL.Query().Get("disableNLA") == "true",
 		enableAudio: r.URL.Query().Get("audio") == "true",
+		enableMicrophone: r.URL.Query().Get("microphone") == "true",
+		reconnectCookie: reconnectCookie,
+		monitors:        monitors,
+		forceCodec:      forceCodec,
 	}, nil
 }
 
+// forceCodecNames maps forceCodec parameter values to the codec override.
+var forceCodecNames = map[string]rdp.ForcedCodec{
+	"nscodec": rdp.ForcedCodecNSCodec,
+	"rfx":     rdp.ForcedCodecRFX,
+	"none":    rdp.ForcedCodecNone,
+}
+
+// parseForceCodec decodes the forceCodec parameter. An empty value leaves
+// codec negotiation to the server configuration.
+func parseForceCodec(name string) (rdp.ForcedCodec, error) {
+	if name == "" {
+		return rdp.ForcedCodecAuto, nil
+	}
+	codec, ok := forceCodecNames[name]
+	if !ok {
+		return rdp.ForcedCodecAuto, fmt.Errorf("invalid forceCodec parameter %q (must be nscodec, rfx or none)", name)
+	}
+	return codec, nil
+}
+
+// parseMonitors decodes the monitors parameter, a JSON array of monitor
+// rectangles, into a validated layout with the primary monitor at the origin.
+func parseMonitors(layout string) ([]pdu.MonitorDef, error) {
+	var rects []monitorRect
+	if err := json.Unmarshal([]byte(layout), &rects); err != nil {
+		return nil, errors.New("invalid monitors parameter")
+	}
+
+	var originX, originY int
+	for _, rect := range rects {
+		if rect.Primary {
+			originX, originY = rect.X, rect.Y
+			break
+		}
+	}
+
+	monitors := make([]pdu.MonitorDef, len(rects))
+	for i, rect := range rects {
+		if rect.Width <= 0 || rect.Width > pdu.MaxMonitorDimension || rect.Height <= 0 || rect.Height > pdu.MaxMonitorDimension {
+			return nil, fmt.Errorf("invalid monitors parameter: monitor %d is %dx%d (must be 1-%d)", i, rect.Width, rect.Height, pdu.MaxMonitorDimension)
+		}
+		x, y := rect.X-originX, rect.Y-originY
+		if x < -pdu.MaxMonitorDimension || x > pdu.MaxMonitorDimension || y < -pdu.MaxMonitorDimension || y > pdu.MaxMonitorDimension {
+			return nil, fmt.Errorf("invalid monitors parameter: monitor %d is outside the desktop", i)
+		}
+		monitors[i] = pdu.MonitorDef{
+			Left:   int32(x),                   // #nosec G115 -- bounded above
+			Top:    int32(y),                   // #nosec G115 -- bounded above
+			Right:  int32(x + rect.Width - 1),  // #nosec G115 -- bounded above
+			Bottom: int32(y + rect.Height - 1), // #nosec G115 -- bounded above
+		}
+		if rect.Primary {
+			monitors[i].Flags = pdu.MonitorFlagPrimary
+		}
+	}
+
+	if _, err := pdu.NewClientMonitorData(monitors); err != nil {
+		return nil, fmt.Errorf("invalid monitors parameter: %w", err)
+	}
+	return monitors, nil
+}
+
+// errHostNotResolved is returned when the credentials message names a host
+// other than the one server-side credentials were resolved for.
+var errHostNotResolved = errors.New("host does not match the resolved credentials")
+
 // receiveCredentials waits for and validates credentials sent via WebSocket.
-func receiveCredentials(wsConn *websocket.Conn) (*connectionRequest, error) {
+// When the credential provider resolved them server-side, resolved replaces
+// the user and password of the message, which then only needs the host. If
+// the provider pinned a host, the message may omit it but not change it.
+func receiveCredentials(wsConn *websocket.Conn, resolved *resolvedCredentials) (*connectionRequest, error) {
 	// Set read deadline for credentials
 	if err := wsConn.SetReadDeadline(time.Now().Add(30 * time.Second)); err != nil {
 		return nil, errors.New("failed to set read deadline")
@@ -137,6 +311,18 @@ func receiveCredentials(wsConn *websocket.Conn) (*connectionRequest, error) {
 		return nil, errors.New("expected credentials message")
 	}
 
+	if resolved != nil {
+		credentials.User, credentials.Password = resolved.user, resolved.password
+		if resolved.host != "" {
+			if credentials.Host != "" {
+				if target, err := parseTarget(credentials.Host); err != nil || target != resolved.host {
+					return nil, errHostNotResolved
+				}
+			}
+			credentials.Host = resolved.host
+		}
+	}
+
 	// Validate hostname length (max 253 per DNS spec)
 	if len(credentials.Host) == 0 || len(credentials.Host) > 253 {
 		return nil, errors.New("invalid hostname")
@@ -155,36 +341,108 @@ func receiveCredentials(wsConn *websocket.Conn) (*connectionRequest, error) {
 	return &credentials, nil
 }
 
-// setupRDPClient creates and configures an RDP client with the given parameters.
-func setupRDPClient(creds *connectionRequest, params *connectionParams) (*rdp.Client, error) {
-	rdpClient, err := rdp.NewClient(creds.Host, creds.User, creds.Password, params.width, params.height, params.colorDepth)
+// connectWithRetry connects rdpClient as connectRDP does and, when the
+// connection sequence fails with a transient server error, retries it on a
+// newly dialed client. It returns the client in use when it stopped, which
+// the caller must close even on error, and the result of its last
+// connection sequence, which may be nil.
+func connectWithRetry(ctx context.Context, rdpClient *rdp.Client, creds *connectionRequest, params *connectionParams, callbacks connectCallbacks) (*rdp.Client, *rdp.ConnectResult, error) {
+	cfg := currentConfig()
+	retry := rdp.ConnectRetry{Retries: cfg.RDP.ConnectRetries, Backoff: cfg.RDP.ConnectRetryBackoff}
+
+	var result *rdp.ConnectResult
+	err := retry.Do(ctx, func(attempt int) error {
+		if attempt > 0 {
+			_ = rdpClient.Close()
+			next, err := setupRDPClient(ctx, creds, params)
+			if err != nil {
+				result = nil
+				return err
+			}
+			rdpClient = next
+		}
+
+		var err error
+		rdpClient, result, err = connectRDP(ctx, rdpClient, creds, params, callbacks)
+		return err
+	})
+	return rdpClient, result, err
+}
+
+// setupRDPClient creates and configures an RDP client with the given
+// parameters, dialing within ctx.
+func setupRDPClient(ctx context.Context, creds *connectionRequest, params *connectionParams) (*rdp.Client, error) {
+	cfg := currentConfig()
+
+	// A session clamped to the primary monitor is sized to that monitor
+	width, height := params.width, params.height
+	if cfg.RDP.PrimaryMonitorOnly && params.monitors != nil {
+		for _, m := range params.monitors {
+			if m.IsPrimary() {
+				width, height = m.Width(), m.Height()
+			}
+		}
+	}
+
+	// Load the mutual TLS certificate before dialing so a bad one fails fast
+	clientCert, err := cfg.Security.ClientCertificate()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("RDP client certificate: %w", err)
 	}
 
-	// Set TLS configuration from server config
-	cfg := config.GetGlobalConfig()
-	if cfg == nil {
-		cfg, err = config.Load()
-		if err != nil {
-			logging.Debug("Failed to load config for TLS settings: %v", err)
-			cfg = &config.Config{}
-		}
+	rdpClient, err := newRDPClient(ctx, cfg, creds, width, height, params.colorDepth)
+	if err != nil {
+		return nil, err
 	}
 
-	rdpClient.SetTLSConfig(cfg.Security.SkipTLSValidation, cfg.Security.TLSServerName)
+	// Set TLS configuration from server config and any host profile
+	settings := hostSettingsFor(cfg, creds.Host)
+
+	rdpClient.SetTLSConfig(settings.skipTLSValidation, settings.tlsServerName)
+	rdpClient.SetMaxChannels(cfg.RDP.MaxChannels)
+	rdpClient.SetMaxUnacknowledgedFrames(uint32(cfg.RDP.MaxUnacknowledgedFrames)) // #nosec G115 -- validated non-negative
+	rdpClient.SetFrameReorderGrace(uint32(cfg.RDP.FrameReorderGrace))             // #nosec G115 -- validated non-negative
+	rdpClient.SetReadIdleTimeout(cfg.RDP.ReadIdleTimeout)
+	rdpClient.SetHandshakeTimeout(cfg.RDP.HandshakeTimeout)
+	if err := rdpClient.SetClientIdentity(clientIdentity(cfg)); err != nil {
+		return nil, err
+	}
+	if clientCert != nil {
+		rdpClient.SetClientCertificate(clientCert)
+	}
 
 	// Use NLA unless explicitly disabled by client or server config
-	useNLA := cfg.Security.UseNLA && !params.disableNLA
+	useNLA := settings.useNLA && !params.disableNLA
 	rdpClient.SetUseNLA(useNLA)
+	serviceHost, _, err := net.SplitHostPort(creds.Host)
+	if err != nil {
+		serviceHost = creds.Host
+	}
+	rdpClient.SetNLAMechanism(nlaMechanism(cfg.RDP.NLAMechanism), rdp.KerberosSettings{
+		ConfigPath:  cfg.RDP.KerberosConfig,
+		Realm:       cfg.RDP.KerberosRealm,
+		ServiceHost: serviceHost,
+	})
 	if params.disableNLA {
 		logging.Info("NLA disabled for this connection")
 	}
 
-	// Enable audio if requested
-	if params.enableAudio {
+	// Present the auto-reconnect cookie from the browser's previous session
+	if params.reconnectCookie != nil {
+		if err := rdpClient.SetReconnectCookie(params.reconnectCookie); err != nil {
+			return nil, err
+		}
+	}
+
+	// Enable audio if requested, unless the server has audio turned off
+	if !cfg.Features.Enabled(config.FeatureAudio) {
+		rdpClient.DisableAudio()
+		if params.enableAudio {
+			logging.Info("Audio redirection disabled by server configuration")
+		}
+	} else if params.enableAudio {
 		rdpClient.EnableAudio()
-		if cfg.RDP.PreferPCMAudio {
+		if cfg.Features.Enabled(config.FeaturePCMAudio) {
 			rdpClient.GetAudioHandler().SetPreferPCM(true)
 			logging.Info("Audio redirection enabled (prefer PCM for quality)")
 		} else {
@@ -192,26 +450,230 @@ func setupRDPClient(creds *connectionRequest, params *connectionParams) (*rdp.Cl
 		}
 	}
 
+	// Enable microphone redirection over the AUDIO_INPUT dynamic channel
+	if params.enableMicrophone {
+		rdpClient.EnableAudioInput()
+		logging.Info("Microphone redirection enabled")
+	}
+
+	// Enable clipboard text sync over the cliprdr channel, unless the server
+	// has the clipboard turned off
+	if cfg.Features.Enabled(config.FeatureClipboard) {
+		rdpClient.EnableClipboard()
+	}
+
+	// Complete the rdpdr handshake so smartcard logon does not stall, and
+	// redirect the configured directory as a read-only drive
+	rdpClient.EnableDeviceRedirection()
+	if cfg.RDP.DriveRoot != "" {
+		if err := rdpClient.SetDriveRedirection(cfg.RDP.DriveRoot, cfg.RDP.DriveName); err != nil {
+			return nil, err
+		}
+		logging.Info("Drive redirection enabled (read-only)")
+	}
+
+	// Present a single primary monitor regardless of the server's layout
+	if cfg.RDP.PrimaryMonitorOnly {
+		rdpClient.SetPrimaryMonitorOnly(true)
+		logging.Info("Session clamped to the primary monitor")
+	} else if params.monitors != nil {
+		if err := rdpClient.SetMonitors(params.monitors); err != nil {
+			return nil, err
+		}
+		logging.Info("Multi-monitor desktop: %d monitor(s), %dx%d", len(params.monitors), width, height)
+	}
+
 	// Enable display control for dynamic resize
 	rdpClient.EnableDisplayControl()
 	logging.Debug("Display control enabled")
 
 	// Enable UDP transport if configured (experimental)
-	if cfg.RDP.EnableUDP {
+	if cfg.Features.Enabled(config.FeatureUDP) {
 		rdpClient.EnableMultitransport(true)
 		logging.Info("UDP transport enabled (experimental)")
 	}
 
+	// Cache bitmaps sent with drawing orders instead of relying on bitmap updates
+	if cfg.RDP.BitmapCache {
+		rdpClient.EnableBitmapCache()
+		logging.Debug("Bitmap cache enabled")
+	}
+
+	// Draw solid fills and screen-to-screen copies sent as drawing orders
+	if cfg.RDP.DrawingOrders {
+		rdpClient.EnableDrawingOrders()
+		logging.Debug("Drawing orders enabled")
+	}
+
 	// Enable RemoteFX-Image codec if configured
-	if cfg.RDP.EnableRFX {
+	if settings.enableRFX {
 		rdpClient.SetEnableRFX(true)
+		rdpClient.SetRFXMode(rfxCodecMode(settings.rfxMode))
+	}
+
+	// Constrain the advertised codecs when the browser asks for one
+	if params.forceCodec != rdp.ForcedCodecAuto {
+		rdpClient.SetRFXMode(rfxCodecMode(settings.rfxMode))
+		rdpClient.SetForcedCodec(params.forceCodec)
+		logging.Info("Bitmap codecs forced by the browser")
 	}
 
 	return rdpClient, nil
 }
 
+// hostSettings are the connection settings for one RDP target.
+type hostSettings struct {
+	useNLA            bool
+	enableRFX         bool
+	rfxMode           string
+	skipTLSValidation bool
+	tlsServerName     string
+}
+
+// hostSettingsFor returns the server-wide connection settings, overridden
+// by the profile configured for host, if any.
+func hostSettingsFor(cfg *config.Config, host string) hostSettings {
+	settings := hostSettings{
+		useNLA:            cfg.Features.Enabled(config.FeatureNLA),
+		enableRFX:         cfg.Features.Enabled(config.FeatureRFX),
+		rfxMode:           cfg.RDP.RFXMode,
+		skipTLSValidation: cfg.Security.SkipTLSValidation,
+		tlsServerName:     cfg.Security.TLSServerName,
+	}
+
+	profile, ok := cfg.ProfileFor(host)
+	if !ok {
+		return settings
+	}
+	logging.Debug("Applying connection profile for %s", host)
+	if profile.UseNLA != nil {
+		settings.useNLA = *profile.UseNLA
+	}
+	if profile.EnableRFX != nil {
+		settings.enableRFX = *profile.EnableRFX
+	}
+	if profile.RFXMode != "" {
+		settings.rfxMode = profile.RFXMode
+	}
+	if profile.SkipTLSValidation != nil {
+		settings.skipTLSValidation = *profile.SkipTLSValidation
+	}
+	if profile.TLSServerName != "" {
+		settings.tlsServerName = profile.TLSServerName
+	}
+	return settings
+}
+
+// rfxCodecMode maps a configured RemoteFX mode name to the advertised codec
+// mode. Anything other than video, including unset, prefers image mode.
+func rfxCodecMode(mode string) pdu.RFXCodecMode {
+	if mode == config.RFXModeVideo {
+		return pdu.RFXCodecModeVideo
+	}
+	return pdu.RFXCodecModeImage
+}
+
+// nlaMechanism maps a configured NLA mechanism name to the client's. Anything
+// other than kerberos or negotiate, including unset, uses NTLM.
+func nlaMechanism(name string) rdp.NLAMechanism {
+	switch name {
+	case config.NLAMechanismKerberos:
+		return rdp.NLAMechanismKerberos
+	case config.NLAMechanismNegotiate:
+		return rdp.NLAMechanismNegotiate
+	}
+	return rdp.NLAMechanismNTLM
+}
+
+// clientOSTypes maps configured client platforms to the OS major and minor
+// types advertised in the General Capability Set, as those clients send them.
+var clientOSTypes = map[string][2]uint16{
+	config.ClientOSWindows:  {pdu.OSMajorTypeWindows, pdu.OSMinorTypeWindowsNT},
+	config.ClientOSMacOS:    {pdu.OSMajorTypeOSX, pdu.OSMinorTypeUnspecified},
+	config.ClientOSLinux:    {pdu.OSMajorTypeUnix, pdu.OSMinorTypeNativeXServer},
+	config.ClientOSIOS:      {pdu.OSMajorTypeIOS, pdu.OSMinorTypeUnspecified},
+	config.ClientOSAndroid:  {pdu.OSMajorTypeAndroid, pdu.OSMinorTypeUnspecified},
+	config.ClientOSChromeOS: {pdu.OSMajorTypeChromeOS, pdu.OSMinorTypeUnspecified},
+}
+
+// clientIdentity returns the client build, product ID and platform to
+// advertise in place of the defaults.
+func clientIdentity(cfg *config.Config) rdp.ClientIdentity {
+	identity := rdp.ClientIdentity{
+		Build:     uint32(cfg.RDP.ClientBuild), // #nosec G115 -- validated to fit
+		ProductID: cfg.RDP.ClientProductID,
+	}
+	if types, ok := clientOSTypes[cfg.RDP.ClientOS]; ok {
+		identity.OSMajorType, identity.OSMinorType = types[0], types[1]
+	}
+	return identity
+}
+
+// currentConfig returns the configuration stored by the server, falling back
+// to loading it from the environment when none has been stored.
+func currentConfig() *config.Config {
+	if cfg := config.GetGlobalConfig(); cfg != nil {
+		return cfg
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		logging.Debug("Failed to load config: %v", err)
+		return &config.Config{}
+	}
+	return cfg
+}
+
+// relayOptions carries per-session relay policies derived from server config.
+type relayOptions struct {
+	// watchdog, when non-nil, warns the browser if the update stream stalls.
+	watchdog *updateWatchdog
+	// heartbeat, when non-nil, pings the browser while no updates are sent.
+	heartbeat *wsHeartbeat
+	// closeOnUnknownMarker closes the session instead of dropping messages
+	// that carry an unrecognized control marker.
+	closeOnUnknownMarker bool
+	// sessionTimer, when non-nil, ends the session at its maximum duration.
+	sessionTimer *sessionTimer
+	// readTimeout is how long the browser may stay silent before the
+	// session is closed as idle; zero means browserReadTimeout.
+	readTimeout time.Duration
+	// stats, when non-nil, collects the counters for the session summary.
+	stats *sessionStats
+	// framebuffer, when non-nil, keeps a copy of the desktop for snapshots.
+	framebuffer *framebuffer
+	// skipFrames drops RemoteFX frames superseded by newer ones while the
+	// relay is behind the server.
+	skipFrames bool
+	// splash, when non-nil, stops its progress reports at the first graphics.
+	splash *connectSplash
+	// fragmentSize splits updates larger than this many bytes into
+	// fragments; zero sends them whole.
+	fragmentSize int
+}
+
+// browserReadTimeout is the default time allowed between browser messages.
+const browserReadTimeout = 30 * time.Second
+
+// newRelayOptions builds the relay options for a session from config.
+func newRelayOptions(cfg *config.Config) relayOptions {
+	opts := relayOptions{
+		closeOnUnknownMarker: cfg.Server.UnknownMarkerPolicy == config.UnknownMarkerPolicyClose,
+		fragmentSize:         cfg.Server.FragmentSize,
+	}
+	if cfg.RDP.UpdateWatchdogTimeout > 0 {
+		opts.watchdog = newUpdateWatchdog(cfg.RDP.UpdateWatchdogTimeout, nil)
+	}
+	if cfg.Server.HeartbeatInterval > 0 {
+		opts.heartbeat = newWSHeartbeat(cfg.Server.HeartbeatInterval, nil)
+	}
+	if cfg.Security.MaxSessionDuration > 0 {
+		opts.sessionTimer = newSessionTimer(cfg.Security.MaxSessionDuration, nil)
+	}
+	return opts
+}
+
 // startBidirectionalRelay manages the goroutines that relay data between WebSocket and RDP.
-func startBidirectionalRelay(ctx context.Context, cancel context.CancelFunc, wsConn *websocket.Conn, rdpClient *rdp.Client, wsMu *sync.Mutex, enableAudio bool) {
+func startBidirectionalRelay(ctx context.Context, cancel context.CancelFunc, wsConn *websocket.Conn, rdpClient *rdp.Client, wsMu *sync.Mutex, enableAudio bool, opts relayOptions) {
 	// Set up audio callback to forward audio data to browser
 	if enableAudio && rdpClient.GetAudioHandler() != nil {
 		rdpClient.GetAudioHandler().SetCallback(func(data []byte, format *audio.AudioFormat, timestamp uint16) {
@@ -219,9 +681,52 @@ func startBidirectionalRelay(ctx context.Context, cancel context.CancelFunc, wsC
 		})
 	}
 
+	// Tell the browser when to start capturing and in which format
+	if audioInput := rdpClient.GetAudioInputHandler(); audioInput != nil {
+		audioInput.SetCallback(func(format *audio.AudioFormat, framesPerPacket uint32) {
+			sendControlMessageWithMutex(wsConn, wsMu, newMicrophoneMessage(format, framesPerPacket))
+		})
+	}
+
+	// Forward remote clipboard changes to the browser
+	if clipboard := rdpClient.GetClipboardHandler(); clipboard != nil {
+		clipboard.SetCallback(func(text string) {
+			sendClipboardTextWithMutex(wsConn, wsMu, text)
+		})
+	}
+
 	// Send server capabilities info to browser
 	sendCapabilitiesInfoWithMutex(wsConn, wsMu, rdpClient)
 
+	// Forward the server's monitor layout so the browser can arrange canvases;
+	// it usually arrives during connection finalization, before the relay starts
+	rdpClient.SetMonitorLayoutCallback(func(monitors []pdu.MonitorDef) {
+		sendControlMessageWithMutex(wsConn, wsMu, newMonitorLayoutMessage(monitors))
+	})
+	if monitors := rdpClient.GetMonitorLayout(); monitors != nil {
+		sendControlMessageWithMutex(wsConn, wsMu, newMonitorLayoutMessage(monitors))
+	}
+
+	// Hand the auto-reconnect cookie to the browser so it can resume the
+	// logon session after a network blip; the server sends it after logon
+	rdpClient.SetReconnectCookieCallback(func(cookie []byte) {
+		opts.stats.loggedOn(rdpClient.LogonSession())
+		sendControlMessageWithMutex(wsConn, wsMu, newReconnectCookieMessage(cookie))
+	})
+	if cookie := rdpClient.ReconnectCookie(); cookie != nil {
+		sendControlMessageWithMutex(wsConn, wsMu, newReconnectCookieMessage(cookie))
+	}
+	opts.stats.loggedOn(rdpClient.LogonSession())
+
+	// Tell the browser why a logon failed; without this a failed logon
+	// looks like any other disconnect
+	rdpClient.SetLogonErrorCallback(func(info pdu.LogonErrorsInfo) {
+		sendControlMessageWithMutex(wsConn, wsMu, newLogonErrorMessage(&info))
+	})
+	if info := rdpClient.LogonError(); info != nil {
+		sendControlMessageWithMutex(wsConn, wsMu, newLogonErrorMessage(info))
+	}
+
 	// Use WaitGroup to ensure clean goroutine shutdown
 	var cancelOnce sync.Once
 	safeCancel := func() { cancelOnce.Do(cancel) }
@@ -229,9 +734,24 @@ func startBidirectionalRelay(ctx context.Context, cancel context.CancelFunc, wsC
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		wsToRdp(ctx, wsConn, rdpClient, safeCancel)
+		wsToRdpWithOptions(ctx, wsConn, rdpClient, safeCancel, opts)
 	}()
-	rdpToWsWithMutex(ctx, rdpClient, wsConn, wsMu)
+	if opts.sessionTimer != nil {
+		// Cancelling interrupts rdpToWs, whose update reads follow the session context
+		go enforceSessionDuration(ctx, wsConn, wsMu, opts.sessionTimer, func() {
+			opts.stats.ended(reasonMaxDuration)
+			safeCancel()
+			_ = rdpClient.Close()
+		})
+	}
+	// Servers that send heartbeats say how many missed ones warrant a
+	// warning and a reconnect
+	go enforceServerHeartbeats(ctx, wsConn, wsMu, rdpClient.HeartbeatStats, serverHeartbeatPoll, func() {
+		opts.stats.ended(reasonUnresponsive)
+		safeCancel()
+		_ = rdpClient.Close()
+	})
+	rdpToWsWithOptions(ctx, rdpClient, wsConn, wsMu, opts)
 
 	// Cancel context to signal wsToRdp to exit
 	safeCancel()
@@ -249,49 +769,179 @@ func startBidirectionalRelay(ctx context.Context, cancel context.CancelFunc, wsC
 	}
 }
 
-func handleWebSocket(wsConn *websocket.Conn, r *http.Request) {
+func handleWebSocket(wsConn *websocket.Conn, r *http.Request, resolved *resolvedCredentials) {
 	defer func() { _ = wsConn.Close() }()
+	start := time.Now()
+
+	// Count the session until it ends so shutdown can wait for it
+	session, ok := activeSessions.add()
+	if !ok {
+		sendError(wsConn, "Server is shutting down")
+		return
+	}
+	defer activeSessions.remove(session)
 
 	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
 
+	// Per-connection mutex for WebSocket writes
+	var wsMu sync.Mutex
+
+	// Let operators list the session and end it through the admin API
+	stats := newSessionStats(start)
+	clientAddr := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(clientAddr); err == nil {
+		clientAddr = host
+	}
+	activeSessions.describe(session, clientAddr, stats, func() {
+		logging.Info("Session %s terminated by administrator", session.id)
+		stats.ended(reasonAdminTerminated)
+		sendControlMessageWithMutex(wsConn, &wsMu, errorMessage{Type: "error", Message: "Session terminated by administrator"})
+		writeCloseWithMutex(wsConn, &wsMu, closeStatusPolicyRejected)
+		cancel()
+	})
+
 	// Parse and validate connection parameters
 	params, err := parseConnectionParams(r)
 	if err != nil {
 		logging.Error("Invalid params: %v", err)
 		sendError(wsConn, err.Error())
+		_ = wsConn.WriteClose(closeStatusPolicyRejected)
+		return
+	}
+
+	// Server-side credentials always go through NLA, so the password is
+	// never handed to the RDP server in the Client Info PDU
+	if resolved != nil && params.disableNLA {
+		logging.Info("Refusing disableNLA with server-side credentials")
+		sendError(wsConn, "NLA cannot be disabled for this session")
+		_ = wsConn.WriteClose(closeStatusPolicyRejected)
 		return
 	}
 
 	// Receive and validate credentials
-	credentials, err := receiveCredentials(wsConn)
+	credentials, err := receiveCredentials(wsConn, resolved)
 	if err != nil {
 		logging.Error("Credentials error: %v", err)
 		sendError(wsConn, err.Error())
+		if errors.Is(err, errHostNotResolved) {
+			_ = wsConn.WriteClose(closeStatusPolicyRejected)
+		}
+		return
+	}
+
+	// Reject malformed targets before dialing
+	target, err := parseTarget(credentials.Host)
+	if err != nil {
+		logging.Error("Invalid target: %v", err)
+		sendError(wsConn, "Invalid host: "+err.Error())
+		_ = wsConn.WriteClose(closeStatusPolicyRejected)
+		return
+	}
+	credentials.Host = target
+	activeSessions.setTarget(session, target)
+
+	// Refuse targets the allow and deny lists rule out before dialing them
+	if err := checkTarget(ctx, currentConfig(), target); err != nil {
+		logging.Info("Refusing target %s: %v", target, err)
+		sendError(wsConn, "Target host not allowed")
+		_ = writeCloseReason(wsConn, closeStatusPolicyRejected, connectFailureReason(err))
 		return
 	}
 
 	// Create and configure RDP client
-	rdpClient, err := setupRDPClient(credentials, params)
+	rdpClient, err := setupRDPClient(ctx, credentials, params)
 	if err != nil {
 		logging.Error("RDP init: %v", err)
 		sendError(wsConn, "Connection failed")
+		_ = writeCloseReason(wsConn, connectFailureStatus(err), connectFailureReason(err))
 		return
 	}
 	defer func() { _ = rdpClient.Close() }()
 
-	// Connect to RDP server
-	if err = rdpClient.Connect(); err != nil {
-		logging.Error("RDP connect: %v", err)
-		sendError(wsConn, "Connection failed")
+	cfg := currentConfig()
+
+	// Until the first graphics arrive, keep telling the browser how far the
+	// connection has got rather than leaving it on a blank screen
+	var splash *connectSplash
+	if cfg.RDP.ConnectSplash > 0 {
+		splash = newConnectSplash(cfg.RDP.ConnectSplash, nil)
+		splashCtx, stopSplash := context.WithCancel(ctx)
+		defer stopSplash()
+		go splash.run(splashCtx, func(msg connectingMessage) {
+			sendControlMessageWithMutex(wsConn, &wsMu, msg)
+		})
+	}
+
+	// Show the browser the server's progress while it prepares the session
+	onStatus := func(status pdu.StatusInfoPDUData) {
+		splash.setStatus(status.Message())
+		sendControlMessageWithMutex(wsConn, &wsMu, newStatusInfoMessage(&status))
+	}
+
+	// Tell the browser each phase reached, so a failed logon shows whether
+	// TLS, NLA or licensing stopped it. Redirections are not failures.
+	onPhase := func(event rdp.ConnectEvent) {
+		if errors.Is(event.Err, rdp.ErrServerRedirected) {
+			return
+		}
+		logging.Debug("RDP connect: %s after %v", event.Phase, event.Elapsed)
+		sendControlMessageWithMutex(wsConn, &wsMu, newConnectPhaseMessage(event))
+	}
+
+	// Connect to RDP server, following any connection broker redirection
+	// and retrying transient server errors
+	callbacks := connectCallbacks{onStatus: onStatus, onStage: splash.setStage, onPhase: onPhase}
+	rdpClient, result, err := connectWithRetry(ctx, rdpClient, credentials, params, callbacks)
+	if err != nil {
+		if result != nil {
+			logging.Error("RDP connect failed during %s after %s over %s: %v", result.Stage, result.Phase, result.Transport, err)
+		} else {
+			logging.Error("RDP connect: %v", err)
+		}
+		// The splash may be mid-report; hold the write lock for the close
+		splash.finish()
+		wsMu.Lock()
+		defer wsMu.Unlock()
+		switch {
+		case errors.Is(err, rdp.ErrAuthenticationFailed):
+			sendError(wsConn, "Authentication failed")
+		case errors.Is(err, config.ErrTargetNotAllowed):
+			sendError(wsConn, "Target host not allowed")
+		default:
+			sendError(wsConn, "Connection failed")
+		}
+		_ = writeCloseReason(wsConn, connectFailureStatus(err), connectFailureReason(err))
 		return
 	}
 
-	// Per-connection mutex for WebSocket writes
-	var wsMu sync.Mutex
+	splash.setStage(rdp.StageActive)
+	opts := newRelayOptions(cfg)
+	opts.splash = splash
+	opts.stats = stats
+	var releaseSnapshots func()
+	opts.framebuffer, releaseSnapshots = startSnapshots(cfg, params.width, params.height)
+	defer releaseSnapshots()
+	settings := hostSettingsFor(cfg, credentials.Host)
+	opts.skipFrames = settings.enableRFX && settings.rfxMode == config.RFXModeVideo
+
+	// On shutdown, tell the browser and close both ends so the relay loops
+	// exit between frames rather than being cut off
+	activeSessions.attach(session, func() {
+		logging.Info("Server shutting down, closing session")
+		opts.stats.ended(reasonServerShutdown)
+		sendControlMessageWithMutex(wsConn, &wsMu, errorMessage{Type: "error", Message: "Server is shutting down"})
+		wsMu.Lock()
+		_ = wsConn.WriteClose(closeStatusGoingAway)
+		wsMu.Unlock()
+		cancel()
+		_ = rdpClient.Close()
+	})
 
 	// Start bidirectional data relay
-	startBidirectionalRelay(ctx, cancel, wsConn, rdpClient, &wsMu, params.enableAudio)
+	startBidirectionalRelay(ctx, cancel, wsConn, rdpClient, &wsMu, params.enableAudio, opts)
+
+	logSessionSummary(logging.Default(), opts.stats, rdpClient.GetServerCapabilities(), time.Now())
 }
 
 // resizeRequest represents a display resize request from the browser
@@ -307,7 +957,153 @@ type resizer interface {
 	IsDisplayControlReady() bool
 }
 
+// controlMarkerMin is the lowest first byte treated as a browser control
+// marker. Every FastPath input event starts with an eventHeader whose top
+// three bits carry an event code of 0-6, so a first byte with event code 7
+// (0xE0-0xFF) can never be input and is reserved for control messages.
+const controlMarkerMin = 0xE0
+
+// isControlMarker reports whether a browser message starts with a control marker.
+func isControlMarker(data []byte) bool {
+	return len(data) > 0 && data[0] >= controlMarkerMin
+}
+
+// unicodeInputMarker prefixes typed characters from the browser:
+// [0xFB][UTF-16LE code units], sent as Unicode keyboard events.
+const unicodeInputMarker = 0xFB
+
+// clipboardMarker prefixes clipboard text in both directions:
+// [0xFC][UTF-8 text].
+const clipboardMarker = 0xFC
+
+// microphoneMarker prefixes captured microphone audio from the browser:
+// [0xFD][PCM samples in the format announced by the "microphone" message].
+const microphoneMarker = 0xFD
+
+// frameAckMarker acknowledges that the browser rendered a frame:
+// [0xFA][frameId:4, little-endian].
+const frameAckMarker = 0xFA
+
+// errUnknownControlMarker is returned when the browser sends a marker this
+// gateway does not understand.
+var errUnknownControlMarker = errors.New("unknown control marker")
+
+// clipboardWriter interface for clipboard redirection
+type clipboardWriter interface {
+	SetClipboardText(text string) error
+}
+
+// audioInputWriter interface for microphone redirection
+type audioInputWriter interface {
+	SendAudioInput(data []byte) error
+}
+
+// frameAcknowledger interface for frame acknowledgement
+type frameAcknowledger interface {
+	AcknowledgeFrame(frameID uint32) error
+}
+
+// disconnecter is implemented by RDP connections that can log off with
+// disconnect PDUs rather than just dropping the TCP connection
+type disconnecter interface {
+	Disconnect(reason uint8) error
+}
+
+// disconnectRDP ends the RDP session with the given MCS reason, if the
+// connection supports it
+func disconnectRDP(rdpConn rdpConn, reason uint8) {
+	d, ok := rdpConn.(disconnecter)
+	if !ok {
+		return
+	}
+	if err := d.Disconnect(reason); err != nil {
+		logging.Debug("RDP disconnect: %v", err)
+	}
+}
+
+// handleControlMarker processes a browser control message.
+func handleControlMarker(data []byte, rdpConn rdpConn) error {
+	switch data[0] {
+	case clipboardMarker:
+		writer, ok := rdpConn.(clipboardWriter)
+		if !ok {
+			logging.Debug("Clipboard not supported by connection, paste ignored")
+			return nil
+		}
+		if !utf8.Valid(data[1:]) {
+			logging.Debug("Dropping clipboard message with invalid UTF-8")
+			return nil
+		}
+		if err := writer.SetClipboardText(string(data[1:])); err != nil {
+			logging.Debug("Clipboard paste failed: %v", err)
+		}
+		return nil
+	case microphoneMarker:
+		writer, ok := rdpConn.(audioInputWriter)
+		if !ok {
+			logging.Debug("Microphone not supported by connection, audio ignored")
+			return nil
+		}
+		if err := writer.SendAudioInput(data[1:]); err != nil && !errors.Is(err, rdp.ErrAudioInputNotEnabled) {
+			logging.Debug("Microphone audio dropped: %v", err)
+		}
+		return nil
+	case unicodeInputMarker:
+		sendUnicodeInput(data[1:], rdpConn)
+		return nil
+	case frameAckMarker:
+		acker, ok := rdpConn.(frameAcknowledger)
+		if !ok || len(data) != 5 {
+			return nil
+		}
+		if err := acker.AcknowledgeFrame(binary.LittleEndian.Uint32(data[1:])); err != nil {
+			logging.Debug("Frame acknowledge dropped: %v", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w 0x%02X", errUnknownControlMarker, data[0])
+}
+
+// sendUnicodeInput types the UTF-16LE code units in payload as Unicode
+// keyboard events. Surrogate pairs are sent as two events; unpaired
+// surrogates are dropped.
+func sendUnicodeInput(payload []byte, rdpConn rdpConn) {
+	if len(payload)%2 != 0 {
+		logging.Debug("Dropping Unicode input with odd length %d", len(payload))
+		return
+	}
+
+	units := make([]uint16, 0, len(payload)/2)
+	for i := 0; i < len(payload); i += 2 {
+		unit := binary.LittleEndian.Uint16(payload[i:])
+		if !utf16.IsSurrogate(rune(unit)) {
+			units = append(units, unit)
+			continue
+		}
+		if i+3 < len(payload) {
+			low := binary.LittleEndian.Uint16(payload[i+2:])
+			if utf16.DecodeRune(rune(unit), rune(low)) != utf8.RuneError {
+				units = append(units, unit, low)
+				i += 2
+				continue
+			}
+		}
+		logging.Debug("Dropping unpaired surrogate 0x%04X", unit)
+	}
+
+	for _, event := range pdu.NewUnicodeKeyStrokes(units) {
+		if err := rdpConn.SendInputEvent(event.Serialize()); err != nil {
+			logging.Debug("Unicode input dropped: %v", err)
+			return
+		}
+	}
+}
+
 func wsToRdp(ctx context.Context, wsConn *websocket.Conn, rdpConn rdpConn, cancel context.CancelFunc) {
+	wsToRdpWithOptions(ctx, wsConn, rdpConn, cancel, relayOptions{})
+}
+
+func wsToRdpWithOptions(ctx context.Context, wsConn *websocket.Conn, rdpConn rdpConn, cancel context.CancelFunc, opts relayOptions) {
 	defer func() {
 		if r := recover(); r != nil {
 			logging.Error("Panic in wsToRdp: %v", r)
@@ -317,6 +1113,11 @@ func wsToRdp(ctx context.Context, wsConn *websocket.Conn, rdpConn rdpConn, cance
 	// Check if rdpConn supports resize
 	resizerConn, supportsResize := rdpConn.(resizer)
 
+	readTimeout := opts.readTimeout
+	if readTimeout <= 0 {
+		readTimeout = browserReadTimeout
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -325,17 +1126,53 @@ func wsToRdp(ctx context.Context, wsConn *websocket.Conn, rdpConn rdpConn, cance
 		}
 
 		// Apply a read deadline to avoid hung connections keeping goroutines alive
-		_ = wsConn.SetReadDeadline(time.Now().Add(30 * time.Second))
+		_ = wsConn.SetReadDeadline(time.Now().Add(readTimeout))
 
 		var data []byte
 		if err := websocket.Message.Receive(wsConn, &data); err != nil {
-			if err == io.EOF || strings.Contains(err.Error(), "use of closed network connection") {
+			if err == io.EOF {
+				// The browser closed the session; log off rather than drop it
+				opts.stats.ended(reasonBrowserClosed)
+				cancel()
+				disconnectRDP(rdpConn, mcs.RNUserRequested)
 				return
 			}
-			logging.Error("Error reading message from WS: %v", err)
+			if strings.Contains(err.Error(), "use of closed network connection") {
+				return
+			}
+			if isTimeout(err) {
+				logging.Info("Browser idle, closing session")
+				opts.stats.ended(reasonIdleTimeout)
+				_ = wsConn.WriteClose(closeStatusIdleTimeout)
+			} else if errors.Is(err, websocket.ErrFrameTooLarge) {
+				logging.Warn("Closing session: browser message exceeds %d bytes", wsConn.MaxPayloadBytes)
+				opts.stats.ended(reasonProtocolError)
+				sendError(wsConn, "Message too large")
+				_ = wsConn.WriteClose(closeStatusMessageTooBig)
+			} else {
+				logging.Error("Error reading message from WS: %v", err)
+				opts.stats.ended(reasonBrowserError)
+			}
 			cancel()
+			disconnectRDP(rdpConn, mcs.RNProviderInitiated)
 			return
 		}
+		opts.stats.received(len(data))
+
+		if isControlMarker(data) {
+			if err := handleControlMarker(data, rdpConn); err != nil {
+				if !opts.closeOnUnknownMarker {
+					logging.Debug("Dropping browser message: %v", err)
+					continue
+				}
+				logging.Warn("Closing session: %v", err)
+				opts.stats.ended(reasonProtocolError)
+				_ = wsConn.WriteClose(closeStatusProtocolError)
+				cancel()
+				return
+			}
+			continue
+		}
 
 		// Check if this is a JSON message (starts with '{')
 		if len(data) > 0 && data[0] == '{' {
@@ -363,18 +1200,52 @@ func wsToRdp(ctx context.Context, wsConn *websocket.Conn, rdpConn rdpConn, cance
 
 		if err := rdpConn.SendInputEvent(data); err != nil {
 			logging.Error("Failed writing to RDP: %v", err)
+			opts.stats.ended(reasonRDPError)
 			return
 		}
 	}
 }
 
 func rdpToWsWithMutex(ctx context.Context, rdpConn rdpConn, wsConn *websocket.Conn, wsMu *sync.Mutex) {
+	rdpToWsWithOptions(ctx, rdpConn, wsConn, wsMu, relayOptions{})
+}
+
+func rdpToWsWithOptions(ctx context.Context, rdpConn rdpConn, wsConn *websocket.Conn, wsMu *sync.Mutex, opts relayOptions) {
 	defer func() {
 		if r := recover(); r != nil {
 			logging.Error("Panic in rdpToWs: %v", r)
 		}
 	}()
 
+	if opts.watchdog != nil {
+		watchdogCtx, stopWatchdog := context.WithCancel(ctx)
+		defer stopWatchdog()
+		go opts.watchdog.run(watchdogCtx, func() {
+			logging.Warn("No updates from RDP server for %v, session may be unresponsive", opts.watchdog.idle)
+			sendControlMessageWithMutex(wsConn, wsMu, unresponsiveWarning())
+		})
+		// A static desktop sends no updates, but the server heartbeats
+		// still show the session is alive
+		if notifier, ok := rdpConn.(heartbeatNotifier); ok {
+			notifier.SetHeartbeatCallback(func(int) { opts.watchdog.touch() })
+		}
+	}
+
+	if opts.heartbeat != nil {
+		heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+		defer stopHeartbeat()
+		go opts.heartbeat.run(heartbeatCtx, wsConn, wsMu)
+	}
+
+	getUpdate := rdpConn.GetUpdate
+	if updater, ok := rdpConn.(contextUpdater); ok {
+		getUpdate = func() (*rdp.Update, error) { return updater.GetUpdateContext(ctx) }
+	}
+	if backlog, ok := rdpConn.(backlogReporter); ok && opts.skipFrames {
+		getUpdate = newFrameSkipper(getUpdate, backlog.Backlogged).next
+	}
+	pointers := newPointerCache()
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -382,18 +1253,44 @@ func rdpToWsWithMutex(ctx context.Context, rdpConn rdpConn, wsConn *websocket.Co
 		default:
 		}
 
-		update, err := rdpConn.GetUpdate()
+		update, err := getUpdate()
 		switch {
 		case err == nil:
 		case errors.Is(err, pdu.ErrDeactivateAll):
+			opts.stats.ended(reasonServerLogoff)
+			writeCloseWithMutex(wsConn, wsMu, closeStatusLogoff)
+			return
+		case errors.Is(err, mcs.ErrDisconnectUltimatum), errors.Is(err, x224.ErrDisconnectRequest):
+			logging.Info("RDP server ended the session")
+			opts.stats.ended(reasonServerLogoff)
+			writeCloseWithMutex(wsConn, wsMu, closeStatusLogoff)
+			return
+		case errors.Is(err, rdp.ErrServerUnresponsive):
+			logging.Warn("RDP server sent nothing, not even a heartbeat, within the read idle timeout; closing session")
+			opts.stats.ended(reasonUnresponsive)
+			sendControlMessageWithMutex(wsConn, wsMu, errorMessage{Type: "error", Message: "RDP server unresponsive"})
+			writeCloseWithMutex(wsConn, wsMu, closeStatusHostUnreachable)
+			return
+		case ctx.Err() != nil:
+			// The session was ended, interrupting the read
 			return
 		default:
 			logging.Error("Get update: %v", err)
+			opts.stats.ended(reasonRDPError)
 			return
 		}
+		opts.watchdog.touch()
+
+		if msg, ok := pointers.controlMessage(update.Data); ok {
+			sendControlMessageWithMutex(wsConn, wsMu, msg)
+			opts.heartbeat.sent()
+			continue
+		}
+		opts.splash.finish()
+		opts.framebuffer.observe(update.Data)
 
 		wsMu.Lock()
-		err = websocket.Message.Send(wsConn, update.Data)
+		err = sendUpdate(wsConn, update.Data, opts.fragmentSize)
 		wsMu.Unlock()
 
 		if err != nil {
@@ -401,8 +1298,11 @@ func rdpToWsWithMutex(ctx context.Context, rdpConn rdpConn, wsConn *websocket.Co
 				return
 			}
 			logging.Error("Failed sending message to WS: %v", err)
+			opts.stats.ended(reasonBrowserError)
 			return
 		}
+		opts.stats.sent(len(update.Data))
+		opts.heartbeat.sent()
 	}
 }
 
@@ -415,8 +1315,8 @@ func sendCapabilitiesInfoWithMutex(wsConn *websocket.Conn, wsMu *sync.Mutex, rdp
 
 	displayControlReady := rdpClient.IsDisplayControlReady()
 
-	logging.Info("Session: NLA=%v audio=%v channels=%v colorDepth=%d desktop=%s codecs=%v displayControl=%v",
-		caps.UseNLA, caps.AudioEnabled, caps.Channels, caps.ColorDepth, caps.DesktopSize, caps.BitmapCodecs, displayControlReady)
+	logging.Info("Session: NLA=%v audio=%v channels=%v colorDepth=%d desktop=%s codecs=%v advertised=%v displayControl=%v",
+		caps.UseNLA, caps.AudioEnabled, caps.Channels, caps.ColorDepth, caps.DesktopSize, caps.BitmapCodecs, caps.AdvertisedCodecs, displayControlReady)
 
 	msg := buildCapabilitiesMessage(caps, displayControlReady)
 
@@ -434,6 +1334,7 @@ func buildCapabilitiesMessage(caps *rdp.ServerCapabilityInfo, displayControlRead
 	payload := map[string]any{
 		"type":                "capabilities",
 		"codecs":              caps.BitmapCodecs,
+		"advertisedCodecs":    caps.AdvertisedCodecs,
 		"surfaceCommands":     caps.SurfaceCommands,
 		"colorDepth":          caps.ColorDepth,
 		"desktopSize":         caps.DesktopSize,
@@ -442,23 +1343,199 @@ func buildCapabilitiesMessage(caps *rdp.ServerCapabilityInfo, displayControlRead
 		"frameAcknowledge":    caps.FrameAcknowledge,
 		"useNLA":              caps.UseNLA,
 		"audioEnabled":        caps.AudioEnabled,
+		"clipboardEnabled":    caps.ClipboardEnabled,
 		"channels":            caps.Channels,
 		"logLevel":            logLevel,
 		"displayControlReady": displayControlReady,
+		"bitmapCacheCells":    caps.BitmapCacheCells,
+		"bitmapCacheHits":     caps.BitmapCacheHits,
+		"bitmapCacheMisses":   caps.BitmapCacheMisses,
+		"bitmapCacheSkipped":  caps.BitmapCacheSkipped,
+		"serverRdpVersion":    caps.ServerRDPVersion,
 	}
 
+	return buildControlMessage(payload)
+}
+
+// controlMessageGzipFlag follows the 0xFF marker of a control message whose
+// JSON is gzip-compressed. Plain JSON never starts with this byte.
+const controlMessageGzipFlag = 0x01
+
+// controlMessageCompressThreshold is the JSON size above which control
+// messages are gzip-compressed; smaller ones are sent as plain JSON.
+const controlMessageCompressThreshold = 4096
+
+// buildControlMessage encodes a JSON control message for the browser,
+// prefixed with the 0xFF marker so it is not mistaken for an update. JSON
+// larger than controlMessageCompressThreshold is gzipped and flagged.
+func buildControlMessage(payload any) []byte {
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		logging.Error("Failed to marshal capabilities: %v", err)
+		logging.Error("Failed to marshal control message: %v", err)
 		return nil
 	}
 
+	if len(jsonData) > controlMessageCompressThreshold {
+		var buf bytes.Buffer
+		buf.Write([]byte{0xFF, controlMessageGzipFlag})
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(jsonData); err == nil && zw.Close() == nil && buf.Len() < len(jsonData) {
+			return buf.Bytes()
+		}
+	}
+
 	msg := make([]byte, 1+len(jsonData))
 	msg[0] = 0xFF
 	copy(msg[1:], jsonData)
 	return msg
 }
 
+// sendControlMessageWithMutex sends a JSON control message to the browser.
+func sendControlMessageWithMutex(wsConn *websocket.Conn, wsMu *sync.Mutex, payload any) {
+	msg := buildControlMessage(payload)
+	if msg == nil {
+		return
+	}
+
+	wsMu.Lock()
+	defer wsMu.Unlock()
+	if err := websocket.Message.Send(wsConn, msg); err != nil {
+		logging.Debug("Failed to send control message: %v", err)
+	}
+}
+
+// warningMessage is the JSON structure for non-fatal session warnings
+type warningMessage struct {
+	Type    string `json:"type"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// microphoneMessage tells the browser to start (or reconfigure) microphone
+// capture once the server opens the AUDIO_INPUT channel.
+type microphoneMessage struct {
+	Type            string `json:"type"`
+	SampleRate      uint32 `json:"sampleRate"`
+	Channels        uint16 `json:"channels"`
+	BitsPerSample   uint16 `json:"bitsPerSample"`
+	FramesPerPacket uint32 `json:"framesPerPacket"`
+}
+
+func newMicrophoneMessage(format *audio.AudioFormat, framesPerPacket uint32) microphoneMessage {
+	return microphoneMessage{
+		Type:            "microphone",
+		SampleRate:      format.SamplesPerSec,
+		Channels:        format.Channels,
+		BitsPerSample:   format.BitsPerSample,
+		FramesPerPacket: framesPerPacket,
+	}
+}
+
+// monitorLayoutMessage forwards the server's Monitor Layout PDU so the
+// browser can arrange one canvas per monitor.
+type monitorLayoutMessage struct {
+	Type     string        `json:"type"`
+	Monitors []monitorRect `json:"monitors"`
+}
+
+// monitorRect is one monitor in desktop coordinates. X and Y are negative
+// for monitors left of or above the primary.
+type monitorRect struct {
+	X       int  `json:"x"`
+	Y       int  `json:"y"`
+	Width   int  `json:"width"`
+	Height  int  `json:"height"`
+	Primary bool `json:"primary"`
+}
+
+func newMonitorLayoutMessage(monitors []pdu.MonitorDef) monitorLayoutMessage {
+	rects := make([]monitorRect, len(monitors))
+	for i, m := range monitors {
+		rects[i] = monitorRect{
+			X:       int(m.Left),
+			Y:       int(m.Top),
+			Width:   m.Width(),
+			Height:  m.Height(),
+			Primary: m.IsPrimary(),
+		}
+	}
+	return monitorLayoutMessage{Type: "monitorLayout", Monitors: rects}
+}
+
+// reconnectCookieMessage carries the server's auto-reconnect cookie, which
+// the browser passes back as the reconnect query parameter.
+type reconnectCookieMessage struct {
+	Type   string `json:"type"`
+	Cookie string `json:"cookie"`
+}
+
+func newReconnectCookieMessage(cookie []byte) reconnectCookieMessage {
+	return reconnectCookieMessage{Type: "reconnectCookie", Cookie: base64.StdEncoding.EncodeToString(cookie)}
+}
+
+// logonErrorMessage carries a logon error notification from the server.
+// Reason is human-readable, such as "account locked"; the raw codes are
+// the ErrorNotificationType and ErrorNotificationData of TS_LOGON_ERRORS_INFO.
+type logonErrorMessage struct {
+	Type             string `json:"type"`
+	Reason           string `json:"reason"`
+	Failed           bool   `json:"failed"`
+	NotificationType uint32 `json:"notificationType"`
+	NotificationData uint32 `json:"notificationData"`
+}
+
+func newLogonErrorMessage(info *pdu.LogonErrorsInfo) logonErrorMessage {
+	return logonErrorMessage{
+		Type:             "logonError",
+		Reason:           info.Reason(),
+		Failed:           info.Failed(),
+		NotificationType: info.ErrorNotificationType,
+		NotificationData: info.ErrorNotificationData,
+	}
+}
+
+// statusInfoMessage carries connection progress reported by the server.
+// Message is human-readable, such as "Waking the virtual machine"; Code is
+// the raw TS_STATUS_* value.
+type statusInfoMessage struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	Code    uint32 `json:"code"`
+}
+
+func newStatusInfoMessage(status *pdu.StatusInfoPDUData) statusInfoMessage {
+	return statusInfoMessage{Type: "statusInfo", Message: status.Message(), Code: status.StatusCode}
+}
+
+// connectPhaseMessage tells the browser a phase of the connection sequence
+// has been reached. Failed is set when the sequence then failed; Phase is
+// the last phase reached. Retries and redirections start over from
+// tcp_connected.
+type connectPhaseMessage struct {
+	Type      string `json:"type"`
+	Phase     string `json:"phase"`
+	ElapsedMs int64  `json:"elapsedMs"` // since the server was dialed
+	Failed    bool   `json:"failed,omitempty"`
+}
+
+func newConnectPhaseMessage(event rdp.ConnectEvent) connectPhaseMessage {
+	return connectPhaseMessage{
+		Type:      "connectPhase",
+		Phase:     event.Phase.String(),
+		ElapsedMs: event.Elapsed.Milliseconds(),
+		Failed:    event.Err != nil,
+	}
+}
+
+// unresponsiveWarning tells the browser the update stream has stalled.
+func unresponsiveWarning() warningMessage {
+	return warningMessage{
+		Type:    "warning",
+		Reason:  "unresponsive",
+		Message: "Remote session may be unresponsive",
+	}
+}
+
 func codecListToJSON(codecs []string) string {
 	if len(codecs) == 0 {
 		return ""
@@ -500,26 +1577,61 @@ func isAllowedOrigin(origin string) bool {
 	return true
 }
 
+// IsOriginAllowed reports whether a browser at origin may make cross-origin
+// requests: the origin is well formed and either matches an entry of
+// allowedOrigins, which "*" matches entirely, or is the same origin as the
+// request host. Entries are compared case-insensitively without a trailing
+// slash, so the scheme and port must match too.
 func IsOriginAllowed(origin string, allowedOrigins []string, host string) bool {
-	if origin == "" {
+	if !isAllowedOrigin(origin) {
 		return false
 	}
 
-	parsed, err := url.Parse(origin)
-	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
-		return false
+	parsed, _ := url.Parse(origin)
+	if host != "" && strings.EqualFold(parsed.Host, host) {
+		return true
 	}
-	_ = allowedOrigins
-	_ = host
-	return true
+
+	origin = normalizeOrigin(origin)
+	for _, allowed := range allowedOrigins {
+		allowed = strings.TrimSpace(allowed)
+		if allowed == "*" || normalizeOrigin(allowed) == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeOrigin lowercases an origin and drops any trailing slash
+func normalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(origin), "/")
 }
 
+// closeStatusProtocolError is the WebSocket close code for protocol violations (RFC 6455)
+const closeStatusProtocolError = 1002
+
 // Audio message types for WebSocket
 const (
 	AudioMsgTypeData   = 0x01 // Audio PCM data
 	AudioMsgTypeFormat = 0x02 // Audio format info
 )
 
+// sendClipboardTextWithMutex sends remote clipboard text to the browser
+// Format: [0xFC][UTF-8 text]
+func sendClipboardTextWithMutex(wsConn *websocket.Conn, wsMu *sync.Mutex, text string) {
+	msg := make([]byte, 1+len(text))
+	msg[0] = clipboardMarker
+	copy(msg[1:], text)
+
+	wsMu.Lock()
+	err := websocket.Message.Send(wsConn, msg)
+	wsMu.Unlock()
+
+	if err != nil {
+		logging.Debug("Failed to send clipboard text: %v", err)
+	}
+}
+
 // sendAudioDataWithMutex sends audio data to the browser over WebSocket with per-connection mutex
 // Format: [0xFE][msgType][timestamp 2 bytes][format info if type=format][data]
 func sendAudioDataWithMutex(wsConn *websocket.Conn, wsMu *sync.Mutex, data []byte, format *audio.AudioFormat, timestamp uint16) {
@@ -1,10 +1,18 @@
 package handler
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"strings"
 	"sync"
@@ -13,8 +21,12 @@ import (
 
 	"golang.org/x/net/websocket"
 
+	"github.com/rcarmo/go-rdp/internal/config"
 	"github.com/rcarmo/go-rdp/internal/protocol/audio"
+	"github.com/rcarmo/go-rdp/internal/protocol/fastpath"
+	"github.com/rcarmo/go-rdp/internal/protocol/mcs"
 	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+	"github.com/rcarmo/go-rdp/internal/protocol/x224"
 	"github.com/rcarmo/go-rdp/internal/rdp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -284,6 +296,37 @@ func TestRdpToWs_ContextCancellation(t *testing.T) {
 	}
 }
 
+// contextRDPConnection blocks in GetUpdateContext until its context ends
+type contextRDPConnection struct {
+	mockRDPConnection
+}
+
+func (c *contextRDPConnection) GetUpdateContext(ctx context.Context) (*rdp.Update, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// TestRdpToWs_CancelInterruptsBlockedUpdate tests that cancelling the session
+// ends rdpToWs while it waits for an update, without closing the connection
+func TestRdpToWs_CancelInterruptsBlockedUpdate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		rdpToWs(ctx, &contextRDPConnection{}, nil)
+		close(done)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("rdpToWs did not return after cancellation")
+	}
+}
+
 // TestRdpToWs_DeactivateAllError tests handling of ErrDeactivateAll
 func TestRdpToWs_DeactivateAllError(t *testing.T) {
 	mockRDP := &mockRDPConnection{
@@ -524,6 +567,91 @@ func TestWsToRdp_WebSocketEOF(t *testing.T) {
 	}
 }
 
+// disconnectingRDPConnection records the reasons it was disconnected with
+type disconnectingRDPConnection struct {
+	mockRDPConnection
+	reasons chan uint8
+}
+
+func (m *disconnectingRDPConnection) Disconnect(reason uint8) error {
+	m.reasons <- reason
+	return nil
+}
+
+// runWsToRdp serves one WebSocket with wsToRdp and returns the server URL, a
+// channel closed when wsToRdp returns, and the session context
+func runWsToRdp(t *testing.T, rdpConn rdpConn) (string, <-chan struct{}, context.Context) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	done := make(chan struct{})
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		wsToRdp(ctx, ws, rdpConn, cancel)
+		close(done)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, done, ctx
+}
+
+func TestWsToRdp_NormalCloseDisconnects(t *testing.T) {
+	mockRDP := &disconnectingRDPConnection{reasons: make(chan uint8, 1)}
+	url, done, ctx := runWsToRdp(t, mockRDP)
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(url, "http"), "", "http://localhost/")
+	require.NoError(t, err)
+	_ = ws.Close()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("wsToRdp did not return on WebSocket close")
+	}
+	assert.Equal(t, mcs.RNUserRequested, <-mockRDP.reasons)
+	assert.Error(t, ctx.Err(), "session context should be cancelled")
+}
+
+func TestWsToRdp_ReadErrorDisconnects(t *testing.T) {
+	mockRDP := &disconnectingRDPConnection{reasons: make(chan uint8, 1)}
+	url, done, ctx := runWsToRdp(t, mockRDP)
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	require.NoError(t, err)
+	defer conn.Close()
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(url, "http"), "http://localhost/")
+	require.NoError(t, err)
+	_, err = websocket.NewClient(config, conn)
+	require.NoError(t, err)
+
+	// A binary frame header claiming a payload far over the read limit
+	_, err = conn.Write([]byte{0x82, 0xFF, 0x00, 0x00, 0x00, 0x10, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+	require.NoError(t, err)
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("wsToRdp did not return on read error")
+	}
+	assert.Equal(t, mcs.RNProviderInitiated, <-mockRDP.reasons)
+	assert.Error(t, ctx.Err(), "session context should be cancelled")
+}
+
+func TestRdpToWs_ServerDisconnect(t *testing.T) {
+	for _, serverErr := range []error{mcs.ErrDisconnectUltimatum, x224.ErrDisconnectRequest} {
+		mockRDP := &mockRDPConnection{updateError: fmt.Errorf("get X.224 update: %w", serverErr)}
+
+		done := make(chan struct{})
+		go func() {
+			rdpToWs(context.Background(), mockRDP, nil)
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("rdpToWs did not return on %v", serverErr)
+		}
+	}
+}
+
 // TestRdpToWs_ClosedConnectionError tests handling of closed connection error message
 func TestRdpToWs_ClosedConnectionError(t *testing.T) {
 	mockRDP := &mockRDPConnection{
@@ -2094,3 +2222,566 @@ func TestBuildCapabilitiesMessageWithDisplayControl(t *testing.T) {
 		assert.Contains(t, jsonStr, `"displayControlReady":false`)
 	})
 }
+
+func TestBuildCapabilitiesMessage_BitmapCache(t *testing.T) {
+	caps := &rdp.ServerCapabilityInfo{BitmapCacheCells: 3, BitmapCacheHits: 12, BitmapCacheMisses: 1, BitmapCacheSkipped: 2}
+	msg := buildCapabilitiesMessage(caps, false)
+	require.NotNil(t, msg)
+
+	jsonStr := string(msg[1:]) // Skip 0xFF marker
+	assert.Contains(t, jsonStr, `"bitmapCacheCells":3`)
+	assert.Contains(t, jsonStr, `"bitmapCacheHits":12`)
+	assert.Contains(t, jsonStr, `"bitmapCacheMisses":1`)
+	assert.Contains(t, jsonStr, `"bitmapCacheSkipped":2`)
+}
+
+func TestBuildCapabilitiesMessage_ServerRDPVersion(t *testing.T) {
+	caps := &rdp.ServerCapabilityInfo{ServerRDPVersion: "10.7"}
+	msg := buildCapabilitiesMessage(caps, false)
+	require.NotNil(t, msg)
+
+	jsonStr := string(msg[1:]) // Skip 0xFF marker
+	assert.Contains(t, jsonStr, `"serverRdpVersion":"10.7"`)
+}
+
+func TestBuildCapabilitiesMessage_CompressesLargePayload(t *testing.T) {
+	channels := make([]string, 500)
+	for i := range channels {
+		channels[i] = fmt.Sprintf("chan%03d", i)
+	}
+	caps := &rdp.ServerCapabilityInfo{BitmapCodecs: []string{"RFX"}, Channels: channels}
+	msg := buildCapabilitiesMessage(caps, false)
+	require.NotNil(t, msg)
+	assert.Equal(t, []byte{0xFF, controlMessageGzipFlag}, msg[:2])
+
+	zr, err := gzip.NewReader(bytes.NewReader(msg[2:]))
+	require.NoError(t, err)
+	jsonData, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Greater(t, len(jsonData), controlMessageCompressThreshold)
+	assert.Less(t, len(msg), len(jsonData))
+
+	var decoded struct {
+		Type     string   `json:"type"`
+		Codecs   []string `json:"codecs"`
+		Channels []string `json:"channels"`
+	}
+	require.NoError(t, json.Unmarshal(jsonData, &decoded))
+	assert.Equal(t, "capabilities", decoded.Type)
+	assert.Equal(t, []string{"RFX"}, decoded.Codecs)
+	assert.Equal(t, channels, decoded.Channels)
+}
+
+func TestBuildControlMessage_SmallPayloadUncompressed(t *testing.T) {
+	msg := buildControlMessage(warningMessage{Type: "warning", Reason: "test", Message: "hello"})
+	require.NotNil(t, msg)
+	assert.Equal(t, byte(0xFF), msg[0])
+	assert.JSONEq(t, `{"type":"warning","reason":"test","message":"hello"}`, string(msg[1:]))
+}
+
+// TestWsToRdp_UnknownMarkerDropped tests that unknown control markers are dropped by default
+func TestWsToRdp_UnknownMarkerDropped(t *testing.T) {
+	mockRDP := &mockRDPConnection{}
+	validInput := []byte{0x04, 0x05, 0x06}
+
+	done := make(chan struct{})
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		wsToRdp(ctx, ws, mockRDP, cancel)
+		close(done)
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	ws, err := websocket.Dial(wsURL, "", "http://localhost/")
+	require.NoError(t, err)
+
+	require.NoError(t, websocket.Message.Send(ws, []byte{0xE0, 0x01, 0x02}))
+	require.NoError(t, websocket.Message.Send(ws, validInput))
+
+	time.Sleep(50 * time.Millisecond)
+	_ = ws.Close()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("wsToRdp did not complete")
+	}
+
+	mockRDP.mu.Lock()
+	defer mockRDP.mu.Unlock()
+	require.Len(t, mockRDP.receivedInputs, 1, "unknown marker must not reach RDP")
+	assert.Equal(t, validInput, mockRDP.receivedInputs[0])
+}
+
+// TestWsToRdp_UnknownMarkerClosePolicy tests that the close policy ends the session
+func TestWsToRdp_UnknownMarkerClosePolicy(t *testing.T) {
+	mockRDP := &mockRDPConnection{}
+	cancelled := make(chan struct{})
+
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var once sync.Once
+		wsToRdpWithOptions(ctx, ws, mockRDP, func() {
+			once.Do(func() { close(cancelled) })
+			cancel()
+		}, relayOptions{closeOnUnknownMarker: true})
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	ws, err := websocket.Dial(wsURL, "", "http://localhost/")
+	require.NoError(t, err)
+	defer func() { _ = ws.Close() }()
+
+	require.NoError(t, websocket.Message.Send(ws, []byte{0xE0, 0x01, 0x02}))
+
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("session was not cancelled on unknown marker")
+	}
+
+	mockRDP.mu.Lock()
+	defer mockRDP.mu.Unlock()
+	assert.Empty(t, mockRDP.receivedInputs)
+}
+
+func TestIsControlMarker(t *testing.T) {
+	assert.False(t, isControlMarker(nil))
+	assert.False(t, isControlMarker([]byte{0xDF}), "event code 6 is valid input")
+	assert.True(t, isControlMarker([]byte{0xE0}))
+	assert.True(t, isControlMarker([]byte{0xFF}))
+}
+
+// mockClipboardConn records clipboard text offered by the browser
+type mockClipboardConn struct {
+	mockRDPConnection
+	clipboard []string
+}
+
+func (m *mockClipboardConn) SetClipboardText(text string) error {
+	m.clipboard = append(m.clipboard, text)
+	return nil
+}
+
+func TestHandleControlMarker_Clipboard(t *testing.T) {
+	conn := &mockClipboardConn{}
+
+	require.NoError(t, handleControlMarker(append([]byte{clipboardMarker}, "héllo"...), conn))
+	require.NoError(t, handleControlMarker([]byte{clipboardMarker, 0xFF, 0xFE}, conn), "invalid UTF-8 is dropped")
+	assert.Equal(t, []string{"héllo"}, conn.clipboard)
+	assert.Empty(t, conn.receivedInputs)
+
+	// Connections without clipboard support ignore the message
+	assert.NoError(t, handleControlMarker([]byte{clipboardMarker, 'x'}, &mockRDPConnection{}))
+
+	assert.ErrorIs(t, handleControlMarker([]byte{0xE0}, conn), errUnknownControlMarker)
+}
+
+func TestHandleControlMarker_UnicodeInput(t *testing.T) {
+	conn := &mockRDPConnection{}
+
+	// "é", U+1F600 as a surrogate pair, then an unpaired high surrogate
+	msg := []byte{unicodeInputMarker, 0xE9, 0x00, 0x3D, 0xD8, 0x00, 0xDE, 0x3D, 0xD8}
+	require.NoError(t, handleControlMarker(msg, conn))
+
+	var wire [][]byte
+	for _, event := range conn.receivedInputs {
+		wire = append(wire, fastpath.NewInputEventPDU(event).Serialize())
+	}
+	assert.Equal(t, [][]byte{
+		{0x04, 0x05, 0x80, 0xE9, 0x00}, {0x04, 0x05, 0x81, 0xE9, 0x00},
+		{0x04, 0x05, 0x80, 0x3D, 0xD8}, {0x04, 0x05, 0x81, 0x3D, 0xD8},
+		{0x04, 0x05, 0x80, 0x00, 0xDE}, {0x04, 0x05, 0x81, 0x00, 0xDE},
+	}, wire)
+
+	// Odd-length payloads are dropped without ending the session
+	conn.receivedInputs = nil
+	assert.NoError(t, handleControlMarker([]byte{unicodeInputMarker, 0x41}, conn))
+	assert.Empty(t, conn.receivedInputs)
+}
+
+// mockMicrophoneConn records microphone audio sent by the browser
+type mockMicrophoneConn struct {
+	mockRDPConnection
+	audio [][]byte
+	err   error
+}
+
+func (m *mockMicrophoneConn) SendAudioInput(data []byte) error {
+	m.audio = append(m.audio, data)
+	return m.err
+}
+
+func TestHandleControlMarker_Microphone(t *testing.T) {
+	conn := &mockMicrophoneConn{}
+
+	require.NoError(t, handleControlMarker([]byte{microphoneMarker, 0x01, 0x02, 0x03, 0x04}, conn))
+	assert.Equal(t, [][]byte{{0x01, 0x02, 0x03, 0x04}}, conn.audio)
+	assert.Empty(t, conn.receivedInputs)
+
+	// Send failures drop the packet without ending the session
+	conn.err = rdp.ErrAudioInputNotEnabled
+	assert.NoError(t, handleControlMarker([]byte{microphoneMarker, 0x05, 0x06}, conn))
+
+	// Connections without microphone support ignore the message
+	assert.NoError(t, handleControlMarker([]byte{microphoneMarker, 0x01, 0x02}, &mockRDPConnection{}))
+}
+
+// mockFrameAckConn records frames acknowledged by the browser
+type mockFrameAckConn struct {
+	mockRDPConnection
+	acked []uint32
+}
+
+func (m *mockFrameAckConn) AcknowledgeFrame(frameID uint32) error {
+	m.acked = append(m.acked, frameID)
+	return nil
+}
+
+func TestHandleControlMarker_FrameAcknowledge(t *testing.T) {
+	conn := &mockFrameAckConn{}
+
+	require.NoError(t, handleControlMarker([]byte{frameAckMarker, 0x2A, 0x00, 0x00, 0x01}, conn))
+	assert.Equal(t, []uint32{0x0100002A}, conn.acked)
+	assert.Empty(t, conn.receivedInputs)
+
+	// Truncated messages are dropped without ending the session
+	assert.NoError(t, handleControlMarker([]byte{frameAckMarker, 0x2A}, conn))
+	assert.Len(t, conn.acked, 1)
+
+	// Connections without frame acknowledgement ignore the message
+	assert.NoError(t, handleControlMarker([]byte{frameAckMarker, 0x01, 0x00, 0x00, 0x00}, &mockRDPConnection{}))
+}
+
+func TestNewMicrophoneMessage(t *testing.T) {
+	format := &audio.AudioFormat{FormatTag: audio.WAVE_FORMAT_PCM, Channels: 1, SamplesPerSec: 22050, BitsPerSample: 16}
+	msg := buildControlMessage(newMicrophoneMessage(format, 441))
+	require.NotNil(t, msg)
+	assert.Equal(t, byte(0xFF), msg[0])
+	assert.JSONEq(t, `{"type":"microphone","sampleRate":22050,"channels":1,"bitsPerSample":16,"framesPerPacket":441}`, string(msg[1:]))
+}
+
+func TestNewMonitorLayoutMessage(t *testing.T) {
+	msg := buildControlMessage(newMonitorLayoutMessage([]pdu.MonitorDef{
+		{Left: 0, Top: 0, Right: 1919, Bottom: 1079, Flags: pdu.MonitorFlagPrimary},
+		{Left: -1280, Top: 56, Right: -1, Bottom: 1079},
+	}))
+	require.NotNil(t, msg)
+	assert.Equal(t, byte(0xFF), msg[0])
+	assert.JSONEq(t, `{"type":"monitorLayout","monitors":[
+		{"x":0,"y":0,"width":1920,"height":1080,"primary":true},
+		{"x":-1280,"y":56,"width":1280,"height":1024,"primary":false}
+	]}`, string(msg[1:]))
+}
+
+func TestParseConnectionParams_Reconnect(t *testing.T) {
+	cookie := (&pdu.ARCSCPrivatePacket{LogonID: 3}).Serialize()
+
+	tests := []struct {
+		name    string
+		query   string
+		want    []byte
+		wantErr bool
+	}{
+		{name: "absent", query: ""},
+		{name: "valid", query: base64.StdEncoding.EncodeToString(cookie), want: cookie},
+		{name: "not base64", query: "not*base64", wantErr: true},
+		{name: "wrong length", query: base64.StdEncoding.EncodeToString(cookie[:16]), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/connect?width=800&height=600", nil)
+			if tt.query != "" {
+				q := req.URL.Query()
+				q.Set("reconnect", tt.query)
+				req.URL.RawQuery = q.Encode()
+			}
+
+			params, err := parseConnectionParams(req)
+			if tt.wantErr {
+				require.EqualError(t, err, "invalid reconnect parameter")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, params.reconnectCookie)
+		})
+	}
+}
+
+func TestParseConnectionParams_Monitors(t *testing.T) {
+	tests := []struct {
+		name       string
+		monitors   string
+		wantWidth  int
+		wantHeight int
+		want       []pdu.MonitorDef
+		wantErr    string
+	}{
+		{
+			name:       "two monitors",
+			monitors:   `[{"x":0,"y":0,"width":1920,"height":1080,"primary":true},{"x":-1280,"y":56,"width":1280,"height":1024}]`,
+			wantWidth:  3200,
+			wantHeight: 1080,
+			want: []pdu.MonitorDef{
+				{Left: 0, Top: 0, Right: 1919, Bottom: 1079, Flags: pdu.MonitorFlagPrimary},
+				{Left: -1280, Top: 56, Right: -1, Bottom: 1079},
+			},
+		},
+		{
+			name:       "primary moved to the origin",
+			monitors:   `[{"x":1920,"y":0,"width":1920,"height":1080,"primary":true},{"x":0,"y":0,"width":1920,"height":1080}]`,
+			wantWidth:  3840,
+			wantHeight: 1080,
+			want: []pdu.MonitorDef{
+				{Left: 0, Top: 0, Right: 1919, Bottom: 1079, Flags: pdu.MonitorFlagPrimary},
+				{Left: -1920, Top: 0, Right: -1, Bottom: 1079},
+			},
+		},
+		{name: "not json", monitors: `[{`, wantErr: "invalid monitors parameter"},
+		{name: "no primary", monitors: `[{"x":0,"y":0,"width":800,"height":600}]`, wantErr: "0 primary monitors"},
+		{name: "two primaries", monitors: `[{"width":800,"height":600,"primary":true},{"x":800,"width":800,"height":600,"primary":true}]`, wantErr: "2 primary monitors"},
+		{name: "monitor too large", monitors: `[{"width":16385,"height":600,"primary":true}]`, wantErr: "must be 1-16384"},
+		{name: "desktop too large", monitors: `[{"width":16384,"height":600,"primary":true},{"x":16384,"width":800,"height":600}]`, wantErr: "exceeds 16384"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := url.Values{"monitors": {tt.monitors}}
+			req := httptest.NewRequest(http.MethodGet, "/connect?"+q.Encode(), nil)
+
+			params, err := parseConnectionParams(req)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantWidth, params.width)
+			assert.Equal(t, tt.wantHeight, params.height)
+			assert.Equal(t, tt.want, params.monitors)
+		})
+	}
+}
+
+func TestParseConnectionParams_ForceCodec(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    rdp.ForcedCodec
+		wantErr bool
+	}{
+		{name: "absent", query: "", want: rdp.ForcedCodecAuto},
+		{name: "nscodec", query: "nscodec", want: rdp.ForcedCodecNSCodec},
+		{name: "rfx", query: "rfx", want: rdp.ForcedCodecRFX},
+		{name: "none", query: "none", want: rdp.ForcedCodecNone},
+		{name: "unknown", query: "h264", wantErr: true},
+		{name: "wrong case", query: "RFX", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := url.Values{"width": {"800"}, "height": {"600"}}
+			if tt.query != "" {
+				q.Set("forceCodec", tt.query)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/connect?"+q.Encode(), nil)
+
+			params, err := parseConnectionParams(req)
+			if tt.wantErr {
+				require.EqualError(t, err, fmt.Sprintf("invalid forceCodec parameter %q (must be nscodec, rfx or none)", tt.query))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, params.forceCodec)
+		})
+	}
+}
+
+func TestBuildCapabilitiesMessage_AdvertisedCodecs(t *testing.T) {
+	caps := &rdp.ServerCapabilityInfo{
+		BitmapCodecs:     []string{"NSCodec", "RemoteFX"},
+		AdvertisedCodecs: []string{"RemoteFX-Image"},
+	}
+	msg := buildCapabilitiesMessage(caps, false)
+	require.NotNil(t, msg)
+	assert.Contains(t, string(msg[1:]), `"advertisedCodecs":["RemoteFX-Image"]`)
+}
+
+func TestNewReconnectCookieMessage(t *testing.T) {
+	msg := buildControlMessage(newReconnectCookieMessage([]byte{0x1c, 0x00, 0xfe, 0xff}))
+	require.NotNil(t, msg)
+	assert.Equal(t, byte(0xFF), msg[0])
+	assert.JSONEq(t, `{"type":"reconnectCookie","cookie":"HAD+/w=="}`, string(msg[1:]))
+}
+
+func TestNewLogonErrorMessage(t *testing.T) {
+	msg := buildControlMessage(newLogonErrorMessage(&pdu.LogonErrorsInfo{ErrorNotificationType: 0xC0000071, ErrorNotificationData: pdu.LogonFailedUpdatePassword}))
+	require.NotNil(t, msg)
+	assert.Equal(t, byte(0xFF), msg[0])
+	assert.JSONEq(t, `{"type":"logonError","reason":"password expired","failed":true,"notificationType":3221225585,"notificationData":1}`, string(msg[1:]))
+}
+
+func TestNewStatusInfoMessage(t *testing.T) {
+	msg := buildControlMessage(newStatusInfoMessage(&pdu.StatusInfoPDUData{StatusCode: pdu.StatusVMWaking}))
+	require.NotNil(t, msg)
+	assert.Equal(t, byte(0xFF), msg[0])
+	assert.JSONEq(t, `{"type":"statusInfo","message":"Waking the virtual machine","code":1282}`, string(msg[1:]))
+}
+
+func TestNewConnectPhaseMessage(t *testing.T) {
+	msg := buildControlMessage(newConnectPhaseMessage(rdp.ConnectEvent{Phase: rdp.PhaseTLSHandshakeDone, Elapsed: 42 * time.Millisecond}))
+	require.NotNil(t, msg)
+	assert.JSONEq(t, `{"type":"connectPhase","phase":"tls_handshake_done","elapsedMs":42}`, string(msg[1:]))
+
+	failed := newConnectPhaseMessage(rdp.ConnectEvent{Phase: rdp.PhaseNLAComplete, Elapsed: 1500 * time.Millisecond, Err: errors.New("licensing: no license server")})
+	assert.Equal(t, connectPhaseMessage{Type: "connectPhase", Phase: "nla_complete", ElapsedMs: 1500, Failed: true}, failed)
+}
+
+func TestSendClipboardText(t *testing.T) {
+	received := make(chan []byte, 1)
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		var msg []byte
+		if err := websocket.Message.Receive(ws, &msg); err == nil {
+			received <- msg
+		}
+	}))
+	defer server.Close()
+
+	wsURL := strings.Replace(server.URL, "http://", "ws://", 1)
+	ws, err := websocket.Dial(wsURL, "", "http://localhost/")
+	require.NoError(t, err)
+	defer func() { _ = ws.Close() }()
+
+	var mu sync.Mutex
+	sendClipboardTextWithMutex(ws, &mu, "copied ✓")
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, append([]byte{0xFC}, "copied ✓"...), msg)
+	case <-time.After(2 * time.Second):
+		t.Fatal("clipboard message not received")
+	}
+}
+
+func TestSetupRDPClient_AudioDisabled(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	creds := &connectionRequest{Host: listener.Addr().String(), User: "user", Password: "pass"}
+	params := &connectionParams{width: 800, height: 600, colorDepth: 16, enableAudio: true}
+
+	t.Setenv("ENABLE_AUDIO", "true")
+	_, err = config.Load()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		t.Setenv("ENABLE_AUDIO", "true")
+		_, _ = config.Load()
+	})
+	rdpClient, err := setupRDPClient(context.Background(), creds, params)
+	require.NoError(t, err)
+	assert.NotNil(t, rdpClient.GetAudioHandler())
+	_ = rdpClient.Close()
+
+	// With audio off there is no handler, so no audio reaches the browser
+	t.Setenv("ENABLE_AUDIO", "false")
+	_, err = config.Load()
+	require.NoError(t, err)
+	rdpClient, err = setupRDPClient(context.Background(), creds, params)
+	require.NoError(t, err)
+	assert.Nil(t, rdpClient.GetAudioHandler())
+	_ = rdpClient.Close()
+}
+
+func TestSetupRDPClient_ClipboardDisabled(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	creds := &connectionRequest{Host: listener.Addr().String(), User: "user", Password: "pass"}
+	params := &connectionParams{width: 800, height: 600, colorDepth: 16}
+
+	t.Setenv("ENABLE_CLIPBOARD", "true")
+	_, err = config.Load()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		t.Setenv("ENABLE_CLIPBOARD", "true")
+		_, _ = config.Load()
+	})
+	rdpClient, err := setupRDPClient(context.Background(), creds, params)
+	require.NoError(t, err)
+	assert.NotNil(t, rdpClient.GetClipboardHandler())
+	_ = rdpClient.Close()
+
+	// With the clipboard off the cliprdr channel is never requested
+	t.Setenv("ENABLE_CLIPBOARD", "false")
+	_, err = config.Load()
+	require.NoError(t, err)
+	rdpClient, err = setupRDPClient(context.Background(), creds, params)
+	require.NoError(t, err)
+	assert.Nil(t, rdpClient.GetClipboardHandler())
+	_ = rdpClient.Close()
+}
+
+func TestHostSettingsFor(t *testing.T) {
+	enabled, disabled := true, false
+	cfg := &config.Config{
+		RDP:      config.RDPConfig{RFXMode: config.RFXModeImage},
+		Security: config.SecurityConfig{TLSServerName: "gateway.example.com"},
+		Hosts: map[string]config.HostProfile{
+			"legacy": {UseNLA: &disabled, EnableRFX: &disabled, SkipTLSValidation: &enabled},
+			"lab":    {TLSServerName: "lab.internal"},
+			"cad":    {RFXMode: config.RFXModeVideo},
+		},
+	}
+
+	defaults := hostSettings{useNLA: true, enableRFX: true, rfxMode: config.RFXModeImage, tlsServerName: "gateway.example.com"}
+	assert.Equal(t, defaults, hostSettingsFor(cfg, "other:3389"))
+
+	assert.Equal(t, hostSettings{
+		useNLA:            false,
+		enableRFX:         false,
+		rfxMode:           config.RFXModeImage,
+		skipTLSValidation: true,
+		tlsServerName:     "gateway.example.com",
+	}, hostSettingsFor(cfg, "LEGACY:3389"))
+
+	lab := defaults
+	lab.tlsServerName = "lab.internal"
+	assert.Equal(t, lab, hostSettingsFor(cfg, "lab"))
+
+	cad := defaults
+	cad.rfxMode = config.RFXModeVideo
+	assert.Equal(t, cad, hostSettingsFor(cfg, "cad"))
+}
+
+func TestRFXCodecMode(t *testing.T) {
+	assert.Equal(t, pdu.RFXCodecModeImage, rfxCodecMode(config.RFXModeImage))
+	assert.Equal(t, pdu.RFXCodecModeVideo, rfxCodecMode(config.RFXModeVideo))
+	assert.Equal(t, pdu.RFXCodecModeImage, rfxCodecMode(""))
+}
+
+func TestNLAMechanism(t *testing.T) {
+	assert.Equal(t, rdp.NLAMechanismNTLM, nlaMechanism(config.NLAMechanismNTLM))
+	assert.Equal(t, rdp.NLAMechanismKerberos, nlaMechanism(config.NLAMechanismKerberos))
+	assert.Equal(t, rdp.NLAMechanismNegotiate, nlaMechanism(config.NLAMechanismNegotiate))
+	assert.Equal(t, rdp.NLAMechanismNTLM, nlaMechanism(""))
+}
+
+func TestClientIdentity(t *testing.T) {
+	assert.Equal(t, rdp.ClientIdentity{}, clientIdentity(&config.Config{}), "nothing is spoofed by default")
+
+	cfg := &config.Config{RDP: config.RDPConfig{
+		ClientBuild:     22621,
+		ClientProductID: "00330-80000-00000-AA123",
+		ClientOS:        config.ClientOSLinux,
+	}}
+	assert.Equal(t, rdp.ClientIdentity{
+		Build:       22621,
+		ProductID:   "00330-80000-00000-AA123",
+		OSMajorType: pdu.OSMajorTypeUnix,
+		OSMinorType: pdu.OSMinorTypeNativeXServer,
+	}, clientIdentity(cfg))
+}
@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CredentialProvider resolves the RDP credentials for a /connect request
+// before the WebSocket upgrade. A provider that returns an empty user
+// resolves nothing, and the credentials come from the browser's
+// credentials message instead. A non-empty host pins the session to that
+// RDP host, so the credentials cannot be sent anywhere else.
+type CredentialProvider interface {
+	Resolve(r *http.Request) (domain, user, password, host string, err error)
+}
+
+// messageCredentialProvider is the default provider. It resolves nothing,
+// leaving the credentials to the credentials message the browser sends over
+// the WebSocket, so they never appear in the URL.
+type messageCredentialProvider struct{}
+
+// Resolve implements CredentialProvider.
+func (messageCredentialProvider) Resolve(*http.Request) (domain, user, password, host string, err error) {
+	return "", "", "", "", nil
+}
+
+// credentialProvider is the provider used by Connect.
+var credentialProvider = struct {
+	mu       sync.RWMutex
+	provider CredentialProvider
+}{provider: messageCredentialProvider{}}
+
+// SetCredentialProvider sets the provider used to resolve the credentials
+// of new connections. A nil provider restores the default, which takes them
+// from the browser's credentials message.
+func SetCredentialProvider(p CredentialProvider) {
+	if p == nil {
+		p = messageCredentialProvider{}
+	}
+	credentialProvider.mu.Lock()
+	credentialProvider.provider = p
+	credentialProvider.mu.Unlock()
+}
+
+// resolvedCredentials are credentials a provider resolved server-side.
+type resolvedCredentials struct {
+	user     string
+	password string
+	host     string // RDP host the credentials are for, empty for any
+}
+
+// resolveCredentials asks the current provider for the credentials of r.
+// It returns nil when the provider resolved none.
+func resolveCredentials(r *http.Request) (*resolvedCredentials, error) {
+	credentialProvider.mu.RLock()
+	p := credentialProvider.provider
+	credentialProvider.mu.RUnlock()
+
+	domain, user, password, host, err := p.Resolve(r)
+	if err != nil {
+		return nil, err
+	}
+	if user == "" {
+		return nil, nil
+	}
+	// The RDP client takes the domain as part of the user name
+	if domain != "" {
+		user = domain + `\` + user
+	}
+	return &resolvedCredentials{user: user, password: password, host: host}, nil
+}
+
+// ErrInvalidToken is returned by TokenCredentialProvider for a missing,
+// unknown, used or expired session token.
+var ErrInvalidToken = errors.New("invalid session token")
+
+// tokenQueryParam is the /connect query parameter carrying a session token.
+const tokenQueryParam = "token"
+
+// tokenCredentials are the credentials held for one session token and the
+// RDP host they may be used for.
+type tokenCredentials struct {
+	domain, user, password, host string
+	expires                      time.Time
+}
+
+// TokenCredentialProvider resolves credentials from a short-lived opaque
+// session token in the token query parameter. Credentials are stored
+// server-side by Issue and each token resolves once, so the URL only ever
+// carries a token that is useless after the connection it was issued for.
+type TokenCredentialProvider struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	now    func() time.Time
+	tokens map[string]tokenCredentials
+}
+
+// NewTokenCredentialProvider creates a provider whose tokens expire after
+// ttl. A nil clock defaults to time.Now.
+func NewTokenCredentialProvider(ttl time.Duration, now func() time.Time) *TokenCredentialProvider {
+	if now == nil {
+		now = time.Now
+	}
+	return &TokenCredentialProvider{
+		ttl:    ttl,
+		now:    now,
+		tokens: make(map[string]tokenCredentials),
+	}
+}
+
+// Issue stores the credentials for host and returns a new token for them.
+func (p *TokenCredentialProvider) Issue(domain, user, password, host string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pruneLocked()
+	p.tokens[token] = tokenCredentials{domain: domain, user: user, password: password, host: host, expires: p.now().Add(p.ttl)}
+	return token, nil
+}
+
+// Resolve implements CredentialProvider. The token is consumed whether or
+// not it has expired.
+func (p *TokenCredentialProvider) Resolve(r *http.Request) (domain, user, password, host string, err error) {
+	token := r.URL.Query().Get(tokenQueryParam)
+	if token == "" {
+		return "", "", "", "", ErrInvalidToken
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	creds, ok := p.tokens[token]
+	delete(p.tokens, token)
+	if !ok || !p.now().Before(creds.expires) {
+		return "", "", "", "", ErrInvalidToken
+	}
+	return creds.domain, creds.user, creds.password, creds.host, nil
+}
+
+// maxTokenRequestSize bounds the body of a token request.
+const maxTokenRequestSize = 4096
+
+// IssueToken serves POST /admin/tokens: it stores the domain, user,
+// password and host of the JSON body and answers 201 with a token for the
+// /connect token parameter and its lifetime in seconds, or 400 for a body
+// without a user or a valid host. The token only connects to that host.
+func (p *TokenCredentialProvider) IssueToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Domain   string `json:"domain"`
+		User     string `json:"user"`
+		Password string `json:"password"`
+		Host     string `json:"host"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxTokenRequestSize)).Decode(&req); err != nil || req.User == "" {
+		http.Error(w, "Invalid token request", http.StatusBadRequest)
+		return
+	}
+	host, err := parseTarget(req.Host)
+	if err != nil {
+		http.Error(w, "Invalid host: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token, err := p.Issue(req.Domain, req.User, req.Password, host)
+	if err != nil {
+		http.Error(w, "Failed to issue token", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(struct {
+		Token     string `json:"token"`
+		ExpiresIn int64  `json:"expiresIn"`
+	}{token, int64(p.ttl.Seconds())})
+}
+
+// pruneLocked drops expired tokens. Callers must hold p.mu.
+func (p *TokenCredentialProvider) pruneLocked() {
+	now := p.now()
+	for token, creds := range p.tokens {
+		if !now.Before(creds.expires) {
+			delete(p.tokens, token)
+		}
+	}
+}
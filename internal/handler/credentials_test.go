@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubCredentialProvider resolves fixed credentials
+type stubCredentialProvider struct {
+	domain, user, password, host string
+	err                          error
+}
+
+func (p stubCredentialProvider) Resolve(*http.Request) (string, string, string, string, error) {
+	return p.domain, p.user, p.password, p.host, p.err
+}
+
+func TestResolveCredentials(t *testing.T) {
+	t.Cleanup(func() { SetCredentialProvider(nil) })
+	req := httptest.NewRequest(http.MethodGet, "/connect", nil)
+
+	resolved, err := resolveCredentials(req)
+	require.NoError(t, err)
+	assert.Nil(t, resolved, "the default provider leaves credentials to the message")
+
+	SetCredentialProvider(stubCredentialProvider{domain: "CORP", user: "alice", password: "secret", host: "desktop.example:3389"})
+	resolved, err = resolveCredentials(req)
+	require.NoError(t, err)
+	assert.Equal(t, &resolvedCredentials{user: `CORP\alice`, password: "secret", host: "desktop.example:3389"}, resolved)
+
+	SetCredentialProvider(stubCredentialProvider{user: "bob"})
+	resolved, err = resolveCredentials(req)
+	require.NoError(t, err)
+	assert.Equal(t, &resolvedCredentials{user: "bob"}, resolved)
+
+	SetCredentialProvider(stubCredentialProvider{err: ErrInvalidToken})
+	_, err = resolveCredentials(req)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestTokenCredentialProvider(t *testing.T) {
+	clock := newFakeClock()
+	p := NewTokenCredentialProvider(time.Minute, clock.Now)
+
+	token, err := p.Issue("CORP", "alice", "secret", "desktop.example:3389")
+	require.NoError(t, err)
+	other, err := p.Issue("", "bob", "hunter2", "lab.example:3389")
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+
+	resolve := func(token string) (string, string, string, string, error) {
+		return p.Resolve(httptest.NewRequest(http.MethodGet, "/connect?token="+token, nil))
+	}
+
+	domain, user, password, host, err := resolve(token)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"CORP", "alice", "secret", "desktop.example:3389"}, []string{domain, user, password, host})
+
+	// Tokens are single-use
+	_, _, _, _, err = resolve(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, _, _, _, err = resolve("")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, _, _, _, err = resolve("unknown")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Tokens expire
+	clock.Advance(time.Minute)
+	_, _, _, _, err = resolve(other)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestTokenCredentialProvider_PrunesExpired(t *testing.T) {
+	clock := newFakeClock()
+	p := NewTokenCredentialProvider(time.Minute, clock.Now)
+
+	_, err := p.Issue("", "alice", "secret", "desktop.example:3389")
+	require.NoError(t, err)
+	clock.Advance(2 * time.Minute)
+	_, err = p.Issue("", "bob", "secret", "desktop.example:3389")
+	require.NoError(t, err)
+
+	assert.Len(t, p.tokens, 1)
+}
+
+func TestTokenCredentialProvider_IssueToken(t *testing.T) {
+	p := NewTokenCredentialProvider(time.Minute, newFakeClock().Now)
+
+	issue := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		p.IssueToken(rec, httptest.NewRequest(http.MethodPost, "/admin/tokens", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := issue(`{"domain":"CORP","user":"alice","password":"secret","host":"desktop.example"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	var resp struct {
+		Token     string `json:"token"`
+		ExpiresIn int64  `json:"expiresIn"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, int64(60), resp.ExpiresIn)
+
+	domain, user, password, host, err := p.Resolve(httptest.NewRequest(http.MethodGet, "/connect?token="+resp.Token, nil))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"CORP", "alice", "secret", "desktop.example:3389"}, []string{domain, user, password, host},
+		"the host is stored with its default port")
+
+	assert.Equal(t, http.StatusBadRequest, issue(`{"password":"secret","host":"desktop.example"}`).Code, "a user is required")
+	assert.Equal(t, http.StatusBadRequest, issue(`{"user":"alice","password":"secret"}`).Code, "a host is required")
+	assert.Equal(t, http.StatusBadRequest, issue(`{"user":"alice","host":"desktop.example:99999"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, issue(`not json`).Code)
+	assert.Equal(t, http.StatusBadRequest, issue(`{"user":"`+strings.Repeat("a", maxTokenRequestSize)+`"}`).Code)
+	assert.Empty(t, p.tokens, "rejected requests issue no token")
+}
+
+func TestConnect_InvalidTokenIsUnauthorized(t *testing.T) {
+	SetCredentialProvider(NewTokenCredentialProvider(time.Minute, nil))
+	t.Cleanup(func() { SetCredentialProvider(nil) })
+
+	rec := httptest.NewRecorder()
+	Connect(rec, httptest.NewRequest(http.MethodGet, "/connect?width=800&height=600&token=forged", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestConnect_TokenCredentialsReplaceMessage(t *testing.T) {
+	provider := NewTokenCredentialProvider(time.Minute, nil)
+	SetCredentialProvider(provider)
+	t.Cleanup(func() { SetCredentialProvider(nil) })
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	host := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	token, err := provider.Issue("", "alice", "secret", host)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(Connect))
+	t.Cleanup(server.Close)
+
+	// The message carries nothing but its type; without the token's
+	// credentials and host it would be rejected before dialing
+	ws, rec := dialRecording(t, server.URL, "/connect?width=800&height=600&token="+token)
+	creds, err := json.Marshal(connectionRequest{Type: "credentials"})
+	require.NoError(t, err)
+	require.NoError(t, websocket.Message.Send(ws, string(creds)))
+	assert.Equal(t, closeStatusHostUnreachable, readCloseStatus(t, ws, rec))
+}
+
+func TestConnect_TokenRejectsOtherHost(t *testing.T) {
+	provider := NewTokenCredentialProvider(time.Minute, nil)
+	SetCredentialProvider(provider)
+	t.Cleanup(func() { SetCredentialProvider(nil) })
+
+	// Both the token's host and the browser's listen, so only the host
+	// check keeps the credentials from reaching the browser's
+	tokenHost, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = tokenHost.Close() })
+	browserHost, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = browserHost.Close() })
+
+	token, err := provider.Issue("", "alice", "secret", tokenHost.Addr().String())
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(Connect))
+	t.Cleanup(server.Close)
+
+	ws, rec := dialRecording(t, server.URL, "/connect?width=800&height=600&token="+token)
+	creds, err := json.Marshal(connectionRequest{Type: "credentials", Host: browserHost.Addr().String()})
+	require.NoError(t, err)
+	require.NoError(t, websocket.Message.Send(ws, string(creds)))
+	assert.Equal(t, closeStatusPolicyRejected, readCloseStatus(t, ws, rec))
+
+	for _, l := range []net.Listener{tokenHost, browserHost} {
+		require.NoError(t, l.(*net.TCPListener).SetDeadline(time.Now().Add(100*time.Millisecond)))
+		conn, err := l.Accept()
+		if err == nil {
+			_ = conn.Close()
+		}
+		assert.Error(t, err, "%s should not have been dialed", l.Addr())
+	}
+}
+
+func TestReceiveCredentials_TokenHost(t *testing.T) {
+	resolved := &resolvedCredentials{user: "alice", password: "secret", host: "192.0.2.10:3389"}
+
+	type result struct {
+		creds *connectionRequest
+		err   error
+	}
+	results := make(chan result, 1)
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		creds, err := receiveCredentials(ws, resolved)
+		results <- result{creds, err}
+	}))
+	t.Cleanup(server.Close)
+
+	receive := func(host string) (*connectionRequest, error) {
+		ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http"), "", "http://localhost/")
+		require.NoError(t, err)
+		defer func() { _ = ws.Close() }()
+		msg, err := json.Marshal(connectionRequest{Type: "credentials", Host: host})
+		require.NoError(t, err)
+		require.NoError(t, websocket.Message.Send(ws, string(msg)))
+		r := <-results
+		return r.creds, r.err
+	}
+
+	creds, err := receive("192.0.2.10")
+	require.NoError(t, err, "the same host with the default port implied")
+	assert.Equal(t, "192.0.2.10:3389", creds.Host)
+
+	_, err = receive("192.0.2.11:3389")
+	assert.ErrorIs(t, err, errHostNotResolved)
+	_, err = receive("192.0.2.10:3390")
+	assert.ErrorIs(t, err, errHostNotResolved)
+	_, err = receive("[::1")
+	assert.ErrorIs(t, err, errHostNotResolved)
+}
+
+func TestConnect_TokenRefusesDisableNLA(t *testing.T) {
+	provider := NewTokenCredentialProvider(time.Minute, nil)
+	SetCredentialProvider(provider)
+	t.Cleanup(func() { SetCredentialProvider(nil) })
+
+	token, err := provider.Issue("", "alice", "secret", "192.0.2.10:3389")
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(Connect))
+	t.Cleanup(server.Close)
+
+	ws, rec := dialRecording(t, server.URL, "/connect?width=800&height=600&disableNLA=true&token="+token)
+	assert.Equal(t, closeStatusPolicyRejected, readCloseStatus(t, ws, rec))
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"encoding/binary"
+
+	"github.com/rcarmo/go-rdp/internal/codec"
+	"github.com/rcarmo/go-rdp/internal/protocol/fastpath"
+)
+
+// cursorMessage is the JSON structure telling the browser to hide the
+// pointer, show the system default one or show a decoded pointer shape.
+type cursorMessage struct {
+	Type    string       `json:"type"`
+	Visible bool         `json:"visible"`
+	Shape   *cursorShape `json:"shape,omitempty"`
+}
+
+// cursorShape is a pointer shape decoded by the gateway: top-down RGBA
+// pixels, base64 encoded in JSON, and the hotspot within them.
+type cursorShape struct {
+	CacheIndex uint16 `json:"cacheIndex"`
+	X          int    `json:"x"`
+	Y          int    `json:"y"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	RGBA       []byte `json:"rgba"`
+}
+
+// pointerCacheSize is the pointer cache size advertised in the pointer
+// capability set; servers never reference indexes at or past it
+const pointerCacheSize = 25
+
+// singleUpdate returns the update code and payload of data when it consists
+// of one unfragmented, uncompressed fastpath update.
+func singleUpdate(data []byte) (fastpath.UpdateCode, []byte, bool) {
+	// [updateHeader:1] [size:2] [payload]
+	if len(data) < 3 || int(binary.LittleEndian.Uint16(data[1:]))+3 != len(data) {
+		return 0, nil, false
+	}
+	header := data[0]
+	if fastpath.Fragment((header>>4)&0x3) != fastpath.FragmentSingle || header>>6 != 0 {
+		return 0, nil, false
+	}
+	return fastpath.UpdateCode(header & 0xf), data[3:], true
+}
+
+// cursorControlMessage translates an update consisting of a lone Pointer
+// Null or Pointer Default fastpath update into a cursor control message.
+// It reports false for any other update, which is forwarded as is.
+func cursorControlMessage(data []byte) (cursorMessage, bool) {
+	code, payload, ok := singleUpdate(data)
+	if !ok || len(payload) != 0 {
+		return cursorMessage{}, false
+	}
+
+	switch code {
+	case fastpath.UpdateCodePTRNull:
+		return cursorMessage{Type: "cursor", Visible: false}, true
+	case fastpath.UpdateCodePTRDefault:
+		return cursorMessage{Type: "cursor", Visible: true}, true
+	}
+	return cursorMessage{}, false
+}
+
+// pointerCache mirrors the server's pointer cache so that cached pointer
+// updates resolve to the shapes sent before them. It is used by the relay
+// goroutine only.
+type pointerCache struct {
+	shapes    map[uint16]*cursorShape
+	fragments []byte
+}
+
+func newPointerCache() *pointerCache {
+	return &pointerCache{shapes: make(map[uint16]*cursorShape)}
+}
+
+// controlMessage translates an update consisting of a lone pointer update
+// into a cursor control message: Pointer Null and Pointer Default as in
+// cursorControlMessage, shapes decoded to RGBA and cached pointers resolved
+// from the cache. It reports false for any other update, and for pointer
+// updates it cannot decode or resolve, which are forwarded as is for the
+// browser to handle. Shapes in forwarded updates are cached all the same.
+func (c *pointerCache) controlMessage(data []byte) (cursorMessage, bool) {
+	if msg, ok := cursorControlMessage(data); ok {
+		return msg, true
+	}
+	code, payload, ok := singleUpdate(data)
+	if !ok {
+		c.observe(data)
+		return cursorMessage{}, false
+	}
+
+	var shape *cursorShape
+	switch code {
+	case fastpath.UpdateCodeColor, fastpath.UpdateCodePointer, fastpath.UpdateCodeLargePointer:
+		shape = c.store(code, payload)
+	case fastpath.UpdateCodeCached:
+		if index, err := fastpath.ParseCachedPointer(payload); err == nil {
+			shape = c.shapes[index]
+		}
+	}
+	if shape == nil {
+		return cursorMessage{}, false
+	}
+	return cursorMessage{Type: "cursor", Visible: true, Shape: shape}, true
+}
+
+// observe caches the shapes of the pointer updates in data, reassembling
+// fragmented ones.
+func (c *pointerCache) observe(data []byte) {
+	for len(data) >= 3 {
+		header := data[0]
+		size := int(binary.LittleEndian.Uint16(data[1:3]))
+		if header>>6 != 0 || 3+size > len(data) {
+			// Compressed updates cannot be parsed here
+			return
+		}
+		payload := data[3 : 3+size]
+		data = data[3+size:]
+
+		code := fastpath.UpdateCode(header & 0xf)
+		if code != fastpath.UpdateCodeColor && code != fastpath.UpdateCodePointer && code != fastpath.UpdateCodeLargePointer {
+			continue
+		}
+		switch fastpath.Fragment((header >> 4) & 0x3) {
+		case fastpath.FragmentSingle:
+		case fastpath.FragmentFirst:
+			c.fragments = append(c.fragments[:0], payload...)
+			continue
+		case fastpath.FragmentNext:
+			c.fragments = append(c.fragments, payload...)
+			continue
+		case fastpath.FragmentLast:
+			payload = append(c.fragments, payload...)
+			c.fragments = c.fragments[:0]
+		}
+		c.store(code, payload)
+	}
+}
+
+// store decodes and caches a pointer shape, returning nil if it cannot be
+// decoded.
+func (c *pointerCache) store(code fastpath.UpdateCode, payload []byte) *cursorShape {
+	ptr, err := fastpath.ParsePointerShape(code, payload)
+	if err != nil || ptr.CacheIndex >= pointerCacheSize {
+		return nil
+	}
+	rgba := codec.PointerToRGBA(ptr.XorMask, ptr.AndMask, int(ptr.Width), int(ptr.Height), int(ptr.XorBpp))
+	if rgba == nil {
+		// Drop the stale shape so the index is not resolved to it
+		delete(c.shapes, ptr.CacheIndex)
+		return nil
+	}
+	shape := &cursorShape{
+		CacheIndex: ptr.CacheIndex,
+		X:          int(ptr.HotspotX),
+		Y:          int(ptr.HotspotY),
+		Width:      int(ptr.Width),
+		Height:     int(ptr.Height),
+		RGBA:       rgba,
+	}
+	c.shapes[ptr.CacheIndex] = shape
+	return shape
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcarmo/go-rdp/internal/protocol/fastpath"
+	"github.com/rcarmo/go-rdp/internal/rdp"
+)
+
+func TestCursorControlMessage(t *testing.T) {
+	msg, ok := cursorControlMessage([]byte{byte(fastpath.UpdateCodePTRNull), 0, 0})
+	require.True(t, ok)
+	assert.Equal(t, cursorMessage{Type: "cursor", Visible: false}, msg)
+
+	msg, ok = cursorControlMessage([]byte{byte(fastpath.UpdateCodePTRDefault), 0, 0})
+	require.True(t, ok)
+	assert.Equal(t, cursorMessage{Type: "cursor", Visible: true}, msg)
+}
+
+func TestCursorControlMessage_OtherUpdates(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"empty":           nil,
+		"bitmap":          {byte(fastpath.UpdateCodeBitmap), 0, 0},
+		"position":        {byte(fastpath.UpdateCodePTRPosition), 4, 0, 1, 0, 2, 0},
+		"trailing update": {byte(fastpath.UpdateCodePTRNull), 0, 0, byte(fastpath.UpdateCodeSynchronize), 0, 0},
+		"fragment":        {byte(fastpath.UpdateCodePTRNull) | byte(fastpath.FragmentFirst)<<4, 0, 0},
+		"compressed":      {byte(fastpath.UpdateCodePTRDefault) | byte(fastpath.CompressionUsed)<<6, 0, 0},
+	} {
+		_, ok := cursorControlMessage(data)
+		assert.False(t, ok, name)
+	}
+}
+
+func TestRdpToWs_PointerNullSendsCursorMessage(t *testing.T) {
+	mockRDP := &mockRDPConnection{
+		updateData: &rdp.Update{Data: []byte{byte(fastpath.UpdateCodePTRNull), 0, 0}},
+		maxUpdates: 1,
+	}
+
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		rdpToWs(context.Background(), mockRDP, ws)
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	ws, err := websocket.Dial(wsURL, "", "http://localhost/")
+	require.NoError(t, err)
+	defer func() { _ = ws.Close() }()
+
+	var received []byte
+	require.NoError(t, websocket.Message.Receive(ws, &received))
+	require.NotEmpty(t, received)
+	assert.Equal(t, byte(0xFF), received[0])
+
+	var msg cursorMessage
+	require.NoError(t, json.Unmarshal(received[1:], &msg))
+	assert.Equal(t, cursorMessage{Type: "cursor", Visible: false}, msg)
+}
+
+// colorPointerUpdate builds a lone Color Pointer update for a 1x1 24bpp shape
+func colorPointerUpdate(cacheIndex uint16, bgr [3]byte) []byte {
+	payload := []byte{
+		byte(cacheIndex), byte(cacheIndex >> 8),
+		0, 0, 0, 0, // hotspot
+		1, 0, 1, 0, // width, height
+		2, 0, 4, 0, // lengthAndMask, lengthXorMask
+		bgr[0], bgr[1], bgr[2], 0, // XOR row padded to 2 bytes
+		0, 0, // AND row
+	}
+	return append([]byte{byte(fastpath.UpdateCodeColor), byte(len(payload)), 0}, payload...)
+}
+
+func TestPointerCache_ShapeAndCachedPointer(t *testing.T) {
+	cache := newPointerCache()
+
+	msg, ok := cache.controlMessage(colorPointerUpdate(3, [3]byte{0x10, 0x20, 0x30}))
+	require.True(t, ok)
+	require.NotNil(t, msg.Shape)
+	assert.True(t, msg.Visible)
+	assert.Equal(t, uint16(3), msg.Shape.CacheIndex)
+	assert.Equal(t, []byte{0x30, 0x20, 0x10, 0xff}, msg.Shape.RGBA)
+
+	msg, ok = cache.controlMessage([]byte{byte(fastpath.UpdateCodeCached), 2, 0, 3, 0})
+	require.True(t, ok)
+	require.NotNil(t, msg.Shape)
+	assert.Equal(t, []byte{0x30, 0x20, 0x10, 0xff}, msg.Shape.RGBA)
+
+	_, ok = cache.controlMessage([]byte{byte(fastpath.UpdateCodeCached), 2, 0, 4, 0})
+	assert.False(t, ok, "unknown cache index is forwarded")
+
+	msg, ok = cache.controlMessage([]byte{byte(fastpath.UpdateCodePTRNull), 0, 0})
+	require.True(t, ok)
+	assert.Equal(t, cursorMessage{Type: "cursor", Visible: false}, msg)
+}
+
+func TestPointerCache_ObservesFragmentedShapes(t *testing.T) {
+	cache := newPointerCache()
+	update := colorPointerUpdate(5, [3]byte{0xff, 0, 0})
+	payload := update[3:]
+
+	first := append([]byte{byte(fastpath.UpdateCodeColor) | byte(fastpath.FragmentFirst)<<4, 10, 0}, payload[:10]...)
+	last := append([]byte{byte(fastpath.UpdateCodeColor) | byte(fastpath.FragmentLast)<<4, byte(len(payload) - 10), 0}, payload[10:]...)
+	_, ok := cache.controlMessage(append(first, last...))
+	assert.False(t, ok, "fragmented updates are forwarded")
+
+	msg, ok := cache.controlMessage([]byte{byte(fastpath.UpdateCodeCached), 2, 0, 5, 0})
+	require.True(t, ok)
+	require.NotNil(t, msg.Shape)
+	assert.Equal(t, []byte{0, 0, 0xff, 0xff}, msg.Shape.RGBA)
+}
+
+func TestPointerCache_RejectsOutOfRangeIndex(t *testing.T) {
+	cache := newPointerCache()
+	_, ok := cache.controlMessage(colorPointerUpdate(pointerCacheSize, [3]byte{1, 2, 3}))
+	assert.False(t, ok)
+}
+
+func TestPointerCache_IgnoresDrawingOperations(t *testing.T) {
+	c := newPointerCache()
+	// A fill whose count and first bytes would read as an empty update
+	data := []byte{rdp.DrawingOpsMarker, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0xFF, 0x00, 0x00}
+	_, ok := c.controlMessage(data)
+	assert.False(t, ok)
+	assert.Empty(t, c.shapes)
+}
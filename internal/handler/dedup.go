@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rcarmo/go-rdp/internal/config"
+)
+
+// maxNonceLength bounds the client-provided connection nonce.
+const maxNonceLength = 128
+
+// nonceClaim is a session's hold on a connection nonce.
+type nonceClaim struct {
+	claimed   time.Time
+	terminate func()
+	replaced  bool
+}
+
+// connectionNonces de-duplicates WebSocket upgrades that carry the same
+// client-provided nonce within a short window, e.g. from a double-click.
+type connectionNonces struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	entries map[string]*nonceClaim
+}
+
+// newConnectionNonces creates an empty nonce registry.
+// A nil clock defaults to time.Now.
+func newConnectionNonces(now func() time.Time) *connectionNonces {
+	if now == nil {
+		now = time.Now
+	}
+	return &connectionNonces{
+		now:     now,
+		entries: make(map[string]*nonceClaim),
+	}
+}
+
+// sessionNonces is the registry shared by all /connect requests.
+var sessionNonces = newConnectionNonces(nil)
+
+// claim registers a nonce for a new connection. If another connection claimed
+// the same nonce within window, the reject policy refuses the new one (ok is
+// false) while the replace policy terminates the earlier one.
+func (n *connectionNonces) claim(nonce, policy string, window time.Duration) (claim *nonceClaim, ok bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := n.now()
+	if prev, exists := n.entries[nonce]; exists && now.Sub(prev.claimed) < window {
+		if policy == config.DedupPolicyReject {
+			return nil, false
+		}
+		prev.replaced = true
+		if prev.terminate != nil {
+			go prev.terminate()
+		}
+	}
+
+	claim = &nonceClaim{claimed: now}
+	n.entries[nonce] = claim
+	return claim, true
+}
+
+// attach sets the function used to end the claiming session once it exists.
+// If the claim was already replaced, the session is terminated immediately.
+func (n *connectionNonces) attach(claim *nonceClaim, terminate func()) {
+	n.mu.Lock()
+	replaced := claim.replaced
+	claim.terminate = terminate
+	n.mu.Unlock()
+
+	if replaced {
+		terminate()
+	}
+}
+
+// release drops the nonce when the claiming session ends, unless a newer
+// connection has taken it over.
+func (n *connectionNonces) release(nonce string, claim *nonceClaim) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.entries[nonce] == claim {
+		delete(n.entries, nonce)
+	}
+}
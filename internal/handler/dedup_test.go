@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/go-rdp/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionNonces_ReplacePolicy(t *testing.T) {
+	clock := newFakeClock()
+	nonces := newConnectionNonces(clock.Now)
+
+	first, ok := nonces.claim("abc", config.DedupPolicyReplace, 10*time.Second)
+	require.True(t, ok)
+	terminated := make(chan struct{})
+	nonces.attach(first, func() { close(terminated) })
+
+	clock.Advance(time.Second)
+	second, ok := nonces.claim("abc", config.DedupPolicyReplace, 10*time.Second)
+	require.True(t, ok, "replace policy accepts the newer connection")
+
+	select {
+	case <-terminated:
+	case <-time.After(time.Second):
+		t.Fatal("earlier connection was not terminated")
+	}
+
+	// The replaced session ending must not drop the newer claim
+	nonces.release("abc", first)
+	assert.Same(t, second, nonces.entries["abc"])
+
+	nonces.release("abc", second)
+	assert.Empty(t, nonces.entries)
+}
+
+func TestConnectionNonces_ReplaceBeforeAttach(t *testing.T) {
+	nonces := newConnectionNonces(newFakeClock().Now)
+
+	first, _ := nonces.claim("abc", config.DedupPolicyReplace, 10*time.Second)
+	_, ok := nonces.claim("abc", config.DedupPolicyReplace, 10*time.Second)
+	require.True(t, ok)
+
+	terminated := false
+	nonces.attach(first, func() { terminated = true })
+	assert.True(t, terminated, "a session replaced during setup is closed as soon as it attaches")
+}
+
+func TestConnectionNonces_RejectPolicy(t *testing.T) {
+	clock := newFakeClock()
+	nonces := newConnectionNonces(clock.Now)
+
+	first, ok := nonces.claim("abc", config.DedupPolicyReject, 10*time.Second)
+	require.True(t, ok)
+	nonces.attach(first, func() { t.Error("reject policy must not terminate the earlier connection") })
+
+	_, ok = nonces.claim("abc", config.DedupPolicyReject, 10*time.Second)
+	assert.False(t, ok, "duplicate within the window is rejected")
+
+	_, ok = nonces.claim("other", config.DedupPolicyReject, 10*time.Second)
+	assert.True(t, ok, "different nonces are independent")
+
+	clock.Advance(11 * time.Second)
+	_, ok = nonces.claim("abc", config.DedupPolicyReject, 10*time.Second)
+	assert.True(t, ok, "duplicate outside the window is accepted")
+}
+
+func TestConnect_DuplicateNonceRejected(t *testing.T) {
+	t.Setenv("WS_DEDUP_POLICY", "reject")
+	_, err := config.Load()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		t.Setenv("WS_DEDUP_POLICY", "off")
+		_, _ = config.Load()
+	})
+
+	claim, ok := sessionNonces.claim("dup-nonce", config.DedupPolicyReject, time.Minute)
+	require.True(t, ok)
+	defer sessionNonces.release("dup-nonce", claim)
+
+	req := httptest.NewRequest(http.MethodGet, "/connect?width=800&height=600&nonce=dup-nonce", nil)
+	rec := httptest.NewRecorder()
+	Connect(rec, req)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// closeStatusGoingAway is the WebSocket close code sent when the server is
+// shutting down (RFC 6455)
+const closeStatusGoingAway = 1001
+
+// drainSession is an active session's entry in a sessionDrain.
+type drainSession struct {
+	id        string
+	start     time.Time
+	terminate func()
+
+	// Reported and used by the admin API once the session is described
+	clientAddr string
+	target     string
+	stats      *sessionStats
+	kill       func()
+}
+
+// sessionDrain tracks active sessions so the server can stop accepting new
+// ones on shutdown and wait for the existing ones to close.
+type sessionDrain struct {
+	mu       sync.Mutex
+	draining bool
+	sessions map[*drainSession]struct{}
+	idle     chan struct{} // closed once draining with no sessions left
+}
+
+// newSessionDrain creates an empty session registry.
+func newSessionDrain() *sessionDrain {
+	return &sessionDrain{
+		sessions: make(map[*drainSession]struct{}),
+		idle:     make(chan struct{}),
+	}
+}
+
+// activeSessions is the registry shared by all /connect requests.
+var activeSessions = newSessionDrain()
+
+// add registers a new session. It fails (ok is false) once draining has begun.
+func (d *sessionDrain) add() (session *drainSession, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.draining {
+		return nil, false
+	}
+	session = &drainSession{id: rand.Text(), start: time.Now()}
+	d.sessions[session] = struct{}{}
+	return session, true
+}
+
+// attach sets the function used to end the session on shutdown. If draining
+// has already begun, the session is terminated immediately.
+func (d *sessionDrain) attach(session *drainSession, terminate func()) {
+	d.mu.Lock()
+	draining := d.draining
+	session.terminate = terminate
+	d.mu.Unlock()
+
+	if draining {
+		terminate()
+	}
+}
+
+// remove drops a session once it has ended.
+func (d *sessionDrain) remove(session *drainSession) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.sessions, session)
+	if d.draining && len(d.sessions) == 0 {
+		d.closeIdle()
+	}
+}
+
+// drain stops accepting sessions and asks every active one to end.
+func (d *sessionDrain) drain() {
+	d.mu.Lock()
+	if d.draining {
+		d.mu.Unlock()
+		return
+	}
+	d.draining = true
+	var terminate []func()
+	for session := range d.sessions {
+		if session.terminate != nil {
+			terminate = append(terminate, session.terminate)
+		}
+	}
+	if len(d.sessions) == 0 {
+		d.closeIdle()
+	}
+	d.mu.Unlock()
+
+	for _, fn := range terminate {
+		go fn()
+	}
+}
+
+// isDraining reports whether drain has been called.
+func (d *sessionDrain) isDraining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+// wait blocks until draining has begun and every session has ended, or ctx
+// is done.
+func (d *sessionDrain) wait(ctx context.Context) error {
+	select {
+	case <-d.idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// closeIdle closes the idle channel. Callers must hold d.mu.
+func (d *sessionDrain) closeIdle() {
+	select {
+	case <-d.idle:
+	default:
+		close(d.idle)
+	}
+}
+
+// BeginDrain puts the handler into shutdown mode: new /connect requests are
+// refused with 503 and active sessions are told the server is going away.
+func BeginDrain() {
+	activeSessions.drain()
+}
+
+// Draining reports whether BeginDrain has been called.
+func Draining() bool {
+	return activeSessions.isDraining()
+}
+
+// WaitForSessions blocks until every session has ended after BeginDrain, or
+// ctx is done.
+func WaitForSessions(ctx context.Context) error {
+	return activeSessions.wait(ctx)
+}
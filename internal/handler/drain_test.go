@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionDrain(t *testing.T) {
+	d := newSessionDrain()
+
+	first, ok := d.add()
+	require.True(t, ok)
+	second, ok := d.add()
+	require.True(t, ok)
+
+	terminated := make(chan struct{})
+	d.attach(first, func() { close(terminated) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, d.wait(ctx), context.DeadlineExceeded, "not draining yet")
+
+	d.drain()
+	assert.True(t, d.isDraining())
+	select {
+	case <-terminated:
+	case <-time.After(time.Second):
+		t.Fatal("attached session was not terminated")
+	}
+
+	_, ok = d.add()
+	assert.False(t, ok, "no new sessions while draining")
+
+	// A session that attaches after draining began is ended at once
+	late := false
+	d.attach(second, func() { late = true })
+	assert.True(t, late)
+
+	d.remove(first)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, d.wait(ctx), context.DeadlineExceeded, "one session still active")
+
+	d.remove(second)
+	assert.NoError(t, d.wait(context.Background()))
+
+	// Draining again is harmless
+	d.drain()
+}
+
+func TestSessionDrain_NoSessions(t *testing.T) {
+	d := newSessionDrain()
+	d.drain()
+	assert.NoError(t, d.wait(context.Background()))
+}
+
+func TestConnect_Draining(t *testing.T) {
+	saved := activeSessions
+	activeSessions = newSessionDrain()
+	t.Cleanup(func() { activeSessions = saved })
+
+	activeSessions.drain()
+
+	req := httptest.NewRequest(http.MethodGet, "/connect?width=800&height=600", nil)
+	rec := httptest.NewRecorder()
+	Connect(rec, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
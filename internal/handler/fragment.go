@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"golang.org/x/net/websocket"
+)
+
+// defaultMaxMessageSize is the largest browser message accepted when the
+// configuration leaves WS_MAX_MESSAGE_SIZE at zero.
+const defaultMaxMessageSize = 256 * 1024
+
+// closeStatusMessageTooBig is the WebSocket close code for a message larger
+// than the gateway accepts (RFC 6455)
+const closeStatusMessageTooBig = 1009
+
+// fragmentMarker prefixes one piece of an update to the browser that was
+// split because it exceeds the fragment size:
+// [0xF9][flags][payload chunk]. Fragments of one update are sent back to
+// back, so the browser appends chunks until the one flagged final.
+const fragmentMarker = 0xF9
+
+// fragmentFinal flags the last fragment of an update.
+const fragmentFinal = 0x01
+
+// fragmentUpdate splits data into fragments carrying at most size bytes of
+// payload each. Data no larger than size, or a size of zero, is returned
+// whole and unframed.
+func fragmentUpdate(data []byte, size int) [][]byte {
+	if size <= 0 || len(data) <= size {
+		return [][]byte{data}
+	}
+
+	fragments := make([][]byte, 0, (len(data)+size-1)/size)
+	for start := 0; start < len(data); start += size {
+		end := min(start+size, len(data))
+		var flags byte
+		if end == len(data) {
+			flags = fragmentFinal
+		}
+		fragment := make([]byte, 0, 2+end-start)
+		fragment = append(fragment, fragmentMarker, flags)
+		fragments = append(fragments, append(fragment, data[start:end]...))
+	}
+	return fragments
+}
+
+// sendUpdate sends an update to the browser, fragmented when it exceeds
+// size. The caller must hold the WebSocket write lock so that no other
+// message lands between fragments.
+func sendUpdate(wsConn *websocket.Conn, data []byte, size int) error {
+	for _, fragment := range fragmentUpdate(data, size) {
+		if err := websocket.Message.Send(wsConn, fragment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/rcarmo/go-rdp/internal/rdp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFragmentUpdate(t *testing.T) {
+	data := []byte("0123456789")
+
+	assert.Equal(t, [][]byte{data}, fragmentUpdate(data, 0), "zero disables fragmentation")
+	assert.Equal(t, [][]byte{data}, fragmentUpdate(data, 10), "updates that fit are sent whole")
+
+	assert.Equal(t, [][]byte{
+		{fragmentMarker, 0x00, '0', '1', '2', '3'},
+		{fragmentMarker, 0x00, '4', '5', '6', '7'},
+		{fragmentMarker, fragmentFinal, '8', '9'},
+	}, fragmentUpdate(data, 4))
+
+	assert.Equal(t, [][]byte{
+		{fragmentMarker, 0x00, '0', '1', '2', '3', '4'},
+		{fragmentMarker, fragmentFinal, '5', '6', '7', '8', '9'},
+	}, fragmentUpdate(data, 5), "an exact multiple ends with a full final fragment")
+}
+
+func TestRdpToWs_FragmentsLargeUpdates(t *testing.T) {
+	update := bytes.Repeat([]byte{0x00, 0x01, 0x02}, 1000)
+	mockRDP := &mockRDPConnection{updateData: &rdp.Update{Data: update}, maxUpdates: 1}
+
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		var mu sync.Mutex
+		rdpToWsWithOptions(context.Background(), mockRDP, ws, &mu, relayOptions{fragmentSize: 1024})
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	ws, err := websocket.Dial(wsURL, "", "http://localhost/")
+	require.NoError(t, err)
+	defer func() { _ = ws.Close() }()
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(2*time.Second)))
+
+	var reassembled []byte
+	for i := 0; ; i++ {
+		var fragment []byte
+		require.NoError(t, websocket.Message.Receive(ws, &fragment))
+		require.GreaterOrEqual(t, len(fragment), 2)
+		assert.Equal(t, byte(fragmentMarker), fragment[0])
+		assert.LessOrEqual(t, len(fragment)-2, 1024)
+		reassembled = append(reassembled, fragment[2:]...)
+		if fragment[1]&fragmentFinal != 0 {
+			assert.Equal(t, 2, i, "3000 bytes should take three fragments")
+			break
+		}
+	}
+	assert.Equal(t, update, reassembled)
+}
+
+func TestWsToRdp_MessageTooLarge(t *testing.T) {
+	mockRDP := &mockRDPConnection{}
+
+	done := make(chan struct{})
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		ws.MaxPayloadBytes = 1024
+		ctx, cancel := context.WithCancel(context.Background())
+		wsToRdp(ctx, ws, mockRDP, cancel)
+		close(done)
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	ws, err := websocket.Dial(wsURL, "", "http://localhost/")
+	require.NoError(t, err)
+	defer func() { _ = ws.Close() }()
+
+	require.NoError(t, websocket.Message.Send(ws, make([]byte, 512)))
+	require.NoError(t, websocket.Message.Send(ws, make([]byte, 4096)))
+
+	var msg string
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(2*time.Second)))
+	require.NoError(t, websocket.Message.Receive(ws, &msg))
+	assert.JSONEq(t, `{"type":"error","message":"Message too large"}`, msg)
+
+	// The close frame follows the error
+	assert.ErrorIs(t, websocket.Message.Receive(ws, &msg), io.EOF)
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("wsToRdp did not stop on an oversized message")
+	}
+
+	mockRDP.mu.Lock()
+	defer mockRDP.mu.Unlock()
+	require.Len(t, mockRDP.receivedInputs, 1, "only the message within the limit is forwarded")
+}
@@ -0,0 +1,260 @@
+package handler
+
+import (
+	"encoding/binary"
+	"image"
+
+	"github.com/rcarmo/go-rdp/internal/codec/rfx"
+	"github.com/rcarmo/go-rdp/internal/logging"
+	"github.com/rcarmo/go-rdp/internal/protocol/fastpath"
+	"github.com/rcarmo/go-rdp/internal/rdp"
+)
+
+// backlogReporter is implemented by connections that can tell whether the
+// next update is already waiting to be read
+type backlogReporter interface {
+	Backlogged() bool
+}
+
+// surfaceFrame is the updates of one frame, from the one carrying its
+// frame start marker to the one carrying its frame end marker.
+type surfaceFrame struct {
+	updates []*rdp.Update
+	started bool
+	ended   bool
+
+	// area is the desktop painted by the frame's surface bits; it is
+	// unknown, and the frame never skipped, when opaque is set
+	area   []image.Rectangle
+	opaque bool
+}
+
+// covers reports whether f paints everything prev painted, so that prev can
+// be dropped without leaving stale pixels behind.
+func (f *surfaceFrame) covers(prev *surfaceFrame) bool {
+	if f.opaque || prev.opaque {
+		return false
+	}
+	for _, r := range prev.area {
+		covered := false
+		for _, a := range f.area {
+			if r.In(a) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// maxFrameUpdates bounds the updates held back while reading one frame
+const maxFrameUpdates = 256
+
+// frameSkipper drops RemoteFX video frames the relay has fallen behind on.
+// While updates are backlogged, each complete frame is held until the next
+// one is read; if the newer frame repaints everything the held one painted,
+// the held frame is dropped and only the latest frame of the run reaches the
+// browser and the snapshot framebuffer. Frames are never reordered, and
+// frames mixing in other updates are always forwarded. Acknowledging the
+// latest frame acknowledges the dropped ones with it.
+type frameSkipper struct {
+	get        func() (*rdp.Update, error)
+	backlogged func() bool
+
+	queue []*rdp.Update
+	err   error // read error deferred until the queue is drained
+
+	// fragments collects the surface commands of a fragmented update
+	fragments []byte
+
+	skipped int
+}
+
+// newFrameSkipper wraps get, skipping superseded frames while backlogged
+// reports that more updates are waiting.
+func newFrameSkipper(get func() (*rdp.Update, error), backlogged func() bool) *frameSkipper {
+	return &frameSkipper{get: get, backlogged: backlogged}
+}
+
+// next returns the next update to forward.
+func (s *frameSkipper) next() (*rdp.Update, error) {
+	if len(s.queue) > 0 {
+		update := s.queue[0]
+		s.queue = s.queue[1:]
+		return update, nil
+	}
+	if s.err != nil {
+		err := s.err
+		s.err = nil
+		return nil, err
+	}
+
+	update, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	// Only hold back frames when already behind, so a keeping-up relay
+	// forwards every update as soon as it arrives
+	if !s.backlogged() {
+		s.observe(update, nil)
+		return update, nil
+	}
+	var current surfaceFrame
+	if !s.observe(update, &current) {
+		return update, nil
+	}
+	if !s.readFrame(&current) {
+		s.queue = append(s.queue, current.updates...)
+		return s.next()
+	}
+
+	for s.backlogged() {
+		update, err := s.get()
+		if err != nil {
+			s.err = err
+			break
+		}
+		var frame surfaceFrame
+		if !s.observe(update, &frame) {
+			s.queue = append(s.queue, current.updates...)
+			s.queue = append(s.queue, update)
+			return s.next()
+		}
+		complete := s.readFrame(&frame)
+		if complete && frame.covers(&current) {
+			s.skipped++
+			logging.Debug("Skipping superseded RemoteFX frame (%d skipped)", s.skipped)
+		} else {
+			s.queue = append(s.queue, current.updates...)
+		}
+		current = frame
+		if !complete {
+			break
+		}
+	}
+	s.queue = append(s.queue, current.updates...)
+	return s.next()
+}
+
+// readFrame reads updates into frame until its end marker. It reports false
+// if the rest of the frame is not waiting already, if the frame grows past
+// maxFrameUpdates or if a read fails, deferring the error.
+func (s *frameSkipper) readFrame(frame *surfaceFrame) bool {
+	for !frame.ended {
+		if !s.backlogged() || len(frame.updates) >= maxFrameUpdates {
+			return false
+		}
+		update, err := s.get()
+		if err != nil {
+			s.err = err
+			return false
+		}
+		s.observe(update, frame)
+	}
+	return true
+}
+
+// observe scans an update's fast-path updates, adding it to frame when
+// frame is non-nil. It reports whether the update starts the frame.
+func (s *frameSkipper) observe(update *rdp.Update, frame *surfaceFrame) (start bool) {
+	if frame == nil {
+		frame = &surfaceFrame{}
+	}
+	frame.updates = append(frame.updates, update)
+
+	data := update.Data
+	for len(data) >= 3 {
+		header := data[0]
+		size := int(binary.LittleEndian.Uint16(data[1:3]))
+		if 3+size > len(data) {
+			frame.opaque = true
+			return start
+		}
+		payload := data[3 : 3+size]
+		data = data[3+size:]
+
+		if fastpath.UpdateCode(header&0xf) != fastpath.UpdateCodeSurfCMDs {
+			frame.opaque = true
+			continue
+		}
+
+		switch fastpath.Fragment((header >> 4) & 0x3) {
+		case fastpath.FragmentSingle:
+		case fastpath.FragmentFirst:
+			s.fragments = append(s.fragments[:0], payload...)
+			continue
+		case fastpath.FragmentNext:
+			s.fragments = append(s.fragments, payload...)
+			continue
+		case fastpath.FragmentLast:
+			payload = append(s.fragments, payload...)
+			s.fragments = s.fragments[:0]
+		}
+
+		commands, _ := fastpath.ParseSurfaceCommands(payload)
+		for _, cmd := range commands {
+			if frame.ended {
+				// Anything after the end marker belongs to another frame
+				frame.opaque = true
+			}
+			switch cmd.CmdType {
+			case fastpath.CmdTypeFrameMarker:
+				marker, err := fastpath.ParseFrameMarker(cmd.Data)
+				if err != nil {
+					frame.opaque = true
+					continue
+				}
+				switch {
+				case marker.FrameAction == fastpath.FrameStart && !frame.started && len(frame.updates) == 1:
+					start = true
+					frame.started = true
+				case marker.FrameAction == fastpath.FrameEnd && frame.started:
+					frame.ended = true
+				default:
+					frame.opaque = true
+				}
+			case fastpath.CmdTypeSurfaceBits, fastpath.CmdTypeStreamSurfaceBits:
+				bits, err := fastpath.ParseSetSurfaceBits(cmd.Data)
+				if err != nil {
+					frame.opaque = true
+					continue
+				}
+				frame.addSurfaceBits(bits)
+			default:
+				frame.opaque = true
+			}
+		}
+	}
+	if len(data) != 0 {
+		frame.opaque = true
+	}
+	return start
+}
+
+// addSurfaceBits adds the area painted by a surface bits command: the RFX
+// region rectangles, or the destination rectangle for other codecs.
+func (f *surfaceFrame) addSurfaceBits(bits *fastpath.SetSurfaceBitsCommand) {
+	left, top := int(bits.DestLeft), int(bits.DestTop)
+	data := bits.BitmapData
+
+	if len(data) >= 2 {
+		if magic := binary.LittleEndian.Uint16(data); (magic >= rfx.WBT_SYNC && magic <= rfx.WBT_EXTENSION) || magic == rfx.WBT_TILESET || magic == rfx.CBT_TILE {
+			// Messages that do not open with a frame begin block carry the
+			// sync, channels or context blocks later frames decode with
+			rects, ok := rfx.MessageRegion(data)
+			if !ok || magic != rfx.WBT_FRAME_BEGIN {
+				f.opaque = true
+				return
+			}
+			for _, r := range rects {
+				x, y := left+int(r.X), top+int(r.Y)
+				f.area = append(f.area, image.Rect(x, y, x+int(r.Width), y+int(r.Height)))
+			}
+			return
+		}
+	}
+	f.area = append(f.area, image.Rect(left, top, left+int(bits.Width), top+int(bits.Height)))
+}
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcarmo/go-rdp/internal/codec/rfx"
+	"github.com/rcarmo/go-rdp/internal/protocol/fastpath"
+	"github.com/rcarmo/go-rdp/internal/rdp"
+)
+
+// surfCmdsUpdate wraps surface commands in a single fast-path update.
+func surfCmdsUpdate(commands ...[]byte) *rdp.Update {
+	var payload []byte
+	for _, cmd := range commands {
+		payload = append(payload, cmd...)
+	}
+	data := []byte{byte(fastpath.UpdateCodeSurfCMDs), 0, 0}
+	binary.LittleEndian.PutUint16(data[1:], uint16(len(payload)))
+	return &rdp.Update{Data: append(data, payload...)}
+}
+
+// frameMarkerCmd builds a frame marker surface command.
+func frameMarkerCmd(action uint16, frameID uint32) []byte {
+	cmd := make([]byte, 8)
+	binary.LittleEndian.PutUint16(cmd[0:], fastpath.CmdTypeFrameMarker)
+	binary.LittleEndian.PutUint16(cmd[2:], action)
+	binary.LittleEndian.PutUint32(cmd[4:], frameID)
+	return cmd
+}
+
+// surfaceBitsCmd builds a surface bits command painting a width x height
+// area at (left, top) with the given bitmap data.
+func surfaceBitsCmd(left, top, width, height uint16, bitmap []byte) []byte {
+	cmd := make([]byte, 22, 22+len(bitmap))
+	binary.LittleEndian.PutUint16(cmd[0:], fastpath.CmdTypeSurfaceBits)
+	binary.LittleEndian.PutUint16(cmd[2:], left)
+	binary.LittleEndian.PutUint16(cmd[4:], top)
+	binary.LittleEndian.PutUint16(cmd[6:], left+width)
+	binary.LittleEndian.PutUint16(cmd[8:], top+height)
+	cmd[10] = 32
+	binary.LittleEndian.PutUint16(cmd[14:], width)
+	binary.LittleEndian.PutUint16(cmd[16:], height)
+	binary.LittleEndian.PutUint32(cmd[18:], uint32(len(bitmap)))
+	return append(cmd, bitmap...)
+}
+
+// rfxBlock builds an RFX message block with the given body.
+func rfxBlock(blockType uint16, body []byte) []byte {
+	block := make([]byte, 6, 6+len(body))
+	binary.LittleEndian.PutUint16(block[0:], blockType)
+	binary.LittleEndian.PutUint32(block[2:], uint32(6+len(body)))
+	return append(block, body...)
+}
+
+// rfxFrameMessage builds an RFX frame message whose region is one rectangle.
+func rfxFrameMessage(leading uint16, x, y, width, height uint16) []byte {
+	region := make([]byte, 11+8)
+	binary.LittleEndian.PutUint16(region[1:], 1)
+	binary.LittleEndian.PutUint16(region[3:], x)
+	binary.LittleEndian.PutUint16(region[5:], y)
+	binary.LittleEndian.PutUint16(region[7:], width)
+	binary.LittleEndian.PutUint16(region[9:], height)
+	return append(rfxBlock(leading, make([]byte, 8)), rfxBlock(rfx.WBT_REGION, region)...)
+}
+
+// testFrame builds the updates of a frame painting one surface bits command:
+// the start marker, the bits and the end marker, each in its own update.
+func testFrame(frameID uint32, bits []byte) []*rdp.Update {
+	return []*rdp.Update{
+		surfCmdsUpdate(frameMarkerCmd(fastpath.FrameStart, frameID)),
+		surfCmdsUpdate(bits),
+		surfCmdsUpdate(frameMarkerCmd(fastpath.FrameEnd, frameID)),
+	}
+}
+
+// scriptedUpdates serves updates in order, then err. It is backlogged while
+// updates remain unless keepingUp is set.
+type scriptedUpdates struct {
+	updates   []*rdp.Update
+	err       error
+	keepingUp bool
+}
+
+func (s *scriptedUpdates) get() (*rdp.Update, error) {
+	if len(s.updates) == 0 {
+		return nil, s.err
+	}
+	update := s.updates[0]
+	s.updates = s.updates[1:]
+	return update, nil
+}
+
+func (s *scriptedUpdates) backlogged() bool {
+	return !s.keepingUp && len(s.updates) > 0
+}
+
+// drain forwards every update until the script's error.
+func drain(t *testing.T, skipper *frameSkipper) []*rdp.Update {
+	t.Helper()
+	var out []*rdp.Update
+	for {
+		update, err := skipper.next()
+		if err != nil {
+			return out
+		}
+		out = append(out, update)
+	}
+}
+
+func concatFrames(frames ...[]*rdp.Update) []*rdp.Update {
+	var all []*rdp.Update
+	for _, f := range frames {
+		all = append(all, f...)
+	}
+	return all
+}
+
+func TestFrameSkipper_BacklogForwardsLatestFrame(t *testing.T) {
+	bits := surfaceBitsCmd(0, 0, 64, 64, []byte{1, 2, 3})
+	frames := [][]*rdp.Update{testFrame(1, bits), testFrame(2, bits), testFrame(3, bits)}
+	script := &scriptedUpdates{updates: concatFrames(frames...), err: errors.New("done")}
+	skipper := newFrameSkipper(script.get, script.backlogged)
+
+	assert.Equal(t, frames[2], drain(t, skipper))
+	assert.Equal(t, 2, skipper.skipped)
+}
+
+func TestFrameSkipper_KeepingUpForwardsEveryFrame(t *testing.T) {
+	bits := surfaceBitsCmd(0, 0, 64, 64, []byte{1, 2, 3})
+	all := concatFrames(testFrame(1, bits), testFrame(2, bits))
+	script := &scriptedUpdates{updates: append([]*rdp.Update(nil), all...), err: errors.New("done"), keepingUp: true}
+	skipper := newFrameSkipper(script.get, script.backlogged)
+
+	assert.Equal(t, all, drain(t, skipper))
+	assert.Zero(t, skipper.skipped)
+}
+
+func TestFrameSkipper_KeepsFramesNotRepainted(t *testing.T) {
+	// The second frame repaints only part of the first
+	first := testFrame(1, surfaceBitsCmd(0, 0, 128, 64, []byte{1}))
+	second := testFrame(2, surfaceBitsCmd(0, 0, 64, 64, []byte{2}))
+	all := concatFrames(first, second)
+	script := &scriptedUpdates{updates: append([]*rdp.Update(nil), all...), err: errors.New("done")}
+
+	assert.Equal(t, all, drain(t, newFrameSkipper(script.get, script.backlogged)))
+}
+
+func TestFrameSkipper_KeepsFramesWithOtherUpdates(t *testing.T) {
+	bits := surfaceBitsCmd(0, 0, 64, 64, []byte{1})
+	first := testFrame(1, bits)
+	// A pointer update inside the frame must still reach the browser
+	first = append(first[:2:2], &rdp.Update{Data: []byte{byte(fastpath.UpdateCodePTRDefault), 0, 0}}, first[2])
+	second := testFrame(2, bits)
+	pointer := &rdp.Update{Data: []byte{byte(fastpath.UpdateCodePTRNull), 0, 0}}
+
+	all := append(concatFrames(first, second), pointer)
+	script := &scriptedUpdates{updates: append([]*rdp.Update(nil), all...), err: errors.New("done")}
+	assert.Equal(t, all, drain(t, newFrameSkipper(script.get, script.backlogged)))
+}
+
+func TestFrameSkipper_RemoteFXRegions(t *testing.T) {
+	latest := testFrame(3, surfaceBitsCmd(0, 0, 256, 256, rfxFrameMessage(rfx.WBT_FRAME_BEGIN, 0, 0, 128, 128)))
+	frames := concatFrames(
+		testFrame(1, surfaceBitsCmd(0, 0, 256, 256, rfxFrameMessage(rfx.WBT_FRAME_BEGIN, 64, 64, 64, 64))),
+		testFrame(2, surfaceBitsCmd(0, 0, 256, 256, rfxFrameMessage(rfx.WBT_FRAME_BEGIN, 0, 0, 128, 128))),
+		latest,
+	)
+	script := &scriptedUpdates{updates: frames, err: errors.New("done")}
+	assert.Equal(t, latest, drain(t, newFrameSkipper(script.get, script.backlogged)))
+
+	// A message resetting the decoder is needed by the frames after it
+	sync := testFrame(1, surfaceBitsCmd(0, 0, 256, 256, rfxFrameMessage(rfx.WBT_SYNC, 0, 0, 128, 128)))
+	all := concatFrames(sync, latest)
+	script = &scriptedUpdates{updates: append([]*rdp.Update(nil), all...), err: errors.New("done")}
+	assert.Equal(t, all, drain(t, newFrameSkipper(script.get, script.backlogged)))
+}
+
+func TestFrameSkipper_ReadErrorAfterQueuedUpdates(t *testing.T) {
+	readErr := errors.New("connection reset")
+	bits := surfaceBitsCmd(0, 0, 64, 64, []byte{1})
+	complete := testFrame(1, bits)
+	partial := testFrame(2, bits)[:2]
+	script := &scriptedUpdates{updates: concatFrames(complete, partial), err: readErr}
+	skipper := newFrameSkipper(script.get, script.backlogged)
+
+	for _, want := range concatFrames(complete, partial) {
+		update, err := skipper.next()
+		require.NoError(t, err)
+		assert.Equal(t, want, update)
+	}
+	_, err := skipper.next()
+	assert.ErrorIs(t, err, readErr)
+}
@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rcarmo/go-rdp/internal/config"
+	"github.com/rcarmo/go-rdp/internal/rdp"
+	"github.com/rcarmo/go-rdp/internal/transport/dnscache"
+	"github.com/rcarmo/go-rdp/internal/transport/rdg"
+)
+
+// targetDialTimeout bounds each TCP dial to a resolved target address
+const targetDialTimeout = 5 * time.Second
+
+// targetResolver caches the target lookups of all sessions. It is replaced
+// when the configured TTLs change.
+var targetResolver struct {
+	mu    sync.Mutex
+	cache *dnscache.Cache
+}
+
+// resolverFor returns the shared target lookup cache for cfg's TTLs.
+func resolverFor(cfg *config.Config) *dnscache.Cache {
+	targetResolver.mu.Lock()
+	defer targetResolver.mu.Unlock()
+
+	ttl, negativeTTL := cfg.RDP.DNSCacheTTL, cfg.RDP.DNSNegativeCacheTTL
+	if c := targetResolver.cache; c != nil {
+		if cachedTTL, cachedNegativeTTL := c.TTLs(); cachedTTL == ttl && cachedNegativeTTL == negativeTTL {
+			return c
+		}
+	}
+	targetResolver.cache = dnscache.New(nil, ttl, negativeTTL)
+	targetResolver.cache.Dialer = &net.Dialer{Timeout: targetDialTimeout}
+	return targetResolver.cache
+}
+
+// lookupHost resolves target host names when the lookup cache is disabled
+var lookupHost = net.DefaultResolver.LookupHost
+
+// lookupTarget resolves a target host name, through the shared lookup cache
+// when it is enabled.
+func lookupTarget(ctx context.Context, cfg *config.Config, host string) ([]netip.Addr, error) {
+	lookup := lookupHost
+	if cfg.RDP.DNSCacheTTL > 0 || cfg.RDP.DNSNegativeCacheTTL > 0 {
+		lookup = resolverFor(cfg).LookupHost
+	}
+	names, err := lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []netip.Addr
+	for _, name := range names {
+		if addr, err := netip.ParseAddr(name); err == nil {
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses for %s", host)
+	}
+	return addrs, nil
+}
+
+// newRDPClient connects to the RDP server directly or, when a gateway is
+// configured, through an RD Gateway tunnel authenticated with the same
+// credentials. Direct connections resolve the target through the shared
+// lookup cache when it is enabled, and are held to the target policy at the
+// address dialed. Each TCP dial, to the target or to the gateway, is bounded
+// by the dial timeout and redialed on transient failures.
+func newRDPClient(ctx context.Context, cfg *config.Config, creds *connectionRequest, width, height, colorDepth int) (*rdp.Client, error) {
+	if cfg.RDP.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.RDP.Timeout)
+		defer cancel()
+	}
+	retry := rdp.ConnectRetry{Retries: cfg.RDP.DialRetries, Backoff: cfg.RDP.DialRetryBackoff}
+
+	if cfg.RDP.Gateway == "" {
+		dial, err := targetDial(cfg)
+		if err != nil {
+			return nil, err
+		}
+		dial = retry.Dial(withDialTimeout(dial, cfg.RDP.DialTimeout))
+		return rdp.NewClientWithDialContext(ctx, dial, creds.Host, creds.User, creds.Password, width, height, colorDepth)
+	}
+
+	dialer := &rdg.Dialer{
+		Gateway:  cfg.RDP.Gateway,
+		Username: creds.User,
+		Password: creds.Password,
+		TLSConfig: &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: cfg.Security.SkipTLSValidation, // #nosec G402 -- gateways commonly use self-signed certificates
+		},
+		DialGateway: retry.Dial(withDialTimeout((&net.Dialer{}).DialContext, cfg.RDP.DialTimeout)),
+	}
+	client, err := rdp.NewClientWithDialContext(ctx, dialer.DialContext, creds.Host, creds.User, creds.Password, width, height, colorDepth)
+	if err != nil {
+		return nil, err
+	}
+	client.SetTransport(rdp.TransportGateway)
+	return client, nil
+}
+
+// targetDial returns the dial for direct connections to RDP targets. Under a
+// target policy the name is resolved here and each address is checked in the
+// dialer's Control hook as it is connected, so a name that re-resolves to
+// another address after checkTarget cannot slip past the policy.
+func targetDial(cfg *config.Config) (rdp.DialFunc, error) {
+	policy, err := cfg.Security.TargetPolicy()
+	if err != nil {
+		return nil, err
+	}
+	if !policy.Active() {
+		if cfg.RDP.DNSCacheTTL > 0 || cfg.RDP.DNSNegativeCacheTTL > 0 {
+			return resolverFor(cfg).DialContext, nil
+		}
+		return (&net.Dialer{}).DialContext, nil
+	}
+
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		name := host
+		addrs := []string{host}
+		if _, err := netip.ParseAddr(host); err == nil {
+			name = ""
+		} else {
+			resolved, err := lookupTarget(ctx, cfg, host)
+			if err != nil {
+				return nil, fmt.Errorf("%w: cannot resolve %s: %v", config.ErrTargetNotAllowed, host, err)
+			}
+			addrs = addrs[:0]
+			for _, addr := range resolved {
+				addrs = append(addrs, addr.String())
+			}
+		}
+
+		dialer := &net.Dialer{
+			Timeout: targetDialTimeout,
+			Control: func(_, address string, _ syscall.RawConn) error {
+				addrPort, err := netip.ParseAddrPort(address)
+				if err != nil {
+					return err
+				}
+				return policy.Check(name, addrPort.Addr())
+			},
+		}
+		var errs []error
+		for _, addr := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+			if err == nil {
+				return conn, nil
+			}
+			if errors.Is(err, config.ErrTargetNotAllowed) {
+				return nil, err
+			}
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return nil, errors.Join(errs...)
+	}, nil
+}
+
+// withDialTimeout bounds each call of dial by timeout; zero leaves dial
+// bounded by its context alone.
+func withDialTimeout(dial rdp.DialFunc, timeout time.Duration) rdp.DialFunc {
+	if timeout <= 0 {
+		return dial
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return dial(ctx, network, address)
+	}
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcarmo/go-rdp/internal/config"
+)
+
+func TestResolverFor_SharedUntilTTLsChange(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.RDP.DNSCacheTTL = 30 * time.Second
+	cfg.RDP.DNSNegativeCacheTTL = 5 * time.Second
+
+	first := resolverFor(cfg)
+	assert.Same(t, first, resolverFor(cfg))
+
+	cfg.RDP.DNSCacheTTL = time.Minute
+	changed := resolverFor(cfg)
+	assert.NotSame(t, first, changed)
+	ttl, negativeTTL := changed.TTLs()
+	assert.Equal(t, time.Minute, ttl)
+	assert.Equal(t, 5*time.Second, negativeTTL)
+}
+
+// TestTargetDial_ChecksDialedAddress validates that a name which passed
+// checkTarget is refused when it re-resolves to a private address for the
+// dial, as in DNS rebinding
+func TestTargetDial_ChecksDialedAddress(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	lookups := 0
+	orig := lookupHost
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		lookups++
+		if lookups == 1 {
+			return []string{"203.0.113.10"}, nil
+		}
+		return []string{"127.0.0.1"}, nil
+	}
+	defer func() { lookupHost = orig }()
+
+	cfg := &config.Config{}
+	cfg.Security.BlockPrivateTargets = true
+	target := net.JoinHostPort("rebind.example", port)
+	require.NoError(t, checkTarget(context.Background(), cfg, target))
+
+	dial, err := targetDial(cfg)
+	require.NoError(t, err)
+	conn, err := dial(context.Background(), "tcp", target)
+	if conn != nil {
+		conn.Close()
+	}
+	assert.ErrorIs(t, err, config.ErrTargetNotAllowed)
+	assert.Equal(t, 2, lookups, "the dial should resolve the name itself")
+}
+
+func TestTargetDial_AllowedAddress(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	cfg := &config.Config{}
+	cfg.Security.AllowedTargets = []string{"127.0.0.1"}
+	dial, err := targetDial(cfg)
+	require.NoError(t, err)
+	conn, err := dial(context.Background(), "tcp", listener.Addr().String())
+	require.NoError(t, err)
+	conn.Close()
+
+	cfg.Security = config.SecurityConfig{BlockPrivateTargets: true}
+	dial, err = targetDial(cfg)
+	require.NoError(t, err)
+	_, err = dial(context.Background(), "tcp", listener.Addr().String())
+	assert.ErrorIs(t, err, config.ErrTargetNotAllowed)
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/rcarmo/go-rdp/internal/logging"
+)
+
+// pingCodec sends empty WebSocket ping frames. Browsers answer them with a
+// pong on their own, so no client code is involved.
+var pingCodec = websocket.Codec{
+	Marshal: func(any) ([]byte, byte, error) {
+		return nil, websocket.PingFrame, nil
+	},
+}
+
+// wsHeartbeat pings the browser when no updates have been sent for the
+// interval, so that proxies do not close idle sessions.
+type wsHeartbeat struct {
+	mu       sync.Mutex
+	interval time.Duration
+	poll     time.Duration
+	now      func() time.Time
+	lastSend time.Time
+}
+
+// newWSHeartbeat creates a heartbeat with the given interval.
+// A nil clock defaults to time.Now.
+func newWSHeartbeat(interval time.Duration, now func() time.Time) *wsHeartbeat {
+	if now == nil {
+		now = time.Now
+	}
+	return &wsHeartbeat{
+		interval: interval,
+		poll:     pollIntervalFor(interval),
+		now:      now,
+		lastSend: now(),
+	}
+}
+
+// sent records a message sent to the browser.
+func (h *wsHeartbeat) sent() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastSend = h.now()
+}
+
+// due returns true when the interval has elapsed since the last message,
+// counting the heartbeat it asks for as sent.
+func (h *wsHeartbeat) due() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.now().Sub(h.lastSend) < h.interval {
+		return false
+	}
+	h.lastSend = h.now()
+	return true
+}
+
+// run pings the browser whenever a heartbeat is due until ctx is cancelled
+// or a ping fails.
+func (h *wsHeartbeat) run(ctx context.Context, wsConn *websocket.Conn, wsMu *sync.Mutex) {
+	ticker := time.NewTicker(h.poll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !h.due() {
+				continue
+			}
+			wsMu.Lock()
+			err := pingCodec.Send(wsConn, nil)
+			wsMu.Unlock()
+			if err != nil {
+				logging.Debug("WebSocket heartbeat failed: %v", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWSHeartbeat_Due(t *testing.T) {
+	clock := newFakeClock()
+	h := newWSHeartbeat(20*time.Second, clock.Now)
+
+	clock.Advance(19 * time.Second)
+	assert.False(t, h.due(), "should not ping before the interval")
+
+	clock.Advance(time.Second)
+	assert.True(t, h.due(), "should ping once the interval elapses")
+	assert.False(t, h.due(), "the ping counts as a sent message")
+
+	clock.Advance(15 * time.Second)
+	h.sent()
+	clock.Advance(15 * time.Second)
+	assert.False(t, h.due(), "updates should postpone the ping")
+
+	clock.Advance(5 * time.Second)
+	assert.True(t, h.due())
+}
+
+func TestWSHeartbeat_NilSent(t *testing.T) {
+	var h *wsHeartbeat
+	assert.NotPanics(t, func() { h.sent() })
+}
+
+func TestWSHeartbeat_RunContextCancelled(t *testing.T) {
+	h := newWSHeartbeat(time.Hour, newFakeClock().Now)
+	h.poll = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		var mu sync.Mutex
+		h.run(ctx, nil, &mu)
+		close(done)
+	}()
+
+	time.Sleep(30 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("heartbeat did not stop on cancellation")
+	}
+}
+
+func TestRdpToWs_HeartbeatSendsPing(t *testing.T) {
+	clock := newFakeClock()
+	heartbeat := newWSHeartbeat(30*time.Second, clock.Now)
+	heartbeat.poll = 10 * time.Millisecond
+	blocking := &blockingRDPConnection{release: make(chan struct{})}
+	defer close(blocking.release)
+
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var mu sync.Mutex
+		go rdpToWsWithOptions(ctx, blocking, ws, &mu, relayOptions{heartbeat: heartbeat})
+
+		// No updates flow past the heartbeat interval
+		clock.Advance(31 * time.Second)
+
+		// Keep the handler alive until the client has read the ping
+		var ignored []byte
+		_ = websocket.Message.Receive(ws, &ignored)
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	ws, err := websocket.Dial(wsURL, "", "http://localhost/")
+	require.NoError(t, err)
+	defer func() { _ = ws.Close() }()
+
+	// Read raw frames: Message.Receive answers pings without returning them
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(2*time.Second)))
+	frame, err := ws.NewFrameReader()
+	require.NoError(t, err)
+	assert.Equal(t, byte(websocket.PingFrame), frame.PayloadType())
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/rcarmo/go-rdp/internal/logging"
+	"github.com/rcarmo/go-rdp/internal/rdp"
+)
+
+// maxRedirects bounds the Server Redirection PDUs followed for one session,
+// so brokers pointing at each other cannot loop forever.
+const maxRedirects = 3
+
+// connectCallbacks receive the progress of every client a connection goes
+// through: the status reported by each server dialed, the stages each
+// client enters and the phases it reaches. Nil callbacks are left unset.
+type connectCallbacks struct {
+	onStatus rdp.StatusInfoCallback
+	onStage  rdp.StageCallback
+	onPhase  rdp.ConnectEventCallback
+}
+
+// apply sets the callbacks on rdpClient.
+func (cb connectCallbacks) apply(rdpClient *rdp.Client) {
+	if cb.onStatus != nil {
+		rdpClient.SetStatusInfoCallback(cb.onStatus)
+	}
+	if cb.onStage != nil {
+		rdpClient.SetStageCallback(cb.onStage)
+	}
+	if cb.onPhase != nil {
+		rdpClient.SetConnectEventCallback(cb.onPhase)
+	}
+}
+
+// connectRDP connects rdpClient, following any Server Redirection PDU by
+// re-dialing the target session host with the same connection parameters
+// and replaying the logon. It returns the client in use when it stopped,
+// which the caller must close even on error, and the result of its last
+// connection sequence, nil if a redirection target could not be dialed.
+func connectRDP(ctx context.Context, rdpClient *rdp.Client, creds *connectionRequest, params *connectionParams, callbacks connectCallbacks) (*rdp.Client, *rdp.ConnectResult, error) {
+	host := creds.Host
+	for redirects := 0; ; redirects++ {
+		callbacks.apply(rdpClient)
+		result, err := rdpClient.ConnectWithResultContext(ctx)
+		if !errors.Is(err, rdp.ErrServerRedirected) {
+			return rdpClient, result, err
+		}
+		if redirects == maxRedirects {
+			return rdpClient, result, fmt.Errorf("too many redirections: %w", err)
+		}
+
+		info := rdpClient.Redirection()
+		targets, err := redirectTargets(info, host)
+		if err != nil {
+			return rdpClient, result, err
+		}
+		_ = rdpClient.Close()
+
+		redirected, target, err := dialRedirectTarget(ctx, targets, creds, params)
+		if err != nil {
+			return rdpClient, nil, err
+		}
+		logging.Info("Following server redirection to %s (session %d)", target, info.SessionID)
+		redirected.SetRedirection(info)
+		rdpClient, host = redirected, target
+	}
+}
+
+// dialRedirectTarget sets up a client for the first target that accepts a
+// connection, returning it and the target dialed.
+func dialRedirectTarget(ctx context.Context, targets []string, creds *connectionRequest, params *connectionParams) (*rdp.Client, string, error) {
+	var errs []error
+	for _, target := range targets {
+		if err := checkTarget(ctx, currentConfig(), target); err != nil {
+			logging.Info("Refusing redirection target %s: %v", target, err)
+			errs = append(errs, err)
+			continue
+		}
+		redirectedCreds := *creds
+		redirectedCreds.Host = target
+		rdpClient, err := setupRDPClient(ctx, &redirectedCreds, params)
+		if err == nil {
+			return rdpClient, target, nil
+		}
+		logging.Debug("Redirection target %s unreachable: %v", target, err)
+		errs = append(errs, err)
+	}
+	return nil, "", fmt.Errorf("no redirection target reachable: %w", errors.Join(errs...))
+}
+
+// redirectTargets returns the host:port targets to try for a redirection
+// received from host, in order. Redirection addresses carry no port, so the
+// port of host is kept; a redirection without targets reconnects to host.
+func redirectTargets(info *rdp.RedirectionInfo, host string) ([]string, error) {
+	if info == nil {
+		return nil, errors.New("server redirection without details")
+	}
+	_, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []string
+	for _, addr := range info.Targets() {
+		target, err := parseTarget(net.JoinHostPort(addr, port))
+		if err != nil {
+			logging.Debug("Ignoring redirection target %q: %v", addr, err)
+			continue
+		}
+		targets = append(targets, target)
+	}
+	if len(targets) == 0 {
+		if !info.NoRedirect {
+			return nil, errors.New("server redirection without a usable target")
+		}
+		targets = append(targets, host)
+	}
+	return targets, nil
+}
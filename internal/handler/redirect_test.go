@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcarmo/go-rdp/internal/rdp"
+)
+
+func TestRedirectTargets(t *testing.T) {
+	info := &rdp.RedirectionInfo{
+		TargetAddress:   "10.0.0.12",
+		TargetAddresses: []string{"10.0.0.12", "2001:db8::12", "fe80::12%eth0", "bad host"},
+		TargetFQDN:      "host12.corp.example",
+	}
+	targets, err := redirectTargets(info, "broker.corp.example:3390")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"10.0.0.12:3390",
+		"[2001:db8::12]:3390",
+		"[fe80::12%eth0]:3390",
+		"host12.corp.example:3390",
+	}, targets)
+}
+
+func TestRedirectTargets_NoRedirect(t *testing.T) {
+	info := &rdp.RedirectionInfo{TargetAddress: "10.0.0.12", NoRedirect: true}
+	targets, err := redirectTargets(info, "broker.corp.example:3389")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"broker.corp.example:3389"}, targets)
+}
+
+func TestRedirectTargets_Errors(t *testing.T) {
+	_, err := redirectTargets(nil, "broker:3389")
+	assert.Error(t, err)
+
+	_, err = redirectTargets(&rdp.RedirectionInfo{TargetAddress: "bad host"}, "broker:3389")
+	assert.Error(t, err)
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/rcarmo/go-rdp/internal/logging"
+	"github.com/rcarmo/go-rdp/internal/rdp"
+)
+
+// serverHeartbeatPoll is how often the server heartbeats are checked
+// against the thresholds the server announced with them.
+const serverHeartbeatPoll = time.Second
+
+// enforceServerHeartbeats acts on the missed heartbeat thresholds of the
+// Server Heartbeat PDU (MS-RDPBCGR 2.2.16.1): the browser is warned once
+// count1 heartbeats are overdue, and the session is terminated once count2
+// are, so the browser can reconnect. A zero threshold is never reached. It
+// returns when the session is terminated or ctx is cancelled.
+func enforceServerHeartbeats(ctx context.Context, wsConn *websocket.Conn, wsMu *sync.Mutex, stats func() rdp.HeartbeatStats, interval time.Duration, terminate func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	warned := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		heartbeats := stats()
+		if heartbeats.ReconnectAfter > 0 && heartbeats.Overdue >= heartbeats.ReconnectAfter {
+			logging.Warn("RDP server missed %d heartbeats, closing session", heartbeats.Overdue)
+			sendControlMessageWithMutex(wsConn, wsMu, errorMessage{Type: "error", Message: "RDP server unresponsive"})
+			writeCloseWithMutex(wsConn, wsMu, closeStatusHostUnreachable)
+			terminate()
+			return
+		}
+
+		// Warn once per streak; a heartbeat arriving re-arms the warning
+		if heartbeats.WarnAfter == 0 || heartbeats.Overdue < heartbeats.WarnAfter {
+			warned = false
+			continue
+		}
+		if !warned {
+			warned = true
+			logging.Warn("RDP server missed %d heartbeats", heartbeats.Overdue)
+			sendControlMessageWithMutex(wsConn, wsMu, warningMessage{
+				Type:    "warning",
+				Reason:  "heartbeat",
+				Message: fmt.Sprintf("Remote session may be unresponsive: %d server heartbeats missed", heartbeats.Overdue),
+			})
+		}
+	}
+}
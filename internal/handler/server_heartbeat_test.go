@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/rcarmo/go-rdp/internal/rdp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// heartbeatStatsStub reports heartbeat stats set by the test
+type heartbeatStatsStub struct {
+	mu    sync.Mutex
+	stats rdp.HeartbeatStats
+}
+
+func (s *heartbeatStatsStub) get() rdp.HeartbeatStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+func (s *heartbeatStatsStub) setOverdue(overdue int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Overdue = overdue
+}
+
+func TestEnforceServerHeartbeats_WarnsThenTerminates(t *testing.T) {
+	stub := &heartbeatStatsStub{stats: rdp.HeartbeatStats{Period: 10 * time.Second, WarnAfter: 3, ReconnectAfter: 5}}
+	terminated := make(chan struct{})
+
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var mu sync.Mutex
+		enforceServerHeartbeats(ctx, ws, &mu, stub.get, 10*time.Millisecond, func() { close(terminated) })
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	ws, err := websocket.Dial(wsURL, "", "http://localhost/")
+	require.NoError(t, err)
+	defer func() { _ = ws.Close() }()
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(2*time.Second)))
+
+	// Reaching count1 produces a single warning but keeps the session
+	stub.setOverdue(3)
+	var msg []byte
+	require.NoError(t, websocket.Message.Receive(ws, &msg))
+	require.Equal(t, byte(0xFF), msg[0])
+	var warning warningMessage
+	require.NoError(t, json.Unmarshal(msg[1:], &warning))
+	assert.Equal(t, "warning", warning.Type)
+	assert.Equal(t, "heartbeat", warning.Reason)
+
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-terminated:
+		t.Fatal("session terminated before count2")
+	default:
+	}
+
+	// Reaching count2 ends the session; no second warning comes first
+	stub.setOverdue(5)
+	require.NoError(t, websocket.Message.Receive(ws, &msg))
+	require.Equal(t, byte(0xFF), msg[0])
+	var final errorMessage
+	require.NoError(t, json.Unmarshal(msg[1:], &final))
+	assert.Equal(t, "error", final.Type)
+	assert.Equal(t, "RDP server unresponsive", final.Message)
+
+	select {
+	case <-terminated:
+	case <-time.After(2 * time.Second):
+		t.Fatal("session was not terminated at count2")
+	}
+}
+
+func TestEnforceServerHeartbeats_NoThresholds(t *testing.T) {
+	// Zero thresholds are never reached, however many heartbeats are overdue
+	stub := &heartbeatStatsStub{stats: rdp.HeartbeatStats{Period: 10 * time.Second, Overdue: 100}}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		var mu sync.Mutex
+		enforceServerHeartbeats(ctx, nil, &mu, stub.get, 10*time.Millisecond, func() { t.Error("terminate should not be called") })
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("enforceServerHeartbeats did not return on cancellation")
+	}
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/rcarmo/go-rdp/internal/logging"
+)
+
+// maxSessionWarningLead is how long before the limit the browser is warned.
+const maxSessionWarningLead = 5 * time.Minute
+
+// sessionTimer enforces a maximum session duration, warning the browser
+// shortly before the limit is reached.
+type sessionTimer struct {
+	limit    time.Duration
+	warnAt   time.Duration
+	interval time.Duration
+	now      func() time.Time
+	start    time.Time
+}
+
+// newSessionTimer creates a timer for the given limit starting now.
+// A nil clock defaults to time.Now.
+func newSessionTimer(limit time.Duration, now func() time.Time) *sessionTimer {
+	if now == nil {
+		now = time.Now
+	}
+
+	// Warn five minutes ahead, or at 90% for short limits
+	lead := maxSessionWarningLead
+	if lead > limit/10 {
+		lead = limit / 10
+	}
+
+	return &sessionTimer{
+		limit:    limit,
+		warnAt:   limit - lead,
+		interval: pollIntervalFor(lead),
+		now:      now,
+		start:    now(),
+	}
+}
+
+// elapsed returns how long the session has been running.
+func (t *sessionTimer) elapsed() time.Duration {
+	return t.now().Sub(t.start)
+}
+
+// enforceSessionDuration warns the browser as the session approaches its
+// limit and terminates it once the limit is reached. It returns when the
+// session is terminated or ctx is cancelled.
+func enforceSessionDuration(ctx context.Context, wsConn *websocket.Conn, wsMu *sync.Mutex, timer *sessionTimer, terminate func()) {
+	ticker := time.NewTicker(timer.interval)
+	defer ticker.Stop()
+
+	warned := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		elapsed := timer.elapsed()
+		if elapsed >= timer.limit {
+			logging.Info("Session reached maximum duration of %v, disconnecting", timer.limit)
+			sendControlMessageWithMutex(wsConn, wsMu, errorMessage{
+				Type:    "error",
+				Message: fmt.Sprintf("Session ended: maximum session duration of %v reached", timer.limit),
+			})
+			writeCloseWithMutex(wsConn, wsMu, closeStatusPolicyRejected)
+			terminate()
+			return
+		}
+
+		if !warned && elapsed >= timer.warnAt {
+			warned = true
+			remaining := (timer.limit - elapsed).Round(time.Second)
+			sendControlMessageWithMutex(wsConn, wsMu, warningMessage{
+				Type:    "warning",
+				Reason:  "session_limit",
+				Message: fmt.Sprintf("Session will end in %v (maximum session duration)", remaining),
+			})
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSessionTimer_WarningLead(t *testing.T) {
+	clock := newFakeClock()
+
+	long := newSessionTimer(8*time.Hour, clock.Now)
+	assert.Equal(t, 8*time.Hour-5*time.Minute, long.warnAt)
+
+	short := newSessionTimer(10*time.Minute, clock.Now)
+	assert.Equal(t, 9*time.Minute, short.warnAt, "short limits warn at 90%")
+}
+
+func TestEnforceSessionDuration_TerminatesAtLimit(t *testing.T) {
+	clock := newFakeClock()
+	timer := newSessionTimer(time.Hour, clock.Now)
+	timer.interval = 10 * time.Millisecond
+	terminated := make(chan struct{})
+
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var mu sync.Mutex
+		enforceSessionDuration(ctx, ws, &mu, timer, func() { close(terminated) })
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	ws, err := websocket.Dial(wsURL, "", "http://localhost/")
+	require.NoError(t, err)
+	defer func() { _ = ws.Close() }()
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(2*time.Second)))
+
+	// Approaching the limit produces a warning but keeps the session
+	clock.Advance(56 * time.Minute)
+	var msg []byte
+	require.NoError(t, websocket.Message.Receive(ws, &msg))
+	require.Equal(t, byte(0xFF), msg[0])
+	var warning warningMessage
+	require.NoError(t, json.Unmarshal(msg[1:], &warning))
+	assert.Equal(t, "warning", warning.Type)
+	assert.Equal(t, "session_limit", warning.Reason)
+
+	select {
+	case <-terminated:
+		t.Fatal("session terminated before the limit")
+	default:
+	}
+
+	// Reaching the limit ends the session with a clear reason
+	clock.Advance(4 * time.Minute)
+	require.NoError(t, websocket.Message.Receive(ws, &msg))
+	require.Equal(t, byte(0xFF), msg[0])
+	var final errorMessage
+	require.NoError(t, json.Unmarshal(msg[1:], &final))
+	assert.Equal(t, "error", final.Type)
+	assert.Contains(t, final.Message, "maximum session duration")
+
+	select {
+	case <-terminated:
+	case <-time.After(2 * time.Second):
+		t.Fatal("session was not terminated at the limit")
+	}
+}
+
+func TestEnforceSessionDuration_ContextCancelled(t *testing.T) {
+	clock := newFakeClock()
+	timer := newSessionTimer(time.Hour, clock.Now)
+	timer.interval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		var mu sync.Mutex
+		enforceSessionDuration(ctx, nil, &mu, timer, func() { t.Error("terminate should not be called") })
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("enforceSessionDuration did not return on cancellation")
+	}
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rcarmo/go-rdp/internal/logging"
+	"github.com/rcarmo/go-rdp/internal/rdp"
+)
+
+// Disconnect reasons reported in the session summary
+const (
+	reasonBrowserClosed  = "browser_closed"
+	reasonBrowserError   = "browser_error"
+	reasonIdleTimeout    = "idle_timeout"
+	reasonProtocolError  = "protocol_error"
+	reasonServerLogoff   = "server_logoff"
+	reasonRDPError       = "rdp_error"
+	reasonUnresponsive   = "server_unresponsive"
+	reasonMaxDuration    = "max_duration"
+	reasonServerShutdown = "server_shutdown"
+	reasonUnknown        = "unknown"
+)
+
+// sessionStats accumulates the counters reported when a session ends.
+// Methods on a nil *sessionStats do nothing.
+type sessionStats struct {
+	start    time.Time
+	bytesIn  atomic.Int64 // browser to RDP server
+	bytesOut atomic.Int64 // RDP server to browser
+	frames   atomic.Int64 // updates relayed to the browser
+
+	mu     sync.Mutex
+	reason string
+	logon  *rdp.LogonSession // as reported by the server, for auditing
+}
+
+// newSessionStats starts counting a session that began at start.
+func newSessionStats(start time.Time) *sessionStats {
+	return &sessionStats{start: start}
+}
+
+// received records a message of n bytes from the browser.
+func (s *sessionStats) received(n int) {
+	if s == nil {
+		return
+	}
+	s.bytesIn.Add(int64(n))
+}
+
+// sent records an update of n bytes relayed to the browser.
+func (s *sessionStats) sent(n int) {
+	if s == nil {
+		return
+	}
+	s.bytesOut.Add(int64(n))
+	s.frames.Add(1)
+}
+
+// ended records why the session ended. Only the first reason is kept, since
+// the other relay direction stops as a consequence of it.
+func (s *sessionStats) ended(reason string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reason == "" {
+		s.reason = reason
+	}
+}
+
+// loggedOn records the logon session the server reported, if any.
+func (s *sessionStats) loggedOn(session *rdp.LogonSession) {
+	if s == nil || session == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logon = session
+}
+
+// disconnectReason returns the recorded reason, or reasonUnknown.
+func (s *sessionStats) disconnectReason() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reason == "" {
+		return reasonUnknown
+	}
+	return s.reason
+}
+
+// logSessionSummary writes one structured line summarizing a finished
+// session, with the server's logon session ID once it has reported one and
+// the MemBlt orders left undrawn, if any. Sessions only use the TCP
+// transport, so there is no UDP retransmit count to report.
+func logSessionSummary(logger *logging.Logger, stats *sessionStats, caps *rdp.ServerCapabilityInfo, end time.Time) {
+	var codecs []string
+	if caps != nil {
+		codecs = caps.BitmapCodecs
+	}
+	fields := []interface{}{
+		"duration_ms", end.Sub(stats.start).Milliseconds(),
+		"bytes_in", stats.bytesIn.Load(),
+		"bytes_out", stats.bytesOut.Load(),
+		"frames", stats.frames.Load(),
+		"reason", stats.disconnectReason(),
+		"codecs", strings.Join(codecs, ","),
+	}
+	if caps != nil && caps.BitmapCacheSkipped > 0 {
+		fields = append(fields, "memblt_skipped", caps.BitmapCacheSkipped)
+	}
+	stats.mu.Lock()
+	if logon := stats.logon; logon != nil {
+		fields = append(fields, "logon_id", logon.ID, "auto_reconnect", logon.AutoReconnect)
+	}
+	stats.mu.Unlock()
+	logger.With(fields...).Info("Session summary")
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/rcarmo/go-rdp/internal/logging"
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+	"github.com/rcarmo/go-rdp/internal/rdp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// summaryRDPConn serves a fixed number of updates before the server logs off
+type summaryRDPConn struct {
+	updates int
+	inputs  chan []byte
+}
+
+func (c *summaryRDPConn) GetUpdate() (*rdp.Update, error) {
+	if c.updates == 0 {
+		return nil, pdu.ErrDeactivateAll
+	}
+	c.updates--
+	return &rdp.Update{Data: make([]byte, 100)}, nil
+}
+
+func (c *summaryRDPConn) SendInputEvent(data []byte) error {
+	c.inputs <- data
+	return nil
+}
+
+func TestLogSessionSummary_MockSession(t *testing.T) {
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	stats := newSessionStats(start)
+	conn := &summaryRDPConn{updates: 3, inputs: make(chan []byte, 2)}
+
+	done := make(chan struct{})
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		opts := relayOptions{stats: stats}
+		go wsToRdpWithOptions(ctx, ws, conn, cancel, opts)
+
+		// Relay the browser's input before the server's updates and logoff
+		<-conn.inputs
+		<-conn.inputs
+		var mu sync.Mutex
+		rdpToWsWithOptions(ctx, conn, ws, &mu, opts)
+		close(done)
+	}))
+	defer server.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http"), "", "http://localhost/")
+	require.NoError(t, err)
+	require.NoError(t, websocket.Message.Send(ws, make([]byte, 10)))
+	require.NoError(t, websocket.Message.Send(ws, make([]byte, 10)))
+	<-done
+	_ = ws.Close()
+
+	var buf bytes.Buffer
+	logger := logging.New(&buf)
+	logger.SetFormat(logging.FormatJSON)
+	caps := &rdp.ServerCapabilityInfo{BitmapCodecs: []string{"RemoteFX", "NSCodec"}}
+	logSessionSummary(logger, stats, caps, start.Add(90*time.Second))
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry), "summary should be one JSON line: %q", buf.String())
+	assert.Equal(t, "INFO", entry["level"])
+	assert.Equal(t, "Session summary", entry["msg"])
+	assert.Equal(t, float64(90000), entry["duration_ms"])
+	assert.Equal(t, float64(20), entry["bytes_in"])
+	assert.Equal(t, float64(300), entry["bytes_out"])
+	assert.Equal(t, float64(3), entry["frames"])
+	assert.Equal(t, reasonServerLogoff, entry["reason"])
+	assert.Equal(t, "RemoteFX,NSCodec", entry["codecs"])
+	assert.NotContains(t, entry, "memblt_skipped")
+}
+
+func TestLogSessionSummary_SkippedMemBlt(t *testing.T) {
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	logger := logging.New(&buf)
+	logger.SetFormat(logging.FormatJSON)
+	logSessionSummary(logger, newSessionStats(start), &rdp.ServerCapabilityInfo{BitmapCacheSkipped: 4}, start.Add(time.Minute))
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, float64(4), entry["memblt_skipped"])
+}
+
+func TestLogSessionSummary_LogonSession(t *testing.T) {
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	stats := newSessionStats(start)
+	stats.loggedOn(nil)
+	stats.loggedOn(&rdp.LogonSession{ID: 7, AutoReconnect: true})
+
+	var buf bytes.Buffer
+	logger := logging.New(&buf)
+	logger.SetFormat(logging.FormatJSON)
+	logSessionSummary(logger, stats, nil, start.Add(time.Minute))
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, float64(7), entry["logon_id"])
+	assert.Equal(t, true, entry["auto_reconnect"])
+
+	// Sessions the server never reported a logon for leave the fields out
+	buf.Reset()
+	logSessionSummary(logger, newSessionStats(start), nil, start.Add(time.Minute))
+	entry = nil
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.NotContains(t, entry, "logon_id")
+}
+
+func TestSessionStats_FirstReasonWins(t *testing.T) {
+	stats := newSessionStats(time.Now())
+	assert.Equal(t, reasonUnknown, stats.disconnectReason())
+
+	stats.ended(reasonIdleTimeout)
+	stats.ended(reasonBrowserClosed)
+	assert.Equal(t, reasonIdleTimeout, stats.disconnectReason())
+
+	// A nil collector ignores updates
+	var none *sessionStats
+	none.received(1)
+	none.sent(1)
+	none.ended(reasonRDPError)
+}
@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"sync"
+
+	"github.com/rcarmo/go-rdp/internal/codec"
+	"github.com/rcarmo/go-rdp/internal/codec/rfx"
+	"github.com/rcarmo/go-rdp/internal/config"
+	"github.com/rcarmo/go-rdp/internal/logging"
+	"github.com/rcarmo/go-rdp/internal/protocol/fastpath"
+)
+
+// snapshotJPEGQuality is the quality of snapshots requested as JPEG
+const snapshotJPEGQuality = 80
+
+// framebuffer is a server-side copy of a session's desktop, drawn from the
+// same updates relayed to the browser so it can be exported as an image.
+// Bitmap updates and surface bits (RemoteFX and NSCodec) are drawn; graphics
+// pipeline surfaces and the fills and copies of drawing orders are not.
+// Methods on a nil *framebuffer do nothing.
+type framebuffer struct {
+	mu  sync.Mutex
+	img *image.RGBA
+	rfx *rfx.Context
+
+	// fragments collects the payload of a fragmented update
+	fragments []byte
+}
+
+// newFramebuffer creates a black framebuffer of the given desktop size.
+func newFramebuffer(width, height int) *framebuffer {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xff
+	}
+	return &framebuffer{img: img, rfx: rfx.NewContext()}
+}
+
+// observe draws the fast-path updates in data, as returned by GetUpdate.
+// Updates that cannot be decoded are skipped; the browser still gets them.
+func (f *framebuffer) observe(data []byte) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for len(data) >= 3 {
+		header := data[0]
+		size := int(binary.LittleEndian.Uint16(data[1:3]))
+		if 3+size > len(data) {
+			return
+		}
+		payload := data[3 : 3+size]
+		data = data[3+size:]
+
+		code := fastpath.UpdateCode(header & 0xf)
+		if code != fastpath.UpdateCodeBitmap && code != fastpath.UpdateCodeSurfCMDs {
+			continue
+		}
+
+		switch fastpath.Fragment((header >> 4) & 0x3) {
+		case fastpath.FragmentSingle:
+			f.draw(code, payload)
+		case fastpath.FragmentFirst:
+			f.fragments = append(f.fragments[:0], payload...)
+		case fastpath.FragmentNext:
+			f.fragments = append(f.fragments, payload...)
+		case fastpath.FragmentLast:
+			f.draw(code, append(f.fragments, payload...))
+			f.fragments = f.fragments[:0]
+		}
+	}
+}
+
+// draw applies one reassembled update. Callers must hold f.mu.
+func (f *framebuffer) draw(code fastpath.UpdateCode, payload []byte) {
+	if code == fastpath.UpdateCodeBitmap {
+		f.drawBitmapUpdate(payload)
+		return
+	}
+
+	commands, _ := fastpath.ParseSurfaceCommands(payload)
+	for _, cmd := range commands {
+		if cmd.CmdType != fastpath.CmdTypeSurfaceBits && cmd.CmdType != fastpath.CmdTypeStreamSurfaceBits {
+			continue
+		}
+		bits, err := fastpath.ParseSetSurfaceBits(cmd.Data)
+		if err != nil {
+			continue
+		}
+		f.drawSurfaceBits(bits)
+	}
+}
+
+// drawBitmapUpdate draws the rectangles of a TS_UPDATE_BITMAP_DATA.
+// Callers must hold f.mu.
+func (f *framebuffer) drawBitmapUpdate(payload []byte) {
+	// [updateType:2] [numberRectangles:2] [rectangles...]
+	if len(payload) < 4 {
+		return
+	}
+	count := int(binary.LittleEndian.Uint16(payload[2:4]))
+	r := bytes.NewReader(payload[4:])
+
+	for i := 0; i < count; i++ {
+		var bitmap fastpath.BitmapData
+		if err := bitmap.Deserialize(r); err != nil {
+			logging.Debug("Snapshot: bitmap rectangle: %v", err)
+			return
+		}
+		width, height, bpp := int(bitmap.Width), int(bitmap.Height), int(bitmap.BitsPerPixel)
+		rgba := codec.ProcessBitmap(bitmap.BitmapDataStream, width, height, bpp,
+			bitmap.Flags&fastpath.BitmapDataFlagCompression != 0, width*((bpp+7)/8),
+			bitmap.Flags&fastpath.BitmapDataFlagNoHDR != 0)
+		if rgba == nil {
+			continue
+		}
+		// The bitmap may be wider than its destination, which is inclusive
+		dest := image.Rect(int(bitmap.DestLeft), int(bitmap.DestTop), int(bitmap.DestRight)+1, int(bitmap.DestBottom)+1)
+		f.blit(dest, rgba, width)
+	}
+}
+
+// drawSurfaceBits draws a Set Surface Bits command, telling RemoteFX from
+// NSCodec by the leading block type as the browser does. Callers must hold
+// f.mu.
+func (f *framebuffer) drawSurfaceBits(bits *fastpath.SetSurfaceBitsCommand) {
+	data := bits.BitmapData
+	if len(data) < 2 {
+		return
+	}
+	left, top := int(bits.DestLeft), int(bits.DestTop)
+
+	if magic := binary.LittleEndian.Uint16(data); (magic >= rfx.WBT_SYNC && magic <= rfx.WBT_EXTENSION) || magic == rfx.WBT_TILESET || magic == rfx.CBT_TILE {
+		frame, err := rfx.ParseRFXMessage(data, f.rfx)
+		if err != nil {
+			logging.Debug("Snapshot: RemoteFX message: %v", err)
+			return
+		}
+		if frame.SkippedTiles > 0 {
+			logging.Debug("Snapshot: RemoteFX frame %d: skipped %d tiles outside the surface", frame.FrameIdx, frame.SkippedTiles)
+		}
+		for _, update := range frame.Updates(left, top) {
+			f.blit(image.Rect(update.X, update.Y, update.X+update.Width, update.Y+update.Height), update.RGBA(), update.Width)
+		}
+		return
+	}
+
+	width, height := int(bits.Width), int(bits.Height)
+	if rgba := codec.DecodeNSCodecToRGBA(data, width, height); rgba != nil {
+		f.blit(image.Rect(left, top, left+width, top+height), rgba, width)
+	}
+}
+
+// blit copies RGBA pixels with the given row width into dest, clipped to the
+// desktop. Callers must hold f.mu.
+func (f *framebuffer) blit(dest image.Rectangle, rgba []byte, width int) {
+	clipped := dest.Intersect(f.img.Rect)
+	if clipped.Empty() {
+		return
+	}
+	stride := width * 4
+	for y := clipped.Min.Y; y < clipped.Max.Y; y++ {
+		start := (y-dest.Min.Y)*stride + (clipped.Min.X-dest.Min.X)*4
+		end := start + clipped.Dx()*4
+		if end > len(rgba) {
+			return
+		}
+		copy(f.img.Pix[f.img.PixOffset(clipped.Min.X, y):], rgba[start:end])
+	}
+}
+
+// snapshot returns a copy of the current desktop.
+func (f *framebuffer) snapshot() *image.RGBA {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	img := *f.img
+	img.Pix = bytes.Clone(f.img.Pix)
+	return &img
+}
+
+// framebufferRegistry maps session IDs to the framebuffers of sessions with
+// snapshots enabled.
+type framebufferRegistry struct {
+	mu       sync.Mutex
+	sessions map[string]*framebuffer
+}
+
+// newFramebufferRegistry creates an empty registry.
+func newFramebufferRegistry() *framebufferRegistry {
+	return &framebufferRegistry{sessions: make(map[string]*framebuffer)}
+}
+
+// sessionFramebuffers is the registry shared by all /connect and /snapshot
+// requests.
+var sessionFramebuffers = newFramebufferRegistry()
+
+// add registers a framebuffer under a new random session ID. The ID is the
+// only thing guarding the snapshot, so it is unguessable.
+func (r *framebufferRegistry) add(fb *framebuffer) (string, error) {
+	var raw [16]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(raw[:])
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions[id] = fb
+	return id, nil
+}
+
+// get returns the framebuffer of a session, or nil if it is not registered.
+func (r *framebufferRegistry) get(id string) *framebuffer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sessions[id]
+}
+
+// remove drops a session once it has ended.
+func (r *framebufferRegistry) remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, id)
+}
+
+// startSnapshots registers a framebuffer for a new session when the
+// snapshot feature is enabled. It returns nil when it is off or the session
+// could not be registered; release must be called when the session ends.
+func startSnapshots(cfg *config.Config, width, height int) (fb *framebuffer, release func()) {
+	if !cfg.Features.Enabled(config.FeatureSnapshot) {
+		return nil, func() {}
+	}
+	fb = newFramebuffer(width, height)
+	id, err := sessionFramebuffers.add(fb)
+	if err != nil {
+		logging.Warn("Snapshots unavailable for session: %v", err)
+		return nil, func() {}
+	}
+	logging.Info("Session snapshot available at /snapshot?session=%s", id)
+	return fb, func() { sessionFramebuffers.remove(id) }
+}
+
+// Snapshot serves an image of a session's current desktop, named by the
+// session query parameter. The image is a PNG unless format=jpeg is given.
+// Sessions are only known while the snapshot feature is enabled.
+func Snapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	fb := sessionFramebuffers.get(query.Get("session"))
+	if fb == nil {
+		http.NotFound(w, r)
+		return
+	}
+	img := fb.snapshot()
+
+	var buf bytes.Buffer
+	contentType := "image/png"
+	var err error
+	switch query.Get("format") {
+	case "", "png":
+		err = png.Encode(&buf, img)
+	case "jpeg", "jpg":
+		contentType = "image/jpeg"
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: snapshotJPEGQuality})
+	default:
+		http.Error(w, "unsupported format", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logging.Error("Snapshot encode: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(buf.Bytes())
+}
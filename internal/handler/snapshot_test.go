@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcarmo/go-rdp/internal/config"
+	"github.com/rcarmo/go-rdp/internal/protocol/fastpath"
+)
+
+var (
+	snapshotRed  = color.RGBA{R: 0xff, A: 0xff}
+	snapshotBlue = color.RGBA{B: 0xff, A: 0xff}
+)
+
+// bitmapUpdate builds a fast-path bitmap update drawing a 2x2 uncompressed
+// 32-bit bitmap at (left, top): red on the top row, blue on the bottom one.
+func bitmapUpdate(left, top uint16) []byte {
+	red := []byte{0x00, 0x00, 0xff, 0x00} // BGRA
+	blue := []byte{0xff, 0x00, 0x00, 0x00}
+
+	var payload bytes.Buffer
+	for _, v := range []uint16{
+		0x0001, 1, // updateType, numberRectangles
+		left, top, left + 1, top + 1, // inclusive destination
+		2, 2, 32, 0, 16, // width, height, bpp, flags, bitmapLength
+	} {
+		_ = binary.Write(&payload, binary.LittleEndian, v)
+	}
+	// Rows are bottom-up
+	payload.Write(bytes.Repeat(blue, 2))
+	payload.Write(bytes.Repeat(red, 2))
+
+	update := []byte{byte(fastpath.UpdateCodeBitmap), 0, 0}
+	binary.LittleEndian.PutUint16(update[1:], uint16(payload.Len()))
+	return append(update, payload.Bytes()...)
+}
+
+func TestFramebuffer_DrawsBitmapUpdate(t *testing.T) {
+	fb := newFramebuffer(4, 4)
+	fb.observe(bitmapUpdate(1, 1))
+
+	img := fb.snapshot()
+	assert.Equal(t, snapshotRed, img.RGBAAt(1, 1))
+	assert.Equal(t, snapshotRed, img.RGBAAt(2, 1))
+	assert.Equal(t, snapshotBlue, img.RGBAAt(1, 2))
+	assert.Equal(t, snapshotBlue, img.RGBAAt(2, 2))
+	assert.Equal(t, color.RGBA{A: 0xff}, img.RGBAAt(0, 0), "undrawn pixels stay black")
+}
+
+func TestFramebuffer_ClipsToDesktop(t *testing.T) {
+	fb := newFramebuffer(2, 2)
+	fb.observe(bitmapUpdate(1, 1))
+
+	img := fb.snapshot()
+	assert.Equal(t, snapshotRed, img.RGBAAt(1, 1))
+	assert.Equal(t, color.RGBA{A: 0xff}, img.RGBAAt(0, 1))
+}
+
+func TestFramebuffer_ReassemblesFragments(t *testing.T) {
+	update := bitmapUpdate(0, 0)
+	payload := update[3:]
+	half := len(payload) / 2
+
+	first := append([]byte{byte(fastpath.UpdateCodeBitmap) | byte(fastpath.FragmentFirst)<<4, 0, 0}, payload[:half]...)
+	binary.LittleEndian.PutUint16(first[1:], uint16(half))
+	last := append([]byte{byte(fastpath.UpdateCodeBitmap) | byte(fastpath.FragmentLast)<<4, 0, 0}, payload[half:]...)
+	binary.LittleEndian.PutUint16(last[1:], uint16(len(payload)-half))
+
+	fb := newFramebuffer(2, 2)
+	fb.observe(first)
+	assert.Equal(t, color.RGBA{A: 0xff}, fb.snapshot().RGBAAt(0, 0), "nothing is drawn before the last fragment")
+	fb.observe(last)
+	assert.Equal(t, snapshotRed, fb.snapshot().RGBAAt(0, 0))
+}
+
+func TestFramebuffer_NilIgnoresUpdates(t *testing.T) {
+	var fb *framebuffer
+	assert.NotPanics(t, func() { fb.observe(bitmapUpdate(0, 0)) })
+}
+
+func TestStartSnapshots_FollowsFeature(t *testing.T) {
+	fb, release := startSnapshots(&config.Config{}, 4, 4)
+	release()
+	assert.Nil(t, fb, "snapshots are off by default")
+
+	cfg, err := config.LoadWithOverrides(config.LoadOptions{Features: map[string]bool{config.FeatureSnapshot: true}})
+	require.NoError(t, err)
+	t.Cleanup(func() { _, _ = config.Load() })
+
+	fb, release = startSnapshots(cfg, 4, 4)
+	require.NotNil(t, fb)
+	sessionFramebuffers.mu.Lock()
+	assert.Len(t, sessionFramebuffers.sessions, 1)
+	sessionFramebuffers.mu.Unlock()
+
+	release()
+	sessionFramebuffers.mu.Lock()
+	assert.Empty(t, sessionFramebuffers.sessions)
+	sessionFramebuffers.mu.Unlock()
+}
+
+func TestSnapshot(t *testing.T) {
+	fb := newFramebuffer(4, 4)
+	fb.observe(bitmapUpdate(0, 0))
+	id, err := sessionFramebuffers.add(fb)
+	require.NoError(t, err)
+	t.Cleanup(func() { sessionFramebuffers.remove(id) })
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		Snapshot(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	rec := get("/snapshot?session=" + id)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	img, err := png.Decode(rec.Body)
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 4, 4), img.Bounds())
+	assert.Equal(t, color.RGBAModel.Convert(snapshotRed), color.RGBAModel.Convert(img.At(0, 0)))
+
+	rec = get("/snapshot?format=jpeg&session=" + id)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/jpeg", rec.Header().Get("Content-Type"))
+	_, err = jpeg.Decode(rec.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusBadRequest, get("/snapshot?format=gif&session="+id).Code)
+	assert.Equal(t, http.StatusNotFound, get("/snapshot?session=unknown").Code)
+	assert.Equal(t, http.StatusNotFound, get("/snapshot").Code)
+
+	rec = httptest.NewRecorder()
+	Snapshot(rec, httptest.NewRequest(http.MethodPost, "/snapshot?session="+id, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
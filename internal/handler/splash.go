@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rcarmo/go-rdp/internal/rdp"
+)
+
+// connectingMessage tells the browser the session is still being set up.
+// It is repeated while the screen stays blank so the user sees progress.
+type connectingMessage struct {
+	Type    string `json:"type"`
+	Stage   string `json:"stage"`
+	Message string `json:"message"`
+	Elapsed int    `json:"elapsed"` // seconds since the connection started
+}
+
+// connectSplash reports connection progress to the browser from the start of
+// the handshake until the first graphics arrive. Once per interval without
+// graphics it produces a connectingMessage with the current stage and the
+// last status reported by the server. It never fails the connection; the
+// handshake timeout does that.
+type connectSplash struct {
+	mu       sync.Mutex
+	interval time.Duration
+	poll     time.Duration
+	now      func() time.Time
+	start    time.Time
+	lastSent time.Time
+	stage    rdp.ConnectStage
+	status   string
+	finished bool
+}
+
+// newConnectSplash creates a splash that reports every interval.
+// A nil clock defaults to time.Now.
+func newConnectSplash(interval time.Duration, now func() time.Time) *connectSplash {
+	if now == nil {
+		now = time.Now
+	}
+	start := now()
+	return &connectSplash{
+		interval: interval,
+		poll:     pollIntervalFor(interval),
+		now:      now,
+		start:    start,
+		lastSent: start,
+	}
+}
+
+// setStage records the connection stage the client has entered.
+func (s *connectSplash) setStage(stage rdp.ConnectStage) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stage = stage
+}
+
+// setStatus records the last progress message reported by the server.
+func (s *connectSplash) setStatus(message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = message
+}
+
+// finish stops progress reports once graphics have arrived.
+func (s *connectSplash) finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finished = true
+}
+
+// due returns the progress message to send when the interval has elapsed
+// since the start or the last report, counting the report as sent.
+func (s *connectSplash) due() (connectingMessage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if s.finished || now.Sub(s.lastSent) < s.interval {
+		return connectingMessage{}, false
+	}
+	s.lastSent = now
+
+	msg := connectingMessage{
+		Type:    "connecting",
+		Stage:   s.stage.String(),
+		Message: s.status,
+		Elapsed: int(now.Sub(s.start) / time.Second),
+	}
+	if msg.Message == "" {
+		msg.Message = "Still connecting (" + msg.Stage + ")"
+		if s.stage == rdp.StageActive {
+			msg.Message = "Waiting for the desktop"
+		}
+	}
+	return msg, true
+}
+
+// run calls send with each progress report until graphics arrive or ctx is
+// cancelled.
+func (s *connectSplash) run(ctx context.Context, send func(connectingMessage)) {
+	ticker := time.NewTicker(s.poll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			finished := s.finished
+			s.mu.Unlock()
+			if finished {
+				return
+			}
+			if msg, ok := s.due(); ok {
+				send(msg)
+			}
+		}
+	}
+}
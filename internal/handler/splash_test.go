@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+	"github.com/rcarmo/go-rdp/internal/rdp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectSplash_Due(t *testing.T) {
+	clock := newFakeClock()
+	s := newConnectSplash(3*time.Second, clock.Now)
+
+	clock.Advance(2 * time.Second)
+	_, ok := s.due()
+	assert.False(t, ok, "should not report before the interval")
+
+	s.setStage(rdp.StageLicensing)
+	clock.Advance(time.Second)
+	msg, ok := s.due()
+	require.True(t, ok)
+	assert.Equal(t, connectingMessage{
+		Type:    "connecting",
+		Stage:   "licensing",
+		Message: "Still connecting (licensing)",
+		Elapsed: 3,
+	}, msg)
+	_, ok = s.due()
+	assert.False(t, ok, "the report restarts the interval")
+
+	s.setStatus("Waking the virtual machine")
+	clock.Advance(3 * time.Second)
+	msg, ok = s.due()
+	require.True(t, ok)
+	assert.Equal(t, "Waking the virtual machine", msg.Message)
+	assert.Equal(t, 6, msg.Elapsed)
+
+	s.setStatus("")
+	s.setStage(rdp.StageActive)
+	clock.Advance(3 * time.Second)
+	msg, ok = s.due()
+	require.True(t, ok)
+	assert.Equal(t, "Waiting for the desktop", msg.Message)
+
+	s.finish()
+	clock.Advance(time.Minute)
+	_, ok = s.due()
+	assert.False(t, ok, "no reports once graphics arrived")
+}
+
+func TestConnectSplash_NilSafe(t *testing.T) {
+	var s *connectSplash
+	assert.NotPanics(t, func() {
+		s.setStage(rdp.StageChannels)
+		s.setStatus("status")
+		s.finish()
+	})
+}
+
+func TestConnectSplash_ReportsDuringSlowHandshake(t *testing.T) {
+	s := newConnectSplash(20*time.Millisecond, nil)
+	s.poll = 5 * time.Millisecond
+
+	var (
+		mu      sync.Mutex
+		reports []connectingMessage
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		s.run(ctx, func(msg connectingMessage) {
+			mu.Lock()
+			reports = append(reports, msg)
+			mu.Unlock()
+		})
+		close(done)
+	}()
+
+	// A handshake that lingers in each stage for several intervals
+	for _, stage := range []rdp.ConnectStage{rdp.StageNegotiation, rdp.StageLicensing, rdp.StageActive} {
+		s.setStage(stage)
+		time.Sleep(70 * time.Millisecond)
+	}
+	s.finish()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("splash kept running after graphics arrived")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.GreaterOrEqual(t, len(reports), 3, "expected periodic reports, got %v", reports)
+	stages := make(map[string]bool)
+	for _, msg := range reports {
+		assert.Equal(t, "connecting", msg.Type)
+		stages[msg.Stage] = true
+	}
+	assert.True(t, stages["licensing"], "reports should follow the stage, got %v", reports)
+	assert.True(t, stages["active"], "reports should continue after the handshake until graphics arrive, got %v", reports)
+}
+
+func TestRdpToWs_FirstUpdateFinishesSplash(t *testing.T) {
+	splash := newConnectSplash(time.Hour, nil)
+	mockRDP := &mockRDPConnection{
+		updateData: &rdp.Update{Data: []byte{0x00, 0x04, 0x00, 0x00}},
+		maxUpdates: 1,
+	}
+
+	done := make(chan struct{})
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		var mu sync.Mutex
+		rdpToWsWithOptions(context.Background(), mockRDP, ws, &mu, relayOptions{splash: splash})
+		close(done)
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	ws, err := websocket.Dial(wsURL, "", "http://localhost/")
+	require.NoError(t, err)
+	defer func() { _ = ws.Close() }()
+
+	var data []byte
+	require.NoError(t, websocket.Message.Receive(ws, &data))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("relay did not stop after %v", pdu.ErrDeactivateAll)
+	}
+
+	splash.mu.Lock()
+	defer splash.mu.Unlock()
+	assert.True(t, splash.finished)
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"sync"
+
+	"github.com/rcarmo/go-rdp/internal/protocol/rdpegfx"
+)
+
+// errUnknownSurface is returned for commands naming a surface that was
+// never created or has been deleted.
+var errUnknownSurface = errors.New("unknown surface")
+
+// gfxSurface is an offscreen surface created over the graphics pipeline.
+type gfxSurface struct {
+	width, height int
+	pixelFormat   uint8
+
+	// mapped is set once the surface is placed on the desktop at origin
+	mapped bool
+	origin image.Point
+}
+
+// surfaceRegistry tracks the graphics pipeline surfaces of one session,
+// mapping surface IDs to the desktop region each one covers.
+type surfaceRegistry struct {
+	mu       sync.Mutex
+	surfaces map[uint16]*gfxSurface
+}
+
+// newSurfaceRegistry creates an empty registry.
+func newSurfaceRegistry() *surfaceRegistry {
+	return &surfaceRegistry{surfaces: make(map[uint16]*gfxSurface)}
+}
+
+// handle applies a surface management command. Other commands are ignored.
+func (r *surfaceRegistry) handle(data []byte) error {
+	var header rdpegfx.Header
+	if err := header.Deserialize(bytes.NewReader(data)); err != nil {
+		return err
+	}
+
+	switch header.CmdID {
+	case rdpegfx.CmdIDCreateSurface:
+		var pdu rdpegfx.CreateSurfacePDU
+		if err := pdu.Deserialize(bytes.NewReader(data)); err != nil {
+			return err
+		}
+		r.create(pdu)
+	case rdpegfx.CmdIDMapSurfaceToOutput:
+		var pdu rdpegfx.MapSurfaceToOutputPDU
+		if err := pdu.Deserialize(bytes.NewReader(data)); err != nil {
+			return err
+		}
+		return r.mapToOutput(pdu)
+	case rdpegfx.CmdIDDeleteSurface:
+		var pdu rdpegfx.DeleteSurfacePDU
+		if err := pdu.Deserialize(bytes.NewReader(data)); err != nil {
+			return err
+		}
+		return r.delete(pdu.SurfaceID)
+	case rdpegfx.CmdIDResetGraphics:
+		r.reset()
+	}
+	return nil
+}
+
+// create adds an unmapped surface, replacing any surface with the same ID.
+func (r *surfaceRegistry) create(pdu rdpegfx.CreateSurfacePDU) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.surfaces[pdu.SurfaceID] = &gfxSurface{
+		width:       int(pdu.Width),
+		height:      int(pdu.Height),
+		pixelFormat: pdu.PixelFormat,
+	}
+}
+
+// mapToOutput places a surface on the desktop.
+func (r *surfaceRegistry) mapToOutput(pdu rdpegfx.MapSurfaceToOutputPDU) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.surfaces[pdu.SurfaceID]
+	if !ok {
+		return fmt.Errorf("map surface %d: %w", pdu.SurfaceID, errUnknownSurface)
+	}
+	s.mapped = true
+	s.origin = image.Pt(int(pdu.OutputOriginX), int(pdu.OutputOriginY))
+	return nil
+}
+
+// delete removes a surface.
+func (r *surfaceRegistry) delete(id uint16) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.surfaces[id]; !ok {
+		return fmt.Errorf("delete surface %d: %w", id, errUnknownSurface)
+	}
+	delete(r.surfaces, id)
+	return nil
+}
+
+// reset drops every surface, as the server does on a graphics reset.
+func (r *surfaceRegistry) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clear(r.surfaces)
+}
+
+// region returns the desktop region covered by a surface. It reports false
+// when the surface does not exist or is not mapped to the desktop.
+func (r *surfaceRegistry) region(id uint16) (image.Rectangle, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.surfaces[id]
+	if !ok || !s.mapped {
+		return image.Rectangle{}, false
+	}
+	return image.Rectangle{Min: s.origin, Max: s.origin.Add(image.Pt(s.width, s.height))}, true
+}
+
+// len returns the number of surfaces.
+func (r *surfaceRegistry) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.surfaces)
+}
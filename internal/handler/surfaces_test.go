@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcarmo/go-rdp/internal/protocol/rdpegfx"
+)
+
+func TestSurfaceRegistry_CreateMapDelete(t *testing.T) {
+	r := newSurfaceRegistry()
+
+	create := rdpegfx.CreateSurfacePDU{SurfaceID: 1, Width: 1280, Height: 1024, PixelFormat: rdpegfx.PixelFormatXRGB8888}
+	require.NoError(t, r.handle(create.Serialize()))
+	assert.Equal(t, 1, r.len())
+
+	// Created surfaces cover no region until mapped
+	_, ok := r.region(1)
+	assert.False(t, ok)
+
+	mapping := rdpegfx.MapSurfaceToOutputPDU{SurfaceID: 1, OutputOriginX: 1920, OutputOriginY: 56}
+	require.NoError(t, r.handle(mapping.Serialize()))
+	region, ok := r.region(1)
+	require.True(t, ok)
+	assert.Equal(t, image.Rect(1920, 56, 3200, 1080), region)
+
+	require.NoError(t, r.handle((&rdpegfx.DeleteSurfacePDU{SurfaceID: 1}).Serialize()))
+	assert.Zero(t, r.len())
+	_, ok = r.region(1)
+	assert.False(t, ok)
+}
+
+func TestSurfaceRegistry_RecreateUnmaps(t *testing.T) {
+	r := newSurfaceRegistry()
+	require.NoError(t, r.handle((&rdpegfx.CreateSurfacePDU{SurfaceID: 4, Width: 64, Height: 64, PixelFormat: rdpegfx.PixelFormatARGB8888}).Serialize()))
+	require.NoError(t, r.handle((&rdpegfx.MapSurfaceToOutputPDU{SurfaceID: 4}).Serialize()))
+
+	require.NoError(t, r.handle((&rdpegfx.CreateSurfacePDU{SurfaceID: 4, Width: 128, Height: 32, PixelFormat: rdpegfx.PixelFormatARGB8888}).Serialize()))
+	_, ok := r.region(4)
+	assert.False(t, ok)
+	assert.Equal(t, 1, r.len())
+}
+
+func TestSurfaceRegistry_UnknownSurface(t *testing.T) {
+	r := newSurfaceRegistry()
+
+	err := r.handle((&rdpegfx.MapSurfaceToOutputPDU{SurfaceID: 9}).Serialize())
+	assert.ErrorIs(t, err, errUnknownSurface)
+
+	err = r.handle((&rdpegfx.DeleteSurfacePDU{SurfaceID: 9}).Serialize())
+	assert.ErrorIs(t, err, errUnknownSurface)
+}
+
+func TestSurfaceRegistry_ResetGraphicsDropsSurfaces(t *testing.T) {
+	r := newSurfaceRegistry()
+	for id := uint16(1); id <= 3; id++ {
+		require.NoError(t, r.handle((&rdpegfx.CreateSurfacePDU{SurfaceID: id, Width: 8, Height: 8, PixelFormat: rdpegfx.PixelFormatXRGB8888}).Serialize()))
+	}
+
+	reset := rdpegfx.Header{CmdID: rdpegfx.CmdIDResetGraphics, PDULength: 340}
+	require.NoError(t, r.handle(reset.Serialize()))
+	assert.Zero(t, r.len())
+}
+
+func TestSurfaceRegistry_OtherAndMalformedCommands(t *testing.T) {
+	r := newSurfaceRegistry()
+	frame := rdpegfx.Header{CmdID: rdpegfx.CmdIDStartFrame, PDULength: 16}
+	assert.NoError(t, r.handle(frame.Serialize()))
+
+	assert.Error(t, r.handle([]byte{0x09, 0x00}), "truncated header")
+
+	bad := (&rdpegfx.CreateSurfacePDU{SurfaceID: 1, Width: 8, Height: 8, PixelFormat: rdpegfx.PixelFormatXRGB8888}).Serialize()
+	bad[len(bad)-1] = 0x00
+	assert.Error(t, r.handle(bad), "malformed create surface")
+	assert.Zero(t, r.len())
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/rcarmo/go-rdp/internal/config"
+)
+
+// defaultRDPPort is the port used when the target host names none.
+const defaultRDPPort = "3389"
+
+// parseTarget validates an RDP target as entered by the user and returns it
+// as host:port. It accepts host names, IPv4 addresses and IPv6 addresses,
+// bracketed or not, each with or without a port; the port defaults to 3389.
+func parseTarget(target string) (string, error) {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return "", errors.New("empty host")
+	}
+
+	host, port := target, defaultRDPPort
+	switch {
+	case strings.HasPrefix(target, "[") && strings.HasSuffix(target, "]"):
+		// Bracketed IPv6 literal without a port
+		host = target[1 : len(target)-1]
+		if !isIPv6(host) {
+			return "", fmt.Errorf("%q is not an IPv6 address", host)
+		}
+	case strings.HasPrefix(target, "["):
+		var err error
+		host, port, err = net.SplitHostPort(target)
+		if err != nil {
+			return "", fmt.Errorf("malformed address %q", target)
+		}
+		if !isIPv6(host) {
+			return "", fmt.Errorf("%q is not an IPv6 address", host)
+		}
+	case strings.Count(target, ":") > 1:
+		// Only an unbracketed IPv6 literal may hold several colons
+		if !isIPv6(target) {
+			return "", fmt.Errorf("malformed address %q (use [address]:port for IPv6)", target)
+		}
+	case strings.Contains(target, ":"):
+		var err error
+		host, port, err = net.SplitHostPort(target)
+		if err != nil {
+			return "", fmt.Errorf("malformed address %q", target)
+		}
+		if !isValidHostname(host) {
+			return "", fmt.Errorf("invalid host name %q", host)
+		}
+	default:
+		if !isValidHostname(host) {
+			return "", fmt.Errorf("invalid host name %q", host)
+		}
+	}
+
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid port %q", port)
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+// isIPv6 reports whether s is an IPv6 address, optionally with a zone.
+func isIPv6(s string) bool {
+	addr, err := netip.ParseAddr(s)
+	return err == nil && addr.Is6()
+}
+
+// isValidHostname reports whether s is an IPv4 address or a DNS host name
+// made of letters, digits, hyphens and underscores. A trailing dot is allowed.
+func isValidHostname(s string) bool {
+	s = strings.TrimSuffix(s, ".")
+	if s == "" || len(s) > 253 {
+		return false
+	}
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.Is4()
+	}
+
+	for _, label := range strings.Split(s, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+			if !isAlnum && c != '-' && c != '_' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// checkTarget applies cfg's target policy to a host:port target before it
+// is dialed, so a refused target fails before any connection attempt. Host
+// names are resolved when the policy decides on addresses, through the
+// shared lookup cache when enabled. A name that cannot be resolved is
+// refused. The dial checks the addresses it connects to again, as the name
+// may resolve differently by then (see targetDial).
+func checkTarget(ctx context.Context, cfg *config.Config, target string) error {
+	policy, err := cfg.Security.TargetPolicy()
+	if err != nil {
+		return err
+	}
+	if !policy.Active() {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		return err
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return policy.Check("", addr)
+	}
+	if !policy.NeedsAddresses(host) {
+		return policy.Check(host, netip.Addr{})
+	}
+
+	addrs, err := lookupTarget(ctx, cfg, host)
+	if err != nil {
+		return fmt.Errorf("%w: cannot resolve %s: %v", config.ErrTargetNotAllowed, host, err)
+	}
+	for _, addr := range addrs {
+		if err := policy.Check(host, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+
+	"github.com/rcarmo/go-rdp/internal/config"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"[::1]:3389", "[::1]:3389"},
+		{"[::1]", "[::1]:3389"},
+		{"[2001:db8::1]:3390", "[2001:db8::1]:3390"},
+		{"2001:db8::1", "[2001:db8::1]:3389"},
+		{"[fe80::1%eth0]:3389", "[fe80::1%eth0]:3389"},
+		{"192.168.1.10", "192.168.1.10:3389"},
+		{"192.168.1.10:3390", "192.168.1.10:3390"},
+		{"rdp.example.com", "rdp.example.com:3389"},
+		{" Desktop-01:3389 ", "Desktop-01:3389"},
+		{"host_name.", "host_name.:3389"},
+	}
+	for _, tt := range tests {
+		got, err := parseTarget(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+}
+
+func TestParseTarget_Invalid(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"   ",
+		"[::1",
+		"[::1]x",
+		"[::1]:",
+		"[192.168.1.10]",
+		"[192.168.1.10]:3389",
+		"2001:db8::1:3389:x",
+		"host:",
+		"host:0",
+		"host:65536",
+		"host:rdp",
+		"bad host",
+		"-bad.example.com",
+		"a..b",
+		"host/path",
+		"user@host",
+		strings.Repeat("a", 64) + ".example.com",
+	} {
+		_, err := parseTarget(in)
+		assert.Error(t, err, "%q", in)
+	}
+}
+
+func TestConnect_InvalidTarget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(Connect))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/connect?width=800&height=600"
+	ws, err := websocket.Dial(wsURL, "", "http://localhost/")
+	require.NoError(t, err)
+	defer func() { _ = ws.Close() }()
+
+	creds, err := json.Marshal(connectionRequest{Type: "credentials", Host: "[::1", User: "user"})
+	require.NoError(t, err)
+	require.NoError(t, websocket.Message.Send(ws, creds))
+
+	var reply string
+	require.NoError(t, websocket.Message.Receive(ws, &reply))
+	var msg errorMessage
+	require.NoError(t, json.Unmarshal([]byte(reply), &msg))
+	assert.Equal(t, "error", msg.Type)
+	assert.Contains(t, msg.Message, "Invalid host")
+
+	// The gateway closes the connection without dialing
+	assert.Error(t, websocket.Message.Receive(ws, &reply))
+}
+
+func TestCheckTarget(t *testing.T) {
+	cfg := &config.Config{}
+	assert.NoError(t, checkTarget(context.Background(), cfg, "127.0.0.1:3389"), "no policy allows any target")
+
+	cfg.Security = config.SecurityConfig{
+		AllowedTargets:      []string{"*.corp.example", "203.0.113.0/24"},
+		DeniedTargets:       []string{"bad.corp.example"},
+		BlockPrivateTargets: true,
+	}
+	assert.NoError(t, checkTarget(context.Background(), cfg, "203.0.113.5:3389"))
+	assert.NoError(t, checkTarget(context.Background(), cfg, "desk.corp.example:3389"), "allowed names are not resolved")
+	for _, target := range []string{"bad.corp.example:3389", "[::1]:3389", "192.168.1.1:3389", "localhost:3389", "no-such-host.invalid:3389"} {
+		assert.ErrorIs(t, checkTarget(context.Background(), cfg, target), config.ErrTargetNotAllowed, target)
+	}
+
+	cfg.Security = config.SecurityConfig{AllowedTargets: []string{"bad/prefix"}}
+	assert.Error(t, checkTarget(context.Background(), cfg, "203.0.113.5:3389"))
+}
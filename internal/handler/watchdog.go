@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// updateWatchdog tracks activity on the RDP update stream and reports when the
+// server has gone quiet for longer than the configured idle period. It only
+// fires once per stall; any new activity re-arms it.
+type updateWatchdog struct {
+	mu           sync.Mutex
+	idle         time.Duration
+	interval     time.Duration
+	now          func() time.Time
+	lastActivity time.Time
+	stalled      bool
+}
+
+// newUpdateWatchdog creates a watchdog with the given idle period.
+// A nil clock defaults to time.Now.
+func newUpdateWatchdog(idle time.Duration, now func() time.Time) *updateWatchdog {
+	if now == nil {
+		now = time.Now
+	}
+	return &updateWatchdog{
+		idle:         idle,
+		interval:     pollIntervalFor(idle),
+		now:          now,
+		lastActivity: now(),
+	}
+}
+
+// touch records activity (an update or heartbeat) from the RDP server.
+func (w *updateWatchdog) touch() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastActivity = w.now()
+	w.stalled = false
+}
+
+// check returns true exactly once when the idle period has elapsed since the
+// last recorded activity.
+func (w *updateWatchdog) check() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stalled || w.now().Sub(w.lastActivity) < w.idle {
+		return false
+	}
+	w.stalled = true
+	return true
+}
+
+// run polls the watchdog until ctx is cancelled, invoking onStall whenever
+// the update stream is found to be idle.
+func (w *updateWatchdog) run(ctx context.Context, onStall func()) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if w.check() {
+				onStall()
+			}
+		}
+	}
+}
+
+// pollIntervalFor picks a polling interval that keeps detection latency
+// well under the given period without spinning on very short timeouts.
+func pollIntervalFor(period time.Duration) time.Duration {
+	interval := period / 4
+	if interval < 100*time.Millisecond {
+		interval = 100 * time.Millisecond
+	}
+	if interval > 5*time.Second {
+		interval = 5 * time.Second
+	}
+	return interval
+}
@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/rcarmo/go-rdp/internal/rdp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a manually advanced clock for timer-driven tests
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// blockingRDPConnection never produces updates until released
+type blockingRDPConnection struct {
+	release chan struct{}
+}
+
+func (b *blockingRDPConnection) GetUpdate() (*rdp.Update, error) {
+	<-b.release
+	return nil, context.Canceled
+}
+
+func (b *blockingRDPConnection) SendInputEvent(data []byte) error {
+	return nil
+}
+
+// heartbeatRDPConnection produces no updates, only the server heartbeats
+// GetUpdate consumes, one per value sent on beats
+type heartbeatRDPConnection struct {
+	blockingRDPConnection
+	beats    chan chan struct{}
+	callback rdp.HeartbeatCallback
+}
+
+func (h *heartbeatRDPConnection) SetHeartbeatCallback(cb rdp.HeartbeatCallback) {
+	h.callback = cb
+}
+
+func (h *heartbeatRDPConnection) GetUpdate() (*rdp.Update, error) {
+	for {
+		select {
+		case done := <-h.beats:
+			if h.callback != nil {
+				h.callback(0)
+			}
+			close(done)
+		case <-h.release:
+			return nil, context.Canceled
+		}
+	}
+}
+
+func (h *heartbeatRDPConnection) beat() {
+	done := make(chan struct{})
+	h.beats <- done
+	<-done
+}
+
+func TestUpdateWatchdog_Check(t *testing.T) {
+	clock := newFakeClock()
+	w := newUpdateWatchdog(10*time.Second, clock.Now)
+
+	assert.False(t, w.check(), "should not fire before idle period")
+
+	clock.Advance(9 * time.Second)
+	assert.False(t, w.check())
+
+	clock.Advance(time.Second)
+	assert.True(t, w.check(), "should fire once idle period elapses")
+	assert.False(t, w.check(), "should only fire once per stall")
+
+	w.touch()
+	clock.Advance(5 * time.Second)
+	assert.False(t, w.check(), "activity should re-arm the watchdog")
+
+	clock.Advance(5 * time.Second)
+	assert.True(t, w.check())
+}
+
+func TestUpdateWatchdog_NilTouch(t *testing.T) {
+	var w *updateWatchdog
+	assert.NotPanics(t, func() { w.touch() })
+}
+
+func TestWatchdogPollInterval(t *testing.T) {
+	assert.Equal(t, 100*time.Millisecond, pollIntervalFor(100*time.Millisecond))
+	assert.Equal(t, 2*time.Second, pollIntervalFor(8*time.Second))
+	assert.Equal(t, 5*time.Second, pollIntervalFor(time.Minute))
+}
+
+func TestRdpToWs_WatchdogSendsWarning(t *testing.T) {
+	clock := newFakeClock()
+	watchdog := newUpdateWatchdog(30*time.Second, clock.Now)
+	watchdog.interval = 10 * time.Millisecond
+	blocking := &blockingRDPConnection{release: make(chan struct{})}
+	defer close(blocking.release)
+
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var mu sync.Mutex
+		go rdpToWsWithOptions(ctx, blocking, ws, &mu, relayOptions{watchdog: watchdog})
+
+		// Server goes quiet past the idle period
+		clock.Advance(31 * time.Second)
+
+		// Keep the handler alive until the client has read the warning
+		var ignored []byte
+		_ = websocket.Message.Receive(ws, &ignored)
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	ws, err := websocket.Dial(wsURL, "", "http://localhost/")
+	require.NoError(t, err)
+	defer func() { _ = ws.Close() }()
+
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(2*time.Second)))
+	var msg []byte
+	require.NoError(t, websocket.Message.Receive(ws, &msg))
+
+	require.NotEmpty(t, msg)
+	assert.Equal(t, byte(0xFF), msg[0])
+
+	var warning warningMessage
+	require.NoError(t, json.Unmarshal(msg[1:], &warning))
+	assert.Equal(t, "warning", warning.Type)
+	assert.Equal(t, "unresponsive", warning.Reason)
+}
+
+func TestRdpToWs_HeartbeatsKeepWatchdogQuiet(t *testing.T) {
+	clock := newFakeClock()
+	watchdog := newUpdateWatchdog(30*time.Second, clock.Now)
+	watchdog.interval = 10 * time.Millisecond
+	conn := &heartbeatRDPConnection{
+		blockingRDPConnection: blockingRDPConnection{release: make(chan struct{})},
+		beats:                 make(chan chan struct{}),
+	}
+	defer close(conn.release)
+
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var mu sync.Mutex
+		go rdpToWsWithOptions(ctx, conn, ws, &mu, relayOptions{watchdog: watchdog})
+
+		// No updates for well past the idle period, but a heartbeat
+		// every 20 seconds
+		for i := 0; i < 4; i++ {
+			clock.Advance(20 * time.Second)
+			conn.beat()
+			time.Sleep(5 * watchdog.interval)
+		}
+
+		mu.Lock()
+		_ = websocket.Message.Send(ws, "done")
+		mu.Unlock()
+
+		var ignored []byte
+		_ = websocket.Message.Receive(ws, &ignored)
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	ws, err := websocket.Dial(wsURL, "", "http://localhost/")
+	require.NoError(t, err)
+	defer func() { _ = ws.Close() }()
+
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var msg string
+	require.NoError(t, websocket.Message.Receive(ws, &msg))
+	assert.Equal(t, "done", msg, "heartbeats should keep the watchdog from warning")
+}
@@ -2,11 +2,14 @@
 package logging
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Level represents log severity levels
@@ -26,13 +29,32 @@ var levelNames = map[Level]string{
 	LevelError: "ERROR",
 }
 
+// Format selects how log lines are rendered
+type Format int
+
+const (
+	// FormatText writes "[LEVEL] message key=value" lines
+	FormatText Format = iota
+	// FormatJSON writes one JSON object per line with level, ts and msg
+	FormatJSON
+)
+
 // Logger provides leveled logging
 type Logger struct {
 	level  Level
+	format Format
 	mu     sync.RWMutex
 	logger *log.Logger
+
+	// root is the logger a With child was derived from; level, format and
+	// output are always read from it so later changes apply to children
+	root   *Logger
+	fields []interface{}
 }
 
+// jsonMu serializes JSON lines, which bypass log.Logger's own locking
+var jsonMu sync.Mutex
+
 var (
 	defaultLogger *Logger
 	once          sync.Once
@@ -49,11 +71,28 @@ func Default() *Logger {
 	return defaultLogger
 }
 
+// New returns a logger writing to w at info level in text format
+func New(w io.Writer) *Logger {
+	return &Logger{
+		level:  LevelInfo,
+		logger: log.New(w, "", log.LstdFlags|log.LUTC),
+	}
+}
+
+// base returns the logger holding the shared level, format and output
+func (l *Logger) base() *Logger {
+	if l.root != nil {
+		return l.root
+	}
+	return l
+}
+
 // SetLevel sets the minimum log level
 func (l *Logger) SetLevel(level Level) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	l.level = level
+	b := l.base()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.level = level
 }
 
 // SetLevelFromString sets the log level from a string
@@ -74,9 +113,10 @@ func (l *Logger) SetLevelFromString(levelStr string) {
 
 // GetLevel returns the current log level
 func (l *Logger) GetLevel() Level {
-	l.mu.RLock()
-	defer l.mu.RUnlock()
-	return l.level
+	b := l.base()
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.level
 }
 
 // GetLevelString returns the current log level as a string
@@ -89,18 +129,131 @@ func GetLevelString() string {
 	return Default().GetLevelString()
 }
 
+// SetFormat sets the output format
+func (l *Logger) SetFormat(format Format) {
+	b := l.base()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.format = format
+}
+
+// SetFormatFromString sets the output format from a string ("text" or "json")
+func (l *Logger) SetFormatFromString(formatStr string) {
+	switch strings.ToLower(formatStr) {
+	case "json":
+		l.SetFormat(FormatJSON)
+	default:
+		l.SetFormat(FormatText)
+	}
+}
+
+// GetFormat returns the current output format
+func (l *Logger) GetFormat() Format {
+	b := l.base()
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.format
+}
+
+// With returns a logger that adds the key/value pairs to every line it
+// writes. Keys should be strings; a trailing key without a value is logged
+// under "!BADKEY". The child shares the parent's level, format and output.
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+	return &Logger{root: l.base(), fields: fields}
+}
+
 func (l *Logger) log(level Level, format string, args ...interface{}) {
-	l.mu.RLock()
-	currentLevel := l.level
-	l.mu.RUnlock()
+	b := l.base()
+	b.mu.RLock()
+	currentLevel := b.level
+	outFormat := b.format
+	b.mu.RUnlock()
 
+	// Filter before formatting so suppressed levels cost nothing
 	if level < currentLevel {
 		return
 	}
 
-	prefix := levelNames[level]
 	msg := fmt.Sprintf(format, args...)
-	l.logger.Printf("[%s] %s", prefix, msg)
+	if outFormat == FormatJSON {
+		line := formatJSON(time.Now().UTC(), level, msg, l.fields)
+		jsonMu.Lock()
+		_, _ = b.logger.Writer().Write(line)
+		jsonMu.Unlock()
+		return
+	}
+
+	b.logger.Printf("[%s] %s%s", levelNames[level], msg, formatFields(l.fields))
+}
+
+// fieldPairs walks kv as key/value pairs, stringifying keys and rendering
+// errors through their Error method
+func fieldPairs(kv []interface{}, fn func(key string, value interface{})) {
+	for i := 0; i < len(kv); i += 2 {
+		if i+1 >= len(kv) {
+			fn("!BADKEY", kv[i])
+			return
+		}
+		key, ok := kv[i].(string)
+		if !ok {
+			key = fmt.Sprint(kv[i])
+		}
+		value := kv[i+1]
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		fn(key, value)
+	}
+}
+
+// formatFields renders kv as " key=value" pairs for text output
+func formatFields(kv []interface{}) string {
+	if len(kv) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	fieldPairs(kv, func(key string, value interface{}) {
+		s := fmt.Sprint(value)
+		if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+			s = fmt.Sprintf("%q", s)
+		}
+		fmt.Fprintf(&sb, " %s=%s", key, s)
+	})
+	return sb.String()
+}
+
+// formatJSON renders one newline-terminated JSON object. The level, ts and
+// msg keys come first, followed by the fields in the order they were given.
+func formatJSON(ts time.Time, level Level, msg string, kv []interface{}) []byte {
+	buf := make([]byte, 0, 128)
+	buf = appendJSONField(buf, "level", levelNames[level])
+	buf = appendJSONField(buf, "ts", ts.Format(time.RFC3339Nano))
+	buf = appendJSONField(buf, "msg", msg)
+	fieldPairs(kv, func(key string, value interface{}) {
+		buf = appendJSONField(buf, key, value)
+	})
+	return append(buf, '}', '\n')
+}
+
+func appendJSONField(buf []byte, key string, value interface{}) []byte {
+	if len(buf) == 0 {
+		buf = append(buf, '{')
+	} else {
+		buf = append(buf, ',')
+	}
+	k, _ := json.Marshal(key)
+	buf = append(buf, k...)
+	buf = append(buf, ':')
+	v, err := json.Marshal(value)
+	if err != nil {
+		// Values JSON cannot represent (channels, funcs, cycles) are logged
+		// as their fmt rendering instead of dropping the line
+		v, _ = json.Marshal(fmt.Sprint(value))
+	}
+	return append(buf, v...)
 }
 
 // Debug logs a debug message
@@ -135,6 +288,21 @@ func SetLevelFromString(levelStr string) {
 	Default().SetLevelFromString(levelStr)
 }
 
+// SetFormat sets the default logger's output format
+func SetFormat(format Format) {
+	Default().SetFormat(format)
+}
+
+// SetFormatFromString sets the default logger's output format from a string
+func SetFormatFromString(formatStr string) {
+	Default().SetFormatFromString(formatStr)
+}
+
+// With returns a child of the default logger carrying the key/value pairs
+func With(kv ...interface{}) *Logger {
+	return Default().With(kv...)
+}
+
 // Debug logs a debug message to the default logger
 func Debug(format string, args ...interface{}) {
 	Default().Debug(format, args...)
@@ -2,9 +2,12 @@ package logging
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"log"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestSetLevel(t *testing.T) {
@@ -101,6 +104,81 @@ func TestLoggingOutput(t *testing.T) {
 	}
 }
 
+func TestJSONOutput(t *testing.T) {
+	var buf bytes.Buffer
+	testLogger := &Logger{
+		level:  LevelInfo,
+		logger: log.New(&buf, "", log.LstdFlags),
+	}
+	testLogger.SetFormat(FormatJSON)
+
+	// Level filtering happens before serialization
+	testLogger.Debug("should not appear")
+	if buf.Len() != 0 {
+		t.Fatalf("Debug() at Info level should produce no output, got %q", buf.String())
+	}
+
+	testLogger.With("session", "abc", "attempt", 2, "err", errors.New("refused")).Warn("dial %s failed", "host:3389")
+
+	line := buf.String()
+	if strings.Count(line, "\n") != 1 || !strings.HasPrefix(line, `{"level":"WARN","ts":`) {
+		t.Fatalf("JSON output = %q, want one object starting with level and ts", line)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatalf("JSON output %q does not parse: %v", line, err)
+	}
+	if entry["msg"] != "dial host:3389 failed" {
+		t.Errorf("msg = %v, want %q", entry["msg"], "dial host:3389 failed")
+	}
+	if entry["session"] != "abc" || entry["attempt"] != float64(2) || entry["err"] != "refused" {
+		t.Errorf("fields = %v, want session, attempt and err", entry)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, entry["ts"].(string)); err != nil {
+		t.Errorf("ts = %v is not RFC 3339: %v", entry["ts"], err)
+	}
+}
+
+func TestWith(t *testing.T) {
+	var buf bytes.Buffer
+	testLogger := &Logger{
+		level:  LevelInfo,
+		logger: log.New(&buf, "", 0),
+	}
+
+	child := testLogger.With("conn", 7).With("user", "alice smith", "dangling")
+	child.Info("connected")
+	if got, want := buf.String(), "[INFO] connected conn=7 user=\"alice smith\" !BADKEY=dangling\n"; got != want {
+		t.Errorf("With() text output = %q, want %q", got, want)
+	}
+
+	// Children follow later level and format changes on the parent
+	testLogger.SetLevel(LevelError)
+	buf.Reset()
+	child.Warn("suppressed")
+	if buf.Len() != 0 {
+		t.Errorf("child ignored parent level, got %q", buf.String())
+	}
+
+	testLogger.SetFormatFromString("json")
+	child.Error("failed")
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("child output %q is not JSON: %v", buf.String(), err)
+	}
+	if entry["conn"] != float64(7) || entry["user"] != "alice smith" {
+		t.Errorf("child fields = %v", entry)
+	}
+
+	// The parent itself carries no fields
+	buf.Reset()
+	testLogger.Error("plain")
+	if strings.Contains(buf.String(), "conn") {
+		t.Errorf("parent output %q should not include child fields", buf.String())
+	}
+}
+
 func TestGetLevel(t *testing.T) {
 	SetLevel(LevelWarn)
 	if Default().GetLevel() != LevelWarn {
@@ -129,3 +207,17 @@ func TestGetLevelString(t *testing.T) {
 		})
 	}
 }
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf)
+	if l.GetLevel() != LevelInfo || l.GetFormat() != FormatText {
+		t.Fatalf("New() level=%v format=%v, want info/text", l.GetLevel(), l.GetFormat())
+	}
+
+	l.Debug("hidden")
+	l.Info("shown")
+	if got := buf.String(); strings.Contains(got, "hidden") || !strings.Contains(got, "[INFO] shown") {
+		t.Errorf("New() output = %q", got)
+	}
+}
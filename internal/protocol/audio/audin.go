@@ -0,0 +1,162 @@
+// Package audio implements RDP audio virtual channel protocols.
+// This file contains the audio input (microphone) PDUs from MS-RDPEAI.
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// ChannelAudioInput is the dynamic virtual channel name the server opens
+// for audio input (MS-RDPEAI 2.1)
+const ChannelAudioInput = "AUDIO_INPUT"
+
+// Audio input message IDs (MS-RDPEAI 2.2.1)
+const (
+	MSG_SNDIN_VERSION       = 0x01
+	MSG_SNDIN_FORMATS       = 0x02
+	MSG_SNDIN_OPEN          = 0x03
+	MSG_SNDIN_OPEN_REPLY    = 0x04
+	MSG_SNDIN_DATA_INCOMING = 0x05
+	MSG_SNDIN_DATA          = 0x06
+	MSG_SNDIN_FORMATCHANGE  = 0x07
+)
+
+// Audio input protocol versions (MS-RDPEAI 2.2.2.1)
+const (
+	SNDIN_VERSION_1 uint32 = 0x00000001
+	SNDIN_VERSION_2 uint32 = 0x00000002
+)
+
+// SndinVersionPDU represents MSG_SNDIN_VERSION, sent by both sides
+type SndinVersionPDU struct {
+	Version uint32
+}
+
+func (v *SndinVersionPDU) Serialize() []byte {
+	buf := make([]byte, 5)
+	buf[0] = MSG_SNDIN_VERSION
+	binary.LittleEndian.PutUint32(buf[1:5], v.Version)
+	return buf
+}
+
+func (v *SndinVersionPDU) Deserialize(data []byte) error {
+	if len(data) < 5 || data[0] != MSG_SNDIN_VERSION {
+		return fmt.Errorf("invalid audio input version PDU")
+	}
+	v.Version = binary.LittleEndian.Uint32(data[1:5])
+	return nil
+}
+
+// SndinFormatsPDU represents MSG_SNDIN_FORMATS. The server sends the
+// formats it can accept; the client replies with the subset it will
+// capture in, and later messages index into the client's list.
+type SndinFormatsPDU struct {
+	Formats   []AudioFormat
+	ExtraData []byte // Server only, ignored
+}
+
+func (s *SndinFormatsPDU) Serialize() []byte {
+	var formats bytes.Buffer
+	for _, format := range s.Formats {
+		formats.Write(format.Serialize())
+	}
+
+	buf := make([]byte, 9, 9+formats.Len())
+	buf[0] = MSG_SNDIN_FORMATS
+	binary.LittleEndian.PutUint32(buf[1:5], uint32(len(s.Formats)))  // #nosec G115
+	binary.LittleEndian.PutUint32(buf[5:9], uint32(9+formats.Len())) // #nosec G115
+	return append(buf, formats.Bytes()...)
+}
+
+func (s *SndinFormatsPDU) Deserialize(data []byte) error {
+	if len(data) < 9 || data[0] != MSG_SNDIN_FORMATS {
+		return fmt.Errorf("invalid audio input formats PDU")
+	}
+	numFormats := binary.LittleEndian.Uint32(data[1:5])
+	formatsSize := binary.LittleEndian.Uint32(data[5:9])
+
+	// Each format is at least 18 bytes
+	if uint64(numFormats)*18 > uint64(len(data)-9) {
+		return fmt.Errorf("audio input formats PDU too short for %d formats", numFormats)
+	}
+
+	r := bytes.NewReader(data[9:])
+	s.Formats = make([]AudioFormat, numFormats)
+	for i := range s.Formats {
+		if err := s.Formats[i].Deserialize(r); err != nil {
+			return fmt.Errorf("format %d: %w", i, err)
+		}
+	}
+
+	// cbSizeFormatsPacket covers everything but the trailing extra data
+	if consumed := len(data) - r.Len(); int(formatsSize) >= consumed && int(formatsSize) < len(data) {
+		s.ExtraData = data[formatsSize:]
+	}
+	return nil
+}
+
+// SndinOpenPDU represents MSG_SNDIN_OPEN, the server's request to start
+// capturing in the client format at index InitialFormat
+type SndinOpenPDU struct {
+	FramesPerPacket uint32
+	InitialFormat   uint32
+	Format          AudioFormat // Capture format the server will consume
+}
+
+func (o *SndinOpenPDU) Deserialize(data []byte) error {
+	if len(data) < 9 || data[0] != MSG_SNDIN_OPEN {
+		return fmt.Errorf("invalid audio input open PDU")
+	}
+	o.FramesPerPacket = binary.LittleEndian.Uint32(data[1:5])
+	o.InitialFormat = binary.LittleEndian.Uint32(data[5:9])
+	if err := o.Format.Deserialize(bytes.NewReader(data[9:])); err != nil {
+		return fmt.Errorf("open capture format: %w", err)
+	}
+	return nil
+}
+
+// SndinOpenReplyPDU represents MSG_SNDIN_OPEN_REPLY
+type SndinOpenReplyPDU struct {
+	Result uint32 // HRESULT, 0 on success
+}
+
+func (o *SndinOpenReplyPDU) Serialize() []byte {
+	buf := make([]byte, 5)
+	buf[0] = MSG_SNDIN_OPEN_REPLY
+	binary.LittleEndian.PutUint32(buf[1:5], o.Result)
+	return buf
+}
+
+// SndinFormatChangePDU represents MSG_SNDIN_FORMATCHANGE. The server sends
+// it to switch capture formats and the client echoes it back to confirm;
+// the client also sends one before its open reply to announce the initial
+// format.
+type SndinFormatChangePDU struct {
+	NewFormat uint32
+}
+
+func (f *SndinFormatChangePDU) Serialize() []byte {
+	buf := make([]byte, 5)
+	buf[0] = MSG_SNDIN_FORMATCHANGE
+	binary.LittleEndian.PutUint32(buf[1:5], f.NewFormat)
+	return buf
+}
+
+func (f *SndinFormatChangePDU) Deserialize(data []byte) error {
+	if len(data) < 5 || data[0] != MSG_SNDIN_FORMATCHANGE {
+		return fmt.Errorf("invalid audio input format change PDU")
+	}
+	f.NewFormat = binary.LittleEndian.Uint32(data[1:5])
+	return nil
+}
+
+// BuildSndinData builds the MSG_SNDIN_DATA_INCOMING and MSG_SNDIN_DATA
+// messages that carry one packet of captured audio
+func BuildSndinData(data []byte) (incoming, payload []byte) {
+	payload = make([]byte, 1+len(data))
+	payload[0] = MSG_SNDIN_DATA
+	copy(payload[1:], data)
+	return []byte{MSG_SNDIN_DATA_INCOMING}, payload
+}
@@ -0,0 +1,114 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestSndinVersionPDU(t *testing.T) {
+	pdu := &SndinVersionPDU{Version: SNDIN_VERSION_2}
+	data := pdu.Serialize()
+	if !bytes.Equal(data, []byte{MSG_SNDIN_VERSION, 0x02, 0x00, 0x00, 0x00}) {
+		t.Fatalf("Serialize() = %v", data)
+	}
+
+	var parsed SndinVersionPDU
+	if err := parsed.Deserialize(data); err != nil {
+		t.Fatalf("Deserialize() error = %v", err)
+	}
+	if parsed.Version != SNDIN_VERSION_2 {
+		t.Errorf("Version = %d, want %d", parsed.Version, SNDIN_VERSION_2)
+	}
+
+	if err := parsed.Deserialize([]byte{MSG_SNDIN_VERSION, 0x01}); err == nil {
+		t.Error("Deserialize() should fail on truncated PDU")
+	}
+	if err := parsed.Deserialize([]byte{MSG_SNDIN_OPEN, 0x01, 0x00, 0x00, 0x00}); err == nil {
+		t.Error("Deserialize() should fail on wrong message ID")
+	}
+}
+
+func TestSndinFormatsPDU(t *testing.T) {
+	formats := []AudioFormat{
+		{FormatTag: WAVE_FORMAT_PCM, Channels: 2, SamplesPerSec: 44100, AvgBytesPerSec: 176400, BlockAlign: 4, BitsPerSample: 16},
+		{FormatTag: WAVE_FORMAT_ADPCM, Channels: 1, SamplesPerSec: 22050, BitsPerSample: 4, ExtraDataSize: 2, ExtraData: []byte{0xF4, 0x01}},
+	}
+	data := (&SndinFormatsPDU{Formats: formats}).Serialize()
+
+	if data[0] != MSG_SNDIN_FORMATS {
+		t.Fatalf("message ID = 0x%02X", data[0])
+	}
+	if got := binary.LittleEndian.Uint32(data[1:5]); got != 2 {
+		t.Errorf("NumFormats = %d, want 2", got)
+	}
+	if got := binary.LittleEndian.Uint32(data[5:9]); got != uint32(len(data)) {
+		t.Errorf("cbSizeFormatsPacket = %d, want %d", got, len(data))
+	}
+
+	// Servers may append extra data after the format list
+	withExtra := append(append([]byte{}, data...), 0xAA, 0xBB)
+	var parsed SndinFormatsPDU
+	if err := parsed.Deserialize(withExtra); err != nil {
+		t.Fatalf("Deserialize() error = %v", err)
+	}
+	if len(parsed.Formats) != 2 {
+		t.Fatalf("got %d formats, want 2", len(parsed.Formats))
+	}
+	if parsed.Formats[0].SamplesPerSec != 44100 || !bytes.Equal(parsed.Formats[1].ExtraData, []byte{0xF4, 0x01}) {
+		t.Errorf("formats = %+v", parsed.Formats)
+	}
+	if !bytes.Equal(parsed.ExtraData, []byte{0xAA, 0xBB}) {
+		t.Errorf("ExtraData = %v, want [AA BB]", parsed.ExtraData)
+	}
+
+	// A format count larger than the PDU is rejected before allocating
+	binary.LittleEndian.PutUint32(data[1:5], 0xFFFFFFFF)
+	if err := parsed.Deserialize(data); err == nil {
+		t.Error("Deserialize() should fail on oversized format count")
+	}
+}
+
+func TestSndinOpenPDU(t *testing.T) {
+	format := AudioFormat{FormatTag: WAVE_FORMAT_PCM, Channels: 1, SamplesPerSec: 22050, AvgBytesPerSec: 44100, BlockAlign: 2, BitsPerSample: 16}
+	data := []byte{MSG_SNDIN_OPEN, 0xB9, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00}
+	data = append(data, format.Serialize()...)
+
+	var open SndinOpenPDU
+	if err := open.Deserialize(data); err != nil {
+		t.Fatalf("Deserialize() error = %v", err)
+	}
+	if open.FramesPerPacket != 441 || open.InitialFormat != 1 {
+		t.Errorf("FramesPerPacket = %d, InitialFormat = %d", open.FramesPerPacket, open.InitialFormat)
+	}
+	if open.Format.SamplesPerSec != 22050 || open.Format.Channels != 1 {
+		t.Errorf("Format = %s", open.Format.String())
+	}
+
+	if err := open.Deserialize(data[:12]); err == nil {
+		t.Error("Deserialize() should fail on truncated format")
+	}
+}
+
+func TestSndinReplies(t *testing.T) {
+	if got := (&SndinOpenReplyPDU{Result: 0}).Serialize(); !bytes.Equal(got, []byte{MSG_SNDIN_OPEN_REPLY, 0, 0, 0, 0}) {
+		t.Errorf("open reply = %v", got)
+	}
+
+	change := (&SndinFormatChangePDU{NewFormat: 3}).Serialize()
+	if !bytes.Equal(change, []byte{MSG_SNDIN_FORMATCHANGE, 3, 0, 0, 0}) {
+		t.Errorf("format change = %v", change)
+	}
+	var parsed SndinFormatChangePDU
+	if err := parsed.Deserialize(change); err != nil || parsed.NewFormat != 3 {
+		t.Errorf("Deserialize() = %d, %v", parsed.NewFormat, err)
+	}
+
+	incoming, payload := BuildSndinData([]byte{0x10, 0x20})
+	if !bytes.Equal(incoming, []byte{MSG_SNDIN_DATA_INCOMING}) {
+		t.Errorf("incoming = %v", incoming)
+	}
+	if !bytes.Equal(payload, []byte{MSG_SNDIN_DATA, 0x10, 0x20}) {
+		t.Errorf("payload = %v", payload)
+	}
+}
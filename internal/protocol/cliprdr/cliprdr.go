@@ -0,0 +1,273 @@
+// Package cliprdr implements the Clipboard Virtual Channel Extension (MS-RDPECLIP).
+// Only the text exchange is supported: format lists, format data requests and
+// responses for CF_UNICODETEXT, plus the capability and monitor-ready handshake.
+package cliprdr
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// ChannelName is the static virtual channel name for clipboard redirection
+const ChannelName = "cliprdr"
+
+// Message types (MS-RDPECLIP 2.2.1)
+const (
+	MsgTypeMonitorReady       uint16 = 0x0001 // CB_MONITOR_READY
+	MsgTypeFormatList         uint16 = 0x0002 // CB_FORMAT_LIST
+	MsgTypeFormatListResponse uint16 = 0x0003 // CB_FORMAT_LIST_RESPONSE
+	MsgTypeFormatDataRequest  uint16 = 0x0004 // CB_FORMAT_DATA_REQUEST
+	MsgTypeFormatDataResponse uint16 = 0x0005 // CB_FORMAT_DATA_RESPONSE
+	MsgTypeTempDirectory      uint16 = 0x0006 // CB_TEMP_DIRECTORY
+	MsgTypeClipCaps           uint16 = 0x0007 // CB_CLIP_CAPS
+	MsgTypeFileContentsReq    uint16 = 0x0008 // CB_FILECONTENTS_REQUEST
+	MsgTypeFileContentsResp   uint16 = 0x0009 // CB_FILECONTENTS_RESPONSE
+	MsgTypeLockClipData       uint16 = 0x000A // CB_LOCK_CLIPDATA
+	MsgTypeUnlockClipData     uint16 = 0x000B // CB_UNLOCK_CLIPDATA
+)
+
+// Message flags (MS-RDPECLIP 2.2.1)
+const (
+	FlagResponseOK   uint16 = 0x0001 // CB_RESPONSE_OK
+	FlagResponseFail uint16 = 0x0002 // CB_RESPONSE_FAIL
+	FlagASCIINames   uint16 = 0x0004 // CB_ASCII_NAMES
+)
+
+// Capability constants (MS-RDPECLIP 2.2.2.1.1.1)
+const (
+	CapsTypeGeneral uint16 = 0x0001 // CB_CAPSTYPE_GENERAL
+	CapsVersion1    uint32 = 0x0001 // CB_CAPS_VERSION_1
+	CapsVersion2    uint32 = 0x0002 // CB_CAPS_VERSION_2
+
+	GeneralFlagUseLongFormatNames    uint32 = 0x00000002 // CB_USE_LONG_FORMAT_NAMES
+	GeneralFlagStreamFileClipEnabled uint32 = 0x00000004 // CB_STREAM_FILECLIP_ENABLED
+	GeneralFlagFileClipNoFilePaths   uint32 = 0x00000008 // CB_FILECLIP_NO_FILE_PATHS
+	GeneralFlagCanLockClipData       uint32 = 0x00000010 // CB_CAN_LOCK_CLIPDATA
+)
+
+// Standard clipboard format IDs
+const (
+	FormatText        uint32 = 1  // CF_TEXT
+	FormatUnicodeText uint32 = 13 // CF_UNICODETEXT
+)
+
+// HeaderSize is the size of CLIPRDR_HEADER
+const HeaderSize = 8
+
+// shortFormatNameSize is the fixed name field size in a short format name entry
+const shortFormatNameSize = 32
+
+// ErrInvalidPDU is returned when a clipboard PDU is truncated or malformed.
+var ErrInvalidPDU = errors.New("invalid cliprdr PDU")
+
+// Header represents CLIPRDR_HEADER (MS-RDPECLIP 2.2.1)
+type Header struct {
+	MsgType  uint16
+	MsgFlags uint16
+	DataLen  uint32
+}
+
+// ParsePDU splits a reassembled clipboard PDU into its header and body
+func ParsePDU(data []byte) (Header, []byte, error) {
+	var h Header
+	if len(data) < HeaderSize {
+		return h, nil, fmt.Errorf("%w: %d bytes", ErrInvalidPDU, len(data))
+	}
+	h.MsgType = binary.LittleEndian.Uint16(data[0:2])
+	h.MsgFlags = binary.LittleEndian.Uint16(data[2:4])
+	h.DataLen = binary.LittleEndian.Uint32(data[4:8])
+	if uint64(h.DataLen) > uint64(len(data)-HeaderSize) {
+		return h, nil, fmt.Errorf("%w: dataLen %d exceeds %d bytes", ErrInvalidPDU, h.DataLen, len(data)-HeaderSize)
+	}
+	return h, data[HeaderSize : HeaderSize+int(h.DataLen)], nil
+}
+
+// BuildPDU prepends a CLIPRDR_HEADER to body
+func BuildPDU(msgType, msgFlags uint16, body []byte) []byte {
+	buf := make([]byte, HeaderSize, HeaderSize+len(body))
+	binary.LittleEndian.PutUint16(buf[0:2], msgType)
+	binary.LittleEndian.PutUint16(buf[2:4], msgFlags)
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(len(body))) // #nosec G115
+	return append(buf, body...)
+}
+
+// GeneralCapability represents CLIPRDR_GENERAL_CAPABILITY (MS-RDPECLIP 2.2.2.1.1.1)
+type GeneralCapability struct {
+	Version      uint32
+	GeneralFlags uint32
+}
+
+// ParseCapabilities parses the body of a CLIPRDR_CAPS PDU and returns the
+// general capability set. Unknown capability sets are skipped.
+func ParseCapabilities(body []byte) (*GeneralCapability, error) {
+	if len(body) < 4 {
+		return nil, fmt.Errorf("%w: capabilities too short", ErrInvalidPDU)
+	}
+	count := int(binary.LittleEndian.Uint16(body[0:2]))
+	rest := body[4:] // cCapabilitiesSets, pad1
+
+	var general *GeneralCapability
+	for i := 0; i < count; i++ {
+		if len(rest) < 4 {
+			return nil, fmt.Errorf("%w: capability set %d truncated", ErrInvalidPDU, i)
+		}
+		capType := binary.LittleEndian.Uint16(rest[0:2])
+		capLen := int(binary.LittleEndian.Uint16(rest[2:4]))
+		if capLen < 4 || capLen > len(rest) {
+			return nil, fmt.Errorf("%w: capability set %d length %d", ErrInvalidPDU, i, capLen)
+		}
+		if capType == CapsTypeGeneral {
+			if capLen < 12 {
+				return nil, fmt.Errorf("%w: general capability length %d", ErrInvalidPDU, capLen)
+			}
+			general = &GeneralCapability{
+				Version:      binary.LittleEndian.Uint32(rest[4:8]),
+				GeneralFlags: binary.LittleEndian.Uint32(rest[8:12]),
+			}
+		}
+		rest = rest[capLen:]
+	}
+	if general == nil {
+		return nil, fmt.Errorf("%w: no general capability set", ErrInvalidPDU)
+	}
+	return general, nil
+}
+
+// SerializeCapabilities encodes the body of a CLIPRDR_CAPS PDU carrying c
+func (c *GeneralCapability) SerializeCapabilities() []byte {
+	buf := make([]byte, 16)
+	binary.LittleEndian.PutUint16(buf[0:2], 1) // cCapabilitiesSets
+	binary.LittleEndian.PutUint16(buf[4:6], CapsTypeGeneral)
+	binary.LittleEndian.PutUint16(buf[6:8], 12) // lengthCapability
+	binary.LittleEndian.PutUint32(buf[8:12], c.Version)
+	binary.LittleEndian.PutUint32(buf[12:16], c.GeneralFlags)
+	return buf
+}
+
+// Format is one entry of a format list
+type Format struct {
+	ID   uint32
+	Name string
+}
+
+// ParseFormatList parses the body of a CLIPRDR_FORMAT_LIST PDU. longNames
+// selects CLIPRDR_LONG_FORMAT_NAME entries, which are used when both sides
+// advertised CB_USE_LONG_FORMAT_NAMES; otherwise the fixed 32-byte short
+// names are expected, as ASCII if msgFlags carries CB_ASCII_NAMES.
+func ParseFormatList(body []byte, msgFlags uint16, longNames bool) ([]Format, error) {
+	var formats []Format
+	if !longNames {
+		const entrySize = 4 + shortFormatNameSize
+		if len(body)%entrySize != 0 {
+			return nil, fmt.Errorf("%w: short format list length %d", ErrInvalidPDU, len(body))
+		}
+		for off := 0; off < len(body); off += entrySize {
+			f := Format{ID: binary.LittleEndian.Uint32(body[off:])}
+			name := body[off+4 : off+entrySize]
+			if msgFlags&FlagASCIINames != 0 {
+				f.Name = decodeASCII(name)
+			} else {
+				f.Name = DecodeText(name)
+			}
+			formats = append(formats, f)
+		}
+		return formats, nil
+	}
+
+	for len(body) > 0 {
+		if len(body) < 6 {
+			return nil, fmt.Errorf("%w: long format name truncated", ErrInvalidPDU)
+		}
+		f := Format{ID: binary.LittleEndian.Uint32(body)}
+		body = body[4:]
+		end := -1
+		for i := 0; i+1 < len(body); i += 2 {
+			if body[i] == 0 && body[i+1] == 0 {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("%w: unterminated format name", ErrInvalidPDU)
+		}
+		f.Name = DecodeText(body[:end])
+		body = body[end+2:]
+		formats = append(formats, f)
+	}
+	return formats, nil
+}
+
+// SerializeFormatList encodes the body of a CLIPRDR_FORMAT_LIST PDU
+func SerializeFormatList(formats []Format, longNames bool) []byte {
+	var buf []byte
+	for _, f := range formats {
+		buf = binary.LittleEndian.AppendUint32(buf, f.ID)
+		name := EncodeText(f.Name)
+		if longNames {
+			buf = append(buf, name...)
+			continue
+		}
+		short := make([]byte, shortFormatNameSize)
+		copy(short[:shortFormatNameSize-2], name) // always leave room for the terminator
+		buf = append(buf, short...)
+	}
+	return buf
+}
+
+// HasFormat reports whether formats contains id
+func HasFormat(formats []Format, id uint32) bool {
+	for _, f := range formats {
+		if f.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// SerializeFormatDataRequest encodes the body of a CLIPRDR_FORMAT_DATA_REQUEST PDU
+func SerializeFormatDataRequest(formatID uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, formatID)
+}
+
+// ParseFormatDataRequest parses the body of a CLIPRDR_FORMAT_DATA_REQUEST PDU
+func ParseFormatDataRequest(body []byte) (uint32, error) {
+	if len(body) < 4 {
+		return 0, fmt.Errorf("%w: format data request too short", ErrInvalidPDU)
+	}
+	return binary.LittleEndian.Uint32(body), nil
+}
+
+// EncodeText converts s to null-terminated UTF-16LE, the CF_UNICODETEXT
+// representation. Line endings are sent as-is.
+func EncodeText(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	buf := make([]byte, 0, 2*len(units)+2)
+	for _, u := range units {
+		buf = binary.LittleEndian.AppendUint16(buf, u)
+	}
+	return append(buf, 0, 0)
+}
+
+// DecodeText converts UTF-16LE data up to the first null character to a string
+func DecodeText(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u := binary.LittleEndian.Uint16(b[i:])
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+	return string(utf16.Decode(units))
+}
+
+func decodeASCII(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
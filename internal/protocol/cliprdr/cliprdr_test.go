@@ -0,0 +1,117 @@
+package cliprdr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildParsePDU(t *testing.T) {
+	pdu := BuildPDU(MsgTypeFormatDataResponse, FlagResponseOK, []byte{1, 2, 3})
+	assert.Equal(t, []byte{0x05, 0x00, 0x01, 0x00, 0x03, 0x00, 0x00, 0x00, 1, 2, 3}, pdu)
+
+	header, body, err := ParsePDU(append(pdu, 0xAA)) // trailing padding is ignored
+	require.NoError(t, err)
+	assert.Equal(t, Header{MsgType: MsgTypeFormatDataResponse, MsgFlags: FlagResponseOK, DataLen: 3}, header)
+	assert.Equal(t, []byte{1, 2, 3}, body)
+
+	_, _, err = ParsePDU([]byte{1, 0, 0, 0})
+	assert.ErrorIs(t, err, ErrInvalidPDU)
+
+	_, _, err = ParsePDU(pdu[:10])
+	assert.ErrorIs(t, err, ErrInvalidPDU, "dataLen exceeds data")
+}
+
+func TestCapabilities(t *testing.T) {
+	caps := GeneralCapability{Version: CapsVersion2, GeneralFlags: GeneralFlagUseLongFormatNames}
+	body := caps.SerializeCapabilities()
+	assert.Equal(t, []byte{
+		0x01, 0x00, 0x00, 0x00, // cCapabilitiesSets, pad1
+		0x01, 0x00, 0x0C, 0x00, // CB_CAPSTYPE_GENERAL, length 12
+		0x02, 0x00, 0x00, 0x00, // version
+		0x02, 0x00, 0x00, 0x00, // generalFlags
+	}, body)
+
+	parsed, err := ParseCapabilities(body)
+	require.NoError(t, err)
+	assert.Equal(t, caps, *parsed)
+
+	// An unknown capability set ahead of the general one is skipped
+	withUnknown := []byte{0x02, 0x00, 0x00, 0x00, 0x09, 0x00, 0x06, 0x00, 0xAA, 0xBB}
+	withUnknown = append(withUnknown, body[4:]...)
+	parsed, err = ParseCapabilities(withUnknown)
+	require.NoError(t, err)
+	assert.Equal(t, caps, *parsed)
+
+	_, err = ParseCapabilities([]byte{0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x20, 0x00})
+	assert.ErrorIs(t, err, ErrInvalidPDU, "length beyond data")
+
+	_, err = ParseCapabilities([]byte{0x00, 0x00, 0x00, 0x00})
+	assert.ErrorIs(t, err, ErrInvalidPDU, "no general capability set")
+}
+
+func TestFormatList_LongNames(t *testing.T) {
+	formats := []Format{
+		{ID: FormatUnicodeText},
+		{ID: 0xC004, Name: "HTML Format"},
+	}
+	body := SerializeFormatList(formats, true)
+	assert.Equal(t, []byte{0x0D, 0x00, 0x00, 0x00, 0x00, 0x00}, body[:6])
+
+	parsed, err := ParseFormatList(body, 0, true)
+	require.NoError(t, err)
+	assert.Equal(t, formats, parsed)
+	assert.True(t, HasFormat(parsed, FormatUnicodeText))
+	assert.False(t, HasFormat(parsed, FormatText))
+
+	_, err = ParseFormatList(body[:len(body)-2], 0, true)
+	assert.ErrorIs(t, err, ErrInvalidPDU, "unterminated name")
+
+	parsed, err = ParseFormatList(nil, 0, true)
+	require.NoError(t, err)
+	assert.Empty(t, parsed)
+}
+
+func TestFormatList_ShortNames(t *testing.T) {
+	formats := []Format{{ID: FormatUnicodeText}, {ID: 0xC004, Name: "HTML Format"}}
+	body := SerializeFormatList(formats, false)
+	require.Len(t, body, 2*36)
+
+	parsed, err := ParseFormatList(body, 0, false)
+	require.NoError(t, err)
+	assert.Equal(t, formats, parsed)
+
+	// CB_ASCII_NAMES: names are single-byte
+	ascii := make([]byte, 36)
+	ascii[0] = 0x01
+	copy(ascii[4:], "Rich Text")
+	parsed, err = ParseFormatList(ascii, FlagASCIINames, false)
+	require.NoError(t, err)
+	assert.Equal(t, []Format{{ID: FormatText, Name: "Rich Text"}}, parsed)
+
+	_, err = ParseFormatList(body[:40], 0, false)
+	assert.ErrorIs(t, err, ErrInvalidPDU)
+}
+
+func TestFormatDataRequest(t *testing.T) {
+	body := SerializeFormatDataRequest(FormatUnicodeText)
+	id, err := ParseFormatDataRequest(body)
+	require.NoError(t, err)
+	assert.Equal(t, FormatUnicodeText, id)
+
+	_, err = ParseFormatDataRequest(body[:2])
+	assert.ErrorIs(t, err, ErrInvalidPDU)
+}
+
+func TestText(t *testing.T) {
+	assert.Equal(t, []byte{'h', 0, 'i', 0, 0, 0}, EncodeText("hi"))
+
+	for _, s := range []string{"", "hello\r\nworld", "naïve café", "emoji 😀 outside the BMP"} {
+		assert.Equal(t, s, DecodeText(EncodeText(s)))
+	}
+
+	// Decoding stops at the terminator and tolerates a missing one
+	assert.Equal(t, "ab", DecodeText([]byte{'a', 0, 'b', 0, 0, 0, 'c', 0}))
+	assert.Equal(t, "ab", DecodeText([]byte{'a', 0, 'b', 0, 'c'}))
+}
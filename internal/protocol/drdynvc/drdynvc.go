@@ -170,6 +170,24 @@ func (c *CreateRequestPDU) Serialize() []byte {
 	return buf.Bytes()
 }
 
+// Deserialize decodes a server DYNVC_CREATE_REQ body (the bytes after the
+// header) from wire format
+func (c *CreateRequestPDU) Deserialize(data []byte, cbChID uint8) error {
+	channelID, remaining, err := ReadChannelID(data, cbChID)
+	if err != nil {
+		return err
+	}
+
+	end := bytes.IndexByte(remaining, 0)
+	if end < 0 {
+		return fmt.Errorf("create request channel name not terminated")
+	}
+
+	c.ChannelID = channelID
+	c.ChannelName = string(remaining[:end])
+	return nil
+}
+
 // CreateResponsePDU represents DYNVC_CREATE_RSP (MS-RDPEDYC 2.2.2.2)
 type CreateResponsePDU struct {
 	ChannelID    uint32
@@ -202,6 +220,38 @@ func (c *CreateResponsePDU) Deserialize(r io.Reader, cbChID uint8) error {
 	return binary.Read(r, binary.LittleEndian, &c.CreationCode)
 }
 
+// Serialize encodes CreateResponsePDU to wire format
+func (c *CreateResponsePDU) Serialize() []byte {
+	buf := new(bytes.Buffer)
+
+	// Determine channel ID size
+	var cbChID uint8
+	switch {
+	case c.ChannelID <= 0xFF:
+		cbChID = 0
+	case c.ChannelID <= 0xFFFF:
+		cbChID = 1
+	default:
+		cbChID = 2
+	}
+
+	header := Header{CbChID: cbChID, Sp: 0, Cmd: CmdCreate}
+	buf.WriteByte(header.Serialize())
+
+	switch cbChID {
+	case 0:
+		buf.WriteByte(byte(c.ChannelID))
+	case 1:
+		_ = binary.Write(buf, binary.LittleEndian, uint16(c.ChannelID)) // #nosec G115
+	case 2:
+		_ = binary.Write(buf, binary.LittleEndian, c.ChannelID)
+	}
+
+	_ = binary.Write(buf, binary.LittleEndian, c.CreationCode)
+
+	return buf.Bytes()
+}
+
 // IsSuccess returns true if channel creation succeeded
 func (c *CreateResponsePDU) IsSuccess() bool {
 	return c.CreationCode == CreateResultOK
@@ -311,6 +361,33 @@ func (d *DataPDU) Serialize() []byte {
 	return buf.Bytes()
 }
 
+// MaxPDUSize is the largest DRDYNVC PDU a peer must accept (MS-RDPEDYC 3.1.5.1.4)
+const MaxPDUSize = 1600
+
+// Fragment encodes channel data as DRDYNVC PDUs no larger than MaxPDUSize.
+// Data that fits is sent as a single DYNVC_DATA; anything larger is split
+// into a DYNVC_DATA_FIRST carrying the total length followed by DYNVC_DATA
+// fragments.
+func Fragment(channelID uint32, data []byte) [][]byte {
+	single := &DataPDU{ChannelID: channelID, Data: data}
+	if pdu := single.Serialize(); len(pdu) <= MaxPDUSize {
+		return [][]byte{pdu}
+	}
+
+	// Header, the largest channel ID and the largest length field
+	const overhead = 1 + 4 + 4
+	chunk := MaxPDUSize - overhead
+
+	first := &DataFirstPDU{ChannelID: channelID, Length: uint32(len(data)), Data: data[:chunk]} // #nosec G115
+	pdus := [][]byte{first.Serialize()}
+	for off := chunk; off < len(data); off += chunk {
+		end := min(off+chunk, len(data))
+		next := &DataPDU{ChannelID: channelID, Data: data[off:end]}
+		pdus = append(pdus, next.Serialize())
+	}
+	return pdus
+}
+
 // ClosePDU represents DYNVC_CLOSE (MS-RDPEDYC 2.2.4)
 type ClosePDU struct {
 	ChannelID uint32
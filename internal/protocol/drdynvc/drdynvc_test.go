@@ -994,3 +994,60 @@ func TestS7_DynamicVirtualChannel_CreateResponse(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateRequestPDU_Deserialize(t *testing.T) {
+	req := &CreateRequestPDU{ChannelID: 0x1234, ChannelName: "AUDIO_INPUT"}
+	data := req.Serialize()
+
+	cmd, cbChID, remaining, err := ParsePDU(data)
+	require.NoError(t, err)
+	require.Equal(t, CmdCreate, cmd)
+
+	var parsed CreateRequestPDU
+	require.NoError(t, parsed.Deserialize(remaining, cbChID))
+	assert.Equal(t, *req, parsed)
+
+	// The channel name must be null-terminated
+	assert.Error(t, parsed.Deserialize(remaining[:len(remaining)-1], cbChID))
+}
+
+func TestCreateResponsePDU_Serialize(t *testing.T) {
+	resp := &CreateResponsePDU{ChannelID: 7, CreationCode: CreateResultOK}
+	data := resp.Serialize()
+	assert.Equal(t, []byte{0x10, 0x07, 0x00, 0x00, 0x00, 0x00}, data)
+
+	var parsed CreateResponsePDU
+	require.NoError(t, parsed.Deserialize(bytes.NewReader(data[1:]), 0))
+	assert.Equal(t, *resp, parsed)
+}
+
+func TestFragment(t *testing.T) {
+	small := Fragment(3, []byte{1, 2, 3})
+	require.Len(t, small, 1)
+	assert.Equal(t, []byte{0x30, 0x03, 1, 2, 3}, small[0])
+
+	data := make([]byte, 4000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	pdus := Fragment(3, data)
+	require.Len(t, pdus, 3)
+
+	var header Header
+	header.Deserialize(pdus[0][0])
+	assert.Equal(t, CmdDataFirst, header.Cmd)
+	assert.Equal(t, uint8(1), header.Sp, "2-byte total length")
+	assert.Equal(t, []byte{0x03, 0xA0, 0x0F}, pdus[0][1:4])
+
+	var reassembled []byte
+	reassembled = append(reassembled, pdus[0][4:]...)
+	for _, pdu := range pdus[1:] {
+		header.Deserialize(pdu[0])
+		assert.Equal(t, CmdData, header.Cmd)
+		reassembled = append(reassembled, pdu[2:]...)
+	}
+	for _, pdu := range pdus {
+		assert.LessOrEqual(t, len(pdu), MaxPDUSize)
+	}
+	assert.Equal(t, data, reassembled)
+}
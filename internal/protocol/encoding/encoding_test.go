@@ -2,6 +2,7 @@ package encoding
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"testing"
 )
@@ -1087,6 +1088,141 @@ func TestPerReadOctetStream(t *testing.T) {
 	}
 }
 
+func TestPerReadLengthFragment(t *testing.T) {
+	for m := 1; m <= 4; m++ {
+		got, err := PerReadLength(bytes.NewReader([]byte{0xC0 | byte(m)}))
+		if !errors.Is(err, ErrPERFragmented) {
+			t.Errorf("PerReadLength(0x%02X) error = %v, want ErrPERFragmented", 0xC0|m, err)
+		}
+		if got != m*16384 {
+			t.Errorf("PerReadLength(0x%02X) = %d, want %d", 0xC0|m, got, m*16384)
+		}
+	}
+}
+
+func TestPerWriteOctetString(t *testing.T) {
+	type segment struct {
+		determinant []byte
+		octets      int
+	}
+
+	tests := []struct {
+		name     string
+		size     int
+		segments []segment
+	}{
+		{name: "empty", size: 0, segments: []segment{{[]byte{0x00}, 0}}},
+		{name: "short form", size: 5, segments: []segment{{[]byte{0x05}, 5}}},
+		{name: "long form", size: 300, segments: []segment{{[]byte{0x81, 0x2C}, 300}}},
+		{name: "largest unfragmented", size: 16383, segments: []segment{{[]byte{0xBF, 0xFF}, 16383}}},
+		{name: "one fragment and empty remainder", size: 16384, segments: []segment{
+			{[]byte{0xC1}, 16384}, {[]byte{0x00}, 0},
+		}},
+		{name: "two fragments and remainder", size: 2*16384 + 10, segments: []segment{
+			{[]byte{0xC2}, 2 * 16384}, {[]byte{0x0A}, 10},
+		}},
+		{name: "64K fragment then more", size: 5*16384 + 1, segments: []segment{
+			{[]byte{0xC4}, 4 * 16384}, {[]byte{0xC1}, 16384}, {[]byte{0x01}, 1},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want bytes.Buffer
+			for _, seg := range tt.segments {
+				want.Write(seg.determinant)
+				want.Write(bytes.Repeat([]byte{0xAB}, seg.octets))
+			}
+
+			var buf bytes.Buffer
+			PerWriteOctetString(bytes.Repeat([]byte{0xAB}, tt.size), &buf)
+			if !bytes.Equal(buf.Bytes(), want.Bytes()) {
+				t.Errorf("PerWriteOctetString(%d octets) wrote %d bytes, want %d", tt.size, buf.Len(), want.Len())
+			}
+		})
+	}
+}
+
+func TestPerReadWriteOctetStringRoundTrip(t *testing.T) {
+	sizes := []int{0, 1, 127, 128, 1000, 16383, 16384, 16385, 65536, 65537, 5*16384 + 7}
+
+	for _, size := range sizes {
+		str := make([]byte, size)
+		for i := range str {
+			str[i] = byte(i)
+		}
+
+		var buf bytes.Buffer
+		PerWriteOctetString(str, &buf)
+		buf.WriteByte(0xEE) // trailing data must be left unread
+
+		r := bytes.NewReader(buf.Bytes())
+		got, err := PerReadOctetString(r)
+		if err != nil {
+			t.Errorf("Round trip failed for size %d: %v", size, err)
+			continue
+		}
+		if !bytes.Equal(got, str) {
+			t.Errorf("Round trip size %d: got %d octets", size, len(got))
+		}
+		if r.Len() != 1 {
+			t.Errorf("Round trip size %d: %d bytes left unread, want 1", size, r.Len())
+		}
+	}
+}
+
+func TestPerReadOctetString(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		want    []byte
+		wantErr bool
+	}{
+		{name: "empty string", input: []byte{0x00}, want: []byte{}},
+		{name: "short form", input: []byte{0x03, 'a', 'b', 'c'}, want: []byte("abc")},
+
+		// Error cases
+		{name: "empty", input: []byte{}, wantErr: true},
+		{name: "truncated", input: []byte{0x05, 'a', 'b'}, wantErr: true},
+		{name: "truncated fragment", input: append([]byte{0xC1}, make([]byte, 100)...), wantErr: true},
+		{name: "missing remainder", input: append([]byte{0xC1}, make([]byte, 16384)...), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PerReadOctetString(bytes.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PerReadOctetString() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !bytes.Equal(got, tt.want) {
+				t.Errorf("PerReadOctetString() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPerReadWriteObjectIdentifierRoundTrip(t *testing.T) {
+	oids := [][6]byte{
+		{0x00, 0x00, 0x14, 0x7C, 0x00, 0x01}, // T.124 0.0.20.124.0.1
+		{0x00, 0x05, 0x00, 0x14, 0x7C, 0x00},
+		{0x0F, 0x0F, 0xFF, 0xFF, 0xFF, 0xFF},
+	}
+
+	for _, oid := range oids {
+		var buf bytes.Buffer
+		PerWriteObjectIdentifier(oid, &buf)
+		got, err := PerReadObjectIdentifier(oid, bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Errorf("Round trip failed for OID %v: %v", oid, err)
+			continue
+		}
+		if !got {
+			t.Errorf("Round trip OID %v did not match", oid)
+		}
+	}
+}
+
 // ============================================================================
 // Edge Case and Integration Tests
 // ============================================================================
@@ -3,9 +3,17 @@ package encoding
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 )
 
+// perFragmentUnit is the 16K block a fragment length determinant counts in (X.691 10.9.3.8)
+const perFragmentUnit = 16384
+
+// ErrPERFragmented is returned by PerReadLength for the length determinant
+// of a fragment. Fragmented content is reassembled by PerReadOctetString.
+var ErrPERFragmented = errors.New("fragmented PER length")
+
 // PER reading functions
 
 func PerReadChoice(r io.Reader) (uint8, error) {
@@ -14,7 +22,25 @@ func PerReadChoice(r io.Reader) (uint8, error) {
 	return choice, binary.Read(r, binary.BigEndian, &choice)
 }
 
+// PerReadLength reads an unconstrained length determinant. A fragment
+// header (0xC1-0xC4) returns its size with ErrPERFragmented; other two-octet
+// forms are read as 15-bit lengths for encoders that never fragment.
 func PerReadLength(r io.Reader) (int, error) {
+	size, fragment, err := perReadLengthDeterminant(r)
+	if err != nil {
+		return 0, err
+	}
+
+	if fragment {
+		return size, fmt.Errorf("%w: %d octets", ErrPERFragmented, size)
+	}
+
+	return size, nil
+}
+
+// perReadLengthDeterminant reads a length determinant, reporting whether it
+// heads a fragment of 1 to 4 16K blocks followed by more content.
+func perReadLengthDeterminant(r io.Reader) (int, bool, error) {
 	var (
 		octet uint8
 		size  int
@@ -22,23 +48,27 @@ func PerReadLength(r io.Reader) (int, error) {
 	)
 
 	if err = binary.Read(r, binary.BigEndian, &octet); err != nil {
-		return 0, err
+		return 0, false, err
 	}
 
 	if octet&0x80 != 0x80 {
-		return int(octet), nil
+		return int(octet), false, nil
+	}
+
+	if m := octet &^ 0xC0; octet&0xC0 == 0xC0 && m >= 1 && m <= 4 {
+		return int(m) * perFragmentUnit, true, nil
 	}
 
 	octet &^= 0x80
 	size = int(octet) << 8
 
 	if err = binary.Read(r, binary.BigEndian, &octet); err != nil {
-		return 0, err
+		return 0, false, err
 	}
 
 	size += int(octet)
 
-	return size, nil
+	return size, false, nil
 }
 
 func PerReadObjectIdentifier(oid [6]byte, r io.Reader) (bool, error) {
@@ -151,6 +181,30 @@ func PerReadOctetStream(octetStream []byte, minValue int, r io.Reader) (bool, er
 	return true, nil
 }
 
+// PerReadOctetString reads an unconstrained OCTET STRING, reassembling the
+// fragments of strings of 16K octets or more.
+func PerReadOctetString(r io.Reader) ([]byte, error) {
+	var str []byte
+
+	for {
+		size, fragment, err := perReadLengthDeterminant(r)
+		if err != nil {
+			return nil, err
+		}
+
+		start := len(str)
+		str = append(str, make([]byte, size)...)
+
+		if _, err = io.ReadFull(r, str[start:]); err != nil {
+			return nil, err
+		}
+
+		if !fragment {
+			return str, nil
+		}
+	}
+}
+
 // PER writing functions
 
 func PerWriteChoice(choice uint8, w io.Writer) {
@@ -239,6 +293,22 @@ func PerWriteOctetStream(oStr string, minValue int, w io.Writer) {
 	_, _ = w.Write(result)
 }
 
+// PerWriteOctetString writes an unconstrained OCTET STRING. Strings of 16K
+// octets or more are split into fragments of up to 64K octets, followed by
+// the length of the remainder, which may be zero (X.691 10.9.3.8).
+func PerWriteOctetString(str []byte, w io.Writer) {
+	for len(str) >= perFragmentUnit {
+		m := min(len(str)/perFragmentUnit, 4)
+		_, _ = w.Write([]byte{0xC0 | uint8(m)}) // #nosec G115
+
+		_, _ = w.Write(str[:m*perFragmentUnit])
+		str = str[m*perFragmentUnit:]
+	}
+
+	PerWriteLength(uint16(len(str)), w) // #nosec G115
+	_, _ = w.Write(str)
+}
+
 func PerWriteInteger(value int, w io.Writer) {
 	if value <= 0xff {
 		PerWriteLength(1, w)
@@ -0,0 +1,89 @@
+package fastpath
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ErrMalformedUpdate is returned when a fast-path update runs past the end of its PDU
+var ErrMalformedUpdate = errors.New("malformed fast-path update")
+
+// DecompressFunc expands the data of one compressed update given its
+// compressionFlags
+type DecompressFunc func(data []byte, flags uint8) ([]byte, error)
+
+// DecompressUpdates walks the TS_FP_UPDATE structures in the data of an
+// UpdatePDU and expands every update that carries a compressionFlags field
+// (MS-RDPBCGR 2.2.9.1.2.1). Expanded updates are rewritten without the
+// compressionFlags byte and with the compression bits cleared, so consumers
+// only ever see uncompressed updates. Updates that only set flush or
+// at-front flags are still passed to decompress so the history stays in
+// step with the server. data is returned as-is when no update uses
+// compression.
+func DecompressUpdates(data []byte, decompress DecompressFunc) ([]byte, error) {
+	if !hasCompressedUpdate(data) {
+		return data, nil
+	}
+
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); {
+		updateHeader := data[i]
+		i++
+
+		compressed := Compression((updateHeader>>6)&0x3)&CompressionUsed == CompressionUsed
+		var compressionFlags uint8
+		if compressed {
+			if i >= len(data) {
+				return nil, ErrMalformedUpdate
+			}
+			compressionFlags = data[i]
+			i++
+		}
+
+		if i+2 > len(data) {
+			return nil, ErrMalformedUpdate
+		}
+		size := int(binary.LittleEndian.Uint16(data[i:]))
+		i += 2
+		if i+size > len(data) {
+			return nil, ErrMalformedUpdate
+		}
+		payload := data[i : i+size]
+		i += size
+
+		if compressed {
+			expanded, err := decompress(payload, compressionFlags)
+			if err != nil {
+				return nil, err
+			}
+			if len(expanded) > 0xFFFF {
+				return nil, ErrMalformedUpdate
+			}
+			payload = expanded
+			updateHeader &^= 0xC0
+		}
+
+		out = append(out, updateHeader)
+		out = binary.LittleEndian.AppendUint16(out, uint16(len(payload))) // #nosec G115
+		out = append(out, payload...)
+	}
+
+	return out, nil
+}
+
+// hasCompressedUpdate reports whether any update in data carries a
+// compressionFlags field
+func hasCompressedUpdate(data []byte) bool {
+	for i := 0; i < len(data); {
+		updateHeader := data[i]
+		i++
+		if Compression((updateHeader>>6)&0x3)&CompressionUsed == CompressionUsed {
+			return true
+		}
+		if i+2 > len(data) {
+			return false
+		}
+		i += 2 + int(binary.LittleEndian.Uint16(data[i:]))
+	}
+	return false
+}
@@ -1302,11 +1302,48 @@ func TestColorPointerUpdateData_Deserialize(t *testing.T) {
 				lengthXorMask: 8,
 			},
 		},
+		{
+			name: "hotspot without padding",
+			input: func() []byte {
+				buf := new(bytes.Buffer)
+				_ = binary.Write(buf, binary.LittleEndian, uint16(3))  // cacheIndex
+				_ = binary.Write(buf, binary.LittleEndian, uint16(31)) // xPos
+				_ = binary.Write(buf, binary.LittleEndian, uint16(7))  // yPos
+				_ = binary.Write(buf, binary.LittleEndian, uint16(32)) // width
+				_ = binary.Write(buf, binary.LittleEndian, uint16(32)) // height
+				_ = binary.Write(buf, binary.LittleEndian, uint16(2))  // lengthAndMask
+				_ = binary.Write(buf, binary.LittleEndian, uint16(3))  // lengthXorMask
+				buf.Write([]byte{0x01, 0x02, 0x03})                    // xorMaskData
+				buf.Write([]byte{0xF0, 0x0F})                          // andMaskData
+				return buf.Bytes()
+			}(),
+			expected: &colorPointerUpdateData{
+				cacheIndex:    3,
+				xPos:          31,
+				yPos:          7,
+				width:         32,
+				height:        32,
+				lengthAndMask: 2,
+				lengthXorMask: 3,
+			},
+		},
 		{
 			name:        "too short header",
 			input:       []byte{0x01, 0x00, 0x00, 0x00},
 			expectedErr: io.EOF,
 		},
+		{
+			name: "truncated mask",
+			input: func() []byte {
+				buf := new(bytes.Buffer)
+				for _, v := range []uint16{1, 0, 0, 32, 32, 0, 8} {
+					_ = binary.Write(buf, binary.LittleEndian, v)
+				}
+				buf.Write([]byte{0x11, 0x22})
+				return buf.Bytes()
+			}(),
+			expectedErr: io.ErrUnexpectedEOF,
+		},
 	}
 
 	for _, tt := range tests {
@@ -1661,3 +1698,103 @@ func TestS10_FastPathOutput_PointerUpdates(t *testing.T) {
 		})
 	}
 }
+
+// =============================================================================
+// Bulk compression tests
+// =============================================================================
+
+func TestDecompressUpdates(t *testing.T) {
+	var calls []uint8
+	expand := func(data []byte, flags uint8) ([]byte, error) {
+		calls = append(calls, flags)
+		return bytes.Repeat(data, 2), nil
+	}
+
+	t.Run("no compressed updates", func(t *testing.T) {
+		calls = nil
+		data := []byte{0x03, 0x00, 0x00, 0x01, 0x02, 0x00, 0xAA, 0xBB}
+		out, err := DecompressUpdates(data, expand)
+		require.NoError(t, err)
+		assert.Equal(t, data, out)
+		assert.Empty(t, calls)
+	})
+
+	t.Run("compressed update is expanded", func(t *testing.T) {
+		calls = nil
+		data := []byte{
+			0x81, 0x21, 0x02, 0x00, 0xAA, 0xBB, // bitmap, compressed
+			0x03, 0x00, 0x00, // synchronize, uncompressed
+		}
+		out, err := DecompressUpdates(data, expand)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{
+			0x01, 0x04, 0x00, 0xAA, 0xBB, 0xAA, 0xBB,
+			0x03, 0x00, 0x00,
+		}, out)
+		assert.Equal(t, []uint8{0x21}, calls)
+	})
+
+	t.Run("truncated update", func(t *testing.T) {
+		_, err := DecompressUpdates([]byte{0x81, 0x21, 0x05, 0x00, 0xAA}, expand)
+		assert.ErrorIs(t, err, ErrMalformedUpdate)
+	})
+
+	t.Run("decompress error", func(t *testing.T) {
+		fail := func([]byte, uint8) ([]byte, error) { return nil, io.ErrUnexpectedEOF }
+		_, err := DecompressUpdates([]byte{0x81, 0x21, 0x01, 0x00, 0xAA}, fail)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+}
+
+func TestParsePointerShape(t *testing.T) {
+	xor := []byte{0x11, 0x22, 0x33, 0x00}
+	and := []byte{0x80, 0x00}
+	attribute := func() *bytes.Buffer {
+		buf := new(bytes.Buffer)
+		for _, v := range []uint16{4, 1, 2, 1, 1, uint16(len(and)), uint16(len(xor))} {
+			_ = binary.Write(buf, binary.LittleEndian, v)
+		}
+		buf.Write(xor)
+		buf.Write(and)
+		return buf
+	}
+	want := &PointerShape{CacheIndex: 4, HotspotX: 1, HotspotY: 2, Width: 1, Height: 1, XorBpp: 24, XorMask: xor, AndMask: and}
+
+	shape, err := ParsePointerShape(UpdateCodeColor, attribute().Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, want, shape)
+
+	newPointer := append([]byte{32, 0}, attribute().Bytes()...)
+	shape, err = ParsePointerShape(UpdateCodePointer, newPointer)
+	require.NoError(t, err)
+	want.XorBpp = 32
+	assert.Equal(t, want, shape)
+
+	large := new(bytes.Buffer)
+	for _, v := range []uint16{32, 4, 1, 2, 1, 1} {
+		_ = binary.Write(large, binary.LittleEndian, v)
+	}
+	_ = binary.Write(large, binary.LittleEndian, uint32(len(and)))
+	_ = binary.Write(large, binary.LittleEndian, uint32(len(xor)))
+	large.Write(xor)
+	large.Write(and)
+	shape, err = ParsePointerShape(UpdateCodeLargePointer, large.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, want, shape)
+
+	_, err = ParsePointerShape(UpdateCodeLargePointer, large.Bytes()[:large.Len()-1])
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	_, err = ParsePointerShape(UpdateCodePointer, []byte{32})
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	_, err = ParsePointerShape(UpdateCodeCached, []byte{4, 0})
+	assert.ErrorIs(t, err, ErrNotPointerShape)
+}
+
+func TestParseCachedPointer(t *testing.T) {
+	index, err := ParseCachedPointer([]byte{0x07, 0x00})
+	require.NoError(t, err)
+	assert.Equal(t, uint16(7), index)
+
+	_, err = ParseCachedPointer([]byte{0x07})
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
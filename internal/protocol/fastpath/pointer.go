@@ -0,0 +1,92 @@
+package fastpath
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrNotPointerShape is returned by ParsePointerShape for update codes that
+// do not carry a pointer shape
+var ErrNotPointerShape = errors.New("update does not carry a pointer shape")
+
+// PointerShape is the shape carried by a color, new or large pointer update
+// (MS-RDPBCGR 2.2.9.1.1.4.4 - 2.2.9.1.1.4.5). Masks are bottom-up.
+type PointerShape struct {
+	CacheIndex uint16
+	HotspotX   uint16
+	HotspotY   uint16
+	Width      uint16
+	Height     uint16
+	XorBpp     uint16
+	XorMask    []byte
+	AndMask    []byte
+}
+
+// ParsePointerShape parses the data of a pointer update carrying a shape.
+// Color pointer updates are always 24 bpp; new and large pointer updates
+// lead with their XOR mask depth, and large ones use 32-bit mask lengths.
+func ParsePointerShape(code UpdateCode, data []byte) (*PointerShape, error) {
+	switch code {
+	case UpdateCodeColor:
+		return parseColorPointer(24, data)
+	case UpdateCodePointer:
+		if len(data) < 2 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return parseColorPointer(binary.LittleEndian.Uint16(data), data[2:])
+	case UpdateCodeLargePointer:
+		return parseLargePointer(data)
+	}
+	return nil, ErrNotPointerShape
+}
+
+func parseColorPointer(xorBpp uint16, data []byte) (*PointerShape, error) {
+	var d colorPointerUpdateData
+	if err := d.Deserialize(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return &PointerShape{
+		CacheIndex: d.cacheIndex,
+		HotspotX:   d.xPos,
+		HotspotY:   d.yPos,
+		Width:      d.width,
+		Height:     d.height,
+		XorBpp:     xorBpp,
+		XorMask:    d.xorMaskData,
+		AndMask:    d.andMaskData,
+	}, nil
+}
+
+func parseLargePointer(data []byte) (*PointerShape, error) {
+	// xorBpp (2) + cacheIndex (2) + hotSpot (4) + width (2) + height (2)
+	// + lengthAndMask (4) + lengthXorMask (4)
+	if len(data) < 20 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	shape := &PointerShape{
+		XorBpp:     binary.LittleEndian.Uint16(data[0:2]),
+		CacheIndex: binary.LittleEndian.Uint16(data[2:4]),
+		HotspotX:   binary.LittleEndian.Uint16(data[4:6]),
+		HotspotY:   binary.LittleEndian.Uint16(data[6:8]),
+		Width:      binary.LittleEndian.Uint16(data[8:10]),
+		Height:     binary.LittleEndian.Uint16(data[10:12]),
+	}
+	andLength := uint64(binary.LittleEndian.Uint32(data[12:16]))
+	xorLength := uint64(binary.LittleEndian.Uint32(data[16:20]))
+	if uint64(len(data)-20) < xorLength+andLength {
+		return nil, io.ErrUnexpectedEOF
+	}
+	shape.XorMask = data[20 : 20+xorLength]
+	shape.AndMask = data[20+xorLength : 20+xorLength+andLength]
+	return shape, nil
+}
+
+// ParseCachedPointer parses the cache index of a cached pointer update
+func ParseCachedPointer(data []byte) (uint16, error) {
+	if len(data) < 2 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return binary.LittleEndian.Uint16(data), nil
+}
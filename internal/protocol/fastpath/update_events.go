@@ -298,7 +298,7 @@ func (d *colorPointerUpdateData) Deserialize(wire io.Reader) error {
 
 	if d.lengthXorMask > 0 {
 		d.xorMaskData = make([]byte, d.lengthXorMask)
-		_, err = wire.Read(d.xorMaskData)
+		_, err = io.ReadFull(wire, d.xorMaskData)
 		if err != nil {
 			return err
 		}
@@ -306,13 +306,17 @@ func (d *colorPointerUpdateData) Deserialize(wire io.Reader) error {
 
 	if d.lengthAndMask > 0 {
 		d.andMaskData = make([]byte, d.lengthAndMask)
-		_, err = wire.Read(d.andMaskData)
+		_, err = io.ReadFull(wire, d.andMaskData)
 		if err != nil {
 			return err
 		}
 	}
 
+	// The pad octet is optional (MS-RDPBCGR 2.2.9.1.1.4.4)
 	var padding uint8
+	if err = binary.Read(wire, binary.LittleEndian, &padding); err != nil && err != io.EOF {
+		return err
+	}
 
-	return binary.Read(wire, binary.LittleEndian, &padding)
+	return nil
 }
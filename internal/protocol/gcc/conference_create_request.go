@@ -39,7 +39,7 @@ func (r *ConferenceCreateRequest) Serialize() []byte {
 	encoding.PerWriteNumberOfSet(1, buf)
 	encoding.PerWriteChoice(0xc0, buf)
 	encoding.PerWriteOctetStream(h221CSKey, 4, buf)
-	encoding.PerWriteOctetStream(string(r.UserData), 0, buf)
+	encoding.PerWriteOctetString(r.UserData, buf)
 
 	return buf.Bytes()
 }
@@ -2,12 +2,21 @@ package gcc
 
 import (
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/rcarmo/go-rdp/internal/protocol/encoding"
 )
 
-type ConferenceCreateResponse struct{}
+// ConferenceCreateResponse is the GCC Conference Create Response carried by
+// the MCS Connect Response (MS-RDPBCGR 2.2.1.4). UserData holds the server
+// data blocks that follow the H.221 "McDn" key.
+type ConferenceCreateResponse struct {
+	NodeID   uint16
+	Tag      int
+	Result   uint8
+	UserData []byte
+}
 
 func (r *ConferenceCreateResponse) Deserialize(wire io.Reader) error {
 	_, err := encoding.PerReadChoice(wire)
@@ -36,17 +45,17 @@ func (r *ConferenceCreateResponse) Deserialize(wire io.Reader) error {
 		return err
 	}
 
-	_, err = encoding.PerReadInteger16(1001, wire)
+	r.NodeID, err = encoding.PerReadInteger16(1001, wire)
 	if err != nil {
 		return err
 	}
 
-	_, err = encoding.PerReadInteger(wire)
+	r.Tag, err = encoding.PerReadInteger(wire)
 	if err != nil {
 		return err
 	}
 
-	_, err = encoding.PerReadEnumerates(wire)
+	r.Result, err = encoding.PerReadEnumerates(wire)
 	if err != nil {
 		return err
 	}
@@ -72,9 +81,8 @@ func (r *ConferenceCreateResponse) Deserialize(wire io.Reader) error {
 		return errors.New("bad H221 SC_KEY")
 	}
 
-	_, err = encoding.PerReadLength(wire)
-	if err != nil {
-		return err
+	if r.UserData, err = encoding.PerReadOctetString(wire); err != nil {
+		return fmt.Errorf("server user data: %w", err)
 	}
 
 	return nil
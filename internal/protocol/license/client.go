@@ -0,0 +1,161 @@
+package license
+
+import (
+	"bytes"
+	"crypto/md5" // #nosec G501 -- used to derive a stable hardware ID, not for security
+	"crypto/rand"
+	"fmt"
+	"io"
+)
+
+// Client runs the client side of licensing. Each server message is passed
+// to Handle, which returns the reply to send, if any, until licensing ends.
+type Client struct {
+	userName    string
+	machineName string
+	hardwareID  [16]byte
+
+	// random supplies the client random and premaster secret
+	random io.Reader
+
+	serverRandom []byte
+	clientRandom []byte
+	keys         *sessionKeys
+	license      *LicenseInfo
+}
+
+// NewClient returns a licensing client that requests licenses for
+// userName on machineName. The hardware ID sent with platform challenge
+// responses is derived from both, so reconnecting clients present the same
+// identity.
+func NewClient(userName, machineName string) *Client {
+	return &Client{
+		userName:    userName,
+		machineName: machineName,
+		hardwareID:  md5.Sum([]byte(machineName + "\x00" + userName)), // #nosec G401
+		random:      rand.Reader,
+	}
+}
+
+// License returns the license the server issued, or nil when licensing
+// ended without one, as it does when the server sends STATUS_VALID_CLIENT.
+func (c *Client) License() *LicenseInfo {
+	return c.license
+}
+
+// Handle processes one licensing message from the server, starting at its
+// preamble. It returns the reply to send, or done once licensing has
+// completed. Error alerts other than STATUS_VALID_CLIENT end licensing with
+// an *Error.
+func (c *Client) Handle(msg []byte) (reply []byte, done bool, err error) {
+	wire := bytes.NewReader(msg)
+
+	var preamble Preamble
+	if err := preamble.Deserialize(wire); err != nil {
+		return nil, false, fmt.Errorf("%w: preamble: %v", ErrMalformed, err)
+	}
+
+	switch preamble.MsgType {
+	case MsgTypeErrorAlert:
+		return nil, true, c.handleErrorAlert(wire)
+	case MsgTypeLicenseRequest:
+		reply, err := c.handleLicenseRequest(wire)
+		return reply, false, err
+	case MsgTypePlatformChallenge:
+		reply, err := c.handlePlatformChallenge(wire)
+		return reply, false, err
+	case MsgTypeNewLicense, MsgTypeUpgradeLicense:
+		c.handleNewLicense(wire)
+		return nil, true, nil
+	default:
+		return nil, false, fmt.Errorf("unknown license msg type: 0x%02X", preamble.MsgType)
+	}
+}
+
+func (c *Client) handleErrorAlert(wire *bytes.Reader) error {
+	var alert ErrorMessage
+	if err := alert.Deserialize(wire); err != nil {
+		return fmt.Errorf("%w: error alert: %v", ErrMalformed, err)
+	}
+	if alert.ErrorCode == StatusValidClient && alert.StateTransition == StateNoTransition {
+		return nil
+	}
+	return &Error{Code: alert.ErrorCode, StateTransition: alert.StateTransition}
+}
+
+func (c *Client) handleLicenseRequest(wire *bytes.Reader) ([]byte, error) {
+	var request Request
+	if err := request.Deserialize(wire); err != nil {
+		return nil, fmt.Errorf("%w: license request: %v", ErrMalformed, err)
+	}
+
+	key, err := publicKey(request.ServerCertificate)
+	if err != nil {
+		return nil, fmt.Errorf("license server key: %w", err)
+	}
+
+	secrets := make([]byte, RandomLength+PreMasterSecretLength)
+	if _, err := io.ReadFull(c.random, secrets); err != nil {
+		return nil, fmt.Errorf("license random: %w", err)
+	}
+	clientRandom, preMasterSecret := secrets[:RandomLength], secrets[RandomLength:]
+
+	c.serverRandom = request.ServerRandom[:]
+	c.clientRandom = clientRandom
+	keys := deriveKeys(preMasterSecret, c.clientRandom, c.serverRandom)
+	c.keys = &keys
+
+	newRequest := NewLicenseRequest{
+		EncryptedPreMasterSecret: encryptPreMasterSecret(key, preMasterSecret),
+		UserName:                 c.userName,
+		MachineName:              c.machineName,
+	}
+	copy(newRequest.ClientRandom[:], clientRandom)
+	return newRequest.Serialize(), nil
+}
+
+func (c *Client) handlePlatformChallenge(wire *bytes.Reader) ([]byte, error) {
+	if c.keys == nil {
+		return nil, fmt.Errorf("%w: platform challenge before license request", ErrMalformed)
+	}
+
+	var challenge PlatformChallenge
+	if err := challenge.Deserialize(wire); err != nil {
+		return nil, fmt.Errorf("%w: platform challenge: %v", ErrMalformed, err)
+	}
+
+	decrypted := c.keys.crypt(challenge.EncryptedChallenge)
+	if c.keys.mac(decrypted) != challenge.MAC {
+		return nil, &Error{Code: CodeInvalidMAC, StateTransition: StateTotalAbort}
+	}
+
+	responseData := platformChallengeResponseData(decrypted)
+	hwid := clientHardwareID(c.hardwareID)
+	response := PlatformChallengeResponse{
+		EncryptedResponse: c.keys.crypt(responseData),
+		EncryptedHWID:     c.keys.crypt(hwid),
+		MAC:               c.keys.mac(append(append([]byte{}, responseData...), hwid...)),
+	}
+	return response.Serialize(), nil
+}
+
+// handleNewLicense keeps the license when it can be decrypted. Licenses the
+// client cannot read still complete licensing: the server has granted
+// access, and the client would only have presented the license again on
+// later connections.
+func (c *Client) handleNewLicense(wire *bytes.Reader) {
+	var license NewLicense
+	if c.keys == nil || license.Deserialize(wire) != nil {
+		return
+	}
+
+	decrypted := c.keys.crypt(license.EncryptedLicenseInfo)
+	if c.keys.mac(decrypted) != license.MAC {
+		return
+	}
+
+	var info LicenseInfo
+	if info.Deserialize(bytes.NewReader(decrypted)) == nil {
+		c.license = &info
+	}
+}
@@ -0,0 +1,249 @@
+package license
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLicenseServer plays the server side of a licensing exchange.
+type fakeLicenseServer struct {
+	t            *testing.T
+	key          *rsa.PrivateKey
+	serverRandom [RandomLength]byte
+	keys         sessionKeys
+}
+
+func newFakeLicenseServer(t *testing.T) *fakeLicenseServer {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	s := &fakeLicenseServer{t: t, key: key}
+	_, _ = rand.Read(s.serverRandom[:])
+	return s
+}
+
+// proprietaryCertificate returns the server certificate with the key in a
+// proprietary certificate.
+func (s *fakeLicenseServer) proprietaryCertificate() []byte {
+	modulus := reversed(s.key.N.Bytes())
+	publicKey := binary.LittleEndian.AppendUint32(nil, 0x31415352) // "RSA1"
+	publicKey = binary.LittleEndian.AppendUint32(publicKey, uint32(len(modulus)+8))
+	publicKey = binary.LittleEndian.AppendUint32(publicKey, uint32(s.key.N.BitLen()))
+	publicKey = binary.LittleEndian.AppendUint32(publicKey, uint32(len(modulus)-1))
+	publicKey = binary.LittleEndian.AppendUint32(publicKey, uint32(s.key.E))
+	publicKey = append(publicKey, modulus...)
+	publicKey = append(publicKey, make([]byte, 8)...)
+
+	cert := binary.LittleEndian.AppendUint32(nil, certChainVersion1|0x80000000)
+	cert = binary.LittleEndian.AppendUint32(cert, 1) // SIGNATURE_ALG_RSA
+	cert = binary.LittleEndian.AppendUint32(cert, 1) // KEY_EXCHANGE_ALG_RSA
+	cert = binary.LittleEndian.AppendUint16(cert, 0x0006)
+	cert = binary.LittleEndian.AppendUint16(cert, uint16(len(publicKey)))
+	cert = append(cert, publicKey...)
+	cert = binary.LittleEndian.AppendUint16(cert, 0x0008)
+	cert = binary.LittleEndian.AppendUint16(cert, 72)
+	return append(cert, make([]byte, 72)...)
+}
+
+// x509Certificate returns the server certificate with the key in the last
+// certificate of an X.509 chain.
+func (s *fakeLicenseServer) x509Certificate() []byte {
+	issuer, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(s.t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "license server"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	root, err := x509.CreateCertificate(rand.Reader, template, template, &issuer.PublicKey, issuer)
+	require.NoError(s.t, err)
+	leaf, err := x509.CreateCertificate(rand.Reader, template, template, &s.key.PublicKey, issuer)
+	require.NoError(s.t, err)
+
+	cert := binary.LittleEndian.AppendUint32(nil, certChainVersion2)
+	cert = binary.LittleEndian.AppendUint32(cert, 2)
+	for _, der := range [][]byte{root, leaf} {
+		cert = binary.LittleEndian.AppendUint32(cert, uint32(len(der)))
+		cert = append(cert, der...)
+	}
+	return append(cert, make([]byte, 8+4*2)...)
+}
+
+func (s *fakeLicenseServer) licenseRequest(certificate []byte) []byte {
+	companyName := []byte("M\x00i\x00c\x00r\x00o\x00s\x00o\x00f\x00t\x00 \x00C\x00o\x00r\x00p\x00o\x00r\x00a\x00t\x00i\x00o\x00n\x00\x00\x00")
+	productID := []byte("A\x000\x002\x00\x00\x00")
+
+	body := append([]byte{}, s.serverRandom[:]...)
+	body = binary.LittleEndian.AppendUint32(body, 0x00060000)
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(companyName)))
+	body = append(body, companyName...)
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(productID)))
+	body = append(body, productID...)
+	body = append(body, (&Blob{Type: BlobKeyExchangeAlg, Data: []byte{0x01, 0x00, 0x00, 0x00}}).Serialize()...)
+	body = append(body, (&Blob{Type: BlobCertificate, Data: certificate}).Serialize()...)
+	body = binary.LittleEndian.AppendUint32(body, 1)
+	body = append(body, (&Blob{Type: BlobScope, Data: []byte("microsoft.com\x00")}).Serialize()...)
+	return message(MsgTypeLicenseRequest, body)
+}
+
+// readNewLicenseRequest decrypts the premaster secret of the client's reply
+// and derives the licensing keys from it.
+func (s *fakeLicenseServer) readNewLicenseRequest(msg []byte) (userName, machineName string) {
+	require.Equal(s.t, MsgTypeNewLicenseRequest, msg[0])
+	wire := bytes.NewReader(msg[4:])
+
+	var header [8]byte
+	_, _ = wire.Read(header[:])
+	assert.Equal(s.t, KeyExchangeAlgRSA, binary.LittleEndian.Uint32(header[:]))
+	assert.Equal(s.t, PlatformID, binary.LittleEndian.Uint32(header[4:]))
+	clientRandom := make([]byte, RandomLength)
+	_, _ = wire.Read(clientRandom)
+
+	var encrypted, user, machine Blob
+	require.NoError(s.t, encrypted.Deserialize(wire))
+	require.NoError(s.t, user.Deserialize(wire))
+	require.NoError(s.t, machine.Deserialize(wire))
+
+	modulusLen := (s.key.N.BitLen() + 7) / 8
+	require.Len(s.t, encrypted.Data, modulusLen+8)
+	assert.Equal(s.t, make([]byte, 8), encrypted.Data[modulusLen:])
+	c := new(big.Int).SetBytes(reversed(encrypted.Data[:modulusLen]))
+	m := new(big.Int).Exp(c, s.key.D, s.key.N)
+	preMasterSecret := make([]byte, PreMasterSecretLength)
+	m.FillBytes(preMasterSecret)
+
+	s.keys = deriveKeys(reversed(preMasterSecret), clientRandom, s.serverRandom[:])
+	return string(bytes.TrimRight(user.Data, "\x00")), string(bytes.TrimRight(machine.Data, "\x00"))
+}
+
+func (s *fakeLicenseServer) platformChallenge(challenge []byte) []byte {
+	body := binary.LittleEndian.AppendUint32(nil, 0)
+	body = append(body, (&Blob{Type: BlobAny, Data: s.keys.crypt(challenge)}).Serialize()...)
+	mac := s.keys.mac(challenge)
+	return message(MsgTypePlatformChallenge, append(body, mac[:]...))
+}
+
+func (s *fakeLicenseServer) readPlatformChallengeResponse(msg []byte) (response, hwid []byte) {
+	require.Equal(s.t, MsgTypePlatformChallengeResponse, msg[0])
+	wire := bytes.NewReader(msg[4:])
+
+	var encryptedResponse, encryptedHWID Blob
+	require.NoError(s.t, encryptedResponse.Deserialize(wire))
+	require.NoError(s.t, encryptedHWID.Deserialize(wire))
+	var mac [16]byte
+	_, _ = wire.Read(mac[:])
+
+	response = s.keys.crypt(encryptedResponse.Data)
+	hwid = s.keys.crypt(encryptedHWID.Data)
+	assert.Equal(s.t, s.keys.mac(append(append([]byte{}, response...), hwid...)), mac)
+	return response, hwid
+}
+
+func (s *fakeLicenseServer) newLicense(license []byte) []byte {
+	info := binary.LittleEndian.AppendUint32(nil, 0x00060000)
+	for _, field := range [][]byte{[]byte("microsoft.com\x00"), []byte("M\x00S\x00\x00\x00"), []byte("A\x000\x002\x00\x00\x00"), license} {
+		info = binary.LittleEndian.AppendUint32(info, uint32(len(field)))
+		info = append(info, field...)
+	}
+	body := (&Blob{Type: BlobEncryptedData, Data: s.keys.crypt(info)}).Serialize()
+	mac := s.keys.mac(info)
+	return message(MsgTypeNewLicense, append(body, mac[:]...))
+}
+
+func TestClient_NewLicenseExchange(t *testing.T) {
+	for _, certificate := range []string{"proprietary", "x509"} {
+		t.Run(certificate, func(t *testing.T) {
+			server := newFakeLicenseServer(t)
+			cert := server.proprietaryCertificate()
+			if certificate == "x509" {
+				cert = server.x509Certificate()
+			}
+			client := NewClient("alice", "WORKSTATION")
+
+			reply, done, err := client.Handle(server.licenseRequest(cert))
+			require.NoError(t, err)
+			require.False(t, done)
+			userName, machineName := server.readNewLicenseRequest(reply)
+			assert.Equal(t, "alice", userName)
+			assert.Equal(t, "WORKSTATION", machineName)
+
+			challenge := []byte("TEST CHALLENGE\x00\x00")
+			reply, done, err = client.Handle(server.platformChallenge(challenge))
+			require.NoError(t, err)
+			require.False(t, done)
+			response, hwid := server.readPlatformChallengeResponse(reply)
+			assert.Equal(t, []byte{0x00, 0x01, 0x00, 0xFF, 0x03, 0x00, 0x10, 0x00}, response[:8])
+			assert.Equal(t, challenge, response[8:])
+			require.Len(t, hwid, 20)
+			assert.Equal(t, PlatformID, binary.LittleEndian.Uint32(hwid))
+
+			reply, done, err = client.Handle(server.newLicense([]byte{0x30, 0x82, 0x01, 0x02}))
+			require.NoError(t, err)
+			assert.True(t, done)
+			assert.Nil(t, reply)
+			require.NotNil(t, client.License())
+			assert.Equal(t, "microsoft.com", client.License().Scope)
+			assert.Equal(t, "MS", client.License().CompanyName)
+			assert.Equal(t, "A02", client.License().ProductID)
+			assert.Equal(t, []byte{0x30, 0x82, 0x01, 0x02}, client.License().License)
+		})
+	}
+}
+
+func TestClient_PlatformChallengeBadMAC(t *testing.T) {
+	server := newFakeLicenseServer(t)
+	client := NewClient("alice", "WORKSTATION")
+	reply, _, err := client.Handle(server.licenseRequest(server.proprietaryCertificate()))
+	require.NoError(t, err)
+	server.readNewLicenseRequest(reply)
+
+	challenge := server.platformChallenge([]byte("TEST CHALLENGE"))
+	challenge[len(challenge)-1] ^= 0xFF
+	_, _, err = client.Handle(challenge)
+	assert.Equal(t, &Error{Code: CodeInvalidMAC, StateTransition: StateTotalAbort}, err)
+}
+
+func TestClient_TamperedLicense(t *testing.T) {
+	server := newFakeLicenseServer(t)
+	client := NewClient("alice", "WORKSTATION")
+	reply, _, err := client.Handle(server.licenseRequest(server.proprietaryCertificate()))
+	require.NoError(t, err)
+	server.readNewLicenseRequest(reply)
+
+	license := server.newLicense([]byte{0x30})
+	license[10] ^= 0xFF
+	_, done, err := client.Handle(license)
+	assert.NoError(t, err, "licenses the client cannot verify still complete licensing")
+	assert.True(t, done)
+	assert.Nil(t, client.License())
+}
+
+func TestClient_HardwareIDIsStable(t *testing.T) {
+	assert.Equal(t, NewClient("alice", "PC").hardwareID, NewClient("alice", "PC").hardwareID)
+	assert.NotEqual(t, NewClient("alice", "PC").hardwareID, NewClient("bob", "PC").hardwareID)
+}
+
+func TestPublicKey_Invalid(t *testing.T) {
+	for name, certificate := range map[string][]byte{
+		"short":         {0x01},
+		"version":       {0x03, 0x00, 0x00, 0x00},
+		"empty chain":   {0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		"bad x509":      {0x02, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x30, 0x00},
+		"proprietary":   {0x01, 0x00, 0x00, 0x80, 0x01, 0x00},
+		"chain overrun": {0x02, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0xFF, 0x00, 0x00, 0x00},
+	} {
+		_, err := publicKey(certificate)
+		assert.ErrorIs(t, err, ErrMalformed, name)
+	}
+}
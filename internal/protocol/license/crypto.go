@@ -0,0 +1,213 @@
+package license
+
+import (
+	"bytes"
+	"crypto/md5" // #nosec G501 -- MS-RDPELE mandates MD5 for key derivation and MACs
+	"crypto/rc4" // #nosec G503 -- MS-RDPELE mandates RC4 for licensing data
+	"crypto/rsa"
+	"crypto/sha1" // #nosec G505 -- MS-RDPELE mandates SHA-1 for key derivation and MACs
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+)
+
+// Server certificate versions (MS-RDPBCGR 2.2.1.4.3.1)
+const (
+	certChainVersion1 uint32 = 0x00000001 // CERT_CHAIN_VERSION_1, proprietary
+	certChainVersion2 uint32 = 0x00000002 // CERT_CHAIN_VERSION_2, X.509
+)
+
+// sessionKeys are the licensing keys both sides derive from the premaster
+// secret and the two randoms (MS-RDPELE 5.1.3).
+type sessionKeys struct {
+	macSalt       []byte
+	encryptionKey []byte
+}
+
+// saltedHash computes SaltedHash(S, I) = MD5(S + SHA1(I + S + R1 + R2)).
+func saltedHash(secret, input, random1, random2 []byte) []byte {
+	inner := sha1.New() // #nosec G401
+	inner.Write(input)
+	inner.Write(secret)
+	inner.Write(random1)
+	inner.Write(random2)
+
+	outer := md5.New() // #nosec G401
+	outer.Write(secret)
+	outer.Write(inner.Sum(nil))
+	return outer.Sum(nil)
+}
+
+// saltedHash48 concatenates the salted hashes of "A", "BB" and "CCC", the
+// construction of both the master secret and the session key blob.
+func saltedHash48(secret, random1, random2 []byte) []byte {
+	out := make([]byte, 0, 48)
+	for _, input := range []string{"A", "BB", "CCC"} {
+		out = append(out, saltedHash(secret, []byte(input), random1, random2)...)
+	}
+	return out
+}
+
+// deriveKeys derives the MAC salt and RC4 key of a licensing exchange.
+func deriveKeys(preMasterSecret, clientRandom, serverRandom []byte) sessionKeys {
+	masterSecret := saltedHash48(preMasterSecret, clientRandom, serverRandom)
+	sessionKeyBlob := saltedHash48(masterSecret, serverRandom, clientRandom)
+
+	final := md5.New() // #nosec G401
+	final.Write(sessionKeyBlob[16:32])
+	final.Write(clientRandom)
+	final.Write(serverRandom)
+
+	return sessionKeys{
+		macSalt:       sessionKeyBlob[:16],
+		encryptionKey: final.Sum(nil),
+	}
+}
+
+// crypt encrypts or decrypts data. Every licensing blob starts a fresh RC4
+// stream with the licensing key.
+func (k sessionKeys) crypt(data []byte) []byte {
+	cipher, _ := rc4.NewCipher(k.encryptionKey) // #nosec G405 -- the key is always 16 bytes
+	out := make([]byte, len(data))
+	cipher.XORKeyStream(out, data)
+	return out
+}
+
+// mac computes the MAC of decrypted data (MS-RDPBCGR 5.3.6.1).
+func (k sessionKeys) mac(data []byte) [16]byte {
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(data))) // #nosec G115 -- licensing data is far below 4 GiB
+
+	inner := sha1.New() // #nosec G401
+	inner.Write(k.macSalt)
+	inner.Write(bytes.Repeat([]byte{0x36}, 40))
+	inner.Write(length[:])
+	inner.Write(data)
+
+	outer := md5.New() // #nosec G401
+	outer.Write(k.macSalt)
+	outer.Write(bytes.Repeat([]byte{0x5C}, 48))
+	outer.Write(inner.Sum(nil))
+
+	var sum [16]byte
+	copy(sum[:], outer.Sum(nil))
+	return sum
+}
+
+// encryptPreMasterSecret encrypts the premaster secret with raw RSA, as RDP
+// does: the little-endian secret is raised to the public exponent and the
+// little-endian result is padded with 8 zero bytes (MS-RDPBCGR 5.3.4.1).
+func encryptPreMasterSecret(key *rsa.PublicKey, secret []byte) []byte {
+	m := new(big.Int).SetBytes(reversed(secret))
+	c := new(big.Int).Exp(m, big.NewInt(int64(key.E)), key.N)
+
+	modulusLen := (key.N.BitLen() + 7) / 8
+	out := make([]byte, modulusLen+8)
+	c.FillBytes(out[:modulusLen])
+	copy(out, reversed(out[:modulusLen]))
+	return out
+}
+
+// reversed returns a reversed copy of b, converting between the
+// little-endian integers of RDP and the big-endian ones of math/big.
+func reversed(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i, v := range b {
+		out[len(b)-1-i] = v
+	}
+	return out
+}
+
+// publicKey extracts the license server's public key from the server
+// certificate of a license request: the RSA key of a proprietary
+// certificate, or of the last certificate in an X.509 chain.
+func publicKey(certificate []byte) (*rsa.PublicKey, error) {
+	if len(certificate) < 4 {
+		return nil, fmt.Errorf("%w: server certificate of %d bytes", ErrMalformed, len(certificate))
+	}
+
+	// The high bit marks temporary certificates
+	switch version := binary.LittleEndian.Uint32(certificate) & 0x7FFFFFFF; version {
+	case certChainVersion1:
+		var cert pdu.ServerProprietaryCertificate
+		if err := cert.Deserialize(bytes.NewReader(certificate[4:])); err != nil {
+			return nil, fmt.Errorf("%w: proprietary certificate: %v", ErrMalformed, err)
+		}
+		key := cert.PublicKeyBlob
+		modulusLen := int(key.BitLen / 8)
+		if key.Magic != 0x31415352 || modulusLen == 0 || modulusLen > len(key.Modulus) { // "RSA1"
+			return nil, fmt.Errorf("%w: invalid proprietary public key", ErrMalformed)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(reversed(key.Modulus[:modulusLen])),
+			E: int(key.PubExp),
+		}, nil
+	case certChainVersion2:
+		return x509ChainPublicKey(bytes.NewReader(certificate[4:]))
+	default:
+		return nil, fmt.Errorf("%w: unknown server certificate version 0x%08X", ErrMalformed, version)
+	}
+}
+
+// x509ChainPublicKey reads the public key of the last certificate of an
+// X.509 certificate chain (MS-RDPBCGR 2.2.1.4.2).
+func x509ChainPublicKey(wire *bytes.Reader) (*rsa.PublicKey, error) {
+	var count uint32
+	if err := binary.Read(wire, binary.LittleEndian, &count); err != nil {
+		return nil, err
+	}
+	if count == 0 || int64(count)*4 > int64(wire.Len()) {
+		return nil, fmt.Errorf("%w: certificate chain of %d certificates", ErrMalformed, count)
+	}
+
+	var last []byte
+	for range count {
+		cert, err := readBytes(wire)
+		if err != nil {
+			return nil, err
+		}
+		last = cert
+	}
+	return certificatePublicKey(last)
+}
+
+// x509Certificate holds the leading fields of an X.509 certificate up to
+// its public key. License server certificates use legacy algorithm OIDs that
+// crypto/x509 does not accept, so only the key is decoded.
+type x509Certificate struct {
+	TBSCertificate struct {
+		Version              int `asn1:"optional,explicit,default:0,tag:0"`
+		SerialNumber         asn1.RawValue
+		Signature            asn1.RawValue
+		Issuer               asn1.RawValue
+		Validity             asn1.RawValue
+		Subject              asn1.RawValue
+		SubjectPublicKeyInfo struct {
+			Algorithm asn1.RawValue
+			PublicKey asn1.BitString
+		}
+	}
+}
+
+// certificatePublicKey decodes the RSA public key of a DER certificate.
+func certificatePublicKey(der []byte) (*rsa.PublicKey, error) {
+	var cert x509Certificate
+	if _, err := asn1.Unmarshal(der, &cert); err != nil {
+		return nil, fmt.Errorf("%w: X.509 certificate: %v", ErrMalformed, err)
+	}
+
+	var key struct {
+		N *big.Int
+		E int
+	}
+	if _, err := asn1.Unmarshal(cert.TBSCertificate.SubjectPublicKeyInfo.PublicKey.RightAlign(), &key); err != nil {
+		return nil, fmt.Errorf("%w: X.509 public key: %v", ErrMalformed, err)
+	}
+	if key.N == nil || key.N.Sign() <= 0 || key.E <= 0 {
+		return nil, fmt.Errorf("%w: invalid X.509 public key", ErrMalformed)
+	}
+	return &rsa.PublicKey{N: key.N, E: key.E}, nil
+}
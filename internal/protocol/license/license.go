@@ -0,0 +1,193 @@
+// Package license implements the client side of RDP licensing (MS-RDPELE):
+// the license request, platform challenge and license messages exchanged
+// after the Client Info PDU, and the error alerts that end them.
+package license
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Message types (MS-RDPBCGR 2.2.1.12.1.1)
+const (
+	MsgTypeLicenseRequest            uint8 = 0x01 // LICENSE_REQUEST
+	MsgTypePlatformChallenge         uint8 = 0x02 // PLATFORM_CHALLENGE
+	MsgTypeNewLicense                uint8 = 0x03 // NEW_LICENSE
+	MsgTypeUpgradeLicense            uint8 = 0x04 // UPGRADE_LICENSE
+	MsgTypeLicenseInfo               uint8 = 0x12 // LICENSE_INFO
+	MsgTypeNewLicenseRequest         uint8 = 0x13 // NEW_LICENSE_REQUEST
+	MsgTypePlatformChallengeResponse uint8 = 0x15 // PLATFORM_CHALLENGE_RESPONSE
+	MsgTypeErrorAlert                uint8 = 0xFF // ERROR_ALERT
+)
+
+// Preamble flags
+const (
+	PreambleVersion3          uint8 = 0x03 // PREAMBLE_VERSION_3_0
+	ExtendedErrorMsgSupported uint8 = 0x80 // EXTENDED_ERROR_MSG_SUPPORTED
+)
+
+// Binary blob types (MS-RDPBCGR 2.2.1.12.1.2)
+const (
+	BlobAny               uint16 = 0x0000 // BB_ANY_BLOB
+	BlobData              uint16 = 0x0001 // BB_DATA_BLOB
+	BlobRandom            uint16 = 0x0002 // BB_RANDOM_BLOB
+	BlobCertificate       uint16 = 0x0003 // BB_CERTIFICATE_BLOB
+	BlobError             uint16 = 0x0004 // BB_ERROR_BLOB
+	BlobEncryptedData     uint16 = 0x0009 // BB_ENCRYPTED_DATA_BLOB
+	BlobKeyExchangeAlg    uint16 = 0x000D // BB_KEY_EXCHG_ALG_BLOB
+	BlobScope             uint16 = 0x000E // BB_SCOPE_BLOB
+	BlobClientUserName    uint16 = 0x000F // BB_CLIENT_USER_NAME_BLOB
+	BlobClientMachineName uint16 = 0x0010 // BB_CLIENT_MACHINE_NAME_BLOB
+)
+
+// Error codes of a licensing error message (MS-RDPBCGR 2.2.1.12.1.3)
+const (
+	CodeInvalidServerCertificate uint32 = 0x00000001 // ERR_INVALID_SERVER_CERTIFICATE
+	CodeNoLicense                uint32 = 0x00000002 // ERR_NO_LICENSE
+	CodeInvalidMAC               uint32 = 0x00000003 // ERR_INVALID_MAC
+	CodeInvalidScope             uint32 = 0x00000004 // ERR_INVALID_SCOPE
+	CodeNoLicenseServer          uint32 = 0x00000006 // ERR_NO_LICENSE_SERVER
+	StatusValidClient            uint32 = 0x00000007 // STATUS_VALID_CLIENT
+	CodeInvalidClient            uint32 = 0x00000008 // ERR_INVALID_CLIENT
+	CodeInvalidProductID         uint32 = 0x0000000B // ERR_INVALID_PRODUCTID
+	CodeInvalidMessageLen        uint32 = 0x0000000C // ERR_INVALID_MESSAGE_LEN
+)
+
+// State transitions of a licensing error message (MS-RDPBCGR 2.2.1.12.1.3)
+const (
+	StateTotalAbort        uint32 = 0x00000001 // ST_TOTAL_ABORT
+	StateNoTransition      uint32 = 0x00000002 // ST_NO_TRANSITION
+	StateResetPhaseToStart uint32 = 0x00000003 // ST_RESET_PHASE_TO_START
+	StateResendLastMessage uint32 = 0x00000004 // ST_RESEND_LAST_MESSAGE
+)
+
+var errorCodeNames = map[uint32]string{
+	CodeInvalidServerCertificate: "invalid server certificate",
+	CodeNoLicense:                "no license",
+	CodeInvalidMAC:               "invalid MAC",
+	CodeInvalidScope:             "invalid scope",
+	CodeNoLicenseServer:          "no license server",
+	StatusValidClient:            "valid client",
+	CodeInvalidClient:            "invalid client",
+	CodeInvalidProductID:         "invalid product ID",
+	CodeInvalidMessageLen:        "invalid message length",
+}
+
+// Error is a licensing error message from the server that ends licensing
+// without a license, such as ERR_NO_LICENSE_SERVER.
+type Error struct {
+	Code            uint32
+	StateTransition uint32
+}
+
+func (e *Error) Error() string {
+	name, ok := errorCodeNames[e.Code]
+	if !ok {
+		name = "unknown error"
+	}
+	return fmt.Sprintf("license error: %s (code 0x%08X, state transition 0x%08X)", name, e.Code, e.StateTransition)
+}
+
+// ErrMalformed is returned for licensing messages that cannot be decoded.
+var ErrMalformed = errors.New("malformed licensing message")
+
+// Preamble represents a LICENSE_PREAMBLE structure (MS-RDPBCGR 2.2.1.12.1.1).
+type Preamble struct {
+	MsgType uint8
+	Flags   uint8
+	MsgSize uint16
+}
+
+// Serialize encodes the preamble to wire format.
+func (p *Preamble) Serialize() []byte {
+	buf := make([]byte, 4)
+	buf[0] = p.MsgType
+	buf[1] = p.Flags
+	binary.LittleEndian.PutUint16(buf[2:], p.MsgSize)
+	return buf
+}
+
+// Deserialize decodes the preamble from wire format.
+func (p *Preamble) Deserialize(wire io.Reader) error {
+	if err := binary.Read(wire, binary.LittleEndian, &p.MsgType); err != nil {
+		return err
+	}
+	if err := binary.Read(wire, binary.LittleEndian, &p.Flags); err != nil {
+		return err
+	}
+	return binary.Read(wire, binary.LittleEndian, &p.MsgSize)
+}
+
+// Blob represents a LICENSE_BINARY_BLOB structure (MS-RDPBCGR 2.2.1.12.1.2).
+type Blob struct {
+	Type uint16
+	Data []byte
+}
+
+// Serialize encodes the blob to wire format.
+func (b *Blob) Serialize() []byte {
+	buf := make([]byte, 4, 4+len(b.Data))
+	binary.LittleEndian.PutUint16(buf, b.Type)
+	binary.LittleEndian.PutUint16(buf[2:], uint16(len(b.Data))) // #nosec G115 -- licensing blobs are far below 64 KiB
+	return append(buf, b.Data...)
+}
+
+// Deserialize decodes the blob from wire format.
+func (b *Blob) Deserialize(wire io.Reader) error {
+	var length uint16
+	if err := binary.Read(wire, binary.LittleEndian, &b.Type); err != nil {
+		return err
+	}
+	if err := binary.Read(wire, binary.LittleEndian, &length); err != nil {
+		return err
+	}
+	b.Data = make([]byte, length)
+	_, err := io.ReadFull(wire, b.Data)
+	return err
+}
+
+// ErrorMessage represents a LICENSE_ERROR_MESSAGE structure (MS-RDPBCGR 2.2.1.12.1.3).
+type ErrorMessage struct {
+	ErrorCode       uint32
+	StateTransition uint32
+	ErrorInfo       Blob
+}
+
+// Deserialize decodes the error message from wire format.
+func (m *ErrorMessage) Deserialize(wire io.Reader) error {
+	if err := binary.Read(wire, binary.LittleEndian, &m.ErrorCode); err != nil {
+		return err
+	}
+	if err := binary.Read(wire, binary.LittleEndian, &m.StateTransition); err != nil {
+		return err
+	}
+	return m.ErrorInfo.Deserialize(wire)
+}
+
+// message frames a client message body with its preamble.
+func message(msgType uint8, body []byte) []byte {
+	preamble := Preamble{
+		MsgType: msgType,
+		Flags:   PreambleVersion3 | ExtendedErrorMsgSupported,
+		MsgSize: uint16(4 + len(body)), // #nosec G115 -- client messages are a few hundred bytes
+	}
+	return append(preamble.Serialize(), body...)
+}
+
+// readBytes reads a field prefixed with its 32-bit length, such as the
+// company name of a product info structure.
+func readBytes(wire *bytes.Reader) ([]byte, error) {
+	var length uint32
+	if err := binary.Read(wire, binary.LittleEndian, &length); err != nil {
+		return nil, err
+	}
+	if int64(length) > int64(wire.Len()) {
+		return nil, fmt.Errorf("%w: field of %d bytes exceeds message", ErrMalformed, length)
+	}
+	data := make([]byte, length)
+	_, err := io.ReadFull(wire, data)
+	return data, err
+}
@@ -0,0 +1,137 @@
+package license
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Error alerts as Windows Server sends them, after the security header
+var (
+	windowsValidClient = []byte{
+		0xFF, 0x03, 0x10, 0x00, // ERROR_ALERT, PREAMBLE_VERSION_3_0, 16 bytes
+		0x07, 0x00, 0x00, 0x00, // STATUS_VALID_CLIENT
+		0x02, 0x00, 0x00, 0x00, // ST_NO_TRANSITION
+		0x04, 0x00, 0x00, 0x00, // BB_ERROR_BLOB, empty
+	}
+	windowsNoLicenseServer = []byte{
+		0xFF, 0x83, 0x10, 0x00, // ERROR_ALERT, EXTENDED_ERROR_MSG_SUPPORTED
+		0x06, 0x00, 0x00, 0x00, // ERR_NO_LICENSE_SERVER
+		0x02, 0x00, 0x00, 0x00, // ST_NO_TRANSITION
+		0x04, 0x00, 0x00, 0x00,
+	}
+	windowsInvalidClient = []byte{
+		0xFF, 0x83, 0x10, 0x00,
+		0x08, 0x00, 0x00, 0x00, // ERR_INVALID_CLIENT
+		0x01, 0x00, 0x00, 0x00, // ST_TOTAL_ABORT
+		0x04, 0x00, 0x00, 0x00,
+	}
+)
+
+func TestClient_ErrorAlerts(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     []byte
+		wantErr *Error
+	}{
+		{name: "valid client", msg: windowsValidClient},
+		{name: "no license server", msg: windowsNoLicenseServer, wantErr: &Error{Code: CodeNoLicenseServer, StateTransition: StateNoTransition}},
+		{name: "invalid client", msg: windowsInvalidClient, wantErr: &Error{Code: CodeInvalidClient, StateTransition: StateTotalAbort}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply, done, err := NewClient("user", "host").Handle(tt.msg)
+			assert.True(t, done)
+			assert.Nil(t, reply)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var licenseErr *Error
+			require.True(t, errors.As(err, &licenseErr))
+			assert.Equal(t, tt.wantErr, licenseErr)
+		})
+	}
+}
+
+func TestClient_ValidClientWithTransition(t *testing.T) {
+	msg := bytes.Clone(windowsValidClient)
+	msg[8] = byte(StateResetPhaseToStart)
+
+	_, done, err := NewClient("user", "host").Handle(msg)
+	assert.True(t, done)
+	assert.EqualError(t, err, "license error: valid client (code 0x00000007, state transition 0x00000003)")
+}
+
+func TestClient_Malformed(t *testing.T) {
+	client := NewClient("user", "host")
+
+	_, _, err := client.Handle([]byte{0xFF, 0x03})
+	assert.ErrorIs(t, err, ErrMalformed)
+
+	_, _, err = client.Handle(windowsValidClient[:10])
+	assert.ErrorIs(t, err, ErrMalformed)
+
+	// A platform challenge needs the keys of a license request
+	_, _, err = client.Handle([]byte{0x02, 0x03, 0x04, 0x00})
+	assert.ErrorIs(t, err, ErrMalformed)
+
+	_, _, err = client.Handle([]byte{0x42, 0x03, 0x04, 0x00})
+	assert.EqualError(t, err, "unknown license msg type: 0x42")
+}
+
+func TestClient_UnreadableLicense(t *testing.T) {
+	// Without a license request the client cannot decrypt the license, but
+	// the server has still granted access
+	reply, done, err := NewClient("user", "host").Handle([]byte{0x03, 0x03, 0x0C, 0x00, 0x09, 0x00, 0x04, 0x00, 0xDE, 0xAD, 0xBE, 0xEF})
+	assert.NoError(t, err)
+	assert.True(t, done)
+	assert.Nil(t, reply)
+}
+
+func TestBlob_RoundTrip(t *testing.T) {
+	blob := Blob{Type: BlobScope, Data: []byte("microsoft.com\x00")}
+	var decoded Blob
+	require.NoError(t, decoded.Deserialize(bytes.NewReader(blob.Serialize())))
+	assert.Equal(t, blob, decoded)
+
+	assert.Error(t, decoded.Deserialize(bytes.NewReader([]byte{0x0E, 0x00, 0x10, 0x00, 0x01})))
+}
+
+func TestNewLicenseRequest_Serialize(t *testing.T) {
+	request := NewLicenseRequest{
+		EncryptedPreMasterSecret: []byte{0xAA, 0xBB},
+		UserName:                 "alice",
+		MachineName:              "PC",
+	}
+	request.ClientRandom[0] = 0x11
+
+	data := request.Serialize()
+	assert.Equal(t, []byte{0x13, 0x83}, data[:2])
+	assert.Equal(t, len(data), int(data[2])|int(data[3])<<8)
+	assert.Equal(t, []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x04, 0x11}, data[4:13])
+
+	wire := bytes.NewReader(data[4+8+RandomLength:])
+	for _, want := range []Blob{
+		{Type: BlobRandom, Data: []byte{0xAA, 0xBB}},
+		{Type: BlobClientUserName, Data: []byte("alice\x00")},
+		{Type: BlobClientMachineName, Data: []byte("PC\x00")},
+	} {
+		var blob Blob
+		require.NoError(t, blob.Deserialize(wire))
+		assert.Equal(t, want, blob)
+	}
+	assert.Zero(t, wire.Len())
+}
+
+func TestError_Error(t *testing.T) {
+	err := &Error{Code: CodeNoLicenseServer, StateTransition: StateNoTransition}
+	assert.Equal(t, "license error: no license server (code 0x00000006, state transition 0x00000002)", err.Error())
+
+	err = &Error{Code: 0x99, StateTransition: StateTotalAbort}
+	assert.Contains(t, err.Error(), "unknown error")
+}
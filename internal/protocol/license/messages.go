@@ -0,0 +1,251 @@
+package license
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unicode/utf16"
+)
+
+// RandomLength is the size of the client and server randoms.
+const RandomLength = 32
+
+// PreMasterSecretLength is the size of the premaster secret the client
+// encrypts with the server's public key.
+const PreMasterSecretLength = 48
+
+// KeyExchangeAlgRSA KEY_EXCHANGE_ALG_RSA is the only key exchange algorithm.
+const KeyExchangeAlgRSA uint32 = 0x00000001
+
+// PlatformID identifies the client operating system and licensing software
+// to the license server: CLIENT_OS_ID_WINNT_POST_52 with
+// CLIENT_IMAGE_ID_MICROSOFT, as Windows clients send.
+const PlatformID uint32 = 0x04000000 | 0x00010000
+
+// Platform challenge response constants (MS-RDPELE 2.2.2.5.1)
+const (
+	platformChallengeResponseVersion uint16 = 0x0100 // PLATFORM_CHALLENGE_RESPONSE_VERSION
+	otherPlatformChallengeType       uint16 = 0xFF00 // OTHER_PLATFORM_CHALLENGE_TYPE
+	licenseDetailDetail              uint16 = 0x0003 // LICENSE_DETAIL_DETAIL
+)
+
+// ProductInfo represents a PRODUCT_INFO structure (MS-RDPELE 2.2.2.1.1).
+type ProductInfo struct {
+	Version     uint32
+	CompanyName string
+	ProductID   string
+}
+
+// Request represents a Server License Request (MS-RDPELE 2.2.2.1), the
+// first message of licensing when the server wants the client to obtain a
+// license.
+type Request struct {
+	ServerRandom      [RandomLength]byte
+	ProductInfo       ProductInfo
+	KeyExchangeList   []uint32
+	ServerCertificate []byte
+	Scopes            []string
+}
+
+// Deserialize decodes the request body, after the preamble.
+func (r *Request) Deserialize(wire *bytes.Reader) error {
+	if _, err := io.ReadFull(wire, r.ServerRandom[:]); err != nil {
+		return err
+	}
+
+	if err := binary.Read(wire, binary.LittleEndian, &r.ProductInfo.Version); err != nil {
+		return err
+	}
+	companyName, err := readBytes(wire)
+	if err != nil {
+		return err
+	}
+	productID, err := readBytes(wire)
+	if err != nil {
+		return err
+	}
+	r.ProductInfo.CompanyName = decodeUTF16(companyName)
+	r.ProductInfo.ProductID = decodeUTF16(productID)
+
+	var keyExchange Blob
+	if err := keyExchange.Deserialize(wire); err != nil {
+		return err
+	}
+	r.KeyExchangeList = nil
+	for i := 0; i+4 <= len(keyExchange.Data); i += 4 {
+		r.KeyExchangeList = append(r.KeyExchangeList, binary.LittleEndian.Uint32(keyExchange.Data[i:]))
+	}
+
+	var certificate Blob
+	if err := certificate.Deserialize(wire); err != nil {
+		return err
+	}
+	r.ServerCertificate = certificate.Data
+
+	var scopeCount uint32
+	if err := binary.Read(wire, binary.LittleEndian, &scopeCount); err != nil {
+		return err
+	}
+	// Each scope takes at least a blob header
+	if int64(scopeCount)*4 > int64(wire.Len()) {
+		return fmt.Errorf("%w: %d scopes exceed message", ErrMalformed, scopeCount)
+	}
+	r.Scopes = make([]string, 0, scopeCount)
+	for range scopeCount {
+		var scope Blob
+		if err := scope.Deserialize(wire); err != nil {
+			return err
+		}
+		r.Scopes = append(r.Scopes, string(bytes.TrimRight(scope.Data, "\x00")))
+	}
+	return nil
+}
+
+// NewLicenseRequest represents a Client New License Request (MS-RDPELE
+// 2.2.2.2), asking the server for a license.
+type NewLicenseRequest struct {
+	ClientRandom             [RandomLength]byte
+	EncryptedPreMasterSecret []byte
+	UserName                 string
+	MachineName              string
+}
+
+// Serialize encodes the request with its preamble.
+func (r *NewLicenseRequest) Serialize() []byte {
+	body := binary.LittleEndian.AppendUint32(nil, KeyExchangeAlgRSA)
+	body = binary.LittleEndian.AppendUint32(body, PlatformID)
+	body = append(body, r.ClientRandom[:]...)
+	body = append(body, (&Blob{Type: BlobRandom, Data: r.EncryptedPreMasterSecret}).Serialize()...)
+	body = append(body, (&Blob{Type: BlobClientUserName, Data: nullTerminated(r.UserName)}).Serialize()...)
+	body = append(body, (&Blob{Type: BlobClientMachineName, Data: nullTerminated(r.MachineName)}).Serialize()...)
+	return message(MsgTypeNewLicenseRequest, body)
+}
+
+// PlatformChallenge represents a Server Platform Challenge (MS-RDPELE
+// 2.2.2.4).
+type PlatformChallenge struct {
+	ConnectFlags       uint32
+	EncryptedChallenge []byte
+	MAC                [16]byte
+}
+
+// Deserialize decodes the challenge body, after the preamble.
+func (c *PlatformChallenge) Deserialize(wire *bytes.Reader) error {
+	if err := binary.Read(wire, binary.LittleEndian, &c.ConnectFlags); err != nil {
+		return err
+	}
+	var challenge Blob
+	if err := challenge.Deserialize(wire); err != nil {
+		return err
+	}
+	c.EncryptedChallenge = challenge.Data
+	_, err := io.ReadFull(wire, c.MAC[:])
+	return err
+}
+
+// PlatformChallengeResponse represents a Client Platform Challenge
+// Response (MS-RDPELE 2.2.2.5).
+type PlatformChallengeResponse struct {
+	EncryptedResponse []byte
+	EncryptedHWID     []byte
+	MAC               [16]byte
+}
+
+// Serialize encodes the response with its preamble.
+func (r *PlatformChallengeResponse) Serialize() []byte {
+	body := (&Blob{Type: BlobEncryptedData, Data: r.EncryptedResponse}).Serialize()
+	body = append(body, (&Blob{Type: BlobEncryptedData, Data: r.EncryptedHWID}).Serialize()...)
+	body = append(body, r.MAC[:]...)
+	return message(MsgTypePlatformChallengeResponse, body)
+}
+
+// platformChallengeResponseData encodes a PLATFORM_CHALLENGE_RESPONSE_DATA
+// structure answering challenge (MS-RDPELE 2.2.2.5.1).
+func platformChallengeResponseData(challenge []byte) []byte {
+	data := binary.LittleEndian.AppendUint16(nil, platformChallengeResponseVersion)
+	data = binary.LittleEndian.AppendUint16(data, otherPlatformChallengeType)
+	data = binary.LittleEndian.AppendUint16(data, licenseDetailDetail)
+	data = binary.LittleEndian.AppendUint16(data, uint16(len(challenge))) // #nosec G115 -- read from a 16-bit blob length
+	return append(data, challenge...)
+}
+
+// clientHardwareID encodes a CLIENT_HARDWARE_ID structure (MS-RDPELE
+// 2.2.2.5.2).
+func clientHardwareID(hwid [16]byte) []byte {
+	return append(binary.LittleEndian.AppendUint32(nil, PlatformID), hwid[:]...)
+}
+
+// NewLicense represents a Server New License or Server Upgrade License
+// (MS-RDPELE 2.2.2.6, 2.2.2.7), which carry the same structure.
+type NewLicense struct {
+	EncryptedLicenseInfo []byte
+	MAC                  [16]byte
+}
+
+// Deserialize decodes the license body, after the preamble.
+func (l *NewLicense) Deserialize(wire *bytes.Reader) error {
+	var info Blob
+	if err := info.Deserialize(wire); err != nil {
+		return err
+	}
+	l.EncryptedLicenseInfo = info.Data
+	_, err := io.ReadFull(wire, l.MAC[:])
+	return err
+}
+
+// LicenseInfo represents a NEW_LICENSE_INFO structure (MS-RDPELE
+// 2.2.2.6.1), the decrypted content of a new license.
+type LicenseInfo struct {
+	Version     uint32
+	Scope       string
+	CompanyName string
+	ProductID   string
+	// License is the license itself, an X.509 certificate chain the client
+	// presents in later connections
+	License []byte
+}
+
+// Deserialize decodes the license info.
+func (i *LicenseInfo) Deserialize(wire *bytes.Reader) error {
+	if err := binary.Read(wire, binary.LittleEndian, &i.Version); err != nil {
+		return err
+	}
+	scope, err := readBytes(wire)
+	if err != nil {
+		return err
+	}
+	companyName, err := readBytes(wire)
+	if err != nil {
+		return err
+	}
+	productID, err := readBytes(wire)
+	if err != nil {
+		return err
+	}
+	if i.License, err = readBytes(wire); err != nil {
+		return err
+	}
+	i.Scope = string(bytes.TrimRight(scope, "\x00"))
+	i.CompanyName = decodeUTF16(companyName)
+	i.ProductID = decodeUTF16(productID)
+	return nil
+}
+
+// nullTerminated returns s as a null-terminated ANSI string.
+func nullTerminated(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+// decodeUTF16 decodes a null-terminated UTF-16LE string.
+func decodeUTF16(data []byte) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		unit := binary.LittleEndian.Uint16(data[i:])
+		if unit == 0 {
+			break
+		}
+		units = append(units, unit)
+	}
+	return string(utf16.Decode(units))
+}
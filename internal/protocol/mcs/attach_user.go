@@ -14,12 +14,22 @@ func (pdu *ClientAttachUserRequest) Serialize() []byte {
 	return nil
 }
 
+// attachUserConfirmInitiator is set in the choice byte of an Attach User
+// Confirm when the optional initiator field is present (T.125, section 7)
+const attachUserConfirmInitiator uint8 = 0x02
+
 type ServerAttachUserConfirm struct {
 	Result    uint8
 	Initiator uint16
 }
 
 func (pdu *ServerAttachUserConfirm) Deserialize(wire io.Reader) error {
+	return pdu.deserialize(wire, true)
+}
+
+// deserialize reads the confirm, leaving Initiator zero when the server
+// omitted it, as it does when the attach fails
+func (pdu *ServerAttachUserConfirm) deserialize(wire io.Reader, hasInitiator bool) error {
 	var err error
 
 	pdu.Result, err = encoding.PerReadEnumerates(wire)
@@ -27,6 +37,10 @@ func (pdu *ServerAttachUserConfirm) Deserialize(wire io.Reader) error {
 		return err
 	}
 
+	if !hasInitiator {
+		return nil
+	}
+
 	pdu.Initiator, err = encoding.PerReadInteger16(1001, wire)
 	if err != nil {
 		return err
@@ -55,9 +69,19 @@ func (p *Protocol) AttachUser() (uint16, error) {
 		return 0, fmt.Errorf("server MCS attach user confirm reponse: %w", err)
 	}
 
-	if resp.ServerAttachUserConfirm.Result != RTSuccessful {
-		return 0, fmt.Errorf("unsuccessful MCS attach user; result=%d", resp.ServerAttachUserConfirm.Result)
+	if resp.ServerAttachUserConfirm == nil {
+		return 0, fmt.Errorf("%w: expected attach user confirm, got application=%v", ErrAttachUserFailed, resp.Application)
+	}
+
+	confirm := resp.ServerAttachUserConfirm
+	if confirm.Result != RTSuccessful {
+		return 0, fmt.Errorf("%w: server returned %s (result=%d)", ErrAttachUserFailed, resultName(confirm.Result), confirm.Result)
+	}
+
+	if confirm.Initiator == 0 {
+		return 0, fmt.Errorf("%w: confirm carried no user ID", ErrAttachUserFailed)
 	}
 
-	return resp.ServerAttachUserConfirm.Initiator, nil
+	p.channels.set(UserChannelName, confirm.Initiator)
+	return confirm.Initiator, nil
 }
@@ -35,3 +35,13 @@ func TestServerMCSAttachUserConfirmPDU_Deserialize(t *testing.T) {
 	require.NoError(t, actual.Deserialize(input))
 	require.Equal(t, expected, actual)
 }
+
+func TestServerMCSAttachUserConfirmPDU_DeserializeWithoutInitiator(t *testing.T) {
+	var actual DomainPDU
+
+	input := bytes.NewBuffer([]byte{0x2c, RTUserRejected})
+
+	require.NoError(t, actual.Deserialize(input))
+	require.Equal(t, &ServerAttachUserConfirm{Result: RTUserRejected}, actual.ServerAttachUserConfirm)
+	require.Zero(t, input.Len(), "initiator should not be read when absent")
+}
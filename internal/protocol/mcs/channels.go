@@ -0,0 +1,94 @@
+package mcs
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// Names of the MCS channels that are not static virtual channels
+const (
+	GlobalChannelName  = "global"
+	UserChannelName    = "user"
+	MessageChannelName = "message"
+)
+
+// AssignChannelIDs maps each requested static virtual channel name to the ID
+// the server assigned at the same position of the Server Network Data
+// (MS-RDPBCGR 2.2.1.4.4), and GlobalChannelName to the I/O channel ID. Names
+// the server assigned no ID to are left out.
+func AssignChannelIDs(names []string, globalID uint16, ids []uint16) map[string]uint16 {
+	channelIDs := make(map[string]uint16, len(names)+1)
+	for i, name := range names {
+		if i < len(ids) {
+			channelIDs[name] = ids[i]
+		}
+	}
+	channelIDs[GlobalChannelName] = globalID
+	return channelIDs
+}
+
+// channelRegistry holds the channel IDs assigned to a connection. Virtual
+// channel handlers read it concurrently with the connection sequence.
+type channelRegistry struct {
+	mu  sync.RWMutex
+	ids map[string]uint16
+}
+
+func (r *channelRegistry) set(name string, id uint16) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ids == nil {
+		r.ids = make(map[string]uint16)
+	}
+	r.ids[name] = id
+}
+
+// SetChannels records the channel IDs the server assigned in its network
+// data, for the static virtual channel names requested in the same order.
+func (p *Protocol) SetChannels(names []string, globalID uint16, ids []uint16) {
+	for name, id := range AssignChannelIDs(names, globalID, ids) {
+		p.channels.set(name, id)
+	}
+}
+
+// SetChannel records the ID of a channel outside the network data, such as
+// the message channel, so that JoinChannels joins it too.
+func (p *Protocol) SetChannel(name string, id uint16) {
+	p.channels.set(name, id)
+}
+
+// ChannelID returns the ID assigned to the named channel.
+func (p *Protocol) ChannelID(name string) (uint16, bool) {
+	p.channels.mu.RLock()
+	defer p.channels.mu.RUnlock()
+	id, ok := p.channels.ids[name]
+	return id, ok
+}
+
+// ChannelIDs returns a copy of the channel name to ID map, including
+// GlobalChannelName and, once attached, UserChannelName.
+func (p *Protocol) ChannelIDs() map[string]uint16 {
+	p.channels.mu.RLock()
+	defer p.channels.mu.RUnlock()
+	return maps.Clone(p.channels.ids)
+}
+
+// SendToChannel sends data on the named channel.
+func (p *Protocol) SendToChannel(userID uint16, name string, data []byte) error {
+	channelID, ok := p.ChannelID(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrChannelNotFound, name)
+	}
+	return p.Send(userID, channelID, data)
+}
+
+// joinOrder returns the assigned channels sorted by ID, so channels are
+// joined in the order the server assigned them.
+func (p *Protocol) joinOrder() []string {
+	channelIDs := p.ChannelIDs()
+	return slices.SortedFunc(maps.Keys(channelIDs), func(a, b string) int {
+		return int(channelIDs[a]) - int(channelIDs[b])
+	})
+}
@@ -213,5 +213,9 @@ func (p *Protocol) Connect(userData []byte) (io.Reader, error) {
 		return nil, fmt.Errorf("unsuccessful MCS connect initial; result=%d", resp.ServerConnectResponse.Result)
 	}
 
-	return wire, nil
+	if resp.ServerConnectResponse.UserData.Result != 0 {
+		return nil, fmt.Errorf("unsuccessful GCC conference create; result=%d", resp.ServerConnectResponse.UserData.Result)
+	}
+
+	return bytes.NewReader(resp.ServerConnectResponse.UserData.UserData), nil
 }
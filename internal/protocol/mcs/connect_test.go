@@ -77,28 +77,7 @@ func TestClientMCSConnectInitialPDU_Serialize(t *testing.T) {
 // TestServerMCSConnectResponsePDU_Deserialize from MS-RDPBCGR protocol examples 4.1.4.
 // without TPKT and X224 headers
 func TestServerMCSConnectResponsePDU_Deserialize(t *testing.T) {
-	var actual ConnectPDU
-
-	expected := ConnectPDU{
-		Application: connectResponse,
-		ServerConnectResponse: &ServerConnectResponse{
-			Result:          0,
-			calledConnectId: 0,
-			DomainParameters: domainParameters{
-				maxChannelIds:   34,
-				maxUserIds:      3,
-				maxTokenIds:     0,
-				numPriorities:   1,
-				minThroughput:   0,
-				maxHeight:       1,
-				maxMCSPDUsize:   65528,
-				protocolVersion: 2,
-			},
-			UserData: gcc.ConferenceCreateResponse{},
-		},
-	}
-
-	input := bytes.NewBuffer([]byte{
+	raw := []byte{
 		0x7f, 0x66, 0x82, 0x01, 0x45, 0x0a, 0x01, 0x00, 0x02,
 		0x01, 0x00, 0x30, 0x1a, 0x02, 0x01, 0x22, 0x02, 0x01, 0x03, 0x02, 0x01, 0x00, 0x02, 0x01, 0x01,
 		0x02, 0x01, 0x00, 0x02, 0x01, 0x01, 0x02, 0x03, 0x00, 0xff, 0xf8, 0x02, 0x01, 0x02, 0x04, 0x82,
@@ -121,8 +100,33 @@ func TestServerMCSConnectResponsePDU_Deserialize(t *testing.T) {
 		0x69, 0x21, 0x89, 0x0e, 0x1d, 0xc0, 0x4c, 0x1a, 0xa8, 0xaa, 0x71, 0x3e, 0x0f, 0x54, 0xb9, 0x9a,
 		0xe4, 0x99, 0x68, 0x3f, 0x6c, 0xd6, 0x76, 0x84, 0x61, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
 		0x00,
-	})
+	}
 
-	require.NoError(t, actual.Deserialize(input))
+	expected := ConnectPDU{
+		Application: connectResponse,
+		ServerConnectResponse: &ServerConnectResponse{
+			Result:          0,
+			calledConnectId: 0,
+			DomainParameters: domainParameters{
+				maxChannelIds:   34,
+				maxUserIds:      3,
+				maxTokenIds:     0,
+				numPriorities:   1,
+				minThroughput:   0,
+				maxHeight:       1,
+				maxMCSPDUsize:   65528,
+				protocolVersion: 2,
+			},
+			UserData: gcc.ConferenceCreateResponse{
+				NodeID:   31219,
+				Tag:      1,
+				Result:   0,
+				UserData: raw[len(raw)-264:],
+			},
+		},
+	}
+
+	var actual ConnectPDU
+	require.NoError(t, actual.Deserialize(bytes.NewBuffer(raw)))
 	require.Equal(t, expected, actual)
 }
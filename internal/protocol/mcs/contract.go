@@ -20,6 +20,12 @@ type MCSLayer interface {
 	ErectDomain() error
 	// AttachUser attaches user to MCS
 	AttachUser() (uint16, error)
-	// JoinChannels joins MCS channels
-	JoinChannels(userID uint16, channelIDMap map[string]uint16) error
+	// SetChannels records the channel IDs assigned in the server network data
+	SetChannels(names []string, globalID uint16, ids []uint16)
+	// SetChannel records the ID of a channel outside the network data
+	SetChannel(name string, id uint16)
+	// JoinChannels joins every assigned channel
+	JoinChannels(userID uint16) error
+	// Disconnect sends a Disconnect Provider Ultimatum with an RN* reason
+	Disconnect(reason uint8) error
 }
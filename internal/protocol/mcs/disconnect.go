@@ -4,18 +4,25 @@ import (
 	"fmt"
 )
 
-type ClientDisconnectUltimatumRequest struct{}
+// ClientDisconnectUltimatumRequest is the MCS Disconnect Provider Ultimatum
+// the client sends to end the session (T.125 DisconnectProviderUltimatum)
+type ClientDisconnectUltimatumRequest struct {
+	Reason uint8 // One of the RN* reason codes
+}
 
 func (pdu *ClientDisconnectUltimatumRequest) Serialize() []byte {
-	// per aligned RNUserRequested
+	// per aligned: the choice byte carries the application in its top six bits
+	// and the first two bits of the 3-bit reason; the last reason bit leads
+	// the next byte
 	return []byte{
-		0x21,
-		0x80,
+		byte(disconnectProviderUltimatum<<2) | (pdu.Reason>>1)&0x03,
+		(pdu.Reason & 0x01) << 7,
 	}
 }
 
-func (p *Protocol) Disconnect() error {
-	req := ClientDisconnectUltimatumRequest{}
+// Disconnect sends a Disconnect Provider Ultimatum with the given reason
+func (p *Protocol) Disconnect(reason uint8) error {
+	req := ClientDisconnectUltimatumRequest{Reason: reason}
 
 	if err := p.x224Conn.Send(req.Serialize()); err != nil {
 		return fmt.Errorf("client MCS disconnect ultimatum: %w", err)
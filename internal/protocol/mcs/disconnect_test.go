@@ -7,10 +7,19 @@ import (
 )
 
 func TestClientDisconnectUltimatumRequest_Serialize(t *testing.T) {
-	req := &ClientDisconnectUltimatumRequest{}
+	testCases := []struct {
+		reason   uint8
+		expected []byte
+	}{
+		{RNDomainDisconnected, []byte{0x20, 0x00}},
+		{RNProviderInitiated, []byte{0x20, 0x80}},
+		{RNTokenPurged, []byte{0x21, 0x00}},
+		{RNUserRequested, []byte{0x21, 0x80}},
+		{RNChannelPurged, []byte{0x22, 0x00}},
+	}
 
-	expected := []byte{0x21, 0x80}
-	actual := req.Serialize()
-
-	require.Equal(t, expected, actual)
+	for _, tc := range testCases {
+		req := &ClientDisconnectUltimatumRequest{Reason: tc.reason}
+		require.Equal(t, tc.expected, req.Serialize(), "reason %d", tc.reason)
+	}
 }
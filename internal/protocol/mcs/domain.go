@@ -108,7 +108,7 @@ func (pdu *DomainPDU) Deserialize(wire io.Reader) error {
 	case attachUserConfirm:
 		pdu.ServerAttachUserConfirm = &ServerAttachUserConfirm{}
 
-		return pdu.ServerAttachUserConfirm.Deserialize(wire)
+		return pdu.ServerAttachUserConfirm.deserialize(wire, application&attachUserConfirmInitiator != 0)
 	case channelJoinConfirm:
 		pdu.ServerChannelJoinConfirm = &ServerChannelJoinConfirm{}
 
@@ -1,6 +1,9 @@
 package mcs
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrChannelNotFound           = errors.New("channel not found")
@@ -8,4 +11,46 @@ var (
 	ErrUnknownDomainApplication  = errors.New("unknown domain application")
 	ErrUnknownChannel            = errors.New("unknown channel")
 	ErrDisconnectUltimatum       = errors.New("disconnect ultimatum")
+	ErrAttachUserFailed          = errors.New("MCS attach user failed")
 )
+
+// ErrChannelJoinRejected is returned by JoinChannels when the server
+// confirms a channel join with a result other than rt-successful.
+type ErrChannelJoinRejected struct {
+	ChannelID   uint16
+	ChannelName string
+	Reason      uint8 // T.125 result, such as RTNoSuchChannel
+}
+
+func (e *ErrChannelJoinRejected) Error() string {
+	return fmt.Sprintf("MCS channel join rejected for channel=%s (%d): %s (result=%d)",
+		e.ChannelName, e.ChannelID, resultName(e.Reason), e.Reason)
+}
+
+// Optional reports whether the rejected channel is a static virtual channel,
+// which the session can do without, rather than the I/O or user channel.
+func (e *ErrChannelJoinRejected) Optional() bool {
+	return e.ChannelName != GlobalChannelName && e.ChannelName != UserChannelName
+}
+
+// OptionalJoinRejections returns the rejections err from JoinChannels
+// consists of when they are all for optional channels, and false when err
+// is nil or carries any other failure.
+func OptionalJoinRejections(err error) ([]*ErrChannelJoinRejected, bool) {
+	if err == nil {
+		return nil, false
+	}
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	rejections := make([]*ErrChannelJoinRejected, 0, len(errs))
+	for _, e := range errs {
+		var rejected *ErrChannelJoinRejected
+		if !errors.As(e, &rejected) || !rejected.Optional() {
+			return nil, false
+		}
+		rejections = append(rejections, rejected)
+	}
+	return rejections, true
+}
@@ -38,6 +38,11 @@ func TestErrors(t *testing.T) {
 			err:  ErrDisconnectUltimatum,
 			msg:  "disconnect ultimatum",
 		},
+		{
+			name: "ErrAttachUserFailed",
+			err:  ErrAttachUserFailed,
+			msg:  "MCS attach user failed",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -60,12 +60,15 @@ func (pdu *ServerChannelJoinConfirm) Deserialize(wire io.Reader) error {
 	return nil
 }
 
-func (p *Protocol) JoinChannels(userID uint16, channelIDMap map[string]uint16) error {
-	if len(channelIDMap) == 0 {
-		return nil
-	}
-
-	for channelName, channelID := range channelIDMap {
+// JoinChannels joins every channel recorded by SetChannels and AttachUser,
+// in channel ID order. A rejected join of the I/O or user channel ends it
+// with an *ErrChannelJoinRejected; rejected static virtual channels are
+// skipped and their *ErrChannelJoinRejected errors returned joined once the
+// other channels are joined, for the caller to drop them.
+func (p *Protocol) JoinChannels(userID uint16) error {
+	var rejected []error
+	for _, channelName := range p.joinOrder() {
+		channelID, _ := p.ChannelID(channelName)
 		req := DomainPDU{
 			Application: channelJoinRequest,
 			ClientChannelJoinRequest: &ClientChannelJoinRequest{
@@ -87,15 +90,18 @@ func (p *Protocol) JoinChannels(userID uint16, channelIDMap map[string]uint16) e
 		if err = resp.Deserialize(wire); err != nil {
 			return fmt.Errorf("server MCS channel join confirm reponse: %w", err)
 		}
+		if resp.ServerChannelJoinConfirm == nil {
+			return fmt.Errorf("server MCS channel join confirm for channel=%s: got application=%v", channelName, resp.Application)
+		}
 
-		if resp.ServerChannelJoinConfirm.Result != RTSuccessful {
-			return fmt.Errorf(
-				"unsuccessful MCS channel join confirm for channel=%s; result=%d",
-				channelName,
-				resp.ServerChannelJoinConfirm.Result,
-			)
+		if result := resp.ServerChannelJoinConfirm.Result; result != RTSuccessful {
+			err := &ErrChannelJoinRejected{ChannelID: channelID, ChannelName: channelName, Reason: result}
+			if !err.Optional() {
+				return err
+			}
+			rejected = append(rejected, err)
 		}
 	}
 
-	return nil
+	return errors.Join(rejected...)
 }
@@ -2,6 +2,8 @@ package mcs
 
 import (
 	"bytes"
+	"errors"
+	"io"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -137,3 +139,62 @@ func TestServerMCSChannelJoinConfirmPDU_Deserialize(t *testing.T) {
 		})
 	}
 }
+
+func TestJoinChannels_Rejected(t *testing.T) {
+	confirm := func(result uint8, channelID uint16) io.Reader {
+		return bytes.NewBuffer([]byte{0x3e, result, 0x00, 0x06, byte(channelID >> 8), byte(channelID), byte(channelID >> 8), byte(channelID)})
+	}
+	newProtocol := func(replies ...io.Reader) (*Protocol, *multiReceiveMock) {
+		mock := &multiReceiveMock{receiveData: replies}
+		p := &Protocol{x224Conn: mock}
+		p.SetChannels([]string{"rdpdr", "cliprdr"}, 1003, []uint16{1004, 1005})
+		p.SetChannel(UserChannelName, 1007)
+		return p, mock
+	}
+
+	t.Run("optional channels are skipped", func(t *testing.T) {
+		p, mock := newProtocol(
+			confirm(RTSuccessful, 1003),
+			// Rejections may leave out the optional channel ID
+			bytes.NewBuffer([]byte{0x3c, RTNoSuchChannel, 0x00, 0x06, 0x03, 0xec}),
+			confirm(RTTooManyChannels, 1005),
+			confirm(RTSuccessful, 1007),
+		)
+
+		err := p.JoinChannels(1007)
+		require.Error(t, err)
+		require.Equal(t, 4, mock.sendCount, "the user channel is joined after the rejections")
+
+		var rejected *ErrChannelJoinRejected
+		require.True(t, errors.As(err, &rejected))
+		require.Equal(t, &ErrChannelJoinRejected{ChannelID: 1004, ChannelName: "rdpdr", Reason: RTNoSuchChannel}, rejected)
+		require.Contains(t, err.Error(), "rt-no-such-channel")
+
+		rejections, ok := OptionalJoinRejections(err)
+		require.True(t, ok)
+		require.Len(t, rejections, 2)
+		require.Equal(t, "cliprdr", rejections[1].ChannelName)
+		require.Equal(t, RTTooManyChannels, rejections[1].Reason)
+	})
+
+	t.Run("core channel is fatal", func(t *testing.T) {
+		p, mock := newProtocol(confirm(RTNotAdmitted, 1003))
+
+		err := p.JoinChannels(1007)
+		var rejected *ErrChannelJoinRejected
+		require.True(t, errors.As(err, &rejected))
+		require.Equal(t, GlobalChannelName, rejected.ChannelName)
+		require.False(t, rejected.Optional())
+		require.Equal(t, 1, mock.sendCount)
+
+		_, ok := OptionalJoinRejections(err)
+		require.False(t, ok)
+	})
+
+	t.Run("other errors are not rejections", func(t *testing.T) {
+		_, ok := OptionalJoinRejections(nil)
+		require.False(t, ok)
+		_, ok = OptionalJoinRejections(errors.Join(&ErrChannelJoinRejected{ChannelName: "rdpdr"}, io.EOF))
+		require.False(t, ok)
+	})
+}
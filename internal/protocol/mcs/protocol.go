@@ -6,6 +6,7 @@ import "github.com/rcarmo/go-rdp/internal/protocol/x224"
 
 type Protocol struct {
 	x224Conn x224Conn
+	channels channelRegistry
 }
 
 func New(x224Conn *x224.Protocol) *Protocol {
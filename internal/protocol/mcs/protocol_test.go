@@ -7,6 +7,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
 )
 
 // mockX224Conn implements x224Conn interface for testing
@@ -182,6 +184,7 @@ func TestProtocol_AttachUser(t *testing.T) {
 		receiveErr    error
 		wantInitiator uint16
 		wantErr       bool
+		wantFailure   string
 	}{
 		{
 			name:          "successful attach user",
@@ -208,6 +211,24 @@ func TestProtocol_AttachUser(t *testing.T) {
 			receiveData: []byte{0x2e, 0x00}, // truncated
 			wantErr:     true,
 		},
+		{
+			name:        "rejected without initiator",
+			receiveData: []byte{0x2c, RTTooManyUsers},
+			wantErr:     true,
+			wantFailure: "rt-too-many-users",
+		},
+		{
+			name:        "successful without initiator",
+			receiveData: []byte{0x2c, 0x00},
+			wantErr:     true,
+			wantFailure: "no user ID",
+		},
+		{
+			name:        "unexpected application",
+			receiveData: []byte{0x3e, 0x00, 0x00, 0x06, 0x03, 0xeb, 0x03, 0xeb}, // channel join confirm
+			wantErr:     true,
+			wantFailure: "expected attach user confirm",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -223,6 +244,10 @@ func TestProtocol_AttachUser(t *testing.T) {
 
 			if tc.wantErr {
 				require.Error(t, err)
+				if tc.wantFailure != "" {
+					require.ErrorIs(t, err, ErrAttachUserFailed)
+					require.ErrorContains(t, err, tc.wantFailure)
+				}
 				return
 			}
 
@@ -291,9 +316,9 @@ func TestProtocol_JoinChannels(t *testing.T) {
 				"rdpdr":  1004,
 			},
 			receiveData: []io.Reader{
-				bytes.NewBuffer([]byte{0x3e, 0x00, 0x00, 0x06, 0x03, 0xef, 0x03, 0xef}),
 				bytes.NewBuffer([]byte{0x3e, 0x00, 0x00, 0x06, 0x03, 0xeb, 0x03, 0xeb}),
 				bytes.NewBuffer([]byte{0x3e, 0x00, 0x00, 0x06, 0x03, 0xec, 0x03, 0xec}),
+				bytes.NewBuffer([]byte{0x3e, 0x00, 0x00, 0x06, 0x03, 0xef, 0x03, 0xef}),
 			},
 		},
 		{
@@ -327,8 +352,11 @@ func TestProtocol_JoinChannels(t *testing.T) {
 				receiveErrs: tc.receiveErrs,
 			}
 			p := &Protocol{x224Conn: mock}
+			for name, id := range tc.channelMap {
+				p.channels.set(name, id)
+			}
 
-			err := p.JoinChannels(1007, tc.channelMap)
+			err := p.JoinChannels(1007)
 
 			if tc.wantErr {
 				require.Error(t, err)
@@ -336,10 +364,61 @@ func TestProtocol_JoinChannels(t *testing.T) {
 			}
 
 			require.NoError(t, err)
+			require.Equal(t, len(tc.channelMap), mock.sendCount)
 		})
 	}
 }
 
+func TestProtocol_ChannelIDs(t *testing.T) {
+	p := newWithConn(&mockX224Conn{
+		receiveData: bytes.NewBuffer([]byte{0x2e, 0x00, 0x00, 0x06}), // attach user confirm, user 1007
+	})
+	p.SetChannels([]string{"rdpdr", "rdpsnd", "cliprdr", "drdynvc"}, 1003, []uint16{1004, 1005, 1006})
+
+	userID, err := p.AttachUser()
+	require.NoError(t, err)
+	require.Equal(t, uint16(1007), userID)
+
+	require.Equal(t, map[string]uint16{
+		GlobalChannelName: 1003,
+		UserChannelName:   1007,
+		"rdpdr":           1004,
+		"rdpsnd":          1005,
+		"cliprdr":         1006,
+	}, p.ChannelIDs())
+
+	id, ok := p.ChannelID("cliprdr")
+	require.True(t, ok)
+	require.Equal(t, uint16(1006), id)
+	_, ok = p.ChannelID("drdynvc")
+	require.False(t, ok, "the server assigned no ID to the fourth channel")
+
+	require.Equal(t, []string{GlobalChannelName, "rdpdr", "rdpsnd", "cliprdr", UserChannelName}, p.joinOrder())
+}
+
+func TestProtocol_SetChannel(t *testing.T) {
+	p := newWithConn(&mockX224Conn{})
+	p.SetChannels([]string{"rdpsnd"}, 1003, []uint16{1004})
+	p.SetChannel(MessageChannelName, 1010)
+
+	id, ok := p.ChannelID(MessageChannelName)
+	require.True(t, ok)
+	require.Equal(t, uint16(1010), id)
+	require.Equal(t, []string{GlobalChannelName, "rdpsnd", MessageChannelName}, p.joinOrder())
+}
+
+func TestProtocol_SendToChannel(t *testing.T) {
+	mock := &mockX224Conn{}
+	p := newWithConn(mock)
+	p.SetChannels([]string{"cliprdr"}, 1003, []uint16{1004})
+
+	require.NoError(t, p.SendToChannel(1007, "cliprdr", []byte{0xAA}))
+	require.Equal(t, []byte{0x64, 0x00, 0x06, 0x03, 0xec, 0x70, 0x01, 0xAA}, mock.sendData)
+
+	err := p.SendToChannel(1007, "rdpsnd", []byte{0xAA})
+	require.ErrorIs(t, err, ErrChannelNotFound)
+}
+
 func TestProtocol_Disconnect(t *testing.T) {
 	testCases := []struct {
 		name    string
@@ -361,7 +440,7 @@ func TestProtocol_Disconnect(t *testing.T) {
 			mock := &mockX224Conn{sendErr: tc.sendErr}
 			p := newWithConn(mock)
 
-			err := p.Disconnect()
+			err := p.Disconnect(RNUserRequested)
 
 			if tc.wantErr {
 				require.Error(t, err)
@@ -375,38 +454,47 @@ func TestProtocol_Disconnect(t *testing.T) {
 	}
 }
 
+// capturedConnectResponse is the MCS Connect Response of MS-RDPBCGR 4.1.4
+// without TPKT and X224 headers
+var capturedConnectResponse = []byte{
+	0x7f, 0x66, 0x82, 0x01, 0x45, 0x0a, 0x01, 0x00, 0x02,
+	0x01, 0x00, 0x30, 0x1a, 0x02, 0x01, 0x22, 0x02, 0x01, 0x03, 0x02, 0x01, 0x00, 0x02, 0x01, 0x01,
+	0x02, 0x01, 0x00, 0x02, 0x01, 0x01, 0x02, 0x03, 0x00, 0xff, 0xf8, 0x02, 0x01, 0x02, 0x04, 0x82,
+	0x01, 0x1f, 0x00, 0x05, 0x00, 0x14, 0x7c, 0x00, 0x01, 0x2a, 0x14, 0x76, 0x0a, 0x01, 0x01, 0x00,
+	0x01, 0xc0, 0x00, 0x4d, 0x63, 0x44, 0x6e, 0x81, 0x08, 0x01, 0x0c, 0x0c, 0x00, 0x04, 0x00, 0x08,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x03, 0x0c, 0x10, 0x00, 0xeb, 0x03, 0x03, 0x00, 0xec, 0x03, 0xed,
+	0x03, 0xee, 0x03, 0x00, 0x00, 0x02, 0x0c, 0xec, 0x00, 0x02, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00,
+	0x00, 0x20, 0x00, 0x00, 0x00, 0xb8, 0x00, 0x00, 0x00, 0x10, 0x11, 0x77, 0x20, 0x30, 0x61, 0x0a,
+	0x12, 0xe4, 0x34, 0xa1, 0x1e, 0xf2, 0xc3, 0x9f, 0x31, 0x7d, 0xa4, 0x5f, 0x01, 0x89, 0x34, 0x96,
+	0xe0, 0xff, 0x11, 0x08, 0x69, 0x7f, 0x1a, 0xc3, 0xd2, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00,
+	0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x00, 0x5c, 0x00, 0x52, 0x53, 0x41, 0x31, 0x48, 0x00, 0x00,
+	0x00, 0x00, 0x02, 0x00, 0x00, 0x3f, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0xcb, 0x81, 0xfe,
+	0xba, 0x6d, 0x61, 0xc3, 0x55, 0x05, 0xd5, 0x5f, 0x2e, 0x87, 0xf8, 0x71, 0x94, 0xd6, 0xf1, 0xa5,
+	0xcb, 0xf1, 0x5f, 0x0c, 0x3d, 0xf8, 0x70, 0x02, 0x96, 0xc4, 0xfb, 0x9b, 0xc8, 0x3c, 0x2d, 0x55,
+	0xae, 0xe8, 0xff, 0x32, 0x75, 0xea, 0x68, 0x79, 0xe5, 0xa2, 0x01, 0xfd, 0x31, 0xa0, 0xb1, 0x1f,
+	0x55, 0xa6, 0x1f, 0xc1, 0xf6, 0xd1, 0x83, 0x88, 0x63, 0x26, 0x56, 0x12, 0xbc, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x08, 0x00, 0x48, 0x00, 0xe9, 0xe1, 0xd6, 0x28, 0x46, 0x8b, 0x4e,
+	0xf5, 0x0a, 0xdf, 0xfd, 0xee, 0x21, 0x99, 0xac, 0xb4, 0xe1, 0x8f, 0x5f, 0x81, 0x57, 0x82, 0xef,
+	0x9d, 0x96, 0x52, 0x63, 0x27, 0x18, 0x29, 0xdb, 0xb3, 0x4a, 0xfd, 0x9a, 0xda, 0x42, 0xad, 0xb5,
+	0x69, 0x21, 0x89, 0x0e, 0x1d, 0xc0, 0x4c, 0x1a, 0xa8, 0xaa, 0x71, 0x3e, 0x0f, 0x54, 0xb9, 0x9a,
+	0xe4, 0x99, 0x68, 0x3f, 0x6c, 0xd6, 0x76, 0x84, 0x61, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00,
+}
+
 func TestProtocol_Connect(t *testing.T) {
-	// Build a valid MCS connect response
-	validConnectResponse := []byte{
-		0x7f, 0x66, 0x82, 0x01, 0x45, 0x0a, 0x01, 0x00, 0x02,
-		0x01, 0x00, 0x30, 0x1a, 0x02, 0x01, 0x22, 0x02, 0x01, 0x03, 0x02, 0x01, 0x00, 0x02, 0x01, 0x01,
-		0x02, 0x01, 0x00, 0x02, 0x01, 0x01, 0x02, 0x03, 0x00, 0xff, 0xf8, 0x02, 0x01, 0x02, 0x04, 0x82,
-		0x01, 0x1f, 0x00, 0x05, 0x00, 0x14, 0x7c, 0x00, 0x01, 0x2a, 0x14, 0x76, 0x0a, 0x01, 0x01, 0x00,
-		0x01, 0xc0, 0x00, 0x4d, 0x63, 0x44, 0x6e, 0x81, 0x08, 0x01, 0x0c, 0x0c, 0x00, 0x04, 0x00, 0x08,
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x03, 0x0c, 0x10, 0x00, 0xeb, 0x03, 0x03, 0x00, 0xec, 0x03, 0xed,
-		0x03, 0xee, 0x03, 0x00, 0x00, 0x02, 0x0c, 0xec, 0x00, 0x02, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00,
-		0x00, 0x20, 0x00, 0x00, 0x00, 0xb8, 0x00, 0x00, 0x00, 0x10, 0x11, 0x77, 0x20, 0x30, 0x61, 0x0a,
-		0x12, 0xe4, 0x34, 0xa1, 0x1e, 0xf2, 0xc3, 0x9f, 0x31, 0x7d, 0xa4, 0x5f, 0x01, 0x89, 0x34, 0x96,
-		0xe0, 0xff, 0x11, 0x08, 0x69, 0x7f, 0x1a, 0xc3, 0xd2, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00,
-		0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x00, 0x5c, 0x00, 0x52, 0x53, 0x41, 0x31, 0x48, 0x00, 0x00,
-		0x00, 0x00, 0x02, 0x00, 0x00, 0x3f, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0xcb, 0x81, 0xfe,
-		0xba, 0x6d, 0x61, 0xc3, 0x55, 0x05, 0xd5, 0x5f, 0x2e, 0x87, 0xf8, 0x71, 0x94, 0xd6, 0xf1, 0xa5,
-		0xcb, 0xf1, 0x5f, 0x0c, 0x3d, 0xf8, 0x70, 0x02, 0x96, 0xc4, 0xfb, 0x9b, 0xc8, 0x3c, 0x2d, 0x55,
-		0xae, 0xe8, 0xff, 0x32, 0x75, 0xea, 0x68, 0x79, 0xe5, 0xa2, 0x01, 0xfd, 0x31, 0xa0, 0xb1, 0x1f,
-		0x55, 0xa6, 0x1f, 0xc1, 0xf6, 0xd1, 0x83, 0x88, 0x63, 0x26, 0x56, 0x12, 0xbc, 0x00, 0x00, 0x00,
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x08, 0x00, 0x48, 0x00, 0xe9, 0xe1, 0xd6, 0x28, 0x46, 0x8b, 0x4e,
-		0xf5, 0x0a, 0xdf, 0xfd, 0xee, 0x21, 0x99, 0xac, 0xb4, 0xe1, 0x8f, 0x5f, 0x81, 0x57, 0x82, 0xef,
-		0x9d, 0x96, 0x52, 0x63, 0x27, 0x18, 0x29, 0xdb, 0xb3, 0x4a, 0xfd, 0x9a, 0xda, 0x42, 0xad, 0xb5,
-		0x69, 0x21, 0x89, 0x0e, 0x1d, 0xc0, 0x4c, 0x1a, 0xa8, 0xaa, 0x71, 0x3e, 0x0f, 0x54, 0xb9, 0x9a,
-		0xe4, 0x99, 0x68, 0x3f, 0x6c, 0xd6, 0x76, 0x84, 0x61, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
-		0x00,
-	}
+
+	validConnectResponse := capturedConnectResponse
 
 	// Build an unsuccessful connect response (Result = 1)
 	unsuccessfulResponse := make([]byte, len(validConnectResponse))
 	copy(unsuccessfulResponse, validConnectResponse)
 	unsuccessfulResponse[7] = 0x01 // Change result from 0 to 1 (position is: 7f 66 82 01 45 0a 01 [00])
 
+	// Build a response whose GCC result is userRejected (follows 76 0a 01 01)
+	rejectedConferenceResponse := make([]byte, len(validConnectResponse))
+	copy(rejectedConferenceResponse, validConnectResponse)
+	rejectedConferenceResponse[56] = 0x01
+
 	testCases := []struct {
 		name        string
 		userData    []byte
@@ -438,6 +526,12 @@ func TestProtocol_Connect(t *testing.T) {
 			receiveData: unsuccessfulResponse,
 			wantErr:     true,
 		},
+		{
+			name:        "unsuccessful conference create",
+			userData:    []byte{0x01, 0x02, 0x03},
+			receiveData: rejectedConferenceResponse,
+			wantErr:     true,
+		},
 		{
 			name:        "malformed response",
 			userData:    []byte{0x01, 0x02, 0x03},
@@ -467,6 +561,34 @@ func TestProtocol_Connect(t *testing.T) {
 	}
 }
 
+func TestProtocol_Connect_CapturedServerData(t *testing.T) {
+	p := newWithConn(&mockX224Conn{receiveData: bytes.NewBuffer(capturedConnectResponse)})
+
+	wire, err := p.Connect([]byte{0x01, 0x02, 0x03})
+	require.NoError(t, err)
+
+	userData, err := io.ReadAll(wire)
+	require.NoError(t, err)
+	require.Equal(t, capturedConnectResponse[len(capturedConnectResponse)-264:], userData)
+
+	var serverData pdu.ServerUserData
+	require.NoError(t, serverData.Deserialize(bytes.NewReader(userData)))
+
+	require.NotNil(t, serverData.ServerCoreData)
+	require.Equal(t, uint32(0x00080004), serverData.ServerCoreData.Version)
+
+	require.NotNil(t, serverData.ServerNetworkData)
+	require.Equal(t, uint16(1003), serverData.ServerNetworkData.MCSChannelId)
+	require.Equal(t, []uint16{1004, 1005, 1006}, serverData.ServerNetworkData.ChannelIdArray)
+
+	require.NotNil(t, serverData.ServerSecurityData)
+	require.Equal(t, uint32(2), serverData.ServerSecurityData.EncryptionMethod)
+	require.Equal(t, uint32(2), serverData.ServerSecurityData.EncryptionLevel)
+	require.Len(t, serverData.ServerSecurityData.ServerRandom, 32)
+
+	require.Nil(t, serverData.ServerMessageChannelData)
+}
+
 func TestDomainPDUApplication_Values(t *testing.T) {
 	// Test all DomainPDUApplication constants
 	require.Equal(t, DomainPDUApplication(0), plumbDomainIndication)
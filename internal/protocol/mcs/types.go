@@ -26,6 +26,34 @@ const (
 	RTUserRejected
 )
 
+// resultNames holds the T.125 names of the Result values, indexed by value
+var resultNames = [...]string{
+	"rt-successful",
+	"rt-domain-merging",
+	"rt-domain-not-hierarchical",
+	"rt-no-such-channel",
+	"rt-no-such-domain",
+	"rt-no-such-user",
+	"rt-not-admitted",
+	"rt-other-user-id",
+	"rt-parameters-unacceptable",
+	"rt-token-not-available",
+	"rt-token-not-possessed",
+	"rt-too-many-channels",
+	"rt-too-many-tokens",
+	"rt-too-many-users",
+	"rt-unspecified-failure",
+	"rt-user-rejected",
+}
+
+// resultName returns the T.125 name of an MCS result
+func resultName(result uint8) string {
+	if int(result) < len(resultNames) {
+		return resultNames[result]
+	}
+	return "unknown result"
+}
+
 const (
 	RNDomainDisconnected uint8 = iota
 	RNProviderInitiated
@@ -0,0 +1,498 @@
+// Package orders decodes the most common drawing orders (MS-RDPEGDI
+// 2.2.2): the OpaqueRect, ScrBlt and MemBlt primary orders and the Cache
+// Bitmap (Revision 2) secondary orders that MemBlt draws from.
+package orders
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrMalformedOrder is returned when an order runs past the end of its data
+	ErrMalformedOrder = errors.New("malformed drawing order")
+
+	// ErrUnsupportedOrder is returned for an order whose length cannot be
+	// determined, so the orders after it cannot be read
+	ErrUnsupportedOrder = errors.New("unsupported drawing order")
+)
+
+// Control flags of a drawing order (MS-RDPEGDI 2.2.2.2.1.1.2)
+const (
+	flagStandard          = 0x01
+	flagSecondary         = 0x02
+	flagBounds            = 0x04
+	flagTypeChange        = 0x08
+	flagDeltaCoordinates  = 0x10
+	flagZeroBoundsDeltas  = 0x20
+	flagZeroFieldByteBit0 = 0x40
+	flagZeroFieldByteBit1 = 0x80
+)
+
+// Primary order types (MS-RDPEGDI 2.2.2.2.1.1.2)
+const (
+	TypePatBlt     uint8 = 0x01
+	TypeScrBlt     uint8 = 0x02
+	TypeOpaqueRect uint8 = 0x0A
+	TypeMemBlt     uint8 = 0x0D
+)
+
+// Secondary order types (MS-RDPEGDI 2.2.2.2.1.2.1.1)
+const (
+	TypeCacheBitmapUncompressedRev2 uint8 = 0x04
+	TypeCacheBitmapCompressedRev2   uint8 = 0x05
+)
+
+// Cache Bitmap (Revision 2) flags, stored in bits 7-15 of extraFlags
+const (
+	cbr2HeightSameAsWidth      = 0x01
+	cbr2PersistentKeyPresent   = 0x02
+	cbr2NoBitmapCompressionHdr = 0x08
+	cbr2DoNotCache             = 0x10
+)
+
+// WaitingListIndex is the cache index used by bitmaps sent with
+// CBR2_DO_NOT_CACHE (MS-RDPEGDI 2.2.2.2.1.2.3)
+const WaitingListIndex uint16 = 0x7FFF
+
+// Number of field flag bytes of each supported primary order
+const (
+	scrBltFieldBytes     = 1
+	opaqueRectFieldBytes = 1
+	memBltFieldBytes     = 2
+)
+
+// Rect is an inclusive bounding rectangle
+type Rect struct {
+	Left, Top, Right, Bottom int16
+}
+
+// OpaqueRect fills a rectangle with a solid color
+// (MS-RDPEGDI 2.2.2.2.1.1.2.5)
+type OpaqueRect struct {
+	Left   int16
+	Top    int16
+	Width  int16
+	Height int16
+
+	// Color holds the red, green and blue bytes of the order. At 8 bpp the
+	// first is a palette index; at 15 and 16 bpp the first two are the
+	// little-endian color and the third is unused.
+	Color [3]uint8
+
+	// Bounds clips the order when not nil
+	Bounds *Rect
+}
+
+// ScrBlt copies a rectangle of the screen to another position
+// (MS-RDPEGDI 2.2.2.2.1.1.2.7)
+type ScrBlt struct {
+	Left   int16
+	Top    int16
+	Width  int16
+	Height int16
+	Rop    uint8
+	SrcX   int16
+	SrcY   int16
+
+	// Bounds clips the order when not nil
+	Bounds *Rect
+}
+
+// MemBlt draws part of a cached bitmap (MS-RDPEGDI 2.2.2.2.1.1.2.9)
+type MemBlt struct {
+	CacheID    uint8
+	ColorIndex uint8
+	Left       int16
+	Top        int16
+	Width      int16
+	Height     int16
+	Rop        uint8
+	SrcX       int16
+	SrcY       int16
+	CacheIndex uint16
+
+	// Bounds clips the order when not nil
+	Bounds *Rect
+}
+
+// CacheBitmapRev2 stores a bitmap in a cell of the bitmap cache
+// (MS-RDPEGDI 2.2.2.2.1.2.3)
+type CacheBitmapRev2 struct {
+	CacheID      uint8
+	BitsPerPixel int
+	Width        int
+	Height       int
+	CacheIndex   uint16
+	Compressed   bool
+
+	// NoCompressionHeader is set when compressed data is not preceded by a
+	// TS_CD_HEADER, which for 32 bpp means RDP 6.0 planar data
+	NoCompressionHeader bool
+
+	// Data is the bitmap data without any compression header
+	Data []byte
+}
+
+// Handler receives the orders a Decoder understands
+type Handler interface {
+	CacheBitmap(order *CacheBitmapRev2)
+	OpaqueRect(order *OpaqueRect)
+	ScrBlt(order *ScrBlt)
+	MemBlt(order *MemBlt)
+}
+
+// Decoder reads drawing orders. Primary orders are delta-encoded against the
+// previous order, so one Decoder must see every order of a connection.
+type Decoder struct {
+	orderType  uint8
+	bounds     Rect
+	opaqueRect OpaqueRect
+	scrBlt     ScrBlt
+	memBlt     MemBlt
+}
+
+// NewDecoder creates a Decoder in the initial state of a connection
+func NewDecoder() *Decoder {
+	return &Decoder{orderType: TypePatBlt}
+}
+
+// Decode reads count orders from data and passes those it understands to h.
+// Other secondary orders are skipped; any other order stops decoding with
+// ErrUnsupportedOrder, since its length is unknown.
+func (d *Decoder) Decode(data []byte, count int, h Handler) error {
+	r := &reader{data: data}
+	for i := 0; i < count; i++ {
+		controlFlags := r.u8()
+		if r.err != nil {
+			return r.err
+		}
+
+		var err error
+		switch {
+		case controlFlags&flagStandard == 0 && controlFlags&flagSecondary != 0:
+			err = fmt.Errorf("%w: alternate secondary order 0x%02X", ErrUnsupportedOrder, controlFlags>>2)
+		case controlFlags&flagStandard == 0:
+			err = fmt.Errorf("%w: control flags 0x%02X", ErrMalformedOrder, controlFlags)
+		case controlFlags&flagSecondary != 0:
+			err = d.decodeSecondary(r, h)
+		default:
+			err = d.decodePrimary(r, controlFlags, h)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) decodeSecondary(r *reader, h Handler) error {
+	orderLength := r.u16()
+	extraFlags := r.u16()
+	orderType := r.u8()
+	// orderLength is the order length minus 13, and 6 bytes are already read
+	body := r.take(int(int16(orderLength)) + 7)
+	if r.err != nil {
+		return r.err
+	}
+
+	switch orderType {
+	case TypeCacheBitmapUncompressedRev2, TypeCacheBitmapCompressedRev2:
+		order, err := parseCacheBitmapRev2(body, extraFlags, orderType == TypeCacheBitmapCompressedRev2)
+		if err != nil {
+			return err
+		}
+		h.CacheBitmap(order)
+	}
+	return nil
+}
+
+func (d *Decoder) decodePrimary(r *reader, controlFlags uint8, h Handler) error {
+	if controlFlags&flagTypeChange != 0 {
+		d.orderType = r.u8()
+	}
+
+	var fieldBytes int
+	switch d.orderType {
+	case TypeOpaqueRect:
+		fieldBytes = opaqueRectFieldBytes
+	case TypeScrBlt:
+		fieldBytes = scrBltFieldBytes
+	case TypeMemBlt:
+		fieldBytes = memBltFieldBytes
+	default:
+		return fmt.Errorf("%w: primary order 0x%02X", ErrUnsupportedOrder, d.orderType)
+	}
+
+	fieldFlags := r.fieldFlags(fieldBytes, controlFlags)
+	if controlFlags&flagBounds != 0 && controlFlags&flagZeroBoundsDeltas == 0 {
+		d.readBounds(r)
+	}
+
+	var bounds *Rect
+	if controlFlags&flagBounds != 0 {
+		saved := d.bounds
+		bounds = &saved
+	}
+
+	delta := controlFlags&flagDeltaCoordinates != 0
+	switch d.orderType {
+	case TypeOpaqueRect:
+		d.decodeOpaqueRect(r, fieldFlags, delta)
+		if r.err != nil {
+			return r.err
+		}
+		order := d.opaqueRect
+		order.Bounds = bounds
+		h.OpaqueRect(&order)
+	case TypeScrBlt:
+		d.decodeScrBlt(r, fieldFlags, delta)
+		if r.err != nil {
+			return r.err
+		}
+		order := d.scrBlt
+		order.Bounds = bounds
+		h.ScrBlt(&order)
+	case TypeMemBlt:
+		d.decodeMemBlt(r, fieldFlags, delta)
+		if r.err != nil {
+			return r.err
+		}
+		order := d.memBlt
+		order.Bounds = bounds
+		h.MemBlt(&order)
+	}
+	return nil
+}
+
+// decodeOpaqueRect updates the saved OpaqueRect fields
+func (d *Decoder) decodeOpaqueRect(r *reader, fieldFlags uint32, delta bool) {
+	o := &d.opaqueRect
+	if fieldFlags&0x01 != 0 {
+		o.Left = r.coord(delta, o.Left)
+	}
+	if fieldFlags&0x02 != 0 {
+		o.Top = r.coord(delta, o.Top)
+	}
+	if fieldFlags&0x04 != 0 {
+		o.Width = r.coord(delta, o.Width)
+	}
+	if fieldFlags&0x08 != 0 {
+		o.Height = r.coord(delta, o.Height)
+	}
+	// Each color byte is a separate field
+	for i := range o.Color {
+		if fieldFlags&(0x10<<i) != 0 {
+			o.Color[i] = r.u8()
+		}
+	}
+}
+
+// decodeScrBlt updates the saved ScrBlt fields
+func (d *Decoder) decodeScrBlt(r *reader, fieldFlags uint32, delta bool) {
+	o := &d.scrBlt
+	if fieldFlags&0x01 != 0 {
+		o.Left = r.coord(delta, o.Left)
+	}
+	if fieldFlags&0x02 != 0 {
+		o.Top = r.coord(delta, o.Top)
+	}
+	if fieldFlags&0x04 != 0 {
+		o.Width = r.coord(delta, o.Width)
+	}
+	if fieldFlags&0x08 != 0 {
+		o.Height = r.coord(delta, o.Height)
+	}
+	if fieldFlags&0x10 != 0 {
+		o.Rop = r.u8()
+	}
+	if fieldFlags&0x20 != 0 {
+		o.SrcX = r.coord(delta, o.SrcX)
+	}
+	if fieldFlags&0x40 != 0 {
+		o.SrcY = r.coord(delta, o.SrcY)
+	}
+}
+
+// decodeMemBlt updates the saved MemBlt fields
+func (d *Decoder) decodeMemBlt(r *reader, fieldFlags uint32, delta bool) {
+	o := &d.memBlt
+	if fieldFlags&0x0001 != 0 {
+		v := r.u16()
+		o.CacheID, o.ColorIndex = uint8(v), uint8(v>>8)
+	}
+	if fieldFlags&0x0002 != 0 {
+		o.Left = r.coord(delta, o.Left)
+	}
+	if fieldFlags&0x0004 != 0 {
+		o.Top = r.coord(delta, o.Top)
+	}
+	if fieldFlags&0x0008 != 0 {
+		o.Width = r.coord(delta, o.Width)
+	}
+	if fieldFlags&0x0010 != 0 {
+		o.Height = r.coord(delta, o.Height)
+	}
+	if fieldFlags&0x0020 != 0 {
+		o.Rop = r.u8()
+	}
+	if fieldFlags&0x0040 != 0 {
+		o.SrcX = r.coord(delta, o.SrcX)
+	}
+	if fieldFlags&0x0080 != 0 {
+		o.SrcY = r.coord(delta, o.SrcY)
+	}
+	if fieldFlags&0x0100 != 0 {
+		o.CacheIndex = r.u16()
+	}
+}
+
+// readBounds updates the saved bounds from a TS_BOUNDS field
+// (MS-RDPEGDI 2.2.2.2.1.1.1.1)
+func (d *Decoder) readBounds(r *reader) {
+	flags := r.u8()
+	fields := []*int16{&d.bounds.Left, &d.bounds.Top, &d.bounds.Right, &d.bounds.Bottom}
+	for i, field := range fields {
+		switch {
+		case flags&(0x01<<i) != 0:
+			*field = int16(r.u16())
+		case flags&(0x10<<i) != 0:
+			*field += int16(int8(r.u8()))
+		}
+	}
+}
+
+func parseCacheBitmapRev2(body []byte, extraFlags uint16, compressed bool) (*CacheBitmapRev2, error) {
+	order := &CacheBitmapRev2{
+		CacheID:    uint8(extraFlags & 0x07),
+		Compressed: compressed,
+	}
+
+	switch (extraFlags & 0x78) >> 3 {
+	case 3:
+		order.BitsPerPixel = 8
+	case 4:
+		order.BitsPerPixel = 16
+	case 5:
+		order.BitsPerPixel = 24
+	case 6:
+		order.BitsPerPixel = 32
+	default:
+		return nil, fmt.Errorf("%w: bitsPerPixelId %d", ErrMalformedOrder, (extraFlags&0x78)>>3)
+	}
+
+	flags := extraFlags >> 7
+	r := &reader{data: body}
+	if flags&cbr2PersistentKeyPresent != 0 {
+		r.take(8) // key1, key2
+	}
+	order.Width = int(r.twoByteUnsigned())
+	order.Height = order.Width
+	if flags&cbr2HeightSameAsWidth == 0 {
+		order.Height = int(r.twoByteUnsigned())
+	}
+	bitmapLength := int(r.fourByteUnsigned())
+	order.CacheIndex = r.twoByteUnsigned()
+	if flags&cbr2DoNotCache != 0 {
+		order.CacheIndex = WaitingListIndex
+	}
+
+	order.NoCompressionHeader = flags&cbr2NoBitmapCompressionHdr != 0
+	if compressed && !order.NoCompressionHeader {
+		r.take(8) // TS_CD_HEADER
+		bitmapLength -= 8
+	}
+	if bitmapLength < 0 {
+		return nil, fmt.Errorf("%w: bitmap length", ErrMalformedOrder)
+	}
+	order.Data = r.take(bitmapLength)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return order, nil
+}
+
+// reader is a cursor over order data. The first read past the end sets err
+// and every later read returns zero.
+type reader struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (r *reader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.off+n > len(r.data) {
+		r.err = fmt.Errorf("%w: need %d bytes at offset %d of %d", ErrMalformedOrder, n, r.off, len(r.data))
+		return nil
+	}
+	b := r.data[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+func (r *reader) u8() uint8 {
+	if b := r.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) u16() uint16 {
+	if b := r.take(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+// coord reads a coordinate field, either an absolute int16 or a signed
+// one-byte delta from prev (MS-RDPEGDI 2.2.2.2.1.1.1.1)
+func (r *reader) coord(delta bool, prev int16) int16 {
+	if delta {
+		return prev + int16(int8(r.u8()))
+	}
+	return int16(r.u16())
+}
+
+// fieldFlags reads the field flags of a primary order, which omits one
+// leading zero byte for each TS_ZERO_FIELD_BYTE_BIT set in controlFlags
+func (r *reader) fieldFlags(fieldBytes int, controlFlags uint8) uint32 {
+	if controlFlags&flagZeroFieldByteBit0 != 0 {
+		fieldBytes--
+	}
+	if controlFlags&flagZeroFieldByteBit1 != 0 {
+		if fieldBytes > 1 {
+			fieldBytes -= 2
+		} else {
+			fieldBytes = 0
+		}
+	}
+
+	var flags uint32
+	for i := 0; i < fieldBytes; i++ {
+		flags |= uint32(r.u8()) << (8 * i)
+	}
+	return flags
+}
+
+// twoByteUnsigned reads a TWO_BYTE_UNSIGNED_ENCODING (MS-RDPEGDI 2.2.2.2.1.2.1.2)
+func (r *reader) twoByteUnsigned() uint16 {
+	b := r.u8()
+	if b&0x80 == 0 {
+		return uint16(b)
+	}
+	return uint16(b&0x7F)<<8 | uint16(r.u8())
+}
+
+// fourByteUnsigned reads a FOUR_BYTE_UNSIGNED_ENCODING (MS-RDPEGDI 2.2.2.2.1.2.1.4)
+func (r *reader) fourByteUnsigned() uint32 {
+	b := r.u8()
+	v := uint32(b & 0x3F)
+	for i := 0; i < int(b>>6); i++ {
+		v = v<<8 | uint32(r.u8())
+	}
+	return v
+}
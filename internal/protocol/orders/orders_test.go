@@ -0,0 +1,224 @@
+package orders
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingHandler struct {
+	cached      []*CacheBitmapRev2
+	opaqueRects []*OpaqueRect
+	scrBlts     []*ScrBlt
+	memBlts     []*MemBlt
+}
+
+func (h *recordingHandler) CacheBitmap(order *CacheBitmapRev2) { h.cached = append(h.cached, order) }
+func (h *recordingHandler) OpaqueRect(order *OpaqueRect) {
+	h.opaqueRects = append(h.opaqueRects, order)
+}
+func (h *recordingHandler) ScrBlt(order *ScrBlt) { h.scrBlts = append(h.scrBlts, order) }
+func (h *recordingHandler) MemBlt(order *MemBlt) { h.memBlts = append(h.memBlts, order) }
+
+func TestDecode_CacheBitmapRev2(t *testing.T) {
+	data := []byte{
+		0x03,       // TS_STANDARD | TS_SECONDARY
+		0x00, 0x00, // orderLength, set below
+		0xB1, 0x00, // extraFlags: cacheId 1, 32 bpp, HEIGHT_SAME_AS_WIDTH
+		0x04,       // TS_CACHE_BITMAP_UNCOMPRESSED_REV2
+		0x01,       // bitmapWidth 1
+		0x04,       // bitmapLength 4
+		0x80, 0x05, // cacheIndex 5 (two-byte form)
+		0x11, 0x22, 0x33, 0x44,
+	}
+	data[1] = byte(len(data) - 13)
+
+	h := &recordingHandler{}
+	require.NoError(t, NewDecoder().Decode(data, 1, h))
+	require.Len(t, h.cached, 1)
+	assert.Equal(t, &CacheBitmapRev2{
+		CacheID:      1,
+		BitsPerPixel: 32,
+		Width:        1,
+		Height:       1,
+		CacheIndex:   5,
+		Data:         []byte{0x11, 0x22, 0x33, 0x44},
+	}, h.cached[0])
+}
+
+func TestDecode_CacheBitmapRev2Compressed(t *testing.T) {
+	data := []byte{
+		0x03,
+		0x00, 0x00, // orderLength, set below
+		0x20, 0x08, // extraFlags: cacheId 0, 16 bpp, DO_NOT_CACHE
+		0x05,                   // TS_CACHE_BITMAP_COMPRESSED_REV2
+		0x02,                   // bitmapWidth 2
+		0x01,                   // bitmapHeight 1
+		0x0A,                   // bitmapLength 10 including the compression header
+		0x07,                   // cacheIndex (ignored)
+		0, 0, 0, 0, 0, 0, 0, 0, // TS_CD_HEADER
+		0xAA, 0xBB,
+	}
+	data[1] = byte(len(data) - 13)
+
+	h := &recordingHandler{}
+	require.NoError(t, NewDecoder().Decode(data, 1, h))
+	require.Len(t, h.cached, 1)
+	order := h.cached[0]
+	assert.True(t, order.Compressed)
+	assert.Equal(t, 16, order.BitsPerPixel)
+	assert.Equal(t, 2, order.Width)
+	assert.Equal(t, 1, order.Height)
+	assert.Equal(t, WaitingListIndex, order.CacheIndex)
+	assert.Equal(t, []byte{0xAA, 0xBB}, order.Data)
+}
+
+func TestDecode_SkipsOtherSecondaryOrders(t *testing.T) {
+	// orderLength -4 leaves a 3 byte body
+	data := []byte{0x03, 0xFC, 0xFF, 0x00, 0x00, 0x01, 0x01, 0x02, 0x03}
+
+	h := &recordingHandler{}
+	require.NoError(t, NewDecoder().Decode(data, 1, h))
+	assert.Empty(t, h.cached)
+}
+
+func TestDecode_MemBlt(t *testing.T) {
+	d := NewDecoder()
+	h := &recordingHandler{}
+
+	first := []byte{
+		0x0D,       // TS_STANDARD | TS_BOUNDS | TS_TYPE_CHANGE
+		0x0D,       // TS_ENC_MEMBLT_ORDER
+		0xFF, 0x01, // all nine fields
+		0x0F,                   // absolute bounds
+		0x0A, 0x00, 0x14, 0x00, // left 10, top 20
+		0x63, 0x00, 0xC7, 0x00, // right 99, bottom 199
+		0x02, 0x00, // cacheId 2
+		0x0A, 0x00, 0x14, 0x00, // left 10, top 20
+		0x40, 0x00, 0x40, 0x00, // 64x64
+		0xCC,                   // SRCCOPY
+		0x00, 0x00, 0x00, 0x00, // source 0,0
+		0x03, 0x00, // cacheIndex 3
+	}
+	require.NoError(t, d.Decode(first, 1, h))
+
+	// Same order type and bounds, left moved by a delta, new cache index
+	second := []byte{
+		0x35,       // TS_STANDARD | TS_BOUNDS | TS_DELTA_COORDINATES | TS_ZERO_BOUNDS_DELTAS
+		0x02, 0x01, // left, cacheIndex
+		0x40,       // left += 64
+		0x04, 0x00, // cacheIndex 4
+	}
+	require.NoError(t, d.Decode(second, 1, h))
+
+	require.Len(t, h.memBlts, 2)
+	bounds := &Rect{Left: 10, Top: 20, Right: 99, Bottom: 199}
+	assert.Equal(t, &MemBlt{CacheID: 2, Left: 10, Top: 20, Width: 64, Height: 64, Rop: 0xCC, CacheIndex: 3, Bounds: bounds}, h.memBlts[0])
+	assert.Equal(t, &MemBlt{CacheID: 2, Left: 74, Top: 20, Width: 64, Height: 64, Rop: 0xCC, CacheIndex: 4, Bounds: bounds}, h.memBlts[1])
+}
+
+func TestDecode_MemBltZeroFieldByte(t *testing.T) {
+	d := NewDecoder()
+	h := &recordingHandler{}
+
+	// TS_ZERO_FIELD_BYTE_BIT0 drops the second field flags byte
+	data := []byte{0x49, 0x0D, 0x20, 0x66}
+	require.NoError(t, d.Decode(data, 1, h))
+	require.Len(t, h.memBlts, 1)
+	assert.Equal(t, uint8(0x66), h.memBlts[0].Rop)
+	assert.Nil(t, h.memBlts[0].Bounds)
+}
+
+func TestDecode_OpaqueRect(t *testing.T) {
+	d := NewDecoder()
+	h := &recordingHandler{}
+
+	first := []byte{
+		0x09,                   // TS_STANDARD | TS_TYPE_CHANGE
+		0x0A,                   // TS_ENC_OPAQUERECT_ORDER
+		0x7F,                   // all seven fields
+		0x0A, 0x00, 0x14, 0x00, // left 10, top 20
+		0x20, 0x00, 0x10, 0x00, // 32x16
+		0x11, 0x22, 0x33, // red, green, blue
+	}
+	require.NoError(t, d.Decode(first, 1, h))
+
+	// Same type, top moved by a delta and only the blue byte changed
+	second := []byte{
+		0x11, // TS_STANDARD | TS_DELTA_COORDINATES
+		0x42, // top, blue
+		0xFC, // top -= 4
+		0x44, // blue
+	}
+	require.NoError(t, d.Decode(second, 1, h))
+
+	require.Len(t, h.opaqueRects, 2)
+	assert.Equal(t, &OpaqueRect{Left: 10, Top: 20, Width: 32, Height: 16, Color: [3]uint8{0x11, 0x22, 0x33}}, h.opaqueRects[0])
+	assert.Equal(t, &OpaqueRect{Left: 10, Top: 16, Width: 32, Height: 16, Color: [3]uint8{0x11, 0x22, 0x44}}, h.opaqueRects[1])
+}
+
+func TestDecode_ScrBltAfterMemBlt(t *testing.T) {
+	d := NewDecoder()
+	h := &recordingHandler{}
+
+	data := []byte{
+		0x0D,       // TS_STANDARD | TS_BOUNDS | TS_TYPE_CHANGE
+		0x02,       // TS_ENC_SCRBLT_ORDER
+		0x7F,       // all seven fields
+		0x05,       // left and right bounds as absolute values
+		0x05, 0x00, // bounds left 5
+		0x32, 0x00, // bounds right 50
+		0x0A, 0x00, 0x14, 0x00, // left 10, top 20
+		0x40, 0x00, 0x08, 0x00, // 64x8
+		0xCC,                   // SRCCOPY
+		0x0A, 0x00, 0x1C, 0x00, // source 10,28
+
+		// A MemBlt in between keeps its own fields
+		0x49, 0x0D, 0x20, 0xCC, // TS_ZERO_FIELD_BYTE_BIT0, rop only
+
+		0x19, 0x02, // TS_STANDARD | TS_TYPE_CHANGE | TS_DELTA_COORDINATES, ScrBlt
+		0x02, 0x01, // top += 1
+	}
+	require.NoError(t, d.Decode(data, 3, h))
+
+	require.Len(t, h.scrBlts, 2)
+	require.Len(t, h.memBlts, 1)
+	assert.Equal(t, &ScrBlt{Left: 10, Top: 20, Width: 64, Height: 8, Rop: 0xCC, SrcX: 10, SrcY: 28,
+		Bounds: &Rect{Left: 5, Right: 50}}, h.scrBlts[0])
+	assert.Equal(t, &ScrBlt{Left: 10, Top: 21, Width: 64, Height: 8, Rop: 0xCC, SrcX: 10, SrcY: 28}, h.scrBlts[1])
+	assert.Equal(t, &MemBlt{Rop: 0xCC}, h.memBlts[0])
+}
+
+func TestDecode_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"unsupported primary order", []byte{0x09, 0x01, 0x00}, ErrUnsupportedOrder},
+		{"truncated opaque rect", []byte{0x09, 0x0A, 0x10}, ErrMalformedOrder},
+		{"default primary order", []byte{0x01, 0x00}, ErrUnsupportedOrder},
+		{"alternate secondary order", []byte{0x02}, ErrUnsupportedOrder},
+		{"no standard flag", []byte{0x00}, ErrMalformedOrder},
+		{"truncated secondary order", []byte{0x03, 0x00, 0x00, 0x00, 0x00, 0x04}, ErrMalformedOrder},
+		{"truncated memblt", []byte{0x09, 0x0D, 0x01, 0x00}, ErrMalformedOrder},
+		{"missing order", nil, ErrMalformedOrder},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewDecoder().Decode(tt.data, 1, &recordingHandler{})
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+func TestReader_VariableLengthEncodings(t *testing.T) {
+	r := &reader{data: []byte{0x7F, 0x81, 0x02, 0x3F, 0x41, 0x02, 0x80, 0x01, 0x02}}
+	assert.Equal(t, uint16(0x7F), r.twoByteUnsigned())
+	assert.Equal(t, uint16(0x0102), r.twoByteUnsigned())
+	assert.Equal(t, uint32(0x3F), r.fourByteUnsigned())
+	assert.Equal(t, uint32(0x0102), r.fourByteUnsigned())
+	assert.Equal(t, uint32(0x000102), r.fourByteUnsigned())
+	require.NoError(t, r.err)
+}
@@ -11,7 +11,6 @@ import (
 )
 
 const (
-	rdpVersion5Plus             = 0x00080004
 	keyboardTypeIBM101or102Keys = 0x00000004
 	projectName                 = "go-rdp"
 )
@@ -106,7 +105,7 @@ func newClientCoreData(selectedProtocol uint32, desktopWidth, desktopHeight uint
 	}
 
 	data := ClientCoreData{
-		Version:                rdpVersion5Plus,
+		Version:                RDPVersion5Plus,
 		DesktopWidth:           desktopWidth,
 		DesktopHeight:          desktopHeight,
 		ColorDepth:             0xCA01,     // RNS_UD_COLOR_8BPP (ignored when HighColorDepth is set)
@@ -179,6 +178,10 @@ type ChannelDefinitionStructure struct {
 	Options uint32
 }
 
+// MaxStaticChannels is the most static virtual channels a client may request
+// (CHANNEL_MAX_COUNT, MS-RDPBCGR 2.2.1.3.4).
+const MaxStaticChannels = 31
+
 // ClientNetworkData contains the list of static virtual channels requested by the client.
 // See MS-RDPBCGR section 2.2.1.3.4 for the Client Network Data (TS_UD_CS_NET) structure.
 type ClientNetworkData struct {
@@ -193,12 +196,101 @@ type ClientClusterData struct {
 	RedirectedSessionID uint32
 }
 
+// Client Cluster Data flags (MS-RDPBCGR 2.2.1.3.5)
+const (
+	// ClusterRedirectionSupported REDIRECTION_SUPPORTED
+	ClusterRedirectionSupported uint32 = 0x00000001
+
+	// ClusterRedirectedSessionIDFieldValid REDIRECTED_SESSIONID_FIELD_VALID
+	ClusterRedirectedSessionIDFieldValid uint32 = 0x00000002
+
+	// ClusterRedirectionVersion4 REDIRECTION_VERSION4, in the
+	// ServerSessionRedirectionVersionMask bits
+	ClusterRedirectionVersion4 uint32 = 0x03 << 2
+)
+
+// ClientMonitorData describes the client display monitors.
+// See MS-RDPBCGR section 2.2.1.3.6 for the Client Monitor Data (TS_UD_CS_MONITOR) structure.
+type ClientMonitorData struct {
+	Monitors []MonitorDef
+}
+
+// NewSingleMonitorData creates a ClientMonitorData advertising one primary
+// monitor covering the whole desktop.
+func NewSingleMonitorData(desktopWidth, desktopHeight uint16) *ClientMonitorData {
+	return &ClientMonitorData{
+		Monitors: []MonitorDef{{
+			Right:  int32(desktopWidth) - 1,
+			Bottom: int32(desktopHeight) - 1,
+			Flags:  MonitorFlagPrimary,
+		}},
+	}
+}
+
+// MaxMonitorDimension is the largest width or height of the desktop spanned
+// by the client monitors.
+const MaxMonitorDimension = 16384
+
+// ErrInvalidMonitorLayout is returned for a monitor layout the server would reject
+var ErrInvalidMonitorLayout = errors.New("invalid monitor layout")
+
+// NewClientMonitorData creates a ClientMonitorData for a multi-monitor
+// desktop. Exactly one monitor must be primary, with its top-left corner at
+// the origin, and the monitors must fit in a MaxMonitorDimension square.
+func NewClientMonitorData(monitors []MonitorDef) (*ClientMonitorData, error) {
+	if len(monitors) == 0 || len(monitors) > MaxMonitorCount {
+		return nil, fmt.Errorf("%w: %d monitors (must be 1-%d)", ErrInvalidMonitorLayout, len(monitors), MaxMonitorCount)
+	}
+
+	var primary *MonitorDef
+	primaries := 0
+	for i, m := range monitors {
+		if m.Width() <= 0 || m.Height() <= 0 {
+			return nil, fmt.Errorf("%w: monitor %d is empty", ErrInvalidMonitorLayout, i)
+		}
+		if m.IsPrimary() {
+			primary = &monitors[i]
+			primaries++
+		}
+	}
+	if primaries != 1 {
+		return nil, fmt.Errorf("%w: %d primary monitors (must be exactly 1)", ErrInvalidMonitorLayout, primaries)
+	}
+	if primary.Left != 0 || primary.Top != 0 {
+		return nil, fmt.Errorf("%w: primary monitor is not at the origin", ErrInvalidMonitorLayout)
+	}
+
+	d := &ClientMonitorData{Monitors: monitors}
+	if width, height := d.DesktopSize(); width > MaxMonitorDimension || height > MaxMonitorDimension {
+		return nil, fmt.Errorf("%w: desktop %dx%d exceeds %d", ErrInvalidMonitorLayout, width, height, MaxMonitorDimension)
+	}
+	return d, nil
+}
+
+// DesktopSize returns the size of the bounding box of all monitors, which is
+// the desktop size of the session.
+func (d ClientMonitorData) DesktopSize() (width, height int) {
+	if len(d.Monitors) == 0 {
+		return 0, 0
+	}
+	bounds := d.Monitors[0]
+	for _, m := range d.Monitors[1:] {
+		bounds.Left = min(bounds.Left, m.Left)
+		bounds.Top = min(bounds.Top, m.Top)
+		bounds.Right = max(bounds.Right, m.Right)
+		bounds.Bottom = max(bounds.Bottom, m.Bottom)
+	}
+	return bounds.Width(), bounds.Height()
+}
+
 // ClientUserDataSet aggregates all client GCC user data blocks sent to the server.
 type ClientUserDataSet struct {
-	ClientCoreData     *ClientCoreData
-	ClientSecurityData *ClientSecurityData
-	ClientNetworkData  *ClientNetworkData
-	ClientClusterData  *ClientClusterData
+	ClientCoreData           *ClientCoreData
+	ClientSecurityData       *ClientSecurityData
+	ClientNetworkData        *ClientNetworkData
+	ClientClusterData        *ClientClusterData
+	ClientMonitorData        *ClientMonitorData
+	ClientMessageChannelData *ClientMessageChannelData
 }
 
 // NewClientUserDataSet creates a new ClientUserDataSet with the specified connection parameters.
@@ -354,6 +446,30 @@ func (d ClientClusterData) Serialize() []byte {
 	return buf.Bytes()
 }
 
+// Serialize encodes the ClientMonitorData into its wire format with a CS_MONITOR header.
+func (d ClientMonitorData) Serialize() []byte {
+	const (
+		headerLen     = 12
+		monitorDefLen = 20
+	)
+
+	monitorCount := uint32(len(d.Monitors))                   // #nosec G115
+	pktSize := uint16(headerLen + monitorDefLen*monitorCount) // #nosec G115
+
+	buf := new(bytes.Buffer)
+
+	_ = binary.Write(buf, binary.LittleEndian, uint16(0xC005)) // header type CS_MONITOR
+	_ = binary.Write(buf, binary.LittleEndian, pktSize)
+	_ = binary.Write(buf, binary.LittleEndian, uint32(0)) // flags (unused)
+	_ = binary.Write(buf, binary.LittleEndian, monitorCount)
+
+	for _, m := range d.Monitors {
+		_ = binary.Write(buf, binary.LittleEndian, m)
+	}
+
+	return buf.Bytes()
+}
+
 // Serialize encodes all client user data blocks into their combined wire format.
 func (ud ClientUserDataSet) Serialize() []byte {
 	buf := new(bytes.Buffer)
@@ -367,6 +483,14 @@ func (ud ClientUserDataSet) Serialize() []byte {
 	buf.Write(ud.ClientSecurityData.Serialize())
 	buf.Write(ud.ClientNetworkData.Serialize())
 
+	if ud.ClientMonitorData != nil {
+		buf.Write(ud.ClientMonitorData.Serialize())
+	}
+
+	if ud.ClientMessageChannelData != nil {
+		buf.Write(ud.ClientMessageChannelData.Serialize())
+	}
+
 	return buf.Bytes()
 }
 
@@ -407,6 +531,29 @@ func (d *ServerCoreData) Deserialize(wire io.Reader) error {
 	return nil
 }
 
+// RDP protocol versions advertised in the core data blocks (MS-RDPBCGR 2.2.1.4.2)
+const (
+	RDPVersion4     uint32 = 0x00080001
+	RDPVersion5Plus uint32 = 0x00080004
+	RDPVersion10    uint32 = 0x00080005
+	RDPVersion10_12 uint32 = 0x00080011
+)
+
+// VersionName returns the RDP version the server advertised, such as "10.7".
+// Versions newer than this client knows of are reported in hex.
+func (d *ServerCoreData) VersionName() string {
+	switch {
+	case d.Version == RDPVersion4:
+		return "4.0"
+	case d.Version == RDPVersion5Plus:
+		return "5.0+"
+	case d.Version >= RDPVersion10 && d.Version <= RDPVersion10_12:
+		return fmt.Sprintf("10.%d", d.Version-RDPVersion10)
+	default:
+		return fmt.Sprintf("0x%08X", d.Version)
+	}
+}
+
 // RSAPublicKey represents an RSA public key used in server proprietary certificates.
 // See MS-RDPBCGR section 2.2.1.4.3.1.1.1 for the RSA Public Key (RSA_PUBLIC_KEY) structure.
 type RSAPublicKey struct {
@@ -658,64 +805,62 @@ type ServerUserData struct {
 	ServerMultitransportChannelData *ServerMultitransportChannelData
 }
 
+// Server data block types (MS-RDPBCGR 2.2.1.4)
+const (
+	serverCoreDataType           uint16 = 0x0C01 // SC_CORE
+	serverSecurityDataType       uint16 = 0x0C02 // SC_SECURITY
+	serverNetworkDataType        uint16 = 0x0C03 // SC_NET
+	serverMessageChannelDataType uint16 = 0x0C04 // SC_MCS_MSGCHANNEL
+	serverMultitransportDataType uint16 = 0x0C08 // SC_MULTITRANSPORT
+)
+
+// ErrInvalidServerUserData is returned when a server data block is truncated
+// or overruns its declared length
+var ErrInvalidServerUserData = errors.New("invalid server user data")
+
 // Deserialize decodes all server user data blocks from their combined wire format.
+// Each block is decoded within its own length, so a block carrying fields this
+// client does not know cannot throw off the next one, and blocks of unknown
+// type are skipped.
 func (ud *ServerUserData) Deserialize(wire io.Reader) error {
-	var (
-		dataType uint16
-		dataLen  uint16
-		err      error
-	)
+	data, err := io.ReadAll(wire)
+	if err != nil {
+		return err
+	}
 
-	for {
-		err = binary.Read(wire, binary.LittleEndian, &dataType)
-		switch err {
-		case nil: // pass
-		case io.EOF:
-			return nil
-		default:
-			return err
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return fmt.Errorf("%w: truncated block header", ErrInvalidServerUserData)
 		}
-
-		err = binary.Read(wire, binary.LittleEndian, &dataLen)
-		if err != nil {
-			return err
+		dataType := binary.LittleEndian.Uint16(data)
+		dataLen := int(binary.LittleEndian.Uint16(data[2:]))
+		if dataLen < 4 || dataLen > len(data) {
+			return fmt.Errorf("%w: block 0x%04X length %d with %d bytes left", ErrInvalidServerUserData, dataType, dataLen, len(data))
 		}
-
-		dataLen -= 4 // exclude User Data Header
+		block := bytes.NewReader(data[4:dataLen])
+		data = data[dataLen:]
 
 		switch dataType {
-		case 0x0C01:
-			ud.ServerCoreData = &ServerCoreData{DataLen: dataLen}
-
-			if err = ud.ServerCoreData.Deserialize(wire); err != nil {
-				return err
-			}
-		case 0x0C02:
+		case serverCoreDataType:
+			ud.ServerCoreData = &ServerCoreData{DataLen: uint16(dataLen - 4)} // #nosec G115
+			err = ud.ServerCoreData.Deserialize(block)
+		case serverSecurityDataType:
 			ud.ServerSecurityData = &ServerSecurityData{}
-
-			if err = ud.ServerSecurityData.Deserialize(wire); err != nil {
-				return err
-			}
-		case 0x0C03:
+			err = ud.ServerSecurityData.Deserialize(block)
+		case serverNetworkDataType:
 			ud.ServerNetworkData = &ServerNetworkData{}
-
-			if err = ud.ServerNetworkData.Deserialize(wire); err != nil {
-				return err
-			}
-		case 0x0C04:
+			err = ud.ServerNetworkData.Deserialize(block)
+		case serverMessageChannelDataType:
 			ud.ServerMessageChannelData = &ServerMessageChannelData{}
-
-			if err = binary.Read(wire, binary.LittleEndian, &ud.ServerMessageChannelData.MCSChannelID); err != nil {
-				return err
-			}
-		case 0x0C08:
+			err = binary.Read(block, binary.LittleEndian, &ud.ServerMessageChannelData.MCSChannelID)
+		case serverMultitransportDataType:
 			ud.ServerMultitransportChannelData = &ServerMultitransportChannelData{}
-
-			if err = binary.Read(wire, binary.LittleEndian, &ud.ServerMultitransportChannelData.Flags); err != nil {
-				return err
-			}
-		default:
-			return errors.New("unknown header type")
+			err = binary.Read(block, binary.LittleEndian, &ud.ServerMultitransportChannelData.Flags)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: block 0x%04X: %w", ErrInvalidServerUserData, dataType, err)
 		}
 	}
+
+	return nil
 }
@@ -2,6 +2,7 @@ package pdu
 
 import (
 	"bytes"
+	"encoding/binary"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -104,6 +105,28 @@ func TestServerCoreData_Deserialize(t *testing.T) {
 	}
 }
 
+func TestServerCoreData_VersionName(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{[]byte{0x01, 0x00, 0x08, 0x00}, "4.0"},
+		{[]byte{0x04, 0x00, 0x08, 0x00}, "5.0+"},
+		{[]byte{0x05, 0x00, 0x08, 0x00}, "10.0"},
+		{[]byte{0x0C, 0x00, 0x08, 0x00}, "10.7"},
+		{[]byte{0x11, 0x00, 0x08, 0x00}, "10.12"},
+		{[]byte{0x12, 0x00, 0x08, 0x00}, "0x00080012"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			d := ServerCoreData{DataLen: 4}
+			require.NoError(t, d.Deserialize(bytes.NewReader(tt.data)))
+			require.Equal(t, tt.want, d.VersionName())
+		})
+	}
+}
+
 func TestServerNetworkData_Deserialize(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -366,17 +389,37 @@ func TestServerUserData_Deserialize(t *testing.T) {
 		require.NotNil(t, ud.ServerMultitransportChannelData)
 	})
 
-	t.Run("UnknownType", func(t *testing.T) {
+	t.Run("UnknownTypeSkipped", func(t *testing.T) {
 		data := []byte{
 			0xFF, 0x0C, // Unknown type
 			0x08, 0x00, // Length = 8
 			0x00, 0x00, 0x00, 0x00,
+			0x01, 0x0C, // Type = SC_CORE
+			0x08, 0x00, // Length = 8
+			0x04, 0x00, 0x08, 0x00, // Version
 		}
 
 		var ud ServerUserData
 		err := ud.Deserialize(bytes.NewReader(data))
-		require.Error(t, err)
-		require.Contains(t, err.Error(), "unknown header type")
+		require.NoError(t, err)
+		require.NotNil(t, ud.ServerCoreData)
+		require.Equal(t, uint32(0x00080004), ud.ServerCoreData.Version)
+	})
+
+	t.Run("InvalidBlocks", func(t *testing.T) {
+		tests := map[string][]byte{
+			"truncated header": {0x01, 0x0C, 0x08},
+			"short length":     {0x01, 0x0C, 0x02, 0x00},
+			"overlong length":  {0x01, 0x0C, 0x10, 0x00, 0x04, 0x00, 0x08, 0x00},
+			"truncated block":  {0x03, 0x0C, 0x06, 0x00, 0xEB, 0x03},
+		}
+		for name, data := range tests {
+			t.Run(name, func(t *testing.T) {
+				var ud ServerUserData
+				err := ud.Deserialize(bytes.NewReader(data))
+				require.ErrorIs(t, err, ErrInvalidServerUserData)
+			})
+		}
 	})
 
 	t.Run("EmptyData", func(t *testing.T) {
@@ -437,3 +480,60 @@ func TestServerSecurityData_DeserializeWithCert(t *testing.T) {
 	require.NotNil(t, d.ServerCertificate)
 	require.NotNil(t, d.ServerCertificate.ProprietaryCert)
 }
+
+func TestNewSingleMonitorData_Serialize(t *testing.T) {
+	data := NewSingleMonitorData(1920, 1080).Serialize()
+
+	require.Equal(t, []byte{
+		0x05, 0xC0, 0x20, 0x00, // CS_MONITOR, length 32
+		0x00, 0x00, 0x00, 0x00, // flags
+		0x01, 0x00, 0x00, 0x00, // monitorCount
+		0x00, 0x00, 0x00, 0x00, // left
+		0x00, 0x00, 0x00, 0x00, // top
+		0x7F, 0x07, 0x00, 0x00, // right (1919)
+		0x37, 0x04, 0x00, 0x00, // bottom (1079)
+		0x01, 0x00, 0x00, 0x00, // TS_MONITOR_PRIMARY
+	}, data)
+}
+
+func TestClientUserDataSet_MonitorData(t *testing.T) {
+	userData := NewClientUserDataSet(0, 1920, 1080, 24, nil)
+	plain := userData.Serialize()
+
+	userData.ClientMonitorData = NewSingleMonitorData(1920, 1080)
+	withMonitor := userData.Serialize()
+
+	require.Equal(t, plain, withMonitor[:len(plain)])
+	require.Equal(t, userData.ClientMonitorData.Serialize(), withMonitor[len(plain):])
+}
+
+func TestNewClientMonitorData(t *testing.T) {
+	primary := MonitorDef{Right: 1919, Bottom: 1079, Flags: MonitorFlagPrimary}
+	left := MonitorDef{Left: -1280, Top: 56, Right: -1, Bottom: 1079}
+
+	d, err := NewClientMonitorData([]MonitorDef{primary, left})
+	require.NoError(t, err)
+	width, height := d.DesktopSize()
+	require.Equal(t, 3200, width)
+	require.Equal(t, 1080, height)
+
+	encoded := d.Serialize()
+	require.Len(t, encoded, 12+2*20)
+	require.Equal(t, uint32(2), binary.LittleEndian.Uint32(encoded[8:12]), "monitorCount")
+
+	tests := map[string][]MonitorDef{
+		"no monitors":        nil,
+		"no primary":         {left},
+		"two primaries":      {primary, {Left: 1920, Right: 2719, Bottom: 599, Flags: MonitorFlagPrimary}},
+		"primary off origin": {{Left: 10, Right: 809, Bottom: 599, Flags: MonitorFlagPrimary}},
+		"empty monitor":      {primary, {Left: 1920, Right: 1919, Bottom: 1079}},
+		"too wide":           {primary, {Left: 1920, Right: 16384, Bottom: 1079}},
+		"too many monitors":  make([]MonitorDef, MaxMonitorCount+1),
+	}
+	for name, monitors := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewClientMonitorData(monitors)
+			require.ErrorIs(t, err, ErrInvalidMonitorLayout)
+		})
+	}
+}
@@ -97,11 +97,28 @@ type BitmapCacheCapabilitySetRev2 struct {
 	BitmapCache4CellInfo uint32
 }
 
-// NewBitmapCacheCapabilitySetRev2 creates a BitmapCacheCapabilitySetRev2 with default values.
-func NewBitmapCacheCapabilitySetRev2() *CapabilitySet {
-	return &CapabilitySet{
-		CapabilitySetType:            CapabilitySetTypeBitmapCacheRev2,
-		BitmapCacheCapabilitySetRev2: &BitmapCacheCapabilitySetRev2{},
+// MaxBitmapCacheCells is the number of cell caches a BitmapCacheCapabilitySetRev2 can describe
+const MaxBitmapCacheCells = 5
+
+// NewBitmapCacheCapabilitySetRev2 creates a BitmapCacheCapabilitySetRev2 describing one
+// non-persistent cell cache per entry count. Counts beyond MaxBitmapCacheCells are ignored.
+func NewBitmapCacheCapabilitySetRev2(cellEntries ...uint32) CapabilitySet {
+	cellEntries = cellEntries[:min(len(cellEntries), MaxBitmapCacheCells)]
+	cells := make([]uint32, MaxBitmapCacheCells)
+	for i, entries := range cellEntries {
+		cells[i] = entries & 0x7FFFFFFF // bit 31 would mark the cell persistent
+	}
+
+	return CapabilitySet{
+		CapabilitySetType: CapabilitySetTypeBitmapCacheRev2,
+		BitmapCacheCapabilitySetRev2: &BitmapCacheCapabilitySetRev2{
+			NumCellCaches:        uint8(len(cellEntries)), // #nosec G115
+			BitmapCache0CellInfo: cells[0],
+			BitmapCache1CellInfo: cells[1],
+			BitmapCache2CellInfo: cells[2],
+			BitmapCache3CellInfo: cells[3],
+			BitmapCache4CellInfo: cells[4],
+		},
 	}
 }
 
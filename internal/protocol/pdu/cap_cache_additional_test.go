@@ -28,3 +28,17 @@ func TestBitmapCacheCapabilitySetRev2_DeserializeErrors(t *testing.T) {
 	err = set.Deserialize(bytes.NewReader(buf.Bytes()))
 	require.Error(t, err)
 }
+
+func TestNewBitmapCacheCapabilitySetRev2_CellEntries(t *testing.T) {
+	set := NewBitmapCacheCapabilitySetRev2(600, 600, 0x80000400)
+	s := set.BitmapCacheCapabilitySetRev2
+	require.Equal(t, uint8(3), s.NumCellCaches)
+	require.Equal(t, uint32(600), s.BitmapCache0CellInfo)
+	require.Equal(t, uint32(600), s.BitmapCache1CellInfo)
+	require.Equal(t, uint32(0x400), s.BitmapCache2CellInfo, "persistent bit is cleared")
+	require.Zero(t, s.BitmapCache3CellInfo)
+
+	var decoded BitmapCacheCapabilitySetRev2
+	require.NoError(t, decoded.Deserialize(bytes.NewReader(s.Serialize())))
+	require.Equal(t, *s, decoded)
+}
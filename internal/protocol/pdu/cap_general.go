@@ -15,16 +15,43 @@ type GeneralCapabilitySet struct {
 	SuppressOutputSupport uint8
 }
 
+// OS major types advertised in the General Capability Set (MS-RDPBCGR 2.2.7.1.1).
+const (
+	OSMajorTypeUnspecified uint16 = 0x0000
+	OSMajorTypeWindows     uint16 = 0x0001
+	OSMajorTypeOS2         uint16 = 0x0002
+	OSMajorTypeMacintosh   uint16 = 0x0003
+	OSMajorTypeUnix        uint16 = 0x0004
+	OSMajorTypeIOS         uint16 = 0x0005
+	OSMajorTypeOSX         uint16 = 0x0006
+	OSMajorTypeAndroid     uint16 = 0x0007
+	OSMajorTypeChromeOS    uint16 = 0x0008
+)
+
+// OS minor types advertised in the General Capability Set (MS-RDPBCGR 2.2.7.1.1).
+const (
+	OSMinorTypeUnspecified   uint16 = 0x0000
+	OSMinorTypeWindows31x    uint16 = 0x0001
+	OSMinorTypeWindows95     uint16 = 0x0002
+	OSMinorTypeWindowsNT     uint16 = 0x0003
+	OSMinorTypeOS2V21        uint16 = 0x0004
+	OSMinorTypePowerPC       uint16 = 0x0005
+	OSMinorTypeMacintosh     uint16 = 0x0006
+	OSMinorTypeNativeXServer uint16 = 0x0007
+	OSMinorTypePseudoXServer uint16 = 0x0008
+	OSMinorTypeWindowsRT     uint16 = 0x0009
+)
+
 // NewGeneralCapabilitySet creates a General Capability Set with default client values.
 func NewGeneralCapabilitySet() CapabilitySet {
 	return CapabilitySet{
 		CapabilitySetType: CapabilitySetTypeGeneral,
 		GeneralCapabilitySet: &GeneralCapabilitySet{
-			OSMajorType:           0x000A,                                     // Windows 10+ platform
-			OSMinorType:           0x0000,                                     // Latest version
-			ExtraFlags:            0x0001 | 0x0004 | 0x0400 | 0x0080 | 0x0100, // Enhanced features: FASTPATH_OUTPUT_SUPPORTED, LONG_CREDENTIALS_SUPPORTED, NO_BITMAP_COMPRESSION_HDR, DYNAMIC_DST_SUPPORTED, TILE_SUPPORT
-			RefreshRectSupport:    1,                                          // We support Refresh Rect PDU
-			SuppressOutputSupport: 1,                                          // We support Suppress Output PDU
+			OSMajorType:           0x000A,                                              // Windows 10+ platform
+			OSMinorType:           0x0000,                                              // Latest version
+			ExtraFlags:            0x0001 | 0x0004 | 0x0008 | 0x0400 | 0x0080 | 0x0100, // Enhanced features: FASTPATH_OUTPUT_SUPPORTED, LONG_CREDENTIALS_SUPPORTED, AUTORECONNECT_SUPPORTED, NO_BITMAP_COMPRESSION_HDR, DYNAMIC_DST_SUPPORTED, TILE_SUPPORT
+			RefreshRectSupport:    1,                                                   // We support Refresh Rect PDU
+			SuppressOutputSupport: 1,                                                   // We support Suppress Output PDU
 		},
 	}
 }
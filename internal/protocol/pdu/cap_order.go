@@ -6,6 +6,13 @@ import (
 "io"
 )
 
+// orderSupport indices of the supported primary orders (MS-RDPBCGR 2.2.7.1.3.1)
+const (
+	OrderSupportScrBltIndex     = 0x02 // TS_NEG_SCRBLT_INDEX
+	OrderSupportMemBltIndex     = 0x03 // TS_NEG_MEMBLT_INDEX
+	OrderSupportOpaqueRectIndex = 0x0A // TS_NEG_OPAQUE_RECT_INDEX
+)
+
 // OrderCapabilitySet represents the Order Capability Set (MS-RDPBCGR 2.2.7.1.3).
 type OrderCapabilitySet struct {
 	OrderFlags          uint16
@@ -290,8 +290,92 @@ func NewBitmapCodecsCapabilitySet() CapabilitySet {
 	}
 }
 
-// NewBitmapCodecsWithRFXCapabilitySet creates a capability set advertising NSCodec + RemoteFX-Image.
+// RFXCodecMode selects the RemoteFX operating mode advertised in the
+// TS_RFX_ICAP flags field (MS-RDPRFX 2.2.1.1.1.1.1).
+type RFXCodecMode uint8
+
+// RemoteFX codec modes.
+const (
+	// RFXCodecModeVideo asks for video mode, suited to motion.
+	RFXCodecModeVideo RFXCodecMode = 0x00
+	// RFXCodecModeImage (CODEC_MODE) asks for image mode, suited to static content.
+	RFXCodecModeImage RFXCodecMode = 0x02
+)
+
+// RFX capability block types and field values (MS-RDPRFX 2.2.1.1).
+const (
+	rfxBlockTypeCaps      uint16 = 0xCBC0 // CBY_CAPS
+	rfxBlockTypeCapset    uint16 = 0xCBC1 // CBY_CAPSET
+	rfxCapsetTypeCapset   uint16 = 0xCFC0 // CLY_CAPSET
+	rfxCaptureFlagsNonCAC uint32 = 0x01   // CARDP_CAPS_CAPTURE_NON_CAC
+	rfxIcapVersion10      uint16 = 0x0100 // CLW_VERSION_1_0
+	rfxIcapTileSize64     uint16 = 0x0040 // CT_TILE_64x64
+	rfxIcapColConvICT     uint8  = 0x01   // CLW_COL_CONV_ICT
+	rfxIcapXformDWT53A    uint8  = 0x01   // CLW_XFORM_DWT_53_A
+	rfxIcapEntropyRLGR1   uint8  = 0x01   // CLW_ENTROPY_RLGR1
+	rfxIcapEntropyRLGR3   uint8  = 0x04   // CLW_ENTROPY_RLGR3
+	rfxIcapLength         uint16 = 8
+	rfxCapsBlockLength    uint32 = 8
+	rfxCapsetHeaderLength uint32 = 13
+)
+
+// RFXClientCapsContainer is the TS_RFX_CLNT_CAPS_CONTAINER carried in the
+// codec properties of a RemoteFX bitmap codec (MS-RDPRFX 2.2.1.1). One
+// TS_RFX_ICAP is advertised per supported entropy coder, all sharing the
+// same codec mode.
+type RFXClientCapsContainer struct {
+	CaptureFlags uint32
+	Mode         RFXCodecMode
+}
+
+// Serialize encodes the caps container to wire format.
+func (c *RFXClientCapsContainer) Serialize() []byte {
+	entropy := []uint8{rfxIcapEntropyRLGR1, rfxIcapEntropyRLGR3}
+	capsetLength := rfxCapsetHeaderLength + uint32(len(entropy))*uint32(rfxIcapLength) // #nosec G115
+	capsLength := rfxCapsBlockLength + capsetLength
+
+	buf := new(bytes.Buffer)
+
+	_ = binary.Write(buf, binary.LittleEndian, 12+capsLength) // length
+	_ = binary.Write(buf, binary.LittleEndian, c.CaptureFlags)
+	_ = binary.Write(buf, binary.LittleEndian, capsLength)
+
+	// TS_RFX_CAPS
+	_ = binary.Write(buf, binary.LittleEndian, rfxBlockTypeCaps)
+	_ = binary.Write(buf, binary.LittleEndian, rfxCapsBlockLength)
+	_ = binary.Write(buf, binary.LittleEndian, uint16(1)) // numCapsets
+
+	// TS_RFX_CAPSET
+	_ = binary.Write(buf, binary.LittleEndian, rfxBlockTypeCapset)
+	_ = binary.Write(buf, binary.LittleEndian, capsetLength)
+	_ = binary.Write(buf, binary.LittleEndian, uint8(1)) // codecId
+	_ = binary.Write(buf, binary.LittleEndian, rfxCapsetTypeCapset)
+	_ = binary.Write(buf, binary.LittleEndian, uint16(len(entropy))) // #nosec G115
+	_ = binary.Write(buf, binary.LittleEndian, rfxIcapLength)
+
+	// TS_RFX_ICAP entries
+	for _, e := range entropy {
+		_ = binary.Write(buf, binary.LittleEndian, rfxIcapVersion10)
+		_ = binary.Write(buf, binary.LittleEndian, rfxIcapTileSize64)
+		buf.WriteByte(uint8(c.Mode))
+		buf.WriteByte(rfxIcapColConvICT)
+		buf.WriteByte(rfxIcapXformDWT53A)
+		buf.WriteByte(e)
+	}
+
+	return buf.Bytes()
+}
+
+// NewBitmapCodecsWithRFXCapabilitySet creates a capability set advertising
+// NSCodec + RemoteFX-Image in image mode.
 func NewBitmapCodecsWithRFXCapabilitySet() CapabilitySet {
+	return NewBitmapCodecsWithRFXModeCapabilitySet(RFXCodecModeImage)
+}
+
+// NewBitmapCodecsWithRFXModeCapabilitySet creates a capability set advertising
+// NSCodec + RemoteFX with the given preferred mode. Image mode is advertised
+// under the RemoteFX-Image GUID and video mode under the RemoteFX GUID.
+func NewBitmapCodecsWithRFXModeCapabilitySet(mode RFXCodecMode) CapabilitySet {
 	nscodecProps := NSCodecCapabilitySet{
 		FAllowDynamicFidelity: 1,
 		FAllowSubsampling:     1,
@@ -307,16 +391,41 @@ func NewBitmapCodecsWithRFXCapabilitySet() CapabilitySet {
 					CodecID:         1,
 					CodecProperties: nscodecProps.Serialize(),
 				},
-				{
-					CodecGUID:       RemoteFXImageGUID,
-					CodecID:         2,
-					CodecProperties: nil,
-				},
+				rfxBitmapCodec(mode, 2),
 			},
 		},
 	}
 }
 
+// NewBitmapCodecsRFXOnlyCapabilitySet creates a capability set advertising
+// RemoteFX alone with the given preferred mode.
+func NewBitmapCodecsRFXOnlyCapabilitySet(mode RFXCodecMode) CapabilitySet {
+	return CapabilitySet{
+		CapabilitySetType: CapabilitySetTypeBitmapCodecs,
+		BitmapCodecsCapabilitySet: &BitmapCodecsCapabilitySet{
+			BitmapCodecArray: []BitmapCodec{rfxBitmapCodec(mode, 1)},
+		},
+	}
+}
+
+// rfxBitmapCodec returns the RemoteFX bitmap codec entry for mode.
+func rfxBitmapCodec(mode RFXCodecMode, codecID uint8) BitmapCodec {
+	rfxProps := RFXClientCapsContainer{
+		CaptureFlags: rfxCaptureFlagsNonCAC,
+		Mode:         mode,
+	}
+	rfxGUID := RemoteFXImageGUID
+	if mode == RFXCodecModeVideo {
+		rfxGUID = RemoteFXGUID
+	}
+
+	return BitmapCodec{
+		CodecGUID:       rfxGUID,
+		CodecID:         codecID,
+		CodecProperties: rfxProps.Serialize(),
+	}
+}
+
 // RailCapabilitySet represents the Remote Programs Capability Set (MS-RDPBCGR 2.2.7.2.4).
 type RailCapabilitySet struct {
 	RailSupportLevel uint32
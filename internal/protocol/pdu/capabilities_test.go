@@ -2,6 +2,7 @@ package pdu
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"testing"
 
@@ -942,6 +943,72 @@ func Test_BitmapCodecsWithRFXCapabilitySet_Deserialize(t *testing.T) {
 	require.Equal(t, uint8(2), deserialized.BitmapCodecArray[1].CodecID)
 }
 
+func Test_BitmapCodecsWithRFXModeCapabilitySet(t *testing.T) {
+	tests := []struct {
+		name  string
+		mode  RFXCodecMode
+		guid  [16]byte
+		flags uint8
+	}{
+		{"image", RFXCodecModeImage, RemoteFXImageGUID, 0x02},
+		{"video", RFXCodecModeVideo, RemoteFXGUID, 0x00},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := NewBitmapCodecsWithRFXModeCapabilitySet(tt.mode)
+			serialized := set.Serialize()
+
+			var deserialized BitmapCodecsCapabilitySet
+			require.NoError(t, deserialized.Deserialize(bytes.NewReader(serialized[4:])))
+			require.Len(t, deserialized.BitmapCodecArray, 2)
+
+			rfx := deserialized.BitmapCodecArray[1]
+			require.Equal(t, tt.guid, rfx.CodecGUID)
+
+			// TS_RFX_CLNT_CAPS_CONTAINER: 12-byte header, TS_RFX_CAPS (8),
+			// TS_RFX_CAPSET header (13), then two 8-byte TS_RFX_ICAPs
+			props := rfx.CodecProperties
+			require.Len(t, props, 49)
+			require.Equal(t, uint32(49), binary.LittleEndian.Uint32(props[0:4]))
+			require.Equal(t, uint32(37), binary.LittleEndian.Uint32(props[8:12]))
+			require.Equal(t, uint16(0xCBC0), binary.LittleEndian.Uint16(props[12:14]))
+			require.Equal(t, uint16(0xCBC1), binary.LittleEndian.Uint16(props[20:22]))
+			require.Equal(t, uint16(2), binary.LittleEndian.Uint16(props[29:31]))
+
+			icaps := props[33:]
+			for i, entropy := range []uint8{0x01, 0x04} {
+				icap := icaps[i*8 : i*8+8]
+				require.Equal(t, uint16(0x0100), binary.LittleEndian.Uint16(icap[0:2]), "version")
+				require.Equal(t, uint16(64), binary.LittleEndian.Uint16(icap[2:4]), "tileSize")
+				require.Equal(t, tt.flags, icap[4], "flags")
+				require.Equal(t, entropy, icap[7], "entropyBits")
+			}
+		})
+	}
+
+	// The mode-less constructor keeps advertising image mode
+	def := NewBitmapCodecsWithRFXCapabilitySet()
+	image := NewBitmapCodecsWithRFXModeCapabilitySet(RFXCodecModeImage)
+	require.Equal(t, image.Serialize(), def.Serialize())
+}
+
+func Test_BitmapCodecsRFXOnlyCapabilitySet(t *testing.T) {
+	set := NewBitmapCodecsRFXOnlyCapabilitySet(RFXCodecModeVideo)
+	serialized := set.Serialize()
+
+	var deserialized BitmapCodecsCapabilitySet
+	require.NoError(t, deserialized.Deserialize(bytes.NewReader(serialized[4:])))
+	require.Len(t, deserialized.BitmapCodecArray, 1)
+	require.Equal(t, RemoteFXGUID, deserialized.BitmapCodecArray[0].CodecGUID)
+	require.Equal(t, uint8(1), deserialized.BitmapCodecArray[0].CodecID)
+
+	// Same RemoteFX properties as the combined set
+	combined := NewBitmapCodecsWithRFXModeCapabilitySet(RFXCodecModeVideo)
+	require.Equal(t, combined.BitmapCodecsCapabilitySet.BitmapCodecArray[1].CodecProperties,
+		deserialized.BitmapCodecArray[0].CodecProperties)
+}
+
 func Test_RailCapabilitySet_Serialize(t *testing.T) {
 	set := NewRailCapabilitySet()
 	serialized := set.Serialize()
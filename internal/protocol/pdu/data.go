@@ -24,6 +24,9 @@ const (
 
 	// TypeData PDUTYPE_DATAPDU
 	TypeData Type = 0x17
+
+	// TypeServerRedirect PDUTYPE_SERVER_REDIR_PKT
+	TypeServerRedirect Type = 0x1A
 )
 
 // IsDemandActive returns true if the PDU type is Demand Active.
@@ -46,6 +49,12 @@ func (t Type) IsData() bool {
 	return t == TypeData
 }
 
+// IsServerRedirect returns true if the PDU type is Server Redirection. Only
+// the type bits are compared, as some servers leave the version bits clear.
+func (t Type) IsServerRedirect() bool {
+	return t&0x0F == TypeServerRedirect&0x0F
+}
+
 // ShareControlHeader represents the TS_SHARECONTROLHEADER structure (MS-RDPBCGR 2.2.8.1.1.1.1).
 type ShareControlHeader struct {
 	TotalLength uint16
@@ -112,6 +121,12 @@ const (
 
 	// Type2SaveSessionInfo PDUTYPE2_SAVE_SESSION_INFO
 	Type2SaveSessionInfo Type2 = 0x26
+
+	// Type2MonitorLayout PDUTYPE2_MONITOR_LAYOUT_PDU
+	Type2MonitorLayout Type2 = 0x37
+
+	// Type2StatusInfo PDUTYPE2_STATUS_INFO_PDU
+	Type2StatusInfo Type2 = 0x36
 )
 
 // IsUpdate returns true if the PDU type 2 is Update.
@@ -159,6 +174,16 @@ func (t Type2) IsSaveSessionInfo() bool {
 	return t == Type2SaveSessionInfo
 }
 
+// IsMonitorLayout returns true if the PDU type 2 is Monitor Layout.
+func (t Type2) IsMonitorLayout() bool {
+	return t == Type2MonitorLayout
+}
+
+// IsStatusInfo returns true if the PDU type 2 is Status Info.
+func (t Type2) IsStatusInfo() bool {
+	return t == Type2StatusInfo
+}
+
 // ShareDataHeader represents the TS_SHAREDATAHEADER structure (MS-RDPBCGR 2.2.8.1.1.1.2).
 type ShareDataHeader struct {
 	ShareControlHeader ShareControlHeader
@@ -250,12 +275,15 @@ func (header *ShareDataHeader) Deserialize(wire io.Reader) error {
 
 // Data represents a share data PDU containing one of several data types (MS-RDPBCGR 2.2.8.1.1.1).
 type Data struct {
-	ShareDataHeader    ShareDataHeader
-	SynchronizePDUData *SynchronizePDUData
-	ControlPDUData     *ControlPDUData
-	FontListPDUData    *FontListPDUData
-	FontMapPDUData     *FontMapPDUData
-	ErrorInfoPDUData   *ErrorInfoPDUData
+	ShareDataHeader        ShareDataHeader
+	SynchronizePDUData     *SynchronizePDUData
+	ControlPDUData         *ControlPDUData
+	FontListPDUData        *FontListPDUData
+	FontMapPDUData         *FontMapPDUData
+	ErrorInfoPDUData       *ErrorInfoPDUData
+	MonitorLayoutPDUData   *MonitorLayoutPDUData
+	SaveSessionInfoPDUData *SaveSessionInfoPDUData
+	StatusInfoPDUData      *StatusInfoPDUData
 }
 
 // Serialize encodes the PDU to wire format.
@@ -307,8 +335,18 @@ func (pdu *Data) Deserialize(wire io.Reader) error {
 		pdu.ErrorInfoPDUData = &ErrorInfoPDUData{}
 
 		return pdu.ErrorInfoPDUData.Deserialize(wire)
-	case pdu.ShareDataHeader.PDUType2.IsSaveSessionInfo(): // ignore
-		return nil
+	case pdu.ShareDataHeader.PDUType2.IsMonitorLayout():
+		pdu.MonitorLayoutPDUData = &MonitorLayoutPDUData{}
+
+		return pdu.MonitorLayoutPDUData.Deserialize(wire)
+	case pdu.ShareDataHeader.PDUType2.IsSaveSessionInfo():
+		pdu.SaveSessionInfoPDUData = &SaveSessionInfoPDUData{}
+
+		return pdu.SaveSessionInfoPDUData.Deserialize(wire)
+	case pdu.ShareDataHeader.PDUType2.IsStatusInfo():
+		pdu.StatusInfoPDUData = &StatusInfoPDUData{}
+
+		return pdu.StatusInfoPDUData.Deserialize(wire)
 	case pdu.ShareDataHeader.PDUType2.IsUpdate(): // slow-path graphics update, handled via fastpath
 		return nil
 	case pdu.ShareDataHeader.PDUType2.IsPointer(): // pointer update, ignore for now
@@ -396,16 +396,19 @@ func TestData_DeserializeErrorInfo(t *testing.T) {
 
 func TestData_DeserializeSaveSessionInfo(t *testing.T) {
 	header := newShareDataHeader(66538, 1007, TypeData, Type2SaveSessionInfo)
-	header.ShareControlHeader.TotalLength = 18
-	header.UncompressedLength = 4
+	header.ShareControlHeader.TotalLength = 22
+	header.UncompressedLength = 8
 
 	buf := bytes.Buffer{}
 	buf.Write(header.Serialize())
+	buf.Write([]byte{0x02, 0x00, 0x00, 0x00}) // INFOTYPE_LOGON_PLAINNOTIFY
 
 	var data Data
 	err := data.Deserialize(&buf)
 	require.NoError(t, err)
-	// SaveSessionInfo is ignored
+	require.NotNil(t, data.SaveSessionInfoPDUData)
+	require.Equal(t, InfoTypeLogonPlainNotify, data.SaveSessionInfoPDUData.InfoType)
+	require.Nil(t, data.SaveSessionInfoPDUData.AutoReconnectCookie)
 }
 
 func TestData_DeserializeUpdate(t *testing.T) {
@@ -0,0 +1,64 @@
+package pdu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/rcarmo/go-rdp/internal/codec"
+)
+
+// SecHeartbeat SEC_HEARTBEAT marks a Server Heartbeat PDU in the basic
+// security header of a message channel PDU
+const SecHeartbeat uint16 = 0x4000
+
+// ClientMessageChannelData represents the Client Message Channel Data
+// (TS_UD_CS_MCS_MSGCHANNEL, MS-RDPBCGR 2.2.1.3.7). Sending it asks the
+// server for a message channel, which carries the Server Heartbeat PDU.
+type ClientMessageChannelData struct {
+	Flags uint32 // unused, must be zero
+}
+
+// Serialize encodes the ClientMessageChannelData into its wire format with a CS_MCS_MSGCHANNEL header.
+func (d ClientMessageChannelData) Serialize() []byte {
+	buf := new(bytes.Buffer)
+
+	_ = binary.Write(buf, binary.LittleEndian, uint16(0xC006)) // header type CS_MCS_MSGCHANNEL
+	_ = binary.Write(buf, binary.LittleEndian, uint16(8))      // header length
+	_ = binary.Write(buf, binary.LittleEndian, d.Flags)
+
+	return buf.Bytes()
+}
+
+// HeartbeatPDU represents the Server Heartbeat PDU (MS-RDPBCGR 2.2.16.1).
+// The server sends it every Period seconds so the client can tell a quiet
+// session from a dead connection; the client does not reply.
+type HeartbeatPDU struct {
+	Period uint8 // seconds between heartbeats
+	Count1 uint8 // missed heartbeats before the client should warn
+	Count2 uint8 // missed heartbeats before the client should reconnect
+}
+
+// Serialize encodes the PDU, including its basic security header.
+func (p *HeartbeatPDU) Serialize() []byte {
+	return codec.WrapSecurityFlag(SecHeartbeat, []byte{0x00, p.Period, p.Count1, p.Count2})
+}
+
+// Deserialize decodes the PDU, including its basic security header.
+func (p *HeartbeatPDU) Deserialize(wire io.Reader) error {
+	flags, err := codec.UnwrapSecurityFlag(wire)
+	if err != nil {
+		return err
+	}
+	if flags&SecHeartbeat == 0 {
+		return fmt.Errorf("heartbeat: unexpected security flags 0x%04X", flags)
+	}
+
+	var body [4]byte // reserved, period, count1, count2
+	if _, err := io.ReadFull(wire, body[:]); err != nil {
+		return fmt.Errorf("heartbeat: %w", err)
+	}
+	p.Period, p.Count1, p.Count2 = body[1], body[2], body[3]
+	return nil
+}
@@ -0,0 +1,45 @@
+package pdu
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientMessageChannelData_Serialize(t *testing.T) {
+	require.Equal(t, []byte{0x06, 0xC0, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00}, ClientMessageChannelData{}.Serialize())
+}
+
+func TestHeartbeatPDU_Serialize(t *testing.T) {
+	p := HeartbeatPDU{Period: 5, Count1: 3, Count2: 10}
+
+	// flags SEC_HEARTBEAT, flagsHi, reserved, period, count1, count2
+	require.Equal(t, []byte{0x00, 0x40, 0x00, 0x00, 0x00, 0x05, 0x03, 0x0A}, p.Serialize())
+}
+
+func TestHeartbeatPDU_Deserialize(t *testing.T) {
+	want := HeartbeatPDU{Period: 20, Count1: 2, Count2: 4}
+
+	var got HeartbeatPDU
+	require.NoError(t, got.Deserialize(bytes.NewReader(want.Serialize())))
+	require.Equal(t, want, got)
+}
+
+func TestHeartbeatPDU_Deserialize_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"not a heartbeat", []byte{0x00, 0x10, 0x00, 0x00, 0x00, 0x05, 0x03, 0x0A}},
+		{"truncated", []byte{0x00, 0x40, 0x00, 0x00, 0x00, 0x05}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p HeartbeatPDU
+			require.Error(t, p.Deserialize(bytes.NewReader(tt.data)))
+		})
+	}
+}
@@ -43,9 +43,9 @@ type InputEvent struct {
 func (e *InputEvent) Serialize() []byte {
 	buf := new(bytes.Buffer)
 
-	// event flags in higher 5 bits
-	// event code in lower 3 bits
-	header := (e.EventFlags&0x1f)<<3 | uint8(e.EventCode)&0x7
+	// event code in higher 3 bits
+	// event flags in lower 5 bits
+	header := (uint8(e.EventCode)&0x7)<<5 | e.EventFlags&0x1f
 
 	var data []byte
 
@@ -114,6 +114,19 @@ func NewUnicodeKeyboardEvent(unicodeCode uint16) *InputEvent {
 	}
 }
 
+// NewUnicodeKeyStrokes creates a press and a release Unicode keyboard event
+// for each UTF-16 code unit, so a surrogate pair is typed as two key strokes
+// (MS-RDPBCGR 2.2.8.1.2.2.2).
+func NewUnicodeKeyStrokes(units []uint16) []*InputEvent {
+	events := make([]*InputEvent, 0, 2*len(units))
+	for _, unit := range units {
+		press := NewUnicodeKeyboardEvent(unit)
+		press.EventFlags = 0
+		events = append(events, press, NewUnicodeKeyboardEvent(unit))
+	}
+	return events
+}
+
 func (e *unicodeKeyboardEvent) Serialize() []byte {
 	buf := new(bytes.Buffer)
 
@@ -131,6 +144,17 @@ const (
 	PTRFlagsButton1       uint16 = 0x1000
 	PTRFlagsButton2       uint16 = 0x2000
 	PTRFlagsButton3       uint16 = 0x4000
+
+	// WheelRotationMask covers the 9-bit two's complement rotation field
+	// carried by wheel events, including the PTRFLAGS_WHEEL_NEGATIVE sign bit
+	WheelRotationMask uint16 = 0x01FF
+)
+
+// Wheel rotation limits representable in the 9-bit rotation field, in units
+// of 1/120 of a detent (WHEEL_DELTA)
+const (
+	MaxWheelRotation = 255
+	MinWheelRotation = -256
 )
 
 type mouseEvent struct {
@@ -151,6 +175,27 @@ func NewMouseEvent(pointerFlags, xPos, yPos uint16) *InputEvent {
 	}
 }
 
+// NewMouseWheelEvent creates a vertical wheel event. Positive rotation
+// scrolls up, away from the user; values outside the 9-bit rotation field
+// are clamped.
+func NewMouseWheelEvent(rotation int, xPos, yPos uint16) *InputEvent {
+	return NewMouseEvent(PTRFlagsWheel|wheelRotation(rotation), xPos, yPos)
+}
+
+// NewMouseHWheelEvent creates a horizontal wheel event. Positive rotation
+// scrolls right; values outside the 9-bit rotation field are clamped.
+// Servers only honor it when the client advertises INPUT_FLAG_MOUSE_HWHEEL.
+func NewMouseHWheelEvent(rotation int, xPos, yPos uint16) *InputEvent {
+	return NewMouseEvent(PTRFlagsHWheel|wheelRotation(rotation), xPos, yPos)
+}
+
+// wheelRotation encodes rotation as the 9-bit two's complement value of the
+// pointer flags, so negative values set PTRFLAGS_WHEEL_NEGATIVE
+func wheelRotation(rotation int) uint16 {
+	rotation = max(MinWheelRotation, min(MaxWheelRotation, rotation))
+	return uint16(rotation) & WheelRotationMask // #nosec G115 -- masked to 9 bits
+}
+
 func (e *mouseEvent) Serialize() []byte {
 	buf := new(bytes.Buffer)
 
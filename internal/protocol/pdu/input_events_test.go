@@ -62,22 +62,22 @@ func TestKeyboardEvent_Serialize(t *testing.T) {
 			name:    "KeyA_Down",
 			flags:   0,
 			keyCode: 0x1E,
-			// header: flags(0)<<3 | code(0) = 0x00
+			// header: code(0)<<5 | flags(0) = 0x00
 			expected: []byte{0x00, 0x1E},
 		},
 		{
 			name:    "KeyA_Up",
 			flags:   KBDFlagsRelease,
 			keyCode: 0x1E,
-			// header: flags(1)<<3 | code(0) = 0x08
-			expected: []byte{0x08, 0x1E},
+			// header: code(0)<<5 | flags(1) = 0x01
+			expected: []byte{0x01, 0x1E},
 		},
 		{
 			name:    "Extended",
 			flags:   KBDFlagsExtended,
 			keyCode: 0x1D,
-			// header: flags(2)<<3 | code(0) = 0x10
-			expected: []byte{0x10, 0x1D},
+			// header: code(0)<<5 | flags(2) = 0x02
+			expected: []byte{0x02, 0x1D},
 		},
 	}
 
@@ -122,13 +122,13 @@ func TestUnicodeKeyboardEvent_Serialize(t *testing.T) {
 		{
 			name:        "CharA",
 			unicodeCode: 0x0041,
-			// header: flags(1)<<3 | code(4) = 0x0C
-			expected: []byte{0x0C, 0x41, 0x00},
+			// header: code(4)<<5 | flags(1) = 0x81
+			expected: []byte{0x81, 0x41, 0x00},
 		},
 		{
 			name:        "CharZ",
 			unicodeCode: 0x005A,
-			expected:    []byte{0x0C, 0x5A, 0x00},
+			expected:    []byte{0x81, 0x5A, 0x00},
 		},
 	}
 
@@ -141,6 +141,22 @@ func TestUnicodeKeyboardEvent_Serialize(t *testing.T) {
 	}
 }
 
+func TestNewUnicodeKeyStrokes(t *testing.T) {
+	// U+1F600 is the surrogate pair D83D DE00
+	events := NewUnicodeKeyStrokes([]uint16{0x00E9, 0xD83D, 0xDE00})
+	require.Len(t, events, 6)
+
+	var serialized [][]byte
+	for _, event := range events {
+		serialized = append(serialized, event.Serialize())
+	}
+	require.Equal(t, [][]byte{
+		{0x80, 0xE9, 0x00}, {0x81, 0xE9, 0x00},
+		{0x80, 0x3D, 0xD8}, {0x81, 0x3D, 0xD8},
+		{0x80, 0x00, 0xDE}, {0x81, 0x00, 0xDE},
+	}, serialized)
+}
+
 func TestNewMouseEvent(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -218,20 +234,20 @@ func TestMouseEvent_Serialize(t *testing.T) {
 			pointerFlags: PTRFlagsMove,
 			xPos:         100,
 			yPos:         200,
-			// header: flags(0)<<3 | code(1) = 0x01
+			// header: code(1)<<5 | flags(0) = 0x20
 			// pointerFlags: 0x0800 (little-endian: 0x00 0x08)
 			// xPos: 100 (little-endian: 0x64 0x00)
 			// yPos: 200 (little-endian: 0xC8 0x00)
-			expected: []byte{0x01, 0x00, 0x08, 0x64, 0x00, 0xC8, 0x00},
+			expected: []byte{0x20, 0x00, 0x08, 0x64, 0x00, 0xC8, 0x00},
 		},
 		{
 			name:         "LeftClickAt0_0",
 			pointerFlags: PTRFlagsDown | PTRFlagsButton1,
 			xPos:         0,
 			yPos:         0,
-			// header: 0x01
+			// header: 0x20
 			// pointerFlags: 0x9000 (0x8000 | 0x1000) -> little-endian: 0x00 0x90
-			expected: []byte{0x01, 0x00, 0x90, 0x00, 0x00, 0x00, 0x00},
+			expected: []byte{0x20, 0x00, 0x90, 0x00, 0x00, 0x00, 0x00},
 		},
 	}
 
@@ -244,6 +260,43 @@ func TestMouseEvent_Serialize(t *testing.T) {
 	}
 }
 
+func TestNewMouseWheelEvent(t *testing.T) {
+	tests := []struct {
+		name         string
+		horizontal   bool
+		rotation     int
+		pointerFlags uint16
+	}{
+		{"WheelUp", false, 120, PTRFlagsWheel | 0x0078},
+		{"WheelDown", false, -120, PTRFlagsWheel | PTRFlagsWheelNegative | 0x0088},
+		{"HighResUp", false, 1, PTRFlagsWheel | 0x0001},
+		{"HighResDown", false, -1, PTRFlagsWheel | PTRFlagsWheelNegative | 0x00FF},
+		{"ClampedUp", false, 1000, PTRFlagsWheel | 0x00FF},
+		{"ClampedDown", false, -1000, PTRFlagsWheel | PTRFlagsWheelNegative},
+		{"HWheelRight", true, 120, PTRFlagsHWheel | 0x0078},
+		{"HWheelLeft", true, -120, PTRFlagsHWheel | PTRFlagsWheelNegative | 0x0088},
+		{"HWheelClamped", true, -257, PTRFlagsHWheel | PTRFlagsWheelNegative},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := NewMouseWheelEvent(tt.rotation, 10, 20)
+			if tt.horizontal {
+				event = NewMouseHWheelEvent(tt.rotation, 10, 20)
+			}
+			require.Equal(t, EventCodeMouse, event.EventCode)
+			require.Equal(t, tt.pointerFlags, event.mouseEvent.pointerFlags)
+			require.Equal(t, uint16(10), event.mouseEvent.xPos)
+			require.Equal(t, uint16(20), event.mouseEvent.yPos)
+		})
+	}
+}
+
+func TestNewInputCapabilitySet_AdvertisesHWheel(t *testing.T) {
+	set := NewInputCapabilitySet()
+	require.NotZero(t, set.InputCapabilitySet.InputFlags&0x0100, "INPUT_FLAG_MOUSE_HWHEEL")
+}
+
 func TestNewExtendedMouseEvent(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -287,11 +340,11 @@ func TestNewExtendedMouseEvent(t *testing.T) {
 func TestExtendedMouseEvent_Serialize(t *testing.T) {
 	event := NewExtendedMouseEvent(PTRXFlagsDown|PTRXFlagsButton1, 100, 200)
 	serialized := event.Serialize()
-	// header: flags(0)<<3 | code(2) = 0x02
+	// header: code(2)<<5 | flags(0) = 0x40
 	// pointerFlags: 0x8001 -> little-endian: 0x01 0x80
 	// xPos: 100 -> 0x64 0x00
 	// yPos: 200 -> 0xC8 0x00
-	expected := []byte{0x02, 0x01, 0x80, 0x64, 0x00, 0xC8, 0x00}
+	expected := []byte{0x40, 0x01, 0x80, 0x64, 0x00, 0xC8, 0x00}
 	require.Equal(t, expected, serialized)
 }
 
@@ -327,20 +380,20 @@ func TestSynchronizeEvent_Serialize(t *testing.T) {
 		{
 			name:       "NoLocks",
 			eventFlags: 0,
-			// header: flags(0)<<3 | code(3) = 0x03
-			expected: []byte{0x03},
+			// header: code(3)<<5 | flags(0) = 0x60
+			expected: []byte{0x60},
 		},
 		{
 			name:       "NumLock",
 			eventFlags: SyncNumLock,
-			// header: flags(2)<<3 | code(3) = 0x13
-			expected: []byte{0x13},
+			// header: code(3)<<5 | flags(2) = 0x62
+			expected: []byte{0x62},
 		},
 		{
 			name:       "CapsLock",
 			eventFlags: SyncCapsLock,
-			// header: flags(4)<<3 | code(3) = 0x23
-			expected: []byte{0x23},
+			// header: code(3)<<5 | flags(4) = 0x64
+			expected: []byte{0x64},
 		},
 	}
 
@@ -377,9 +430,9 @@ func TestNewQualityOfExperienceEvent(t *testing.T) {
 func TestQualityOfExperienceEvent_Serialize(t *testing.T) {
 	event := NewQualityOfExperienceEvent(0x12345678)
 	serialized := event.Serialize()
-	// header: flags(0)<<3 | code(6) = 0x06
+	// header: code(6)<<5 | flags(0) = 0xC0
 	// timestamp: 0x12345678 -> little-endian: 0x78 0x56 0x34 0x12
-	expected := []byte{0x06, 0x78, 0x56, 0x34, 0x12}
+	expected := []byte{0xC0, 0x78, 0x56, 0x34, 0x12}
 	require.Equal(t, expected, serialized)
 }
 
@@ -400,8 +453,8 @@ func TestInputEvent_SerializeAllTypes(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			serialized := tt.event.Serialize()
 			require.NotEmpty(t, serialized)
-			// First byte should be the header with event code in lower 3 bits
-			eventCode := serialized[0] & 0x07
+			// First byte should be the header with event code in upper 3 bits
+			eventCode := serialized[0] >> 5
 			require.Equal(t, uint8(tt.event.EventCode), eventCode)
 		})
 	}
@@ -0,0 +1,137 @@
+package pdu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Logon notification types of TS_LOGON_ERRORS_INFO (MS-RDPBCGR 2.2.10.1.1.4.1.1).
+// Any other ErrorNotificationType is an NTSTATUS value.
+const (
+	// LogonMsgSessionBusyOptions LOGON_MSG_SESSION_BUSY_OPTIONS
+	LogonMsgSessionBusyOptions uint32 = 0xFFFFFFF8
+
+	// LogonMsgDisconnectRefused LOGON_MSG_DISCONNECT_REFUSED
+	LogonMsgDisconnectRefused uint32 = 0xFFFFFFF9
+
+	// LogonMsgNoPermission LOGON_MSG_NO_PERMISSION
+	LogonMsgNoPermission uint32 = 0xFFFFFFFA
+
+	// LogonMsgBumpOptions LOGON_MSG_BUMP_OPTIONS
+	LogonMsgBumpOptions uint32 = 0xFFFFFFFB
+
+	// LogonMsgReconnectOptions LOGON_MSG_RECONNECT_OPTIONS
+	LogonMsgReconnectOptions uint32 = 0xFFFFFFFC
+
+	// LogonMsgSessionTerminate LOGON_MSG_SESSION_TERMINATE
+	LogonMsgSessionTerminate uint32 = 0xFFFFFFFD
+
+	// LogonMsgSessionContinue LOGON_MSG_SESSION_CONTINUE
+	LogonMsgSessionContinue uint32 = 0xFFFFFFFE
+)
+
+// Logon results of TS_LOGON_ERRORS_INFO. Any other ErrorNotificationData is a session ID.
+const (
+	// LogonFailedBadPassword LOGON_FAILED_BAD_PASSWORD
+	LogonFailedBadPassword uint32 = 0x00000000
+
+	// LogonFailedUpdatePassword LOGON_FAILED_UPDATE_PASSWORD
+	LogonFailedUpdatePassword uint32 = 0x00000001
+
+	// LogonFailedOther LOGON_FAILED_OTHER
+	LogonFailedOther uint32 = 0x00000002
+
+	// LogonWarning LOGON_WARNING
+	LogonWarning uint32 = 0x00000003
+)
+
+// logonNotificationReasons describes the notification types and the
+// NTSTATUS values Winlogon reports for failed logons ([MS-ERREF] 2.3.1)
+var logonNotificationReasons = map[uint32]string{
+	LogonMsgSessionBusyOptions: "the session is busy",
+	LogonMsgDisconnectRefused:  "the connected user refused to disconnect",
+	LogonMsgNoPermission:       "no permission to connect to the session",
+	LogonMsgBumpOptions:        "another user is connected to the session",
+	LogonMsgReconnectOptions:   "a disconnected session can be reconnected",
+	LogonMsgSessionTerminate:   "the session was terminated",
+	LogonMsgSessionContinue:    "the logon continues",
+
+	0xC0000064: "unknown user name",                          // STATUS_NO_SUCH_USER
+	0xC000006A: "wrong password",                             // STATUS_WRONG_PASSWORD
+	0xC000006D: "wrong user name or password",                // STATUS_LOGON_FAILURE
+	0xC000006E: "account restrictions prevent logon",         // STATUS_ACCOUNT_RESTRICTION
+	0xC000006F: "logon is not allowed at this time",          // STATUS_INVALID_LOGON_HOURS
+	0xC0000070: "logon is not allowed from this workstation", // STATUS_INVALID_WORKSTATION
+	0xC0000071: "password expired",                           // STATUS_PASSWORD_EXPIRED
+	0xC0000072: "account disabled",                           // STATUS_ACCOUNT_DISABLED
+	0xC000015B: "remote logon is not granted to this user",   // STATUS_LOGON_TYPE_NOT_GRANTED
+	0xC0000193: "account expired",                            // STATUS_ACCOUNT_EXPIRED
+	0xC0000224: "password must be changed",                   // STATUS_PASSWORD_MUST_CHANGE
+	0xC0000234: "account locked",                             // STATUS_ACCOUNT_LOCKED_OUT
+}
+
+var logonResultReasons = map[uint32]string{
+	LogonFailedBadPassword:    "invalid credentials",
+	LogonFailedUpdatePassword: "password must be changed",
+	LogonFailedOther:          "logon failed",
+	LogonWarning:              "logon warning",
+}
+
+// LogonErrorsInfo represents the TS_LOGON_ERRORS_INFO structure (MS-RDPBCGR 2.2.10.1.1.4.1.1)
+// the server sends in extended logon info to report logon failures and
+// session notifications.
+type LogonErrorsInfo struct {
+	ErrorNotificationType uint32
+	ErrorNotificationData uint32
+}
+
+// Serialize encodes the structure to wire format, without cbFieldData.
+func (i *LogonErrorsInfo) Serialize() []byte {
+	buf := new(bytes.Buffer)
+
+	_ = binary.Write(buf, binary.LittleEndian, i.ErrorNotificationType)
+	_ = binary.Write(buf, binary.LittleEndian, i.ErrorNotificationData)
+
+	return buf.Bytes()
+}
+
+// Deserialize decodes the structure from wire format, without cbFieldData.
+func (i *LogonErrorsInfo) Deserialize(wire io.Reader) error {
+	if err := binary.Read(wire, binary.LittleEndian, &i.ErrorNotificationType); err != nil {
+		return err
+	}
+
+	return binary.Read(wire, binary.LittleEndian, &i.ErrorNotificationData)
+}
+
+// Failed returns true if the notification reports a failed logon rather
+// than a warning or a step of the logon.
+func (i *LogonErrorsInfo) Failed() bool {
+	if i.ErrorNotificationType == LogonMsgSessionContinue || i.ErrorNotificationType == LogonMsgReconnectOptions {
+		return false
+	}
+
+	return i.ErrorNotificationData != LogonWarning
+}
+
+// Reason returns a human-readable reason for the notification. The
+// notification type is preferred; when it is not a known value the logon
+// result is used.
+func (i *LogonErrorsInfo) Reason() string {
+	if reason, ok := logonNotificationReasons[i.ErrorNotificationType]; ok {
+		return reason
+	}
+
+	if reason, ok := logonResultReasons[i.ErrorNotificationData]; ok {
+		return reason
+	}
+
+	return fmt.Sprintf("logon error 0x%08X", i.ErrorNotificationType)
+}
+
+// String returns the reason followed by the raw codes.
+func (i *LogonErrorsInfo) String() string {
+	return fmt.Sprintf("%s (type 0x%08X, data 0x%08X)", i.Reason(), i.ErrorNotificationType, i.ErrorNotificationData)
+}
@@ -0,0 +1,51 @@
+package pdu
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogonErrorsInfo_RoundTrip(t *testing.T) {
+	info := &LogonErrorsInfo{ErrorNotificationType: LogonMsgSessionTerminate, ErrorNotificationData: LogonFailedBadPassword}
+
+	data := info.Serialize()
+	require.Equal(t, []byte{0xFD, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0x00, 0x00}, data)
+
+	var parsed LogonErrorsInfo
+	require.NoError(t, parsed.Deserialize(bytes.NewReader(data)))
+	require.Equal(t, *info, parsed)
+
+	require.Error(t, parsed.Deserialize(bytes.NewReader(data[:6])))
+}
+
+func TestLogonErrorsInfo_Reason(t *testing.T) {
+	tests := []struct {
+		name       string
+		info       LogonErrorsInfo
+		wantReason string
+		wantFailed bool
+	}{
+		{"account locked", LogonErrorsInfo{0xC0000234, LogonFailedOther}, "account locked", true},
+		{"password expired", LogonErrorsInfo{0xC0000071, LogonFailedUpdatePassword}, "password expired", true},
+		{"account disabled", LogonErrorsInfo{0xC0000072, LogonFailedOther}, "account disabled", true},
+		{"bad credentials", LogonErrorsInfo{0xC000006D, LogonFailedBadPassword}, "wrong user name or password", true},
+		{"no permission", LogonErrorsInfo{LogonMsgNoPermission, 7}, "no permission to connect to the session", true},
+		{"session continues", LogonErrorsInfo{LogonMsgSessionContinue, LogonFailedOther}, "the logon continues", false},
+		{"unknown status, known result", LogonErrorsInfo{0xC0000001, LogonFailedUpdatePassword}, "password must be changed", true},
+		{"unknown", LogonErrorsInfo{0xC0000001, 0x1234}, "logon error 0xC0000001", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.wantReason, tt.info.Reason())
+			require.Equal(t, tt.wantFailed, tt.info.Failed())
+		})
+	}
+}
+
+func TestLogonErrorsInfo_String(t *testing.T) {
+	info := &LogonErrorsInfo{ErrorNotificationType: 0xC0000234, ErrorNotificationData: LogonFailedOther}
+	require.Equal(t, "account locked (type 0xC0000234, data 0x00000002)", info.String())
+}
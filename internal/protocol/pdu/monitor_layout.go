@@ -0,0 +1,64 @@
+package pdu
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// MaxMonitorCount is the largest monitorCount a Monitor Layout PDU may carry (MS-RDPBCGR 2.2.12.1).
+const MaxMonitorCount = 16
+
+// MonitorFlagPrimary (TS_MONITOR_PRIMARY) marks the primary monitor.
+const MonitorFlagPrimary uint32 = 0x00000001
+
+// MonitorDef represents the TS_MONITOR_DEF structure (MS-RDPBCGR 2.2.1.3.6.1).
+// Right and Bottom are inclusive.
+type MonitorDef struct {
+	Left   int32
+	Top    int32
+	Right  int32
+	Bottom int32
+	Flags  uint32
+}
+
+// Width returns the monitor width in pixels.
+func (m MonitorDef) Width() int {
+	return int(m.Right) - int(m.Left) + 1
+}
+
+// Height returns the monitor height in pixels.
+func (m MonitorDef) Height() int {
+	return int(m.Bottom) - int(m.Top) + 1
+}
+
+// IsPrimary reports whether the monitor is the primary one.
+func (m MonitorDef) IsPrimary() bool {
+	return m.Flags&MonitorFlagPrimary != 0
+}
+
+// MonitorLayoutPDUData represents the TS_MONITOR_LAYOUT_PDU payload (MS-RDPBCGR 2.2.12.1).
+type MonitorLayoutPDUData struct {
+	Monitors []MonitorDef
+}
+
+// Deserialize decodes the PDU data from wire format.
+func (pdu *MonitorLayoutPDUData) Deserialize(wire io.Reader) error {
+	var monitorCount uint32
+	if err := binary.Read(wire, binary.LittleEndian, &monitorCount); err != nil {
+		return err
+	}
+
+	if monitorCount > MaxMonitorCount {
+		return fmt.Errorf("monitor layout: too many monitors: %d", monitorCount)
+	}
+
+	pdu.Monitors = make([]MonitorDef, monitorCount)
+	for i := range pdu.Monitors {
+		if err := binary.Read(wire, binary.LittleEndian, &pdu.Monitors[i]); err != nil {
+			return fmt.Errorf("monitor layout: monitor %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package pdu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// buildMonitorLayoutPDU encodes a Monitor Layout PDU carrying monitors.
+func buildMonitorLayoutPDU(monitors []MonitorDef) []byte {
+	body := new(bytes.Buffer)
+	_ = binary.Write(body, binary.LittleEndian, uint32(len(monitors)))
+	for _, m := range monitors {
+		_ = binary.Write(body, binary.LittleEndian, m)
+	}
+
+	header := newShareDataHeader(66538, 1002, TypeData, Type2MonitorLayout)
+	header.ShareControlHeader.TotalLength = uint16(18 + body.Len())
+	header.UncompressedLength = uint16(4 + body.Len())
+
+	buf := new(bytes.Buffer)
+	buf.Write(header.Serialize())
+	buf.Write(body.Bytes())
+	return buf.Bytes()
+}
+
+func TestData_DeserializeMonitorLayout(t *testing.T) {
+	// 1920x1080 primary on the left, 1280x1024 secondary on its right
+	wire := buildMonitorLayoutPDU([]MonitorDef{
+		{Left: 0, Top: 0, Right: 1919, Bottom: 1079, Flags: MonitorFlagPrimary},
+		{Left: 1920, Top: 0, Right: 3199, Bottom: 1023},
+	})
+
+	var data Data
+	require.NoError(t, data.Deserialize(bytes.NewReader(wire)))
+	require.True(t, data.ShareDataHeader.PDUType2.IsMonitorLayout())
+	require.NotNil(t, data.MonitorLayoutPDUData)
+
+	monitors := data.MonitorLayoutPDUData.Monitors
+	require.Len(t, monitors, 2)
+
+	require.True(t, monitors[0].IsPrimary())
+	require.Equal(t, 1920, monitors[0].Width())
+	require.Equal(t, 1080, monitors[0].Height())
+
+	require.False(t, monitors[1].IsPrimary())
+	require.Equal(t, int32(1920), monitors[1].Left)
+	require.Equal(t, 1280, monitors[1].Width())
+	require.Equal(t, 1024, monitors[1].Height())
+}
+
+func TestMonitorLayoutPDUData_NegativeOrigin(t *testing.T) {
+	// Monitors left of or above the primary have negative coordinates
+	body := new(bytes.Buffer)
+	_ = binary.Write(body, binary.LittleEndian, uint32(1))
+	_ = binary.Write(body, binary.LittleEndian, MonitorDef{Left: -1024, Top: -768, Right: -1, Bottom: -1})
+
+	var layout MonitorLayoutPDUData
+	require.NoError(t, layout.Deserialize(body))
+	require.Equal(t, int32(-1024), layout.Monitors[0].Left)
+	require.Equal(t, 1024, layout.Monitors[0].Width())
+	require.Equal(t, 768, layout.Monitors[0].Height())
+}
+
+func TestMonitorLayoutPDUData_DeserializeErrors(t *testing.T) {
+	var layout MonitorLayoutPDUData
+
+	require.Error(t, layout.Deserialize(bytes.NewReader(nil)))
+
+	tooMany := binary.LittleEndian.AppendUint32(nil, MaxMonitorCount+1)
+	require.Error(t, layout.Deserialize(bytes.NewReader(tooMany)))
+
+	// Count says two monitors but only one follows
+	truncated := new(bytes.Buffer)
+	_ = binary.Write(truncated, binary.LittleEndian, uint32(2))
+	_ = binary.Write(truncated, binary.LittleEndian, MonitorDef{Right: 1023, Bottom: 767})
+	require.Error(t, layout.Deserialize(truncated))
+}
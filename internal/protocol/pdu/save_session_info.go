@@ -0,0 +1,230 @@
+package pdu
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5" // #nosec G501 -- HMAC-MD5 is mandated by MS-RDPBCGR 5.5
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// InfoType identifies the logon notification carried by a Save Session Info PDU (MS-RDPBCGR 2.2.10.1.1).
+type InfoType uint32
+
+const (
+	// InfoTypeLogon INFOTYPE_LOGON
+	InfoTypeLogon InfoType = 0x00000000
+
+	// InfoTypeLogonLong INFOTYPE_LOGON_LONG
+	InfoTypeLogonLong InfoType = 0x00000001
+
+	// InfoTypeLogonPlainNotify INFOTYPE_LOGON_PLAINNOTIFY
+	InfoTypeLogonPlainNotify InfoType = 0x00000002
+
+	// InfoTypeLogonExtendedInfo INFOTYPE_LOGON_EXTENDED_INFO
+	InfoTypeLogonExtendedInfo InfoType = 0x00000003
+)
+
+// Fields present in TS_LOGON_INFO_EXTENDED (MS-RDPBCGR 2.2.10.1.1.4).
+const (
+	// logonExAutoReconnectCookie LOGON_EX_AUTORECONNECTCOOKIE
+	logonExAutoReconnectCookie uint32 = 0x00000001
+
+	// logonExLogonErrors LOGON_EX_LOGONERRORS
+	logonExLogonErrors uint32 = 0x00000002
+)
+
+// logonErrorsInfoLength is cbFieldData of TS_LOGON_ERRORS_INFO.
+const logonErrorsInfoLength = 8
+
+// ErrInvalidLogonErrorsInfo is returned when the logon errors field of extended logon info has the wrong length.
+var ErrInvalidLogonErrorsInfo = errors.New("invalid logon errors info")
+
+// Auto-reconnect cookie constants (MS-RDPBCGR 2.2.4.2, 2.2.4.3).
+const (
+	// AutoReconnectCookieLength is cbLen of both ARC_SC_PRIVATE_PACKET and ARC_CS_PRIVATE_PACKET.
+	AutoReconnectCookieLength = 28
+
+	// AutoReconnectVersion1 AUTO_RECONNECT_VERSION_1
+	AutoReconnectVersion1 uint32 = 0x00000001
+
+	// ClientRandomLength is the size of the client random the security verifier is computed over.
+	ClientRandomLength = 32
+)
+
+// ErrInvalidAutoReconnectCookie is returned when an auto-reconnect cookie has the wrong length or version.
+var ErrInvalidAutoReconnectCookie = errors.New("invalid auto-reconnect cookie")
+
+// ARCSCPrivatePacket represents the ARC_SC_PRIVATE_PACKET structure (MS-RDPBCGR 2.2.4.2)
+// the server sends so the client can reconnect without a full logon.
+type ARCSCPrivatePacket struct {
+	LogonID       uint32
+	ArcRandomBits [16]byte
+}
+
+// Serialize encodes the cookie to wire format.
+func (p *ARCSCPrivatePacket) Serialize() []byte {
+	buf := new(bytes.Buffer)
+
+	_ = binary.Write(buf, binary.LittleEndian, uint32(AutoReconnectCookieLength))
+	_ = binary.Write(buf, binary.LittleEndian, AutoReconnectVersion1)
+	_ = binary.Write(buf, binary.LittleEndian, p.LogonID)
+	buf.Write(p.ArcRandomBits[:])
+
+	return buf.Bytes()
+}
+
+// Deserialize decodes the cookie from wire format.
+func (p *ARCSCPrivatePacket) Deserialize(wire io.Reader) error {
+	var cbLen, version uint32
+
+	if err := binary.Read(wire, binary.LittleEndian, &cbLen); err != nil {
+		return err
+	}
+
+	if err := binary.Read(wire, binary.LittleEndian, &version); err != nil {
+		return err
+	}
+
+	if cbLen != AutoReconnectCookieLength || version != AutoReconnectVersion1 {
+		return fmt.Errorf("%w: length %d version %d", ErrInvalidAutoReconnectCookie, cbLen, version)
+	}
+
+	if err := binary.Read(wire, binary.LittleEndian, &p.LogonID); err != nil {
+		return err
+	}
+
+	_, err := io.ReadFull(wire, p.ArcRandomBits[:])
+
+	return err
+}
+
+// ParseARCSCPrivatePacket decodes a serialized ARC_SC_PRIVATE_PACKET.
+func ParseARCSCPrivatePacket(data []byte) (*ARCSCPrivatePacket, error) {
+	if len(data) != AutoReconnectCookieLength {
+		return nil, fmt.Errorf("%w: %d bytes", ErrInvalidAutoReconnectCookie, len(data))
+	}
+
+	p := &ARCSCPrivatePacket{}
+	if err := p.Deserialize(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// ARCCSPrivatePacket represents the ARC_CS_PRIVATE_PACKET structure (MS-RDPBCGR 2.2.4.3)
+// the client sends in the Client Info PDU to request automatic reconnection.
+type ARCCSPrivatePacket struct {
+	LogonID          uint32
+	SecurityVerifier [16]byte
+}
+
+// NewARCCSPrivatePacket answers a server cookie. The security verifier is
+// HMAC-MD5 keyed with ArcRandomBits over the client random (MS-RDPBCGR 5.5),
+// which is all zeros when Enhanced RDP Security is in effect.
+func NewARCCSPrivatePacket(cookie *ARCSCPrivatePacket, clientRandom []byte) *ARCCSPrivatePacket {
+	mac := hmac.New(md5.New, cookie.ArcRandomBits[:])
+	mac.Write(clientRandom)
+
+	p := &ARCCSPrivatePacket{LogonID: cookie.LogonID}
+	copy(p.SecurityVerifier[:], mac.Sum(nil))
+
+	return p
+}
+
+// Serialize encodes the packet to wire format.
+func (p *ARCCSPrivatePacket) Serialize() []byte {
+	buf := new(bytes.Buffer)
+
+	_ = binary.Write(buf, binary.LittleEndian, uint32(AutoReconnectCookieLength))
+	_ = binary.Write(buf, binary.LittleEndian, AutoReconnectVersion1)
+	_ = binary.Write(buf, binary.LittleEndian, p.LogonID)
+	buf.Write(p.SecurityVerifier[:])
+
+	return buf.Bytes()
+}
+
+// SaveSessionInfoPDUData represents the TS_SAVE_SESSION_INFO_PDU_DATA payload (MS-RDPBCGR 2.2.10.1.1).
+// Only the auto-reconnect cookie and logon errors of the extended logon info are decoded.
+type SaveSessionInfoPDUData struct {
+	InfoType InfoType
+	// FieldsPresent holds the LOGON_EX_* flags of extended logon info
+	FieldsPresent       uint32
+	AutoReconnectCookie *ARCSCPrivatePacket
+	LogonErrors         *LogonErrorsInfo
+}
+
+// AutoReconnectEnabled reports whether the server offered automatic
+// reconnection, which it does by sending a cookie in extended logon info.
+func (pdu *SaveSessionInfoPDUData) AutoReconnectEnabled() bool {
+	return pdu.AutoReconnectCookie != nil
+}
+
+// LogonID returns the ID the server assigned to the logon session, carried
+// by the auto-reconnect cookie, and false when the PDU has none.
+func (pdu *SaveSessionInfoPDUData) LogonID() (uint32, bool) {
+	if pdu.AutoReconnectCookie == nil {
+		return 0, false
+	}
+	return pdu.AutoReconnectCookie.LogonID, true
+}
+
+// Deserialize decodes the PDU data from wire format.
+func (pdu *SaveSessionInfoPDUData) Deserialize(wire io.Reader) error {
+	if err := binary.Read(wire, binary.LittleEndian, &pdu.InfoType); err != nil {
+		return err
+	}
+
+	if pdu.InfoType != InfoTypeLogonExtendedInfo {
+		return nil
+	}
+
+	var length uint16
+
+	if err := binary.Read(wire, binary.LittleEndian, &length); err != nil {
+		return err
+	}
+
+	if err := binary.Read(wire, binary.LittleEndian, &pdu.FieldsPresent); err != nil {
+		return err
+	}
+
+	// Fields follow in the order of their flags, each prefixed with cbFieldData
+	if pdu.FieldsPresent&logonExAutoReconnectCookie != 0 {
+		var cbFieldData uint32
+		if err := binary.Read(wire, binary.LittleEndian, &cbFieldData); err != nil {
+			return err
+		}
+
+		if cbFieldData != AutoReconnectCookieLength {
+			return fmt.Errorf("%w: field length %d", ErrInvalidAutoReconnectCookie, cbFieldData)
+		}
+
+		pdu.AutoReconnectCookie = &ARCSCPrivatePacket{}
+		if err := pdu.AutoReconnectCookie.Deserialize(wire); err != nil {
+			return err
+		}
+	}
+
+	if pdu.FieldsPresent&logonExLogonErrors != 0 {
+		var cbFieldData uint32
+		if err := binary.Read(wire, binary.LittleEndian, &cbFieldData); err != nil {
+			return err
+		}
+
+		if cbFieldData != logonErrorsInfoLength {
+			return fmt.Errorf("%w: field length %d", ErrInvalidLogonErrorsInfo, cbFieldData)
+		}
+
+		pdu.LogonErrors = &LogonErrorsInfo{}
+		if err := pdu.LogonErrors.Deserialize(wire); err != nil {
+			return err
+		}
+	}
+
+	// Padding follows and is not needed
+	return nil
+}
@@ -0,0 +1,176 @@
+package pdu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testAutoReconnectCookie() *ARCSCPrivatePacket {
+	cookie := &ARCSCPrivatePacket{LogonID: 0x00010203}
+	for i := range cookie.ArcRandomBits {
+		cookie.ArcRandomBits[i] = byte(i)
+	}
+	return cookie
+}
+
+// buildSaveSessionInfoPDU encodes a Save Session Info PDU carrying extended
+// logon info with the given auto-reconnect cookie.
+func buildSaveSessionInfoPDU(cookie *ARCSCPrivatePacket) []byte {
+	body := new(bytes.Buffer)
+	_ = binary.Write(body, binary.LittleEndian, uint32(InfoTypeLogonExtendedInfo))
+	_ = binary.Write(body, binary.LittleEndian, uint16(2+4+4+AutoReconnectCookieLength)) // Length
+	_ = binary.Write(body, binary.LittleEndian, logonExAutoReconnectCookie)              // FieldsPresent
+	_ = binary.Write(body, binary.LittleEndian, uint32(AutoReconnectCookieLength))       // cbFieldData
+	body.Write(cookie.Serialize())
+	body.Write(make([]byte, 570)) // Pad
+
+	header := newShareDataHeader(66538, 1002, TypeData, Type2SaveSessionInfo)
+	header.ShareControlHeader.TotalLength = uint16(18 + body.Len())
+	header.UncompressedLength = uint16(4 + body.Len())
+
+	return append(header.Serialize(), body.Bytes()...)
+}
+
+func TestData_DeserializeSaveSessionInfoAutoReconnectCookie(t *testing.T) {
+	cookie := testAutoReconnectCookie()
+
+	var data Data
+	require.NoError(t, data.Deserialize(bytes.NewReader(buildSaveSessionInfoPDU(cookie))))
+	require.NotNil(t, data.SaveSessionInfoPDUData)
+	require.Equal(t, InfoTypeLogonExtendedInfo, data.SaveSessionInfoPDUData.InfoType)
+	require.Equal(t, cookie, data.SaveSessionInfoPDUData.AutoReconnectCookie)
+}
+
+func TestSaveSessionInfoPDUData_ExtendedInfoWithoutCookie(t *testing.T) {
+	body := new(bytes.Buffer)
+	_ = binary.Write(body, binary.LittleEndian, uint32(InfoTypeLogonExtendedInfo))
+	_ = binary.Write(body, binary.LittleEndian, uint16(2+4+4+8))
+	_ = binary.Write(body, binary.LittleEndian, uint32(0x00000002)) // LOGON_EX_LOGONERRORS
+	_ = binary.Write(body, binary.LittleEndian, uint32(8))          // cbFieldData
+	body.Write(make([]byte, 8+570))
+
+	var data SaveSessionInfoPDUData
+	require.NoError(t, data.Deserialize(body))
+	require.Nil(t, data.AutoReconnectCookie)
+	require.Equal(t, &LogonErrorsInfo{}, data.LogonErrors)
+}
+
+func TestSaveSessionInfoPDUData_CookieAndLogonErrors(t *testing.T) {
+	cookie := testAutoReconnectCookie()
+	logonErrors := &LogonErrorsInfo{ErrorNotificationType: 0xC0000234, ErrorNotificationData: LogonFailedOther}
+
+	body := new(bytes.Buffer)
+	_ = binary.Write(body, binary.LittleEndian, uint32(InfoTypeLogonExtendedInfo))
+	_ = binary.Write(body, binary.LittleEndian, uint16(2+4+4+AutoReconnectCookieLength+4+8))
+	_ = binary.Write(body, binary.LittleEndian, logonExAutoReconnectCookie|logonExLogonErrors)
+	_ = binary.Write(body, binary.LittleEndian, uint32(AutoReconnectCookieLength))
+	body.Write(cookie.Serialize())
+	_ = binary.Write(body, binary.LittleEndian, uint32(8))
+	body.Write(logonErrors.Serialize())
+	body.Write(make([]byte, 570))
+
+	var data SaveSessionInfoPDUData
+	require.NoError(t, data.Deserialize(body))
+	require.Equal(t, cookie, data.AutoReconnectCookie)
+	require.Equal(t, logonErrors, data.LogonErrors)
+}
+
+func TestSaveSessionInfoPDUData_InvalidLogonErrors(t *testing.T) {
+	body := new(bytes.Buffer)
+	_ = binary.Write(body, binary.LittleEndian, uint32(InfoTypeLogonExtendedInfo))
+	_ = binary.Write(body, binary.LittleEndian, uint16(2+4+4+4))
+	_ = binary.Write(body, binary.LittleEndian, logonExLogonErrors)
+	_ = binary.Write(body, binary.LittleEndian, uint32(4))
+	body.Write(make([]byte, 4))
+
+	var data SaveSessionInfoPDUData
+	require.ErrorIs(t, data.Deserialize(body), ErrInvalidLogonErrorsInfo)
+}
+
+func TestSaveSessionInfoPDUData_InvalidCookie(t *testing.T) {
+	cookie := testAutoReconnectCookie().Serialize()
+	binary.LittleEndian.PutUint32(cookie[4:8], 2) // unknown version
+
+	body := new(bytes.Buffer)
+	_ = binary.Write(body, binary.LittleEndian, uint32(InfoTypeLogonExtendedInfo))
+	_ = binary.Write(body, binary.LittleEndian, uint16(2+4+4+AutoReconnectCookieLength))
+	_ = binary.Write(body, binary.LittleEndian, logonExAutoReconnectCookie)
+	_ = binary.Write(body, binary.LittleEndian, uint32(AutoReconnectCookieLength))
+	body.Write(cookie)
+
+	var data SaveSessionInfoPDUData
+	require.ErrorIs(t, data.Deserialize(body), ErrInvalidAutoReconnectCookie)
+}
+
+func TestARCSCPrivatePacket_RoundTrip(t *testing.T) {
+	cookie := testAutoReconnectCookie()
+
+	data := cookie.Serialize()
+	require.Len(t, data, AutoReconnectCookieLength)
+	require.Equal(t, []byte{0x1c, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x03, 0x02, 0x01, 0x00}, data[:12])
+
+	parsed, err := ParseARCSCPrivatePacket(data)
+	require.NoError(t, err)
+	require.Equal(t, cookie, parsed)
+
+	_, err = ParseARCSCPrivatePacket(data[:20])
+	require.ErrorIs(t, err, ErrInvalidAutoReconnectCookie)
+}
+
+func TestNewARCCSPrivatePacket(t *testing.T) {
+	packet := NewARCCSPrivatePacket(testAutoReconnectCookie(), make([]byte, ClientRandomLength))
+	require.Equal(t, uint32(0x00010203), packet.LogonID)
+
+	// HMAC-MD5(key = 00 01 .. 0f, data = 32 zero bytes)
+	require.Equal(t, [16]byte{
+		0xb6, 0x39, 0xc8, 0x73, 0x16, 0x38, 0x61, 0x8b, 0x70, 0x79, 0x72, 0xaa, 0x6e, 0x96, 0xcf, 0x90,
+	}, packet.SecurityVerifier)
+
+	data := packet.Serialize()
+	require.Len(t, data, AutoReconnectCookieLength)
+	require.Equal(t, packet.SecurityVerifier[:], data[12:])
+}
+
+func TestExtendedInfoPacket_AutoReconnectCookie(t *testing.T) {
+	plain := (&ExtendedInfoPacket{}).Serialize()
+
+	packet := NewARCCSPrivatePacket(testAutoReconnectCookie(), make([]byte, ClientRandomLength))
+	withCookie := (&ExtendedInfoPacket{AutoReconnectCookie: packet}).Serialize()
+
+	require.Len(t, withCookie, len(plain)+2+AutoReconnectCookieLength)
+	require.Equal(t, plain, withCookie[:len(plain)])
+	require.Equal(t, uint16(AutoReconnectCookieLength), binary.LittleEndian.Uint16(withCookie[len(plain):]))
+	require.Equal(t, packet.Serialize(), withCookie[len(plain)+2:])
+}
+
+func TestSaveSessionInfoPDUData_LogonExtended(t *testing.T) {
+	cookie := testAutoReconnectCookie()
+
+	var data Data
+	require.NoError(t, data.Deserialize(bytes.NewReader(buildSaveSessionInfoPDU(cookie))))
+	info := data.SaveSessionInfoPDUData
+	require.NotNil(t, info)
+	require.Equal(t, logonExAutoReconnectCookie, info.FieldsPresent)
+	require.True(t, info.AutoReconnectEnabled())
+	logonID, ok := info.LogonID()
+	require.True(t, ok)
+	require.Equal(t, uint32(0x00010203), logonID)
+
+	// Logon errors alone mean the server did not offer auto-reconnect
+	body := new(bytes.Buffer)
+	_ = binary.Write(body, binary.LittleEndian, uint32(InfoTypeLogonExtendedInfo))
+	_ = binary.Write(body, binary.LittleEndian, uint16(2+4+4+8))
+	_ = binary.Write(body, binary.LittleEndian, logonExLogonErrors)
+	_ = binary.Write(body, binary.LittleEndian, uint32(8))
+	body.Write(make([]byte, 8+570))
+
+	var errorsOnly SaveSessionInfoPDUData
+	require.NoError(t, errorsOnly.Deserialize(body))
+	require.Equal(t, logonExLogonErrors, errorsOnly.FieldsPresent)
+	require.False(t, errorsOnly.AutoReconnectEnabled())
+	_, ok = errorsOnly.LogonID()
+	require.False(t, ok)
+}
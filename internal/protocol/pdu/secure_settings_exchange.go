@@ -80,7 +80,8 @@ const (
 // ExtendedInfoPacket contains optional extended client information
 // sent during the Secure Settings Exchange (MS-RDPBCGR section 2.2.1.11.1.1.1).
 type ExtendedInfoPacket struct {
-	PerformanceFlags uint32
+	PerformanceFlags    uint32
+	AutoReconnectCookie *ARCCSPrivatePacket
 }
 
 func (p *ExtendedInfoPacket) Serialize() []byte {
@@ -95,6 +96,11 @@ func (p *ExtendedInfoPacket) Serialize() []byte {
 	_ = binary.Write(buf, binary.LittleEndian, uint32(0))      // ClientSessionId
 	_ = binary.Write(buf, binary.LittleEndian, p.PerformanceFlags)
 
+	if p.AutoReconnectCookie != nil {
+		_ = binary.Write(buf, binary.LittleEndian, uint16(AutoReconnectCookieLength)) // cbAutoReconnectCookie
+		buf.Write(p.AutoReconnectCookie.Serialize())
+	}
+
 	return buf.Bytes()
 }
 
@@ -0,0 +1,315 @@
+package pdu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf16"
+)
+
+// RedirectionFlag is a redirFlags bit of a Server Redirection Packet (MS-RDPBCGR 2.2.13.1).
+type RedirectionFlag uint32
+
+const (
+	// RedirFlagTargetNetAddress LB_TARGET_NET_ADDRESS
+	RedirFlagTargetNetAddress RedirectionFlag = 0x00000001
+
+	// RedirFlagLoadBalanceInfo LB_LOAD_BALANCE_INFO
+	RedirFlagLoadBalanceInfo RedirectionFlag = 0x00000002
+
+	// RedirFlagUsername LB_USERNAME
+	RedirFlagUsername RedirectionFlag = 0x00000004
+
+	// RedirFlagDomain LB_DOMAIN
+	RedirFlagDomain RedirectionFlag = 0x00000008
+
+	// RedirFlagPassword LB_PASSWORD
+	RedirFlagPassword RedirectionFlag = 0x00000010
+
+	// RedirFlagDontStoreUsername LB_DONTSTOREUSERNAME
+	RedirFlagDontStoreUsername RedirectionFlag = 0x00000020
+
+	// RedirFlagSmartcardLogon LB_SMARTCARD_LOGON
+	RedirFlagSmartcardLogon RedirectionFlag = 0x00000040
+
+	// RedirFlagNoRedirect LB_NOREDIRECT
+	RedirFlagNoRedirect RedirectionFlag = 0x00000080
+
+	// RedirFlagTargetFQDN LB_TARGET_FQDN
+	RedirFlagTargetFQDN RedirectionFlag = 0x00000100
+
+	// RedirFlagTargetNetBIOSName LB_TARGET_NETBIOS_NAME
+	RedirFlagTargetNetBIOSName RedirectionFlag = 0x00000200
+
+	// RedirFlagTargetNetAddresses LB_TARGET_NET_ADDRESSES
+	RedirFlagTargetNetAddresses RedirectionFlag = 0x00000800
+
+	// RedirFlagClientTSVURL LB_CLIENT_TSV_URL
+	RedirFlagClientTSVURL RedirectionFlag = 0x00001000
+
+	// RedirFlagServerTSVCapable LB_SERVER_TSV_CAPABLE
+	RedirFlagServerTSVCapable RedirectionFlag = 0x00002000
+
+	// RedirFlagPasswordIsPKEncrypted LB_PASSWORD_IS_PK_ENCRYPTED
+	RedirFlagPasswordIsPKEncrypted RedirectionFlag = 0x00004000
+
+	// RedirFlagRedirectionGUID LB_REDIRECTION_GUID
+	RedirFlagRedirectionGUID RedirectionFlag = 0x00008000
+
+	// RedirFlagTargetCertificate LB_TARGET_CERTIFICATE
+	RedirFlagTargetCertificate RedirectionFlag = 0x00010000
+)
+
+// secRedirectionPkt SEC_REDIRECTION_PKT is the flags value of every Server Redirection Packet
+const secRedirectionPkt uint16 = 0x0400
+
+// ErrInvalidServerRedirection is returned when a Server Redirection Packet is
+// truncated or a field overruns the packet
+var ErrInvalidServerRedirection = errors.New("invalid server redirection packet")
+
+// ServerRedirectionPacket represents the RDP_SERVER_REDIRECTION_PACKET
+// structure (MS-RDPBCGR 2.2.13.1). Fields absent from RedirFlags are empty.
+type ServerRedirectionPacket struct {
+	SessionID         uint32
+	RedirFlags        RedirectionFlag
+	TargetNetAddress  string
+	LoadBalanceInfo   []byte
+	Username          string
+	Domain            string
+	Password          []byte
+	TargetFQDN        string
+	TargetNetBIOSName string
+	TsvURL            []byte
+	RedirectionGUID   []byte
+	TargetCertificate []byte
+
+	// TargetNetAddresses lists every address of the target, IPv4 or IPv6
+	// (TARGET_NET_ADDRESSES, MS-RDPBCGR 2.2.13.1.1)
+	TargetNetAddresses []string
+}
+
+// Has returns true if flag is set in RedirFlags.
+func (p *ServerRedirectionPacket) Has(flag RedirectionFlag) bool {
+	return p.RedirFlags&flag == flag
+}
+
+// redirectionFields returns the optional fields in wire order. Each is
+// present only when its flag is set and holds either bytes or a string.
+func (p *ServerRedirectionPacket) redirectionFields() []redirectionField {
+	return []redirectionField{
+		{flag: RedirFlagTargetNetAddress, str: &p.TargetNetAddress},
+		{flag: RedirFlagLoadBalanceInfo, bytes: &p.LoadBalanceInfo},
+		{flag: RedirFlagUsername, str: &p.Username},
+		{flag: RedirFlagDomain, str: &p.Domain},
+		{flag: RedirFlagPassword, bytes: &p.Password},
+		{flag: RedirFlagTargetFQDN, str: &p.TargetFQDN},
+		{flag: RedirFlagTargetNetBIOSName, str: &p.TargetNetBIOSName},
+		{flag: RedirFlagClientTSVURL, bytes: &p.TsvURL},
+		{flag: RedirFlagRedirectionGUID, bytes: &p.RedirectionGUID},
+		{flag: RedirFlagTargetCertificate, bytes: &p.TargetCertificate},
+	}
+}
+
+type redirectionField struct {
+	flag  RedirectionFlag
+	bytes *[]byte
+	str   *string
+}
+
+// Serialize encodes the packet to wire format.
+func (p *ServerRedirectionPacket) Serialize() []byte {
+	body := new(bytes.Buffer)
+
+	_ = binary.Write(body, binary.LittleEndian, p.SessionID)
+	_ = binary.Write(body, binary.LittleEndian, p.RedirFlags)
+
+	writeField := func(value []byte) {
+		_ = binary.Write(body, binary.LittleEndian, uint32(len(value))) // #nosec G115
+		body.Write(value)
+	}
+	for _, field := range p.redirectionFields() {
+		if !p.Has(field.flag) {
+			continue
+		}
+		if field.str != nil {
+			writeField(encodeUnicodeString(*field.str))
+		} else {
+			writeField(*field.bytes)
+		}
+	}
+
+	if p.Has(RedirFlagTargetNetAddresses) {
+		addresses := new(bytes.Buffer)
+		_ = binary.Write(addresses, binary.LittleEndian, uint32(len(p.TargetNetAddresses))) // #nosec G115
+		for _, address := range p.TargetNetAddresses {
+			value := encodeUnicodeString(address)
+			_ = binary.Write(addresses, binary.LittleEndian, uint32(len(value))) // #nosec G115
+			addresses.Write(value)
+		}
+		writeField(addresses.Bytes())
+	}
+
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, binary.LittleEndian, secRedirectionPkt)
+	_ = binary.Write(buf, binary.LittleEndian, uint16(4+body.Len())) // #nosec G115
+	buf.Write(body.Bytes())
+
+	return buf.Bytes()
+}
+
+// Deserialize decodes the packet from wire format.
+func (p *ServerRedirectionPacket) Deserialize(wire io.Reader) error {
+	var flags, length uint16
+	if err := binary.Read(wire, binary.LittleEndian, &flags); err != nil {
+		return err
+	}
+	if err := binary.Read(wire, binary.LittleEndian, &length); err != nil {
+		return err
+	}
+	if flags != secRedirectionPkt || length < 12 {
+		return fmt.Errorf("%w: flags 0x%04X, length %d", ErrInvalidServerRedirection, flags, length)
+	}
+
+	body := make([]byte, length-4)
+	if _, err := io.ReadFull(wire, body); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidServerRedirection, err)
+	}
+	r := bytes.NewReader(body)
+
+	_ = binary.Read(r, binary.LittleEndian, &p.SessionID)
+	_ = binary.Read(r, binary.LittleEndian, &p.RedirFlags)
+
+	for _, field := range p.redirectionFields() {
+		if !p.Has(field.flag) {
+			continue
+		}
+		value, err := readRedirectionField(r)
+		if err != nil {
+			return err
+		}
+		if field.str != nil {
+			*field.str = decodeUnicodeString(value)
+		} else {
+			*field.bytes = value
+		}
+	}
+
+	if p.Has(RedirFlagTargetNetAddresses) {
+		value, err := readRedirectionField(r)
+		if err != nil {
+			return err
+		}
+		if p.TargetNetAddresses, err = parseTargetNetAddresses(value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readRedirectionField reads a field preceded by its 32-bit length
+func readRedirectionField(r *bytes.Reader) ([]byte, error) {
+	var length uint32
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		return nil, fmt.Errorf("%w: missing field length", ErrInvalidServerRedirection)
+	}
+	if int64(length) > int64(r.Len()) {
+		return nil, fmt.Errorf("%w: field length %d exceeds remaining %d bytes", ErrInvalidServerRedirection, length, r.Len())
+	}
+	value := make([]byte, length)
+	_, _ = io.ReadFull(r, value)
+	return value, nil
+}
+
+// parseTargetNetAddresses decodes the TARGET_NET_ADDRESSES structure
+// (MS-RDPBCGR 2.2.13.1.1): a count followed by that many length-prefixed
+// TARGET_NET_ADDRESS strings
+func parseTargetNetAddresses(data []byte) ([]string, error) {
+	r := bytes.NewReader(data)
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, fmt.Errorf("%w: missing address count", ErrInvalidServerRedirection)
+	}
+	// Each address takes at least its 4-byte length
+	if int64(count)*4 > int64(r.Len()) {
+		return nil, fmt.Errorf("%w: %d addresses in %d bytes", ErrInvalidServerRedirection, count, r.Len())
+	}
+
+	addresses := make([]string, 0, count)
+	for i := uint32(0); i < count; i++ {
+		value, err := readRedirectionField(r)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, decodeUnicodeString(value))
+	}
+	return addresses, nil
+}
+
+// encodeUnicodeString encodes a null-terminated UTF-16LE string
+func encodeUnicodeString(s string) []byte {
+	units := append(utf16.Encode([]rune(s)), 0)
+	data := make([]byte, 2*len(units))
+	for i, unit := range units {
+		binary.LittleEndian.PutUint16(data[2*i:], unit)
+	}
+	return data
+}
+
+// decodeUnicodeString decodes a UTF-16LE string, stopping at the first null
+func decodeUnicodeString(data []byte) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		unit := binary.LittleEndian.Uint16(data[i:])
+		if unit == 0 {
+			break
+		}
+		units = append(units, unit)
+	}
+	return string(utf16.Decode(units))
+}
+
+// ServerRedirectionPDU represents the Enhanced Security Server Redirection
+// PDU (MS-RDPBCGR 2.2.13.3.1), sent in place of the Demand Active PDU to move
+// the client to another server.
+type ServerRedirectionPDU struct {
+	ShareControlHeader ShareControlHeader
+	Packet             ServerRedirectionPacket
+}
+
+// Serialize encodes the PDU to wire format.
+func (pdu *ServerRedirectionPDU) Serialize() []byte {
+	packet := pdu.Packet.Serialize()
+
+	header := pdu.ShareControlHeader
+	header.PDUType = TypeServerRedirect
+	header.TotalLength = uint16(6 + 2 + len(packet) + 1) // #nosec G115
+
+	buf := new(bytes.Buffer)
+	buf.Write(header.Serialize())
+	buf.Write([]byte{0x00, 0x00}) // pad2Octets
+	buf.Write(packet)
+	buf.WriteByte(0x00) // pad1Octet
+
+	return buf.Bytes()
+}
+
+// Deserialize decodes the PDU from wire format.
+func (pdu *ServerRedirectionPDU) Deserialize(wire io.Reader) error {
+	if err := pdu.ShareControlHeader.Deserialize(wire); err != nil {
+		return err
+	}
+	if !pdu.ShareControlHeader.PDUType.IsServerRedirect() {
+		return fmt.Errorf("%w: PDU type 0x%04X", ErrInvalidServerRedirection, uint16(pdu.ShareControlHeader.PDUType))
+	}
+
+	var pad2Octets uint16
+	if err := binary.Read(wire, binary.LittleEndian, &pad2Octets); err != nil {
+		return err
+	}
+
+	// The trailing pad1Octet is not read
+	return pdu.Packet.Deserialize(wire)
+}
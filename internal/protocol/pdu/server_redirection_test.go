@@ -0,0 +1,89 @@
+package pdu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerRedirectionPDU_RoundTrip(t *testing.T) {
+	in := ServerRedirectionPDU{
+		ShareControlHeader: ShareControlHeader{PDUSource: 1002},
+		Packet: ServerRedirectionPacket{
+			SessionID: 7,
+			RedirFlags: RedirFlagTargetNetAddress | RedirFlagLoadBalanceInfo | RedirFlagUsername |
+				RedirFlagDomain | RedirFlagTargetFQDN | RedirFlagTargetNetAddresses,
+			TargetNetAddress:   "10.0.0.12",
+			LoadBalanceInfo:    []byte("Cookie: msts=3640205228.15629.0000\r\n"),
+			Username:           "alice",
+			Domain:             "CORP",
+			TargetFQDN:         "host12.corp.example",
+			TargetNetAddresses: []string{"10.0.0.12", "fe80::1%4", "2001:db8::12"},
+		},
+	}
+	data := in.Serialize()
+	assert.Equal(t, uint16(len(data)), binary.LittleEndian.Uint16(data[0:2]))
+
+	var out ServerRedirectionPDU
+	require.NoError(t, out.Deserialize(bytes.NewReader(data)))
+	assert.True(t, out.ShareControlHeader.PDUType.IsServerRedirect())
+	assert.Equal(t, in.Packet, out.Packet)
+}
+
+func TestServerRedirectionPacket_Deserialize(t *testing.T) {
+	// TargetNetAddress "h" and LoadBalanceInfo "tok"
+	data := []byte{
+		0x00, 0x04, 0x1F, 0x00, // SEC_REDIRECTION_PKT, length 31
+		0x02, 0x00, 0x00, 0x00, // SessionID
+		0x03, 0x00, 0x00, 0x00, // LB_TARGET_NET_ADDRESS | LB_LOAD_BALANCE_INFO
+		0x04, 0x00, 0x00, 0x00, 'h', 0x00, 0x00, 0x00,
+		0x03, 0x00, 0x00, 0x00, 't', 'o', 'k',
+		0x00, 0x00, 0x00, 0x00, // Pad
+	}
+
+	var p ServerRedirectionPacket
+	require.NoError(t, p.Deserialize(bytes.NewReader(data)))
+	assert.Equal(t, uint32(2), p.SessionID)
+	assert.Equal(t, "h", p.TargetNetAddress)
+	assert.Equal(t, []byte("tok"), p.LoadBalanceInfo)
+	assert.False(t, p.Has(RedirFlagUsername))
+}
+
+func TestServerRedirectionPacket_DeserializeInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"wrong flags", []byte{0x00, 0x00, 0x0C, 0x00, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"short length", []byte{0x00, 0x04, 0x08, 0x00, 0, 0, 0, 0}},
+		{"truncated packet", []byte{0x00, 0x04, 0x20, 0x00, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"field overruns packet", []byte{
+			0x00, 0x04, 0x10, 0x00,
+			0, 0, 0, 0,
+			0x01, 0x00, 0x00, 0x00,
+			0xFF, 0x00, 0x00, 0x00,
+		}},
+		{"address count overruns list", []byte{
+			0x00, 0x04, 0x14, 0x00,
+			0, 0, 0, 0,
+			0x00, 0x08, 0x00, 0x00, // LB_TARGET_NET_ADDRESSES
+			0x04, 0x00, 0x00, 0x00,
+			0x10, 0x00, 0x00, 0x00, // 16 addresses
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p ServerRedirectionPacket
+			assert.ErrorIs(t, p.Deserialize(bytes.NewReader(tt.data)), ErrInvalidServerRedirection)
+		})
+	}
+}
+
+func TestType_IsServerRedirect(t *testing.T) {
+	assert.True(t, TypeServerRedirect.IsServerRedirect())
+	assert.True(t, Type(0x000A).IsServerRedirect())
+	assert.False(t, TypeDemandActive.IsServerRedirect())
+}
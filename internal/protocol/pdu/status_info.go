@@ -0,0 +1,81 @@
+package pdu
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Status codes of the Server Status Info PDU (MS-RDPBCGR 2.2.5.2).
+const (
+	// StatusFindingDestination TS_STATUS_FINDING_DESTINATION
+	StatusFindingDestination uint32 = 0x00000401
+
+	// StatusLoadingDestination TS_STATUS_LOADING_DESTINATION
+	StatusLoadingDestination uint32 = 0x00000402
+
+	// StatusBringingSessionOnline TS_STATUS_BRINGING_SESSION_ONLINE
+	StatusBringingSessionOnline uint32 = 0x00000403
+
+	// StatusRedirectingToDestination TS_STATUS_REDIRECTING_TO_DESTINATION
+	StatusRedirectingToDestination uint32 = 0x00000404
+
+	// StatusVMLoading TS_STATUS_VM_LOADING
+	StatusVMLoading uint32 = 0x00000501
+
+	// StatusVMWaking TS_STATUS_VM_WAKING
+	StatusVMWaking uint32 = 0x00000502
+
+	// StatusVMStarting TS_STATUS_VM_STARTING
+	StatusVMStarting uint32 = 0x00000503
+
+	// StatusVMStartingMonitoring TS_STATUS_VM_STARTING_MONITORING
+	StatusVMStartingMonitoring uint32 = 0x00000504
+
+	// StatusVMRetryingMonitoring TS_STATUS_VM_RETRYING_MONITORING
+	StatusVMRetryingMonitoring uint32 = 0x00000505
+)
+
+var statusInfoMessages = map[uint32]string{
+	StatusFindingDestination:       "Finding the destination",
+	StatusLoadingDestination:       "Loading the destination",
+	StatusBringingSessionOnline:    "Bringing the session online",
+	StatusRedirectingToDestination: "Redirecting to the destination",
+	StatusVMLoading:                "Loading the virtual machine",
+	StatusVMWaking:                 "Waking the virtual machine",
+	StatusVMStarting:               "Starting the virtual machine",
+	StatusVMStartingMonitoring:     "Starting virtual machine monitoring",
+	StatusVMRetryingMonitoring:     "Retrying virtual machine monitoring",
+}
+
+// StatusInfoPDUData represents the TS_STATUS_INFO_PDU payload (MS-RDPBCGR 2.2.5.2).
+// A server that is still preparing the session, such as a connection broker
+// starting a virtual machine, sends it to report progress before the
+// capabilities exchange.
+type StatusInfoPDUData struct {
+	StatusCode uint32
+}
+
+// Serialize encodes the PDU data to wire format.
+func (pdu *StatusInfoPDUData) Serialize() []byte {
+	return binary.LittleEndian.AppendUint32(nil, pdu.StatusCode)
+}
+
+// Deserialize decodes the PDU data from wire format.
+func (pdu *StatusInfoPDUData) Deserialize(wire io.Reader) error {
+	return binary.Read(wire, binary.LittleEndian, &pdu.StatusCode)
+}
+
+// Message returns a human-readable description of the status code.
+func (pdu *StatusInfoPDUData) Message() string {
+	if message, ok := statusInfoMessages[pdu.StatusCode]; ok {
+		return message
+	}
+
+	return fmt.Sprintf("Connection status 0x%08X", pdu.StatusCode)
+}
+
+// String returns the description followed by the raw status code.
+func (pdu *StatusInfoPDUData) String() string {
+	return fmt.Sprintf("%s (0x%08X)", pdu.Message(), pdu.StatusCode)
+}
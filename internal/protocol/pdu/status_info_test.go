@@ -0,0 +1,48 @@
+package pdu
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusInfoPDUData_RoundTrip(t *testing.T) {
+	status := &StatusInfoPDUData{StatusCode: StatusBringingSessionOnline}
+
+	data := status.Serialize()
+	require.Equal(t, []byte{0x03, 0x04, 0x00, 0x00}, data)
+
+	var parsed StatusInfoPDUData
+	require.NoError(t, parsed.Deserialize(bytes.NewReader(data)))
+	require.Equal(t, *status, parsed)
+
+	require.Error(t, parsed.Deserialize(bytes.NewReader(data[:2])))
+}
+
+func TestStatusInfoPDUData_Message(t *testing.T) {
+	require.Equal(t, "Finding the destination", (&StatusInfoPDUData{StatusCode: StatusFindingDestination}).Message())
+	require.Equal(t, "Retrying virtual machine monitoring", (&StatusInfoPDUData{StatusCode: StatusVMRetryingMonitoring}).Message())
+	require.Equal(t, "Connection status 0x00000999", (&StatusInfoPDUData{StatusCode: 0x999}).Message())
+	require.Equal(t, "Waking the virtual machine (0x00000502)", (&StatusInfoPDUData{StatusCode: StatusVMWaking}).String())
+}
+
+func TestData_Deserialize_StatusInfo(t *testing.T) {
+	body := (&StatusInfoPDUData{StatusCode: StatusVMStarting}).Serialize()
+	header := ShareDataHeader{
+		ShareControlHeader: ShareControlHeader{
+			TotalLength: uint16(18 + len(body)),
+			PDUType:     TypeData,
+			PDUSource:   1002,
+		},
+		ShareID:            0x000103EA,
+		StreamID:           0x01,
+		UncompressedLength: uint16(4 + len(body)),
+		PDUType2:           Type2StatusInfo,
+	}
+
+	var data Data
+	require.NoError(t, data.Deserialize(bytes.NewReader(append(header.Serialize(), body...))))
+	require.NotNil(t, data.StatusInfoPDUData)
+	require.Equal(t, StatusVMStarting, data.StatusInfoPDUData.StatusCode)
+}
@@ -0,0 +1,445 @@
+package rdpdr
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf16"
+)
+
+// DeviceTypeFilesystem is RDPDR_DTYP_FILESYSTEM (MS-RDPEFS 2.2.1.3)
+const DeviceTypeFilesystem uint32 = 0x00000008
+
+// DriveCapabilityVersion2 is DRIVE_CAPABILITY_VERSION_02 (MS-RDPEFS 2.2.2.7.5)
+const DriveCapabilityVersion2 uint32 = 0x00000002
+
+// IRP major functions (MS-RDPEFS 2.2.1.4)
+const (
+	IRPCreate                 uint32 = 0x00000000 // IRP_MJ_CREATE
+	IRPClose                  uint32 = 0x00000002 // IRP_MJ_CLOSE
+	IRPRead                   uint32 = 0x00000003 // IRP_MJ_READ
+	IRPWrite                  uint32 = 0x00000004 // IRP_MJ_WRITE
+	IRPQueryInformation       uint32 = 0x00000005 // IRP_MJ_QUERY_INFORMATION
+	IRPSetInformation         uint32 = 0x00000006 // IRP_MJ_SET_INFORMATION
+	IRPQueryVolumeInformation uint32 = 0x0000000A // IRP_MJ_QUERY_VOLUME_INFORMATION
+	IRPSetVolumeInformation   uint32 = 0x0000000B // IRP_MJ_SET_VOLUME_INFORMATION
+	IRPDirectoryControl       uint32 = 0x0000000C // IRP_MJ_DIRECTORY_CONTROL
+	IRPDeviceControl          uint32 = 0x0000000E // IRP_MJ_DEVICE_CONTROL
+	IRPLockControl            uint32 = 0x00000011 // IRP_MJ_LOCK_CONTROL
+)
+
+// IRP minor functions of IRP_MJ_DIRECTORY_CONTROL (MS-RDPEFS 2.2.1.4)
+const (
+	IRPQueryDirectory        uint32 = 0x00000001 // IRP_MN_QUERY_DIRECTORY
+	IRPNotifyChangeDirectory uint32 = 0x00000002 // IRP_MN_NOTIFY_CHANGE_DIRECTORY
+)
+
+// NTSTATUS values returned in I/O completions (MS-ERREF 2.3)
+const (
+	StatusSuccess              uint32 = 0x00000000 // STATUS_SUCCESS
+	StatusNoMoreFiles          uint32 = 0x80000006 // STATUS_NO_MORE_FILES
+	StatusUnsuccessful         uint32 = 0xC0000001 // STATUS_UNSUCCESSFUL
+	StatusInvalidHandle        uint32 = 0xC0000008 // STATUS_INVALID_HANDLE
+	StatusInvalidParameter     uint32 = 0xC000000D // STATUS_INVALID_PARAMETER
+	StatusNoSuchFile           uint32 = 0xC000000F // STATUS_NO_SUCH_FILE
+	StatusInvalidDeviceRequest uint32 = 0xC0000010 // STATUS_INVALID_DEVICE_REQUEST
+	StatusAccessDenied         uint32 = 0xC0000022 // STATUS_ACCESS_DENIED
+	StatusObjectNameNotFound   uint32 = 0xC0000034 // STATUS_OBJECT_NAME_NOT_FOUND
+	StatusMediaWriteProtected  uint32 = 0xC00000A2 // STATUS_MEDIA_WRITE_PROTECTED
+	StatusFileIsADirectory     uint32 = 0xC00000BA // STATUS_FILE_IS_A_DIRECTORY
+	StatusNotSupported         uint32 = 0xC00000BB // STATUS_NOT_SUPPORTED
+	StatusNotADirectory        uint32 = 0xC0000103 // STATUS_NOT_A_DIRECTORY
+)
+
+// Create dispositions (MS-SMB2 2.2.13)
+const (
+	FileSupersede   uint32 = 0x00000000 // FILE_SUPERSEDE
+	FileOpen        uint32 = 0x00000001 // FILE_OPEN
+	FileCreate      uint32 = 0x00000002 // FILE_CREATE
+	FileOpenIf      uint32 = 0x00000003 // FILE_OPEN_IF
+	FileOverwrite   uint32 = 0x00000004 // FILE_OVERWRITE
+	FileOverwriteIf uint32 = 0x00000005 // FILE_OVERWRITE_IF
+)
+
+// Create options (MS-SMB2 2.2.13)
+const (
+	FileDirectoryFile    uint32 = 0x00000001 // FILE_DIRECTORY_FILE
+	FileNonDirectoryFile uint32 = 0x00000040 // FILE_NON_DIRECTORY_FILE
+	FileDeleteOnClose    uint32 = 0x00001000 // FILE_DELETE_ON_CLOSE
+)
+
+// AccessWriteMask holds the access rights (MS-SMB2 2.2.13.1.1) that modify a
+// file or its metadata: FILE_WRITE_DATA, FILE_APPEND_DATA, FILE_WRITE_EA,
+// FILE_DELETE_CHILD, FILE_WRITE_ATTRIBUTES, DELETE, WRITE_DAC, WRITE_OWNER,
+// GENERIC_ALL and GENERIC_WRITE.
+const AccessWriteMask uint32 = 0x00000002 | 0x00000004 | 0x00000010 | 0x00000040 | 0x00000100 |
+	0x00010000 | 0x00040000 | 0x00080000 | 0x10000000 | 0x40000000
+
+// FileOpened is the FILE_OPENED create result (MS-RDPEFS 2.2.1.5.1)
+const FileOpened uint8 = 0x01
+
+// File attributes (MS-FSCC 2.6)
+const (
+	FileAttributeReadOnly  uint32 = 0x00000001 // FILE_ATTRIBUTE_READONLY
+	FileAttributeHidden    uint32 = 0x00000002 // FILE_ATTRIBUTE_HIDDEN
+	FileAttributeDirectory uint32 = 0x00000010 // FILE_ATTRIBUTE_DIRECTORY
+	FileAttributeArchive   uint32 = 0x00000020 // FILE_ATTRIBUTE_ARCHIVE
+)
+
+// File information classes (MS-FSCC 2.4)
+const (
+	FileDirectoryInformation     uint32 = 1  // FileDirectoryInformation
+	FileFullDirectoryInformation uint32 = 2  // FileFullDirectoryInformation
+	FileBothDirectoryInformation uint32 = 3  // FileBothDirectoryInformation
+	FileBasicInformation         uint32 = 4  // FileBasicInformation
+	FileStandardInformation      uint32 = 5  // FileStandardInformation
+	FileNamesInformation         uint32 = 12 // FileNamesInformation
+	FileAttributeTagInformation  uint32 = 35 // FileAttributeTagInformation
+)
+
+// File system information classes (MS-FSCC 2.5)
+const (
+	FileFsVolumeInformation    uint32 = 1 // FileFsVolumeInformation
+	FileFsSizeInformation      uint32 = 3 // FileFsSizeInformation
+	FileFsDeviceInformation    uint32 = 4 // FileFsDeviceInformation
+	FileFsAttributeInformation uint32 = 5 // FileFsAttributeInformation
+	FileFsFullSizeInformation  uint32 = 7 // FileFsFullSizeInformation
+)
+
+// ioRequestHeaderSize is the size of DR_DEVICE_IOREQUEST after RDPDR_HEADER
+const ioRequestHeaderSize = 20
+
+// windowsEpochOffset is the number of 100ns intervals between 1601-01-01
+// and the Unix epoch
+const windowsEpochOffset = 116444736000000000
+
+// ErrUnsupportedInformationClass is returned when an information class has
+// no encoding.
+var ErrUnsupportedInformationClass = errors.New("unsupported information class")
+
+// DeviceAnnounce represents DEVICE_ANNOUNCE (MS-RDPEFS 2.2.1.3)
+type DeviceAnnounce struct {
+	DeviceType uint32
+	DeviceID   uint32
+	// PreferredDosName is the ASCII name the server shows, at most 7 characters
+	PreferredDosName string
+	DeviceData       []byte
+}
+
+// SerializeDeviceList encodes the body of a Client Device List Announce
+// Request (MS-RDPEFS 2.2.2.9) announcing devices
+func SerializeDeviceList(devices []DeviceAnnounce) []byte {
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(len(devices))) // #nosec G115
+	for _, d := range devices {
+		buf = binary.LittleEndian.AppendUint32(buf, d.DeviceType)
+		buf = binary.LittleEndian.AppendUint32(buf, d.DeviceID)
+		var dosName [8]byte
+		copy(dosName[:7], d.PreferredDosName)
+		buf = append(buf, dosName[:]...)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(d.DeviceData))) // #nosec G115
+		buf = append(buf, d.DeviceData...)
+	}
+	return buf
+}
+
+// ParseDeviceReply parses the body of a Server Device Announce Response
+// (MS-RDPEFS 2.2.2.1)
+func ParseDeviceReply(body []byte) (deviceID, resultCode uint32, err error) {
+	if len(body) < 8 {
+		return 0, 0, fmt.Errorf("%w: device reply too short", ErrInvalidPDU)
+	}
+	return binary.LittleEndian.Uint32(body[0:4]), binary.LittleEndian.Uint32(body[4:8]), nil
+}
+
+// IORequest represents DR_DEVICE_IOREQUEST (MS-RDPEFS 2.2.1.4). Body holds
+// the request-specific fields that follow the common header.
+type IORequest struct {
+	DeviceID      uint32
+	FileID        uint32
+	CompletionID  uint32
+	MajorFunction uint32
+	MinorFunction uint32
+	Body          []byte
+}
+
+// ParseIORequest parses the body of a Device I/O Request
+func ParseIORequest(body []byte) (*IORequest, error) {
+	if len(body) < ioRequestHeaderSize {
+		return nil, fmt.Errorf("%w: I/O request too short", ErrInvalidPDU)
+	}
+	return &IORequest{
+		DeviceID:      binary.LittleEndian.Uint32(body[0:4]),
+		FileID:        binary.LittleEndian.Uint32(body[4:8]),
+		CompletionID:  binary.LittleEndian.Uint32(body[8:12]),
+		MajorFunction: binary.LittleEndian.Uint32(body[12:16]),
+		MinorFunction: binary.LittleEndian.Uint32(body[16:20]),
+		Body:          body[ioRequestHeaderSize:],
+	}, nil
+}
+
+// SerializeIOCompletion encodes the body of a Device I/O Response
+// (MS-RDPEFS 2.2.1.5) completing r with status and the response-specific
+// payload
+func (r *IORequest) SerializeIOCompletion(status uint32, payload []byte) []byte {
+	buf := make([]byte, 12, 12+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], r.DeviceID)
+	binary.LittleEndian.PutUint32(buf[4:8], r.CompletionID)
+	binary.LittleEndian.PutUint32(buf[8:12], status)
+	return append(buf, payload...)
+}
+
+// SerializeIOFailure encodes a Device I/O Response failing r with status,
+// carrying the empty response of its major function
+func (r *IORequest) SerializeIOFailure(status uint32) []byte {
+	var payload []byte
+	switch r.MajorFunction {
+	case IRPCreate, IRPWrite, IRPDirectoryControl:
+		// FileId and Information; Length and Padding
+		payload = make([]byte, 5)
+	case IRPClose, IRPLockControl:
+		payload = make([]byte, 5) // Padding
+	default:
+		payload = make([]byte, 4) // Length or OutputBufferLength
+	}
+	return r.SerializeIOCompletion(status, payload)
+}
+
+// SerializeCreateResponse encodes DR_CREATE_RSP after the completion header
+func SerializeCreateResponse(fileID uint32, information uint8) []byte {
+	return append(binary.LittleEndian.AppendUint32(nil, fileID), information)
+}
+
+// SerializeLengthResponse encodes the Length-prefixed buffer that read,
+// query information and query directory responses carry
+func SerializeLengthResponse(data []byte) []byte {
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(len(data))) // #nosec G115
+	return append(buf, data...)
+}
+
+// CreateRequest represents DR_CREATE_REQ (MS-RDPEFS 2.2.1.4.1)
+type CreateRequest struct {
+	DesiredAccess     uint32
+	AllocationSize    uint64
+	FileAttributes    uint32
+	SharedAccess      uint32
+	CreateDisposition uint32
+	CreateOptions     uint32
+	Path              string
+}
+
+// ParseCreateRequest parses the body of a create request
+func ParseCreateRequest(body []byte) (*CreateRequest, error) {
+	if len(body) < 32 {
+		return nil, fmt.Errorf("%w: create request too short", ErrInvalidPDU)
+	}
+	pathLen := binary.LittleEndian.Uint32(body[28:32])
+	if uint64(pathLen) > uint64(len(body)-32) {
+		return nil, fmt.Errorf("%w: create path length %d", ErrInvalidPDU, pathLen)
+	}
+	return &CreateRequest{
+		DesiredAccess:     binary.LittleEndian.Uint32(body[0:4]),
+		AllocationSize:    binary.LittleEndian.Uint64(body[4:12]),
+		FileAttributes:    binary.LittleEndian.Uint32(body[12:16]),
+		SharedAccess:      binary.LittleEndian.Uint32(body[16:20]),
+		CreateDisposition: binary.LittleEndian.Uint32(body[20:24]),
+		CreateOptions:     binary.LittleEndian.Uint32(body[24:28]),
+		Path:              decodeUTF16(body[32 : 32+pathLen]),
+	}, nil
+}
+
+// ReadRequest represents DR_READ_REQ (MS-RDPEFS 2.2.1.4.3)
+type ReadRequest struct {
+	Length uint32
+	Offset uint64
+}
+
+// ParseReadRequest parses the body of a read request
+func ParseReadRequest(body []byte) (*ReadRequest, error) {
+	if len(body) < 12 {
+		return nil, fmt.Errorf("%w: read request too short", ErrInvalidPDU)
+	}
+	return &ReadRequest{
+		Length: binary.LittleEndian.Uint32(body[0:4]),
+		Offset: binary.LittleEndian.Uint64(body[4:12]),
+	}, nil
+}
+
+// ParseQueryInformationRequest parses the body of a query information or
+// query volume information request (MS-RDPEFS 2.2.3.3.8, 2.2.3.3.6),
+// returning the requested information class
+func ParseQueryInformationRequest(body []byte) (uint32, error) {
+	if len(body) < 4 {
+		return 0, fmt.Errorf("%w: query information request too short", ErrInvalidPDU)
+	}
+	return binary.LittleEndian.Uint32(body[0:4]), nil
+}
+
+// QueryDirectoryRequest represents DR_DRIVE_QUERY_DIRECTORY_REQ
+// (MS-RDPEFS 2.2.3.3.10)
+type QueryDirectoryRequest struct {
+	InformationClass uint32
+	InitialQuery     bool
+	// Path is the search pattern, such as \dir\*, sent with initial queries
+	Path string
+}
+
+// ParseQueryDirectoryRequest parses the body of a query directory request
+func ParseQueryDirectoryRequest(body []byte) (*QueryDirectoryRequest, error) {
+	if len(body) < 32 {
+		return nil, fmt.Errorf("%w: query directory request too short", ErrInvalidPDU)
+	}
+	pathLen := binary.LittleEndian.Uint32(body[5:9])
+	if uint64(pathLen) > uint64(len(body)-32) {
+		return nil, fmt.Errorf("%w: query directory path length %d", ErrInvalidPDU, pathLen)
+	}
+	return &QueryDirectoryRequest{
+		InformationClass: binary.LittleEndian.Uint32(body[0:4]),
+		InitialQuery:     body[4] != 0,
+		Path:             decodeUTF16(body[32 : 32+pathLen]),
+	}, nil
+}
+
+// FileInfo describes a file for the information class encoders
+type FileInfo struct {
+	Name       string
+	Size       int64
+	ModTime    time.Time
+	Attributes uint32
+}
+
+func (f *FileInfo) isDir() bool {
+	return f.Attributes&FileAttributeDirectory != 0
+}
+
+// EncodeFileInformation encodes the FileBasicInformation,
+// FileStandardInformation or FileAttributeTagInformation of f
+// (MS-RDPEFS 2.2.3.4.8)
+func EncodeFileInformation(class uint32, f *FileInfo) ([]byte, error) {
+	switch class {
+	case FileBasicInformation:
+		buf := appendTimes(nil, f.ModTime)
+		return binary.LittleEndian.AppendUint32(buf, f.Attributes), nil
+	case FileStandardInformation:
+		buf := binary.LittleEndian.AppendUint64(nil, uint64(f.Size)) // #nosec G115 -- AllocationSize
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(f.Size))  // #nosec G115 -- EndOfFile
+		buf = binary.LittleEndian.AppendUint32(buf, 1)               // NumberOfLinks
+		buf = append(buf, 0)                                         // DeletePending
+		if f.isDir() {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case FileAttributeTagInformation:
+		buf := binary.LittleEndian.AppendUint32(nil, f.Attributes)
+		return binary.LittleEndian.AppendUint32(buf, 0), nil // ReparseTag
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedInformationClass, class)
+	}
+}
+
+// EncodeDirectoryInformation encodes one directory entry of class for f,
+// as returned by a query directory request (MS-RDPEFS 2.2.3.4.10)
+func EncodeDirectoryInformation(class uint32, f *FileInfo) ([]byte, error) {
+	name := encodeUTF16(f.Name)
+
+	buf := binary.LittleEndian.AppendUint32(nil, 0) // NextEntryOffset
+	buf = binary.LittleEndian.AppendUint32(buf, 0)  // FileIndex
+	if class == FileNamesInformation {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(name))) // #nosec G115
+		return append(buf, name...), nil
+	}
+
+	buf = appendTimes(buf, f.ModTime)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(f.Size)) // #nosec G115 -- EndOfFile
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(f.Size)) // #nosec G115 -- AllocationSize
+	buf = binary.LittleEndian.AppendUint32(buf, f.Attributes)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(name))) // #nosec G115
+
+	switch class {
+	case FileDirectoryInformation:
+	case FileFullDirectoryInformation:
+		buf = binary.LittleEndian.AppendUint32(buf, 0) // EaSize
+	case FileBothDirectoryInformation:
+		buf = binary.LittleEndian.AppendUint32(buf, 0) // EaSize
+		buf = append(buf, 0, 0)                        // ShortNameLength, Reserved
+		buf = append(buf, make([]byte, 24)...)         // ShortName
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedInformationClass, class)
+	}
+	return append(buf, name...), nil
+}
+
+// EncodeVolumeInformation encodes the file system information of class for
+// a read-only volume named label (MS-RDPEFS 2.2.3.4.6). The volume reports
+// no free space.
+func EncodeVolumeInformation(class uint32, label string) ([]byte, error) {
+	switch class {
+	case FileFsVolumeInformation:
+		name := encodeUTF16(label)
+		buf := binary.LittleEndian.AppendUint64(nil, 0)                // VolumeCreationTime
+		buf = binary.LittleEndian.AppendUint32(buf, 0)                 // VolumeSerialNumber
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(name))) // #nosec G115
+		buf = append(buf, 0, 0)                                        // SupportsObjects, Reserved
+		return append(buf, name...), nil
+	case FileFsSizeInformation:
+		buf := binary.LittleEndian.AppendUint64(nil, 0) // TotalAllocationUnits
+		buf = binary.LittleEndian.AppendUint64(buf, 0)  // AvailableAllocationUnits
+		return appendAllocationUnit(buf), nil
+	case FileFsDeviceInformation:
+		buf := binary.LittleEndian.AppendUint32(nil, 0x00000007)      // FILE_DEVICE_DISK
+		return binary.LittleEndian.AppendUint32(buf, 0x00000012), nil // FILE_READ_ONLY_DEVICE | FILE_REMOTE_DEVICE
+	case FileFsAttributeInformation:
+		name := encodeUTF16("FAT32")
+		// FILE_CASE_PRESERVED_NAMES | FILE_UNICODE_ON_DISK | FILE_READ_ONLY_VOLUME
+		buf := binary.LittleEndian.AppendUint32(nil, 0x00000002|0x00000004|0x00080000)
+		buf = binary.LittleEndian.AppendUint32(buf, 255)               // MaximumComponentNameLength
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(name))) // #nosec G115
+		return append(buf, name...), nil
+	case FileFsFullSizeInformation:
+		buf := binary.LittleEndian.AppendUint64(nil, 0) // TotalAllocationUnits
+		buf = binary.LittleEndian.AppendUint64(buf, 0)  // CallerAvailableAllocationUnits
+		buf = binary.LittleEndian.AppendUint64(buf, 0)  // ActualAvailableAllocationUnits
+		return appendAllocationUnit(buf), nil
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedInformationClass, class)
+	}
+}
+
+// appendAllocationUnit appends SectorsPerAllocationUnit and BytesPerSector
+func appendAllocationUnit(buf []byte) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, 8)
+	return binary.LittleEndian.AppendUint32(buf, 512)
+}
+
+// appendTimes appends the creation, last access, last write and change
+// times, all set to t, as FILETIMEs
+func appendTimes(buf []byte, t time.Time) []byte {
+	fileTime := uint64(t.UnixNano()/100 + windowsEpochOffset) // #nosec G115 -- times after 1601
+	for range 4 {
+		buf = binary.LittleEndian.AppendUint64(buf, fileTime)
+	}
+	return buf
+}
+
+// encodeUTF16 encodes s as UTF-16LE without a terminator
+func encodeUTF16(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	buf := make([]byte, 0, 2*len(units))
+	for _, u := range units {
+		buf = binary.LittleEndian.AppendUint16(buf, u)
+	}
+	return buf
+}
+
+// decodeUTF16 decodes a UTF-16LE string, stopping at a null terminator
+func decodeUTF16(data []byte) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		unit := binary.LittleEndian.Uint16(data[i:])
+		if unit == 0 {
+			break
+		}
+		units = append(units, unit)
+	}
+	return string(utf16.Decode(units))
+}
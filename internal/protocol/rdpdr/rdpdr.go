@@ -0,0 +1,251 @@
+// Package rdpdr implements the File System Virtual Channel Extension
+// (MS-RDPEFS): the core handshake (announce, client name, capability
+// exchange and device list) and the I/O requests of a read-only file system
+// device. Completing the handshake with no devices is enough for servers
+// that otherwise wait on the channel (for example during smartcard logon).
+package rdpdr
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// ChannelName is the static virtual channel name for device redirection
+const ChannelName = "rdpdr"
+
+// Component types (MS-RDPEFS 2.2.1.1)
+const (
+	ComponentCore    uint16 = 0x4472 // RDPDR_CTYP_CORE
+	ComponentPrinter uint16 = 0x5052 // RDPDR_CTYP_PRN
+)
+
+// Packet IDs (MS-RDPEFS 2.2.1.1)
+const (
+	PacketServerAnnounce     uint16 = 0x496E // PAKID_CORE_SERVER_ANNOUNCE
+	PacketClientIDConfirm    uint16 = 0x4343 // PAKID_CORE_CLIENTID_CONFIRM
+	PacketClientName         uint16 = 0x434E // PAKID_CORE_CLIENT_NAME
+	PacketDeviceListAnnounce uint16 = 0x4441 // PAKID_CORE_DEVICELIST_ANNOUNCE
+	PacketDeviceReply        uint16 = 0x6472 // PAKID_CORE_DEVICE_REPLY
+	PacketDeviceIORequest    uint16 = 0x4952 // PAKID_CORE_DEVICE_IOREQUEST
+	PacketDeviceIOCompletion uint16 = 0x4943 // PAKID_CORE_DEVICE_IOCOMPLETION
+	PacketServerCapability   uint16 = 0x5350 // PAKID_CORE_SERVER_CAPABILITY
+	PacketClientCapability   uint16 = 0x4350 // PAKID_CORE_CLIENT_CAPABILITY
+	PacketDeviceListRemove   uint16 = 0x444D // PAKID_CORE_DEVICELIST_REMOVE
+	PacketUserLoggedOn       uint16 = 0x554C // PAKID_CORE_USER_LOGGEDON
+)
+
+// Capability types (MS-RDPEFS 2.2.1.2.1)
+const (
+	CapTypeGeneral   uint16 = 0x0001 // CAP_GENERAL_TYPE
+	CapTypePrinter   uint16 = 0x0002 // CAP_PRINTER_TYPE
+	CapTypePort      uint16 = 0x0003 // CAP_PORT_TYPE
+	CapTypeDrive     uint16 = 0x0004 // CAP_DRIVE_TYPE
+	CapTypeSmartcard uint16 = 0x0005 // CAP_SMARTCARD_TYPE
+)
+
+// General capability constants (MS-RDPEFS 2.2.2.7.1)
+const (
+	GeneralCapabilityVersion2 uint32 = 0x00000002 // GENERAL_CAPABILITY_VERSION_02
+
+	ExtendedPDUDeviceRemove      uint32 = 0x00000001 // RDPDR_DEVICE_REMOVE_PDUS
+	ExtendedPDUClientDisplayName uint32 = 0x00000002 // RDPDR_CLIENT_DISPLAY_NAME_PDU
+	ExtendedPDUUserLoggedOn      uint32 = 0x00000004 // RDPDR_USER_LOGGEDON_PDU
+
+	// IOCode1All advertises every I/O request type in ioCode1
+	IOCode1All uint32 = 0x0000FFFF
+)
+
+// Protocol version advertised by the client (MS-RDPEFS 2.2.2.3)
+const (
+	VersionMajor uint16 = 0x0001
+	VersionMinor uint16 = 0x000C
+)
+
+// HeaderSize is the size of RDPDR_HEADER
+const HeaderSize = 4
+
+// generalCapabilityLength is the size of a version 2 GENERAL_CAPS_SET
+// including its CAPABILITY_HEADER
+const generalCapabilityLength = 44
+
+// ErrInvalidPDU is returned when a device redirection PDU is truncated or malformed.
+var ErrInvalidPDU = errors.New("invalid rdpdr PDU")
+
+// Header represents RDPDR_HEADER (MS-RDPEFS 2.2.1.1)
+type Header struct {
+	Component uint16
+	PacketID  uint16
+}
+
+// ParsePDU splits a reassembled device redirection PDU into its header and body
+func ParsePDU(data []byte) (Header, []byte, error) {
+	var h Header
+	if len(data) < HeaderSize {
+		return h, nil, fmt.Errorf("%w: %d bytes", ErrInvalidPDU, len(data))
+	}
+	h.Component = binary.LittleEndian.Uint16(data[0:2])
+	h.PacketID = binary.LittleEndian.Uint16(data[2:4])
+	return h, data[HeaderSize:], nil
+}
+
+// BuildPDU prepends an RDPDR_HEADER for a core packet to body
+func BuildPDU(packetID uint16, body []byte) []byte {
+	buf := make([]byte, HeaderSize, HeaderSize+len(body))
+	binary.LittleEndian.PutUint16(buf[0:2], ComponentCore)
+	binary.LittleEndian.PutUint16(buf[2:4], packetID)
+	return append(buf, body...)
+}
+
+// Announce is the body of the Server Announce Request, Client Announce Reply
+// and Server Client ID Confirm PDUs (MS-RDPEFS 2.2.2.2, 2.2.2.3, 2.2.2.6)
+type Announce struct {
+	VersionMajor uint16
+	VersionMinor uint16
+	ClientID     uint32
+}
+
+// ParseAnnounce parses the body of an announce or client ID confirm PDU
+func ParseAnnounce(body []byte) (*Announce, error) {
+	if len(body) < 8 {
+		return nil, fmt.Errorf("%w: announce too short", ErrInvalidPDU)
+	}
+	return &Announce{
+		VersionMajor: binary.LittleEndian.Uint16(body[0:2]),
+		VersionMinor: binary.LittleEndian.Uint16(body[2:4]),
+		ClientID:     binary.LittleEndian.Uint32(body[4:8]),
+	}, nil
+}
+
+// Serialize encodes the announce body
+func (a *Announce) Serialize() []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint16(buf[0:2], a.VersionMajor)
+	binary.LittleEndian.PutUint16(buf[2:4], a.VersionMinor)
+	binary.LittleEndian.PutUint32(buf[4:8], a.ClientID)
+	return buf
+}
+
+// NewAnnounceReply builds the Client Announce Reply body for a server
+// announce, echoing the client ID and capping the minor version at ours.
+func NewAnnounceReply(server *Announce) *Announce {
+	return &Announce{
+		VersionMajor: VersionMajor,
+		VersionMinor: min(server.VersionMinor, VersionMinor),
+		ClientID:     server.ClientID,
+	}
+}
+
+// SerializeClientName encodes the body of a Client Name Request
+// (MS-RDPEFS 2.2.2.4) carrying name as null-terminated UTF-16LE
+func SerializeClientName(name string) []byte {
+	units := utf16.Encode([]rune(name))
+	nameLen := 2*len(units) + 2
+
+	buf := make([]byte, 12, 12+nameLen)
+	binary.LittleEndian.PutUint32(buf[0:4], 1)                // UnicodeFlag
+	binary.LittleEndian.PutUint32(buf[4:8], 0)                // CodePage
+	binary.LittleEndian.PutUint32(buf[8:12], uint32(nameLen)) // #nosec G115
+	for _, u := range units {
+		buf = binary.LittleEndian.AppendUint16(buf, u)
+	}
+	return append(buf, 0, 0)
+}
+
+// Capability is one capability set of a core capability PDU
+type Capability struct {
+	Type    uint16
+	Version uint32
+	Data    []byte
+}
+
+// ParseCapabilities parses the body of a Server Core Capability Request
+// (MS-RDPEFS 2.2.2.7)
+func ParseCapabilities(body []byte) ([]Capability, error) {
+	if len(body) < 4 {
+		return nil, fmt.Errorf("%w: capabilities too short", ErrInvalidPDU)
+	}
+	count := int(binary.LittleEndian.Uint16(body[0:2]))
+	rest := body[4:] // numCapabilities, padding
+
+	// Every set is at least 8 bytes, so the body bounds how many can follow
+	// whatever numCapabilities claims
+	caps := make([]Capability, 0, min(count, len(rest)/8))
+	for i := 0; i < count; i++ {
+		if len(rest) < 8 {
+			return nil, fmt.Errorf("%w: capability set %d truncated", ErrInvalidPDU, i)
+		}
+		capLen := int(binary.LittleEndian.Uint16(rest[2:4]))
+		if capLen < 8 || capLen > len(rest) {
+			return nil, fmt.Errorf("%w: capability set %d length %d", ErrInvalidPDU, i, capLen)
+		}
+		caps = append(caps, Capability{
+			Type:    binary.LittleEndian.Uint16(rest[0:2]),
+			Version: binary.LittleEndian.Uint32(rest[4:8]),
+			Data:    rest[8:capLen],
+		})
+		rest = rest[capLen:]
+	}
+	return caps, nil
+}
+
+// GeneralCapability represents GENERAL_CAPS_SET (MS-RDPEFS 2.2.2.7.1)
+type GeneralCapability struct {
+	OSType               uint32
+	OSVersion            uint32
+	ProtocolMajorVersion uint16
+	ProtocolMinorVersion uint16
+	IOCode1              uint32
+	ExtendedPDU          uint32
+	ExtraFlags1          uint32
+	SpecialTypeDeviceCap uint32
+}
+
+// NewClientGeneralCapability returns the general capability advertised by
+// this client: every I/O code, device removal and user logged-on PDUs, and
+// no special devices.
+func NewClientGeneralCapability() *GeneralCapability {
+	return &GeneralCapability{
+		ProtocolMajorVersion: VersionMajor,
+		ProtocolMinorVersion: VersionMinor,
+		IOCode1:              IOCode1All,
+		ExtendedPDU:          ExtendedPDUDeviceRemove | ExtendedPDUUserLoggedOn,
+	}
+}
+
+// SerializeCapabilities encodes the body of a Client Core Capability
+// Response (MS-RDPEFS 2.2.2.8) carrying c followed by extra capability sets
+func (c *GeneralCapability) SerializeCapabilities(extra ...Capability) []byte {
+	buf := make([]byte, 4+generalCapabilityLength)
+	binary.LittleEndian.PutUint16(buf[0:2], uint16(1+len(extra))) // #nosec G115 -- numCapabilities
+
+	capSet := buf[4:]
+	binary.LittleEndian.PutUint16(capSet[0:2], CapTypeGeneral)
+	binary.LittleEndian.PutUint16(capSet[2:4], generalCapabilityLength)
+	binary.LittleEndian.PutUint32(capSet[4:8], GeneralCapabilityVersion2)
+	binary.LittleEndian.PutUint32(capSet[8:12], c.OSType)
+	binary.LittleEndian.PutUint32(capSet[12:16], c.OSVersion)
+	binary.LittleEndian.PutUint16(capSet[16:18], c.ProtocolMajorVersion)
+	binary.LittleEndian.PutUint16(capSet[18:20], c.ProtocolMinorVersion)
+	binary.LittleEndian.PutUint32(capSet[20:24], c.IOCode1)
+	// ioCode2 (24:28) is reserved
+	binary.LittleEndian.PutUint32(capSet[28:32], c.ExtendedPDU)
+	binary.LittleEndian.PutUint32(capSet[32:36], c.ExtraFlags1)
+	// extraFlags2 (36:40) is reserved
+	binary.LittleEndian.PutUint32(capSet[40:44], c.SpecialTypeDeviceCap)
+
+	for _, capability := range extra {
+		buf = binary.LittleEndian.AppendUint16(buf, capability.Type)
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(8+len(capability.Data))) // #nosec G115
+		buf = binary.LittleEndian.AppendUint32(buf, capability.Version)
+		buf = append(buf, capability.Data...)
+	}
+	return buf
+}
+
+// SerializeEmptyDeviceList encodes the body of a Client Device List Announce
+// Request (MS-RDPEFS 2.2.2.9) that announces no devices
+func SerializeEmptyDeviceList() []byte {
+	return binary.LittleEndian.AppendUint32(nil, 0) // DeviceCount
+}
@@ -0,0 +1,188 @@
+package rdpdr
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildParsePDU(t *testing.T) {
+	pdu := BuildPDU(PacketClientIDConfirm, []byte{1, 2, 3})
+	assert.Equal(t, []byte{0x72, 0x44, 0x43, 0x43, 1, 2, 3}, pdu)
+
+	header, body, err := ParsePDU(pdu)
+	require.NoError(t, err)
+	assert.Equal(t, Header{Component: ComponentCore, PacketID: PacketClientIDConfirm}, header)
+	assert.Equal(t, []byte{1, 2, 3}, body)
+
+	_, _, err = ParsePDU([]byte{0x72, 0x44, 0x6E})
+	assert.ErrorIs(t, err, ErrInvalidPDU)
+}
+
+func TestAnnounce(t *testing.T) {
+	// Server Announce Request body: version 1.13, client ID 2
+	body := []byte{0x01, 0x00, 0x0D, 0x00, 0x02, 0x00, 0x00, 0x00}
+	announce, err := ParseAnnounce(body)
+	require.NoError(t, err)
+	assert.Equal(t, Announce{VersionMajor: 1, VersionMinor: 0x000D, ClientID: 2}, *announce)
+	assert.Equal(t, body, announce.Serialize())
+
+	reply := NewAnnounceReply(announce)
+	assert.Equal(t, Announce{VersionMajor: 1, VersionMinor: VersionMinor, ClientID: 2}, *reply)
+
+	// An older server keeps its own minor version
+	reply = NewAnnounceReply(&Announce{VersionMajor: 1, VersionMinor: 0x0005, ClientID: 3})
+	assert.Equal(t, uint16(0x0005), reply.VersionMinor)
+
+	_, err = ParseAnnounce(body[:6])
+	assert.ErrorIs(t, err, ErrInvalidPDU)
+}
+
+func TestSerializeClientName(t *testing.T) {
+	assert.Equal(t, []byte{
+		0x01, 0x00, 0x00, 0x00, // UnicodeFlag
+		0x00, 0x00, 0x00, 0x00, // CodePage
+		0x06, 0x00, 0x00, 0x00, // ComputerNameLen
+		'p', 0x00, 'c', 0x00, 0x00, 0x00,
+	}, SerializeClientName("pc"))
+}
+
+func TestCapabilities(t *testing.T) {
+	body := NewClientGeneralCapability().SerializeCapabilities()
+	require.Len(t, body, 48)
+	assert.Equal(t, []byte{
+		0x01, 0x00, 0x00, 0x00, // numCapabilities, padding
+		0x01, 0x00, 0x2C, 0x00, // CAP_GENERAL_TYPE, length 44
+		0x02, 0x00, 0x00, 0x00, // GENERAL_CAPABILITY_VERSION_02
+	}, body[:12])
+
+	caps, err := ParseCapabilities(body)
+	require.NoError(t, err)
+	require.Len(t, caps, 1)
+	assert.Equal(t, CapTypeGeneral, caps[0].Type)
+	assert.Equal(t, GeneralCapabilityVersion2, caps[0].Version)
+	require.Len(t, caps[0].Data, 36)
+	assert.Equal(t, []byte{0x01, 0x00, 0x0C, 0x00}, caps[0].Data[8:12], "protocol version 1.12")
+	assert.Equal(t, []byte{0xFF, 0xFF, 0x00, 0x00}, caps[0].Data[12:16], "ioCode1")
+	assert.Equal(t, []byte{0x05, 0x00, 0x00, 0x00}, caps[0].Data[20:24], "extendedPDU")
+
+	_, err = ParseCapabilities([]byte{0x01, 0x00})
+	assert.ErrorIs(t, err, ErrInvalidPDU, "too short")
+
+	_, err = ParseCapabilities([]byte{0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x30, 0x00, 0x02, 0x00, 0x00, 0x00})
+	assert.ErrorIs(t, err, ErrInvalidPDU, "length beyond data")
+
+	_, err = ParseCapabilities([]byte{0x02, 0x00, 0x00, 0x00})
+	assert.ErrorIs(t, err, ErrInvalidPDU, "fewer sets than announced")
+}
+
+func TestSerializeEmptyDeviceList(t *testing.T) {
+	assert.Equal(t, []byte{0x00, 0x00, 0x00, 0x00}, SerializeEmptyDeviceList())
+}
+
+func TestCapabilities_Extra(t *testing.T) {
+	body := NewClientGeneralCapability().SerializeCapabilities(Capability{Type: CapTypeDrive, Version: DriveCapabilityVersion2})
+
+	caps, err := ParseCapabilities(body)
+	require.NoError(t, err)
+	require.Len(t, caps, 2)
+	assert.Equal(t, Capability{Type: CapTypeDrive, Version: DriveCapabilityVersion2, Data: []byte{}}, caps[1])
+}
+
+func TestSerializeDeviceList(t *testing.T) {
+	body := SerializeDeviceList([]DeviceAnnounce{{DeviceType: DeviceTypeFilesystem, DeviceID: 1, PreferredDosName: "LONGNAME"}})
+	assert.Equal(t, []byte{
+		0x01, 0x00, 0x00, 0x00, // DeviceCount
+		0x08, 0x00, 0x00, 0x00, // RDPDR_DTYP_FILESYSTEM
+		0x01, 0x00, 0x00, 0x00, // DeviceId
+		'L', 'O', 'N', 'G', 'N', 'A', 'M', 0x00, // PreferredDosName, truncated
+		0x00, 0x00, 0x00, 0x00, // DeviceDataLength
+	}, body)
+	assert.Equal(t, SerializeEmptyDeviceList(), SerializeDeviceList(nil))
+}
+
+func TestIORequest(t *testing.T) {
+	body := []byte{
+		0x01, 0x00, 0x00, 0x00, // DeviceId
+		0x02, 0x00, 0x00, 0x00, // FileId
+		0x03, 0x00, 0x00, 0x00, // CompletionId
+		0x0C, 0x00, 0x00, 0x00, // IRP_MJ_DIRECTORY_CONTROL
+		0x01, 0x00, 0x00, 0x00, // IRP_MN_QUERY_DIRECTORY
+		0xAA,
+	}
+	req, err := ParseIORequest(body)
+	require.NoError(t, err)
+	assert.Equal(t, &IORequest{
+		DeviceID:      1,
+		FileID:        2,
+		CompletionID:  3,
+		MajorFunction: IRPDirectoryControl,
+		MinorFunction: IRPQueryDirectory,
+		Body:          []byte{0xAA},
+	}, req)
+
+	assert.Equal(t, []byte{1, 0, 0, 0, 3, 0, 0, 0, 0x06, 0x00, 0x00, 0x80, 0, 0, 0, 0, 0}, req.SerializeIOFailure(StatusNoMoreFiles))
+	assert.Equal(t, []byte{1, 0, 0, 0, 3, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 'h', 'i'}, req.SerializeIOCompletion(StatusSuccess, SerializeLengthResponse([]byte("hi"))))
+
+	_, err = ParseIORequest(body[:19])
+	assert.ErrorIs(t, err, ErrInvalidPDU)
+}
+
+func TestParseCreateRequest(t *testing.T) {
+	body := make([]byte, 32)
+	body[0] = 0x01  // FILE_READ_DATA
+	body[20] = 0x01 // FILE_OPEN
+	body[28] = 8    // PathLength
+	body = append(body, '\\', 0, 'a', 0, 'b', 0, 0, 0)
+
+	req, err := ParseCreateRequest(body)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0x01), req.DesiredAccess)
+	assert.Equal(t, FileOpen, req.CreateDisposition)
+	assert.Equal(t, `\ab`, req.Path)
+
+	body[28] = 10
+	_, err = ParseCreateRequest(body)
+	assert.ErrorIs(t, err, ErrInvalidPDU)
+}
+
+func TestEncodeInformation(t *testing.T) {
+	file := &FileInfo{Name: "a.txt", Size: 11, ModTime: time.Unix(0, 0), Attributes: FileAttributeReadOnly}
+
+	tests := []struct {
+		class uint32
+		want  int
+	}{
+		{FileDirectoryInformation, 64 + 10},
+		{FileFullDirectoryInformation, 68 + 10},
+		{FileBothDirectoryInformation, 94 + 10},
+		{FileNamesInformation, 12 + 10},
+	}
+	for _, tt := range tests {
+		data, err := EncodeDirectoryInformation(tt.class, file)
+		require.NoError(t, err)
+		assert.Len(t, data, tt.want, "class %d", tt.class)
+	}
+	_, err := EncodeDirectoryInformation(37, file)
+	assert.ErrorIs(t, err, ErrUnsupportedInformationClass)
+
+	basic, err := EncodeFileInformation(FileBasicInformation, file)
+	require.NoError(t, err)
+	assert.Len(t, basic, 36)
+	assert.Equal(t, uint64(windowsEpochOffset), binary.LittleEndian.Uint64(basic[0:8]))
+
+	standard, err := EncodeFileInformation(FileStandardInformation, file)
+	require.NoError(t, err)
+	assert.Len(t, standard, 22)
+	assert.Equal(t, uint64(11), binary.LittleEndian.Uint64(standard[8:16]))
+
+	for _, class := range []uint32{FileFsVolumeInformation, FileFsSizeInformation, FileFsDeviceInformation, FileFsAttributeInformation, FileFsFullSizeInformation} {
+		_, err := EncodeVolumeInformation(class, "SHARE")
+		assert.NoError(t, err, "class %d", class)
+	}
+	_, err = EncodeVolumeInformation(2, "SHARE")
+	assert.ErrorIs(t, err, ErrUnsupportedInformationClass)
+}
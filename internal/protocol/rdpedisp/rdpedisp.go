@@ -7,6 +7,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 )
 
 // Dynamic channel name for display control
@@ -34,22 +35,34 @@ const (
 // CapsPDU represents DISPLAYCONTROL_CAPS_PDU (MS-RDPEDISP 2.2.2.1)
 // Sent by server to client after channel is created
 type CapsPDU struct {
-	MaxNumMonitors     uint32 // Maximum number of monitors supported
-	MaxMonitorAreaSize uint32 // Maximum total monitor area in pixels (width * height)
+	MaxNumMonitors        uint32 // Maximum number of monitors supported
+	MaxMonitorAreaFactorA uint32 // Maximum monitor width factor
+	MaxMonitorAreaFactorB uint32 // Maximum monitor height factor
 }
 
+// CapsSize is the size of a DISPLAYCONTROL_CAPS_PDU including its header
+const CapsSize = 20
+
 // Serialize encodes CapsPDU to wire format
 func (c *CapsPDU) Serialize() []byte {
 	buf := new(bytes.Buffer)
 
 	_ = binary.Write(buf, binary.LittleEndian, PDUTypeCaps)
-	_ = binary.Write(buf, binary.LittleEndian, uint32(12)) // Length
+	_ = binary.Write(buf, binary.LittleEndian, uint32(CapsSize))
 	_ = binary.Write(buf, binary.LittleEndian, c.MaxNumMonitors)
-	_ = binary.Write(buf, binary.LittleEndian, c.MaxMonitorAreaSize)
+	_ = binary.Write(buf, binary.LittleEndian, c.MaxMonitorAreaFactorA)
+	_ = binary.Write(buf, binary.LittleEndian, c.MaxMonitorAreaFactorB)
 
 	return buf.Bytes()
 }
 
+// MaxMonitorArea returns the maximum total area in pixels of all monitors in
+// a layout, MaxNumMonitors * MaxMonitorAreaFactorA * MaxMonitorAreaFactorB.
+// Zero means the server set no limit.
+func (c *CapsPDU) MaxMonitorArea() uint64 {
+	return uint64(c.MaxNumMonitors) * uint64(c.MaxMonitorAreaFactorA) * uint64(c.MaxMonitorAreaFactorB)
+}
+
 // Deserialize decodes CapsPDU from wire format
 func (c *CapsPDU) Deserialize(r io.Reader) error {
 	var pduType, length uint32
@@ -68,8 +81,11 @@ func (c *CapsPDU) Deserialize(r io.Reader) error {
 	if err := binary.Read(r, binary.LittleEndian, &c.MaxNumMonitors); err != nil {
 		return fmt.Errorf("caps max monitors: %w", err)
 	}
-	if err := binary.Read(r, binary.LittleEndian, &c.MaxMonitorAreaSize); err != nil {
-		return fmt.Errorf("caps max area: %w", err)
+	if err := binary.Read(r, binary.LittleEndian, &c.MaxMonitorAreaFactorA); err != nil {
+		return fmt.Errorf("caps max area factor A: %w", err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &c.MaxMonitorAreaFactorB); err != nil {
+		return fmt.Errorf("caps max area factor B: %w", err)
 	}
 
 	return nil
@@ -365,6 +381,29 @@ func monitorsAdjacent(a, b *MonitorDef) bool {
 	return false
 }
 
+// Monitor dimension limits (MS-RDPEDISP 2.2.2.2.1)
+const (
+	MinMonitorSize uint32 = 200
+	MaxMonitorSize uint32 = 8192
+)
+
+// ClampMonitorSize adjusts a requested monitor size to one the server
+// accepts: each dimension is kept within MinMonitorSize and MaxMonitorSize,
+// the width is made even, and when maxArea is non-zero a larger size is
+// scaled down to fit it, keeping the aspect ratio.
+func ClampMonitorSize(width, height uint32, maxArea uint64) (uint32, uint32) {
+	width = min(max(width, MinMonitorSize), MaxMonitorSize)
+	height = min(max(height, MinMonitorSize), MaxMonitorSize)
+
+	if area := uint64(width) * uint64(height); maxArea > 0 && area > maxArea {
+		scale := math.Sqrt(float64(maxArea) / float64(area))
+		width = max(uint32(float64(width)*scale), MinMonitorSize)
+		height = max(uint32(float64(height)*scale), MinMonitorSize)
+	}
+
+	return width &^ 1, height
+}
+
 // ValidateMonitorDef validates a single monitor definition per MS-RDPEDISP 2.2.2.2.1
 func ValidateMonitorDef(m *MonitorDef) bool {
 	// Width: 200 to 8192, must be even
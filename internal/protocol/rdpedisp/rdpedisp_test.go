@@ -2,6 +2,7 @@ package rdpedisp
 
 import (
 	"bytes"
+	"encoding/binary"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -16,15 +17,17 @@ func TestCapsPDU_SerializeDeserialize(t *testing.T) {
 		{
 			name: "basic caps",
 			caps: CapsPDU{
-				MaxNumMonitors:     1,
-				MaxMonitorAreaSize: 1920 * 1080,
+				MaxNumMonitors:        1,
+				MaxMonitorAreaFactorA: 1920,
+				MaxMonitorAreaFactorB: 1080,
 			},
 		},
 		{
 			name: "multi-monitor caps",
 			caps: CapsPDU{
-				MaxNumMonitors:     4,
-				MaxMonitorAreaSize: 4096 * 2160 * 4,
+				MaxNumMonitors:        4,
+				MaxMonitorAreaFactorA: 4096,
+				MaxMonitorAreaFactorB: 2160,
 			},
 		},
 	}
@@ -32,14 +35,46 @@ func TestCapsPDU_SerializeDeserialize(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			data := tt.caps.Serialize()
-			require.Len(t, data, 16) // 4 (type) + 4 (len) + 4 (monitors) + 4 (area)
+			require.Len(t, data, CapsSize) // 4 (type) + 4 (len) + 4 (monitors) + 4 + 4 (area factors)
+			assert.Equal(t, uint32(CapsSize), binary.LittleEndian.Uint32(data[4:]))
 
 			var decoded CapsPDU
 			err := decoded.Deserialize(bytes.NewReader(data))
 			require.NoError(t, err)
 
 			assert.Equal(t, tt.caps.MaxNumMonitors, decoded.MaxNumMonitors)
-			assert.Equal(t, tt.caps.MaxMonitorAreaSize, decoded.MaxMonitorAreaSize)
+			assert.Equal(t, tt.caps, decoded)
+		})
+	}
+}
+
+func TestCapsPDU_MaxMonitorArea(t *testing.T) {
+	caps := CapsPDU{MaxNumMonitors: 16, MaxMonitorAreaFactorA: 8192, MaxMonitorAreaFactorB: 8192}
+	assert.Equal(t, uint64(16*8192*8192), caps.MaxMonitorArea())
+	assert.Zero(t, (&CapsPDU{}).MaxMonitorArea())
+}
+
+func TestClampMonitorSize(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height uint32
+		maxArea       uint64
+		wantW, wantH  uint32
+	}{
+		{"supported size", 1920, 1080, 0, 1920, 1080},
+		{"odd width", 1367, 768, 0, 1366, 768},
+		{"too small", 120, 80, 0, 200, 200},
+		{"too large", 10000, 9000, 0, 8192, 8192},
+		{"within area", 1920, 1080, 1920 * 1080, 1920, 1080},
+		{"over area", 3840, 2160, 1920 * 1080, 1920, 1080},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, h := ClampMonitorSize(tt.width, tt.height, tt.maxArea)
+			assert.Equal(t, tt.wantW, w)
+			assert.Equal(t, tt.wantH, h)
+			assert.True(t, ValidateMonitorDef(&MonitorDef{Width: w, Height: h, DesktopScaleFactor: 100, DeviceScaleFactor: 100}))
 		})
 	}
 }
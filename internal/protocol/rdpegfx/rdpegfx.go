@@ -0,0 +1,217 @@
+// Package rdpegfx implements PDUs of the Graphics Pipeline Extension
+// (MS-RDPEGFX). Only the surface management commands are covered so far.
+package rdpegfx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Dynamic channel name for the graphics pipeline
+const ChannelName = "Microsoft::Windows::RDS::Graphics"
+
+// Command IDs (MS-RDPEGFX 2.2.1.5)
+const (
+	CmdIDWireToSurface1           uint16 = 0x0001 // RDPGFX_CMDID_WIRETOSURFACE_1
+	CmdIDWireToSurface2           uint16 = 0x0002 // RDPGFX_CMDID_WIRETOSURFACE_2
+	CmdIDDeleteEncodingContext    uint16 = 0x0003 // RDPGFX_CMDID_DELETEENCODINGCONTEXT
+	CmdIDSolidFill                uint16 = 0x0004 // RDPGFX_CMDID_SOLIDFILL
+	CmdIDSurfaceToSurface         uint16 = 0x0005 // RDPGFX_CMDID_SURFACETOSURFACE
+	CmdIDSurfaceToCache           uint16 = 0x0006 // RDPGFX_CMDID_SURFACETOCACHE
+	CmdIDCacheToSurface           uint16 = 0x0007 // RDPGFX_CMDID_CACHETOSURFACE
+	CmdIDEvictCacheEntry          uint16 = 0x0008 // RDPGFX_CMDID_EVICTCACHEENTRY
+	CmdIDCreateSurface            uint16 = 0x0009 // RDPGFX_CMDID_CREATESURFACE
+	CmdIDDeleteSurface            uint16 = 0x000A // RDPGFX_CMDID_DELETESURFACE
+	CmdIDStartFrame               uint16 = 0x000B // RDPGFX_CMDID_STARTFRAME
+	CmdIDEndFrame                 uint16 = 0x000C // RDPGFX_CMDID_ENDFRAME
+	CmdIDFrameAcknowledge         uint16 = 0x000D // RDPGFX_CMDID_FRAMEACKNOWLEDGE
+	CmdIDResetGraphics            uint16 = 0x000E // RDPGFX_CMDID_RESETGRAPHICS
+	CmdIDMapSurfaceToOutput       uint16 = 0x000F // RDPGFX_CMDID_MAPSURFACETOOUTPUT
+	CmdIDCacheImportOffer         uint16 = 0x0010 // RDPGFX_CMDID_CACHEIMPORTOFFER
+	CmdIDCacheImportReply         uint16 = 0x0011 // RDPGFX_CMDID_CACHEIMPORTREPLY
+	CmdIDCapsAdvertise            uint16 = 0x0012 // RDPGFX_CMDID_CAPSADVERTISE
+	CmdIDCapsConfirm              uint16 = 0x0013 // RDPGFX_CMDID_CAPSCONFIRM
+	CmdIDMapSurfaceToWindow       uint16 = 0x0015 // RDPGFX_CMDID_MAPSURFACETOWINDOW
+	CmdIDQoEFrameAcknowledge      uint16 = 0x0016 // RDPGFX_CMDID_QOEFRAMEACKNOWLEDGE
+	CmdIDMapSurfaceToScaledOutput uint16 = 0x0017 // RDPGFX_CMDID_MAPSURFACETOSCALEDOUTPUT
+	CmdIDMapSurfaceToScaledWindow uint16 = 0x0018 // RDPGFX_CMDID_MAPSURFACETOSCALEDWINDOW
+)
+
+// Pixel formats of a surface (MS-RDPEGFX 2.2.1.4)
+const (
+	PixelFormatXRGB8888 uint8 = 0x20 // GFX_PIXEL_FORMAT_XRGB_8888
+	PixelFormatARGB8888 uint8 = 0x21 // GFX_PIXEL_FORMAT_ARGB_8888
+)
+
+// HeaderLength is the size of RDPGFX_HEADER
+const HeaderLength = 8
+
+// PDU lengths, including the header
+const (
+	createSurfaceLength      = HeaderLength + 7
+	deleteSurfaceLength      = HeaderLength + 2
+	mapSurfaceToOutputLength = HeaderLength + 12
+)
+
+// Header represents RDPGFX_HEADER (MS-RDPEGFX 2.2.1.5), which starts
+// every graphics pipeline PDU
+type Header struct {
+	CmdID     uint16
+	Flags     uint16
+	PDULength uint32 // Length of the PDU including this header
+}
+
+// Serialize encodes Header to wire format
+func (h *Header) Serialize() []byte {
+	buf := make([]byte, 0, HeaderLength)
+	buf = binary.LittleEndian.AppendUint16(buf, h.CmdID)
+	buf = binary.LittleEndian.AppendUint16(buf, h.Flags)
+	return binary.LittleEndian.AppendUint32(buf, h.PDULength)
+}
+
+// Deserialize decodes Header from wire format
+func (h *Header) Deserialize(r io.Reader) error {
+	if err := binary.Read(r, binary.LittleEndian, &h.CmdID); err != nil {
+		return fmt.Errorf("header cmdId: %w", err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &h.Flags); err != nil {
+		return fmt.Errorf("header flags: %w", err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &h.PDULength); err != nil {
+		return fmt.Errorf("header pduLength: %w", err)
+	}
+	return nil
+}
+
+// readHeader decodes a header and checks it introduces a cmdID PDU of the
+// given length
+func readHeader(r io.Reader, cmdID uint16, length uint32) error {
+	var h Header
+	if err := h.Deserialize(r); err != nil {
+		return err
+	}
+	if h.CmdID != cmdID {
+		return fmt.Errorf("unexpected command: 0x%04X (expected 0x%04X)", h.CmdID, cmdID)
+	}
+	if h.PDULength != length {
+		return fmt.Errorf("command 0x%04X: invalid length %d (expected %d)", cmdID, h.PDULength, length)
+	}
+	return nil
+}
+
+// CreateSurfacePDU represents RDPGFX_CREATE_SURFACE_PDU (MS-RDPEGFX 2.2.2.9)
+// Sent by server to create an offscreen surface
+type CreateSurfacePDU struct {
+	SurfaceID   uint16
+	Width       uint16
+	Height      uint16
+	PixelFormat uint8 // PixelFormatXRGB8888 or PixelFormatARGB8888
+}
+
+// Serialize encodes CreateSurfacePDU to wire format
+func (p *CreateSurfacePDU) Serialize() []byte {
+	header := Header{CmdID: CmdIDCreateSurface, PDULength: createSurfaceLength}
+	buf := bytes.NewBuffer(header.Serialize())
+
+	_ = binary.Write(buf, binary.LittleEndian, p.SurfaceID)
+	_ = binary.Write(buf, binary.LittleEndian, p.Width)
+	_ = binary.Write(buf, binary.LittleEndian, p.Height)
+	buf.WriteByte(p.PixelFormat)
+
+	return buf.Bytes()
+}
+
+// Deserialize decodes CreateSurfacePDU from wire format
+func (p *CreateSurfacePDU) Deserialize(r io.Reader) error {
+	if err := readHeader(r, CmdIDCreateSurface, createSurfaceLength); err != nil {
+		return err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &p.SurfaceID); err != nil {
+		return fmt.Errorf("create surface id: %w", err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &p.Width); err != nil {
+		return fmt.Errorf("create surface width: %w", err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &p.Height); err != nil {
+		return fmt.Errorf("create surface height: %w", err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &p.PixelFormat); err != nil {
+		return fmt.Errorf("create surface pixel format: %w", err)
+	}
+
+	if p.PixelFormat != PixelFormatXRGB8888 && p.PixelFormat != PixelFormatARGB8888 {
+		return fmt.Errorf("create surface: unknown pixel format 0x%02X", p.PixelFormat)
+	}
+	return nil
+}
+
+// DeleteSurfacePDU represents RDPGFX_DELETE_SURFACE_PDU (MS-RDPEGFX 2.2.2.10)
+// Sent by server to release a surface
+type DeleteSurfacePDU struct {
+	SurfaceID uint16
+}
+
+// Serialize encodes DeleteSurfacePDU to wire format
+func (p *DeleteSurfacePDU) Serialize() []byte {
+	header := Header{CmdID: CmdIDDeleteSurface, PDULength: deleteSurfaceLength}
+	return binary.LittleEndian.AppendUint16(header.Serialize(), p.SurfaceID)
+}
+
+// Deserialize decodes DeleteSurfacePDU from wire format
+func (p *DeleteSurfacePDU) Deserialize(r io.Reader) error {
+	if err := readHeader(r, CmdIDDeleteSurface, deleteSurfaceLength); err != nil {
+		return err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &p.SurfaceID); err != nil {
+		return fmt.Errorf("delete surface id: %w", err)
+	}
+	return nil
+}
+
+// MapSurfaceToOutputPDU represents RDPGFX_MAP_SURFACE_TO_OUTPUT_PDU
+// (MS-RDPEGFX 2.2.2.16). Sent by server to place a surface on the desktop
+// with its top-left corner at the given origin
+type MapSurfaceToOutputPDU struct {
+	SurfaceID     uint16
+	OutputOriginX uint32
+	OutputOriginY uint32
+}
+
+// Serialize encodes MapSurfaceToOutputPDU to wire format
+func (p *MapSurfaceToOutputPDU) Serialize() []byte {
+	header := Header{CmdID: CmdIDMapSurfaceToOutput, PDULength: mapSurfaceToOutputLength}
+	buf := bytes.NewBuffer(header.Serialize())
+
+	_ = binary.Write(buf, binary.LittleEndian, p.SurfaceID)
+	_ = binary.Write(buf, binary.LittleEndian, uint16(0)) // reserved
+	_ = binary.Write(buf, binary.LittleEndian, p.OutputOriginX)
+	_ = binary.Write(buf, binary.LittleEndian, p.OutputOriginY)
+
+	return buf.Bytes()
+}
+
+// Deserialize decodes MapSurfaceToOutputPDU from wire format
+func (p *MapSurfaceToOutputPDU) Deserialize(r io.Reader) error {
+	if err := readHeader(r, CmdIDMapSurfaceToOutput, mapSurfaceToOutputLength); err != nil {
+		return err
+	}
+
+	var reserved uint16
+	if err := binary.Read(r, binary.LittleEndian, &p.SurfaceID); err != nil {
+		return fmt.Errorf("map surface id: %w", err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &reserved); err != nil {
+		return fmt.Errorf("map surface reserved: %w", err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &p.OutputOriginX); err != nil {
+		return fmt.Errorf("map surface origin x: %w", err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &p.OutputOriginY); err != nil {
+		return fmt.Errorf("map surface origin y: %w", err)
+	}
+	return nil
+}
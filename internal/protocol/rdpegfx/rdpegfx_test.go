@@ -0,0 +1,86 @@
+package rdpegfx
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateSurfacePDU_SerializeDeserialize(t *testing.T) {
+	pdu := CreateSurfacePDU{SurfaceID: 3, Width: 1920, Height: 1080, PixelFormat: PixelFormatARGB8888}
+
+	data := pdu.Serialize()
+	assert.Equal(t, []byte{
+		0x09, 0x00, // cmdId
+		0x00, 0x00, // flags
+		0x0F, 0x00, 0x00, 0x00, // pduLength
+		0x03, 0x00, // surfaceId
+		0x80, 0x07, // width
+		0x38, 0x04, // height
+		0x21, // pixelFormat
+	}, data)
+
+	var decoded CreateSurfacePDU
+	require.NoError(t, decoded.Deserialize(bytes.NewReader(data)))
+	assert.Equal(t, pdu, decoded)
+}
+
+func TestCreateSurfacePDU_RejectsUnknownPixelFormat(t *testing.T) {
+	data := (&CreateSurfacePDU{SurfaceID: 1, Width: 64, Height: 64, PixelFormat: 0x10}).Serialize()
+
+	var decoded CreateSurfacePDU
+	assert.ErrorContains(t, decoded.Deserialize(bytes.NewReader(data)), "unknown pixel format")
+}
+
+func TestDeleteSurfacePDU_SerializeDeserialize(t *testing.T) {
+	pdu := DeleteSurfacePDU{SurfaceID: 7}
+
+	data := pdu.Serialize()
+	assert.Equal(t, []byte{0x0A, 0x00, 0x00, 0x00, 0x0A, 0x00, 0x00, 0x00, 0x07, 0x00}, data)
+
+	var decoded DeleteSurfacePDU
+	require.NoError(t, decoded.Deserialize(bytes.NewReader(data)))
+	assert.Equal(t, pdu, decoded)
+}
+
+func TestMapSurfaceToOutputPDU_SerializeDeserialize(t *testing.T) {
+	pdu := MapSurfaceToOutputPDU{SurfaceID: 2, OutputOriginX: 1920, OutputOriginY: 0}
+
+	data := pdu.Serialize()
+	require.Len(t, data, 20)
+	assert.Equal(t, []byte{0x0F, 0x00, 0x00, 0x00, 0x14, 0x00, 0x00, 0x00}, data[:HeaderLength])
+
+	var decoded MapSurfaceToOutputPDU
+	require.NoError(t, decoded.Deserialize(bytes.NewReader(data)))
+	assert.Equal(t, pdu, decoded)
+}
+
+func TestDeserialize_RejectsMismatchedHeader(t *testing.T) {
+	var create CreateSurfacePDU
+	err := create.Deserialize(bytes.NewReader((&DeleteSurfacePDU{SurfaceID: 1}).Serialize()))
+	assert.ErrorContains(t, err, "unexpected command: 0x000A (expected 0x0009)")
+
+	data := (&DeleteSurfacePDU{SurfaceID: 1}).Serialize()
+	data[4] = 0x0C
+	var del DeleteSurfacePDU
+	assert.ErrorContains(t, del.Deserialize(bytes.NewReader(data)), "invalid length 12")
+}
+
+func TestDeserialize_Truncated(t *testing.T) {
+	data := (&MapSurfaceToOutputPDU{SurfaceID: 1}).Serialize()
+
+	for _, n := range []int{0, 4, HeaderLength, len(data) - 1} {
+		var decoded MapSurfaceToOutputPDU
+		assert.Error(t, decoded.Deserialize(bytes.NewReader(data[:n])), "length %d", n)
+	}
+}
+
+func TestHeader_SerializeDeserialize(t *testing.T) {
+	h := Header{CmdID: CmdIDResetGraphics, Flags: 0, PDULength: 340}
+
+	var decoded Header
+	require.NoError(t, decoded.Deserialize(bytes.NewReader(h.Serialize())))
+	assert.Equal(t, h, decoded)
+}
@@ -558,6 +558,13 @@ func Test_Protocol_Receive(t *testing.T) {
 			expectErr:   true,
 			expectedErr: ErrWrongDataLength,
 		},
+		{
+			name:        "server disconnect request",
+			receiveData: []byte{0x06, 0x80, 0x00, 0x00, 0x00, 0x00, 0x80},
+			receiveErr:  nil,
+			expectErr:   true,
+			expectedErr: ErrDisconnectRequest,
+		},
 		{
 			name:        "empty data",
 			receiveData: []byte{},
@@ -0,0 +1,50 @@
+package x224
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// tpduDisconnectRequest is the DR TPDU code (ISO 8073 13.5)
+const tpduDisconnectRequest uint8 = 0x80
+
+// Disconnect reasons for class 0 (ISO 8073 13.5.3 e)
+const (
+	DisconnectReasonNotSpecified uint8 = 0x00
+	DisconnectReasonNormal       uint8 = 0x80 // Normal disconnect initiated by session entity
+)
+
+// DisconnectRequest is the X.224 Disconnect Request TPDU that releases the
+// transport connection. Class 0 has no Disconnect Confirm; the peer closes
+// the network connection in response.
+type DisconnectRequest struct {
+	DSTREF uint16
+	SRCREF uint16
+	Reason uint8
+}
+
+func (pdu *DisconnectRequest) Serialize() []byte {
+	const x224FixedPartLen = 6 // without length indicator (LI)
+
+	buf := new(bytes.Buffer)
+
+	_ = binary.Write(buf, binary.BigEndian, uint8(x224FixedPartLen))
+	_ = binary.Write(buf, binary.BigEndian, tpduDisconnectRequest)
+	_ = binary.Write(buf, binary.BigEndian, pdu.DSTREF)
+	_ = binary.Write(buf, binary.BigEndian, pdu.SRCREF)
+	_ = binary.Write(buf, binary.BigEndian, pdu.Reason)
+
+	return buf.Bytes()
+}
+
+// Disconnect sends a Disconnect Request with a normal-disconnect reason
+func (p *Protocol) Disconnect() error {
+	req := DisconnectRequest{Reason: DisconnectReasonNormal}
+
+	if err := p.tpktConn.Send(req.Serialize()); err != nil {
+		return fmt.Errorf("client X.224 disconnect request: %w", err)
+	}
+
+	return nil
+}
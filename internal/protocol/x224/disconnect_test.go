@@ -0,0 +1,25 @@
+package x224
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DisconnectRequest_Serialize(t *testing.T) {
+	req := DisconnectRequest{Reason: DisconnectReasonNormal}
+
+	require.Equal(t, []byte{0x06, 0x80, 0x00, 0x00, 0x00, 0x00, 0x80}, req.Serialize())
+}
+
+func Test_Protocol_Disconnect(t *testing.T) {
+	mock := &mockTpktConn{}
+	p := NewWithConn(mock)
+
+	require.NoError(t, p.Disconnect())
+	require.Equal(t, []byte{0x06, 0x80, 0x00, 0x00, 0x00, 0x00, 0x80}, mock.sendData)
+
+	mock.sendErr = errors.New("network error")
+	require.ErrorIs(t, p.Disconnect(), mock.sendErr)
+}
@@ -6,4 +6,5 @@ var (
 	ErrSmallConnectionConfirmLength = errors.New("small connection confirm length")
 	ErrWrongDataLength              = errors.New("wrong data length")
 	ErrWrongConnectionConfirmCode   = errors.New("wrong connection confirm code")
+	ErrDisconnectRequest            = errors.New("disconnect request")
 )
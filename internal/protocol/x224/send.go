@@ -32,6 +32,11 @@ func (pdu *Data) Deserialize(wire io.Reader) error {
 	}
 
 	if pdu.LI != dataFixedPartLen {
+		// The server releases the connection with a Disconnect Request
+		var code uint8
+		if binary.Read(wire, binary.BigEndian, &code) == nil && code&0xF0 == tpduDisconnectRequest {
+			return ErrDisconnectRequest
+		}
 		return ErrWrongDataLength
 	}
 
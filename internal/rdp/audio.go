@@ -370,8 +370,12 @@ func (h *AudioHandler) sendWaveConfirm(timestamp uint16, blockNo uint8) error {
 	return h.client.mcsLayer.Send(h.client.userID, channelID, pdu)
 }
 
-// EnableAudio registers the rdpsnd channel for audio redirection
+// EnableAudio registers the rdpsnd channel for audio redirection. It does
+// nothing once DisableAudio has been called.
 func (c *Client) EnableAudio() {
+	if c.audioDisabled {
+		return
+	}
 	if c.channels == nil {
 		c.channels = []string{}
 	}
@@ -387,6 +391,20 @@ func (c *Client) EnableAudio() {
 	c.audioHandler.Enable()
 }
 
+// DisableAudio turns audio output off for the session: the rdpsnd channel
+// is not requested, the Sound capability set is not advertised and the
+// server is told not to play audio (INFO_NOAUDIOPLAYBACK).
+func (c *Client) DisableAudio() {
+	c.audioDisabled = true
+	c.audioHandler = nil
+	for i, ch := range c.channels {
+		if ch == audio.ChannelRDPSND {
+			c.channels = append(c.channels[:i], c.channels[i+1:]...)
+			break
+		}
+	}
+}
+
 // GetAudioHandler returns the audio handler
 func (c *Client) GetAudioHandler() *AudioHandler {
 	return c.audioHandler
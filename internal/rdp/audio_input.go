@@ -0,0 +1,413 @@
+package rdp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/rcarmo/go-rdp/internal/logging"
+	"github.com/rcarmo/go-rdp/internal/protocol/audio"
+	"github.com/rcarmo/go-rdp/internal/protocol/drdynvc"
+)
+
+// ErrAudioInputNotEnabled is returned when microphone audio is sent before
+// EnableAudioInput was called.
+var ErrAudioInputNotEnabled = errors.New("audio input redirection not enabled")
+
+// sndinOpenFailed is the HRESULT (E_FAIL) sent when the server opens a
+// format we never offered
+const sndinOpenFailed uint32 = 0x80004005
+
+// maxAudioInputMessage bounds the reassembled size of a fragmented
+// AUDIO_INPUT message; server messages are format lists and small controls.
+const maxAudioInputMessage = 64 * 1024
+
+// AudioInputCallback is called when the server opens audio input or
+// switches the capture format. Captured audio must be sent in format, in
+// packets of framesPerPacket frames where the server asked for a size.
+type AudioInputCallback func(format *audio.AudioFormat, framesPerPacket uint32)
+
+// AudioInputHandler manages the AUDIO_INPUT dynamic channel (MS-RDPEAI) used
+// for microphone redirection
+type AudioInputHandler struct {
+	client   *Client
+	callback AudioInputCallback
+
+	mu              sync.Mutex
+	channelID       uint32              // Dynamic channel ID, 0 until the server creates it
+	formats         []audio.AudioFormat // formats we offered (format indexes refer to this list)
+	current         int
+	framesPerPacket uint32
+	open            bool
+
+	// DYNVC_DATA_FIRST reassembly
+	pending    []byte
+	pendingLen int
+}
+
+// NewAudioInputHandler creates a new audio input handler
+func NewAudioInputHandler(client *Client) *AudioInputHandler {
+	return &AudioInputHandler{client: client, current: -1}
+}
+
+// SetCallback sets the function to call when capture starts or its format changes
+func (h *AudioInputHandler) SetCallback(cb AudioInputCallback) {
+	h.callback = cb
+}
+
+// IsOpen returns whether the server has opened audio input
+func (h *AudioInputHandler) IsOpen() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.open
+}
+
+// GetFormat returns the current capture format, or nil before the server opens audio input
+func (h *AudioInputHandler) GetFormat() *audio.AudioFormat {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.open || h.current < 0 || h.current >= len(h.formats) {
+		return nil
+	}
+	format := h.formats[h.current]
+	return &format
+}
+
+// HandleDRDYNVC processes DRDYNVC channel data and reports whether it
+// belonged to the AUDIO_INPUT channel. Unhandled PDUs are left for the
+// display control handler.
+func (h *AudioInputHandler) HandleDRDYNVC(data []byte) (bool, error) {
+	if len(data) < 1 {
+		return false, nil
+	}
+
+	var header drdynvc.Header
+	header.Deserialize(data[0])
+	body := data[1:]
+
+	switch header.Cmd {
+	case drdynvc.CmdCapability:
+		// Display control answers the caps request when it is enabled
+		if h.client.displayControl != nil {
+			return false, nil
+		}
+		return true, h.handleCaps(data)
+	case drdynvc.CmdCreate:
+		return h.handleCreate(header.CbChID, body)
+	case drdynvc.CmdDataFirst, drdynvc.CmdData:
+		return h.handleData(header, body)
+	case drdynvc.CmdClose:
+		channelID, _, err := drdynvc.ReadChannelID(body, header.CbChID)
+		if err != nil || !h.ownsChannel(channelID) {
+			return false, nil
+		}
+		h.mu.Lock()
+		h.reset()
+		h.channelID = 0
+		h.mu.Unlock()
+		logging.Info("Audio input: Server closed AUDIO_INPUT channel")
+		return true, nil
+	}
+	return false, nil
+}
+
+// handleCaps answers DYNVC_CAPS when no other handler does
+func (h *AudioInputHandler) handleCaps(data []byte) error {
+	caps := &drdynvc.CapsPDU{}
+	if err := caps.Deserialize(bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("parse DRDYNVC caps: %w", err)
+	}
+	response := &drdynvc.CapsPDU{Version: caps.Version}
+	return h.sendDRDYNVC(response.Serialize())
+}
+
+// handleCreate accepts the server's DYNVC_CREATE_REQ for AUDIO_INPUT
+func (h *AudioInputHandler) handleCreate(cbChID uint8, body []byte) (bool, error) {
+	var req drdynvc.CreateRequestPDU
+	if err := req.Deserialize(body, cbChID); err != nil || req.ChannelName != audio.ChannelAudioInput {
+		return false, nil
+	}
+
+	h.mu.Lock()
+	h.reset()
+	h.channelID = req.ChannelID
+	h.mu.Unlock()
+
+	logging.Debug("Audio input: AUDIO_INPUT channel created (id %d)", req.ChannelID)
+	resp := &drdynvc.CreateResponsePDU{ChannelID: req.ChannelID, CreationCode: drdynvc.CreateResultOK}
+	return true, h.sendDRDYNVC(resp.Serialize())
+}
+
+// handleData reassembles DYNVC_DATA_FIRST/DYNVC_DATA fragments on our channel
+func (h *AudioInputHandler) handleData(header drdynvc.Header, body []byte) (bool, error) {
+	channelID, remaining, err := drdynvc.ReadChannelID(body, header.CbChID)
+	if err != nil || !h.ownsChannel(channelID) {
+		return false, nil
+	}
+
+	h.mu.Lock()
+	if header.Cmd == drdynvc.CmdDataFirst {
+		total, rest, err := readDataFirstLength(remaining, header.Sp)
+		if err != nil {
+			h.mu.Unlock()
+			return true, err
+		}
+		if total > maxAudioInputMessage {
+			h.mu.Unlock()
+			return true, fmt.Errorf("audio input message too large: %d bytes", total)
+		}
+		h.pending = append(make([]byte, 0, total), rest...)
+		h.pendingLen = total
+	} else if h.pending != nil {
+		h.pending = append(h.pending, remaining...)
+	} else {
+		h.mu.Unlock()
+		return true, h.handleMessage(remaining)
+	}
+
+	if len(h.pending) < h.pendingLen {
+		h.mu.Unlock()
+		return true, nil
+	}
+	msg := h.pending
+	h.pending = nil
+	h.mu.Unlock()
+
+	return true, h.handleMessage(msg)
+}
+
+// readDataFirstLength reads the DYNVC_DATA_FIRST total length, whose size is given by Sp
+func readDataFirstLength(data []byte, sp uint8) (int, []byte, error) {
+	switch {
+	case sp == 0 && len(data) >= 1:
+		return int(data[0]), data[1:], nil
+	case sp == 1 && len(data) >= 2:
+		return int(binary.LittleEndian.Uint16(data)), data[2:], nil
+	case sp == 2 && len(data) >= 4:
+		return int(binary.LittleEndian.Uint32(data)), data[4:], nil
+	}
+	return 0, nil, fmt.Errorf("invalid DYNVC_DATA_FIRST length")
+}
+
+// handleMessage dispatches one complete AUDIO_INPUT message
+func (h *AudioInputHandler) handleMessage(msg []byte) error {
+	if len(msg) < 1 {
+		return nil
+	}
+
+	switch msg[0] {
+	case audio.MSG_SNDIN_VERSION:
+		return h.handleVersion(msg)
+	case audio.MSG_SNDIN_FORMATS:
+		return h.handleFormats(msg)
+	case audio.MSG_SNDIN_OPEN:
+		return h.handleOpen(msg)
+	case audio.MSG_SNDIN_FORMATCHANGE:
+		return h.handleFormatChange(msg)
+	default:
+		logging.Debug("Audio input: Unknown message 0x%02X", msg[0])
+	}
+	return nil
+}
+
+// handleVersion replies with the highest version both sides support
+func (h *AudioInputHandler) handleVersion(msg []byte) error {
+	var version audio.SndinVersionPDU
+	if err := version.Deserialize(msg); err != nil {
+		return err
+	}
+	reply := &audio.SndinVersionPDU{Version: audio.SNDIN_VERSION_2}
+	if version.Version < reply.Version {
+		reply.Version = version.Version
+	}
+	return h.send(reply.Serialize())
+}
+
+// handleFormats offers back the server formats the browser can capture:
+// 16-bit mono or stereo PCM, which it resamples to the requested rate
+func (h *AudioInputHandler) handleFormats(msg []byte) error {
+	var serverFormats audio.SndinFormatsPDU
+	if err := serverFormats.Deserialize(msg); err != nil {
+		return err
+	}
+
+	var formats []audio.AudioFormat
+	for _, format := range serverFormats.Formats {
+		logging.Debug("Audio input:   Server format: %s", format.String())
+		if format.FormatTag == audio.WAVE_FORMAT_PCM && format.BitsPerSample == 16 &&
+			(format.Channels == 1 || format.Channels == 2) && format.SamplesPerSec > 0 {
+			formats = append(formats, format)
+		}
+	}
+	logging.Info("Audio input: Server offers %d formats, %d usable", len(serverFormats.Formats), len(formats))
+
+	h.mu.Lock()
+	h.formats = formats
+	h.current = -1
+	h.open = false
+	h.mu.Unlock()
+
+	reply := &audio.SndinFormatsPDU{Formats: formats}
+	return h.send(reply.Serialize())
+}
+
+// handleOpen confirms the initial format and reports the open result
+func (h *AudioInputHandler) handleOpen(msg []byte) error {
+	var open audio.SndinOpenPDU
+	if err := open.Deserialize(msg); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	if int(open.InitialFormat) >= len(h.formats) {
+		h.mu.Unlock()
+		logging.Warn("Audio input: Server opened unknown format %d", open.InitialFormat)
+		reply := &audio.SndinOpenReplyPDU{Result: sndinOpenFailed}
+		return h.send(reply.Serialize())
+	}
+	h.current = int(open.InitialFormat)
+	h.framesPerPacket = open.FramesPerPacket
+	h.open = true
+	format := h.formats[h.current]
+	h.mu.Unlock()
+
+	logging.Info("Audio input: Opened %s (%d frames per packet)", format.String(), open.FramesPerPacket)
+
+	change := &audio.SndinFormatChangePDU{NewFormat: open.InitialFormat}
+	if err := h.send(change.Serialize()); err != nil {
+		return err
+	}
+	reply := &audio.SndinOpenReplyPDU{Result: 0}
+	if err := h.send(reply.Serialize()); err != nil {
+		return err
+	}
+
+	h.notify(&format, open.FramesPerPacket)
+	return nil
+}
+
+// handleFormatChange switches to the requested format and echoes the
+// message back to confirm it
+func (h *AudioInputHandler) handleFormatChange(msg []byte) error {
+	var change audio.SndinFormatChangePDU
+	if err := change.Deserialize(msg); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	if int(change.NewFormat) >= len(h.formats) {
+		h.mu.Unlock()
+		return fmt.Errorf("audio input format change to unknown format %d", change.NewFormat)
+	}
+	h.current = int(change.NewFormat)
+	format := h.formats[h.current]
+	framesPerPacket := h.framesPerPacket
+	open := h.open
+	h.mu.Unlock()
+
+	logging.Info("Audio input: Format changed to %s", format.String())
+	if err := h.send(change.Serialize()); err != nil {
+		return err
+	}
+	if open {
+		h.notify(&format, framesPerPacket)
+	}
+	return nil
+}
+
+func (h *AudioInputHandler) notify(format *audio.AudioFormat, framesPerPacket uint32) {
+	if h.callback != nil {
+		h.callback(format, framesPerPacket)
+	}
+}
+
+// SendAudio forwards one packet of captured audio, already in the current
+// capture format. Audio sent before the server opens the channel is dropped.
+func (h *AudioInputHandler) SendAudio(data []byte) error {
+	if len(data) == 0 || !h.IsOpen() {
+		return nil
+	}
+
+	incoming, payload := audio.BuildSndinData(data)
+	if err := h.send(incoming); err != nil {
+		return err
+	}
+	return h.send(payload)
+}
+
+// send writes an AUDIO_INPUT message on the dynamic channel
+func (h *AudioInputHandler) send(msg []byte) error {
+	h.mu.Lock()
+	channelID := h.channelID
+	h.mu.Unlock()
+
+	if channelID == 0 {
+		return fmt.Errorf("AUDIO_INPUT channel not created")
+	}
+
+	for _, pdu := range drdynvc.Fragment(channelID, msg) {
+		if err := h.sendDRDYNVC(pdu); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendDRDYNVC sends one DRDYNVC PDU on the drdynvc static channel
+func (h *AudioInputHandler) sendDRDYNVC(pdu []byte) error {
+	channelID, ok := h.client.channelIDMap[drdynvc.ChannelName]
+	if !ok {
+		return fmt.Errorf("DRDYNVC channel not initialized")
+	}
+	return h.client.sendChannelData(channelID, audio.BuildChannelData(pdu))
+}
+
+func (h *AudioInputHandler) ownsChannel(channelID uint32) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.channelID != 0 && h.channelID == channelID
+}
+
+// reset clears negotiation state; the caller holds h.mu
+func (h *AudioInputHandler) reset() {
+	h.formats = nil
+	h.current = -1
+	h.framesPerPacket = 0
+	h.open = false
+	h.pending = nil
+	h.pendingLen = 0
+}
+
+// EnableAudioInput registers the drdynvc channel so the server can open
+// AUDIO_INPUT for microphone redirection
+func (c *Client) EnableAudioInput() {
+	if c.audioInputHandler != nil {
+		return
+	}
+	hasDRDYNVC := false
+	for _, ch := range c.channels {
+		if ch == drdynvc.ChannelName {
+			hasDRDYNVC = true
+			break
+		}
+	}
+	if !hasDRDYNVC {
+		c.channels = append(c.channels, drdynvc.ChannelName)
+	}
+	c.audioInputHandler = NewAudioInputHandler(c)
+}
+
+// GetAudioInputHandler returns the audio input handler
+func (c *Client) GetAudioInputHandler() *AudioInputHandler {
+	return c.audioInputHandler
+}
+
+// SendAudioInput forwards captured microphone audio to the server
+func (c *Client) SendAudioInput(data []byte) error {
+	if c.audioInputHandler == nil {
+		return ErrAudioInputNotEnabled
+	}
+	return c.audioInputHandler.SendAudio(data)
+}
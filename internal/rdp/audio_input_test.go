@@ -0,0 +1,218 @@
+package rdp
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcarmo/go-rdp/internal/protocol/audio"
+	"github.com/rcarmo/go-rdp/internal/protocol/drdynvc"
+)
+
+const testAudioInputChannel = 5
+
+// newAudioInputTestClient returns a client with the drdynvc channel joined
+// and a mock MCS layer recording what is sent.
+func newAudioInputTestClient() (*Client, *MockMCSLayer) {
+	mockMCS := &MockMCSLayer{}
+	client := &Client{
+		userID:       1001,
+		channelIDMap: map[string]uint16{drdynvc.ChannelName: 1009},
+		mcsLayer:     mockMCS,
+	}
+	client.EnableAudioInput()
+	return client, mockMCS
+}
+
+// serverAudioInput wraps an AUDIO_INPUT message in a DYNVC_DATA PDU
+func serverAudioInput(msg []byte) []byte {
+	return (&drdynvc.DataPDU{ChannelID: testAudioInputChannel, Data: msg}).Serialize()
+}
+
+// sentAudioInput returns the AUDIO_INPUT messages the client sent, in order
+func sentAudioInput(t *testing.T, m *MockMCSLayer) [][]byte {
+	t.Helper()
+	var msgs [][]byte
+	for _, call := range m.SendCalls {
+		require.Equal(t, uint16(1009), call.ChannelID)
+		chunk, err := audio.ParseChannelData(call.Data)
+		require.NoError(t, err)
+		cmd, cbChID, remaining, err := drdynvc.ParsePDU(chunk.Data)
+		require.NoError(t, err)
+		if cmd != drdynvc.CmdData {
+			continue
+		}
+		channelID, msg, err := drdynvc.ReadChannelID(remaining, cbChID)
+		require.NoError(t, err)
+		require.Equal(t, uint32(testAudioInputChannel), channelID)
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func openAudioInputChannel(t *testing.T, h *AudioInputHandler) {
+	t.Helper()
+	req := &drdynvc.CreateRequestPDU{ChannelID: testAudioInputChannel, ChannelName: audio.ChannelAudioInput}
+	handled, err := h.HandleDRDYNVC(req.Serialize())
+	require.NoError(t, err)
+	require.True(t, handled)
+}
+
+func TestEnableAudioInput(t *testing.T) {
+	client := &Client{channels: []string{drdynvc.ChannelName}}
+	client.EnableAudioInput()
+	client.EnableAudioInput()
+
+	assert.Equal(t, []string{drdynvc.ChannelName}, client.channels)
+	require.NotNil(t, client.GetAudioInputHandler())
+
+	assert.ErrorIs(t, (&Client{}).SendAudioInput([]byte{1, 2}), ErrAudioInputNotEnabled)
+}
+
+func TestAudioInputHandler_Negotiation(t *testing.T) {
+	client, mockMCS := newAudioInputTestClient()
+	h := client.GetAudioInputHandler()
+
+	var opened []audio.AudioFormat
+	var frames uint32
+	h.SetCallback(func(format *audio.AudioFormat, framesPerPacket uint32) {
+		opened = append(opened, *format)
+		frames = framesPerPacket
+	})
+
+	// Other dynamic channels are left for display control
+	other := &drdynvc.CreateRequestPDU{ChannelID: 9, ChannelName: "Microsoft::Windows::RDS::DisplayControl"}
+	handled, err := h.HandleDRDYNVC(other.Serialize())
+	require.NoError(t, err)
+	assert.False(t, handled)
+
+	openAudioInputChannel(t, h)
+	require.Len(t, mockMCS.SendCalls, 1)
+	chunk, err := audio.ParseChannelData(mockMCS.SendCalls[0].Data)
+	require.NoError(t, err)
+	assert.Equal(t, (&drdynvc.CreateResponsePDU{ChannelID: testAudioInputChannel}).Serialize(), chunk.Data)
+	mockMCS.SendCalls = nil
+
+	// Version: reply with the highest common version
+	_, err = h.HandleDRDYNVC(serverAudioInput((&audio.SndinVersionPDU{Version: 5}).Serialize()))
+	require.NoError(t, err)
+
+	// Formats: only 16-bit PCM is offered back
+	mono := audio.AudioFormat{FormatTag: audio.WAVE_FORMAT_PCM, Channels: 1, SamplesPerSec: 22050, AvgBytesPerSec: 44100, BlockAlign: 2, BitsPerSample: 16}
+	stereo := audio.AudioFormat{FormatTag: audio.WAVE_FORMAT_PCM, Channels: 2, SamplesPerSec: 44100, AvgBytesPerSec: 176400, BlockAlign: 4, BitsPerSample: 16}
+	serverFormats := &audio.SndinFormatsPDU{Formats: []audio.AudioFormat{
+		{FormatTag: audio.WAVE_FORMAT_ALAW, Channels: 1, SamplesPerSec: 8000, BitsPerSample: 8},
+		mono,
+		{FormatTag: audio.WAVE_FORMAT_PCM, Channels: 1, SamplesPerSec: 8000, BitsPerSample: 8},
+		stereo,
+	}}
+	_, err = h.HandleDRDYNVC(serverAudioInput(serverFormats.Serialize()))
+	require.NoError(t, err)
+
+	// Audio before the server opens the channel is dropped
+	require.NoError(t, client.SendAudioInput([]byte{1, 2}))
+	assert.False(t, h.IsOpen())
+
+	// Open in client format 1 (stereo)
+	open := []byte{audio.MSG_SNDIN_OPEN, 0, 0, 0, 0, 1, 0, 0, 0}
+	binary.LittleEndian.PutUint32(open[1:], 882)
+	open = append(open, stereo.Serialize()...)
+	_, err = h.HandleDRDYNVC(serverAudioInput(open))
+	require.NoError(t, err)
+	assert.True(t, h.IsOpen())
+	assert.Equal(t, &stereo, h.GetFormat())
+
+	// The server switches format; the client confirms it
+	change := (&audio.SndinFormatChangePDU{NewFormat: 0}).Serialize()
+	_, err = h.HandleDRDYNVC(serverAudioInput(change))
+	require.NoError(t, err)
+	assert.Equal(t, &mono, h.GetFormat())
+
+	require.NoError(t, client.SendAudioInput([]byte{1, 2, 3, 4}))
+
+	msgs := sentAudioInput(t, mockMCS)
+	require.Len(t, msgs, 7)
+	assert.Equal(t, (&audio.SndinVersionPDU{Version: audio.SNDIN_VERSION_2}).Serialize(), msgs[0])
+
+	var offered audio.SndinFormatsPDU
+	require.NoError(t, offered.Deserialize(msgs[1]))
+	assert.Equal(t, []audio.AudioFormat{mono, stereo}, offered.Formats)
+
+	assert.Equal(t, (&audio.SndinFormatChangePDU{NewFormat: 1}).Serialize(), msgs[2], "initial format announced before the open reply")
+	assert.Equal(t, (&audio.SndinOpenReplyPDU{Result: 0}).Serialize(), msgs[3])
+	assert.Equal(t, change, msgs[4], "format change echoed as confirmation")
+	assert.Equal(t, []byte{audio.MSG_SNDIN_DATA_INCOMING}, msgs[5])
+	assert.Equal(t, []byte{audio.MSG_SNDIN_DATA, 1, 2, 3, 4}, msgs[6])
+
+	assert.Equal(t, []audio.AudioFormat{stereo, mono}, opened)
+	assert.Equal(t, uint32(882), frames)
+
+	// Closing the channel stops forwarding
+	handled, err = h.HandleDRDYNVC((&drdynvc.ClosePDU{ChannelID: testAudioInputChannel}).Serialize())
+	require.NoError(t, err)
+	assert.True(t, handled)
+	assert.False(t, h.IsOpen())
+}
+
+func TestAudioInputHandler_OpenUnknownFormat(t *testing.T) {
+	client, mockMCS := newAudioInputTestClient()
+	h := client.GetAudioInputHandler()
+	openAudioInputChannel(t, h)
+	mockMCS.SendCalls = nil
+
+	format := audio.AudioFormat{FormatTag: audio.WAVE_FORMAT_PCM, Channels: 1, SamplesPerSec: 16000, BitsPerSample: 16}
+	open := append([]byte{audio.MSG_SNDIN_OPEN, 0, 0, 0, 0, 3, 0, 0, 0}, format.Serialize()...)
+	_, err := h.HandleDRDYNVC(serverAudioInput(open))
+	require.NoError(t, err)
+	assert.False(t, h.IsOpen())
+
+	msgs := sentAudioInput(t, mockMCS)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, (&audio.SndinOpenReplyPDU{Result: sndinOpenFailed}).Serialize(), msgs[0])
+
+	_, err = h.HandleDRDYNVC(serverAudioInput((&audio.SndinFormatChangePDU{NewFormat: 2}).Serialize()))
+	assert.Error(t, err)
+}
+
+func TestAudioInputHandler_FragmentedMessage(t *testing.T) {
+	client, mockMCS := newAudioInputTestClient()
+	h := client.GetAudioInputHandler()
+	openAudioInputChannel(t, h)
+	mockMCS.SendCalls = nil
+
+	formats := make([]audio.AudioFormat, 100)
+	for i := range formats {
+		formats[i] = audio.AudioFormat{FormatTag: audio.WAVE_FORMAT_PCM, Channels: 1, SamplesPerSec: uint32(8000 + i), BitsPerSample: 16}
+	}
+	pdus := drdynvc.Fragment(testAudioInputChannel, (&audio.SndinFormatsPDU{Formats: formats}).Serialize())
+	require.Greater(t, len(pdus), 1)
+	for _, pdu := range pdus {
+		handled, err := h.HandleDRDYNVC(pdu)
+		require.NoError(t, err)
+		require.True(t, handled)
+	}
+
+	// The client's reply is large enough to be fragmented too
+	require.NotEmpty(t, mockMCS.SendCalls)
+	chunk, err := audio.ParseChannelData(mockMCS.SendCalls[0].Data)
+	require.NoError(t, err)
+	var header drdynvc.Header
+	header.Deserialize(chunk.Data[0])
+	assert.Equal(t, drdynvc.CmdDataFirst, header.Cmd)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	assert.Len(t, h.formats, 100)
+}
+
+func TestClient_HandleDRDYNVC_CapsWithoutDisplayControl(t *testing.T) {
+	client, mockMCS := newAudioInputTestClient()
+
+	client.handleDRDYNVC((&drdynvc.CapsPDU{Version: drdynvc.CapsVersion2}).Serialize())
+	require.Len(t, mockMCS.SendCalls, 1)
+	chunk, err := audio.ParseChannelData(mockMCS.SendCalls[0].Data)
+	require.NoError(t, err)
+	assert.Equal(t, (&drdynvc.CapsPDU{Version: drdynvc.CapsVersion2}).Serialize(), chunk.Data)
+}
@@ -0,0 +1,81 @@
+package rdp
+
+import (
+	"github.com/rcarmo/go-rdp/internal/logging"
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+)
+
+// LogonSession is the logon session the server reported in the extended
+// logon info of a Save Session Info PDU.
+type LogonSession struct {
+	// ID is the logon session ID the server assigned
+	ID uint32
+	// AutoReconnect is true when the server offered automatic reconnection
+	AutoReconnect bool
+}
+
+// LogonSession returns the logon session reported by the server, or nil if
+// none has been reported.
+func (c *Client) LogonSession() *LogonSession {
+	return c.logonSession
+}
+
+// ReconnectCookieCallback is called with each auto-reconnect cookie sent by the server
+type ReconnectCookieCallback func(cookie []byte)
+
+// SetReconnectCookieCallback sets the function to call when the server sends
+// an auto-reconnect cookie in a Save Session Info PDU
+func (c *Client) SetReconnectCookieCallback(cb ReconnectCookieCallback) {
+	c.reconnectCookieCallback = cb
+}
+
+// ReconnectCookie returns the last auto-reconnect cookie (ARC_SC_PRIVATE_PACKET)
+// sent by the server, or nil if none has been received. Passing it to
+// SetReconnectCookie on a new client lets that client reconnect to the same
+// session without a full logon.
+func (c *Client) ReconnectCookie() []byte {
+	if c.autoReconnectCookie == nil {
+		return nil
+	}
+	return c.autoReconnectCookie.Serialize()
+}
+
+// SetReconnectCookie sets the auto-reconnect cookie to present in the Client
+// Info PDU. It must be called before Connect.
+func (c *Client) SetReconnectCookie(cookie []byte) error {
+	arc, err := pdu.ParseARCSCPrivatePacket(cookie)
+	if err != nil {
+		return err
+	}
+	c.autoReconnectCookie = arc
+	return nil
+}
+
+// clientAutoReconnectPacket answers the stored cookie for the Client Info PDU.
+// Only Enhanced RDP Security is supported, so the client random the security
+// verifier is computed over is all zeros (MS-RDPBCGR 5.5).
+func (c *Client) clientAutoReconnectPacket() *pdu.ARCCSPrivatePacket {
+	logging.Info("Requesting automatic reconnection to logon session %d", c.autoReconnectCookie.LogonID)
+	return pdu.NewARCCSPrivatePacket(c.autoReconnectCookie, make([]byte, pdu.ClientRandomLength))
+}
+
+// handleSaveSessionInfo records the auto-reconnect cookie and logon errors
+// of a Save Session Info PDU and reports them to the callbacks
+func (c *Client) handleSaveSessionInfo(info *pdu.SaveSessionInfoPDUData) {
+	if info == nil {
+		return
+	}
+	if info.LogonErrors != nil {
+		c.handleLogonErrors(info.LogonErrors)
+	}
+	logonID, ok := info.LogonID()
+	if !ok {
+		return
+	}
+	c.logonSession = &LogonSession{ID: logonID, AutoReconnect: info.AutoReconnectEnabled()}
+	logging.Info("Logon session %d: auto-reconnect=%v", logonID, c.logonSession.AutoReconnect)
+	c.autoReconnectCookie = info.AutoReconnectCookie
+	if c.reconnectCookieCallback != nil {
+		c.reconnectCookieCallback(c.autoReconnectCookie.Serialize())
+	}
+}
@@ -0,0 +1,181 @@
+package rdp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testARCCookie() *pdu.ARCSCPrivatePacket {
+	cookie := &pdu.ARCSCPrivatePacket{LogonID: 7}
+	for i := range cookie.ArcRandomBits {
+		cookie.ArcRandomBits[i] = byte(0xA0 + i)
+	}
+	return cookie
+}
+
+func buildSaveSessionInfoBody(cookie *pdu.ARCSCPrivatePacket) []byte {
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, binary.LittleEndian, uint32(pdu.InfoTypeLogonExtendedInfo))
+	_ = binary.Write(buf, binary.LittleEndian, uint16(2+4+4+pdu.AutoReconnectCookieLength)) // Length
+	_ = binary.Write(buf, binary.LittleEndian, uint32(0x00000001))                          // LOGON_EX_AUTORECONNECTCOOKIE
+	_ = binary.Write(buf, binary.LittleEndian, uint32(pdu.AutoReconnectCookieLength))       // cbFieldData
+	buf.Write(cookie.Serialize())
+	buf.Write(make([]byte, 570)) // Pad
+	return buf.Bytes()
+}
+
+func TestClient_SetReconnectCookie(t *testing.T) {
+	client := &Client{}
+	assert.Nil(t, client.ReconnectCookie())
+
+	cookie := testARCCookie().Serialize()
+	require.NoError(t, client.SetReconnectCookie(cookie))
+	assert.Equal(t, cookie, client.ReconnectCookie())
+
+	assert.ErrorIs(t, client.SetReconnectCookie(cookie[:10]), pdu.ErrInvalidAutoReconnectCookie)
+	assert.Equal(t, cookie, client.ReconnectCookie(), "invalid cookie should not replace the stored one")
+}
+
+func TestClient_secureSettingsExchange_AutoReconnectCookie(t *testing.T) {
+	send := func(client *Client) []byte {
+		mockMCS := &testMCSLayer{}
+		client.mcsLayer = mockMCS
+		client.userID = 1001
+		client.channelIDMap = map[string]uint16{"global": 1003}
+		client.username = "user"
+		client.selectedProtocol = pdu.NegotiationProtocolSSL
+		require.NoError(t, client.secureSettingsExchange())
+		require.Len(t, mockMCS.sendCalls, 1)
+		return mockMCS.sendCalls[0].data
+	}
+
+	plain := send(&Client{})
+
+	client := &Client{}
+	require.NoError(t, client.SetReconnectCookie(testARCCookie().Serialize()))
+	withCookie := send(client)
+
+	expected := pdu.NewARCCSPrivatePacket(testARCCookie(), make([]byte, pdu.ClientRandomLength)).Serialize()
+	require.Len(t, withCookie, len(plain)+2+pdu.AutoReconnectCookieLength)
+	assert.Equal(t, plain, withCookie[:len(plain)])
+	assert.Equal(t, expected, withCookie[len(plain)+2:])
+}
+
+func TestConnectionFinalization_SaveSessionInfo(t *testing.T) {
+	control := func(action uint16) []byte {
+		return append(binary.LittleEndian.AppendUint16(nil, action), 0, 0, 0, 0, 0, 0)
+	}
+	pdus := [][]byte{
+		buildServerDataPDU(pdu.Type2Synchronize, []byte{0x01, 0x00, 0xE9, 0x03}),
+		buildServerDataPDU(pdu.Type2Control, control(uint16(pdu.ControlActionCooperate))),
+		buildServerDataPDU(pdu.Type2SaveSessionInfo, buildSaveSessionInfoBody(testARCCookie())),
+		buildServerDataPDU(pdu.Type2Control, control(uint16(pdu.ControlActionGrantedControl))),
+		buildServerDataPDU(pdu.Type2Fontmap, make([]byte, 8)),
+	}
+
+	client := &Client{
+		mcsLayer: &testMCSLayer{
+			receiveFunc: func() (uint16, io.Reader, error) {
+				if len(pdus) == 0 {
+					return 0, nil, io.EOF
+				}
+				next := pdus[0]
+				pdus = pdus[1:]
+				return 1003, bytes.NewReader(next), nil
+			},
+		},
+		shareID:      0x12345678,
+		userID:       1001,
+		channelIDMap: map[string]uint16{"global": 1003},
+	}
+
+	require.NoError(t, client.connectionFinalization())
+	assert.Equal(t, testARCCookie().Serialize(), client.ReconnectCookie())
+}
+
+func TestGetX224Update_SaveSessionInfo(t *testing.T) {
+	wire := buildServerDataPDU(pdu.Type2SaveSessionInfo, buildSaveSessionInfoBody(testARCCookie()))
+	client := &Client{
+		channelIDMap: map[string]uint16{"global": 1003},
+		mcsLayer: &MockMCSLayer{
+			ReceiveFunc: func() (uint16, io.Reader, error) {
+				return 1003, bytes.NewReader(wire), nil
+			},
+		},
+	}
+
+	var got []byte
+	client.SetReconnectCookieCallback(func(cookie []byte) {
+		got = cookie
+	})
+
+	update, err := client.getX224Update()
+	require.NoError(t, err)
+	assert.Nil(t, update)
+	assert.Equal(t, testARCCookie().Serialize(), got)
+	assert.Equal(t, got, client.ReconnectCookie())
+	assert.Equal(t, &LogonSession{ID: 7, AutoReconnect: true}, client.LogonSession())
+}
+
+func TestGetX224Update_SaveSessionInfoWithoutCookie(t *testing.T) {
+	// INFOTYPE_LOGON_PLAINNOTIFY carries no cookie
+	wire := buildServerDataPDU(pdu.Type2SaveSessionInfo, append([]byte{0x02, 0x00, 0x00, 0x00}, make([]byte, 576)...))
+	client := &Client{
+		channelIDMap: map[string]uint16{"global": 1003},
+		mcsLayer: &MockMCSLayer{
+			ReceiveFunc: func() (uint16, io.Reader, error) {
+				return 1003, bytes.NewReader(wire), nil
+			},
+		},
+	}
+	client.SetReconnectCookieCallback(func([]byte) {
+		t.Fatal("callback should not run without a cookie")
+	})
+
+	update, err := client.getX224Update()
+	require.NoError(t, err)
+	assert.Nil(t, update)
+	assert.Nil(t, client.ReconnectCookie())
+	assert.Nil(t, client.LogonSession())
+}
+
+func TestGetX224Update_SaveSessionInfoLogonErrors(t *testing.T) {
+	body := new(bytes.Buffer)
+	_ = binary.Write(body, binary.LittleEndian, uint32(pdu.InfoTypeLogonExtendedInfo))
+	_ = binary.Write(body, binary.LittleEndian, uint16(2+4+4+8))    // Length
+	_ = binary.Write(body, binary.LittleEndian, uint32(0x00000002)) // LOGON_EX_LOGONERRORS
+	_ = binary.Write(body, binary.LittleEndian, uint32(8))          // cbFieldData
+	body.Write((&pdu.LogonErrorsInfo{ErrorNotificationType: 0xC0000234, ErrorNotificationData: pdu.LogonFailedOther}).Serialize())
+	body.Write(make([]byte, 570)) // Pad
+
+	wire := buildServerDataPDU(pdu.Type2SaveSessionInfo, body.Bytes())
+	client := &Client{
+		channelIDMap: map[string]uint16{"global": 1003},
+		mcsLayer: &MockMCSLayer{
+			ReceiveFunc: func() (uint16, io.Reader, error) {
+				return 1003, bytes.NewReader(wire), nil
+			},
+		},
+	}
+
+	var got []pdu.LogonErrorsInfo
+	client.SetLogonErrorCallback(func(info pdu.LogonErrorsInfo) {
+		got = append(got, info)
+	})
+	client.SetReconnectCookieCallback(func([]byte) {
+		t.Fatal("callback should not run without a cookie")
+	})
+
+	update, err := client.getX224Update()
+	require.NoError(t, err)
+	assert.Nil(t, update)
+	require.Len(t, got, 1)
+	assert.Equal(t, "account locked", got[0].Reason())
+	assert.Equal(t, &got[0], client.LogonError())
+}
@@ -0,0 +1,229 @@
+package rdp
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+
+	"github.com/rcarmo/go-rdp/internal/codec"
+	"github.com/rcarmo/go-rdp/internal/logging"
+	"github.com/rcarmo/go-rdp/internal/protocol/orders"
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+)
+
+// bitmapCacheCellEntries is the number of entries advertised for revision 2
+// cell caches 0-2, which hold bitmaps of up to 256, 1024 and 4096 pixels
+var bitmapCacheCellEntries = []uint32{600, 600, 1024}
+
+// ropSrcCopy is the SRCCOPY raster operation, the only one MemBlt orders are
+// rendered with
+const ropSrcCopy = 0xCC
+
+// cachedBitmap is a bitmap held in a cell cache, stored uncompressed with
+// bottom-up rows as in a TS_BITMAP_DATA
+type cachedBitmap struct {
+	width, height, bpp int
+	data               []byte
+}
+
+// bitmapCache keeps the revision 2 bitmap cell caches in memory and turns
+// MemBlt orders that draw from them into TS_BITMAP_DATA the browser can
+// render. Persistent (disk) caching is not supported.
+type bitmapCache struct {
+	cells [][]*cachedBitmap
+
+	hits    atomic.Uint64
+	misses  atomic.Uint64
+	skipped atomic.Uint64 // MemBlt orders not drawn because of their raster operation
+}
+
+func newBitmapCache(cellEntries []uint32) *bitmapCache {
+	b := &bitmapCache{}
+	for _, entries := range cellEntries {
+		// One extra slot holds the waiting list entry
+		b.cells = append(b.cells, make([]*cachedBitmap, entries+1))
+	}
+	return b
+}
+
+// EnableBitmapCache advertises in-memory revision 2 bitmap caches and the
+// MemBlt order, and renders cached bitmaps drawn with MemBlt as bitmap
+// updates. It must be called before Connect.
+func (c *Client) EnableBitmapCache() {
+	c.bitmapCache = newBitmapCache(bitmapCacheCellEntries)
+	c.enableOrders().cache = c.bitmapCache
+}
+
+// confirmActiveCapabilities replaces the revision 1 bitmap cache capability
+// set with revision 2 cell caches and enables the MemBlt order
+func (b *bitmapCache) confirmActiveCapabilities(sets []pdu.CapabilitySet) {
+	entries := make([]uint32, len(b.cells))
+	for i, cell := range b.cells {
+		entries[i] = uint32(len(cell) - 1) // #nosec G115
+	}
+
+	for i, set := range sets {
+		switch {
+		case set.BitmapCacheCapabilitySetRev1 != nil:
+			sets[i] = pdu.NewBitmapCacheCapabilitySetRev2(entries...)
+		case set.OrderCapabilitySet != nil:
+			set.OrderCapabilitySet.OrderSupport[pdu.OrderSupportMemBltIndex] = 1
+		}
+	}
+}
+
+// stats returns the MemBlt cache hits and misses so far, and the MemBlt
+// orders skipped because of their raster operation
+func (b *bitmapCache) stats() (hits, misses, skipped uint64) {
+	return b.hits.Load(), b.misses.Load(), b.skipped.Load()
+}
+
+// slot returns the cache entry for index in cell id, or nil when out of range
+func (b *bitmapCache) slot(id uint8, index uint16) **cachedBitmap {
+	if int(id) >= len(b.cells) {
+		return nil
+	}
+	cell := b.cells[id]
+	if index == orders.WaitingListIndex {
+		return &cell[len(cell)-1]
+	}
+	if int(index) >= len(cell)-1 {
+		return nil
+	}
+	return &cell[index]
+}
+
+// cacheBitmap stores a bitmap sent with a Cache Bitmap (Revision 2) order
+func (b *bitmapCache) cacheBitmap(o *orders.CacheBitmapRev2) {
+	slot := b.slot(o.CacheID, o.CacheIndex)
+	if slot == nil {
+		logging.Debug("Bitmap cache: entry %d:%d out of range", o.CacheID, o.CacheIndex)
+		return
+	}
+
+	bmp := decodeCachedBitmap(o)
+	if bmp == nil {
+		logging.Debug("Bitmap cache: cannot decode %dx%d %d bpp bitmap", o.Width, o.Height, o.BitsPerPixel)
+	}
+	*slot = bmp
+}
+
+// memBlt copies part of a cached bitmap to the screen as a TS_BITMAP_DATA,
+// returning nil when there is nothing to draw
+func (b *bitmapCache) memBlt(o *orders.MemBlt) []byte {
+	var bmp *cachedBitmap
+	if slot := b.slot(o.CacheID, o.CacheIndex); slot != nil {
+		bmp = *slot
+	}
+	if bmp == nil {
+		b.misses.Add(1)
+		return nil
+	}
+	b.hits.Add(1)
+
+	// Other raster operations combine the bitmap with the screen, which
+	// only the browser holds, so the area is left as it was
+	if o.Rop != ropSrcCopy {
+		if b.skipped.Add(1) == 1 {
+			logging.Warn("Bitmap cache: MemBlt raster operation 0x%02X not supported, skipping such orders", o.Rop)
+		} else {
+			logging.Debug("Bitmap cache: MemBlt raster operation 0x%02X not supported", o.Rop)
+		}
+		return nil
+	}
+
+	// Screen position of the cached bitmap's top-left pixel
+	originX, originY := int(o.Left)-int(o.SrcX), int(o.Top)-int(o.SrcY)
+
+	left := max(int(o.Left), originX, 0)
+	top := max(int(o.Top), originY, 0)
+	right := min(int(o.Left)+int(o.Width), originX+bmp.width) - 1
+	bottom := min(int(o.Top)+int(o.Height), originY+bmp.height) - 1
+	if o.Bounds != nil {
+		left, top = max(left, int(o.Bounds.Left)), max(top, int(o.Bounds.Top))
+		right, bottom = min(right, int(o.Bounds.Right)), min(bottom, int(o.Bounds.Bottom))
+	}
+	if left > right || top > bottom {
+		return nil
+	}
+
+	width, height := right-left+1, bottom-top+1
+	bytesPerPixel := (bmp.bpp + 7) / 8
+	rowSize := width * bytesPerPixel
+	if 18+rowSize*height > maxBitmapUpdateSize-4 {
+		logging.Debug("Bitmap cache: %dx%d MemBlt too large for one update", width, height)
+		return nil
+	}
+
+	rect := make([]byte, 18, 18+rowSize*height)
+	binary.LittleEndian.PutUint16(rect[0:], uint16(left))            // #nosec G115
+	binary.LittleEndian.PutUint16(rect[2:], uint16(top))             // #nosec G115
+	binary.LittleEndian.PutUint16(rect[4:], uint16(right))           // #nosec G115
+	binary.LittleEndian.PutUint16(rect[6:], uint16(bottom))          // #nosec G115
+	binary.LittleEndian.PutUint16(rect[8:], uint16(width))           // #nosec G115
+	binary.LittleEndian.PutUint16(rect[10:], uint16(height))         // #nosec G115
+	binary.LittleEndian.PutUint16(rect[12:], uint16(bmp.bpp))        // #nosec G115
+	binary.LittleEndian.PutUint16(rect[16:], uint16(rowSize*height)) // #nosec G115
+
+	// Both the cache and the update store rows bottom-up
+	srcCol := (left - originX) * bytesPerPixel
+	for y := bottom; y >= top; y-- {
+		row := bmp.height - 1 - (y - originY)
+		start := row*bmp.width*bytesPerPixel + srcCol
+		rect = append(rect, bmp.data[start:start+rowSize]...)
+	}
+	return rect
+}
+
+// decodeCachedBitmap expands the data of a cache bitmap order, returning nil
+// when it cannot be decoded
+func decodeCachedBitmap(o *orders.CacheBitmapRev2) *cachedBitmap {
+	bmp := &cachedBitmap{width: o.Width, height: o.Height, bpp: o.BitsPerPixel}
+	if bmp.width <= 0 || bmp.height <= 0 {
+		return nil
+	}
+
+	if !o.Compressed {
+		size := bmp.width * bmp.height * ((bmp.bpp + 7) / 8)
+		if len(o.Data) < size {
+			return nil
+		}
+		bmp.data = append([]byte(nil), o.Data[:size]...)
+		return bmp
+	}
+
+	if bmp.bpp == 32 && o.NoCompressionHeader {
+		rgba := codec.DecodePlanar(o.Data, bmp.width, bmp.height)
+		if rgba == nil {
+			return nil
+		}
+		// Planar output is top-down RGBA; the browser reads 32 bpp as BGRA
+		codec.FlipVertical(rgba, bmp.width, bmp.height, 4)
+		for i := 0; i+3 < len(rgba); i += 4 {
+			rgba[i], rgba[i+2] = rgba[i+2], rgba[i]
+		}
+		bmp.data = rgba
+		return bmp
+	}
+
+	// Interleaved RLE has no 32 bpp form; it is sent as 24 bpp
+	if bmp.bpp == 32 {
+		bmp.bpp = 24
+	}
+	bytesPerPixel := (bmp.bpp + 7) / 8
+	bmp.data = make([]byte, bmp.width*bmp.height*bytesPerPixel)
+	rowDelta := bmp.width * bytesPerPixel
+
+	var ok bool
+	switch bmp.bpp {
+	case 8:
+		ok = codec.RLEDecompress8(o.Data, bmp.data, rowDelta)
+	case 16:
+		ok = codec.RLEDecompress16(o.Data, bmp.data, rowDelta)
+	case 24:
+		ok = codec.RLEDecompress24(o.Data, bmp.data, rowDelta)
+	}
+	if !ok {
+		return nil
+	}
+	return bmp
+}
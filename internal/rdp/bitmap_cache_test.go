@@ -0,0 +1,208 @@
+package rdp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+)
+
+// cachedBitmapOrders caches a 2x2 32 bpp bitmap at cache 0 index 1, draws
+// its top-down second row at (10,20), then draws the empty index 7
+func cachedBitmapOrders() []byte {
+	orders := []byte{
+		0x03, 0x0D, 0x00, // TS_SECONDARY order, orderLength 26 - 13
+		0x30, 0x00, // cacheId 0, 32 bpp
+		0x04,       // TS_CACHE_BITMAP_UNCOMPRESSED_REV2
+		0x02, 0x02, // 2x2
+		0x10, // bitmapLength 16
+		0x01, // cacheIndex 1
+		// bottom-up rows: A B, then C D
+		0xA0, 0xA1, 0xA2, 0xA3, 0xB0, 0xB1, 0xB2, 0xB3,
+		0xC0, 0xC1, 0xC2, 0xC3, 0xD0, 0xD1, 0xD2, 0xD3,
+
+		0x09, 0x0D, 0xFF, 0x01, // MemBlt with all fields
+		0x00, 0x00, // cacheId 0
+		0x0A, 0x00, 0x14, 0x00, 0x02, 0x00, 0x01, 0x00, // 2x1 at 10,20
+		0xCC,                   // SRCCOPY
+		0x00, 0x00, 0x01, 0x00, // source 0,1
+		0x01, 0x00, // cacheIndex 1
+
+		0x01, 0x00, 0x01, 0x07, 0x00, // MemBlt of cacheIndex 7
+	}
+	return append([]byte{0x03, 0x00}, orders...) // numberOrders
+}
+
+// expectedBitmapUpdate is the bitmap update cachedBitmapOrders draws
+var expectedBitmapUpdate = []byte{
+	0x01, 0x1E, 0x00, // TS_FP_UPDATE bitmap, size 30
+	0x01, 0x00, 0x01, 0x00, // UPDATETYPE_BITMAP, one rectangle
+	0x0A, 0x00, 0x14, 0x00, 0x0B, 0x00, 0x14, 0x00, // 10,20 - 11,20
+	0x02, 0x00, 0x01, 0x00, 0x20, 0x00, 0x00, 0x00, 0x08, 0x00,
+	0xA0, 0xA1, 0xA2, 0xA3, 0xB0, 0xB1, 0xB2, 0xB3,
+}
+
+// newCachedDrawingOrders creates a drawing order pipeline with a bitmap cache
+func newCachedDrawingOrders() *drawingOrders {
+	d := newDrawingOrders()
+	d.cache = newBitmapCache(bitmapCacheCellEntries)
+	return d
+}
+
+func TestBitmapCache_ApplyFastPath(t *testing.T) {
+	b := newCachedDrawingOrders()
+
+	payload := cachedBitmapOrders()
+	data := []byte{0x03, 0x00, 0x00} // synchronize update
+	data = append(data, 0x00)        // orders update
+	data = binary.LittleEndian.AppendUint16(data, uint16(len(payload)))
+	data = append(data, payload...)
+
+	updates, err := b.applyFastPath(data)
+	require.NoError(t, err)
+	require.Len(t, updates, 2)
+	assert.Equal(t, []byte{0x03, 0x00, 0x00}, updates[0].Data)
+	assert.Equal(t, expectedBitmapUpdate, updates[1].Data)
+
+	hits, misses, skipped := b.cache.stats()
+	assert.Equal(t, uint64(1), hits)
+	assert.Equal(t, uint64(1), misses)
+	assert.Zero(t, skipped)
+}
+
+func TestBitmapCache_ApplyFastPathFragments(t *testing.T) {
+	b := newCachedDrawingOrders()
+
+	payload := cachedBitmapOrders()
+	var data []byte
+	data = append(data, 0x20) // orders, FASTPATH_FRAGMENT_FIRST
+	data = binary.LittleEndian.AppendUint16(data, 10)
+	data = append(data, payload[:10]...)
+	data = append(data, 0x10) // orders, FASTPATH_FRAGMENT_LAST
+	data = binary.LittleEndian.AppendUint16(data, uint16(len(payload)-10))
+	data = append(data, payload[10:]...)
+
+	updates, err := b.applyFastPath(data)
+	require.NoError(t, err)
+	require.Len(t, updates, 1)
+	assert.Equal(t, expectedBitmapUpdate, updates[0].Data)
+}
+
+func TestBitmapCache_ApplyFastPathWithoutOrders(t *testing.T) {
+	b := newCachedDrawingOrders()
+	data := []byte{0x03, 0x00, 0x00, 0x03, 0x00, 0x00}
+
+	updates, err := b.applyFastPath(data)
+	require.NoError(t, err)
+	require.Len(t, updates, 1)
+	assert.Equal(t, data, updates[0].Data)
+
+	_, err = b.applyFastPath([]byte{0x00, 0x05, 0x00})
+	assert.Error(t, err)
+}
+
+func TestBitmapCache_MemBltClipsToBounds(t *testing.T) {
+	b := newCachedDrawingOrders()
+	payload := cachedBitmapOrders()
+	require.Empty(t, b.decodeOrders(append([]byte{0x01, 0x00}, payload[2:28]...)))
+
+	// Draw the whole bitmap at 10,20, clipped to its right column
+	memBlt := []byte{
+		0x01, 0x00, // one order
+		0x0D, 0x0D, 0xFF, 0x01,
+		0x0F, 0x0B, 0x00, 0x00, 0x00, 0x64, 0x00, 0x64, 0x00, // bounds 11,0 - 100,100
+		0x00, 0x00,
+		0x0A, 0x00, 0x14, 0x00, 0x02, 0x00, 0x02, 0x00,
+		0xCC,
+		0x00, 0x00, 0x00, 0x00,
+		0x01, 0x00,
+	}
+	updates := b.decodeOrders(memBlt)
+	require.Len(t, updates, 1)
+	rect := updates[0].Data[7:]
+	assert.Equal(t, []byte{0x0B, 0x00, 0x14, 0x00, 0x0B, 0x00, 0x15, 0x00, 0x01, 0x00, 0x02, 0x00}, rect[:12])
+	assert.Equal(t, []byte{0xB0, 0xB1, 0xB2, 0xB3, 0xD0, 0xD1, 0xD2, 0xD3}, rect[18:])
+}
+
+func TestBitmapCache_MemBltSkipsOtherRasterOperations(t *testing.T) {
+	b := newCachedDrawingOrders()
+	payload := cachedBitmapOrders()
+	require.Empty(t, b.decodeOrders(append([]byte{0x01, 0x00}, payload[2:28]...)))
+
+	// The SRCCOPY MemBlt of cachedBitmapOrders with SRCINVERT, then SRCAND
+	memBlt := append([]byte{0x01, 0x00}, payload[28:49]...)
+	require.Equal(t, byte(ropSrcCopy), memBlt[16])
+	for _, rop := range []byte{0x66, 0x88} {
+		memBlt[16] = rop
+		assert.Empty(t, b.decodeOrders(memBlt), "raster operation 0x%02X", rop)
+	}
+
+	hits, misses, skipped := b.cache.stats()
+	assert.Equal(t, uint64(2), hits, "the bitmap is cached, only the raster operation is unsupported")
+	assert.Zero(t, misses)
+	assert.Equal(t, uint64(2), skipped)
+}
+
+func TestClient_GetUpdate_QueuesCachedBitmapUpdates(t *testing.T) {
+	client := &Client{}
+	client.EnableBitmapCache()
+
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, binary.LittleEndian, SlowPathUpdateTypeOrders)
+	payload := cachedBitmapOrders()
+	buf.Write([]byte{0x00, 0x00}) // pad2Octets
+	buf.Write(payload[:2])        // numberOrders
+	buf.Write([]byte{0x00, 0x00}) // pad2Octets
+	buf.Write(payload[2:])
+
+	// A large pending rectangle pushes the MemBlt into a second update
+	client.drawingOrders.rects = append(client.drawingOrders.rects, make([]byte, maxBitmapUpdateSize-20))
+	update, err := client.handleSlowPathGraphicsUpdate(buf)
+	require.NoError(t, err)
+	require.NotNil(t, update)
+	assert.Len(t, update.Data, maxBitmapUpdateSize-20+7)
+
+	update, err = client.GetUpdate()
+	require.NoError(t, err)
+	assert.Equal(t, expectedBitmapUpdate, update.Data)
+	assert.Empty(t, client.pendingUpdates)
+}
+
+func TestBitmapCache_ConfirmActiveCapabilities(t *testing.T) {
+	b := newBitmapCache(bitmapCacheCellEntries)
+	req := pdu.NewClientConfirmActive(1, 1001, 1024, 768, false)
+	b.confirmActiveCapabilities(req.CapabilitySets)
+
+	var rev2 *pdu.BitmapCacheCapabilitySetRev2
+	for _, set := range req.CapabilitySets {
+		assert.Nil(t, set.BitmapCacheCapabilitySetRev1)
+		if set.BitmapCacheCapabilitySetRev2 != nil {
+			rev2 = set.BitmapCacheCapabilitySetRev2
+		}
+		if set.OrderCapabilitySet != nil {
+			assert.Equal(t, byte(1), set.OrderCapabilitySet.OrderSupport[pdu.OrderSupportMemBltIndex])
+		}
+	}
+	require.NotNil(t, rev2)
+	assert.Equal(t, uint8(3), rev2.NumCellCaches)
+	assert.Equal(t, uint32(1024), rev2.BitmapCache2CellInfo)
+}
+
+func TestClient_GetServerCapabilities_BitmapCache(t *testing.T) {
+	client := &Client{}
+	assert.Zero(t, client.GetServerCapabilities().BitmapCacheCells)
+
+	client.EnableBitmapCache()
+	client.bitmapCache.hits.Add(5)
+	client.bitmapCache.misses.Add(2)
+	client.bitmapCache.skipped.Add(1)
+	info := client.GetServerCapabilities()
+	assert.Equal(t, 3, info.BitmapCacheCells)
+	assert.Equal(t, uint64(5), info.BitmapCacheHits)
+	assert.Equal(t, uint64(2), info.BitmapCacheMisses)
+	assert.Equal(t, uint64(1), info.BitmapCacheSkipped)
+}
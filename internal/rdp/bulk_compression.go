@@ -0,0 +1,47 @@
+package rdp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/rcarmo/go-rdp/internal/codec/bulk"
+	"github.com/rcarmo/go-rdp/internal/protocol/fastpath"
+)
+
+// decompressor returns the connection's bulk decompressor, creating it on first use
+func (c *Client) decompressor() *bulk.Decompressor {
+	if c.bulkDecompressor == nil {
+		c.bulkDecompressor = bulk.NewDecompressor()
+	}
+	return c.bulkDecompressor
+}
+
+// decompressFastPath expands any compressed updates in a fast-path update PDU
+func (c *Client) decompressFastPath(data []byte) ([]byte, error) {
+	data, err := fastpath.DecompressUpdates(data, c.decompressor().Decompress)
+	if err != nil {
+		return nil, fmt.Errorf("decompress fast-path update: %w", err)
+	}
+	return data, nil
+}
+
+// decompressSlowPath expands the remainder of a slow-path data PDU when its
+// share data header carries compression flags (MS-RDPBCGR 2.2.8.1.1.1.2)
+func (c *Client) decompressSlowPath(wire io.Reader, compressedType uint8) (io.Reader, error) {
+	if compressedType&(bulk.FlagCompressed|bulk.FlagAtFront|bulk.FlagFlushed) == 0 {
+		return wire, nil
+	}
+
+	src, err := io.ReadAll(wire)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := c.decompressor().Decompress(src, compressedType)
+	if err != nil {
+		return nil, fmt.Errorf("decompress slow-path data: %w", err)
+	}
+
+	return bytes.NewReader(data), nil
+}
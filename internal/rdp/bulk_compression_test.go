@@ -0,0 +1,87 @@
+package rdp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/rcarmo/go-rdp/internal/codec/bulk"
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bellsRDP5 is the RDP 5.0 compressed example from MS-RDPBCGR 3.1.8.4.2.2
+var bellsRDP5 = []byte("for.whom.the.bell.tolls,\xfa\x1b\x97\x33\x7e\x87\xe3\x32\x90\x80")
+
+const bells = "for.whom.the.bell.tolls,.the.bell.tolls.for.thee!"
+
+// mppcLiterals encodes data as MPPC literals only
+func mppcLiterals(data []byte) []byte {
+	var (
+		out   []byte
+		nbits int
+	)
+	writeBits := func(v, n int) {
+		for i := n - 1; i >= 0; i-- {
+			if nbits%8 == 0 {
+				out = append(out, 0)
+			}
+			if v>>i&1 == 1 {
+				out[len(out)-1] |= 0x80 >> (nbits % 8)
+			}
+			nbits++
+		}
+	}
+	for _, b := range data {
+		if b < 0x80 {
+			writeBits(int(b), 8)
+		} else {
+			writeBits(0x2, 2)
+			writeBits(int(b&0x7F), 7)
+		}
+	}
+	return out
+}
+
+func TestClient_decompressFastPath(t *testing.T) {
+	flags := bulk.FlagCompressed | bulk.FlagFlushed | bulk.Type64K
+	data := []byte{0x81, flags}
+	data = binary.LittleEndian.AppendUint16(data, uint16(len(bellsRDP5)))
+	data = append(data, bellsRDP5...)
+	data = append(data, 0x03, 0x00, 0x00) // uncompressed synchronize
+
+	client := &Client{}
+	out, err := client.decompressFastPath(data)
+	require.NoError(t, err)
+
+	expected := []byte{0x01}
+	expected = binary.LittleEndian.AppendUint16(expected, uint16(len(bells)))
+	expected = append(expected, bells...)
+	expected = append(expected, 0x03, 0x00, 0x00)
+	assert.Equal(t, expected, out)
+
+	_, err = client.decompressFastPath([]byte{0x81, bulk.FlagCompressed | bulk.TypeRDP6, 0x01, 0x00, 0x00})
+	assert.ErrorIs(t, err, bulk.ErrUnsupportedType)
+}
+
+func TestGetX224Update_CompressedMonitorLayout(t *testing.T) {
+	body := mppcLiterals(buildMonitorLayoutBody(dualMonitorLayout))
+	wire := buildServerDataPDU(pdu.Type2MonitorLayout, body)
+	wire[15] = bulk.FlagCompressed | bulk.FlagFlushed | bulk.Type64K // compressedType
+
+	client := &Client{
+		channelIDMap: map[string]uint16{"global": 1003},
+		mcsLayer: &MockMCSLayer{
+			ReceiveFunc: func() (uint16, io.Reader, error) {
+				return 1003, bytes.NewReader(wire), nil
+			},
+		},
+	}
+
+	update, err := client.getX224Update()
+	require.NoError(t, err)
+	assert.Nil(t, update)
+	assert.Equal(t, dualMonitorLayout, client.GetMonitorLayout())
+}
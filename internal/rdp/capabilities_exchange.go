@@ -1,17 +1,27 @@
 package rdp
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+
 	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
 )
 
 func (c *Client) capabilitiesExchange() error {
-	_, wire, err := c.mcsLayer.Receive()
+	data, header, err := c.receiveDemandActive()
 	if err != nil {
 		return err
 	}
 
+	// A connection broker answers with a Server Redirection PDU instead
+	if header.PDUType.IsServerRedirect() {
+		return c.handleServerRedirection(data)
+	}
+
 	var resp pdu.ServerDemandActive
-	if err = resp.Deserialize(wire); err != nil {
+	if err = resp.Deserialize(bytes.NewReader(data)); err != nil {
 		return err
 	}
 
@@ -20,8 +30,21 @@ func (c *Client) capabilitiesExchange() error {
 
 	req := pdu.NewClientConfirmActive(resp.ShareID, c.userID, c.desktopWidth, c.desktopHeight, c.remoteApp != nil)
 
-	if c.enableRFX {
-		// Set MultifragmentUpdate MaxRequestSize large enough for RFX tiles
+	if c.drawingOrders != nil {
+		c.drawingOrders.confirmActiveCapabilities(req.CapabilitySets, serverColorDepth(resp.CapabilitySets))
+	}
+	c.frameAcknowledgeCapabilities(req.CapabilitySets)
+	c.clientIdentityCapabilities(req.CapabilitySets)
+
+	// Without audio there is nothing to play beeps on either
+	if c.audioDisabled {
+		req.CapabilitySets = slices.DeleteFunc(req.CapabilitySets, func(cap pdu.CapabilitySet) bool {
+			return cap.CapabilitySetType == pdu.CapabilitySetTypeSound
+		})
+	}
+
+	if codecs := c.bitmapCodecsCapabilitySet(); codecs != nil {
+		// Set MultifragmentUpdate MaxRequestSize large enough for codec tiles
 		for i, cap := range req.CapabilitySets {
 			if cap.MultifragmentUpdateCapabilitySet != nil {
 				req.CapabilitySets[i].MultifragmentUpdateCapabilitySet.MaxRequestSize = 0x200000 // 2MB
@@ -30,9 +53,80 @@ func (c *Client) capabilitiesExchange() error {
 		}
 		req.CapabilitySets = append(req.CapabilitySets,
 			pdu.NewSurfaceCommandsCapabilitySet(),
-			pdu.NewBitmapCodecsWithRFXCapabilitySet(),
+			*codecs,
 		)
+
+		c.advertisedCodecs = nil
+		for _, codec := range codecs.BitmapCodecsCapabilitySet.BitmapCodecArray {
+			c.advertisedCodecs = append(c.advertisedCodecs, codecGUIDToName(codec.CodecGUID))
+		}
 	}
 
 	return c.mcsLayer.Send(c.userID, c.channelIDMap["global"], req.Serialize())
 }
+
+// receiveDemandActive returns the first PDU of the capabilities exchange,
+// handling any Server Status Info PDUs the server sends while it prepares
+// the session.
+func (c *Client) receiveDemandActive() ([]byte, pdu.ShareControlHeader, error) {
+	for {
+		var header pdu.ShareControlHeader
+
+		_, wire, err := c.mcsLayer.Receive()
+		if err != nil {
+			return nil, header, err
+		}
+
+		data, err := io.ReadAll(wire)
+		if err != nil {
+			return nil, header, err
+		}
+
+		if err = header.Deserialize(bytes.NewReader(data)); err != nil {
+			return nil, header, err
+		}
+		if !header.PDUType.IsData() {
+			return data, header, nil
+		}
+
+		var dataPDU pdu.Data
+		if err = dataPDU.Deserialize(bytes.NewReader(data)); err != nil {
+			return nil, header, err
+		}
+		if !dataPDU.ShareDataHeader.PDUType2.IsStatusInfo() {
+			return nil, header, fmt.Errorf("unexpected data pdu before demand active: %d", dataPDU.ShareDataHeader.PDUType2)
+		}
+		c.handleStatusInfo(dataPDU.StatusInfoPDUData)
+	}
+}
+
+// bitmapCodecsCapabilitySet returns the Bitmap Codecs capability set to
+// advertise, or nil when no codecs are advertised.
+func (c *Client) bitmapCodecsCapabilitySet() *pdu.CapabilitySet {
+	var codecs pdu.CapabilitySet
+	switch c.forcedCodec {
+	case ForcedCodecNSCodec:
+		codecs = pdu.NewBitmapCodecsCapabilitySet()
+	case ForcedCodecRFX:
+		codecs = pdu.NewBitmapCodecsRFXOnlyCapabilitySet(c.rfxMode)
+	case ForcedCodecNone:
+		return nil
+	default:
+		if !c.enableRFX {
+			return nil
+		}
+		codecs = pdu.NewBitmapCodecsWithRFXModeCapabilitySet(c.rfxMode)
+	}
+	return &codecs
+}
+
+// serverColorDepth returns the preferred color depth of the server's Bitmap
+// capability set, or 0 when there is none.
+func serverColorDepth(sets []pdu.CapabilitySet) int {
+	for _, set := range sets {
+		if set.BitmapCapabilitySet != nil {
+			return int(set.BitmapCapabilitySet.PreferredBitsPerPixel)
+		}
+	}
+	return 0
+}
@@ -5,12 +5,14 @@ package rdp
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/rcarmo/go-rdp/internal/codec/bulk"
 	"github.com/rcarmo/go-rdp/internal/protocol/fastpath"
 	"github.com/rcarmo/go-rdp/internal/protocol/mcs"
 	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
@@ -32,6 +34,8 @@ type Client struct {
 	mu sync.RWMutex
 
 	conn       net.Conn
+	transport  string     // TransportTCP or TransportGateway
+	writeMu    sync.Mutex // serializes PDUs written by concurrent senders
 	buffReader *bufio.Reader
 	tpktLayer  *tpkt.Protocol
 	x224Layer  *x224.Protocol
@@ -46,12 +50,14 @@ type Client struct {
 	colorDepth                  int
 
 	serverCapabilitySets []pdu.CapabilitySet
+	serverCoreData       *pdu.ServerCoreData
 	remoteApp            *RemoteApp
 	railState            RailState
 
 	selectedProtocol       pdu.NegotiationProtocol
 	serverNegotiationFlags pdu.NegotiationResponseFlag
 	channels               []string
+	maxChannels            int
 	channelIDMap           map[string]uint16
 	skipChannelJoin        bool
 	shareID                uint32
@@ -60,12 +66,27 @@ type Client struct {
 	// TLS configuration
 	skipTLSValidation bool
 	tlsServerName     string
+	tlsConfigSet      bool // SetTLSConfig was called; don't fall back to global config
+	clientCertificate *tls.Certificate
 
 	// NLA configuration
-	useNLA bool
+	useNLA       bool
+	nlaMechanism NLAMechanism
+	kerberos     KerberosSettings
 
 	// Audio handler
 	audioHandler *AudioHandler
+	// audioDisabled keeps audio output from being negotiated at all
+	audioDisabled bool
+
+	// Audio input (microphone) handler
+	audioInputHandler *AudioInputHandler
+
+	// Clipboard handler
+	clipboardHandler *ClipboardHandler
+
+	// Device redirection (rdpdr) handshake handler
+	deviceRedirection *DeviceRedirectionHandler
 
 	// Display control handler for dynamic resize
 	displayControl *DisplayControlHandler
@@ -75,9 +96,82 @@ type Client struct {
 
 	// RemoteFX-Image support
 	enableRFX bool
+	rfxMode   pdu.RFXCodecMode
+
+	// Frames ended by frame markers, awaiting acknowledgement, and the
+	// window advertised in the Frame Acknowledge capability set
+	frames                  frameTracker
+	maxUnacknowledgedFrames uint32
+
+	// Bitmap codec override and the codecs advertised in Confirm Active
+	forcedCodec      ForcedCodec
+	advertisedCodecs []string
+
+	// Monitor layout sent by the server (MS-RDPBCGR 2.2.12.1)
+	monitorLayout         []pdu.MonitorDef
+	monitorData           *pdu.ClientMonitorData
+	monitorLayoutCallback MonitorLayoutCallback
+	primaryMonitorOnly    bool
+
+	// Auto-reconnect cookie (MS-RDPBCGR 2.2.4.2), presented at logon when set
+	// and replaced when the server sends a new one
+	autoReconnectCookie     *pdu.ARCSCPrivatePacket
+	reconnectCookieCallback ReconnectCookieCallback
+
+	// Logon session reported in extended logon info, and whether the server
+	// offered automatic reconnection to it
+	logonSession *LogonSession
+
+	// Last logon error notification (MS-RDPBCGR 2.2.10.1.1.4.1.1)
+	logonError         *pdu.LogonErrorsInfo
+	logonErrorCallback LogonErrorCallback
+
+	// Last connection progress status (MS-RDPBCGR 2.2.5.2)
+	statusInfo         *pdu.StatusInfoPDUData
+	statusInfoCallback StatusInfoCallback
+
+	// Connection sequence progress and the limit on its duration
+	stageCallback    StageCallback
+	handshakeTimeout time.Duration
+
+	// Connection phases reached, timed from when the client was dialed
+	connectEventCallback ConnectEventCallback
+	dialedAt             time.Time
+	lastPhase            ConnectPhase
+
+	// Client build, product ID and OS advertised in place of the defaults
+	identity ClientIdentity
+
+	// Server heartbeats received on the message channel (MS-RDPBCGR 2.2.16.1)
+	heartbeat         heartbeatMonitor
+	heartbeatCallback HeartbeatCallback
+
+	// How long GetUpdateContext waits for any data from the server, and the
+	// timer enforcing it during a call
+	readIdleTimeout time.Duration
+	readIdle        *readIdleTimer
+
+	// Server redirection received during the connection sequence, and the
+	// one this client follows (MS-RDPBCGR 2.2.13)
+	redirection    *RedirectionInfo
+	redirectedFrom *RedirectionInfo
+
+	// Bulk decompression history shared by fast-path and slow-path output
+	bulkDecompressor *bulk.Decompressor
+
+	// In-memory revision 2 bitmap cache, when enabled
+	bitmapCache *bitmapCache
+
+	// Drawing order decoding, when the bitmap cache or drawing orders are
+	// enabled
+	drawingOrders *drawingOrders
 
 	// Pending slow-path update (per-client, not global)
 	pendingSlowPathUpdate *Update
+
+	// Updates produced alongside the last one returned by GetUpdate, such
+	// as the updates drawn by the orders of one orders update
+	pendingUpdates []*Update
 }
 
 const (
@@ -109,10 +203,12 @@ func NewClient(
 		// Default TLS configuration - can be overridden with SetTLSConfig
 		skipTLSValidation: false,
 		tlsServerName:     "",
+		rfxMode:           pdu.RFXCodecModeImage,
 	}
 
 	var err error
 
+	c.dialedAt = time.Now()
 	dialer := net.Dialer{Timeout: tcpConnectionTimeout}
 	c.conn, err = dialer.DialContext(context.Background(), "tcp", hostname)
 	if err != nil {
@@ -153,8 +249,10 @@ func NewClientWithDialContext(
 		selectedProtocol:  pdu.NegotiationProtocolSSL,
 		skipTLSValidation: false,
 		tlsServerName:     "",
+		rfxMode:           pdu.RFXCodecModeImage,
 	}
 	var err error
+	c.dialedAt = time.Now()
 	c.conn, err = dialContext(ctx, "tcp", hostname)
 	if err != nil {
 		return nil, fmt.Errorf("tcp connect: %w", err)
@@ -167,10 +265,18 @@ func NewClientWithDialContext(
 	return c, nil
 }
 
-// SetTLSConfig allows setting TLS configuration for the RDP client
+// SetTLSConfig allows setting TLS configuration for the RDP client.
+// Once set, these values take precedence over the global configuration.
 func (c *Client) SetTLSConfig(skipValidation bool, serverName string) {
 	c.skipTLSValidation = skipValidation
 	c.tlsServerName = serverName
+	c.tlsConfigSet = true
+}
+
+// SetClientCertificate sets the certificate presented to RDP servers that
+// request mutual TLS authentication.
+func (c *Client) SetClientCertificate(cert *tls.Certificate) {
+	c.clientCertificate = cert
 }
 
 // SetUseNLA enables or disables Network Level Authentication
@@ -188,6 +294,33 @@ func (c *Client) SetEnableRFX(enable bool) {
 	c.enableRFX = enable
 }
 
+// SetRFXMode sets the RemoteFX mode (image or video) advertised when RFX is enabled
+func (c *Client) SetRFXMode(mode pdu.RFXCodecMode) {
+	c.rfxMode = mode
+}
+
+// ForcedCodec constrains the bitmap codecs advertised to the server.
+type ForcedCodec uint8
+
+// Forced codec choices.
+const (
+	// ForcedCodecAuto advertises codecs according to SetEnableRFX.
+	ForcedCodecAuto ForcedCodec = iota
+	// ForcedCodecNSCodec advertises NSCodec alone.
+	ForcedCodecNSCodec
+	// ForcedCodecRFX advertises RemoteFX alone, in the SetRFXMode mode.
+	ForcedCodecRFX
+	// ForcedCodecNone advertises no codecs, so the server falls back to
+	// uncompressed or RLE bitmap updates.
+	ForcedCodecNone
+)
+
+// SetForcedCodec overrides which bitmap codecs are advertised, regardless of
+// SetEnableRFX.
+func (c *Client) SetForcedCodec(codec ForcedCodec) {
+	c.forcedCodec = codec
+}
+
 // Known codec GUIDs (stored in wire format per MS-RDPBCGR)
 // GUID Data1 is 32-bit LE, Data2 is 16-bit LE, Data3 is 16-bit LE, Data4 is 8 bytes BE
 var (
@@ -239,6 +372,7 @@ func codecGUIDToName(guid [16]byte) string {
 // ServerCapabilityInfo contains a summary of server capabilities for logging
 type ServerCapabilityInfo struct {
 	BitmapCodecs      []string
+	AdvertisedCodecs  []string // codecs the client advertised in Confirm Active
 	SurfaceCommands   bool
 	ColorDepth        int
 	DesktopSize       string
@@ -247,10 +381,20 @@ type ServerCapabilityInfo struct {
 	MultifragmentSize uint32
 	LargePointer      bool
 	FrameAcknowledge  bool
+	// RDP version and requested protocols from the server core data
+	ServerRDPVersion         string
+	ServerRequestedProtocols uint32
+	// Bitmap cache cells and MemBlt cache hits/misses, when the cache is enabled
+	BitmapCacheCells  int
+	BitmapCacheHits   uint64
+	BitmapCacheMisses uint64
+	// MemBlt orders not drawn because their raster operation is not SRCCOPY
+	BitmapCacheSkipped uint64
 	// Connection info
-	UseNLA       bool
-	AudioEnabled bool
-	Channels     []string
+	UseNLA           bool
+	AudioEnabled     bool
+	ClipboardEnabled bool
+	Channels         []string
 }
 
 // Update represents an RDP screen update that can be sent to a client.
@@ -262,10 +406,22 @@ type Update struct {
 // GetServerCapabilities returns a summary of the server's capabilities
 func (c *Client) GetServerCapabilities() *ServerCapabilityInfo {
 	info := &ServerCapabilityInfo{
-		BitmapCodecs: []string{},
-		UseNLA:       c.useNLA,
-		AudioEnabled: c.audioHandler != nil,
-		Channels:     c.channels,
+		BitmapCodecs:     []string{},
+		AdvertisedCodecs: c.advertisedCodecs,
+		UseNLA:           c.useNLA,
+		AudioEnabled:     c.audioHandler != nil,
+		ClipboardEnabled: c.clipboardHandler != nil,
+		Channels:         c.channels,
+	}
+
+	if c.serverCoreData != nil {
+		info.ServerRDPVersion = c.serverCoreData.VersionName()
+		info.ServerRequestedProtocols = c.serverCoreData.ClientRequestedProtocols
+	}
+
+	if c.bitmapCache != nil {
+		info.BitmapCacheCells = len(c.bitmapCache.cells)
+		info.BitmapCacheHits, info.BitmapCacheMisses, info.BitmapCacheSkipped = c.bitmapCache.stats()
 	}
 
 	for _, capSet := range c.serverCapabilitySets {
@@ -338,7 +494,7 @@ func (c *Client) RequestResize(width, height int) error {
 }
 
 // GetDisplayControlCapabilities returns the server's display control capabilities
-func (c *Client) GetDisplayControlCapabilities() (maxMonitors uint32, maxArea uint32) {
+func (c *Client) GetDisplayControlCapabilities() (maxMonitors uint32, maxArea uint64) {
 	if c.displayControl == nil {
 		return 0, 0
 	}
@@ -346,7 +502,10 @@ func (c *Client) GetDisplayControlCapabilities() (maxMonitors uint32, maxArea ui
 	if caps == nil {
 		return 0, 0
 	}
-	return caps.MaxNumMonitors, caps.MaxMonitorAreaSize
+	if c.primaryMonitorOnly && caps.MaxNumMonitors > 1 {
+		return 1, caps.MaxMonitorArea()
+	}
+	return caps.MaxNumMonitors, caps.MaxMonitorArea()
 }
 
 // EnableMultitransport enables UDP transport negotiation.
@@ -1,11 +1,14 @@
 package rdp
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"testing"
 
 	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCodecGUIDToName(t *testing.T) {
@@ -126,6 +129,42 @@ func TestClient_SetEnableRFX(t *testing.T) {
 	assert.False(t, client.enableRFX)
 }
 
+func TestClient_SetRFXMode(t *testing.T) {
+	client := &Client{}
+
+	client.SetRFXMode(pdu.RFXCodecModeVideo)
+	assert.Equal(t, pdu.RFXCodecModeVideo, client.rfxMode)
+
+	client.SetRFXMode(pdu.RFXCodecModeImage)
+	assert.Equal(t, pdu.RFXCodecModeImage, client.rfxMode)
+}
+
+// TestClient_DefaultRFXCapabilities validates that both constructors
+// advertise RemoteFX as before RDP_RFX_MODE existed: image mode, alongside
+// NSCodec
+func TestClient_DefaultRFXCapabilities(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	client, err := NewClient(listener.Addr().String(), "user", "pass", 1024, 768, 32)
+	require.NoError(t, err)
+	defer client.conn.Close()
+
+	dialed, err := NewClientWithDialContext(context.Background(), (&net.Dialer{}).DialContext,
+		listener.Addr().String(), "user", "pass", 1024, 768, 32)
+	require.NoError(t, err)
+	defer dialed.conn.Close()
+
+	want := pdu.NewBitmapCodecsWithRFXCapabilitySet()
+	for name, c := range map[string]*Client{"NewClient": client, "NewClientWithDialContext": dialed} {
+		c.SetEnableRFX(true)
+		got := c.bitmapCodecsCapabilitySet()
+		require.NotNil(t, got, name)
+		assert.Equal(t, want, *got, name)
+	}
+}
+
 func TestClient_GetServerCapabilities_Empty(t *testing.T) {
 	client := &Client{
 		serverCapabilitySets: []pdu.CapabilitySet{},
@@ -0,0 +1,63 @@
+package rdp
+
+import (
+	"fmt"
+	"unicode/utf16"
+
+	"github.com/rcarmo/go-rdp/internal/codec"
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+)
+
+// maxClientProductIDLength is the longest product ID that fits, with its
+// null terminator, in the 64-byte clientDigProductId field.
+const maxClientProductIDLength = 31
+
+// ClientIdentity is the client software advertised to the server, for
+// servers and brokers whose policies only admit particular RDP clients.
+// Zero fields keep the defaults.
+type ClientIdentity struct {
+	// Build is the clientBuild of the Client Core Data (MS-RDPBCGR 2.2.1.3.2)
+	Build uint32
+	// ProductID is the clientDigProductId of the Client Core Data
+	ProductID string
+	// OSMajorType and OSMinorType are the platform in the General
+	// Capability Set (MS-RDPBCGR 2.2.7.1.1). OSMinorType is only sent
+	// with an OSMajorType.
+	OSMajorType uint16
+	OSMinorType uint16
+}
+
+// SetClientIdentity makes the client present itself as another RDP client
+// in the Client Core Data and the Confirm Active PDU.
+func (c *Client) SetClientIdentity(identity ClientIdentity) error {
+	if n := len(utf16.Encode([]rune(identity.ProductID))); n > maxClientProductIDLength {
+		return fmt.Errorf("client product ID too long: %d characters (max %d)", n, maxClientProductIDLength)
+	}
+	c.identity = identity
+	return nil
+}
+
+// applyClientIdentity overrides the build and product ID in the core data.
+func (c *Client) applyClientIdentity(core *pdu.ClientCoreData) {
+	if c.identity.Build != 0 {
+		core.ClientBuild = c.identity.Build
+	}
+	if c.identity.ProductID != "" {
+		core.ClientDigProductId = [64]byte{}
+		copy(core.ClientDigProductId[:], codec.Encode(c.identity.ProductID))
+	}
+}
+
+// clientIdentityCapabilities overrides the platform in the General
+// Capability Set.
+func (c *Client) clientIdentityCapabilities(sets []pdu.CapabilitySet) {
+	if c.identity.OSMajorType == pdu.OSMajorTypeUnspecified {
+		return
+	}
+	for _, set := range sets {
+		if general := set.GeneralCapabilitySet; general != nil {
+			general.OSMajorType = c.identity.OSMajorType
+			general.OSMinorType = c.identity.OSMinorType
+		}
+	}
+}
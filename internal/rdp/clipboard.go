@@ -0,0 +1,288 @@
+package rdp
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/rcarmo/go-rdp/internal/logging"
+	"github.com/rcarmo/go-rdp/internal/protocol/audio"
+	"github.com/rcarmo/go-rdp/internal/protocol/cliprdr"
+)
+
+// MaxClipboardTextSize caps the UTF-16 payload exchanged in either direction,
+// so a large copy on one side cannot flood the other.
+const MaxClipboardTextSize = 1 << 20
+
+// clipboardChunkSize is the virtual channel chunk size (CHANNEL_CHUNK_LENGTH)
+// used when sending clipboard PDUs to the server.
+const clipboardChunkSize = 1600
+
+// ErrClipboardNotEnabled is returned when clipboard text is set before
+// EnableClipboard was called.
+var ErrClipboardNotEnabled = errors.New("clipboard redirection not enabled")
+
+// ClipboardCallback is called with text copied on the remote desktop
+type ClipboardCallback func(text string)
+
+// ClipboardHandler manages the CLIPRDR channel for text clipboard sync
+type ClipboardHandler struct {
+	client       *Client
+	callback     ClipboardCallback
+	defragmenter audio.ChannelDefragmenter
+
+	mu              sync.Mutex
+	ready           bool   // monitor-ready handshake completed
+	longFormatNames bool   // both sides support CB_USE_LONG_FORMAT_NAMES
+	localText       string // text offered to the server for paste
+	hasLocalText    bool
+}
+
+// NewClipboardHandler creates a new clipboard handler
+func NewClipboardHandler(client *Client) *ClipboardHandler {
+	return &ClipboardHandler{client: client}
+}
+
+// SetCallback sets the function to call when the remote clipboard changes
+func (h *ClipboardHandler) SetCallback(cb ClipboardCallback) {
+	h.callback = cb
+}
+
+// IsReady returns whether the server has completed the clipboard handshake
+func (h *ClipboardHandler) IsReady() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.ready
+}
+
+// HandleChannelData processes CLIPRDR channel data
+func (h *ClipboardHandler) HandleChannelData(data []byte) error {
+	chunk, err := audio.ParseChannelData(data)
+	if err != nil {
+		return err
+	}
+
+	completeData, complete := h.defragmenter.Process(chunk)
+	if !complete {
+		return nil
+	}
+
+	header, body, err := cliprdr.ParsePDU(completeData)
+	if err != nil {
+		return err
+	}
+
+	switch header.MsgType {
+	case cliprdr.MsgTypeClipCaps:
+		return h.handleCapabilities(body)
+	case cliprdr.MsgTypeMonitorReady:
+		return h.handleMonitorReady()
+	case cliprdr.MsgTypeFormatList:
+		return h.handleFormatList(header.MsgFlags, body)
+	case cliprdr.MsgTypeFormatListResponse:
+		if header.MsgFlags&cliprdr.FlagResponseFail != 0 {
+			logging.Debug("Clipboard: Server rejected format list")
+		}
+		return nil
+	case cliprdr.MsgTypeFormatDataRequest:
+		return h.handleFormatDataRequest(body)
+	case cliprdr.MsgTypeFormatDataResponse:
+		return h.handleFormatDataResponse(header.MsgFlags, body)
+	default:
+		logging.Debug("Clipboard: Ignoring CLIPRDR message type: 0x%04X", header.MsgType)
+	}
+
+	return nil
+}
+
+// handleCapabilities processes CB_CLIP_CAPS from the server
+func (h *ClipboardHandler) handleCapabilities(body []byte) error {
+	caps, err := cliprdr.ParseCapabilities(body)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	h.longFormatNames = caps.GeneralFlags&cliprdr.GeneralFlagUseLongFormatNames != 0
+	h.mu.Unlock()
+
+	logging.Debug("Clipboard: Server caps version=%d flags=0x%08X", caps.Version, caps.GeneralFlags)
+	return nil
+}
+
+// handleMonitorReady answers CB_MONITOR_READY with the client capabilities
+// and an initial format list, completing the handshake.
+func (h *ClipboardHandler) handleMonitorReady() error {
+	caps := cliprdr.GeneralCapability{
+		Version:      cliprdr.CapsVersion2,
+		GeneralFlags: cliprdr.GeneralFlagUseLongFormatNames,
+	}
+	if err := h.send(cliprdr.MsgTypeClipCaps, 0, caps.SerializeCapabilities()); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	h.ready = true
+	h.mu.Unlock()
+
+	logging.Info("Clipboard: Channel ready")
+	return h.sendFormatList()
+}
+
+// handleFormatList processes CB_FORMAT_LIST: the remote clipboard changed, so
+// acknowledge it and fetch the text if any is available.
+func (h *ClipboardHandler) handleFormatList(msgFlags uint16, body []byte) error {
+	h.mu.Lock()
+	longNames := h.longFormatNames
+	// The server now owns the clipboard; our offer is stale
+	h.hasLocalText = false
+	h.localText = ""
+	h.mu.Unlock()
+
+	formats, err := cliprdr.ParseFormatList(body, msgFlags, longNames)
+	if err != nil {
+		_ = h.send(cliprdr.MsgTypeFormatListResponse, cliprdr.FlagResponseFail, nil)
+		return err
+	}
+	if err := h.send(cliprdr.MsgTypeFormatListResponse, cliprdr.FlagResponseOK, nil); err != nil {
+		return err
+	}
+
+	if !cliprdr.HasFormat(formats, cliprdr.FormatUnicodeText) {
+		logging.Debug("Clipboard: Remote clipboard has no text (%d formats)", len(formats))
+		return nil
+	}
+	return h.send(cliprdr.MsgTypeFormatDataRequest, 0, cliprdr.SerializeFormatDataRequest(cliprdr.FormatUnicodeText))
+}
+
+// handleFormatDataRequest answers the server's request for the text we offered
+func (h *ClipboardHandler) handleFormatDataRequest(body []byte) error {
+	formatID, err := cliprdr.ParseFormatDataRequest(body)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	text, ok := h.localText, h.hasLocalText
+	h.mu.Unlock()
+
+	if formatID != cliprdr.FormatUnicodeText || !ok {
+		logging.Debug("Clipboard: No data for requested format %d", formatID)
+		return h.send(cliprdr.MsgTypeFormatDataResponse, cliprdr.FlagResponseFail, nil)
+	}
+	return h.send(cliprdr.MsgTypeFormatDataResponse, cliprdr.FlagResponseOK, cliprdr.EncodeText(text))
+}
+
+// handleFormatDataResponse delivers remote clipboard text to the callback
+func (h *ClipboardHandler) handleFormatDataResponse(msgFlags uint16, body []byte) error {
+	if msgFlags&cliprdr.FlagResponseOK == 0 {
+		logging.Debug("Clipboard: Server failed to provide clipboard data")
+		return nil
+	}
+	if len(body) > MaxClipboardTextSize {
+		logging.Warn("Clipboard: Dropping %d bytes of remote clipboard text (limit %d)", len(body), MaxClipboardTextSize)
+		return nil
+	}
+
+	text := cliprdr.DecodeText(body)
+	logging.Debug("Clipboard: Received %d characters from server", len(text))
+	if h.callback != nil {
+		h.callback(text)
+	}
+	return nil
+}
+
+// SetLocalText offers text to the server as the new clipboard contents, so
+// it can be pasted in the remote session. The text itself is sent when the
+// server asks for it.
+func (h *ClipboardHandler) SetLocalText(text string) error {
+	if n := len(cliprdr.EncodeText(text)); n > MaxClipboardTextSize {
+		return fmt.Errorf("clipboard text too large: %d bytes (limit %d)", n, MaxClipboardTextSize)
+	}
+
+	h.mu.Lock()
+	h.localText = text
+	h.hasLocalText = true
+	ready := h.ready
+	h.mu.Unlock()
+
+	if !ready {
+		// Offered once the server sends CB_MONITOR_READY
+		return nil
+	}
+	return h.sendFormatList()
+}
+
+// sendFormatList advertises CF_UNICODETEXT if local text is pending, or an
+// empty list otherwise.
+func (h *ClipboardHandler) sendFormatList() error {
+	h.mu.Lock()
+	var formats []cliprdr.Format
+	if h.hasLocalText {
+		formats = append(formats, cliprdr.Format{ID: cliprdr.FormatUnicodeText})
+	}
+	longNames := h.longFormatNames
+	h.mu.Unlock()
+
+	return h.send(cliprdr.MsgTypeFormatList, 0, cliprdr.SerializeFormatList(formats, longNames))
+}
+
+// send wraps a CLIPRDR PDU in virtual channel chunks and sends it
+func (h *ClipboardHandler) send(msgType, msgFlags uint16, body []byte) error {
+	channelID, ok := h.client.channelIDMap[cliprdr.ChannelName]
+	if !ok {
+		logging.Warn("Clipboard: cliprdr channel not found")
+		return nil
+	}
+
+	for _, chunk := range buildChannelChunks(cliprdr.BuildPDU(msgType, msgFlags, body), clipboardChunkSize) {
+		if err := h.client.mcsLayer.Send(h.client.userID, channelID, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildChannelChunks splits a virtual channel PDU into chunks of at most
+// chunkSize bytes, each prefixed with a CHANNEL_PDU_HEADER.
+func buildChannelChunks(data []byte, chunkSize int) [][]byte {
+	var chunks [][]byte
+	for off := 0; ; off += chunkSize {
+		end := min(off+chunkSize, len(data))
+		header := audio.ChannelPDUHeader{Length: uint32(len(data))} // #nosec G115
+		if off == 0 {
+			header.Flags |= audio.ChannelFlagFirst
+		}
+		if end == len(data) {
+			header.Flags |= audio.ChannelFlagLast
+		}
+		chunks = append(chunks, append(header.Serialize(), data[off:end]...))
+		if end == len(data) {
+			return chunks
+		}
+	}
+}
+
+// EnableClipboard registers the cliprdr channel for clipboard redirection
+func (c *Client) EnableClipboard() {
+	for _, ch := range c.channels {
+		if ch == cliprdr.ChannelName {
+			return
+		}
+	}
+	c.channels = append(c.channels, cliprdr.ChannelName)
+	c.clipboardHandler = NewClipboardHandler(c)
+}
+
+// GetClipboardHandler returns the clipboard handler
+func (c *Client) GetClipboardHandler() *ClipboardHandler {
+	return c.clipboardHandler
+}
+
+// SetClipboardText offers browser clipboard text to the remote session
+func (c *Client) SetClipboardText(text string) error {
+	if c.clipboardHandler == nil {
+		return ErrClipboardNotEnabled
+	}
+	return c.clipboardHandler.SetLocalText(text)
+}
@@ -0,0 +1,182 @@
+package rdp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcarmo/go-rdp/internal/protocol/audio"
+	"github.com/rcarmo/go-rdp/internal/protocol/cliprdr"
+)
+
+// newClipboardTestClient returns a client with the cliprdr channel joined
+// and a mock MCS layer recording what is sent.
+func newClipboardTestClient() (*Client, *MockMCSLayer) {
+	mockMCS := &MockMCSLayer{}
+	client := &Client{
+		userID:       1001,
+		channelIDMap: map[string]uint16{cliprdr.ChannelName: 1008},
+		mcsLayer:     mockMCS,
+	}
+	client.EnableClipboard()
+	return client, mockMCS
+}
+
+// serverClipPDU frames a CLIPRDR PDU as a single virtual channel chunk.
+func serverClipPDU(msgType, msgFlags uint16, body []byte) []byte {
+	return audio.BuildChannelData(cliprdr.BuildPDU(msgType, msgFlags, body))
+}
+
+// sentClipPDUs reassembles and decodes the CLIPRDR PDUs sent by the client.
+func sentClipPDUs(t *testing.T, m *MockMCSLayer) []cliprdr.Header {
+	t.Helper()
+	var (
+		headers []cliprdr.Header
+		defrag  audio.ChannelDefragmenter
+	)
+	for _, call := range m.SendCalls {
+		require.Equal(t, uint16(1008), call.ChannelID)
+		chunk, err := audio.ParseChannelData(call.Data)
+		require.NoError(t, err)
+		data, complete := defrag.Process(chunk)
+		if !complete {
+			continue
+		}
+		header, _, err := cliprdr.ParsePDU(data)
+		require.NoError(t, err)
+		headers = append(headers, header)
+	}
+	return headers
+}
+
+func TestEnableClipboard(t *testing.T) {
+	client := &Client{}
+	client.EnableClipboard()
+	client.EnableClipboard()
+
+	assert.Equal(t, []string{cliprdr.ChannelName}, client.channels)
+	require.NotNil(t, client.GetClipboardHandler())
+	assert.True(t, client.GetServerCapabilities().ClipboardEnabled)
+
+	assert.ErrorIs(t, (&Client{}).SetClipboardText("x"), ErrClipboardNotEnabled)
+}
+
+func TestClipboardHandler_Handshake(t *testing.T) {
+	client, mockMCS := newClipboardTestClient()
+	h := client.GetClipboardHandler()
+
+	serverCaps := cliprdr.GeneralCapability{Version: cliprdr.CapsVersion2, GeneralFlags: cliprdr.GeneralFlagUseLongFormatNames}
+	require.NoError(t, h.HandleChannelData(serverClipPDU(cliprdr.MsgTypeClipCaps, 0, serverCaps.SerializeCapabilities())))
+	assert.False(t, h.IsReady())
+	assert.Empty(t, mockMCS.SendCalls)
+
+	require.NoError(t, h.HandleChannelData(serverClipPDU(cliprdr.MsgTypeMonitorReady, 0, nil)))
+	assert.True(t, h.IsReady())
+	assert.True(t, h.longFormatNames)
+
+	headers := sentClipPDUs(t, mockMCS)
+	require.Len(t, headers, 2)
+	assert.Equal(t, cliprdr.MsgTypeClipCaps, headers[0].MsgType)
+	assert.Equal(t, cliprdr.MsgTypeFormatList, headers[1].MsgType)
+	assert.Zero(t, headers[1].DataLen, "nothing to offer yet")
+}
+
+func TestClipboardHandler_RemoteCopy(t *testing.T) {
+	client, mockMCS := newClipboardTestClient()
+	h := client.GetClipboardHandler()
+
+	var received string
+	h.SetCallback(func(text string) { received = text })
+
+	// No CB_CLIP_CAPS from the server: short format names
+	formats := cliprdr.SerializeFormatList([]cliprdr.Format{{ID: cliprdr.FormatText}, {ID: cliprdr.FormatUnicodeText}}, false)
+	require.NoError(t, h.HandleChannelData(serverClipPDU(cliprdr.MsgTypeFormatList, 0, formats)))
+
+	headers := sentClipPDUs(t, mockMCS)
+	require.Len(t, headers, 2)
+	assert.Equal(t, cliprdr.Header{MsgType: cliprdr.MsgTypeFormatListResponse, MsgFlags: cliprdr.FlagResponseOK}, headers[0])
+	assert.Equal(t, cliprdr.MsgTypeFormatDataRequest, headers[1].MsgType)
+
+	require.NoError(t, h.HandleChannelData(serverClipPDU(cliprdr.MsgTypeFormatDataResponse, cliprdr.FlagResponseOK, cliprdr.EncodeText("héllo"))))
+	assert.Equal(t, "héllo", received)
+
+	// A failed response does not invoke the callback
+	received = ""
+	require.NoError(t, h.HandleChannelData(serverClipPDU(cliprdr.MsgTypeFormatDataResponse, cliprdr.FlagResponseFail, nil)))
+	assert.Empty(t, received)
+}
+
+func TestClipboardHandler_RemoteCopyWithoutText(t *testing.T) {
+	client, mockMCS := newClipboardTestClient()
+	h := client.GetClipboardHandler()
+
+	formats := cliprdr.SerializeFormatList([]cliprdr.Format{{ID: 2}}, false) // CF_BITMAP
+	require.NoError(t, h.HandleChannelData(serverClipPDU(cliprdr.MsgTypeFormatList, 0, formats)))
+
+	headers := sentClipPDUs(t, mockMCS)
+	require.Len(t, headers, 1)
+	assert.Equal(t, cliprdr.MsgTypeFormatListResponse, headers[0].MsgType)
+}
+
+func TestClipboardHandler_Paste(t *testing.T) {
+	client, mockMCS := newClipboardTestClient()
+	h := client.GetClipboardHandler()
+
+	// Text set before the handshake is offered once the server is ready
+	require.NoError(t, client.SetClipboardText("early"))
+	assert.Empty(t, mockMCS.SendCalls)
+	require.NoError(t, h.HandleChannelData(serverClipPDU(cliprdr.MsgTypeMonitorReady, 0, nil)))
+	headers := sentClipPDUs(t, mockMCS)
+	require.Len(t, headers, 2)
+	assert.NotZero(t, headers[1].DataLen)
+
+	// Large text is split into several channel chunks
+	text := strings.Repeat("paste me ", 500)
+	mockMCS.SendCalls = nil
+	require.NoError(t, client.SetClipboardText(text))
+	require.NoError(t, h.HandleChannelData(serverClipPDU(cliprdr.MsgTypeFormatDataRequest, 0, cliprdr.SerializeFormatDataRequest(cliprdr.FormatUnicodeText))))
+
+	assert.Greater(t, len(mockMCS.SendCalls), 2)
+	headers = sentClipPDUs(t, mockMCS)
+	require.Len(t, headers, 2)
+	assert.Equal(t, cliprdr.MsgTypeFormatList, headers[0].MsgType)
+	assert.Equal(t, cliprdr.Header{
+		MsgType:  cliprdr.MsgTypeFormatDataResponse,
+		MsgFlags: cliprdr.FlagResponseOK,
+		DataLen:  uint32(len(cliprdr.EncodeText(text))), // #nosec G115 -- test data
+	}, headers[1])
+
+	// Once the server takes ownership again, requests are refused
+	mockMCS.SendCalls = nil
+	require.NoError(t, h.HandleChannelData(serverClipPDU(cliprdr.MsgTypeFormatList, 0, nil)))
+	require.NoError(t, h.HandleChannelData(serverClipPDU(cliprdr.MsgTypeFormatDataRequest, 0, cliprdr.SerializeFormatDataRequest(cliprdr.FormatUnicodeText))))
+	headers = sentClipPDUs(t, mockMCS)
+	require.Len(t, headers, 2)
+	assert.Equal(t, cliprdr.FlagResponseFail, headers[1].MsgFlags)
+
+	assert.Error(t, client.SetClipboardText(strings.Repeat("x", MaxClipboardTextSize)))
+}
+
+func TestBuildChannelChunks(t *testing.T) {
+	chunks := buildChannelChunks(nil, 4)
+	require.Len(t, chunks, 1)
+	assert.Equal(t, []byte{0, 0, 0, 0, 0x03, 0, 0, 0}, chunks[0])
+
+	chunks = buildChannelChunks([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9}, 4)
+	require.Len(t, chunks, 3)
+	var defrag audio.ChannelDefragmenter
+	for i, c := range chunks {
+		chunk, err := audio.ParseChannelData(c)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(9), chunk.Header.Length)
+		data, complete := defrag.Process(chunk)
+		if i < 2 {
+			assert.False(t, complete)
+			continue
+		}
+		assert.True(t, complete)
+		assert.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}, data)
+	}
+}
@@ -5,9 +5,36 @@ func (c *Client) Close() error {
 	if c.remoteApp != nil {
 		c.railState = RailStateUninitialized
 	}
+	if c.deviceRedirection != nil && c.deviceRedirection.drive != nil {
+		_ = c.deviceRedirection.drive.close()
+	}
 
 	if c.conn == nil {
 		return nil
 	}
 	return c.conn.Close()
 }
+
+// Disconnect ends the session cleanly: it sends an MCS Disconnect Provider
+// Ultimatum with the given reason (one of the mcs.RN* codes) and an X.224
+// Disconnect Request, so the server logs a logoff rather than a dropped
+// connection, then closes the connection. The connection is closed even if
+// sending fails.
+func (c *Client) Disconnect(reason uint8) error {
+	if c.conn == nil {
+		return nil
+	}
+
+	var err error
+	if c.mcsLayer != nil {
+		err = c.mcsLayer.Disconnect(reason)
+	}
+	if err == nil && c.x224Layer != nil {
+		err = c.x224Layer.Disconnect()
+	}
+
+	if closeErr := c.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -1,9 +1,14 @@
 package rdp
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/rcarmo/go-rdp/internal/protocol/mcs"
+	"github.com/rcarmo/go-rdp/internal/protocol/tpkt"
+	"github.com/rcarmo/go-rdp/internal/protocol/x224"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestClient_Close_WithRemoteApp(t *testing.T) {
@@ -43,3 +48,62 @@ func TestClient_Close_WithoutRemoteApp(t *testing.T) {
 type closeTestMockConn struct {
 	mockConn
 }
+
+// disconnectTestConn records writes and whether the connection was closed
+type disconnectTestConn struct {
+	mockConn
+	writes   [][]byte
+	writeErr error
+	closed   bool
+}
+
+func (m *disconnectTestConn) Write(b []byte) (int, error) {
+	if m.writeErr != nil {
+		return 0, m.writeErr
+	}
+	m.writes = append(m.writes, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func (m *disconnectTestConn) Close() error {
+	m.closed = true
+	return nil
+}
+
+func newDisconnectTestClient(conn *disconnectTestConn) *Client {
+	client := &Client{conn: conn}
+	client.tpktLayer = tpkt.New(client)
+	client.x224Layer = x224.New(client.tpktLayer)
+	client.mcsLayer = mcs.New(client.x224Layer)
+	return client
+}
+
+func TestClient_Disconnect(t *testing.T) {
+	conn := &disconnectTestConn{}
+	client := newDisconnectTestClient(conn)
+
+	require.NoError(t, client.Disconnect(mcs.RNUserRequested))
+
+	require.Len(t, conn.writes, 2)
+	// TPKT + X.224 Data + MCS Disconnect Provider Ultimatum (rn-user-requested)
+	assert.Equal(t, []byte{0x03, 0x00, 0x00, 0x09, 0x02, 0xF0, 0x80, 0x21, 0x80}, conn.writes[0])
+	// TPKT + X.224 Disconnect Request
+	assert.Equal(t, []byte{0x03, 0x00, 0x00, 0x0B, 0x06, 0x80, 0x00, 0x00, 0x00, 0x00, 0x80}, conn.writes[1])
+	assert.True(t, conn.closed)
+}
+
+func TestClient_Disconnect_SendErrorStillCloses(t *testing.T) {
+	conn := &disconnectTestConn{writeErr: errors.New("broken pipe")}
+	client := newDisconnectTestClient(conn)
+
+	err := client.Disconnect(mcs.RNProviderInitiated)
+
+	assert.ErrorIs(t, err, conn.writeErr)
+	assert.Empty(t, conn.writes)
+	assert.True(t, conn.closed)
+}
+
+func TestClient_Disconnect_NotConnected(t *testing.T) {
+	client := &Client{}
+	assert.NoError(t, client.Disconnect(mcs.RNUserRequested))
+}
@@ -1,62 +1,107 @@
 package rdp
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"time"
 
+	"github.com/rcarmo/go-rdp/internal/codec"
 	"github.com/rcarmo/go-rdp/internal/logging"
+	"github.com/rcarmo/go-rdp/internal/protocol/license"
+	"github.com/rcarmo/go-rdp/internal/protocol/mcs"
 	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
 )
 
 // Connect performs the RDP connection sequence including negotiation,
 // TLS/NLA setup, licensing, and capabilities exchange.
 func (c *Client) Connect() error {
-	var err error
-	connectStart := time.Now()
-	timings := make(map[string]time.Duration)
-
-	phaseStart := time.Now()
-	if err = c.connectionInitiation(); err != nil {
-		return fmt.Errorf("connection initiation: %w", err)
-	}
-	timings["negotiation"] = time.Since(phaseStart)
-
-	phaseStart = time.Now()
-	if err = c.basicSettingsExchange(); err != nil {
-		return fmt.Errorf("basic settings exchange: %w", err)
-	}
-	timings["settings"] = time.Since(phaseStart)
-
-	phaseStart = time.Now()
-	if err = c.channelConnection(); err != nil {
-		return fmt.Errorf("channel connection: %w", err)
-	}
-	timings["channels"] = time.Since(phaseStart)
+	_, err := c.ConnectWithResult()
+	return err
+}
 
-	phaseStart = time.Now()
-	if err = c.secureSettingsExchange(); err != nil {
-		return fmt.Errorf("secure settings exchange: %w", err)
-	}
-	timings["secure"] = time.Since(phaseStart)
+// ConnectWithResult performs the connection sequence as Connect does and
+// also reports the stage reached and what was negotiated. The result is
+// returned on error too, with the stage that failed.
+func (c *Client) ConnectWithResult() (*ConnectResult, error) {
+	return c.ConnectWithResultContext(context.Background())
+}
 
-	phaseStart = time.Now()
-	if err = c.licensing(); err != nil {
-		return fmt.Errorf("licensing: %w", err)
+// ConnectWithResultContext performs the connection sequence as
+// ConnectWithResult does, bounded by ctx as well as the handshake timeout:
+// when ctx is done first, the connection is closed and the stage waiting on
+// the server fails with ctx's error.
+func (c *Client) ConnectWithResultContext(ctx context.Context) (*ConnectResult, error) {
+	connectStart := time.Now()
+	timings := make(map[ConnectStage]time.Duration)
+
+	// Clients set up around an existing connection are timed from here
+	if c.dialedAt.IsZero() {
+		c.dialedAt = connectStart
+	}
+	c.reachPhase(PhaseTCPConnected)
+
+	stages := []struct {
+		stage ConnectStage
+		run   func() error
+		name  string
+	}{
+		{StageNegotiation, c.connectionInitiation, "connection initiation"},
+		{StageBasicSettings, c.basicSettingsExchange, "basic settings exchange"},
+		{StageChannels, c.channelConnection, "channel connection"},
+		{StageSecureSettings, c.secureSettingsExchange, "secure settings exchange"},
+		{StageLicensing, c.licensing, "licensing"},
+		{StageCapabilities, c.capabilitiesExchange, "capabilities exchange"},
+		{StageFinalization, c.connectionFinalization, "connection finalization"},
+	}
+
+	if c.handshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, c.handshakeTimeout,
+			fmt.Errorf("%w after %v", ErrHandshakeTimeout, c.handshakeTimeout))
+		defer cancel()
+	}
+
+	// Closing the dialed connection, which TLS wraps later, unblocks
+	// whichever stage is waiting on the server
+	interrupted := func() error { return nil }
+	if c.conn != nil {
+		conn := c.conn
+		stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+		interrupted = func() error {
+			if stop() || ctx.Err() == nil {
+				return nil
+			}
+			return context.Cause(ctx)
+		}
 	}
-	timings["licensing"] = time.Since(phaseStart)
 
-	phaseStart = time.Now()
-	if err = c.capabilitiesExchange(); err != nil {
-		return fmt.Errorf("capabilities exchange: %w", err)
+	for _, s := range stages {
+		if c.stageCallback != nil {
+			c.stageCallback(s.stage)
+		}
+		phaseStart := time.Now()
+		if err := s.run(); err != nil {
+			if cause := interrupted(); cause != nil {
+				err = cause
+			}
+			err = fmt.Errorf("%s: %w", s.name, err)
+			c.failPhase(err)
+			return c.connectResult(s.stage, timings), err
+		}
+		timings[s.stage] = time.Since(phaseStart)
+		if phase, ok := stagePhases[s.stage]; ok {
+			c.reachPhase(phase)
+		}
 	}
-	timings["capabilities"] = time.Since(phaseStart)
-
-	phaseStart = time.Now()
-	if err = c.connectionFinalization(); err != nil {
-		return fmt.Errorf("connection finalizatioin: %w", err)
+	if cause := interrupted(); cause != nil {
+		err := fmt.Errorf("connection finalization: %w", cause)
+		c.failPhase(err)
+		return c.connectResult(StageFinalization, timings), err
 	}
-	timings["finalization"] = time.Since(phaseStart)
+	c.reachPhase(PhaseActiveDesktop)
 
 	// Initialize display control if enabled
 	if c.displayControl != nil {
@@ -72,35 +117,23 @@ func (c *Client) Connect() error {
 	}
 
 	// Request a full screen refresh from the server
-	if err = c.sendRefreshRect(); err != nil {
+	if err := c.sendRefreshRect(); err != nil {
 		logging.Warn("RDP: Failed to send refresh rect: %v", err)
 		// Don't fail the connection if refresh rect fails
 	}
 
 	totalTime := time.Since(connectStart)
 	logging.Info("Connection timing: total=%v negotiation=%v settings=%v channels=%v secure=%v licensing=%v capabilities=%v finalization=%v",
-		totalTime, timings["negotiation"], timings["settings"], timings["channels"],
-		timings["secure"], timings["licensing"], timings["capabilities"], timings["finalization"])
+		totalTime, timings[StageNegotiation], timings[StageBasicSettings], timings[StageChannels],
+		timings[StageSecureSettings], timings[StageLicensing], timings[StageCapabilities], timings[StageFinalization])
 
-	return nil
+	return c.connectResult(StageActive, timings), nil
 }
 
 func (c *Client) connectionInitiation() error {
 	var err error
 
-	// Request both SSL and Hybrid (NLA) protocols - server will pick what it supports
-	// If useNLA is set, we prefer NLA but will fall back to SSL
-	requestedProtocol := c.selectedProtocol
-	if c.useNLA {
-		// Request both SSL and Hybrid so server can choose
-		requestedProtocol = pdu.NegotiationProtocolSSL | pdu.NegotiationProtocolHybrid
-	}
-
-	req := pdu.ClientConnectionRequest{
-		NegotiationRequest: pdu.NegotiationRequest{
-			RequestedProtocols: requestedProtocol,
-		},
-	}
+	req := c.connectionRequest()
 
 	var (
 		resp pdu.ServerConnectionConfirm
@@ -154,12 +187,20 @@ func (c *Client) connectionInitiation() error {
 
 	// Handle Hybrid (NLA) protocol - preferred when available
 	if selectedProto.IsHybrid() {
-		return c.StartNLA()
+		if err := c.StartNLA(); err != nil {
+			return err
+		}
+		c.reachPhase(PhaseNLAComplete)
+		return nil
 	}
 
 	// Handle SSL protocol
 	if selectedProto.IsSSL() {
-		return c.StartTLS()
+		if err := c.StartTLS(); err != nil {
+			return err
+		}
+		c.reachPhase(PhaseTLSHandshakeDone)
+		return nil
 	}
 
 	// Handle standard RDP (no encryption/basic security)
@@ -170,8 +211,45 @@ func (c *Client) connectionInitiation() error {
 	return ErrUnsupportedRequestedProtocol
 }
 
+// connectionRequest builds the X.224 Connection Request, carrying the routing
+// token of a redirection this client follows
+func (c *Client) connectionRequest() pdu.ClientConnectionRequest {
+	// Request both SSL and Hybrid (NLA) protocols - server will pick what it supports
+	// If useNLA is set, we prefer NLA but will fall back to SSL
+	requestedProtocol := c.selectedProtocol
+	if c.useNLA {
+		// Request both SSL and Hybrid so server can choose
+		requestedProtocol = pdu.NegotiationProtocolSSL | pdu.NegotiationProtocolHybrid
+	}
+
+	req := pdu.ClientConnectionRequest{
+		NegotiationRequest: pdu.NegotiationRequest{
+			RequestedProtocols: requestedProtocol,
+		},
+	}
+	if c.redirectedFrom != nil && len(c.redirectedFrom.RoutingToken) > 0 {
+		req.RoutingToken = string(c.redirectedFrom.RoutingToken)
+	}
+	return req
+}
+
 func (c *Client) basicSettingsExchange() error {
+	c.limitChannels()
 	clientUserDataSet := pdu.NewClientUserDataSet(uint32(c.selectedProtocol), c.desktopWidth, c.desktopHeight, c.colorDepth, c.channels)
+	if c.primaryMonitorOnly {
+		clientUserDataSet.ClientMonitorData = pdu.NewSingleMonitorData(c.desktopWidth, c.desktopHeight)
+	} else if c.monitorData != nil {
+		clientUserDataSet.ClientMonitorData = c.monitorData
+	}
+	clientUserDataSet.ClientClusterData = c.clientClusterData()
+	c.applyClientIdentity(clientUserDataSet.ClientCoreData)
+
+	// Ask for the message channel, which carries the Server Heartbeat PDU
+	clientUserDataSet.ClientCoreData.EarlyCapabilityFlags |= pdu.ECFSupportHeartbeatPDU
+	clientUserDataSet.ClientMessageChannelData = &pdu.ClientMessageChannelData{}
+
+	// Let a broker report progress while it prepares the session
+	clientUserDataSet.ClientCoreData.EarlyCapabilityFlags |= pdu.ECFSupportStatusInfoPDU
 
 	wire, err := c.mcsLayer.Connect(clientUserDataSet.Serialize())
 	if err != nil {
@@ -183,8 +261,19 @@ func (c *Client) basicSettingsExchange() error {
 	if err != nil {
 		return err
 	}
+	if serverUserData.ServerNetworkData == nil {
+		return ErrMissingServerNetworkData
+	}
+	c.serverCoreData = serverUserData.ServerCoreData
 
-	c.initChannels(serverUserData.ServerNetworkData)
+	networkData := serverUserData.ServerNetworkData
+	c.limitChannelIDs(networkData)
+	c.mcsLayer.SetChannels(c.channels, networkData.MCSChannelId, networkData.ChannelIdArray)
+	c.initChannels(networkData)
+	if msgChannel := serverUserData.ServerMessageChannelData; msgChannel != nil {
+		c.mcsLayer.SetChannel(mcs.MessageChannelName, msgChannel.MCSChannelID)
+		c.channelIDMap[mcs.MessageChannelName] = msgChannel.MCSChannelID
+	}
 
 	// RNS_UD_SC_SKIP_CHANNELJOIN_SUPPORTED = 0x00000008
 	// This flag means the server SUPPORTS skipping, but we should only skip if we also requested it
@@ -195,18 +284,15 @@ func (c *Client) basicSettingsExchange() error {
 	return nil
 }
 
+// initChannels mirrors the channel IDs the MCS layer records, for lookups by
+// the virtual channel handlers
 func (c *Client) initChannels(serverNetworkData *pdu.ServerNetworkData) {
 	if c.channelIDMap == nil {
 		c.channelIDMap = make(map[string]uint16)
 	}
 
-	for i, channelName := range c.channels {
-		if i < len(serverNetworkData.ChannelIdArray) {
-			c.channelIDMap[channelName] = serverNetworkData.ChannelIdArray[i]
-		}
-	}
-
-	c.channelIDMap["global"] = serverNetworkData.MCSChannelId
+	assigned := mcs.AssignChannelIDs(c.channels, serverNetworkData.MCSChannelId, serverNetworkData.ChannelIdArray)
+	maps.Copy(c.channelIDMap, assigned)
 }
 
 func (c *Client) channelConnection() error {
@@ -220,13 +306,21 @@ func (c *Client) channelConnection() error {
 		return err
 	}
 
-	c.channelIDMap["user"] = c.userID
+	c.channelIDMap[mcs.UserChannelName] = c.userID
 
 	if c.skipChannelJoin {
 		return nil
 	}
 
-	err = c.mcsLayer.JoinChannels(c.userID, c.channelIDMap)
+	err = c.mcsLayer.JoinChannels(c.userID)
+	if rejections, ok := mcs.OptionalJoinRejections(err); ok {
+		// The session carries on without the virtual channels refused
+		for _, rejected := range rejections {
+			logging.Warn("RDP: %v; continuing without it", rejected)
+			delete(c.channelIDMap, rejected.ChannelName)
+		}
+		return nil
+	}
 	if err != nil {
 		return err
 	}
@@ -241,6 +335,14 @@ func (c *Client) secureSettingsExchange() error {
 		clientInfoPDU.InfoPacket.Flags |= pdu.InfoFlagRail
 	}
 
+	if c.audioDisabled {
+		clientInfoPDU.InfoPacket.Flags |= pdu.InfoFlagNoAudioPlayback
+	}
+
+	if c.autoReconnectCookie != nil {
+		clientInfoPDU.InfoPacket.ExtraInfo.AutoReconnectCookie = c.clientAutoReconnectPacket()
+	}
+
 	// Per MS-RDPBCGR 2.2.1.11.1.1: security header MUST NOT be present when Enhanced RDP Security (TLS) is in effect
 	useEnhancedSecurity := c.selectedProtocol.IsSSL() || c.selectedProtocol.IsHybrid()
 	data := clientInfoPDU.Serialize(useEnhancedSecurity)
@@ -260,45 +362,54 @@ func min(a, b int) int {
 }
 
 func (c *Client) licensing() error {
-	// Per MS-RDPBCGR, when Enhanced RDP Security (TLS) is in effect, the security header is not present
-	useEnhancedSecurity := c.selectedProtocol.IsSSL() || c.selectedProtocol.IsHybrid()
-
 	// Set a read deadline so we don't hang forever
 	if c.conn != nil {
 		_ = c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
 		defer func() { _ = c.conn.SetReadDeadline(time.Time{}) }() // Clear deadline
 	}
 
-	_, wire, err := c.mcsLayer.Receive()
-	if err != nil {
-		errStr := err.Error()
-		// Check for disconnect ultimatum which often means authentication failed
-		if errStr == "disconnect ultimatum" {
-			return fmt.Errorf("server disconnected during licensing - possible causes: 1) Invalid credentials, 2) Account locked, 3) NLA required but not negotiated, 4) XRDP session limit reached")
+	// Licensing PDUs always carry the security header, even with Enhanced
+	// RDP Security; XRDP sends SEC_LICENSE_PKT | SEC_LICENSE_ENCRYPT_CS
+	lc := license.NewClient(c.username, deviceRedirectionClientName)
+	for {
+		_, wire, err := c.mcsLayer.Receive()
+		if err != nil {
+			errStr := err.Error()
+			// Check for disconnect ultimatum which often means authentication failed
+			if errStr == "disconnect ultimatum" {
+				return fmt.Errorf("server disconnected during licensing - possible causes: 1) Invalid credentials, 2) Account locked, 3) NLA required but not negotiated, 4) XRDP session limit reached")
+			}
+			return fmt.Errorf("licensing receive: %w", err)
 		}
-		return fmt.Errorf("licensing receive: %w", err)
-	}
-
-	var resp pdu.ServerLicenseError
-	if err = resp.Deserialize(wire, useEnhancedSecurity); err != nil {
-		return fmt.Errorf("server license error: %w", err)
-	}
 
-	if resp.Preamble.MsgType == 0x03 { // NEW_LICENSE
-		return nil
-	}
-
-	if resp.Preamble.MsgType != 0xFF { // ERROR_ALERT
-		return fmt.Errorf("unknown license msg type: 0x%02X", resp.Preamble.MsgType)
-	}
+		securityFlag, err := codec.UnwrapSecurityFlag(wire)
+		if err != nil {
+			return fmt.Errorf("server license error: %w", err)
+		}
+		if securityFlag&0x0080 == 0 { // SEC_LICENSE_PKT
+			return errors.New("server license error: bad license header")
+		}
+		msg, err := io.ReadAll(wire)
+		if err != nil {
+			return fmt.Errorf("server license error: %w", err)
+		}
 
-	if resp.ValidClientMessage.ErrorCode != 0x00000007 { // STATUS_VALID_CLIENT
-		return fmt.Errorf("license error code: 0x%08X (expected STATUS_VALID_CLIENT 0x00000007)", resp.ValidClientMessage.ErrorCode)
-	}
+		reply, done, err := lc.Handle(msg)
+		var licenseErr *license.Error
+		switch {
+		case errors.As(err, &licenseErr) && licenseErr.Code == license.CodeNoLicenseServer:
+			return fmt.Errorf("%w: no license server available (license error code 0x%08X)", ErrTransient, licenseErr.Code)
+		case err != nil:
+			return err
+		case done:
+			if lc.License() != nil {
+				logging.Debug("Licensing: received a license for %s", lc.License().ProductID)
+			}
+			return nil
+		}
 
-	if resp.ValidClientMessage.StateTransition != 0x00000002 { // ST_NO_TRANSITION
-		return fmt.Errorf("license state transition: 0x%08X (expected ST_NO_TRANSITION 0x00000002)", resp.ValidClientMessage.StateTransition)
+		if err := c.mcsLayer.Send(c.userID, c.channelIDMap["global"], codec.WrapSecurityFlag(0x0080, reply)); err != nil {
+			return fmt.Errorf("licensing send: %w", err)
+		}
 	}
-
-	return nil
 }
@@ -36,6 +36,50 @@ func TestBasicSettingsExchange_Success(t *testing.T) {
 	err := client.basicSettingsExchange()
 	require.NoError(t, err)
 	assert.False(t, client.skipChannelJoin)
+
+	// The MCS layer records the assigned IDs and the client mirrors them
+	require.Len(t, mockMCS.SetChannelsCalls, 1)
+	assert.Equal(t, mockSetChannelsCall{[]string{"rdpsnd", "cliprdr"}, 1003, []uint16{1004, 1005}}, mockMCS.SetChannelsCalls[0])
+	assert.Equal(t, map[string]uint16{"global": 1003, "rdpsnd": 1004, "cliprdr": 1005}, client.channelIDMap)
+}
+
+func TestBasicSettingsExchange_ServerRDPVersion(t *testing.T) {
+	serverUserData := createTestServerUserDataResponse(t)
+	binary.LittleEndian.PutUint32(serverUserData[4:], 0x0008000C) // RDP 10.7
+	binary.LittleEndian.PutUint32(serverUserData[8:], uint32(pdu.NegotiationProtocolHybrid))
+
+	client := &Client{
+		channelIDMap: make(map[string]uint16),
+		mcsLayer: &MockMCSLayer{
+			ConnectFunc: func(userData []byte) (io.Reader, error) {
+				return bytes.NewReader(serverUserData), nil
+			},
+		},
+	}
+	assert.Empty(t, client.GetServerCapabilities().ServerRDPVersion)
+
+	require.NoError(t, client.basicSettingsExchange())
+	info := client.GetServerCapabilities()
+	assert.Equal(t, "10.7", info.ServerRDPVersion)
+	assert.Equal(t, uint32(pdu.NegotiationProtocolHybrid), info.ServerRequestedProtocols)
+}
+
+func TestBasicSettingsExchange_MissingNetworkData(t *testing.T) {
+	coreOnly := []byte{
+		0x01, 0x0C, 0x08, 0x00, // SC_CORE, length 8
+		0x04, 0x00, 0x08, 0x00, // version
+	}
+	client := &Client{
+		channelIDMap: make(map[string]uint16),
+		mcsLayer: &MockMCSLayer{
+			ConnectFunc: func(userData []byte) (io.Reader, error) {
+				return bytes.NewReader(coreOnly), nil
+			},
+		},
+	}
+
+	err := client.basicSettingsExchange()
+	require.ErrorIs(t, err, ErrMissingServerNetworkData)
 }
 
 // TestChannelConnection_Success tests the channel connection phase
@@ -92,7 +136,7 @@ func TestChannelConnection_Success(t *testing.T) {
 					}
 					return 1001, nil
 				},
-				JoinChannelsFunc: func(userID uint16, channelIDMap map[string]uint16) error {
+				JoinChannelsFunc: func(userID uint16) error {
 					return tt.joinChannelsErr
 				},
 			}
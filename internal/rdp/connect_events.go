@@ -0,0 +1,82 @@
+package rdp
+
+import "time"
+
+// ConnectPhase is a milestone of the connection sequence. Where a failed
+// connection stopped tells TLS, NLA and licensing problems apart.
+type ConnectPhase int
+
+const (
+	PhaseTCPConnected ConnectPhase = iota
+	PhaseTLSHandshakeDone
+	PhaseNLAComplete
+	PhaseMCSConnected
+	PhaseLicenseOK
+	PhaseCapabilitiesExchanged
+	PhaseActiveDesktop
+)
+
+var connectPhaseNames = map[ConnectPhase]string{
+	PhaseTCPConnected:          "tcp_connected",
+	PhaseTLSHandshakeDone:      "tls_handshake_done",
+	PhaseNLAComplete:           "nla_complete",
+	PhaseMCSConnected:          "mcs_connected",
+	PhaseLicenseOK:             "license_ok",
+	PhaseCapabilitiesExchanged: "capabilities_exchanged",
+	PhaseActiveDesktop:         "active_desktop",
+}
+
+func (p ConnectPhase) String() string {
+	if name, ok := connectPhaseNames[p]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// stagePhases are the phases reached when a stage completes. Negotiation
+// reports TLS and NLA itself, and the active desktop is only reached once
+// the whole sequence has completed in time.
+var stagePhases = map[ConnectStage]ConnectPhase{
+	StageBasicSettings: PhaseMCSConnected,
+	StageLicensing:     PhaseLicenseOK,
+	StageCapabilities:  PhaseCapabilitiesExchanged,
+}
+
+// ConnectEvent reports a phase reached during the connection sequence, or
+// its failure.
+type ConnectEvent struct {
+	Phase ConnectPhase
+	// Elapsed is the time since the client started dialing the server
+	Elapsed time.Duration
+	// Err is set on the last event of a failed sequence, whose Phase is
+	// then the last phase reached
+	Err error
+}
+
+// ConnectEventCallback is called with each ConnectEvent
+type ConnectEventCallback func(event ConnectEvent)
+
+// SetConnectEventCallback sets the function to call as Connect reaches each
+// phase and, if the sequence fails, once more with the error.
+func (c *Client) SetConnectEventCallback(cb ConnectEventCallback) {
+	c.connectEventCallback = cb
+}
+
+// reachPhase records phase as reached and reports it.
+func (c *Client) reachPhase(phase ConnectPhase) {
+	c.lastPhase = phase
+	c.emitConnectEvent(ConnectEvent{Phase: phase})
+}
+
+// failPhase reports that the sequence failed after the last phase reached.
+func (c *Client) failPhase(err error) {
+	c.emitConnectEvent(ConnectEvent{Phase: c.lastPhase, Err: err})
+}
+
+func (c *Client) emitConnectEvent(event ConnectEvent) {
+	if c.connectEventCallback == nil {
+		return
+	}
+	event.Elapsed = time.Since(c.dialedAt)
+	c.connectEventCallback(event)
+}
@@ -0,0 +1,104 @@
+package rdp
+
+import (
+	"time"
+
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+)
+
+// ConnectStage is a phase of the connection sequence (MS-RDPBCGR 1.3.1.1)
+type ConnectStage int
+
+const (
+	StageNegotiation ConnectStage = iota
+	StageBasicSettings
+	StageChannels
+	StageSecureSettings
+	StageLicensing
+	StageCapabilities
+	StageFinalization
+	// StageActive is reached once the sequence completes
+	StageActive
+)
+
+var connectStageNames = map[ConnectStage]string{
+	StageNegotiation:    "negotiation",
+	StageBasicSettings:  "settings",
+	StageChannels:       "channels",
+	StageSecureSettings: "secure",
+	StageLicensing:      "licensing",
+	StageCapabilities:   "capabilities",
+	StageFinalization:   "finalization",
+	StageActive:         "active",
+}
+
+func (s ConnectStage) String() string {
+	if name, ok := connectStageNames[s]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Transports a Client can reach the server over
+const (
+	TransportTCP     = "tcp"
+	TransportGateway = "rdg"
+)
+
+// ConnectResult describes how far a connection sequence got and what was
+// negotiated on the way.
+type ConnectResult struct {
+	// Stage is the stage that failed, or StageActive on success
+	Stage ConnectStage
+	// Phase is the last phase reached, PhaseActiveDesktop on success
+	Phase ConnectPhase
+	// SecurityProtocol is the protocol the server selected, once negotiated
+	SecurityProtocol pdu.NegotiationProtocol
+	// ServerCapabilities is nil until the capabilities exchange completes
+	ServerCapabilities *ServerCapabilityInfo
+	// Transport is TransportTCP or TransportGateway
+	Transport string
+	// Timings holds the duration of each stage completed
+	Timings map[ConnectStage]time.Duration
+}
+
+// SetTransport records the transport the client was dialed over, reported in
+// ConnectResult. Clients default to TransportTCP.
+func (c *Client) SetTransport(transport string) {
+	c.transport = transport
+}
+
+// StageCallback is called as each stage of the connection sequence starts
+type StageCallback func(stage ConnectStage)
+
+// SetStageCallback sets the function to call as Connect enters each stage,
+// which lets callers show progress during a slow logon.
+func (c *Client) SetStageCallback(cb StageCallback) {
+	c.stageCallback = cb
+}
+
+// SetHandshakeTimeout bounds how long one connection sequence may take; when
+// it elapses the connection is closed and Connect fails with
+// ErrHandshakeTimeout. Zero means no limit.
+func (c *Client) SetHandshakeTimeout(timeout time.Duration) {
+	c.handshakeTimeout = timeout
+}
+
+func (c *Client) connectResult(stage ConnectStage, timings map[ConnectStage]time.Duration) *ConnectResult {
+	result := &ConnectResult{
+		Stage:     stage,
+		Phase:     c.lastPhase,
+		Transport: c.transport,
+		Timings:   timings,
+	}
+	if stage > StageNegotiation {
+		result.SecurityProtocol = c.selectedProtocol
+	}
+	if stage > StageCapabilities {
+		result.ServerCapabilities = c.GetServerCapabilities()
+	}
+	if result.Transport == "" {
+		result.Transport = TransportTCP
+	}
+	return result
+}
@@ -0,0 +1,147 @@
+package rdp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcarmo/go-rdp/internal/protocol/license"
+)
+
+func TestConnectWithResult_Handshake(t *testing.T) {
+	client, server := newTestServerClient(t, nil)
+
+	result, err := client.ConnectWithResult()
+	require.NoError(t, err)
+	server.waitActive()
+
+	require.NotNil(t, result)
+	assert.Equal(t, StageActive, result.Stage)
+	assert.True(t, result.SecurityProtocol.IsSSL())
+	assert.Equal(t, TransportTCP, result.Transport)
+	require.NotNil(t, result.ServerCapabilities)
+	assert.NotEmpty(t, result.ServerCapabilities.DesktopSize)
+	for stage := StageNegotiation; stage < StageActive; stage++ {
+		assert.Contains(t, result.Timings, stage, stage.String())
+	}
+
+	require.NoError(t, client.Close())
+}
+
+func TestConnectWithResult_FailedStage(t *testing.T) {
+	client, _ := newTestServerClient(t, func(s *testServer) {
+		s.LicenseError = license.CodeNoLicenseServer
+	})
+	client.SetTransport(TransportGateway)
+
+	result, err := client.ConnectWithResult()
+	require.Error(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, StageLicensing, result.Stage)
+	assert.True(t, result.SecurityProtocol.IsSSL())
+	assert.Equal(t, TransportGateway, result.Transport)
+	assert.Nil(t, result.ServerCapabilities)
+	assert.NotContains(t, result.Timings, StageLicensing)
+}
+
+func TestConnectStage_String(t *testing.T) {
+	assert.Equal(t, "licensing", StageLicensing.String())
+	assert.Equal(t, "active", StageActive.String())
+	assert.Equal(t, "unknown", ConnectStage(99).String())
+}
+
+func TestConnectWithResult_StageCallback(t *testing.T) {
+	client, server := newTestServerClient(t, nil)
+	var stages []ConnectStage
+	client.SetStageCallback(func(stage ConnectStage) { stages = append(stages, stage) })
+
+	_, err := client.ConnectWithResult()
+	require.NoError(t, err)
+	server.waitActive()
+
+	assert.Equal(t, []ConnectStage{
+		StageNegotiation, StageBasicSettings, StageChannels, StageSecureSettings,
+		StageLicensing, StageCapabilities, StageFinalization,
+	}, stages)
+	require.NoError(t, client.Close())
+}
+
+func TestConnectWithResult_HandshakeTimeout(t *testing.T) {
+	client, _ := newTestServerClient(t, func(s *testServer) {
+		s.LicenseDelay = time.Second
+	})
+	client.SetHandshakeTimeout(100 * time.Millisecond)
+
+	start := time.Now()
+	result, err := client.ConnectWithResult()
+	require.ErrorIs(t, err, ErrHandshakeTimeout)
+	assert.Less(t, time.Since(start), time.Second)
+	require.NotNil(t, result)
+	assert.Equal(t, StageLicensing, result.Stage)
+}
+
+func TestConnectWithResult_SlowHandshakeWithinTimeout(t *testing.T) {
+	client, server := newTestServerClient(t, func(s *testServer) {
+		s.LicenseDelay = 50 * time.Millisecond
+	})
+	client.SetHandshakeTimeout(5 * time.Second)
+
+	_, err := client.ConnectWithResult()
+	require.NoError(t, err)
+	server.waitActive()
+	require.NoError(t, client.Close())
+}
+
+func TestConnectWithResult_ConnectEvents(t *testing.T) {
+	client, server := newTestServerClient(t, nil)
+	var events []ConnectEvent
+	client.SetConnectEventCallback(func(event ConnectEvent) { events = append(events, event) })
+
+	result, err := client.ConnectWithResult()
+	require.NoError(t, err)
+	server.waitActive()
+	assert.Equal(t, PhaseActiveDesktop, result.Phase)
+
+	var phases []ConnectPhase
+	var last time.Duration
+	for _, event := range events {
+		assert.NoError(t, event.Err)
+		assert.GreaterOrEqual(t, event.Elapsed, last, event.Phase.String())
+		last = event.Elapsed
+		phases = append(phases, event.Phase)
+	}
+	assert.Equal(t, []ConnectPhase{
+		PhaseTCPConnected, PhaseTLSHandshakeDone, PhaseMCSConnected,
+		PhaseLicenseOK, PhaseCapabilitiesExchanged, PhaseActiveDesktop,
+	}, phases)
+	require.NoError(t, client.Close())
+}
+
+func TestConnectWithResult_ConnectEventsOnFailure(t *testing.T) {
+	client, _ := newTestServerClient(t, func(s *testServer) {
+		s.LicenseError = license.CodeNoLicenseServer
+	})
+	var events []ConnectEvent
+	client.SetConnectEventCallback(func(event ConnectEvent) { events = append(events, event) })
+
+	result, err := client.ConnectWithResult()
+	require.Error(t, err)
+	assert.Equal(t, PhaseMCSConnected, result.Phase)
+
+	require.NotEmpty(t, events)
+	failure := events[len(events)-1]
+	assert.Equal(t, PhaseMCSConnected, failure.Phase, "the failure reports the last phase reached")
+	assert.Equal(t, err, failure.Err)
+	for _, event := range events[:len(events)-1] {
+		assert.NoError(t, event.Err)
+		assert.NotEqual(t, PhaseLicenseOK, event.Phase)
+	}
+}
+
+func TestConnectPhase_String(t *testing.T) {
+	assert.Equal(t, "tls_handshake_done", PhaseTLSHandshakeDone.String())
+	assert.Equal(t, "license_ok", PhaseLicenseOK.String())
+	assert.Equal(t, "unknown", ConnectPhase(99).String())
+}
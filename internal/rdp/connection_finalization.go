@@ -68,7 +68,16 @@ func (c *Client) connectionFinalization() error {
 			}
 		case pduType2.IsFontmap():
 			fontMapReceived = true
+		case pduType2.IsMonitorLayout():
+			c.handleMonitorLayout(dataPDU.MonitorLayoutPDUData)
+		case pduType2.IsSaveSessionInfo():
+			c.handleSaveSessionInfo(dataPDU.SaveSessionInfoPDUData)
+		case pduType2.IsStatusInfo():
+			c.handleStatusInfo(dataPDU.StatusInfoPDUData)
 		case pduType2.IsErrorInfo():
+			if isTransientErrorInfo(dataPDU.ErrorInfoPDUData.ErrorInfo) {
+				return fmt.Errorf("%w: server error info: %s", ErrTransient, dataPDU.ErrorInfoPDUData.String())
+			}
 			return fmt.Errorf("server error info: %d", dataPDU.ErrorInfoPDUData.ErrorInfo)
 		default:
 			return fmt.Errorf("unknown server message with pduType2 = %d", pduType2)
@@ -19,14 +19,18 @@ type MockMCSLayer struct {
 	ConnectFunc     func(userData []byte) (io.Reader, error)
 	ErectDomainFunc func() error
 	AttachUserFunc  func() (uint16, error)
-	JoinChannelsFunc func(userID uint16, channelIDMap map[string]uint16) error
+	JoinChannelsFunc func(userID uint16) error
+	DisconnectFunc  func(reason uint8) error
 
 	SendCalls         []mockSendCall
 	ReceiveCalls      int
 	ConnectCalls      [][]byte
 	ErectDomainCalls  int
 	AttachUserCalls   int
-	JoinChannelsCalls []mockJoinChannelsCall
+	SetChannelsCalls  []mockSetChannelsCall
+	SetChannelCalls   map[string]uint16
+	JoinChannelsCalls []uint16
+	DisconnectCalls   []uint8
 }
 
 type mockSendCall struct {
@@ -35,9 +39,10 @@ type mockSendCall struct {
 	Data      []byte
 }
 
-type mockJoinChannelsCall struct {
-	UserID       uint16
-	ChannelIDMap map[string]uint16
+type mockSetChannelsCall struct {
+	Names    []string
+	GlobalID uint16
+	IDs      []uint16
 }
 
 func (m *MockMCSLayer) Send(userID, channelID uint16, data []byte) error {
@@ -80,10 +85,29 @@ func (m *MockMCSLayer) AttachUser() (uint16, error) {
 	return 1001, nil
 }
 
-func (m *MockMCSLayer) JoinChannels(userID uint16, channelIDMap map[string]uint16) error {
-	m.JoinChannelsCalls = append(m.JoinChannelsCalls, mockJoinChannelsCall{userID, channelIDMap})
+func (m *MockMCSLayer) SetChannels(names []string, globalID uint16, ids []uint16) {
+	m.SetChannelsCalls = append(m.SetChannelsCalls, mockSetChannelsCall{names, globalID, ids})
+}
+
+func (m *MockMCSLayer) SetChannel(name string, id uint16) {
+	if m.SetChannelCalls == nil {
+		m.SetChannelCalls = make(map[string]uint16)
+	}
+	m.SetChannelCalls[name] = id
+}
+
+func (m *MockMCSLayer) JoinChannels(userID uint16) error {
+	m.JoinChannelsCalls = append(m.JoinChannelsCalls, userID)
 	if m.JoinChannelsFunc != nil {
-		return m.JoinChannelsFunc(userID, channelIDMap)
+		return m.JoinChannelsFunc(userID)
+	}
+	return nil
+}
+
+func (m *MockMCSLayer) Disconnect(reason uint8) error {
+	m.DisconnectCalls = append(m.DisconnectCalls, reason)
+	if m.DisconnectFunc != nil {
+		return m.DisconnectFunc(reason)
 	}
 	return nil
 }
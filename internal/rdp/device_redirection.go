@@ -0,0 +1,231 @@
+package rdp
+
+import (
+	"sync"
+
+	"github.com/rcarmo/go-rdp/internal/logging"
+	"github.com/rcarmo/go-rdp/internal/protocol/audio"
+	"github.com/rcarmo/go-rdp/internal/protocol/rdpdr"
+)
+
+// deviceRedirectionClientName is the computer name sent in the Client Name Request
+const deviceRedirectionClientName = "go-rdp"
+
+// defaultVCChunkSize is CHANNEL_CHUNK_LENGTH, used when the server does not
+// advertise a virtual channel chunk size
+const defaultVCChunkSize = 1600
+
+// DeviceRedirectionHandler completes the RDPDR core handshake, so servers
+// waiting on the channel (for example during smartcard logon) do not stall
+// the session, and serves the I/O requests of a read-only drive when one is
+// configured.
+type DeviceRedirectionHandler struct {
+	client       *Client
+	defragmenter audio.ChannelDefragmenter
+	drive        *driveDevice
+
+	mu       sync.Mutex
+	clientID uint32
+	ready    bool // server confirmed the client ID
+}
+
+// NewDeviceRedirectionHandler creates a new device redirection handler
+func NewDeviceRedirectionHandler(client *Client) *DeviceRedirectionHandler {
+	return &DeviceRedirectionHandler{client: client}
+}
+
+// IsReady returns whether the server has confirmed the client ID
+func (h *DeviceRedirectionHandler) IsReady() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.ready
+}
+
+// HandleChannelData processes RDPDR channel data
+func (h *DeviceRedirectionHandler) HandleChannelData(data []byte) error {
+	chunk, err := audio.ParseChannelData(data)
+	if err != nil {
+		return err
+	}
+
+	completeData, complete := h.defragmenter.Process(chunk)
+	if !complete {
+		return nil
+	}
+
+	header, body, err := rdpdr.ParsePDU(completeData)
+	if err != nil {
+		return err
+	}
+
+	if header.Component != rdpdr.ComponentCore {
+		logging.Debug("RDPDR: Ignoring component 0x%04X packet 0x%04X", header.Component, header.PacketID)
+		return nil
+	}
+
+	switch header.PacketID {
+	case rdpdr.PacketServerAnnounce:
+		return h.handleServerAnnounce(body)
+	case rdpdr.PacketServerCapability:
+		return h.handleServerCapability(body)
+	case rdpdr.PacketClientIDConfirm:
+		return h.handleClientIDConfirm(body)
+	case rdpdr.PacketUserLoggedOn:
+		// File system devices are announced once the user has logged on
+		return h.send(rdpdr.PacketDeviceListAnnounce, rdpdr.SerializeDeviceList(h.devices()))
+	case rdpdr.PacketDeviceReply:
+		deviceID, result, err := rdpdr.ParseDeviceReply(body)
+		if err != nil {
+			return err
+		}
+		logging.Debug("RDPDR: Device %d announce result 0x%08X", deviceID, result)
+	case rdpdr.PacketDeviceIORequest:
+		return h.handleIORequest(body)
+	default:
+		logging.Debug("RDPDR: Ignoring core packet 0x%04X", header.PacketID)
+	}
+
+	return nil
+}
+
+// handleServerAnnounce answers the Server Announce Request with the Client
+// Announce Reply and Client Name Request
+func (h *DeviceRedirectionHandler) handleServerAnnounce(body []byte) error {
+	announce, err := rdpdr.ParseAnnounce(body)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	h.clientID = announce.ClientID
+	h.ready = false
+	h.mu.Unlock()
+
+	logging.Debug("RDPDR: Server announce version=%d.%d clientId=%d",
+		announce.VersionMajor, announce.VersionMinor, announce.ClientID)
+
+	if err := h.send(rdpdr.PacketClientIDConfirm, rdpdr.NewAnnounceReply(announce).Serialize()); err != nil {
+		return err
+	}
+	return h.send(rdpdr.PacketClientName, rdpdr.SerializeClientName(deviceRedirectionClientName))
+}
+
+// handleServerCapability answers the Server Core Capability Request with the
+// client general capability
+func (h *DeviceRedirectionHandler) handleServerCapability(body []byte) error {
+	caps, err := rdpdr.ParseCapabilities(body)
+	if err != nil {
+		return err
+	}
+	logging.Debug("RDPDR: Server advertised %d capability set(s)", len(caps))
+
+	var extra []rdpdr.Capability
+	if h.drive != nil {
+		extra = append(extra, rdpdr.Capability{Type: rdpdr.CapTypeDrive, Version: rdpdr.DriveCapabilityVersion2})
+	}
+	return h.send(rdpdr.PacketClientCapability, rdpdr.NewClientGeneralCapability().SerializeCapabilities(extra...))
+}
+
+// handleClientIDConfirm completes the handshake by announcing an empty device list
+func (h *DeviceRedirectionHandler) handleClientIDConfirm(body []byte) error {
+	confirm, err := rdpdr.ParseAnnounce(body)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	h.clientID = confirm.ClientID
+	h.ready = true
+	h.mu.Unlock()
+
+	logging.Info("RDPDR: Channel ready")
+	return h.send(rdpdr.PacketDeviceListAnnounce, rdpdr.SerializeEmptyDeviceList())
+}
+
+// devices returns the devices announced after logon
+func (h *DeviceRedirectionHandler) devices() []rdpdr.DeviceAnnounce {
+	if h.drive == nil {
+		return nil
+	}
+	return []rdpdr.DeviceAnnounce{h.drive.announce()}
+}
+
+// handleIORequest serves a Device I/O Request addressed to the drive.
+// Requests for other devices are ignored.
+func (h *DeviceRedirectionHandler) handleIORequest(body []byte) error {
+	req, err := rdpdr.ParseIORequest(body)
+	if err != nil {
+		return err
+	}
+	if h.drive == nil || req.DeviceID != driveDeviceID {
+		logging.Debug("RDPDR: Ignoring I/O request for device %d", req.DeviceID)
+		return nil
+	}
+
+	completion := h.drive.handleIORequest(req)
+	if completion == nil {
+		return nil
+	}
+	return h.send(rdpdr.PacketDeviceIOCompletion, completion)
+}
+
+// send wraps an RDPDR core PDU in virtual channel chunks and sends it
+func (h *DeviceRedirectionHandler) send(packetID uint16, body []byte) error {
+	channelID, ok := h.client.channelIDMap[rdpdr.ChannelName]
+	if !ok {
+		logging.Warn("RDPDR: rdpdr channel not found")
+		return nil
+	}
+
+	for _, chunk := range buildChannelChunks(rdpdr.BuildPDU(packetID, body), h.client.vcChunkSize()) {
+		if err := h.client.mcsLayer.Send(h.client.userID, channelID, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// vcChunkSize returns the chunk size from the server's Virtual Channel
+// Capability Set, or CHANNEL_CHUNK_LENGTH if it did not advertise one
+func (c *Client) vcChunkSize() int {
+	for _, set := range c.serverCapabilitySets {
+		if set.VirtualChannelCapabilitySet != nil && set.VirtualChannelCapabilitySet.VCChunkSize > 0 {
+			return int(set.VirtualChannelCapabilitySet.VCChunkSize)
+		}
+	}
+	return defaultVCChunkSize
+}
+
+// EnableDeviceRedirection registers the rdpdr channel so the device
+// redirection handshake completes. No devices are redirected unless
+// SetDriveRedirection is called.
+func (c *Client) EnableDeviceRedirection() {
+	for _, ch := range c.channels {
+		if ch == rdpdr.ChannelName {
+			return
+		}
+	}
+	c.channels = append(c.channels, rdpdr.ChannelName)
+	c.deviceRedirection = NewDeviceRedirectionHandler(c)
+}
+
+// SetDriveRedirection redirects dir as a read-only drive named name, at
+// most 7 ASCII characters, and enables device redirection. Writes, creates
+// and deletes are rejected, and paths cannot leave dir.
+func (c *Client) SetDriveRedirection(dir, name string) error {
+	drive, err := newDriveDevice(dir, name)
+	if err != nil {
+		return err
+	}
+	c.EnableDeviceRedirection()
+	if previous := c.deviceRedirection.drive; previous != nil {
+		_ = previous.close()
+	}
+	c.deviceRedirection.drive = drive
+	return nil
+}
+
+// GetDeviceRedirectionHandler returns the device redirection handler
+func (c *Client) GetDeviceRedirectionHandler() *DeviceRedirectionHandler {
+	return c.deviceRedirection
+}
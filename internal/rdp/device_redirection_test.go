@@ -0,0 +1,152 @@
+package rdp
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcarmo/go-rdp/internal/protocol/audio"
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+	"github.com/rcarmo/go-rdp/internal/protocol/rdpdr"
+)
+
+// newDeviceRedirectionTestClient returns a client with the rdpdr channel
+// joined and a mock MCS layer recording what is sent.
+func newDeviceRedirectionTestClient() (*Client, *MockMCSLayer) {
+	mockMCS := &MockMCSLayer{}
+	client := &Client{
+		userID:       1001,
+		channelIDMap: map[string]uint16{rdpdr.ChannelName: 1009},
+		mcsLayer:     mockMCS,
+	}
+	client.EnableDeviceRedirection()
+	return client, mockMCS
+}
+
+// serverRDPDRPDU frames an RDPDR core PDU as a single virtual channel chunk.
+func serverRDPDRPDU(packetID uint16, body []byte) []byte {
+	return audio.BuildChannelData(rdpdr.BuildPDU(packetID, body))
+}
+
+type sentRDPDRPDU struct {
+	header rdpdr.Header
+	body   []byte
+}
+
+// sentRDPDRPDUs reassembles and decodes the RDPDR PDUs sent by the client.
+func sentRDPDRPDUs(t *testing.T, m *MockMCSLayer) []sentRDPDRPDU {
+	t.Helper()
+	var (
+		pdus   []sentRDPDRPDU
+		defrag audio.ChannelDefragmenter
+	)
+	for _, call := range m.SendCalls {
+		require.Equal(t, uint16(1009), call.ChannelID)
+		chunk, err := audio.ParseChannelData(call.Data)
+		require.NoError(t, err)
+		data, complete := defrag.Process(chunk)
+		if !complete {
+			continue
+		}
+		header, body, err := rdpdr.ParsePDU(data)
+		require.NoError(t, err)
+		pdus = append(pdus, sentRDPDRPDU{header, append([]byte(nil), body...)})
+	}
+	return pdus
+}
+
+func TestEnableDeviceRedirection(t *testing.T) {
+	client := &Client{}
+	client.EnableDeviceRedirection()
+	client.EnableDeviceRedirection()
+
+	assert.Equal(t, []string{rdpdr.ChannelName}, client.channels)
+	require.NotNil(t, client.GetDeviceRedirectionHandler())
+	assert.Nil(t, (&Client{}).GetDeviceRedirectionHandler())
+}
+
+func TestDeviceRedirectionHandler_Handshake(t *testing.T) {
+	client, mockMCS := newDeviceRedirectionTestClient()
+	h := client.GetDeviceRedirectionHandler()
+
+	// Server Announce Request
+	announce := rdpdr.Announce{VersionMajor: 1, VersionMinor: 0x000D, ClientID: 7}
+	require.NoError(t, h.HandleChannelData(serverRDPDRPDU(rdpdr.PacketServerAnnounce, announce.Serialize())))
+	assert.False(t, h.IsReady())
+
+	sent := sentRDPDRPDUs(t, mockMCS)
+	require.Len(t, sent, 2)
+	assert.Equal(t, rdpdr.Header{Component: rdpdr.ComponentCore, PacketID: rdpdr.PacketClientIDConfirm}, sent[0].header)
+	reply, err := rdpdr.ParseAnnounce(sent[0].body)
+	require.NoError(t, err)
+	assert.Equal(t, rdpdr.Announce{VersionMajor: 1, VersionMinor: rdpdr.VersionMinor, ClientID: 7}, *reply)
+	assert.Equal(t, rdpdr.PacketClientName, sent[1].header.PacketID)
+
+	// Server Core Capability Request with a general and a smartcard capability
+	serverCaps := []byte{0x02, 0x00, 0x00, 0x00}
+	serverCaps = append(serverCaps, rdpdr.NewClientGeneralCapability().SerializeCapabilities()[4:]...)
+	serverCaps = append(serverCaps, 0x05, 0x00, 0x08, 0x00, 0x01, 0x00, 0x00, 0x00)
+	mockMCS.SendCalls = nil
+	require.NoError(t, h.HandleChannelData(serverRDPDRPDU(rdpdr.PacketServerCapability, serverCaps)))
+
+	sent = sentRDPDRPDUs(t, mockMCS)
+	require.Len(t, sent, 1)
+	assert.Equal(t, rdpdr.PacketClientCapability, sent[0].header.PacketID)
+	caps, err := rdpdr.ParseCapabilities(sent[0].body)
+	require.NoError(t, err)
+	require.Len(t, caps, 1)
+	assert.Equal(t, rdpdr.CapTypeGeneral, caps[0].Type)
+
+	// Server Client ID Confirm completes the handshake with an empty device list
+	mockMCS.SendCalls = nil
+	require.NoError(t, h.HandleChannelData(serverRDPDRPDU(rdpdr.PacketClientIDConfirm, announce.Serialize())))
+	assert.True(t, h.IsReady())
+
+	sent = sentRDPDRPDUs(t, mockMCS)
+	require.Len(t, sent, 1)
+	assert.Equal(t, rdpdr.PacketDeviceListAnnounce, sent[0].header.PacketID)
+	assert.Equal(t, uint32(0), binary.LittleEndian.Uint32(sent[0].body), "no devices")
+
+	// The device list is announced again after logon
+	mockMCS.SendCalls = nil
+	require.NoError(t, h.HandleChannelData(serverRDPDRPDU(rdpdr.PacketUserLoggedOn, nil)))
+	sent = sentRDPDRPDUs(t, mockMCS)
+	require.Len(t, sent, 1)
+	assert.Equal(t, rdpdr.PacketDeviceListAnnounce, sent[0].header.PacketID)
+}
+
+func TestDeviceRedirectionHandler_IgnoresOtherPackets(t *testing.T) {
+	client, mockMCS := newDeviceRedirectionTestClient()
+	h := client.GetDeviceRedirectionHandler()
+
+	// Printer component packets and unexpected core packets are ignored
+	printer := []byte{0x52, 0x50, 0x43, 0x50}
+	require.NoError(t, h.HandleChannelData(audio.BuildChannelData(printer)))
+	require.NoError(t, h.HandleChannelData(serverRDPDRPDU(rdpdr.PacketDeviceIORequest, make([]byte, 20))))
+	assert.Empty(t, mockMCS.SendCalls)
+
+	assert.Error(t, h.HandleChannelData(serverRDPDRPDU(rdpdr.PacketServerAnnounce, []byte{1, 0})))
+	assert.Error(t, h.HandleChannelData(audio.BuildChannelData([]byte{0x72})))
+}
+
+func TestDeviceRedirectionHandler_UsesServerChunkSize(t *testing.T) {
+	client, mockMCS := newDeviceRedirectionTestClient()
+	client.serverCapabilitySets = []pdu.CapabilitySet{{
+		CapabilitySetType:           pdu.CapabilitySetTypeVirtualChannel,
+		VirtualChannelCapabilitySet: &pdu.VirtualChannelCapabilitySet{VCChunkSize: 16},
+	}}
+	h := client.GetDeviceRedirectionHandler()
+
+	// The 52-byte capability response is split into 16-byte chunks
+	caps := []byte{0x00, 0x00, 0x00, 0x00}
+	require.NoError(t, h.HandleChannelData(serverRDPDRPDU(rdpdr.PacketServerCapability, caps)))
+	assert.Len(t, mockMCS.SendCalls, 4)
+
+	sent := sentRDPDRPDUs(t, mockMCS)
+	require.Len(t, sent, 1)
+	assert.Equal(t, rdpdr.PacketClientCapability, sent[0].header.PacketID)
+
+	assert.Equal(t, defaultVCChunkSize, (&Client{}).vcChunkSize())
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/rcarmo/go-rdp/internal/logging"
 	"github.com/rcarmo/go-rdp/internal/protocol/drdynvc"
 	"github.com/rcarmo/go-rdp/internal/protocol/rdpedisp"
 )
@@ -222,15 +223,16 @@ func (h *DisplayControlHandler) RequestResize(width, height uint32) error {
 		return nil
 	}
 
-	// Validate against server capabilities
+	// Clamp to the sizes the server accepts
+	var maxArea uint64
 	if h.caps != nil {
-		maxArea := h.caps.MaxMonitorAreaSize
-		if maxArea > 0 && uint64(width)*uint64(height) > uint64(maxArea) {
-			h.mu.Unlock()
-			return fmt.Errorf("requested resolution %dx%d exceeds server max area %d", width, height, maxArea)
-		}
+		maxArea = h.caps.MaxMonitorArea()
 	}
-	
+	if w, ht := rdpedisp.ClampMonitorSize(width, height, maxArea); w != width || ht != height {
+		logging.Debug("Display control: clamped resize %dx%d to %dx%d", width, height, w, ht)
+		width, height = w, ht
+	}
+
 	dispChannelID := h.dispChannelID
 	h.mu.Unlock()
 
@@ -0,0 +1,335 @@
+package rdp
+
+import (
+	"encoding/binary"
+
+	"github.com/rcarmo/go-rdp/internal/logging"
+	"github.com/rcarmo/go-rdp/internal/protocol/fastpath"
+	"github.com/rcarmo/go-rdp/internal/protocol/orders"
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+)
+
+// DrawingOpsMarker starts a message of drawing operations, the OpaqueRect
+// and ScrBlt orders translated for the browser:
+//
+//	[0xF8] [count:2] [operations...]
+//	fill: [0x01] [left:2] [top:2] [width:2] [height:2] [r] [g] [b]
+//	copy: [0x02] [srcX:2] [srcY:2] [left:2] [top:2] [width:2] [height:2]
+//
+// Values are little-endian and already clipped to the order bounds. Its
+// compression bits are set, so it is never mistaken for a TS_FP_UPDATE.
+const DrawingOpsMarker = 0xF8
+
+// Drawing operation codes of a DrawingOpsMarker message
+const (
+	drawOpFill = 0x01
+	drawOpCopy = 0x02
+)
+
+// Fragmentation values of a TS_FP_UPDATE header (MS-RDPBCGR 2.2.9.1.2.1)
+const (
+	fragmentSingle = 0x0
+	fragmentLast   = 0x1
+	fragmentFirst  = 0x2
+	fragmentNext   = 0x3
+)
+
+// maxBitmapUpdateSize is the largest payload of one TS_FP_UPDATE
+const maxBitmapUpdateSize = 0xFFFF
+
+// maxDrawingOps is the largest number of operations in one message
+const maxDrawingOps = 0xFFFF
+
+// drawingOrders decodes the orders updates of a connection and turns the
+// orders it can render into updates for the browser: MemBlt orders drawn
+// from the bitmap cache become bitmap updates, and OpaqueRect and ScrBlt
+// orders become drawing operations. Output keeps the order of the orders.
+type drawingOrders struct {
+	decoder *orders.Decoder
+
+	// cache renders MemBlt orders, when the bitmap cache is enabled
+	cache *bitmapCache
+
+	// primitives enables the OpaqueRect and ScrBlt orders
+	primitives bool
+
+	// colorDepth is the session color depth OpaqueRect colors are read in
+	colorDepth int
+
+	// fragments reassembles an orders update split across TS_FP_UPDATEs
+	fragments []byte
+
+	// rects holds the TS_BITMAP_DATA and ops the drawing operations not yet
+	// packed into updates; at most one of them is non-empty
+	rects [][]byte
+	ops   [][]byte
+
+	// updates holds the updates produced by the orders being decoded
+	updates []*Update
+}
+
+func newDrawingOrders() *drawingOrders {
+	return &drawingOrders{decoder: orders.NewDecoder(), colorDepth: 32}
+}
+
+// enableOrders returns the client's drawing order pipeline, creating it
+// if needed
+func (c *Client) enableOrders() *drawingOrders {
+	if c.drawingOrders == nil {
+		c.drawingOrders = newDrawingOrders()
+	}
+	return c.drawingOrders
+}
+
+// EnableDrawingOrders advertises the OpaqueRect and ScrBlt orders and
+// forwards them to the browser as drawing operations. It must be called
+// before Connect.
+func (c *Client) EnableDrawingOrders() {
+	c.enableOrders().primitives = true
+}
+
+// confirmActiveCapabilities enables the supported orders in the client's
+// capability sets. colorDepth is the server's preferred color depth, or 0
+// when it sent none.
+func (d *drawingOrders) confirmActiveCapabilities(sets []pdu.CapabilitySet, colorDepth int) {
+	if colorDepth != 0 {
+		d.colorDepth = colorDepth
+	}
+	if d.cache != nil {
+		d.cache.confirmActiveCapabilities(sets)
+	}
+	if !d.primitives {
+		return
+	}
+	for _, set := range sets {
+		if set.OrderCapabilitySet != nil {
+			set.OrderCapabilitySet.OrderSupport[pdu.OrderSupportOpaqueRectIndex] = 1
+			set.OrderCapabilitySet.OrderSupport[pdu.OrderSupportScrBltIndex] = 1
+		}
+	}
+}
+
+// CacheBitmap stores a bitmap in the bitmap cache
+func (d *drawingOrders) CacheBitmap(o *orders.CacheBitmapRev2) {
+	if d.cache != nil {
+		d.cache.cacheBitmap(o)
+	}
+}
+
+// MemBlt draws part of a cached bitmap as a TS_BITMAP_DATA
+func (d *drawingOrders) MemBlt(o *orders.MemBlt) {
+	if d.cache == nil {
+		return
+	}
+	if rect := d.cache.memBlt(o); rect != nil {
+		d.flushOps()
+		d.rects = append(d.rects, rect)
+	}
+}
+
+// OpaqueRect fills a rectangle with a solid color
+func (d *drawingOrders) OpaqueRect(o *orders.OpaqueRect) {
+	if !d.primitives {
+		return
+	}
+	r, g, b, ok := d.color(o.Color)
+	if !ok {
+		logging.Debug("Drawing orders: OpaqueRect at %d bpp not supported", d.colorDepth)
+		return
+	}
+	left, top, width, height, ok := clipOrder(int(o.Left), int(o.Top), int(o.Width), int(o.Height), o.Bounds)
+	if !ok {
+		return
+	}
+
+	op := make([]byte, 1, 12)
+	op[0] = drawOpFill
+	op = binary.LittleEndian.AppendUint16(op, uint16(left))   // #nosec G115
+	op = binary.LittleEndian.AppendUint16(op, uint16(top))    // #nosec G115
+	op = binary.LittleEndian.AppendUint16(op, uint16(width))  // #nosec G115
+	op = binary.LittleEndian.AppendUint16(op, uint16(height)) // #nosec G115
+	op = append(op, r, g, b)
+	d.addOp(op)
+}
+
+// ScrBlt copies a rectangle of the screen to another position
+func (d *drawingOrders) ScrBlt(o *orders.ScrBlt) {
+	if !d.primitives {
+		return
+	}
+	if o.Rop != ropSrcCopy {
+		logging.Debug("Drawing orders: ScrBlt raster operation 0x%02X not supported", o.Rop)
+		return
+	}
+	left, top, width, height, ok := clipOrder(int(o.Left), int(o.Top), int(o.Width), int(o.Height), o.Bounds)
+	if !ok {
+		return
+	}
+	// Clipping the destination moves the source by as much
+	srcX, srcY := int(o.SrcX)+left-int(o.Left), int(o.SrcY)+top-int(o.Top)
+
+	op := make([]byte, 1, 13)
+	op[0] = drawOpCopy
+	op = binary.LittleEndian.AppendUint16(op, uint16(srcX))   // #nosec G115
+	op = binary.LittleEndian.AppendUint16(op, uint16(srcY))   // #nosec G115
+	op = binary.LittleEndian.AppendUint16(op, uint16(left))   // #nosec G115
+	op = binary.LittleEndian.AppendUint16(op, uint16(top))    // #nosec G115
+	op = binary.LittleEndian.AppendUint16(op, uint16(width))  // #nosec G115
+	op = binary.LittleEndian.AppendUint16(op, uint16(height)) // #nosec G115
+	d.addOp(op)
+}
+
+// addOp queues a drawing operation after any pending bitmap rectangles
+func (d *drawingOrders) addOp(op []byte) {
+	d.flushRects()
+	d.ops = append(d.ops, op)
+	if len(d.ops) == maxDrawingOps {
+		d.flushOps()
+	}
+}
+
+// color converts an OpaqueRect color to RGB at the session color depth.
+// Palette colors (8 bpp) are not supported.
+func (d *drawingOrders) color(c [3]uint8) (r, g, b uint8, ok bool) {
+	v := uint16(c[0]) | uint16(c[1])<<8
+	switch d.colorDepth {
+	case 15:
+		r, g, b = uint8(v>>10&0x1F), uint8(v>>5&0x1F), uint8(v&0x1F)
+		return r<<3 | r>>2, g<<3 | g>>2, b<<3 | b>>2, true
+	case 16:
+		r, g, b = uint8(v>>11&0x1F), uint8(v>>5&0x3F), uint8(v&0x1F)
+		return r<<3 | r>>2, g<<2 | g>>4, b<<3 | b>>2, true
+	case 24, 32:
+		return c[0], c[1], c[2], true
+	}
+	return 0, 0, 0, false
+}
+
+// clipOrder clips an order's destination rectangle to its bounds and to
+// the top-left corner of the screen, reporting false when nothing is left
+func clipOrder(left, top, width, height int, bounds *orders.Rect) (int, int, int, int, bool) {
+	right, bottom := left+width-1, top+height-1
+	left, top = max(left, 0), max(top, 0)
+	if bounds != nil {
+		left, top = max(left, int(bounds.Left)), max(top, int(bounds.Top))
+		right, bottom = min(right, int(bounds.Right)), min(bottom, int(bounds.Bottom))
+	}
+	if left > right || top > bottom {
+		return 0, 0, 0, 0, false
+	}
+	return left, top, right - left + 1, bottom - top + 1, true
+}
+
+// decodeOrders runs the orders of a TS_UPDATE_ORDERS payload and returns
+// the updates they produced
+func (d *drawingOrders) decodeOrders(payload []byte) []*Update {
+	if len(payload) < 2 {
+		return nil
+	}
+	count := int(binary.LittleEndian.Uint16(payload))
+	if err := d.decoder.Decode(payload[2:], count, d); err != nil {
+		logging.Debug("Drawing orders: %v", err)
+	}
+	d.flushRects()
+	d.flushOps()
+	updates := d.updates
+	d.updates = nil
+	return updates
+}
+
+// flushRects packs the pending TS_BITMAP_DATA into as few bitmap updates as
+// fit within a TS_FP_UPDATE each
+func (d *drawingOrders) flushRects() {
+	for len(d.rects) > 0 {
+		size, count := 4, 0
+		for count < len(d.rects) && size+len(d.rects[count]) <= maxBitmapUpdateSize {
+			size += len(d.rects[count])
+			count++
+		}
+
+		data := make([]byte, 0, 3+size)
+		data = append(data, byte(fastpath.UpdateCodeBitmap))
+		data = binary.LittleEndian.AppendUint16(data, uint16(size)) // #nosec G115
+		data = binary.LittleEndian.AppendUint16(data, SlowPathUpdateTypeBitmap)
+		data = binary.LittleEndian.AppendUint16(data, uint16(count)) // #nosec G115
+		for _, rect := range d.rects[:count] {
+			data = append(data, rect...)
+		}
+		d.updates = append(d.updates, &Update{Data: data})
+		d.rects = d.rects[count:]
+	}
+	d.rects = nil
+}
+
+// flushOps packs the pending drawing operations into one message
+func (d *drawingOrders) flushOps() {
+	if len(d.ops) == 0 {
+		return
+	}
+	size := 3
+	for _, op := range d.ops {
+		size += len(op)
+	}
+	data := make([]byte, 0, size)
+	data = append(data, DrawingOpsMarker)
+	data = binary.LittleEndian.AppendUint16(data, uint16(len(d.ops))) // #nosec G115
+	for _, op := range d.ops {
+		data = append(data, op...)
+	}
+	d.updates = append(d.updates, &Update{Data: data})
+	d.ops = nil
+}
+
+// applyFastPath replaces the orders updates in the data of a fast-path update
+// PDU with the updates their orders draw. When the PDU holds an orders
+// update, every TS_FP_UPDATE is returned as its own Update.
+func (d *drawingOrders) applyFastPath(data []byte) ([]*Update, error) {
+	if !hasOrdersUpdate(data) {
+		return []*Update{{Data: data}}, nil
+	}
+
+	var updates []*Update
+	for i := 0; i < len(data); {
+		if i+3 > len(data) {
+			return nil, fastpath.ErrMalformedUpdate
+		}
+		header := data[i]
+		size := int(binary.LittleEndian.Uint16(data[i+1:]))
+		if i+3+size > len(data) {
+			return nil, fastpath.ErrMalformedUpdate
+		}
+		payload := data[i+3 : i+3+size]
+		next := i + 3 + size
+
+		if fastpath.UpdateCode(header&0x0F) != fastpath.UpdateCodeOrders {
+			updates = append(updates, &Update{Data: data[i:next]})
+			i = next
+			continue
+		}
+		i = next
+
+		switch (header >> 4) & 0x3 {
+		case fragmentSingle:
+			updates = append(updates, d.decodeOrders(payload)...)
+		case fragmentFirst:
+			d.fragments = append(d.fragments[:0], payload...)
+		case fragmentNext:
+			d.fragments = append(d.fragments, payload...)
+		case fragmentLast:
+			d.fragments = append(d.fragments, payload...)
+			updates = append(updates, d.decodeOrders(d.fragments)...)
+			d.fragments = d.fragments[:0]
+		}
+	}
+	return updates, nil
+}
+
+// hasOrdersUpdate reports whether any TS_FP_UPDATE in data is an orders update
+func hasOrdersUpdate(data []byte) bool {
+	for i := 0; i+3 <= len(data); i += 3 + int(binary.LittleEndian.Uint16(data[i+1:])) {
+		if fastpath.UpdateCode(data[i]&0x0F) == fastpath.UpdateCodeOrders {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package rdp
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+)
+
+// primitiveOrders fills (10,20) 32x16 in red, copies (0,0) 8x8 to (50,60)
+// clipped to a right bound of 53, skips a ScrBlt it cannot render, then fills
+// again at a delta position
+func primitiveOrders() []byte {
+	return []byte{
+		0x04, 0x00, // numberOrders
+
+		0x09, 0x0A, 0x7F, // OpaqueRect with all fields
+		0x0A, 0x00, 0x14, 0x00, 0x20, 0x00, 0x10, 0x00,
+		0xFF, 0x00, 0x00,
+
+		0x0D, 0x02, 0x7F, // ScrBlt with all fields and bounds
+		0x0F,                   // absolute bounds
+		0x00, 0x00, 0x00, 0x00, // left 0, top 0
+		0x35, 0x00, 0x64, 0x00, // right 53, bottom 100
+		0x32, 0x00, 0x3C, 0x00, 0x08, 0x00, 0x08, 0x00,
+		0xCC,
+		0x00, 0x00, 0x00, 0x00,
+
+		0x09, 0x02, 0x10, 0x66, // ScrBlt with another raster operation
+
+		0x19, 0x0A, 0x01, 0x02, // OpaqueRect, left += 2
+	}
+}
+
+func TestDrawingOrders_DecodeOrders(t *testing.T) {
+	d := newDrawingOrders()
+	d.primitives = true
+
+	updates := d.decodeOrders(primitiveOrders())
+	require.Len(t, updates, 1)
+	assert.Equal(t, []byte{
+		DrawingOpsMarker, 0x03, 0x00,
+		drawOpFill, 0x0A, 0x00, 0x14, 0x00, 0x20, 0x00, 0x10, 0x00, 0xFF, 0x00, 0x00,
+		drawOpCopy, 0x00, 0x00, 0x00, 0x00, 0x32, 0x00, 0x3C, 0x00, 0x04, 0x00, 0x08, 0x00,
+		drawOpFill, 0x0C, 0x00, 0x14, 0x00, 0x20, 0x00, 0x10, 0x00, 0xFF, 0x00, 0x00,
+	}, updates[0].Data)
+}
+
+func TestDrawingOrders_DisabledPrimitives(t *testing.T) {
+	d := newDrawingOrders()
+	assert.Empty(t, d.decodeOrders(primitiveOrders()))
+}
+
+func TestDrawingOrders_KeepsOrderWithCachedBitmaps(t *testing.T) {
+	d := newCachedDrawingOrders()
+	d.primitives = true
+
+	// Fill, then the cached bitmap orders, then another fill
+	fill := primitiveOrders()[2:16]
+	cached := cachedBitmapOrders()
+	payload := binary.LittleEndian.AppendUint16(nil, 5)
+	payload = append(payload, fill...)
+	payload = append(payload, cached[2:]...)
+	payload = append(payload, 0x09, 0x0A, 0x01, 0x0B, 0x00) // OpaqueRect, left 11
+
+	updates := d.decodeOrders(payload)
+	require.Len(t, updates, 3)
+	assert.Equal(t, byte(DrawingOpsMarker), updates[0].Data[0])
+	assert.Equal(t, expectedBitmapUpdate, updates[1].Data)
+	assert.Equal(t, []byte{
+		DrawingOpsMarker, 0x01, 0x00,
+		drawOpFill, 0x0B, 0x00, 0x14, 0x00, 0x20, 0x00, 0x10, 0x00, 0xFF, 0x00, 0x00,
+	}, updates[2].Data)
+}
+
+func TestDrawingOrders_Color(t *testing.T) {
+	tests := []struct {
+		depth   int
+		color   [3]uint8
+		r, g, b uint8
+		ok      bool
+	}{
+		{32, [3]uint8{0x12, 0x34, 0x56}, 0x12, 0x34, 0x56, true},
+		{24, [3]uint8{0x12, 0x34, 0x56}, 0x12, 0x34, 0x56, true},
+		{16, [3]uint8{0x1F, 0xF8, 0x00}, 0xFF, 0x00, 0xFF, true}, // 0xF81F
+		{16, [3]uint8{0xE0, 0x07, 0x00}, 0x00, 0xFF, 0x00, true}, // 0x07E0
+		{15, [3]uint8{0x00, 0x7C, 0x00}, 0xFF, 0x00, 0x00, true}, // 0x7C00
+		{8, [3]uint8{0x05, 0x00, 0x00}, 0, 0, 0, false},
+	}
+	for _, tt := range tests {
+		d := &drawingOrders{colorDepth: tt.depth}
+		r, g, b, ok := d.color(tt.color)
+		assert.Equal(t, tt.ok, ok, "%d bpp", tt.depth)
+		assert.Equal(t, []uint8{tt.r, tt.g, tt.b}, []uint8{r, g, b}, "%d bpp", tt.depth)
+	}
+}
+
+func TestDrawingOrders_ConfirmActiveCapabilities(t *testing.T) {
+	client := &Client{}
+	client.EnableDrawingOrders()
+	assert.Nil(t, client.bitmapCache)
+
+	req := pdu.NewClientConfirmActive(1, 1001, 1024, 768, false)
+	client.drawingOrders.confirmActiveCapabilities(req.CapabilitySets, 16)
+	assert.Equal(t, 16, client.drawingOrders.colorDepth)
+
+	for _, set := range req.CapabilitySets {
+		assert.Nil(t, set.BitmapCacheCapabilitySetRev2)
+		if set.OrderCapabilitySet != nil {
+			support := set.OrderCapabilitySet.OrderSupport
+			assert.Equal(t, byte(1), support[pdu.OrderSupportOpaqueRectIndex])
+			assert.Equal(t, byte(1), support[pdu.OrderSupportScrBltIndex])
+			assert.Zero(t, support[pdu.OrderSupportMemBltIndex])
+		}
+	}
+
+	// The bitmap cache shares the pipeline
+	client.EnableBitmapCache()
+	assert.Same(t, client.bitmapCache, client.drawingOrders.cache)
+	assert.True(t, client.drawingOrders.primitives)
+}
@@ -0,0 +1,374 @@
+package rdp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/rcarmo/go-rdp/internal/logging"
+	"github.com/rcarmo/go-rdp/internal/protocol/rdpdr"
+)
+
+// driveDeviceID is the device ID of the redirected drive
+const driveDeviceID uint32 = 1
+
+// driveMaxRead caps the data returned by one read request
+const driveMaxRead = 1 << 20
+
+// driveDevice serves a read-only file system device backed by a directory.
+// All access goes through an os.Root, so paths from the server cannot leave
+// the directory, not even through symbolic links.
+type driveDevice struct {
+	name string
+	root *os.Root
+
+	mu         sync.Mutex
+	nextFileID uint32
+	files      map[uint32]*driveFile
+}
+
+// driveFile is a file or directory opened by a create request
+type driveFile struct {
+	name string // slash-separated path relative to the root, "." for the root
+	file *os.File
+	dir  bool
+
+	// entries holds the matches of the last initial directory query and
+	// next the index of the entry to return next
+	entries []fs.DirEntry
+	next    int
+}
+
+// newDriveDevice opens dir as a read-only drive named name
+func newDriveDevice(dir, name string) (*driveDevice, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, fmt.Errorf("drive root: %w", err)
+	}
+	return &driveDevice{
+		name:  strings.ToUpper(name),
+		root:  root,
+		files: make(map[uint32]*driveFile),
+	}, nil
+}
+
+// announce returns the device announce of the drive
+func (d *driveDevice) announce() rdpdr.DeviceAnnounce {
+	return rdpdr.DeviceAnnounce{
+		DeviceType:       rdpdr.DeviceTypeFilesystem,
+		DeviceID:         driveDeviceID,
+		PreferredDosName: d.name,
+	}
+}
+
+// close closes every open file and the root
+func (d *driveDevice) close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for id, f := range d.files {
+		_ = f.file.Close()
+		delete(d.files, id)
+	}
+	return d.root.Close()
+}
+
+// handleIORequest serves one I/O request and returns the body of its
+// completion, or nil when the request stays pending
+func (d *driveDevice) handleIORequest(req *rdpdr.IORequest) []byte {
+	switch req.MajorFunction {
+	case rdpdr.IRPCreate:
+		return d.create(req)
+	case rdpdr.IRPClose:
+		return d.closeFile(req)
+	case rdpdr.IRPRead:
+		return d.read(req)
+	case rdpdr.IRPQueryInformation:
+		return d.queryInformation(req)
+	case rdpdr.IRPQueryVolumeInformation:
+		return d.queryVolumeInformation(req)
+	case rdpdr.IRPDirectoryControl:
+		switch req.MinorFunction {
+		case rdpdr.IRPQueryDirectory:
+			return d.queryDirectory(req)
+		case rdpdr.IRPNotifyChangeDirectory:
+			// A read-only drive never changes, so the notification stays pending
+			return nil
+		}
+	case rdpdr.IRPWrite, rdpdr.IRPSetInformation, rdpdr.IRPSetVolumeInformation:
+		return req.SerializeIOFailure(rdpdr.StatusMediaWriteProtected)
+	}
+
+	logging.Debug("RDPDR: Unsupported drive request major=0x%X minor=0x%X", req.MajorFunction, req.MinorFunction)
+	return req.SerializeIOFailure(rdpdr.StatusNotSupported)
+}
+
+func (d *driveDevice) create(req *rdpdr.IORequest) []byte {
+	create, err := rdpdr.ParseCreateRequest(req.Body)
+	if err != nil {
+		return req.SerializeIOFailure(rdpdr.StatusInvalidParameter)
+	}
+
+	name, ok := drivePath(create.Path)
+	if !ok {
+		logging.Warn("RDPDR: Rejected drive path %q outside the root", create.Path)
+		return req.SerializeIOFailure(rdpdr.StatusAccessDenied)
+	}
+
+	if create.DesiredAccess&rdpdr.AccessWriteMask != 0 || create.CreateOptions&rdpdr.FileDeleteOnClose != 0 {
+		return req.SerializeIOFailure(rdpdr.StatusMediaWriteProtected)
+	}
+	if create.CreateDisposition != rdpdr.FileOpen && create.CreateDisposition != rdpdr.FileOpenIf {
+		return req.SerializeIOFailure(rdpdr.StatusMediaWriteProtected)
+	}
+
+	file, err := d.root.Open(name)
+	if err != nil {
+		return req.SerializeIOFailure(driveOpenStatus(err, create.CreateDisposition))
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return req.SerializeIOFailure(rdpdr.StatusUnsuccessful)
+	}
+
+	switch {
+	case info.IsDir() && create.CreateOptions&rdpdr.FileNonDirectoryFile != 0:
+		_ = file.Close()
+		return req.SerializeIOFailure(rdpdr.StatusFileIsADirectory)
+	case !info.IsDir() && create.CreateOptions&rdpdr.FileDirectoryFile != 0:
+		_ = file.Close()
+		return req.SerializeIOFailure(rdpdr.StatusNotADirectory)
+	}
+
+	d.mu.Lock()
+	d.nextFileID++
+	fileID := d.nextFileID
+	d.files[fileID] = &driveFile{name: name, file: file, dir: info.IsDir()}
+	d.mu.Unlock()
+
+	return req.SerializeIOCompletion(rdpdr.StatusSuccess, rdpdr.SerializeCreateResponse(fileID, rdpdr.FileOpened))
+}
+
+// driveOpenStatus maps an open error to an NTSTATUS. Files that do not
+// exist cannot be created by FILE_OPEN_IF on a read-only drive.
+func driveOpenStatus(err error, disposition uint32) uint32 {
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && disposition == rdpdr.FileOpenIf:
+		return rdpdr.StatusMediaWriteProtected
+	case errors.Is(err, fs.ErrNotExist):
+		return rdpdr.StatusObjectNameNotFound
+	default:
+		// Includes paths escaping the root through symbolic links
+		return rdpdr.StatusAccessDenied
+	}
+}
+
+func (d *driveDevice) closeFile(req *rdpdr.IORequest) []byte {
+	d.mu.Lock()
+	f, ok := d.files[req.FileID]
+	delete(d.files, req.FileID)
+	d.mu.Unlock()
+
+	if !ok {
+		return req.SerializeIOFailure(rdpdr.StatusInvalidHandle)
+	}
+	_ = f.file.Close()
+	return req.SerializeIOCompletion(rdpdr.StatusSuccess, make([]byte, 5))
+}
+
+func (d *driveDevice) read(req *rdpdr.IORequest) []byte {
+	read, err := rdpdr.ParseReadRequest(req.Body)
+	if err != nil || read.Offset > math.MaxInt64 {
+		return req.SerializeIOFailure(rdpdr.StatusInvalidParameter)
+	}
+
+	f := d.file(req.FileID)
+	if f == nil {
+		return req.SerializeIOFailure(rdpdr.StatusInvalidHandle)
+	}
+	if f.dir {
+		return req.SerializeIOFailure(rdpdr.StatusInvalidDeviceRequest)
+	}
+
+	buf := make([]byte, min(int(read.Length), driveMaxRead))
+	n, err := f.file.ReadAt(buf, int64(read.Offset)) // #nosec G115 -- checked above
+	if err != nil && !errors.Is(err, io.EOF) {
+		return req.SerializeIOFailure(rdpdr.StatusUnsuccessful)
+	}
+	return req.SerializeIOCompletion(rdpdr.StatusSuccess, rdpdr.SerializeLengthResponse(buf[:n]))
+}
+
+func (d *driveDevice) queryInformation(req *rdpdr.IORequest) []byte {
+	class, err := rdpdr.ParseQueryInformationRequest(req.Body)
+	if err != nil {
+		return req.SerializeIOFailure(rdpdr.StatusInvalidParameter)
+	}
+
+	f := d.file(req.FileID)
+	if f == nil {
+		return req.SerializeIOFailure(rdpdr.StatusInvalidHandle)
+	}
+	info, err := f.file.Stat()
+	if err != nil {
+		return req.SerializeIOFailure(rdpdr.StatusUnsuccessful)
+	}
+
+	data, err := rdpdr.EncodeFileInformation(class, driveFileInfo(info))
+	if err != nil {
+		return req.SerializeIOFailure(rdpdr.StatusNotSupported)
+	}
+	return req.SerializeIOCompletion(rdpdr.StatusSuccess, rdpdr.SerializeLengthResponse(data))
+}
+
+func (d *driveDevice) queryVolumeInformation(req *rdpdr.IORequest) []byte {
+	class, err := rdpdr.ParseQueryInformationRequest(req.Body)
+	if err != nil {
+		return req.SerializeIOFailure(rdpdr.StatusInvalidParameter)
+	}
+
+	data, err := rdpdr.EncodeVolumeInformation(class, d.name)
+	if err != nil {
+		return req.SerializeIOFailure(rdpdr.StatusNotSupported)
+	}
+	return req.SerializeIOCompletion(rdpdr.StatusSuccess, rdpdr.SerializeLengthResponse(data))
+}
+
+// queryDirectory returns one directory entry per request. An initial query
+// lists the directory of the open handle and keeps the entries matching the
+// final component of its path; later queries continue through them.
+func (d *driveDevice) queryDirectory(req *rdpdr.IORequest) []byte {
+	query, err := rdpdr.ParseQueryDirectoryRequest(req.Body)
+	if err != nil {
+		return req.SerializeIOFailure(rdpdr.StatusInvalidParameter)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	f := d.files[req.FileID]
+	if f == nil {
+		return req.SerializeIOFailure(rdpdr.StatusInvalidHandle)
+	}
+	if !f.dir {
+		return req.SerializeIOFailure(rdpdr.StatusNotADirectory)
+	}
+
+	if query.InitialQuery {
+		entries, err := fs.ReadDir(d.root.FS(), f.name)
+		if err != nil {
+			return req.SerializeIOFailure(rdpdr.StatusAccessDenied)
+		}
+		pattern := query.Path[strings.LastIndex(query.Path, `\`)+1:]
+		f.entries, f.next = f.entries[:0], 0
+		for _, entry := range entries {
+			if matchWildcard(pattern, entry.Name()) {
+				f.entries = append(f.entries, entry)
+			}
+		}
+		if len(f.entries) == 0 {
+			return req.SerializeIOFailure(rdpdr.StatusNoSuchFile)
+		}
+	}
+
+	for f.next < len(f.entries) {
+		entry := f.entries[f.next]
+		f.next++
+
+		info, err := entry.Info()
+		if err != nil {
+			continue // removed since the listing
+		}
+		data, err := rdpdr.EncodeDirectoryInformation(query.InformationClass, driveFileInfo(info))
+		if err != nil {
+			return req.SerializeIOFailure(rdpdr.StatusNotSupported)
+		}
+		return req.SerializeIOCompletion(rdpdr.StatusSuccess, rdpdr.SerializeLengthResponse(data))
+	}
+	return req.SerializeIOFailure(rdpdr.StatusNoMoreFiles)
+}
+
+// file returns the open file with id, or nil
+func (d *driveDevice) file(id uint32) *driveFile {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.files[id]
+}
+
+// driveFileInfo describes info for the information class encoders. Every
+// file is read-only and dot files are hidden.
+func driveFileInfo(info fs.FileInfo) *rdpdr.FileInfo {
+	attributes := rdpdr.FileAttributeReadOnly | rdpdr.FileAttributeArchive
+	if info.IsDir() {
+		attributes = rdpdr.FileAttributeDirectory
+	}
+	if strings.HasPrefix(info.Name(), ".") {
+		attributes |= rdpdr.FileAttributeHidden
+	}
+
+	size := info.Size()
+	if info.IsDir() {
+		size = 0
+	}
+	return &rdpdr.FileInfo{
+		Name:       info.Name(),
+		Size:       size,
+		ModTime:    info.ModTime(),
+		Attributes: attributes,
+	}
+}
+
+// drivePath converts a path from the server, such as \dir\file.txt, into a
+// slash-separated path relative to the drive root. Paths with ".." or
+// stream and drive separators are rejected rather than resolved.
+func drivePath(p string) (string, bool) {
+	name := strings.Trim(strings.ReplaceAll(p, `\`, "/"), "/")
+	if name == "" {
+		return ".", true
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." || strings.ContainsRune(part, ':') {
+			return "", false
+		}
+	}
+	return path.Clean(name), true
+}
+
+// matchWildcard reports whether name matches a Windows search pattern with
+// * and ? wildcards, ignoring case. An empty pattern and *.* match every
+// name.
+func matchWildcard(pattern, name string) bool {
+	if pattern == "" || pattern == "*.*" {
+		return true
+	}
+	p, n := []rune(strings.ToLower(pattern)), []rune(strings.ToLower(name))
+
+	// Backtrack to the last * on a mismatch
+	var pi, ni, star, mark = 0, 0, -1, 0
+	for ni < len(n) {
+		switch {
+		case pi < len(p) && (p[pi] == '?' || p[pi] == n[ni]):
+			pi++
+			ni++
+		case pi < len(p) && p[pi] == '*':
+			star, mark = pi, ni
+			pi++
+		case star >= 0:
+			pi = star + 1
+			mark++
+			ni = mark
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
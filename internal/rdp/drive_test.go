@@ -0,0 +1,290 @@
+package rdp
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcarmo/go-rdp/internal/protocol/rdpdr"
+)
+
+// Access rights used by the tests (MS-SMB2 2.2.13.1.1)
+const (
+	testFileReadData  uint32 = 0x00000001 // FILE_READ_DATA, FILE_LIST_DIRECTORY
+	testGenericWrite  uint32 = 0x40000000 // GENERIC_WRITE
+	testReadAttribute uint32 = 0x00000080 // FILE_READ_ATTRIBUTES
+)
+
+// newTestDrive returns a drive over a directory holding a.txt, b.log, an
+// empty sub directory and a secret file next to the root.
+func newTestDrive(t *testing.T) *driveDevice {
+	t.Helper()
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "share")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello drive"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.log"), []byte("log"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(parent, "secret"), []byte("secret"), 0o600))
+
+	drive, err := newDriveDevice(dir, "share")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = drive.close() })
+	return drive
+}
+
+// utf16Path encodes p as null-terminated UTF-16LE.
+func utf16Path(p string) []byte {
+	var buf []byte
+	for _, u := range utf16.Encode([]rune(p)) {
+		buf = binary.LittleEndian.AppendUint16(buf, u)
+	}
+	return append(buf, 0, 0)
+}
+
+// createRequest builds an IRP_MJ_CREATE request for p.
+func createRequest(p string, access, disposition, options uint32) *rdpdr.IORequest {
+	path := utf16Path(p)
+	body := make([]byte, 32, 32+len(path))
+	binary.LittleEndian.PutUint32(body[0:4], access)
+	binary.LittleEndian.PutUint32(body[20:24], disposition)
+	binary.LittleEndian.PutUint32(body[24:28], options)
+	binary.LittleEndian.PutUint32(body[28:32], uint32(len(path)))
+	return &rdpdr.IORequest{DeviceID: driveDeviceID, CompletionID: 9, MajorFunction: rdpdr.IRPCreate, Body: append(body, path...)}
+}
+
+// queryDirectoryRequest builds an IRP_MN_QUERY_DIRECTORY request on fileID.
+func queryDirectoryRequest(fileID, class uint32, initial bool, p string) *rdpdr.IORequest {
+	var path []byte
+	if initial {
+		path = utf16Path(p)
+	}
+	body := make([]byte, 32, 32+len(path))
+	binary.LittleEndian.PutUint32(body[0:4], class)
+	if initial {
+		body[4] = 1
+	}
+	binary.LittleEndian.PutUint32(body[5:9], uint32(len(path)))
+	return &rdpdr.IORequest{
+		DeviceID:      driveDeviceID,
+		FileID:        fileID,
+		MajorFunction: rdpdr.IRPDirectoryControl,
+		MinorFunction: rdpdr.IRPQueryDirectory,
+		Body:          append(body, path...),
+	}
+}
+
+// completionStatus splits an I/O completion into its status and payload.
+func completionStatus(t *testing.T, completion []byte) (uint32, []byte) {
+	t.Helper()
+	require.GreaterOrEqual(t, len(completion), 12)
+	return binary.LittleEndian.Uint32(completion[8:12]), completion[12:]
+}
+
+// openDrivePath opens p on drive and returns the file ID.
+func openDrivePath(t *testing.T, drive *driveDevice, p string, options uint32) uint32 {
+	t.Helper()
+	status, payload := completionStatus(t, drive.handleIORequest(createRequest(p, testFileReadData|testReadAttribute, rdpdr.FileOpen, options)))
+	require.Equal(t, rdpdr.StatusSuccess, status, "open %s", p)
+	return binary.LittleEndian.Uint32(payload[0:4])
+}
+
+// listDrive enumerates the names matching pattern in the directory fileID
+// with FileBothDirectoryInformation, one entry per request.
+func listDrive(t *testing.T, drive *driveDevice, fileID uint32, pattern string) ([]string, uint32) {
+	t.Helper()
+	var names []string
+	initial := true
+	for {
+		status, payload := completionStatus(t, drive.handleIORequest(queryDirectoryRequest(fileID, rdpdr.FileBothDirectoryInformation, initial, pattern)))
+		if status != rdpdr.StatusSuccess {
+			return names, status
+		}
+		initial = false
+
+		data := payload[4:]
+		require.Equal(t, len(data), int(binary.LittleEndian.Uint32(payload[0:4])))
+		nameLen := int(binary.LittleEndian.Uint32(data[60:64]))
+		units := make([]uint16, nameLen/2)
+		for i := range units {
+			units[i] = binary.LittleEndian.Uint16(data[94+2*i:])
+		}
+		names = append(names, string(utf16.Decode(units)))
+	}
+}
+
+func TestDriveDevice_DirectoryEnumeration(t *testing.T) {
+	drive := newTestDrive(t)
+	root := openDrivePath(t, drive, `\`, rdpdr.FileDirectoryFile)
+
+	names, status := listDrive(t, drive, root, `\*`)
+	assert.Equal(t, []string{"a.txt", "b.log", "sub"}, names)
+	assert.Equal(t, rdpdr.StatusNoMoreFiles, status)
+
+	// A new initial query restarts the enumeration with its pattern
+	names, status = listDrive(t, drive, root, `\*.TXT`)
+	assert.Equal(t, []string{"a.txt"}, names)
+	assert.Equal(t, rdpdr.StatusNoMoreFiles, status)
+
+	names, status = listDrive(t, drive, root, `\missing.txt`)
+	assert.Empty(t, names)
+	assert.Equal(t, rdpdr.StatusNoSuchFile, status)
+
+	sub := openDrivePath(t, drive, `\sub`, rdpdr.FileDirectoryFile)
+	names, status = listDrive(t, drive, sub, `\sub\*`)
+	assert.Empty(t, names)
+	assert.Equal(t, rdpdr.StatusNoSuchFile, status)
+
+	// Files cannot be enumerated
+	file := openDrivePath(t, drive, `\a.txt`, 0)
+	_, status = listDrive(t, drive, file, `\a.txt\*`)
+	assert.Equal(t, rdpdr.StatusNotADirectory, status)
+}
+
+func TestDriveDevice_RejectsPathTraversal(t *testing.T) {
+	drive := newTestDrive(t)
+	require.NoError(t, os.Symlink(filepath.Join(drive.root.Name(), "..", "secret"), filepath.Join(drive.root.Name(), "link")))
+
+	// The server sends normalized paths, so any ".." is rejected
+	for _, p := range []string{`\..\secret`, `\sub\..\..\secret`, `\sub\..\a.txt`, `..`, `\a.txt:stream`, `\link`} {
+		status, payload := completionStatus(t, drive.handleIORequest(createRequest(p, testFileReadData, rdpdr.FileOpen, 0)))
+		assert.Equal(t, rdpdr.StatusAccessDenied, status, p)
+		assert.Equal(t, make([]byte, 5), payload, p)
+	}
+
+	openDrivePath(t, drive, `sub\`, rdpdr.FileDirectoryFile)
+}
+
+func TestDriveDevice_ReadOnly(t *testing.T) {
+	drive := newTestDrive(t)
+	file := openDrivePath(t, drive, `\a.txt`, rdpdr.FileNonDirectoryFile)
+
+	read := make([]byte, 32)
+	binary.LittleEndian.PutUint32(read[0:4], 5)
+	binary.LittleEndian.PutUint64(read[4:12], 6)
+	status, payload := completionStatus(t, drive.handleIORequest(&rdpdr.IORequest{FileID: file, MajorFunction: rdpdr.IRPRead, Body: read}))
+	require.Equal(t, rdpdr.StatusSuccess, status)
+	assert.Equal(t, append([]byte{5, 0, 0, 0}, "drive"...), payload)
+
+	tests := []struct {
+		name        string
+		path        string
+		access      uint32
+		disposition uint32
+		options     uint32
+		want        uint32
+	}{
+		{name: "write access", path: `\a.txt`, access: testGenericWrite, disposition: rdpdr.FileOpen, want: rdpdr.StatusMediaWriteProtected},
+		{name: "create", path: `\new.txt`, access: testFileReadData, disposition: rdpdr.FileCreate, want: rdpdr.StatusMediaWriteProtected},
+		{name: "overwrite", path: `\a.txt`, access: testFileReadData, disposition: rdpdr.FileOverwriteIf, want: rdpdr.StatusMediaWriteProtected},
+		{name: "open if missing", path: `\new.txt`, access: testFileReadData, disposition: rdpdr.FileOpenIf, want: rdpdr.StatusMediaWriteProtected},
+		{name: "delete on close", path: `\a.txt`, access: testFileReadData, disposition: rdpdr.FileOpen, options: rdpdr.FileDeleteOnClose, want: rdpdr.StatusMediaWriteProtected},
+		{name: "missing", path: `\new.txt`, access: testFileReadData, disposition: rdpdr.FileOpen, want: rdpdr.StatusObjectNameNotFound},
+		{name: "directory as file", path: `\sub`, access: testFileReadData, disposition: rdpdr.FileOpen, options: rdpdr.FileNonDirectoryFile, want: rdpdr.StatusFileIsADirectory},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _ := completionStatus(t, drive.handleIORequest(createRequest(tt.path, tt.access, tt.disposition, tt.options)))
+			assert.Equal(t, tt.want, status)
+		})
+	}
+	_, err := os.Stat(filepath.Join(drive.root.Name(), "new.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	status, payload = completionStatus(t, drive.handleIORequest(&rdpdr.IORequest{FileID: file, MajorFunction: rdpdr.IRPWrite, Body: make([]byte, 40)}))
+	assert.Equal(t, rdpdr.StatusMediaWriteProtected, status)
+	assert.Equal(t, make([]byte, 5), payload)
+
+	// Closed handles are released
+	status, _ = completionStatus(t, drive.handleIORequest(&rdpdr.IORequest{FileID: file, MajorFunction: rdpdr.IRPClose, Body: make([]byte, 32)}))
+	assert.Equal(t, rdpdr.StatusSuccess, status)
+	status, _ = completionStatus(t, drive.handleIORequest(&rdpdr.IORequest{FileID: file, MajorFunction: rdpdr.IRPRead, Body: read}))
+	assert.Equal(t, rdpdr.StatusInvalidHandle, status)
+}
+
+func TestDeviceRedirectionHandler_Drive(t *testing.T) {
+	client, mockMCS := newDeviceRedirectionTestClient()
+	require.NoError(t, client.SetDriveRedirection(t.TempDir(), "share"))
+	t.Cleanup(func() { _ = client.Close() })
+	h := client.GetDeviceRedirectionHandler()
+
+	// The drive capability is advertised
+	require.NoError(t, h.HandleChannelData(serverRDPDRPDU(rdpdr.PacketServerCapability, []byte{0, 0, 0, 0})))
+	sent := sentRDPDRPDUs(t, mockMCS)
+	require.Len(t, sent, 1)
+	caps, err := rdpdr.ParseCapabilities(sent[0].body)
+	require.NoError(t, err)
+	require.Len(t, caps, 2)
+	assert.Equal(t, rdpdr.CapTypeDrive, caps[1].Type)
+
+	// The drive is announced after logon
+	mockMCS.SendCalls = nil
+	require.NoError(t, h.HandleChannelData(serverRDPDRPDU(rdpdr.PacketUserLoggedOn, nil)))
+	sent = sentRDPDRPDUs(t, mockMCS)
+	require.Len(t, sent, 1)
+	assert.Equal(t, rdpdr.SerializeDeviceList([]rdpdr.DeviceAnnounce{{
+		DeviceType:       rdpdr.DeviceTypeFilesystem,
+		DeviceID:         driveDeviceID,
+		PreferredDosName: "SHARE",
+	}}), sent[0].body)
+
+	// I/O requests for the drive are completed
+	mockMCS.SendCalls = nil
+	req := createRequest(`\`, testFileReadData, rdpdr.FileOpen, rdpdr.FileDirectoryFile)
+	header := make([]byte, 20)
+	binary.LittleEndian.PutUint32(header[0:4], req.DeviceID)
+	binary.LittleEndian.PutUint32(header[8:12], req.CompletionID)
+	require.NoError(t, h.HandleChannelData(serverRDPDRPDU(rdpdr.PacketDeviceIORequest, append(header, req.Body...))))
+	sent = sentRDPDRPDUs(t, mockMCS)
+	require.Len(t, sent, 1)
+	assert.Equal(t, rdpdr.PacketDeviceIOCompletion, sent[0].header.PacketID)
+	assert.Equal(t, []byte{1, 0, 0, 0, 9, 0, 0, 0, 0, 0, 0, 0}, sent[0].body[:12])
+
+	assert.Error(t, (&Client{}).SetDriveRedirection(filepath.Join(t.TempDir(), "missing"), "x"))
+}
+
+func TestDrivePath(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{in: ``, want: ".", ok: true},
+		{in: `\`, want: ".", ok: true},
+		{in: `\dir\file.txt`, want: "dir/file.txt", ok: true},
+		{in: `\dir\.\file.txt\`, want: "dir/file.txt", ok: true},
+		{in: `\..`, ok: false},
+		{in: `\dir\..\..\x`, ok: false},
+		{in: `C:\x`, ok: false},
+	}
+	for _, tt := range tests {
+		got, ok := drivePath(tt.in)
+		assert.Equal(t, tt.ok, ok, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+}
+
+func TestMatchWildcard(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "*", name: "a.txt", want: true},
+		{pattern: "*.*", name: "README", want: true},
+		{pattern: "*.txt", name: "A.TXT", want: true},
+		{pattern: "*.txt", name: "a.txt.bak", want: false},
+		{pattern: "a?c", name: "abc", want: true},
+		{pattern: "a?c", name: "ac", want: false},
+		{pattern: "*b*", name: "abc", want: true},
+		{pattern: "[a]", name: "[a]", want: true},
+		{pattern: "file.txt", name: "other.txt", want: false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, matchWildcard(tt.pattern, tt.name), "%s %s", tt.pattern, tt.name)
+	}
+}
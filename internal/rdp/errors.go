@@ -2,8 +2,35 @@ package rdp
 
 import "errors"
 
-// ErrUnsupportedRequestedProtocol indicates that the server selected a protocol
-// that this client does not support.
 var (
+	// ErrUnsupportedRequestedProtocol indicates that the server selected a protocol
+	// that this client does not support.
 	ErrUnsupportedRequestedProtocol = errors.New("unsupported requested protocol")
+
+	// ErrAuthenticationFailed indicates that the server rejected the
+	// credentials during Network Level Authentication.
+	ErrAuthenticationFailed = errors.New("authentication failed")
+
+	// ErrMissingServerNetworkData indicates that the server's MCS Connect
+	// Response carried no network data block, so no channels can be joined.
+	ErrMissingServerNetworkData = errors.New("missing server network data")
+
+	// ErrServerRedirected indicates that the server sent a Server Redirection
+	// PDU instead of activating the session; Client.Redirection says where to
+	// reconnect.
+	ErrServerRedirected = errors.New("server redirected the connection")
+
+	// ErrTransient indicates that the connection sequence failed for a
+	// reason that may clear on its own, such as a license server or session
+	// host that is temporarily unavailable. ConnectRetry retries these.
+	ErrTransient = errors.New("transient server error")
+
+	// ErrHandshakeTimeout indicates that the connection sequence did not
+	// complete within the handshake timeout set on the client.
+	ErrHandshakeTimeout = errors.New("handshake timed out")
+
+	// ErrUnknownFraming indicates that a server PDU started with a byte that
+	// is neither a TPKT version nor a fast-path output action, so the stream
+	// can no longer be framed.
+	ErrUnknownFraming = errors.New("unknown PDU framing")
 )
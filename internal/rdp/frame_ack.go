@@ -1,6 +1,24 @@
 package rdp
 
-import "github.com/rcarmo/go-rdp/internal/protocol/pdu"
+import (
+	"encoding/binary"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/rcarmo/go-rdp/internal/logging"
+	"github.com/rcarmo/go-rdp/internal/protocol/fastpath"
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+)
+
+// ErrUnknownFrame is returned by AcknowledgeFrame for a frame the server
+// did not end with a frame marker, or that was already acknowledged.
+var ErrUnknownFrame = errors.New("unknown frame")
+
+// maxPendingFrames bounds the frames awaiting acknowledgement, so a browser
+// that never acknowledges cannot grow the list without limit. It also bounds
+// the ended frames remembered to drop duplicates.
+const maxPendingFrames = 256
 
 // SendFrameAcknowledge sends a Frame Acknowledge PDU to the server
 // This is required when using Surface Commands - the server expects
@@ -9,3 +27,223 @@ func (c *Client) SendFrameAcknowledge(frameID uint32) error {
 	ack := pdu.NewFrameAcknowledgePDU(c.shareID, c.userID, frameID)
 	return c.mcsLayer.Send(c.userID, c.channelIDMap["global"], ack.Serialize())
 }
+
+// SetMaxUnacknowledgedFrames sets how many frames the server may send
+// before it waits for an acknowledgement, advertised in the Frame
+// Acknowledge capability set. Zero keeps the default. It must be called
+// before Connect.
+func (c *Client) SetMaxUnacknowledgedFrames(n uint32) {
+	c.maxUnacknowledgedFrames = n
+}
+
+// AcknowledgeFrame acknowledges a frame once the browser has rendered it,
+// letting the server send further frames. Earlier frames still pending are
+// acknowledged with it.
+func (c *Client) AcknowledgeFrame(frameID uint32) error {
+	if !c.frames.acknowledge(frameID) {
+		return ErrUnknownFrame
+	}
+	return c.SendFrameAcknowledge(frameID)
+}
+
+// SetFrameReorderGrace sets how many frames a late frame may trail the
+// newest frame and still be drawn. Over a lossy transport frames can arrive
+// duplicated or out of order; a frame that ended already is dropped, as is
+// one further behind than the grace, so an old frame never overwrites a
+// newer one. Zero, the default, drops every frame older than the newest.
+func (c *Client) SetFrameReorderGrace(n uint32) {
+	c.frames.mu.Lock()
+	defer c.frames.mu.Unlock()
+	c.frames.grace = n
+}
+
+// frameAcknowledgeCapabilities applies the configured window to the Frame
+// Acknowledge capability set of a Confirm Active PDU
+func (c *Client) frameAcknowledgeCapabilities(sets []pdu.CapabilitySet) {
+	if c.maxUnacknowledgedFrames == 0 {
+		return
+	}
+	for _, set := range sets {
+		if set.FrameAcknowledgeCapabilitySet != nil {
+			set.FrameAcknowledgeCapabilitySet.MaxUnacknowledgedFrames = c.maxUnacknowledgedFrames
+		}
+	}
+}
+
+// frameTracker records the frames the server ends with a frame marker
+// surface command until they are acknowledged, and drops the surface
+// commands of duplicate and stale frames.
+type frameTracker struct {
+	mu      sync.Mutex
+	pending []uint32
+
+	// grace is how many frames a frame may trail newest and still be drawn
+	grace uint32
+	// newest is the most recent frame started, once started is set
+	newest  uint32
+	started bool
+	// ended holds the most recent frames ended, to recognise duplicates
+	ended []uint32
+	// current is the frame whose commands are arriving, if open; drop
+	// reports whether they are discarded
+	current uint32
+	open    bool
+	drop    bool
+
+	// fragments collects the surface commands of a fragmented update
+	fragments []byte
+}
+
+// observe records the frames ended by the surface commands in a fast-path
+// update and returns the update without the commands of duplicate or stale
+// frames. data holds uncompressed updates as returned by GetUpdate; it is
+// returned as is unless commands were dropped. The fragments of a
+// fragmented update have already been forwarded when its last one arrives,
+// so those frames are only tracked.
+func (t *frameTracker) observe(data []byte) []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var out []byte
+	for offset := 0; offset+3 <= len(data); {
+		header := data[offset]
+		size := int(binary.LittleEndian.Uint16(data[offset+1:]))
+		if offset+3+size > len(data) {
+			break
+		}
+		update := data[offset : offset+3+size]
+		payload := update[3:]
+		offset += len(update)
+
+		if fastpath.UpdateCode(header&0xf) != fastpath.UpdateCodeSurfCMDs {
+			out = appendKept(out, data, update)
+			continue
+		}
+
+		switch fastpath.Fragment((header >> 4) & 0x3) {
+		case fastpath.FragmentSingle:
+			kept, dropped := t.observeCommands(payload)
+			if !dropped {
+				out = appendKept(out, data, update)
+				break
+			}
+			if out == nil {
+				// Copy the updates forwarded so far
+				out = append([]byte{}, data[:offset-len(update)]...)
+			}
+			if len(kept) > 0 {
+				out = append(out, header)
+				out = binary.LittleEndian.AppendUint16(out, uint16(len(kept))) // #nosec G115 -- no longer than payload
+				out = append(out, kept...)
+			}
+		case fastpath.FragmentFirst:
+			t.fragments = append(t.fragments[:0], payload...)
+			out = appendKept(out, data, update)
+		case fastpath.FragmentNext:
+			t.fragments = append(t.fragments, payload...)
+			out = appendKept(out, data, update)
+		case fastpath.FragmentLast:
+			t.observeCommands(append(t.fragments, payload...))
+			t.fragments = t.fragments[:0]
+			out = appendKept(out, data, update)
+		}
+	}
+	if out == nil {
+		return data
+	}
+	return out
+}
+
+// appendKept appends an update of data to out once out has diverged from
+// data; until then out stays nil and data is returned unchanged.
+func appendKept(out, data, update []byte) []byte {
+	if out == nil {
+		return nil
+	}
+	return append(out, update...)
+}
+
+// observeCommands records the frames ended in a run of surface commands and
+// returns the commands not belonging to duplicate or stale frames, and
+// whether any were dropped. Callers must hold t.mu.
+func (t *frameTracker) observeCommands(data []byte) (kept []byte, dropped bool) {
+	commands, _ := fastpath.ParseSurfaceCommands(data)
+	for _, cmd := range commands {
+		drop := t.open && t.drop
+		if cmd.CmdType == fastpath.CmdTypeFrameMarker {
+			drop = t.observeMarker(cmd.Data)
+		}
+		if drop {
+			dropped = true
+			continue
+		}
+		kept = binary.LittleEndian.AppendUint16(kept, cmd.CmdType)
+		kept = append(kept, cmd.Data...)
+	}
+	return kept, dropped
+}
+
+// observeMarker tracks the frame a frame marker starts or ends, reporting
+// whether the marker belongs to a dropped frame. Callers must hold t.mu.
+func (t *frameTracker) observeMarker(data []byte) bool {
+	marker, err := fastpath.ParseFrameMarker(data)
+	if err != nil {
+		return false
+	}
+
+	switch marker.FrameAction {
+	case fastpath.FrameStart:
+		t.current, t.open = marker.FrameID, true
+		t.drop = t.unwanted(marker.FrameID)
+		if !t.drop && (!t.started || int32(marker.FrameID-t.newest) > 0) { // #nosec G115 -- serial number arithmetic
+			t.newest, t.started = marker.FrameID, true
+		}
+		return t.drop
+	case fastpath.FrameEnd:
+		drop := t.unwanted(marker.FrameID)
+		if t.open && t.current == marker.FrameID {
+			drop = t.drop
+		}
+		t.open, t.drop = false, false
+		if drop {
+			logging.Debug("Dropped duplicate or stale frame %d", marker.FrameID)
+			return true
+		}
+		if !t.started || int32(marker.FrameID-t.newest) > 0 { // #nosec G115 -- serial number arithmetic
+			t.newest, t.started = marker.FrameID, true
+		}
+		if len(t.ended) == maxPendingFrames {
+			t.ended = t.ended[1:]
+		}
+		t.ended = append(t.ended, marker.FrameID)
+		if len(t.pending) == maxPendingFrames {
+			t.pending = t.pending[1:]
+		}
+		t.pending = append(t.pending, marker.FrameID)
+	}
+	return false
+}
+
+// unwanted reports whether frameID already ended or trails the newest frame
+// by more than the grace. Callers must hold t.mu.
+func (t *frameTracker) unwanted(frameID uint32) bool {
+	if slices.Contains(t.ended, frameID) {
+		return true
+	}
+	behind := int32(t.newest - frameID) // #nosec G115 -- serial number arithmetic
+	return t.started && behind > 0 && uint32(behind) > t.grace
+}
+
+// acknowledge removes frameID and the frames pending before it. It reports
+// false when frameID is not pending.
+func (t *frameTracker) acknowledge(frameID uint32) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	i := slices.Index(t.pending, frameID)
+	if i < 0 {
+		return false
+	}
+	t.pending = t.pending[i+1:]
+	return true
+}
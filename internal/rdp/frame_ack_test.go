@@ -0,0 +1,183 @@
+package rdp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcarmo/go-rdp/internal/protocol/fastpath"
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+)
+
+// frameMarker encodes a frame marker surface command
+func frameMarker(action uint16, frameID uint32) []byte {
+	cmd := binary.LittleEndian.AppendUint16(nil, fastpath.CmdTypeFrameMarker)
+	cmd = binary.LittleEndian.AppendUint16(cmd, action)
+	return binary.LittleEndian.AppendUint32(cmd, frameID)
+}
+
+// surfaceCommandsUpdate wraps surface commands in a fast-path update
+func surfaceCommandsUpdate(fragment fastpath.Fragment, commands []byte) []byte {
+	update := []byte{byte(fastpath.UpdateCodeSurfCMDs) | byte(fragment)<<4}
+	update = binary.LittleEndian.AppendUint16(update, uint16(len(commands))) // #nosec G115
+	return append(update, commands...)
+}
+
+func TestFrameTracker_ObservesFrameEnds(t *testing.T) {
+	var tracker frameTracker
+
+	// Frame starts are not acknowledged, and other updates are skipped
+	data := surfaceCommandsUpdate(fastpath.FragmentSingle, frameMarker(fastpath.FrameStart, 1))
+	data = append(data, byte(fastpath.UpdateCodeSynchronize), 0, 0)
+	data = append(data, surfaceCommandsUpdate(fastpath.FragmentSingle, frameMarker(fastpath.FrameEnd, 1))...)
+	tracker.observe(data)
+	assert.Equal(t, []uint32{1}, tracker.pending)
+
+	// A frame marker split across fragments
+	marker := frameMarker(fastpath.FrameEnd, 2)
+	tracker.observe(surfaceCommandsUpdate(fastpath.FragmentFirst, marker[:3]))
+	tracker.observe(surfaceCommandsUpdate(fastpath.FragmentLast, marker[3:]))
+	assert.Equal(t, []uint32{1, 2}, tracker.pending)
+}
+
+func TestFrameTracker_Acknowledge(t *testing.T) {
+	tracker := frameTracker{pending: []uint32{7, 8, 9}}
+
+	assert.False(t, tracker.acknowledge(3))
+	assert.Equal(t, []uint32{7, 8, 9}, tracker.pending)
+
+	// Acknowledging a frame acknowledges the frames before it
+	assert.True(t, tracker.acknowledge(8))
+	assert.Equal(t, []uint32{9}, tracker.pending)
+	assert.False(t, tracker.acknowledge(8))
+}
+
+func TestFrameTracker_BoundsPending(t *testing.T) {
+	var tracker frameTracker
+	var commands []byte
+	for id := range uint32(maxPendingFrames + 10) {
+		commands = append(commands, frameMarker(fastpath.FrameEnd, id)...)
+	}
+	tracker.observeCommands(commands)
+
+	require.Len(t, tracker.pending, maxPendingFrames)
+	assert.Equal(t, uint32(10), tracker.pending[0])
+}
+
+func TestClient_AcknowledgeFrame(t *testing.T) {
+	mockMCS := &MockMCSLayer{}
+	client := &Client{
+		userID:       1007,
+		shareID:      0x103EA,
+		channelIDMap: map[string]uint16{"global": 1003},
+		mcsLayer:     mockMCS,
+	}
+	client.frames.observe(surfaceCommandsUpdate(fastpath.FragmentSingle, frameMarker(fastpath.FrameEnd, 42)))
+
+	assert.ErrorIs(t, client.AcknowledgeFrame(41), ErrUnknownFrame)
+	assert.Empty(t, mockMCS.SendCalls)
+
+	require.NoError(t, client.AcknowledgeFrame(42))
+	require.Len(t, mockMCS.SendCalls, 1)
+	assert.Equal(t, uint16(1003), mockMCS.SendCalls[0].ChannelID)
+	assert.Equal(t, pdu.NewFrameAcknowledgePDU(0x103EA, 1007, 42).Serialize(), mockMCS.SendCalls[0].Data)
+
+	assert.ErrorIs(t, client.AcknowledgeFrame(42), ErrUnknownFrame)
+}
+
+// surfaceBits encodes a one-byte Set Surface Bits command
+func surfaceBits(value byte) []byte {
+	cmd := binary.LittleEndian.AppendUint16(nil, fastpath.CmdTypeSurfaceBits)
+	cmd = append(cmd, make([]byte, 16)...)
+	cmd = binary.LittleEndian.AppendUint32(cmd, 1)
+	return append(cmd, value)
+}
+
+// frameUpdate encodes a whole frame in one fast-path update
+func frameUpdate(frameID uint32) []byte {
+	commands := frameMarker(fastpath.FrameStart, frameID)
+	commands = append(commands, surfaceBits(byte(frameID))...)
+	commands = append(commands, frameMarker(fastpath.FrameEnd, frameID)...)
+	return surfaceCommandsUpdate(fastpath.FragmentSingle, commands)
+}
+
+func TestFrameTracker_DropsDuplicateFrames(t *testing.T) {
+	var tracker frameTracker
+
+	assert.Equal(t, frameUpdate(1), tracker.observe(frameUpdate(1)))
+	assert.Empty(t, tracker.observe(frameUpdate(1)))
+	assert.Equal(t, []uint32{1}, tracker.pending)
+
+	// A frame spread over updates, then repeated
+	start := surfaceCommandsUpdate(fastpath.FragmentSingle, append(frameMarker(fastpath.FrameStart, 2), surfaceBits(2)...))
+	end := surfaceCommandsUpdate(fastpath.FragmentSingle, frameMarker(fastpath.FrameEnd, 2))
+	for range 2 {
+		tracker.observe(start)
+		tracker.observe(end)
+	}
+	assert.Equal(t, []uint32{1, 2}, tracker.pending)
+	assert.Empty(t, tracker.observe(start))
+	assert.Empty(t, tracker.observe(end))
+
+	// Other updates sharing the fast-path PDU are kept
+	synchronize := []byte{byte(fastpath.UpdateCodeSynchronize), 0, 0}
+	data := append(append(bytes.Clone(synchronize), frameUpdate(1)...), frameUpdate(3)...)
+	assert.Equal(t, append(bytes.Clone(synchronize), frameUpdate(3)...), tracker.observe(data))
+	assert.Equal(t, []uint32{1, 2, 3}, tracker.pending)
+}
+
+func TestFrameTracker_DropsStaleFrames(t *testing.T) {
+	var tracker frameTracker
+
+	tracker.observe(frameUpdate(5))
+	assert.Empty(t, tracker.observe(frameUpdate(4)))
+	assert.Equal(t, frameUpdate(6), tracker.observe(frameUpdate(6)))
+	assert.Equal(t, []uint32{5, 6}, tracker.pending)
+
+	// Commands outside a frame are kept with the rest of a partly stale update
+	commands := append(frameMarker(fastpath.FrameStart, 3), surfaceBits(3)...)
+	commands = append(commands, frameMarker(fastpath.FrameEnd, 3)...)
+	commands = append(commands, surfaceBits(9)...)
+	assert.Equal(t, surfaceCommandsUpdate(fastpath.FragmentSingle, surfaceBits(9)),
+		tracker.observe(surfaceCommandsUpdate(fastpath.FragmentSingle, commands)))
+}
+
+func TestFrameTracker_ReorderGrace(t *testing.T) {
+	tracker := frameTracker{grace: 1}
+
+	tracker.observe(frameUpdate(10))
+	assert.Equal(t, frameUpdate(9), tracker.observe(frameUpdate(9)))
+	assert.Empty(t, tracker.observe(frameUpdate(8)))
+	assert.Equal(t, []uint32{10, 9}, tracker.pending)
+
+	// Frame IDs wrap around
+	tracker = frameTracker{}
+	tracker.observe(frameUpdate(0xFFFFFFFF))
+	assert.Equal(t, frameUpdate(0), tracker.observe(frameUpdate(0)))
+	assert.Empty(t, tracker.observe(frameUpdate(0xFFFFFFFE)))
+}
+
+func TestGetUpdate_SkipsDuplicateFrames(t *testing.T) {
+	client, server := newPipeClient(t)
+	client.SetFrameReorderGrace(0)
+
+	fastPath := func(data []byte) []byte { return append([]byte{0x00, byte(len(data))}, data...) }
+	synchronize := []byte{byte(fastpath.UpdateCodeSynchronize), 0x00, 0x00}
+	go func() {
+		stream := fastPath(frameUpdate(1))
+		stream = append(stream, fastPath(frameUpdate(1))...)
+		stream = append(stream, fastPath(synchronize)...)
+		_, _ = server.Write(stream)
+	}()
+
+	update, err := client.GetUpdate()
+	require.NoError(t, err)
+	assert.Equal(t, frameUpdate(1), update.Data)
+
+	update, err = client.GetUpdate()
+	require.NoError(t, err)
+	assert.Equal(t, synchronize, update.Data)
+}
@@ -2,16 +2,21 @@ package rdp
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"sync/atomic"
+	"time"
 
 	"github.com/rcarmo/go-rdp/internal/logging"
 	"github.com/rcarmo/go-rdp/internal/protocol/audio"
+	"github.com/rcarmo/go-rdp/internal/protocol/cliprdr"
 	"github.com/rcarmo/go-rdp/internal/protocol/drdynvc"
+	"github.com/rcarmo/go-rdp/internal/protocol/mcs"
 	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+	"github.com/rcarmo/go-rdp/internal/protocol/rdpdr"
 )
 
 // updateCounter tracks total updates processed (for debugging/metrics)
@@ -19,39 +24,59 @@ var updateCounter atomic.Int64
 
 // GetUpdate reads the next screen update from the RDP server.
 // The returned Update contains raw bitmap data for rendering.
+//
+// Servers interleave fast-path and slow-path PDUs freely within a session,
+// so each PDU is dispatched on its first byte: 0x03 starts a TPKT header,
+// and a byte whose low two bits are clear is a fast-path output header
+// (MS-RDPBCGR 2.2.9.1.2). PDUs that carry nothing to draw, such as channel
+// data or cache orders, are consumed and the next one is read.
 func (c *Client) GetUpdate() (*Update, error) {
-	// If we have a pending slow-path update, return it first
-	if c.pendingSlowPathUpdate != nil {
-		update := c.pendingSlowPathUpdate
-		c.pendingSlowPathUpdate = nil
-		return update, nil
-	}
+	for {
+		// If we have a pending slow-path update, return it first
+		if c.pendingSlowPathUpdate != nil {
+			update := c.pendingSlowPathUpdate
+			c.pendingSlowPathUpdate = nil
+			return update, nil
+		}
 
-	protocol, err := receiveProtocol(c.buffReader)
-	if err != nil {
-		return nil, err
-	}
+		if len(c.pendingUpdates) > 0 {
+			update := c.pendingUpdates[0]
+			c.pendingUpdates = c.pendingUpdates[1:]
+			return update, nil
+		}
 
-	updateCounter.Add(1)
+		protocol, err := receiveProtocol(c.buffReader)
+		if err != nil {
+			return nil, err
+		}
+		c.readIdle.touch()
 
-	if protocol.IsX224() {
-		update, err := c.getX224Update()
+		updateCounter.Add(1)
+
+		var update *Update
 		switch {
-		case err == nil:
-			if update != nil {
-				// Got a converted slow-path bitmap update
-				return update, nil
+		case protocol.IsX224():
+			update, err = c.getX224Update()
+			if err != nil && !errors.Is(err, pdu.ErrDeactivateAll) {
+				err = fmt.Errorf("get X.224 update: %w", err)
 			}
-			// Non-bitmap X224 update, try again
-			return c.GetUpdate()
-		case errors.Is(err, pdu.ErrDeactivateAll):
-			return nil, err
-
+		case protocol.IsFastpath():
+			update, err = c.getFastPathUpdate()
 		default:
-			return nil, fmt.Errorf("get X.224 update: %w", err)
+			err = fmt.Errorf("%w: first byte 0x%02X", ErrUnknownFraming, uint8(protocol))
+		}
+		if err != nil {
+			return nil, err
+		}
+		if update != nil {
+			return update, nil
 		}
 	}
+}
 
+// getFastPathUpdate reads a fast-path PDU, returning nil when it only
+// carried cache orders.
+func (c *Client) getFastPathUpdate() (*Update, error) {
 	fpUpdate, err := c.fastPath.Receive()
 	if err != nil {
 		return nil, err
@@ -60,9 +85,97 @@ func (c *Client) GetUpdate() (*Update, error) {
 	// FastPath bitmap updates already contain bitmapUpdateData with:
 	// [updateType:2] [numberRectangles:2] [rectangles...]
 	// The JS parser expects: [updateHeader:1] [size:2] [updateType:2] [numberRectangles:2] [...]
-	// which is exactly what fpUpdate.Data contains, so no modification needed.
+	// which is exactly what fpUpdate.Data contains once any bulk-compressed
+	// updates have been expanded.
+	data, err := c.decompressFastPath(fpUpdate.Data)
+	if err != nil {
+		return nil, err
+	}
+	if filtered := c.frames.observe(data); len(filtered) < len(data) {
+		if len(filtered) == 0 {
+			// Only duplicate or stale frames, nothing to draw
+			return nil, nil
+		}
+		data = filtered
+	}
+
+	if c.drawingOrders != nil {
+		updates, err := c.drawingOrders.applyFastPath(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(updates) == 0 {
+			// Only cache orders or orders that cannot be drawn
+			return nil, nil
+		}
+		return c.queueUpdates(updates), nil
+	}
 
-	return &Update{Data: fpUpdate.Data}, nil
+	return &Update{Data: data}, nil
+}
+
+// GetUpdateContext is GetUpdate, except that it returns ctx.Err() once ctx
+// is done instead of waiting for the server. A blocked read is interrupted
+// by moving the connection's read deadline, so the socket stays open; when
+// ctx ends part-way through an update the stream cannot be resumed and the
+// client should only be closed.
+//
+// With a read idle timeout set, it returns ErrServerUnresponsive once the
+// server has sent nothing for that long.
+func (c *Client) GetUpdateContext(ctx context.Context) (*Update, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.conn != nil {
+		conn := c.conn
+		interrupted := make(chan struct{})
+		stop := context.AfterFunc(ctx, func() {
+			_ = conn.SetReadDeadline(time.Now())
+			close(interrupted)
+		})
+		defer func() {
+			if !stop() {
+				// Clear the deadline once the interrupt has set it
+				<-interrupted
+				_ = conn.SetReadDeadline(time.Time{})
+			}
+		}()
+	}
+
+	var idle *readIdleTimer
+	if c.conn != nil && c.readIdleTimeout > 0 {
+		idle = startReadIdleTimer(c.conn, c.readIdleTimeout)
+		c.readIdle = idle
+	}
+
+	update, err := c.GetUpdate()
+	if idle != nil {
+		c.readIdle = nil
+		if idle.stop(c.conn) && err != nil && ctx.Err() == nil {
+			return nil, ErrServerUnresponsive
+		}
+	}
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return update, err
+}
+
+// Backlogged reports whether the next update can be read without waiting
+// for the server: updates are queued or data is already buffered from the
+// connection. A reader falling behind the server sees it stay true.
+func (c *Client) Backlogged() bool {
+	if c.pendingSlowPathUpdate != nil || len(c.pendingUpdates) > 0 {
+		return true
+	}
+	return c.buffReader != nil && c.buffReader.Buffered() > 0
+}
+
+// queueUpdates returns the first of updates and keeps the rest for the
+// following GetUpdate calls, since the browser renders one update per message
+func (c *Client) queueUpdates(updates []*Update) *Update {
+	c.pendingUpdates = append(c.pendingUpdates, updates[1:]...)
+	return updates[0]
 }
 
 // Slow-path update types
@@ -111,9 +224,39 @@ func (c *Client) getX224Update() (*Update, error) {
 		return nil, nil
 	}
 
-	// Handle DRDYNVC (dynamic virtual channel) for display control
+	// Handle cliprdr clipboard channel
+	if channelID == c.channelIDMap[cliprdr.ChannelName] {
+		if c.clipboardHandler != nil {
+			var buf bytes.Buffer
+			if _, err := io.Copy(&buf, wire); err != nil {
+				logging.Debug("Clipboard: Error reading channel data: %v", err)
+				return nil, nil
+			}
+			if err := c.clipboardHandler.HandleChannelData(buf.Bytes()); err != nil {
+				logging.Debug("Clipboard: Error handling channel data: %v", err)
+			}
+		}
+		return nil, nil
+	}
+
+	// Handle rdpdr device redirection channel
+	if channelID == c.channelIDMap[rdpdr.ChannelName] {
+		if c.deviceRedirection != nil {
+			var buf bytes.Buffer
+			if _, err := io.Copy(&buf, wire); err != nil {
+				logging.Debug("RDPDR: Error reading channel data: %v", err)
+				return nil, nil
+			}
+			if err := c.deviceRedirection.HandleChannelData(buf.Bytes()); err != nil {
+				logging.Debug("RDPDR: Error handling channel data: %v", err)
+			}
+		}
+		return nil, nil
+	}
+
+	// Handle DRDYNVC (dynamic virtual channel) for audio input and display control
 	if channelID == c.channelIDMap[drdynvc.ChannelName] {
-		if c.displayControl != nil {
+		if c.displayControl != nil || c.audioInputHandler != nil {
 			var buf bytes.Buffer
 			if _, err := io.Copy(&buf, wire); err != nil {
 				logging.Debug("DRDYNVC: Error reading channel data: %v", err)
@@ -122,14 +265,18 @@ func (c *Client) getX224Update() (*Update, error) {
 			// Skip the static channel PDU header (8 bytes)
 			data := buf.Bytes()
 			if len(data) > 8 {
-				if err := c.displayControl.HandleDRDYNVC(data[8:]); err != nil {
-					logging.Debug("DRDYNVC: Error handling data: %v", err)
-				}
+				c.handleDRDYNVC(data[8:])
 			}
 		}
 		return nil, nil
 	}
 
+	// Server Heartbeat PDUs arrive on the message channel
+	if id, ok := c.channelIDMap[mcs.MessageChannelName]; ok && channelID == id {
+		c.handleMessageChannel(wire)
+		return nil, nil
+	}
+
 	// Read ShareControlHeader first to check PDU type
 	var shareControlHeader pdu.ShareControlHeader
 	if err = shareControlHeader.Deserialize(wire); err != nil {
@@ -171,6 +318,11 @@ func (c *Client) getX224Update() (*Update, error) {
 		return nil, fmt.Errorf("read compressedLength: %w", err)
 	}
 
+	wire, err = c.decompressSlowPath(wire, compressedType)
+	if err != nil {
+		return nil, err
+	}
+
 	// Handle bitmap updates (PDUTYPE2_UPDATE = 0x02)
 	if pduType2.IsUpdate() {
 		return c.handleSlowPathGraphicsUpdate(wire)
@@ -186,6 +338,36 @@ func (c *Client) getX224Update() (*Update, error) {
 		}
 	}
 
+	// Handle monitor layout changes sent mid-session
+	if pduType2.IsMonitorLayout() {
+		var layout pdu.MonitorLayoutPDUData
+		if err := layout.Deserialize(wire); err != nil {
+			logging.Warn("Error deserializing monitor layout PDU: %v", err)
+		} else {
+			c.handleMonitorLayout(&layout)
+		}
+	}
+
+	// Capture the auto-reconnect cookie sent after logon
+	if pduType2.IsSaveSessionInfo() {
+		var info pdu.SaveSessionInfoPDUData
+		if err := info.Deserialize(wire); err != nil {
+			logging.Warn("Error deserializing save session info PDU: %v", err)
+		} else {
+			c.handleSaveSessionInfo(&info)
+		}
+	}
+
+	// Report connection progress sent after the session is active
+	if pduType2.IsStatusInfo() {
+		var status pdu.StatusInfoPDUData
+		if err := status.Deserialize(wire); err != nil {
+			logging.Warn("Error deserializing status info PDU: %v", err)
+		} else {
+			c.handleStatusInfo(&status)
+		}
+	}
+
 	return nil, nil
 }
 
@@ -215,6 +397,17 @@ func (c *Client) handleSlowPathGraphicsUpdate(wire io.Reader) (*Update, error) {
 		fastpathCode = FastPathUpdateCodePalette
 	case SlowPathUpdateTypeSynchronize:
 		fastpathCode = FastPathUpdateCodeSynchronize
+	case SlowPathUpdateTypeOrders:
+		// [pad2Octets (2)] [numberOrders (2)] [pad2Octets (2)] [orderData...]
+		if c.drawingOrders == nil || len(updateData) < 6 {
+			return nil, nil
+		}
+		payload := append(updateData[2:4:4], updateData[6:]...)
+		updates := c.drawingOrders.decodeOrders(payload)
+		if len(updates) == 0 {
+			return nil, nil
+		}
+		return c.queueUpdates(updates), nil
 	default:
 		// Unknown update type, skip
 		return nil, nil
@@ -234,3 +427,22 @@ func (c *Client) handleSlowPathGraphicsUpdate(wire io.Reader) (*Update, error) {
 
 	return &Update{Data: fpData}, nil
 }
+
+// handleDRDYNVC routes a DRDYNVC PDU to the audio input handler first, since
+// it claims only the AUDIO_INPUT channel, then to display control
+func (c *Client) handleDRDYNVC(data []byte) {
+	if c.audioInputHandler != nil {
+		handled, err := c.audioInputHandler.HandleDRDYNVC(data)
+		if err != nil {
+			logging.Debug("Audio input: Error handling data: %v", err)
+		}
+		if handled {
+			return
+		}
+	}
+	if c.displayControl != nil {
+		if err := c.displayControl.HandleDRDYNVC(data); err != nil {
+			logging.Debug("DRDYNVC: Error handling data: %v", err)
+		}
+	}
+}
@@ -2,9 +2,13 @@ package rdp
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
+	"net"
 	"testing"
+	"time"
 
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -122,3 +126,149 @@ func TestClient_handleSlowPathGraphicsUpdate_UnknownType(t *testing.T) {
 	require.NoError(t, err)
 	assert.Nil(t, result, "Unknown update types should return nil")
 }
+
+// newPipeClient returns a client reading from one end of a net.Pipe and the
+// other end, standing in for the server
+func newPipeClient(t *testing.T) (*Client, net.Conn) {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+	t.Cleanup(func() {
+		_ = clientConn.Close()
+		_ = serverConn.Close()
+	})
+	dial := func(context.Context, string, string) (net.Conn, error) { return clientConn, nil }
+	client, err := NewClientWithDialContext(context.Background(), dial, "rdp.test:3389", "user", "pass", 1024, 768, 16)
+	require.NoError(t, err)
+	return client, serverConn
+}
+
+func TestGetUpdateContext_CancelInterruptsBlockedRead(t *testing.T) {
+	client, _ := newPipeClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.GetUpdateContext(ctx)
+		done <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(2 * time.Second):
+		t.Fatal("GetUpdateContext did not return after cancellation")
+	}
+}
+
+func TestGetUpdateContext_AlreadyCancelled(t *testing.T) {
+	client, _ := newPipeClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := client.GetUpdateContext(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestGetUpdateContext_ReadsAfterDeadline(t *testing.T) {
+	client, server := newPipeClient(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := client.GetUpdateContext(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The deadline is cleared, so the next read waits for the server
+	synchronize := []byte{byte(FastPathUpdateCodeSynchronize), 0x00, 0x00}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_, _ = server.Write(append([]byte{0x00, byte(len(synchronize))}, synchronize...))
+	}()
+
+	update, err := client.GetUpdateContext(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, synchronize, update.Data)
+}
+
+func TestClient_Backlogged(t *testing.T) {
+	client, server := newPipeClient(t)
+	assert.False(t, client.Backlogged())
+
+	// Two updates in one write: reading the first buffers the second
+	synchronize := []byte{byte(FastPathUpdateCodeSynchronize), 0x00, 0x00}
+	pdu := append([]byte{0x00, byte(len(synchronize))}, synchronize...)
+	go func() { _, _ = server.Write(append(pdu, pdu...)) }()
+
+	_, err := client.GetUpdate()
+	require.NoError(t, err)
+	assert.True(t, client.Backlogged())
+
+	_, err = client.GetUpdate()
+	require.NoError(t, err)
+	assert.False(t, client.Backlogged())
+}
+
+// slowPathDataPDU wraps body in the share headers of a slow-path data PDU
+func slowPathDataPDU(pduType2 pdu.Type2, body []byte) []byte {
+	header := pdu.ShareDataHeader{
+		ShareControlHeader: pdu.ShareControlHeader{
+			TotalLength: uint16(18 + len(body)), // #nosec G115
+			PDUType:     pdu.TypeData,
+			PDUSource:   testServerIOChannelID,
+		},
+		ShareID:            testServerShareID,
+		StreamID:           0x01,
+		UncompressedLength: uint16(4 + len(body)), // #nosec G115
+		PDUType2:           pduType2,
+	}
+	return append(header.Serialize(), body...)
+}
+
+func TestGetUpdate_InterleavedFastPathAndSlowPath(t *testing.T) {
+	client, server := newTestServerClient(t, nil)
+	require.NoError(t, client.Connect())
+	server.waitActive()
+
+	fastPathSync := []byte{FastPathUpdateCodeSynchronize, 0x00, 0x00}
+	fastPath := append([]byte{0x00, byte(len(fastPathSync))}, fastPathSync...)
+	errorInfo := binary.LittleEndian.AppendUint32(nil, 0x00000001) // ERRINFO_RPC_INITIATED_DISCONNECT
+	slowPathSync := binary.LittleEndian.AppendUint16(nil, SlowPathUpdateTypeSynchronize)
+	slowPathSync = append(slowPathSync, 0x00, 0x00)
+
+	sent := make(chan error, 1)
+	go func() {
+		for _, send := range []func() error{
+			func() error { _, err := server.conn.Write(fastPath); return err },
+			func() error { return server.sendData(slowPathDataPDU(pdu.Type2ErrorInfo, errorInfo)) },
+			func() error { return server.sendData(slowPathDataPDU(pdu.Type2Update, slowPathSync)) },
+			func() error { _, err := server.conn.Write(fastPath); return err },
+			func() error { _, err := server.conn.Write([]byte{0x01, 0x00}); return err },
+		} {
+			if err := send(); err != nil {
+				sent <- err
+				return
+			}
+		}
+		sent <- nil
+	}()
+
+	update, err := client.GetUpdate()
+	require.NoError(t, err)
+	assert.Equal(t, fastPathSync, update.Data)
+
+	// The error info PDU carries nothing to draw and is skipped
+	update, err = client.GetUpdate()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{FastPathUpdateCodeSynchronize, 0x04, 0x00, 0x03, 0x00, 0x00, 0x00}, update.Data)
+
+	update, err = client.GetUpdate()
+	require.NoError(t, err)
+	assert.Equal(t, fastPathSync, update.Data)
+
+	_, err = client.GetUpdate()
+	assert.ErrorIs(t, err, ErrUnknownFraming)
+	assert.ErrorContains(t, err, "0x01")
+	require.NoError(t, <-sent)
+}
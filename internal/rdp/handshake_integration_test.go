@@ -0,0 +1,351 @@
+package rdp
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/go-rdp/internal/codec"
+	"github.com/rcarmo/go-rdp/internal/protocol/audio"
+	"github.com/rcarmo/go-rdp/internal/protocol/cliprdr"
+	"github.com/rcarmo/go-rdp/internal/protocol/license"
+	"github.com/rcarmo/go-rdp/internal/protocol/mcs"
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnect_HandshakeToActiveState(t *testing.T) {
+	client, server := newTestServerClient(t, nil)
+	client.EnableClipboard()
+
+	require.NoError(t, client.Connect())
+	server.waitActive()
+
+	assert.True(t, server.RequestedProtocols.IsSSL())
+	assert.Equal(t, "alice", server.Username)
+	assert.Equal(t, []string{cliprdr.ChannelName}, server.ChannelNames)
+
+	// The user channel, the I/O channel and the clipboard channel are joined
+	assert.ElementsMatch(t, []uint16{testServerUserID, testServerIOChannelID, testServerFirstVChannel}, server.JoinedChannels)
+	assert.Equal(t, testServerUserID, client.userID)
+	assert.Equal(t, testServerFirstVChannel, client.channelIDMap[cliprdr.ChannelName])
+	assert.Equal(t, testServerIOChannelID, client.channelIDMap["global"])
+
+	require.NotNil(t, server.ConfirmActive)
+	assert.Equal(t, testServerShareID, server.ConfirmActive.ShareID)
+	assert.Equal(t, testServerShareID, client.shareID)
+	assert.NotEmpty(t, client.serverCapabilitySets)
+
+	assert.Equal(t, []pdu.Type2{
+		pdu.Type2Synchronize,
+		pdu.Type2Control,
+		pdu.Type2Control,
+		pdu.Type2Fontlist,
+	}, server.Finalization)
+
+	require.NoError(t, client.Close())
+}
+
+func TestConnect_HandshakeFollowsServerRedirection(t *testing.T) {
+	client, _ := newTestServerClient(t, func(s *testServer) {
+		s.Redirection = &pdu.ServerRedirectionPDU{
+			Packet: pdu.ServerRedirectionPacket{
+				SessionID:        3,
+				RedirFlags:       pdu.RedirFlagTargetNetAddress,
+				TargetNetAddress: "10.0.0.7",
+			},
+		}
+	})
+
+	err := client.Connect()
+	require.ErrorIs(t, err, ErrServerRedirected)
+
+	info := client.Redirection()
+	require.NotNil(t, info)
+	assert.Equal(t, uint32(3), info.SessionID)
+	assert.Equal(t, []string{"10.0.0.7"}, info.Targets())
+}
+
+func TestConnect_HandshakeMCSUserChannel(t *testing.T) {
+	client, server := newTestServerClient(t, nil)
+
+	require.NoError(t, client.Connect())
+	server.waitActive()
+
+	assert.Empty(t, server.ChannelNames)
+	assert.Equal(t, testServerUserID, client.channelIDMap[mcs.UserChannelName])
+}
+
+func TestConnect_HandshakePresentsClientCertificate(t *testing.T) {
+	client, server := newTestServerClient(t, func(s *testServer) {
+		s.RequireClientCert = true
+	})
+	cert := testServerCertificate(t)
+	client.SetClientCertificate(&cert)
+
+	require.NoError(t, client.Connect())
+	server.waitActive()
+
+	require.NotNil(t, server.ClientCertificate)
+	assert.Equal(t, cert.Certificate[0], server.ClientCertificate.Raw)
+}
+
+func TestConnect_HandshakeHeartbeats(t *testing.T) {
+	client, server := newTestServerClient(t, func(s *testServer) {
+		s.MessageChannel = true
+	})
+	heartbeats := make(chan int, 1)
+	client.SetHeartbeatCallback(func(missed int) { heartbeats <- missed })
+
+	require.NoError(t, client.Connect())
+	server.waitActive()
+
+	assert.True(t, server.RequestedMessageChannel)
+	assert.NotZero(t, server.EarlyCapabilities&pdu.ECFSupportHeartbeatPDU)
+	assert.Contains(t, server.JoinedChannels, testServerMsgChannelID)
+
+	updateDone := make(chan struct{})
+	go func() {
+		defer close(updateDone)
+		_, _ = client.GetUpdate()
+	}()
+	require.NoError(t, server.sendDataOn(testServerMsgChannelID, (&pdu.HeartbeatPDU{Period: 5, Count1: 3, Count2: 5}).Serialize()))
+
+	select {
+	case missed := <-heartbeats:
+		assert.Zero(t, missed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("heartbeat not delivered")
+	}
+	stats := client.HeartbeatStats()
+	assert.Equal(t, 5*time.Second, stats.Period)
+	assert.Equal(t, 1, stats.Received)
+
+	require.NoError(t, client.Close())
+	<-updateDone
+}
+
+func TestConnect_HandshakeStatusInfo(t *testing.T) {
+	client, server := newTestServerClient(t, func(s *testServer) {
+		s.StatusInfo = []uint32{pdu.StatusVMWaking, pdu.StatusBringingSessionOnline}
+	})
+	var statuses []uint32
+	client.SetStatusInfoCallback(func(status pdu.StatusInfoPDUData) {
+		statuses = append(statuses, status.StatusCode)
+	})
+
+	require.NoError(t, client.Connect())
+	server.waitActive()
+
+	assert.NotZero(t, server.EarlyCapabilities&pdu.ECFSupportStatusInfoPDU)
+	assert.Equal(t, []uint32{pdu.StatusVMWaking, pdu.StatusBringingSessionOnline}, statuses)
+	require.NotNil(t, client.StatusInfo())
+	assert.Equal(t, "Bringing the session online", client.StatusInfo().Message())
+	require.NotNil(t, server.ConfirmActive, "the status PDUs should not disturb the capabilities exchange")
+}
+
+func TestConnect_HandshakeAudioDisabled(t *testing.T) {
+	hasSound := func(caps []pdu.CapabilitySet) bool {
+		for _, cap := range caps {
+			if cap.CapabilitySetType == pdu.CapabilitySetTypeSound {
+				return true
+			}
+		}
+		return false
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		client, server := newTestServerClient(t, nil)
+		client.EnableAudio()
+
+		require.NoError(t, client.Connect())
+		server.waitActive()
+
+		assert.Contains(t, server.ChannelNames, audio.ChannelRDPSND)
+		assert.Zero(t, server.InfoFlags&pdu.InfoFlagNoAudioPlayback)
+		require.NotNil(t, server.ConfirmActive)
+		assert.True(t, hasSound(server.ConfirmActive.CapabilitySets))
+		require.NoError(t, client.Close())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		client, server := newTestServerClient(t, nil)
+		client.EnableAudio()
+		client.DisableAudio()
+		client.EnableAudio()
+
+		require.NoError(t, client.Connect())
+		server.waitActive()
+
+		assert.NotContains(t, server.ChannelNames, audio.ChannelRDPSND)
+		assert.NotZero(t, server.InfoFlags&pdu.InfoFlagNoAudioPlayback)
+		require.NotNil(t, server.ConfirmActive)
+		assert.False(t, hasSound(server.ConfirmActive.CapabilitySets), "the sound capability set should not be advertised")
+		assert.Nil(t, client.GetAudioHandler(), "no handler should forward audio")
+		require.NoError(t, client.Close())
+	})
+}
+
+func TestConnect_HandshakeCapsChannels(t *testing.T) {
+	channels := make([]string, 40)
+	for i := range channels {
+		channels[i] = fmt.Sprintf("chan%d", i)
+	}
+
+	t.Run("protocol maximum", func(t *testing.T) {
+		client, server := newTestServerClient(t, nil)
+		client.channels = slices.Clone(channels)
+
+		require.NoError(t, client.Connect())
+		server.waitActive()
+
+		assert.Equal(t, channels[:pdu.MaxStaticChannels], server.ChannelNames)
+		require.NoError(t, client.Close())
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		client, server := newTestServerClient(t, nil)
+		client.channels = slices.Clone(channels)
+		client.SetMaxChannels(2)
+
+		require.NoError(t, client.Connect())
+		server.waitActive()
+
+		assert.Equal(t, channels[:2], server.ChannelNames)
+		// The I/O channel, the user channel and the two virtual channels
+		assert.Len(t, server.JoinedChannels, 4)
+		require.NoError(t, client.Close())
+	})
+}
+
+func TestLimitChannelIDs(t *testing.T) {
+	client := &Client{channels: []string{"rdpsnd", "cliprdr"}}
+	networkData := &pdu.ServerNetworkData{MCSChannelId: 1003, ChannelCount: 5, ChannelIdArray: []uint16{1004, 1005, 1006, 1007, 1008}}
+
+	client.limitChannelIDs(networkData)
+	assert.Equal(t, []uint16{1004, 1005}, networkData.ChannelIdArray)
+	assert.Equal(t, uint16(2), networkData.ChannelCount)
+}
+
+func TestConnect_HandshakeMaxUnacknowledgedFrames(t *testing.T) {
+	client, server := newTestServerClient(t, nil)
+	client.SetMaxUnacknowledgedFrames(6)
+
+	require.NoError(t, client.Connect())
+	server.waitActive()
+
+	require.NotNil(t, server.ConfirmActive)
+	var window uint32
+	for _, set := range server.ConfirmActive.CapabilitySets {
+		if set.FrameAcknowledgeCapabilitySet != nil {
+			window = set.FrameAcknowledgeCapabilitySet.MaxUnacknowledgedFrames
+		}
+	}
+	assert.Equal(t, uint32(6), window)
+}
+
+func TestConnect_HandshakeRejectedVirtualChannel(t *testing.T) {
+	client, server := newTestServerClient(t, func(s *testServer) {
+		s.RejectChannels = []uint16{testServerFirstVChannel}
+	})
+	client.EnableClipboard()
+
+	require.NoError(t, client.Connect())
+	server.waitActive()
+
+	assert.Contains(t, server.JoinedChannels, testServerUserID, "channels after the rejected one are joined")
+	assert.NotContains(t, client.channelIDMap, cliprdr.ChannelName)
+
+	require.NoError(t, client.Close())
+}
+
+func TestConnect_HandshakeRejectedIOChannel(t *testing.T) {
+	client, _ := newTestServerClient(t, func(s *testServer) {
+		s.RejectChannels = []uint16{testServerIOChannelID}
+	})
+
+	err := client.Connect()
+	var rejected *mcs.ErrChannelJoinRejected
+	require.ErrorAs(t, err, &rejected)
+	assert.Equal(t, mcs.GlobalChannelName, rejected.ChannelName)
+	assert.Equal(t, mcs.RTNoSuchChannel, rejected.Reason)
+}
+
+func TestConnect_HandshakeClientIdentity(t *testing.T) {
+	client, server := newTestServerClient(t, nil)
+	require.NoError(t, client.SetClientIdentity(ClientIdentity{
+		Build:       22621,
+		ProductID:   "00330-80000-00000-AA123",
+		OSMajorType: pdu.OSMajorTypeWindows,
+		OSMinorType: pdu.OSMinorTypeWindowsNT,
+	}))
+
+	require.NoError(t, client.Connect())
+	server.waitActive()
+
+	assert.Equal(t, uint32(22621), server.ClientBuild)
+	productID := make([]byte, 64)
+	copy(productID, codec.Encode("00330-80000-00000-AA123"))
+	assert.Equal(t, productID, server.ClientDigProductID)
+
+	require.NotNil(t, server.ConfirmActive)
+	var general *pdu.GeneralCapabilitySet
+	for _, set := range server.ConfirmActive.CapabilitySets {
+		if set.GeneralCapabilitySet != nil {
+			general = set.GeneralCapabilitySet
+		}
+	}
+	require.NotNil(t, general)
+	assert.Equal(t, pdu.OSMajorTypeWindows, general.OSMajorType)
+	assert.Equal(t, pdu.OSMinorTypeWindowsNT, general.OSMinorType)
+}
+
+func TestSetClientIdentity_ProductIDTooLong(t *testing.T) {
+	client := &Client{}
+	assert.Error(t, client.SetClientIdentity(ClientIdentity{ProductID: strings.Repeat("9", 32)}))
+	assert.NoError(t, client.SetClientIdentity(ClientIdentity{ProductID: strings.Repeat("9", 31)}))
+}
+
+func TestConnect_HandshakeLicenseRequest(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	// An X.509 certificate chain of one certificate
+	certificate := binary.LittleEndian.AppendUint32(nil, 0x00000002) // CERT_CHAIN_VERSION_2
+	certificate = binary.LittleEndian.AppendUint32(certificate, 1)
+	certificate = binary.LittleEndian.AppendUint32(certificate, uint32(len(der))) // #nosec G115
+	certificate = append(certificate, der...)
+	certificate = append(certificate, make([]byte, 12)...)
+
+	body := make([]byte, license.RandomLength)                // server random
+	body = binary.LittleEndian.AppendUint32(body, 0x00060000) // dwVersion
+	body = append(body, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00)   // company name
+	body = append(body, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00)   // product ID
+	body = append(body, (&license.Blob{Type: license.BlobKeyExchangeAlg, Data: []byte{0x01, 0x00, 0x00, 0x00}}).Serialize()...)
+	body = append(body, (&license.Blob{Type: license.BlobCertificate, Data: certificate}).Serialize()...)
+	body = append(body, 0x00, 0x00, 0x00, 0x00) // no scopes
+	request := append([]byte{license.MsgTypeLicenseRequest, 0x03}, binary.LittleEndian.AppendUint16(nil, uint16(4+len(body)))...)
+
+	client, server := newTestServerClient(t, func(s *testServer) {
+		s.LicenseRequest = append(request, body...)
+	})
+	client.username = "alice"
+	require.NoError(t, client.Connect())
+	server.waitActive()
+
+	require.NotEmpty(t, server.LicenseReply)
+	assert.Equal(t, license.MsgTypeNewLicenseRequest, server.LicenseReply[0])
+	assert.Contains(t, string(server.LicenseReply), "alice\x00")
+	assert.Contains(t, string(server.LicenseReply), deviceRedirectionClientName+"\x00")
+}
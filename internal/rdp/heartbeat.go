@@ -0,0 +1,134 @@
+package rdp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rcarmo/go-rdp/internal/logging"
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+)
+
+// HeartbeatCallback is called for each Server Heartbeat PDU with the number
+// of heartbeats missed before it
+type HeartbeatCallback func(missed int)
+
+// HeartbeatStats summarizes the Server Heartbeat PDUs of a session
+// (MS-RDPBCGR 2.2.16.1)
+type HeartbeatStats struct {
+	Period   time.Duration // interval announced by the server, zero until the first heartbeat
+	Received int
+	Missed   int // heartbeats that did not arrive on time, including any overdue now
+	Overdue  int // heartbeats missed since the last one arrived
+
+	// Missed heartbeats after which the server expects the client to warn
+	// the user (count1) and to reconnect (count2)
+	WarnAfter      int
+	ReconnectAfter int
+}
+
+// SetHeartbeatCallback sets the function to call when the server sends a
+// heartbeat. Heartbeats are requested during the basic settings exchange, so
+// servers that support them start sending once the session is active.
+func (c *Client) SetHeartbeatCallback(cb HeartbeatCallback) {
+	c.heartbeatCallback = cb
+}
+
+// HeartbeatStats returns the heartbeats received so far and those missed
+// at the period the server announced.
+func (c *Client) HeartbeatStats() HeartbeatStats {
+	return c.heartbeat.stats()
+}
+
+// handleMessageChannel processes a PDU received on the MCS message channel.
+// Only the Server Heartbeat PDU is handled; the channel also carries
+// auto-detect PDUs, which this client does not request.
+func (c *Client) handleMessageChannel(wire io.Reader) {
+	data, err := io.ReadAll(wire)
+	if err != nil || len(data) < 2 {
+		logging.Debug("Message channel: unreadable PDU: %v", err)
+		return
+	}
+	if flags := binary.LittleEndian.Uint16(data); flags&pdu.SecHeartbeat == 0 {
+		logging.Debug("Message channel: ignoring PDU with security flags 0x%04X", flags)
+		return
+	}
+
+	var heartbeat pdu.HeartbeatPDU
+	if err := heartbeat.Deserialize(bytes.NewReader(data)); err != nil {
+		logging.Debug("Message channel: %v", err)
+		return
+	}
+
+	missed := c.heartbeat.receive(heartbeat)
+	if missed > 0 {
+		logging.Warn("Missed %d heartbeat(s) from the RDP server", missed)
+	}
+	if c.heartbeatCallback != nil {
+		c.heartbeatCallback(missed)
+	}
+}
+
+// heartbeatMonitor follows the server heartbeats at the period each one
+// announces. The zero value is ready to use and reads the time from time.Now.
+type heartbeatMonitor struct {
+	mu  sync.Mutex
+	now func() time.Time // overrides time.Now in tests
+
+	period         time.Duration
+	warnAfter      int
+	reconnectAfter int
+	last           time.Time
+	received       int
+	missed         int
+}
+
+func (m *heartbeatMonitor) clock() time.Time {
+	if m.now != nil {
+		return m.now()
+	}
+	return time.Now()
+}
+
+// receive records a heartbeat, adopting the period and thresholds it
+// carries, and returns how many heartbeats were missed before it.
+func (m *heartbeatMonitor) receive(p pdu.HeartbeatPDU) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.clock()
+	missed := m.overdue(now)
+	m.missed += missed
+	m.received++
+	m.last = now
+	m.period = time.Duration(p.Period) * time.Second
+	m.warnAfter = int(p.Count1)
+	m.reconnectAfter = int(p.Count2)
+	return missed
+}
+
+// overdue returns the heartbeats missed since the last one. A heartbeat
+// counts as missed once the next one is due, so a late heartbeat is not.
+func (m *heartbeatMonitor) overdue(now time.Time) int {
+	if m.period <= 0 || m.last.IsZero() {
+		return 0
+	}
+	return max(0, int(now.Sub(m.last)/m.period)-1)
+}
+
+func (m *heartbeatMonitor) stats() HeartbeatStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	overdue := m.overdue(m.clock())
+	return HeartbeatStats{
+		Period:         m.period,
+		Received:       m.received,
+		Missed:         m.missed + overdue,
+		Overdue:        overdue,
+		WarnAfter:      m.warnAfter,
+		ReconnectAfter: m.reconnectAfter,
+	}
+}
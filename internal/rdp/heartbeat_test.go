@@ -0,0 +1,132 @@
+package rdp
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/go-rdp/internal/codec"
+	"github.com/rcarmo/go-rdp/internal/protocol/mcs"
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// heartbeatClock is a manually advanced clock for the heartbeat monitor
+type heartbeatClock struct{ now time.Time }
+
+func (c *heartbeatClock) Now() time.Time { return c.now }
+
+func (c *heartbeatClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func TestHeartbeatMonitor_Timing(t *testing.T) {
+	clock := &heartbeatClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	m := heartbeatMonitor{now: clock.Now}
+	beat := pdu.HeartbeatPDU{Period: 10, Count1: 3, Count2: 5}
+
+	assert.Zero(t, m.receive(beat), "nothing is missed before the first heartbeat")
+	assert.Equal(t, HeartbeatStats{Period: 10 * time.Second, Received: 1, WarnAfter: 3, ReconnectAfter: 5}, m.stats())
+
+	// Heartbeats on time or slightly late are not missed
+	clock.Advance(10 * time.Second)
+	assert.Zero(t, m.receive(beat))
+	clock.Advance(19 * time.Second)
+	assert.Zero(t, m.receive(beat))
+
+	// Two heartbeats go missing
+	clock.Advance(30 * time.Second)
+	assert.Equal(t, 2, m.receive(beat))
+	assert.Equal(t, 2, m.stats().Missed)
+
+	// Overdue heartbeats are reported before the next one arrives
+	clock.Advance(25 * time.Second)
+	stats := m.stats()
+	assert.Equal(t, 3, stats.Missed)
+	assert.Equal(t, 1, stats.Overdue, "only the heartbeats missed since the last one are overdue")
+	assert.Equal(t, 4, stats.Received)
+
+	// The next heartbeat clears the overdue count
+	m.receive(beat)
+	assert.Zero(t, m.stats().Overdue)
+}
+
+func TestHeartbeatMonitor_AdoptsServerPeriod(t *testing.T) {
+	clock := &heartbeatClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	m := heartbeatMonitor{now: clock.Now}
+
+	m.receive(pdu.HeartbeatPDU{Period: 5})
+	clock.Advance(10 * time.Second)
+	assert.Equal(t, 1, m.stats().Missed)
+
+	// The server slows down: the new period applies from this heartbeat on
+	m.receive(pdu.HeartbeatPDU{Period: 30})
+	clock.Advance(40 * time.Second)
+	assert.Equal(t, 1, m.stats().Missed)
+	assert.Equal(t, 30*time.Second, m.stats().Period)
+
+	// A zero period disables missed heartbeat accounting
+	m.receive(pdu.HeartbeatPDU{Period: 0})
+	clock.Advance(time.Hour)
+	assert.Equal(t, 1, m.stats().Missed)
+}
+
+func TestGetX224Update_MessageChannelHeartbeat(t *testing.T) {
+	heartbeat := (&pdu.HeartbeatPDU{Period: 5, Count1: 2, Count2: 4}).Serialize()
+	autoDetect := codec.WrapSecurityFlag(0x1000, []byte{0x06, 0x00, 0x01, 0x00, 0x00, 0x10}) // SEC_AUTODETECT_REQ
+
+	for _, data := range [][]byte{heartbeat, autoDetect} {
+		client := &Client{
+			channelIDMap: map[string]uint16{mcs.GlobalChannelName: 1003, mcs.MessageChannelName: 1010},
+			mcsLayer: &MockMCSLayer{
+				ReceiveFunc: func() (uint16, io.Reader, error) {
+					return 1010, bytes.NewReader(data), nil
+				},
+			},
+		}
+		var calls []int
+		client.SetHeartbeatCallback(func(missed int) { calls = append(calls, missed) })
+
+		update, err := client.getX224Update()
+		require.NoError(t, err)
+		assert.Nil(t, update)
+
+		if bytes.Equal(data, heartbeat) {
+			assert.Equal(t, []int{0}, calls)
+			assert.Equal(t, 1, client.HeartbeatStats().Received)
+			assert.Equal(t, 2, client.HeartbeatStats().WarnAfter)
+		} else {
+			assert.Empty(t, calls, "other message channel PDUs are ignored")
+			assert.Zero(t, client.HeartbeatStats().Received)
+		}
+	}
+}
+
+func TestBasicSettingsExchange_RequestsMessageChannel(t *testing.T) {
+	var sent []byte
+	mockMCS := &MockMCSLayer{
+		ConnectFunc: func(userData []byte) (io.Reader, error) {
+			sent = userData
+			serverData := createTestServerUserDataResponse(t)
+			serverData = append(serverData, 0x04, 0x0C, 0x06, 0x00, 0xF2, 0x03) // SC_MCS_MSGCHANNEL, channel 1010
+			return bytes.NewReader(serverData), nil
+		},
+	}
+	client := &Client{
+		desktopWidth:  1024,
+		desktopHeight: 768,
+		colorDepth:    16,
+		channelIDMap:  make(map[string]uint16),
+		mcsLayer:      mockMCS,
+	}
+
+	require.NoError(t, client.basicSettingsExchange())
+
+	assert.True(t, bytes.HasSuffix(sent, pdu.ClientMessageChannelData{}.Serialize()))
+	// earlyCapabilityFlags follows 140 bytes of CS_CORE fields after the block header
+	flags := uint16(sent[4+140]) | uint16(sent[4+141])<<8
+	assert.NotZero(t, flags&pdu.ECFSupportHeartbeatPDU)
+
+	assert.Equal(t, uint16(1010), client.channelIDMap[mcs.MessageChannelName])
+	assert.Equal(t, map[string]uint16{mcs.MessageChannelName: 1010}, mockMCS.SetChannelCalls)
+}
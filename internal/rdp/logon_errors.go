@@ -0,0 +1,35 @@
+package rdp
+
+import (
+	"github.com/rcarmo/go-rdp/internal/logging"
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+)
+
+// LogonErrorCallback is called with each logon error notification sent by the server
+type LogonErrorCallback func(info pdu.LogonErrorsInfo)
+
+// SetLogonErrorCallback sets the function to call when the server reports a
+// logon error or notification in a Save Session Info PDU
+func (c *Client) SetLogonErrorCallback(cb LogonErrorCallback) {
+	c.logonErrorCallback = cb
+}
+
+// LogonError returns the last logon error notification sent by the server,
+// or nil if none has been received. It may arrive during connection
+// finalization, before a callback is set.
+func (c *Client) LogonError() *pdu.LogonErrorsInfo {
+	return c.logonError
+}
+
+// handleLogonErrors records a logon error notification and reports it to the callback
+func (c *Client) handleLogonErrors(info *pdu.LogonErrorsInfo) {
+	if info.Failed() {
+		logging.Warn("Logon error from RDP server: %s", info)
+	} else {
+		logging.Info("Logon notification from RDP server: %s", info)
+	}
+	c.logonError = info
+	if c.logonErrorCallback != nil {
+		c.logonErrorCallback(*info)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"io"
+	"slices"
 	"testing"
 
 	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
@@ -19,7 +20,7 @@ type testMCSLayer struct {
 	connectFunc     func(userData []byte) (io.Reader, error)
 	erectDomainFunc func() error
 	attachUserFunc  func() (uint16, error)
-	joinChannelsFunc func(userID uint16, channelIDMap map[string]uint16) error
+	joinChannelsFunc func(userID uint16) error
 	
 	sendCalls []sendCall
 }
@@ -66,13 +67,21 @@ func (m *testMCSLayer) AttachUser() (uint16, error) {
 	return 1001, nil
 }
 
-func (m *testMCSLayer) JoinChannels(userID uint16, channelIDMap map[string]uint16) error {
+func (m *testMCSLayer) SetChannels(names []string, globalID uint16, ids []uint16) {}
+
+func (m *testMCSLayer) SetChannel(name string, id uint16) {}
+
+func (m *testMCSLayer) JoinChannels(userID uint16) error {
 	if m.joinChannelsFunc != nil {
-		return m.joinChannelsFunc(userID, channelIDMap)
+		return m.joinChannelsFunc(userID)
 	}
 	return nil
 }
 
+func (m *testMCSLayer) Disconnect(reason uint8) error {
+	return nil
+}
+
 // Test capabilitiesExchange with mock MCS layer
 func TestClient_capabilitiesExchange_Success(t *testing.T) {
 	// Build a ServerDemandActive PDU response
@@ -112,6 +121,117 @@ func TestClient_capabilitiesExchange_Success(t *testing.T) {
 	assert.Len(t, mockMCS.sendCalls, 1)
 }
 
+// Test capabilitiesExchange advertises the configured RemoteFX mode
+func TestClient_capabilitiesExchange_RFXMode(t *testing.T) {
+	demandActive := new(bytes.Buffer)
+	_ = binary.Write(demandActive, binary.LittleEndian, uint16(40))     // totalLength
+	_ = binary.Write(demandActive, binary.LittleEndian, uint16(0x11))   // pduType (demand active)
+	_ = binary.Write(demandActive, binary.LittleEndian, uint16(1001))   // pduSource
+	_ = binary.Write(demandActive, binary.LittleEndian, uint32(0x1234)) // shareId
+	_ = binary.Write(demandActive, binary.LittleEndian, uint16(4))      // lengthSourceDescriptor
+	demandActive.Write([]byte("RDP\x00"))
+	_ = binary.Write(demandActive, binary.LittleEndian, uint16(4)) // lengthCombinedCapabilities
+	_ = binary.Write(demandActive, binary.LittleEndian, uint16(0)) // numberCapabilities
+	_ = binary.Write(demandActive, binary.LittleEndian, uint16(0)) // pad2Octets
+	_ = binary.Write(demandActive, binary.LittleEndian, uint32(0)) // sessionId
+
+	tests := []struct {
+		name  string
+		mode  pdu.RFXCodecMode
+		guid  [16]byte
+		other [16]byte
+	}{
+		{"image", pdu.RFXCodecModeImage, pdu.RemoteFXImageGUID, pdu.RemoteFXGUID},
+		{"video", pdu.RFXCodecModeVideo, pdu.RemoteFXGUID, pdu.RemoteFXImageGUID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMCS := &testMCSLayer{
+				receiveFunc: func() (uint16, io.Reader, error) {
+					return 1003, bytes.NewReader(demandActive.Bytes()), nil
+				},
+			}
+			client := &Client{
+				mcsLayer:      mockMCS,
+				userID:        1001,
+				channelIDMap:  map[string]uint16{"global": 1003},
+				desktopWidth:  1024,
+				desktopHeight: 768,
+			}
+			client.SetEnableRFX(true)
+			client.SetRFXMode(tt.mode)
+
+			require.NoError(t, client.capabilitiesExchange())
+			require.Len(t, mockMCS.sendCalls, 1)
+
+			sent := mockMCS.sendCalls[0].data
+			codecs := pdu.NewBitmapCodecsWithRFXModeCapabilitySet(tt.mode)
+			want := codecs.Serialize()
+			assert.True(t, bytes.Contains(sent, want), "confirm active should carry the RFX codec caps")
+			assert.True(t, bytes.Contains(sent, tt.guid[:]))
+			assert.False(t, bytes.Contains(sent, tt.other[:]))
+		})
+	}
+}
+
+// Test capabilitiesExchange advertises only the forced codec
+func TestClient_capabilitiesExchange_ForcedCodec(t *testing.T) {
+	demandActive := new(bytes.Buffer)
+	_ = binary.Write(demandActive, binary.LittleEndian, uint16(40))     // totalLength
+	_ = binary.Write(demandActive, binary.LittleEndian, uint16(0x11))   // pduType (demand active)
+	_ = binary.Write(demandActive, binary.LittleEndian, uint16(1001))   // pduSource
+	_ = binary.Write(demandActive, binary.LittleEndian, uint32(0x1234)) // shareId
+	_ = binary.Write(demandActive, binary.LittleEndian, uint16(4))      // lengthSourceDescriptor
+	demandActive.Write([]byte("RDP\x00"))
+	_ = binary.Write(demandActive, binary.LittleEndian, uint16(4)) // lengthCombinedCapabilities
+	_ = binary.Write(demandActive, binary.LittleEndian, uint16(0)) // numberCapabilities
+	_ = binary.Write(demandActive, binary.LittleEndian, uint16(0)) // pad2Octets
+	_ = binary.Write(demandActive, binary.LittleEndian, uint32(0)) // sessionId
+
+	tests := []struct {
+		name       string
+		forced     ForcedCodec
+		enableRFX  bool
+		advertised []string
+	}{
+		{"auto without RFX", ForcedCodecAuto, false, nil},
+		{"auto with RFX", ForcedCodecAuto, true, []string{"NSCodec", "RemoteFX-Image"}},
+		{"nscodec", ForcedCodecNSCodec, true, []string{"NSCodec"}},
+		{"rfx", ForcedCodecRFX, false, []string{"RemoteFX-Image"}},
+		{"none", ForcedCodecNone, true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMCS := &testMCSLayer{
+				receiveFunc: func() (uint16, io.Reader, error) {
+					return 1003, bytes.NewReader(demandActive.Bytes()), nil
+				},
+			}
+			client := &Client{
+				mcsLayer:      mockMCS,
+				userID:        1001,
+				channelIDMap:  map[string]uint16{"global": 1003},
+				desktopWidth:  1024,
+				desktopHeight: 768,
+				rfxMode:       pdu.RFXCodecModeImage,
+			}
+			client.SetEnableRFX(tt.enableRFX)
+			client.SetForcedCodec(tt.forced)
+
+			require.NoError(t, client.capabilitiesExchange())
+			require.Len(t, mockMCS.sendCalls, 1)
+			assert.Equal(t, tt.advertised, client.advertisedCodecs)
+			assert.Equal(t, tt.advertised, client.GetServerCapabilities().AdvertisedCodecs)
+
+			sent := mockMCS.sendCalls[0].data
+			assert.Equal(t, slices.Contains(tt.advertised, "NSCodec"), bytes.Contains(sent, pdu.NSCodecGUID[:]))
+			assert.Equal(t, slices.Contains(tt.advertised, "RemoteFX-Image"), bytes.Contains(sent, pdu.RemoteFXImageGUID[:]))
+		})
+	}
+}
+
 // Test capabilitiesExchange with receive error
 func TestClient_capabilitiesExchange_ReceiveError(t *testing.T) {
 	mockMCS := &testMCSLayer{
@@ -196,7 +316,7 @@ func TestClient_channelConnection_AttachUserError(t *testing.T) {
 // Test channelConnection with JoinChannels error
 func TestClient_channelConnection_JoinChannelsError(t *testing.T) {
 	mockMCS := &testMCSLayer{
-		joinChannelsFunc: func(userID uint16, channelIDMap map[string]uint16) error {
+		joinChannelsFunc: func(userID uint16) error {
 			return errors.New("join channels error")
 		},
 	}
@@ -0,0 +1,74 @@
+package rdp
+
+import (
+	"github.com/rcarmo/go-rdp/internal/logging"
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+)
+
+// MonitorLayoutCallback is called with the monitor layout sent by the server
+type MonitorLayoutCallback func(monitors []pdu.MonitorDef)
+
+// SetMonitorLayoutCallback sets the function to call when the server sends a
+// Monitor Layout PDU during the session
+func (c *Client) SetMonitorLayoutCallback(cb MonitorLayoutCallback) {
+	c.monitorLayoutCallback = cb
+}
+
+// SetPrimaryMonitorOnly clamps the session to a single primary monitor: the
+// client advertises one monitor covering the desktop and keeps only the primary
+// monitor of any layout the server sends. It must be called before Connect.
+func (c *Client) SetPrimaryMonitorOnly(enabled bool) {
+	c.primaryMonitorOnly = enabled
+}
+
+// SetMonitors advertises a multi-monitor desktop in the client monitor data
+// and sizes the desktop to the bounding box of the monitors. It must be called
+// before Connect, and has no effect when SetPrimaryMonitorOnly is enabled.
+func (c *Client) SetMonitors(monitors []pdu.MonitorDef) error {
+	monitorData, err := pdu.NewClientMonitorData(monitors)
+	if err != nil {
+		return err
+	}
+	width, height := monitorData.DesktopSize()
+	c.monitorData = monitorData
+	c.desktopWidth = uint16(width)   // #nosec G115 -- bounded by MaxMonitorDimension
+	c.desktopHeight = uint16(height) // #nosec G115 -- bounded by MaxMonitorDimension
+	return nil
+}
+
+// GetMonitorLayout returns the last monitor layout sent by the server, or nil
+// if none has been received. Servers send it during connection finalization
+// when multiple monitors were negotiated.
+func (c *Client) GetMonitorLayout() []pdu.MonitorDef {
+	return c.monitorLayout
+}
+
+// handleMonitorLayout records a Monitor Layout PDU and reports it to the callback
+func (c *Client) handleMonitorLayout(layout *pdu.MonitorLayoutPDUData) {
+	if layout == nil {
+		return
+	}
+	logging.Debug("Monitor layout: %d monitor(s)", len(layout.Monitors))
+	monitors := layout.Monitors
+	if c.primaryMonitorOnly {
+		monitors = primaryMonitor(monitors)
+	}
+	c.monitorLayout = monitors
+	if c.monitorLayoutCallback != nil {
+		c.monitorLayoutCallback(monitors)
+	}
+}
+
+// primaryMonitor returns a layout holding only the primary monitor, or the
+// first monitor if none is flagged primary
+func primaryMonitor(monitors []pdu.MonitorDef) []pdu.MonitorDef {
+	for _, m := range monitors {
+		if m.IsPrimary() {
+			return []pdu.MonitorDef{m}
+		}
+	}
+	if len(monitors) > 0 {
+		return monitors[:1]
+	}
+	return monitors
+}
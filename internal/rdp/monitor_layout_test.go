@@ -0,0 +1,252 @@
+package rdp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/rcarmo/go-rdp/internal/protocol/drdynvc"
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+	"github.com/rcarmo/go-rdp/internal/protocol/rdpedisp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dualMonitorLayout is a 1920x1080 primary with a 1280x1024 monitor to its right
+var dualMonitorLayout = []pdu.MonitorDef{
+	{Left: 0, Top: 0, Right: 1919, Bottom: 1079, Flags: pdu.MonitorFlagPrimary},
+	{Left: 1920, Top: 0, Right: 3199, Bottom: 1023},
+}
+
+// buildServerDataPDU wraps body in share control and share data headers
+func buildServerDataPDU(pduType2 pdu.Type2, body []byte) []byte {
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, binary.LittleEndian, uint16(18+len(body))) // totalLength
+	_ = binary.Write(buf, binary.LittleEndian, uint16(0x17))         // PDUTYPE_DATAPDU
+	_ = binary.Write(buf, binary.LittleEndian, uint16(1002))         // pduSource
+	_ = binary.Write(buf, binary.LittleEndian, uint32(0x12345678))   // shareId
+	_ = binary.Write(buf, binary.LittleEndian, uint8(0))             // pad1
+	_ = binary.Write(buf, binary.LittleEndian, uint8(1))             // streamId
+	_ = binary.Write(buf, binary.LittleEndian, uint16(4+len(body)))  // uncompressedLength
+	_ = binary.Write(buf, binary.LittleEndian, uint8(pduType2))
+	_ = binary.Write(buf, binary.LittleEndian, uint8(0))  // compressedType
+	_ = binary.Write(buf, binary.LittleEndian, uint16(0)) // compressedLength
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+func buildMonitorLayoutBody(monitors []pdu.MonitorDef) []byte {
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, binary.LittleEndian, uint32(len(monitors)))
+	for _, m := range monitors {
+		_ = binary.Write(buf, binary.LittleEndian, m)
+	}
+	return buf.Bytes()
+}
+
+func TestConnectionFinalization_MonitorLayout(t *testing.T) {
+	control := func(action uint16) []byte {
+		return append(binary.LittleEndian.AppendUint16(nil, action), 0, 0, 0, 0, 0, 0)
+	}
+	pdus := [][]byte{
+		buildServerDataPDU(pdu.Type2MonitorLayout, buildMonitorLayoutBody(dualMonitorLayout)),
+		buildServerDataPDU(pdu.Type2Synchronize, []byte{0x01, 0x00, 0xE9, 0x03}),
+		buildServerDataPDU(pdu.Type2Control, control(uint16(pdu.ControlActionCooperate))),
+		buildServerDataPDU(pdu.Type2Control, control(uint16(pdu.ControlActionGrantedControl))),
+		buildServerDataPDU(pdu.Type2Fontmap, make([]byte, 8)),
+	}
+
+	mockMCS := &testMCSLayer{
+		receiveFunc: func() (uint16, io.Reader, error) {
+			if len(pdus) == 0 {
+				return 0, nil, io.EOF
+			}
+			next := pdus[0]
+			pdus = pdus[1:]
+			return 1003, bytes.NewReader(next), nil
+		},
+	}
+
+	client := &Client{
+		mcsLayer:     mockMCS,
+		shareID:      0x12345678,
+		userID:       1001,
+		channelIDMap: map[string]uint16{"global": 1003},
+	}
+
+	require.NoError(t, client.connectionFinalization())
+	assert.Equal(t, dualMonitorLayout, client.GetMonitorLayout())
+}
+
+func TestGetX224Update_MonitorLayout(t *testing.T) {
+	wire := buildServerDataPDU(pdu.Type2MonitorLayout, buildMonitorLayoutBody(dualMonitorLayout))
+	client := &Client{
+		channelIDMap: map[string]uint16{"global": 1003},
+		mcsLayer: &MockMCSLayer{
+			ReceiveFunc: func() (uint16, io.Reader, error) {
+				return 1003, bytes.NewReader(wire), nil
+			},
+		},
+	}
+
+	var got []pdu.MonitorDef
+	client.SetMonitorLayoutCallback(func(monitors []pdu.MonitorDef) {
+		got = monitors
+	})
+
+	update, err := client.getX224Update()
+	require.NoError(t, err)
+	assert.Nil(t, update)
+	assert.Equal(t, dualMonitorLayout, got)
+	assert.Equal(t, dualMonitorLayout, client.GetMonitorLayout())
+}
+
+func TestGetX224Update_MalformedMonitorLayout(t *testing.T) {
+	// Count claims two monitors but none follow; the PDU is logged and dropped
+	wire := buildServerDataPDU(pdu.Type2MonitorLayout, []byte{0x02, 0x00, 0x00, 0x00})
+	client := &Client{
+		channelIDMap: map[string]uint16{"global": 1003},
+		mcsLayer: &MockMCSLayer{
+			ReceiveFunc: func() (uint16, io.Reader, error) {
+				return 1003, bytes.NewReader(wire), nil
+			},
+		},
+	}
+	client.SetMonitorLayoutCallback(func([]pdu.MonitorDef) {
+		t.Fatal("callback should not run for a malformed layout")
+	})
+
+	update, err := client.getX224Update()
+	require.NoError(t, err)
+	assert.Nil(t, update)
+	assert.Nil(t, client.GetMonitorLayout())
+}
+
+func TestBasicSettingsExchange_PrimaryMonitorOnly(t *testing.T) {
+	serverUserData := createTestServerUserDataResponse(t)
+	exchange := func(primaryOnly bool) []byte {
+		var sent []byte
+		client := &Client{
+			selectedProtocol: pdu.NegotiationProtocolSSL,
+			desktopWidth:     1920,
+			desktopHeight:    1080,
+			colorDepth:       24,
+			channelIDMap:     make(map[string]uint16),
+			mcsLayer: &MockMCSLayer{
+				ConnectFunc: func(userData []byte) (io.Reader, error) {
+					sent = userData
+					return bytes.NewReader(serverUserData), nil
+				},
+			},
+		}
+		client.SetPrimaryMonitorOnly(primaryOnly)
+		require.NoError(t, client.basicSettingsExchange())
+		return sent
+	}
+
+	csMonitor := []byte{0x05, 0xC0}
+	assert.NotContains(t, string(exchange(false)), string(csMonitor), "no monitor data by default")
+
+	// CS_MONITOR follows the other blocks, before only CS_MCS_MSGCHANNEL, and
+	// describes exactly one primary monitor
+	sent := exchange(true)
+	single := pdu.NewSingleMonitorData(1920, 1080).Serialize()
+	msgChannel := pdu.ClientMessageChannelData{}.Serialize()
+	require.True(t, bytes.HasSuffix(sent, append(single, msgChannel...)))
+	assert.Equal(t, uint32(1), binary.LittleEndian.Uint32(single[8:12]), "monitorCount")
+}
+
+func TestBasicSettingsExchange_Monitors(t *testing.T) {
+	var sent []byte
+	client := &Client{
+		desktopWidth:  800,
+		desktopHeight: 600,
+		colorDepth:    24,
+		channelIDMap:  make(map[string]uint16),
+		mcsLayer: &MockMCSLayer{
+			ConnectFunc: func(userData []byte) (io.Reader, error) {
+				sent = userData
+				return bytes.NewReader(createTestServerUserDataResponse(t)), nil
+			},
+		},
+	}
+
+	require.Error(t, client.SetMonitors(dualMonitorLayout[1:]), "no primary monitor")
+	require.NoError(t, client.SetMonitors(dualMonitorLayout))
+	assert.Equal(t, uint16(3200), client.desktopWidth)
+	assert.Equal(t, uint16(1080), client.desktopHeight)
+
+	require.NoError(t, client.basicSettingsExchange())
+	monitors := pdu.ClientMonitorData{Monitors: dualMonitorLayout}.Serialize()
+	msgChannel := pdu.ClientMessageChannelData{}.Serialize()
+	require.True(t, bytes.HasSuffix(sent, append(monitors, msgChannel...)))
+
+	// The core data carries the bounding box as the desktop size
+	core := pdu.NewClientUserDataSet(0, 3200, 1080, 24, nil).ClientCoreData.Serialize()
+	assert.Equal(t, core[8:12], sent[8:12])
+}
+
+func TestHandleMonitorLayout_PrimaryMonitorOnly(t *testing.T) {
+	secondaryFirst := []pdu.MonitorDef{dualMonitorLayout[1], dualMonitorLayout[0]}
+
+	client := &Client{}
+	client.SetPrimaryMonitorOnly(true)
+
+	var got []pdu.MonitorDef
+	client.SetMonitorLayoutCallback(func(monitors []pdu.MonitorDef) {
+		got = monitors
+	})
+
+	client.handleMonitorLayout(&pdu.MonitorLayoutPDUData{Monitors: secondaryFirst})
+	assert.Equal(t, dualMonitorLayout[:1], got)
+	assert.Equal(t, dualMonitorLayout[:1], client.GetMonitorLayout())
+
+	// Without a primary flag the first monitor is kept
+	noPrimary := []pdu.MonitorDef{dualMonitorLayout[1], {Left: -1024, Right: -1, Bottom: 767}}
+	client.handleMonitorLayout(&pdu.MonitorLayoutPDUData{Monitors: noPrimary})
+	assert.Equal(t, noPrimary[:1], got)
+}
+
+func TestGetDisplayControlCapabilities_PrimaryMonitorOnly(t *testing.T) {
+	client := &Client{displayControl: &DisplayControlHandler{
+		caps: &rdpedisp.CapsPDU{MaxNumMonitors: 16, MaxMonitorAreaFactorA: 8192, MaxMonitorAreaFactorB: 8192},
+	}}
+
+	maxMonitors, maxArea := client.GetDisplayControlCapabilities()
+	assert.Equal(t, uint32(16), maxMonitors)
+	assert.Equal(t, uint64(16*8192*8192), maxArea)
+
+	client.SetPrimaryMonitorOnly(true)
+	maxMonitors, maxArea = client.GetDisplayControlCapabilities()
+	assert.Equal(t, uint32(1), maxMonitors)
+	assert.Equal(t, uint64(16*8192*8192), maxArea)
+}
+
+func TestDisplayControl_RequestResizeClampsToCaps(t *testing.T) {
+	mockMCS := &MockMCSLayer{}
+	client := &Client{userID: 1001, mcsLayer: mockMCS}
+	h := NewDisplayControlHandler(client)
+	h.Initialize(1009)
+	h.dispChannelID = 1
+	h.ready = true
+	h.caps = &rdpedisp.CapsPDU{MaxNumMonitors: 1, MaxMonitorAreaFactorA: 1920, MaxMonitorAreaFactorB: 1080}
+
+	require.NoError(t, h.RequestResize(3841, 2160))
+	require.Len(t, mockMCS.SendCalls, 1)
+
+	// [length:4] [flags:4] [DYNVC_DATA]
+	data := mockMCS.SendCalls[0].Data
+	require.Greater(t, len(data), 8)
+	_, cbChID, remaining, err := drdynvc.ParsePDU(data[8:])
+	require.NoError(t, err)
+	channelID, layoutData, err := drdynvc.ReadChannelID(remaining, cbChID)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), channelID)
+
+	var layout rdpedisp.MonitorLayoutPDU
+	require.NoError(t, layout.Deserialize(bytes.NewReader(layoutData)))
+	require.Len(t, layout.Monitors, 1)
+	assert.Equal(t, uint32(1920), layout.Monitors[0].Width)
+	assert.Equal(t, uint32(1079), layout.Monitors[0].Height)
+}
@@ -49,19 +49,24 @@ func readNLAMessage(r io.Reader, maxSize int) ([]byte, error) {
 	return buf, nil
 }
 
-// StartNLA performs Network Level Authentication using CredSSP/NTLMv2
+// StartNLA performs Network Level Authentication using CredSSP, over NTLMv2
+// or Kerberos as selected with SetNLAMechanism
 func (c *Client) StartNLA() error {
 	// First, establish TLS connection
 	if err := c.startTLSForNLA(); err != nil {
 		return fmt.Errorf("NLA TLS setup failed: %w", err)
 	}
+	c.reachPhase(PhaseTLSHandshakeDone)
 
 	// Parse domain from username if present (DOMAIN\user or user@domain)
 	domain, user := c.parseDomainUser()
 	logging.Debug("NLA: Authenticating user")
 
-	// Create NTLMv2 context
-	ntlmCtx := auth.NewNTLMv2(domain, user, c.password)
+	// Create the NTLMv2 or Kerberos context
+	nlaCtx, err := c.newNLAContext(domain, user)
+	if err != nil {
+		return fmt.Errorf("NLA: %w", err)
+	}
 
 	// Generate client nonce (32 bytes) - required for version 5+
 	clientNonce := make([]byte, 32)
@@ -69,11 +74,14 @@ func (c *Client) StartNLA() error {
 		return fmt.Errorf("NLA: failed to generate nonce: %w", err)
 	}
 
-	// Step 1: Send NTLM Negotiate message with client nonce
-	negoMsg := ntlmCtx.GetNegotiateMessage()
+	// Step 1: Send the NTLM Negotiate message or Kerberos AP-REQ with client nonce
+	negoMsg, err := nlaCtx.initialToken()
+	if err != nil {
+		return fmt.Errorf("NLA: failed to build negotiate message: %w", err)
+	}
 	tsReq := auth.EncodeTSRequestWithNonce([][]byte{negoMsg}, nil, nil, clientNonce)
 
-	if _, err := c.conn.Write(tsReq); err != nil {
+	if _, err := c.Write(tsReq); err != nil {
 		return fmt.Errorf("NLA: failed to send negotiate message: %w", err)
 	}
 	logging.Debug("NLA: Sent negotiate message (%d bytes)", len(tsReq))
@@ -101,10 +109,11 @@ func (c *Client) StartNLA() error {
 		return fmt.Errorf("NLA: no challenge token received from server")
 	}
 
-	// Step 3: Process challenge and get authenticate message
-	authMsg, ntlmSec := ntlmCtx.GetAuthenticateMessage(tsResp.NegoTokens[0].Data)
-	if authMsg == nil || ntlmSec == nil {
-		return fmt.Errorf("NLA: failed to generate authenticate message")
+	// Step 3: Process the challenge or AP-REP; NTLM answers with an
+	// authenticate message, Kerberos has nothing more to send
+	authMsg, gssSec, err := nlaCtx.accept(tsResp.NegoTokens[0].Data)
+	if err != nil {
+		return fmt.Errorf("NLA: %w: %w", ErrAuthenticationFailed, err)
 	}
 
 	// Get the server's public key from the TLS connection
@@ -126,7 +135,10 @@ func (c *Client) StartNLA() error {
 		logging.Debug("NLA: Using version %d raw pubKey", tsResp.Version)
 	}
 
-	encryptedPubKey := ntlmSec.GssEncrypt(pubKeyData)
+	encryptedPubKey := gssSec.GssEncrypt(pubKeyData)
+	if encryptedPubKey == nil {
+		return fmt.Errorf("NLA: failed to encrypt pubKeyAuth")
+	}
 	logging.Debug("NLA: Encrypted pubKeyAuth len=%d", len(encryptedPubKey))
 
 	// Send authenticate message with encrypted public key and optional client nonce.
@@ -135,8 +147,12 @@ func (c *Client) StartNLA() error {
 	if negotiatedVersion >= 5 {
 		authClientNonce = clientNonce
 	}
-	tsReq = auth.EncodeTSRequestWithVersion(negotiatedVersion, [][]byte{authMsg}, nil, encryptedPubKey, authClientNonce)
-	if _, err := c.conn.Write(tsReq); err != nil {
+	var authTokens [][]byte
+	if authMsg != nil {
+		authTokens = [][]byte{authMsg}
+	}
+	tsReq = auth.EncodeTSRequestWithVersion(negotiatedVersion, authTokens, nil, encryptedPubKey, authClientNonce)
+	if _, err := c.Write(tsReq); err != nil {
 		return fmt.Errorf("NLA: failed to send authenticate message: %w", err)
 	}
 	logging.Debug("NLA: Sent authenticate message (%d bytes)", len(tsReq))
@@ -144,7 +160,7 @@ func (c *Client) StartNLA() error {
 	// Step 4: Receive public key verification from server (with size limit)
 	resp, err = readNLAMessage(c.conn, maxNLAMessageSize)
 	if err != nil {
-		return fmt.Errorf("NLA: failed to read public key response: %w", err)
+		return fmt.Errorf("NLA: failed to read public key response: %w: %w", ErrAuthenticationFailed, err)
 	}
 	logging.Debug("NLA: Received public key response (%d bytes)", len(resp))
 
@@ -152,10 +168,14 @@ func (c *Client) StartNLA() error {
 	if err != nil {
 		return fmt.Errorf("NLA: failed to decode public key response: %w", err)
 	}
+	if tsResp.ErrorCode != 0 {
+		// CredSSP v3+ servers report a rejected logon here instead of pubKeyAuth
+		return fmt.Errorf("NLA: %w: server returned error code: 0x%08X", ErrAuthenticationFailed, tsResp.ErrorCode)
+	}
 
 	// Verify server's pubKeyAuth (for version 5+, this is a hash; for earlier versions, pubKey+1)
 	if len(tsResp.PubKeyAuth) > 0 {
-		decryptedPubKeyAuth := ntlmSec.GssDecrypt(tsResp.PubKeyAuth)
+		decryptedPubKeyAuth := gssSec.GssDecrypt(tsResp.PubKeyAuth)
 		if decryptedPubKeyAuth == nil {
 			return fmt.Errorf("NLA: failed to decrypt server pubKeyAuth")
 		}
@@ -171,13 +191,16 @@ func (c *Client) StartNLA() error {
 
 	// Step 5: Send credentials
 	// Per MS-CSSP, TSPasswordCreds MUST be UTF-16LE encoded
-	domainBytes, userBytes, passBytes := ntlmCtx.GetCredSSPCredentials()
+	domainBytes, userBytes, passBytes := nlaCtx.credentials()
 	credentials := auth.EncodeCredentials(domainBytes, userBytes, passBytes)
-	encryptedCreds := ntlmSec.GssEncrypt(credentials)
+	encryptedCreds := gssSec.GssEncrypt(credentials)
+	if encryptedCreds == nil {
+		return fmt.Errorf("NLA: failed to encrypt credentials")
+	}
 	logging.Debug("NLA: Sending encrypted credentials")
 
 	tsReq = auth.EncodeTSRequestWithVersion(negotiatedVersion, nil, encryptedCreds, nil, nil)
-	if _, err := c.conn.Write(tsReq); err != nil {
+	if _, err := c.Write(tsReq); err != nil {
 		return fmt.Errorf("NLA: failed to send credentials: %w", err)
 	}
 	logging.Info("NLA: Authentication completed successfully")
@@ -206,7 +229,7 @@ func (c *Client) StartNLA() error {
 		if setter, ok := c.conn.(interface{ SetReadDeadline(time.Time) error }); ok {
 			_ = setter.SetReadDeadline(time.Time{})
 		}
-		return fmt.Errorf("NLA: failed to read final response: %w", err)
+		return fmt.Errorf("NLA: failed to read final response: %w: %w", ErrAuthenticationFailed, err)
 	}
 
 	// Clear the deadline
@@ -220,7 +243,7 @@ func (c *Client) StartNLA() error {
 		finalTsResp, err := auth.DecodeTSRequest(finalResp[:finalN])
 		if err == nil {
 			if finalTsResp.ErrorCode != 0 {
-				return fmt.Errorf("NLA: server returned error code: 0x%08X", finalTsResp.ErrorCode)
+				return fmt.Errorf("NLA: %w: server returned error code: 0x%08X", ErrAuthenticationFailed, finalTsResp.ErrorCode)
 			}
 			logging.Debug("NLA: Final response indicates success (version=%d)", finalTsResp.Version)
 		}
@@ -244,10 +267,10 @@ func (c *Client) startTLSForNLA() error {
 	}
 
 	if cfg != nil {
-		if !insecureSkipVerify {
+		if !c.tlsConfigSet && !insecureSkipVerify {
 			insecureSkipVerify = cfg.Security.SkipTLSValidation
 		}
-		if serverName == "" {
+		if !c.tlsConfigSet && serverName == "" {
 			serverName = cfg.Security.TLSServerName
 		}
 	}
@@ -264,6 +287,9 @@ func (c *Client) startTLSForNLA() error {
 		MaxVersion:         tls.VersionTLS12, // Windows RDP doesn't support TLS 1.3
 		ServerName:         serverName,
 	}
+	if c.clientCertificate != nil {
+		tlsConfig.Certificates = []tls.Certificate{*c.clientCertificate}
+	}
 
 	if tlsConfig.ServerName == "" {
 		if c.conn != nil {
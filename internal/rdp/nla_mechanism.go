@@ -0,0 +1,149 @@
+package rdp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	krbconfig "github.com/jcmturner/gokrb5/v8/config"
+
+	"github.com/rcarmo/go-rdp/internal/auth"
+	"github.com/rcarmo/go-rdp/internal/logging"
+)
+
+// NLAMechanism selects the authentication package NLA carries in CredSSP.
+type NLAMechanism uint8
+
+const (
+	// NLAMechanismNTLM authenticates with NTLMv2, the default.
+	NLAMechanismNTLM NLAMechanism = iota
+	// NLAMechanismKerberos authenticates with Kerberos through SPNEGO and
+	// fails when no service ticket can be obtained.
+	NLAMechanismKerberos
+	// NLAMechanismNegotiate tries Kerberos and falls back to NTLM when no
+	// service ticket can be obtained.
+	NLAMechanismNegotiate
+)
+
+// KerberosSettings locate the KDC and name the service for Kerberos NLA.
+type KerberosSettings struct {
+	// ConfigPath is the krb5.conf listing the realms and their KDCs
+	ConfigPath string
+	// Realm is the user's realm; empty takes it from a user@domain.example
+	// or domain.example\user name, or the krb5.conf default realm
+	Realm string
+	// ServiceHost is the server's host name, as in TERMSRV/<host>
+	ServiceHost string
+}
+
+// SetNLAMechanism selects the NLA authentication package and, for Kerberos,
+// where to find the KDC.
+func (c *Client) SetNLAMechanism(mechanism NLAMechanism, kerberos KerberosSettings) {
+	c.nlaMechanism = mechanism
+	c.kerberos = kerberos
+}
+
+// gssSecurity seals the CredSSP pubKeyAuth and authInfo fields once the
+// authentication package has established a context.
+type gssSecurity interface {
+	GssEncrypt(data []byte) []byte
+	GssDecrypt(data []byte) []byte
+}
+
+// nlaContext is an authentication package CredSSP carries in its negoTokens.
+type nlaContext interface {
+	// initialToken is the first negoToken sent to the server
+	initialToken() ([]byte, error)
+	// accept processes the server's reply to it, returning the negoToken to
+	// send along with pubKeyAuth (nil for none) and the security context
+	accept(token []byte) ([]byte, gssSecurity, error)
+	// credentials returns the UTF-16LE domain, user and password for
+	// TSPasswordCreds
+	credentials() (domain, user, password []byte)
+}
+
+// ntlmNLA runs the NTLMv2 negotiate, challenge and authenticate exchange.
+type ntlmNLA struct {
+	ntlm *auth.NTLMv2
+}
+
+func (n ntlmNLA) initialToken() ([]byte, error) {
+	return n.ntlm.GetNegotiateMessage(), nil
+}
+
+func (n ntlmNLA) accept(token []byte) ([]byte, gssSecurity, error) {
+	authMsg, security := n.ntlm.GetAuthenticateMessage(token)
+	if authMsg == nil || security == nil {
+		return nil, nil, errors.New("failed to generate authenticate message")
+	}
+	return authMsg, security, nil
+}
+
+func (n ntlmNLA) credentials() ([]byte, []byte, []byte) {
+	return n.ntlm.GetCredSSPCredentials()
+}
+
+// kerberosNLA sends an AP-REQ in a SPNEGO NegTokenInit and completes the
+// context from the AP-REP the server returns.
+type kerberosNLA struct {
+	krb *auth.Kerberos
+}
+
+func (k kerberosNLA) initialToken() ([]byte, error) {
+	return k.krb.GetNegTokenInit()
+}
+
+func (k kerberosNLA) accept(token []byte) ([]byte, gssSecurity, error) {
+	security, err := k.krb.ProcessNegTokenResp(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, security, nil
+}
+
+func (k kerberosNLA) credentials() ([]byte, []byte, []byte) {
+	return k.krb.GetCredSSPCredentials()
+}
+
+// newNLAContext returns the authentication package for domain\user. In
+// negotiate mode, Kerberos is used when a service ticket can be obtained
+// and NTLM otherwise; once the AP-REQ is sent there is no falling back.
+func (c *Client) newNLAContext(domain, user string) (nlaContext, error) {
+	if c.nlaMechanism == NLAMechanismNTLM {
+		return ntlmNLA{ntlm: auth.NewNTLMv2(domain, user, c.password)}, nil
+	}
+
+	krb, err := c.newKerberosNLA(domain, user)
+	if err == nil {
+		logging.Debug("NLA: Using Kerberos")
+		return krb, nil
+	}
+	if c.nlaMechanism == NLAMechanismKerberos {
+		return nil, err
+	}
+	logging.Info("NLA: Kerberos unavailable, falling back to NTLM: %v", err)
+	return ntlmNLA{ntlm: auth.NewNTLMv2(domain, user, c.password)}, nil
+}
+
+// newKerberosNLA obtains a service ticket for TERMSRV/<host>
+func (c *Client) newKerberosNLA(domain, user string) (nlaContext, error) {
+	host := c.kerberos.ServiceHost
+	if host == "" || net.ParseIP(host) != nil {
+		return nil, fmt.Errorf("kerberos needs the server's host name, not %q", host)
+	}
+	krb5conf, err := krbconfig.Load(c.kerberos.ConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("kerberos config %s: %w", c.kerberos.ConfigPath, err)
+	}
+
+	realm := c.kerberos.Realm
+	if realm == "" && strings.Contains(domain, ".") {
+		realm = strings.ToUpper(domain)
+	}
+	krb := auth.NewKerberos(domain, user, c.password, realm, krb5conf)
+	if err := krb.GetServiceTicket("TERMSRV/" + host); err != nil {
+		return nil, err
+	}
+	return kerberosNLA{krb: krb}, nil
+}
@@ -213,3 +213,34 @@ func TestParseASN1Length(t *testing.T) {
 		})
 	}
 }
+
+func TestNewNLAContext_DefaultsToNTLM(t *testing.T) {
+	c := &Client{password: "secret"}
+
+	nlaCtx, err := c.newNLAContext("EXAMPLE", "alice")
+	require.NoError(t, err)
+	assert.IsType(t, ntlmNLA{}, nlaCtx)
+}
+
+func TestNewNLAContext_KerberosUnavailable(t *testing.T) {
+	missing := KerberosSettings{ConfigPath: t.TempDir() + "/krb5.conf", ServiceHost: "host.example.com"}
+
+	c := &Client{password: "secret"}
+	c.SetNLAMechanism(NLAMechanismKerberos, missing)
+	_, err := c.newNLAContext("example.com", "alice")
+	assert.Error(t, err, "Kerberos alone has no fallback")
+
+	c.SetNLAMechanism(NLAMechanismNegotiate, missing)
+	nlaCtx, err := c.newNLAContext("example.com", "alice")
+	require.NoError(t, err)
+	assert.IsType(t, ntlmNLA{}, nlaCtx, "negotiate should fall back to NTLM")
+}
+
+func TestNewNLAContext_KerberosNeedsHostName(t *testing.T) {
+	c := &Client{password: "secret"}
+	c.SetNLAMechanism(NLAMechanismKerberos, KerberosSettings{ConfigPath: "/etc/krb5.conf", ServiceHost: "192.0.2.10"})
+
+	_, err := c.newNLAContext("example.com", "alice")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "host name")
+}
@@ -0,0 +1,59 @@
+package rdp
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// ErrServerUnresponsive is returned by GetUpdateContext when the server
+// sends nothing, not even a heartbeat, for the read idle timeout. It usually
+// means the server's host is gone without resetting the TCP connection.
+var ErrServerUnresponsive = errors.New("RDP server unresponsive")
+
+// SetReadIdleTimeout sets how long GetUpdateContext waits for the server to
+// send anything before giving up with ErrServerUnresponsive. Every PDU
+// resets the timer, so servers sending heartbeats are never considered idle.
+// Zero, the default, waits indefinitely.
+func (c *Client) SetReadIdleTimeout(d time.Duration) {
+	c.readIdleTimeout = d
+}
+
+// readIdleTimer interrupts a blocked read once the connection has been
+// silent for its timeout, by moving the read deadline to now.
+type readIdleTimer struct {
+	timeout time.Duration
+	timer   *time.Timer
+	expired chan struct{} // closed once the timer has fired
+}
+
+// startReadIdleTimer arms a timer that interrupts reads on conn after
+// timeout without a call to touch.
+func startReadIdleTimer(conn net.Conn, timeout time.Duration) *readIdleTimer {
+	t := &readIdleTimer{timeout: timeout, expired: make(chan struct{})}
+	t.timer = time.AfterFunc(timeout, func() {
+		_ = conn.SetReadDeadline(time.Now())
+		close(t.expired)
+	})
+	return t
+}
+
+// touch restarts the timer after data arrived. It does nothing on a nil
+// timer or one that has already fired. It must be called from the reading
+// goroutine.
+func (t *readIdleTimer) touch() {
+	if t != nil && t.timer.Stop() {
+		t.timer.Reset(t.timeout)
+	}
+}
+
+// stop disarms the timer and, if it fired, clears the read deadline it set.
+// It reports whether the timer fired.
+func (t *readIdleTimer) stop(conn net.Conn) bool {
+	if t.timer.Stop() {
+		return false
+	}
+	<-t.expired
+	_ = conn.SetReadDeadline(time.Time{})
+	return true
+}
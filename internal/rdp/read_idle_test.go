@@ -0,0 +1,95 @@
+package rdp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetUpdateContext_SilentServerIsUnresponsive(t *testing.T) {
+	// A server that accepts and then never sends, like a host that died
+	// without resetting the connection
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	var dialer net.Dialer
+	client, err := NewClientWithDialContext(context.Background(), dialer.DialContext, listener.Addr().String(), "user", "pass", 1024, 768, 16)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	server := <-accepted
+	t.Cleanup(func() { _ = server.Close() })
+
+	client.SetReadIdleTimeout(50 * time.Millisecond)
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.GetUpdateContext(context.Background())
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, ErrServerUnresponsive)
+	case <-time.After(2 * time.Second):
+		t.Fatal("GetUpdateContext did not give up on a silent server")
+	}
+}
+
+func TestGetUpdateContext_ReadIdleTimeoutAllowsSlowUpdates(t *testing.T) {
+	client, server := newPipeClient(t)
+	client.SetReadIdleTimeout(time.Second)
+
+	synchronize := []byte{byte(FastPathUpdateCodeSynchronize), 0x00, 0x00}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_, _ = server.Write(append([]byte{0x00, byte(len(synchronize))}, synchronize...))
+	}()
+
+	update, err := client.GetUpdateContext(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, synchronize, update.Data)
+}
+
+func TestGetUpdateContext_CancelWinsOverReadIdleTimeout(t *testing.T) {
+	client, _ := newPipeClient(t)
+	client.SetReadIdleTimeout(time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := client.GetUpdateContext(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestReadIdleTimer_TouchRestarts(t *testing.T) {
+	conn, peer := net.Pipe()
+	t.Cleanup(func() {
+		_ = conn.Close()
+		_ = peer.Close()
+	})
+
+	timer := startReadIdleTimer(conn, 100*time.Millisecond)
+	for i := 0; i < 4; i++ {
+		time.Sleep(40 * time.Millisecond)
+		timer.touch()
+	}
+	assert.False(t, timer.stop(conn), "touched timer should not fire")
+
+	timer = startReadIdleTimer(conn, 10*time.Millisecond)
+	<-timer.expired
+	timer.touch()
+	assert.True(t, timer.stop(conn), "touch does not revive a fired timer")
+
+	var nilTimer *readIdleTimer
+	assert.NotPanics(t, nilTimer.touch)
+}
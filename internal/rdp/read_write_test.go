@@ -3,12 +3,19 @@ package rdp
 import (
 	"bufio"
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"net"
+	"runtime"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/rcarmo/go-rdp/internal/protocol/fastpath"
+	"github.com/rcarmo/go-rdp/internal/protocol/mcs"
 	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+	"github.com/rcarmo/go-rdp/internal/protocol/tpkt"
+	"github.com/rcarmo/go-rdp/internal/protocol/x224"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -173,6 +180,75 @@ func TestClient_Write(t *testing.T) {
 	}
 }
 
+// byteWriterConn writes one byte at a time, yielding in between, so
+// unserialized concurrent writes interleave
+type byteWriterConn struct {
+	readWriteTestMockConn
+	mu sync.Mutex
+}
+
+func (m *byteWriterConn) Write(b []byte) (int, error) {
+	for _, c := range b {
+		m.mu.Lock()
+		m.writeBuffer.WriteByte(c)
+		m.mu.Unlock()
+		runtime.Gosched()
+	}
+	return len(b), nil
+}
+
+func TestClient_ConcurrentSendsAreNotInterleaved(t *testing.T) {
+	conn := &byteWriterConn{}
+	client := &Client{conn: conn}
+	client.tpktLayer = tpkt.New(client)
+	client.x224Layer = x224.New(client.tpktLayer)
+	client.mcsLayer = mcs.New(client.x224Layer)
+	client.fastPath = fastpath.New(client)
+
+	const senders, sends, payloadLen = 8, 20, 200
+	var wg sync.WaitGroup
+	for id := range senders {
+		payload := bytes.Repeat([]byte{byte(id + 1)}, payloadLen)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range sends {
+				// Even senders use the slow path, odd ones fastpath input
+				if id%2 == 0 {
+					assert.NoError(t, client.mcsLayer.Send(1007, 1003, payload))
+				} else {
+					assert.NoError(t, client.SendInputEvent(payload))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Every PDU on the wire is whole and carries one sender's payload
+	stream := conn.writeBuffer.Bytes()
+	count := 0
+	for len(stream) > 0 {
+		var length int
+		switch {
+		case stream[0] == 0x03: // TPKT
+			require.GreaterOrEqual(t, len(stream), 4)
+			length = int(binary.BigEndian.Uint16(stream[2:4]))
+		case stream[1]&0x80 != 0: // fastpath, two length bytes
+			length = int(binary.BigEndian.Uint16(stream[1:3]) &^ 0x8000)
+		default:
+			length = int(stream[1])
+		}
+		require.LessOrEqual(t, length, len(stream), "PDU %d is truncated", count)
+		require.Greater(t, length, payloadLen)
+
+		payload := stream[length-payloadLen : length]
+		assert.Equal(t, bytes.Repeat(payload[:1], payloadLen), payload, "PDU %d is interleaved", count)
+		stream = stream[length:]
+		count++
+	}
+	assert.Equal(t, senders*sends, count)
+}
+
 func TestClient_initChannels(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -0,0 +1,113 @@
+package rdp
+
+import (
+	"bytes"
+	"slices"
+
+	"github.com/rcarmo/go-rdp/internal/logging"
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+)
+
+// RedirectionInfo tells the client where a connection broker's Server
+// Redirection PDU (MS-RDPBCGR 2.2.13) sends the session.
+type RedirectionInfo struct {
+	// SessionID is the session on the target to reconnect to
+	SessionID uint32
+
+	// TargetAddress is the LB_TARGET_NET_ADDRESS of the target
+	TargetAddress string
+
+	// TargetAddresses lists the LB_TARGET_NET_ADDRESSES of the target,
+	// which may include IPv6 addresses
+	TargetAddresses []string
+
+	// TargetFQDN is the fully qualified name of the target, if sent
+	TargetFQDN string
+
+	// RoutingToken is the load balance info to present in the X.224
+	// Connection Request, so the target accepts the redirected logon
+	RoutingToken []byte
+
+	// Username and Domain replace the logon credentials when set
+	Username string
+	Domain   string
+
+	// NoRedirect is set when the client must reconnect to the server it is
+	// already connected to, presenting only the routing token
+	NoRedirect bool
+}
+
+// Targets returns the hosts to reconnect to in order of preference, without
+// ports: LB_TARGET_NET_ADDRESS, then each LB_TARGET_NET_ADDRESSES entry, then
+// the FQDN. It is empty when NoRedirect is set.
+func (r *RedirectionInfo) Targets() []string {
+	if r.NoRedirect {
+		return nil
+	}
+	var targets []string
+	for _, target := range append(append([]string{r.TargetAddress}, r.TargetAddresses...), r.TargetFQDN) {
+		if target != "" && !slices.Contains(targets, target) {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// newRedirectionInfo collects the fields of a Server Redirection Packet the
+// client acts on
+func newRedirectionInfo(p *pdu.ServerRedirectionPacket) *RedirectionInfo {
+	return &RedirectionInfo{
+		SessionID:       p.SessionID,
+		TargetAddress:   p.TargetNetAddress,
+		TargetAddresses: p.TargetNetAddresses,
+		TargetFQDN:      p.TargetFQDN,
+		RoutingToken:    p.LoadBalanceInfo,
+		Username:        p.Username,
+		Domain:          p.Domain,
+		NoRedirect:      p.Has(pdu.RedirFlagNoRedirect),
+	}
+}
+
+// Redirection returns the redirection sent by the server when Connect failed
+// with ErrServerRedirected, or nil.
+func (c *Client) Redirection() *RedirectionInfo {
+	return c.redirection
+}
+
+// SetRedirection prepares a new client to follow a redirection received by
+// another: it presents the routing token and session ID and logs on with the
+// redirected credentials. It must be called before Connect.
+func (c *Client) SetRedirection(info *RedirectionInfo) {
+	c.redirectedFrom = info
+	if info.Username != "" {
+		c.username = info.Username
+		c.domain = info.Domain
+	}
+}
+
+// handleServerRedirection records the redirection carried by an Enhanced
+// Security Server Redirection PDU received in place of Demand Active
+func (c *Client) handleServerRedirection(data []byte) error {
+	var resp pdu.ServerRedirectionPDU
+	if err := resp.Deserialize(bytes.NewReader(data)); err != nil {
+		return err
+	}
+
+	c.redirection = newRedirectionInfo(&resp.Packet)
+	logging.Info("Server redirection: session=%d targets=%v noRedirect=%v",
+		c.redirection.SessionID, c.redirection.Targets(), c.redirection.NoRedirect)
+	return ErrServerRedirected
+}
+
+// clientClusterData advertises support for server redirection and, when
+// following one, the session to reconnect to (MS-RDPBCGR 2.2.1.3.5)
+func (c *Client) clientClusterData() *pdu.ClientClusterData {
+	data := &pdu.ClientClusterData{
+		Flags: pdu.ClusterRedirectionSupported | pdu.ClusterRedirectionVersion4,
+	}
+	if c.redirectedFrom != nil {
+		data.Flags |= pdu.ClusterRedirectedSessionIDFieldValid
+		data.RedirectedSessionID = c.redirectedFrom.SessionID
+	}
+	return data
+}
@@ -0,0 +1,80 @@
+package rdp
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+)
+
+func TestCapabilitiesExchange_ServerRedirection(t *testing.T) {
+	redirect := pdu.ServerRedirectionPDU{
+		Packet: pdu.ServerRedirectionPacket{
+			SessionID: 5,
+			RedirFlags: pdu.RedirFlagTargetNetAddress | pdu.RedirFlagLoadBalanceInfo |
+				pdu.RedirFlagUsername | pdu.RedirFlagTargetNetAddresses,
+			TargetNetAddress:   "10.0.0.12",
+			LoadBalanceInfo:    []byte("Cookie: msts=3640205228.15629.0000\r\n"),
+			Username:           "alice",
+			TargetNetAddresses: []string{"10.0.0.12", "2001:db8::12"},
+		},
+	}
+	client := &Client{
+		channelIDMap: map[string]uint16{"global": 1003},
+		mcsLayer: &MockMCSLayer{
+			ReceiveFunc: func() (uint16, io.Reader, error) {
+				return 1003, bytes.NewReader(redirect.Serialize()), nil
+			},
+		},
+	}
+
+	err := client.capabilitiesExchange()
+	require.ErrorIs(t, err, ErrServerRedirected)
+
+	info := client.Redirection()
+	require.NotNil(t, info)
+	assert.Equal(t, uint32(5), info.SessionID)
+	assert.Equal(t, "alice", info.Username)
+	assert.Equal(t, []byte("Cookie: msts=3640205228.15629.0000\r\n"), info.RoutingToken)
+	assert.Equal(t, []string{"10.0.0.12", "2001:db8::12"}, info.Targets())
+	assert.Empty(t, client.mcsLayer.(*MockMCSLayer).SendCalls)
+}
+
+func TestRedirectionInfo_Targets(t *testing.T) {
+	info := &RedirectionInfo{
+		TargetAddress:   "10.0.0.12",
+		TargetAddresses: []string{"fe80::12", "10.0.0.12"},
+		TargetFQDN:      "host12.corp.example",
+	}
+	assert.Equal(t, []string{"10.0.0.12", "fe80::12", "host12.corp.example"}, info.Targets())
+
+	info.NoRedirect = true
+	assert.Empty(t, info.Targets())
+}
+
+func TestClient_SetRedirection(t *testing.T) {
+	client := &Client{username: "broker-user", selectedProtocol: pdu.NegotiationProtocolSSL}
+	cluster := client.clientClusterData()
+	assert.Equal(t, pdu.ClusterRedirectionSupported|pdu.ClusterRedirectionVersion4, cluster.Flags)
+	assert.Empty(t, client.connectionRequest().RoutingToken)
+
+	client.SetRedirection(&RedirectionInfo{
+		SessionID:    9,
+		RoutingToken: []byte("Cookie: msts=1\r\n"),
+		Username:     "alice",
+		Domain:       "CORP",
+	})
+	assert.Equal(t, "alice", client.username)
+	assert.Equal(t, "CORP", client.domain)
+
+	cluster = client.clientClusterData()
+	assert.NotZero(t, cluster.Flags&pdu.ClusterRedirectedSessionIDFieldValid)
+	assert.Equal(t, uint32(9), cluster.RedirectedSessionID)
+
+	req := client.connectionRequest()
+	assert.True(t, bytes.HasPrefix(req.Serialize(), []byte("Cookie: msts=1\r\n")))
+}
@@ -0,0 +1,138 @@
+package rdp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/rcarmo/go-rdp/internal/logging"
+)
+
+// transientErrorInfo holds the Set Error Info codes (MS-RDPBCGR 2.2.5.1.1)
+// that report a server or broker which may accept the same connection a
+// moment later
+var transientErrorInfo = map[uint32]bool{
+	0x00000006: true, // ERRINFO_OUT_OF_MEMORY
+	0x00000101: true, // ERRINFO_LICENSE_NO_LICENSE_SERVER
+	0x00000402: true, // ERRINFO_CB_LOADING_DESTINATION
+	0x00000405: true, // ERRINFO_CB_SESSION_ONLINE_VM_WAKE
+	0x00000406: true, // ERRINFO_CB_SESSION_ONLINE_VM_BOOT
+	0x00000408: true, // ERRINFO_CB_DESTINATION_POOL_NOT_FREE
+	0x00000411: true, // ERRINFO_CB_SESSION_ONLINE_VM_BOOT_TIMEOUT
+}
+
+func isTransientErrorInfo(code uint32) bool {
+	return transientErrorInfo[code]
+}
+
+// ConnectRetry retries a connection sequence that fails with ErrTransient.
+// Each attempt must use a new Client, since a failed Connect leaves the
+// client mid-sequence. The zero value makes a single attempt.
+type ConnectRetry struct {
+	Retries int           // attempts after the first
+	Backoff time.Duration // wait before the first retry, doubled for each further one
+
+	// sleep overrides waiting between attempts in tests
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// Do calls attempt, numbered from 0, until it succeeds, fails with an error
+// other than ErrTransient, the retries run out or ctx is done. It returns
+// the error of the last attempt.
+func (r ConnectRetry) Do(ctx context.Context, attempt func(n int) error) error {
+	sleep := r.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+
+	delay := r.Backoff
+	for n := 0; ; n++ {
+		err := attempt(n)
+		if err == nil || !errors.Is(err, ErrTransient) || n >= r.Retries {
+			return err
+		}
+
+		logging.Warn("RDP connect failed with a transient error, retrying in %v (%d/%d): %v", delay, n+1, r.Retries, err)
+		if sleepErr := sleep(ctx, delay); sleepErr != nil {
+			return err
+		}
+		delay *= 2
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// DialFunc dials the RDP server, as net.Dialer.DialContext does.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// DialError reports a TCP dial that still failed after the retries of
+// ConnectRetry.Dial.
+type DialError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *DialError) Error() string {
+	return fmt.Sprintf("dial failed after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *DialError) Unwrap() error {
+	return e.Err
+}
+
+// Dial returns dial with transient TCP failures retried: timeouts, refused
+// or reset connections and unreachable hosts or networks. When the retries
+// run out it fails with a *DialError; other failures are returned at once.
+func (r ConnectRetry) Dial(dial DialFunc) DialFunc {
+	if r.Retries <= 0 {
+		return dial
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		var (
+			conn     net.Conn
+			lastErr  error
+			attempts int
+		)
+		err := r.Do(ctx, func(n int) error {
+			attempts = n + 1
+			var err error
+			conn, err = dial(ctx, network, address)
+			lastErr = err
+			if err != nil && ctx.Err() == nil && isTransientDialError(err) {
+				return fmt.Errorf("%w: %w", ErrTransient, err)
+			}
+			return err
+		})
+		if errors.Is(err, ErrTransient) {
+			return nil, &DialError{Attempts: attempts, Err: lastErr}
+		}
+		return conn, err
+	}
+}
+
+// isTransientDialError reports whether a failed dial may succeed if tried
+// again shortly: the host did not answer in time, refused or reset the
+// connection while starting up, or the route to it was briefly down.
+func isTransientDialError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, syscall.ENETUNREACH)
+}
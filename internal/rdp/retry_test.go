@@ -0,0 +1,229 @@
+package rdp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcarmo/go-rdp/internal/protocol/license"
+)
+
+func TestConnectRetry_TransientLicensingErrorSucceedsOnRetry(t *testing.T) {
+	var delays []time.Duration
+	retry := ConnectRetry{
+		Retries: 2,
+		Backoff: time.Second,
+		sleep: func(_ context.Context, d time.Duration) error {
+			delays = append(delays, d)
+			return nil
+		},
+	}
+
+	var client *Client
+	var server *testServer
+	err := retry.Do(context.Background(), func(n int) error {
+		client, server = newTestServerClient(t, func(s *testServer) {
+			if n == 0 {
+				s.LicenseError = license.CodeNoLicenseServer
+			}
+		})
+		err := client.Connect()
+		if err != nil {
+			_ = client.Close()
+		}
+		return err
+	})
+	require.NoError(t, err)
+	server.waitActive()
+	assert.Equal(t, []time.Duration{time.Second}, delays)
+	require.NoError(t, client.Close())
+}
+
+func TestClient_licensing_NoLicenseServerIsTransient(t *testing.T) {
+	client, _ := newTestServerClient(t, func(s *testServer) {
+		s.LicenseError = license.CodeNoLicenseServer
+	})
+	err := client.Connect()
+	require.ErrorIs(t, err, ErrTransient)
+	assert.Contains(t, err.Error(), "licensing")
+
+	client, _ = newTestServerClient(t, func(s *testServer) {
+		s.LicenseError = 0x00000008 // ERR_INVALID_CLIENT
+	})
+	err = client.Connect()
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrTransient)
+}
+
+func TestConnectRetry_Do(t *testing.T) {
+	transient := fmt.Errorf("licensing: %w", ErrTransient)
+	permanent := errors.New("authentication failed")
+
+	tests := []struct {
+		name       string
+		retries    int
+		results    []error
+		wantErr    error
+		wantCalls  int
+		wantDelays []time.Duration
+	}{
+		{"success", 2, []error{nil}, nil, 1, nil},
+		{"no retries", 0, []error{transient}, transient, 1, nil},
+		{"permanent error", 2, []error{permanent}, permanent, 1, nil},
+		{"transient then permanent", 2, []error{transient, permanent}, permanent, 2, []time.Duration{time.Second}},
+		{"retries exhausted", 2, []error{transient, transient, transient}, transient, 3, []time.Duration{time.Second, 2 * time.Second}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var delays []time.Duration
+			retry := ConnectRetry{
+				Retries: tt.retries,
+				Backoff: time.Second,
+				sleep: func(_ context.Context, d time.Duration) error {
+					delays = append(delays, d)
+					return nil
+				},
+			}
+
+			calls := 0
+			err := retry.Do(context.Background(), func(n int) error {
+				assert.Equal(t, calls, n)
+				calls++
+				return tt.results[n]
+			})
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantCalls, calls)
+			assert.Equal(t, tt.wantDelays, delays)
+		})
+	}
+}
+
+func TestConnectRetry_DoContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+	err := ConnectRetry{Retries: 3, Backoff: time.Hour}.Do(ctx, func(int) error {
+		calls++
+		return ErrTransient
+	})
+	assert.ErrorIs(t, err, ErrTransient)
+	assert.Equal(t, 1, calls, "no retry once the context is done")
+}
+
+func TestIsTransientErrorInfo(t *testing.T) {
+	assert.True(t, isTransientErrorInfo(0x00000101))  // ERRINFO_LICENSE_NO_LICENSE_SERVER
+	assert.True(t, isTransientErrorInfo(0x00000408))  // ERRINFO_CB_DESTINATION_POOL_NOT_FREE
+	assert.False(t, isTransientErrorInfo(0x00000009)) // ERRINFO_SERVER_INSUFFICIENT_PRIVILEGES
+}
+
+func TestConnectRetry_Dial(t *testing.T) {
+	retry := ConnectRetry{
+		Retries: 2,
+		Backoff: time.Millisecond,
+		sleep:   func(context.Context, time.Duration) error { return nil },
+	}
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+
+	attempts := 0
+	dial := retry.Dial(func(context.Context, string, string) (net.Conn, error) {
+		attempts++
+		return nil, refused
+	})
+	_, err := dial(context.Background(), "tcp", "192.0.2.1:3389")
+	var dialErr *DialError
+	require.ErrorAs(t, err, &dialErr)
+	assert.Equal(t, 3, dialErr.Attempts)
+	assert.Equal(t, 3, attempts)
+	assert.ErrorIs(t, err, syscall.ECONNREFUSED)
+	assert.NotErrorIs(t, err, ErrTransient, "exhausted dials are not retried again as a connection sequence")
+
+	// The host comes up on the second attempt
+	attempts = 0
+	server, client := net.Pipe()
+	defer func() { _ = server.Close() }()
+	dial = retry.Dial(func(context.Context, string, string) (net.Conn, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, refused
+		}
+		return client, nil
+	})
+	conn, err := dial(context.Background(), "tcp", "192.0.2.1:3389")
+	require.NoError(t, err)
+	assert.Same(t, client, conn)
+
+	// Failures that will not go away are returned at once
+	attempts = 0
+	lookupErr := &net.DNSError{Err: "no such host", Name: "missing.example", IsNotFound: true}
+	dial = retry.Dial(func(context.Context, string, string) (net.Conn, error) {
+		attempts++
+		return nil, lookupErr
+	})
+	_, err = dial(context.Background(), "tcp", "missing.example:3389")
+	assert.ErrorIs(t, err, lookupErr)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestConnectRetry_DialTimesOut(t *testing.T) {
+	retry := ConnectRetry{Retries: 1, sleep: func(context.Context, time.Duration) error { return nil }}
+	attempts := 0
+	dial := retry.Dial(func(ctx context.Context, _, _ string) (net.Conn, error) {
+		attempts++
+		// A blackholed host never answers, so only the dial timeout ends the attempt
+		ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		<-ctx.Done()
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: ctx.Err()}
+	})
+
+	_, err := dial(context.Background(), "tcp", "192.0.2.1:3389")
+	var dialErr *DialError
+	require.ErrorAs(t, err, &dialErr)
+	assert.Equal(t, 2, attempts)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// A session that ends while dialing is not redialed
+	attempts = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = dial(ctx, "tcp", "192.0.2.1:3389")
+	require.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestConnectWithResultContext_UnresponsiveServer(t *testing.T) {
+	// The listener accepts the TCP connection but never answers the X.224 request
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			_, _ = io.Copy(io.Discard, conn)
+			_ = conn.Close()
+		}
+	}()
+
+	client, err := NewClient(listener.Addr().String(), "user", "pass", 800, 600, 16)
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	result, err := client.ConnectWithResultContext(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 2*time.Second, "the handshake must not block past the deadline")
+	require.NotNil(t, result)
+	assert.Equal(t, StageNegotiation, result.Stage)
+}
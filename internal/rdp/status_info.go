@@ -0,0 +1,34 @@
+package rdp
+
+import (
+	"github.com/rcarmo/go-rdp/internal/logging"
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+)
+
+// StatusInfoCallback is called with each Server Status Info PDU
+type StatusInfoCallback func(status pdu.StatusInfoPDUData)
+
+// SetStatusInfoCallback sets the function to call when the server reports
+// connection progress. Status Info PDUs arrive while Connect is running, so
+// the callback must be set before connecting to see them as they come.
+func (c *Client) SetStatusInfoCallback(cb StatusInfoCallback) {
+	c.statusInfoCallback = cb
+}
+
+// StatusInfo returns the last connection progress status sent by the
+// server, or nil if none has been received.
+func (c *Client) StatusInfo() *pdu.StatusInfoPDUData {
+	return c.statusInfo
+}
+
+// handleStatusInfo records a Server Status Info PDU and reports it to the callback
+func (c *Client) handleStatusInfo(status *pdu.StatusInfoPDUData) {
+	if status == nil {
+		return
+	}
+	logging.Info("RDP server status: %s", status)
+	c.statusInfo = status
+	if c.statusInfoCallback != nil {
+		c.statusInfoCallback(*status)
+	}
+}
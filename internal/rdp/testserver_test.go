@@ -0,0 +1,646 @@
+package rdp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"slices"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/rcarmo/go-rdp/internal/codec"
+	"github.com/rcarmo/go-rdp/internal/protocol/encoding"
+	"github.com/rcarmo/go-rdp/internal/protocol/mcs"
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
+	"github.com/stretchr/testify/require"
+)
+
+// MCS domain PDU applications the test server handles (T.125)
+const (
+	testMCSErectDomainRequest = 1
+	testMCSAttachUserRequest  = 10
+	testMCSAttachUserConfirm  = 11
+	testMCSChannelJoinRequest = 14
+	testMCSChannelJoinConfirm = 15
+)
+
+// IDs the test server assigns
+const (
+	testServerUserID        uint16 = 1007
+	testServerIOChannelID   uint16 = 1003
+	testServerFirstVChannel uint16 = 1004
+	testServerMsgChannelID  uint16 = 1010
+	testServerShareID       uint32 = 0x000103EA
+)
+
+// testServer is a minimal in-memory RDP server for end-to-end tests of the
+// connection sequence. It speaks X.224, MCS, TLS security, licensing, the
+// capabilities exchange and connection finalization over one end of a
+// net.Pipe, and records what the client sent. Standard RDP security and NLA
+// are not supported.
+type testServer struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+	cert tls.Certificate
+
+	// Redirection, when set, is sent in place of the Demand Active PDU
+	Redirection *pdu.ServerRedirectionPDU
+	// RequireClientCert makes the TLS handshake demand a client certificate
+	RequireClientCert bool
+	// MessageChannel assigns a message channel when the client asks for one
+	MessageChannel bool
+	// LicenseError, when set, is sent in place of STATUS_VALID_CLIENT and
+	// ends the connection
+	LicenseError uint32
+	// RejectChannels are confirmed with rt-no-such-channel when joined
+	RejectChannels []uint16
+	// StatusInfo codes are sent before the Demand Active PDU to clients
+	// that support Server Status Info PDUs
+	StatusInfo []uint32
+	// LicenseDelay stalls the handshake before licensing, as a slow logon does
+	LicenseDelay time.Duration
+	// LicenseRequest, when set, is sent before STATUS_VALID_CLIENT and the
+	// client's reply recorded in LicenseReply
+	LicenseRequest []byte
+
+	// Recorded from the client
+	RequestedProtocols      pdu.NegotiationProtocol
+	ClientCertificate       *x509.Certificate
+	ChannelNames            []string
+	LicenseReply            []byte
+	EarlyCapabilities       uint16
+	ClientBuild             uint32
+	ClientDigProductID      []byte
+	RequestedMessageChannel bool
+	JoinedChannels          []uint16
+	Username                string
+	InfoFlags               pdu.InfoFlag
+	ConfirmActive           *pdu.ClientConfirmActive
+	Finalization            []pdu.Type2
+
+	// active is closed once the client sends its first PDU after finalization
+	active chan struct{}
+	// done receives the result of serve
+	done chan error
+}
+
+// newTestServerClient starts a test server and returns a client dialed to
+// it, not yet connected. configure, if set, adjusts the server before the
+// client dials.
+func newTestServerClient(t *testing.T, configure func(*testServer)) (*Client, *testServer) {
+	t.Helper()
+
+	clientConn, serverConn := net.Pipe()
+	s := &testServer{
+		t:      t,
+		conn:   serverConn,
+		r:      bufio.NewReader(serverConn),
+		cert:   testServerCertificate(t),
+		active: make(chan struct{}),
+		done:   make(chan error, 1),
+	}
+	if configure != nil {
+		configure(s)
+	}
+	t.Cleanup(func() {
+		_ = clientConn.Close()
+		_ = serverConn.Close()
+	})
+
+	dial := func(context.Context, string, string) (net.Conn, error) { return clientConn, nil }
+	client, err := NewClientWithDialContext(context.Background(), dial, "rdp.test:3389", "alice", "secret", 1024, 768, 16)
+	require.NoError(t, err)
+	client.SetTLSConfig(true, "")
+	client.SetUseNLA(false)
+
+	go func() { s.done <- s.serve() }()
+	return client, s
+}
+
+// waitActive waits until the client has completed the handshake and sent
+// a PDU in the active state
+func (s *testServer) waitActive() {
+	s.t.Helper()
+	select {
+	case <-s.active:
+	case err := <-s.done:
+		s.t.Fatalf("test server stopped before the client was active: %v", err)
+	case <-time.After(5 * time.Second):
+		s.t.Fatal("timed out waiting for the client to become active")
+	}
+}
+
+func (s *testServer) serve() error {
+	if err := s.connectionInitiation(); err != nil {
+		return fmt.Errorf("connection initiation: %w", err)
+	}
+	if err := s.basicSettingsExchange(); err != nil {
+		return fmt.Errorf("basic settings exchange: %w", err)
+	}
+	clientInfo, err := s.channelConnection()
+	if err != nil {
+		return fmt.Errorf("channel connection: %w", err)
+	}
+	if err := s.secureSettingsExchange(clientInfo); err != nil {
+		return fmt.Errorf("secure settings exchange: %w", err)
+	}
+	time.Sleep(s.LicenseDelay)
+	if err := s.sendLicense(); err != nil {
+		return fmt.Errorf("licensing: %w", err)
+	}
+	if s.LicenseError != 0 {
+		// Drop the transport without a TLS close_notify, which nobody reads
+		return s.conn.(*tls.Conn).NetConn().Close()
+	}
+	if s.Redirection != nil {
+		return s.sendData(s.Redirection.Serialize())
+	}
+	if err := s.sendStatusInfo(); err != nil {
+		return fmt.Errorf("status info: %w", err)
+	}
+	if err := s.capabilitiesExchange(); err != nil {
+		return fmt.Errorf("capabilities exchange: %w", err)
+	}
+	if err := s.connectionFinalization(); err != nil {
+		return fmt.Errorf("connection finalization: %w", err)
+	}
+
+	// Drain the client until it disconnects
+	for first := true; ; first = false {
+		if _, err := s.readDomainPDU(); err != nil {
+			return nil
+		}
+		if first {
+			close(s.active)
+		}
+	}
+}
+
+// connectionInitiation answers the X.224 Connection Request, selecting TLS,
+// and upgrades the connection
+func (s *testServer) connectionInitiation() error {
+	req, err := s.readTPKT()
+	if err != nil {
+		return err
+	}
+	// RDP_NEG_REQ closes the request, after any cookie or routing token
+	if len(req) < 7+8 || req[1] != 0xE0 {
+		return fmt.Errorf("unexpected connection request % X", req)
+	}
+	s.RequestedProtocols = pdu.NegotiationProtocol(binary.LittleEndian.Uint32(req[len(req)-4:]))
+	if !s.RequestedProtocols.IsSSL() {
+		return fmt.Errorf("client did not offer TLS: 0x%X", uint32(s.RequestedProtocols))
+	}
+
+	confirm := []byte{0x0E, 0xD0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x00, 0x08, 0x00}
+	confirm = binary.LittleEndian.AppendUint32(confirm, uint32(pdu.NegotiationProtocolSSL))
+	if err := s.writeTPKT(confirm); err != nil {
+		return err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{s.cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if s.RequireClientCert {
+		config.ClientAuth = tls.RequireAnyClientCert
+	}
+	tlsConn := tls.Server(s.conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	if peers := tlsConn.ConnectionState().PeerCertificates; len(peers) > 0 {
+		s.ClientCertificate = peers[0]
+	}
+	s.conn = tlsConn
+	s.r = bufio.NewReader(tlsConn)
+	return nil
+}
+
+// basicSettingsExchange answers the MCS Connect Initial, assigning an ID
+// to each static virtual channel the client asked for
+func (s *testServer) basicSettingsExchange() error {
+	data, err := s.readX224()
+	if err != nil {
+		return err
+	}
+	if s.ChannelNames, err = clientChannelNames(data); err != nil {
+		return err
+	}
+	core, err := clientDataBlock(data, 0xC001) // CS_CORE
+	if err != nil {
+		return err
+	}
+	if len(core) >= 20 {
+		s.ClientBuild = binary.LittleEndian.Uint32(core[16:])
+	}
+	if len(core) >= 142 {
+		s.EarlyCapabilities = binary.LittleEndian.Uint16(core[140:])
+	}
+	if len(core) >= 206 {
+		s.ClientDigProductID = core[142:206]
+	}
+	msgChannel, err := clientDataBlock(data, 0xC006) // CS_MCS_MSGCHANNEL
+	if err != nil {
+		return err
+	}
+	s.RequestedMessageChannel = msgChannel != nil
+
+	userData := new(bytes.Buffer)
+	writeDataBlock(userData, 0x0C01, binary.LittleEndian.AppendUint32(
+		binary.LittleEndian.AppendUint32(
+			binary.LittleEndian.AppendUint32(nil, pdu.RDPVersion10),
+			uint32(pdu.NegotiationProtocolSSL)), 0))
+	writeDataBlock(userData, 0x0C02, make([]byte, 8)) // ENCRYPTION_METHOD_NONE, ENCRYPTION_LEVEL_NONE
+	network := binary.LittleEndian.AppendUint16(nil, testServerIOChannelID)
+	network = binary.LittleEndian.AppendUint16(network, uint16(len(s.ChannelNames))) // #nosec G115
+	for i := range s.ChannelNames {
+		network = binary.LittleEndian.AppendUint16(network, testServerFirstVChannel+uint16(i)) // #nosec G115
+	}
+	if len(s.ChannelNames)%2 == 1 {
+		network = append(network, 0x00, 0x00)
+	}
+	writeDataBlock(userData, 0x0C03, network)
+	if s.MessageChannel && s.RequestedMessageChannel {
+		writeDataBlock(userData, 0x0C04, binary.LittleEndian.AppendUint16(nil, testServerMsgChannelID))
+	}
+
+	// GCC Conference Create Response, laid out as in MS-RDPBCGR 4.1.4
+	gcc := new(bytes.Buffer)
+	gcc.Write([]byte{0x00, 0x05, 0x00, 0x14, 0x7C, 0x00, 0x01})
+	response := new(bytes.Buffer)
+	response.Write([]byte{0x14, 0x76, 0x0A, 0x01, 0x01, 0x00, 0x01, 0xC0, 0x00, 'M', 'c', 'D', 'n'})
+	encoding.PerWriteLength(uint16(userData.Len()), response) // #nosec G115
+	response.Write(userData.Bytes())
+	encoding.PerWriteLength(uint16(response.Len()), gcc) // #nosec G115
+	gcc.Write(response.Bytes())
+
+	body := new(bytes.Buffer)
+	body.Write([]byte{0x0A, 0x01, 0x00}) // result: rt-successful
+	body.Write([]byte{0x02, 0x01, 0x00}) // calledConnectId
+	encoding.BerWriteSequence([]byte{
+		0x02, 0x01, 0x22, 0x02, 0x01, 0x03, 0x02, 0x01, 0x00, 0x02, 0x01, 0x01,
+		0x02, 0x01, 0x00, 0x02, 0x01, 0x01, 0x02, 0x03, 0x00, 0xFF, 0xF8, 0x02, 0x01, 0x02,
+	}, body)
+	encoding.BerWriteOctetString(gcc.Bytes(), body)
+
+	connectResponse := new(bytes.Buffer)
+	encoding.BerWriteApplicationTag(102, body.Len(), connectResponse)
+	connectResponse.Write(body.Bytes())
+	return s.writeX224(connectResponse.Bytes())
+}
+
+// channelConnection answers the erect domain, attach user and channel join
+// requests, returning the first data the client sends, its Client Info PDU
+func (s *testServer) channelConnection() ([]byte, error) {
+	for {
+		p, err := s.readDomainPDU()
+		if err != nil {
+			return nil, err
+		}
+		switch p.application {
+		case testMCSErectDomainRequest:
+		case testMCSAttachUserRequest:
+			confirm := []byte{testMCSAttachUserConfirm<<2 | 0x02, 0x00}
+			if err := s.writeX224(binary.BigEndian.AppendUint16(confirm, testServerUserID-1001)); err != nil {
+				return nil, err
+			}
+		case testMCSChannelJoinRequest:
+			channelID := binary.BigEndian.Uint16(p.data[2:])
+			s.JoinedChannels = append(s.JoinedChannels, channelID)
+			confirm := []byte{testMCSChannelJoinConfirm<<2 | 0x02, mcs.RTSuccessful}
+			if slices.Contains(s.RejectChannels, channelID) {
+				confirm[1] = mcs.RTNoSuchChannel
+			}
+			confirm = binary.BigEndian.AppendUint16(confirm, testServerUserID-1001)
+			confirm = binary.BigEndian.AppendUint16(confirm, channelID)
+			confirm = binary.BigEndian.AppendUint16(confirm, channelID)
+			if err := s.writeX224(confirm); err != nil {
+				return nil, err
+			}
+		case uint8(mcs.SendDataRequest):
+			return p.data, nil
+		default:
+			return nil, fmt.Errorf("unexpected MCS application %d", p.application)
+		}
+	}
+}
+
+// secureSettingsExchange records the flags and user name of the Client Info PDU
+func (s *testServer) secureSettingsExchange(clientInfo []byte) error {
+	wire := bytes.NewReader(clientInfo)
+	flags, err := codec.UnwrapSecurityFlag(wire)
+	if err != nil {
+		return err
+	}
+	if flags&0x0040 == 0 { // SEC_INFO_PKT
+		return fmt.Errorf("client info without SEC_INFO_PKT: 0x%04X", flags)
+	}
+
+	var header struct {
+		CodePage, Flags                                      uint32
+		CbDomain, CbUserName, CbPassword, CbShell, CbWorkDir uint16
+	}
+	if err := binary.Read(wire, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+	name := make([]byte, int(header.CbDomain)+2+int(header.CbUserName))
+	if _, err := io.ReadFull(wire, name); err != nil {
+		return err
+	}
+	s.InfoFlags = pdu.InfoFlag(header.Flags)
+	s.Username = decodeTestUnicode(name[header.CbDomain+2:])
+	return nil
+}
+
+// sendLicense skips licensing with a STATUS_VALID_CLIENT error message, or
+// aborts it with LicenseError
+func (s *testServer) sendLicense() error {
+	if s.LicenseRequest != nil {
+		if err := s.sendData(codec.WrapSecurityFlag(0x0080, s.LicenseRequest)); err != nil {
+			return err
+		}
+		p, err := s.readDomainPDU()
+		if err != nil {
+			return err
+		}
+		s.LicenseReply = p.data[4:] // after the security header
+	}
+	errorCode, stateTransition := uint32(0x00000007), uint32(0x00000002) // STATUS_VALID_CLIENT, ST_NO_TRANSITION
+	if s.LicenseError != 0 {
+		errorCode, stateTransition = s.LicenseError, 0x00000001 // ST_TOTAL_ABORT
+	}
+	license := []byte{0xFF, 0x03, 0x10, 0x00} // ERROR_ALERT, PREAMBLE_VERSION_3_0, 16 bytes
+	license = binary.LittleEndian.AppendUint32(license, errorCode)
+	license = binary.LittleEndian.AppendUint32(license, stateTransition)
+	license = append(license, 0x04, 0x00, 0x00, 0x00)          // empty BB_ERROR_BLOB
+	return s.sendData(codec.WrapSecurityFlag(0x0080, license)) // SEC_LICENSE_PKT
+}
+
+// capabilitiesExchange sends the Demand Active PDU and reads the Confirm Active
+func (s *testServer) capabilitiesExchange() error {
+	sets := []pdu.CapabilitySet{
+		pdu.NewGeneralCapabilitySet(),
+		pdu.NewBitmapCapabilitySet(1024, 768),
+		pdu.NewOrderCapabilitySet(),
+		pdu.NewInputCapabilitySet(),
+	}
+	caps := new(bytes.Buffer)
+	for _, set := range sets {
+		caps.Write(set.Serialize())
+	}
+	sourceDescriptor := []byte("RDP\x00")
+
+	body := binary.LittleEndian.AppendUint32(nil, testServerShareID)
+	body = binary.LittleEndian.AppendUint16(body, uint16(len(sourceDescriptor)))
+	body = binary.LittleEndian.AppendUint16(body, uint16(4+caps.Len())) // #nosec G115
+	body = append(body, sourceDescriptor...)
+	body = binary.LittleEndian.AppendUint16(body, uint16(len(sets))) // #nosec G115
+	body = append(body, 0x00, 0x00)
+	body = append(body, caps.Bytes()...)
+	body = binary.LittleEndian.AppendUint32(body, 0) // sessionId
+
+	header := pdu.ShareControlHeader{
+		TotalLength: uint16(6 + len(body)), // #nosec G115
+		PDUType:     pdu.TypeDemandActive,
+		PDUSource:   testServerIOChannelID,
+	}
+	if err := s.sendData(append(header.Serialize(), body...)); err != nil {
+		return err
+	}
+
+	p, err := s.readDomainPDU()
+	if err != nil {
+		return err
+	}
+	s.ConfirmActive = &pdu.ClientConfirmActive{}
+	return s.ConfirmActive.Deserialize(bytes.NewReader(p.data))
+}
+
+// sendStatusInfo sends the StatusInfo codes if the client supports them
+func (s *testServer) sendStatusInfo() error {
+	if s.EarlyCapabilities&pdu.ECFSupportStatusInfoPDU == 0 {
+		return nil
+	}
+	for _, code := range s.StatusInfo {
+		body := (&pdu.StatusInfoPDUData{StatusCode: code}).Serialize()
+		header := pdu.ShareDataHeader{
+			ShareControlHeader: pdu.ShareControlHeader{
+				TotalLength: uint16(18 + len(body)), // #nosec G115
+				PDUType:     pdu.TypeData,
+				PDUSource:   testServerIOChannelID,
+			},
+			ShareID:            testServerShareID,
+			StreamID:           0x01,
+			UncompressedLength: uint16(4 + len(body)), // #nosec G115
+			PDUType2:           pdu.Type2StatusInfo,
+		}
+		if err := s.sendData(append(header.Serialize(), body...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// connectionFinalization reads the client's synchronize, control and font
+// list PDUs and answers them
+func (s *testServer) connectionFinalization() error {
+	for len(s.Finalization) < 4 {
+		p, err := s.readDomainPDU()
+		if err != nil {
+			return err
+		}
+		var header pdu.ShareDataHeader
+		if err := header.Deserialize(bytes.NewReader(p.data)); err != nil {
+			return err
+		}
+		s.Finalization = append(s.Finalization, header.PDUType2)
+	}
+
+	// The Font Map body has the layout of the client's Font List
+	fontMap := pdu.NewFontList(testServerShareID, testServerIOChannelID).Serialize()
+	fontMap[14] = uint8(pdu.Type2Fontmap)
+
+	for _, data := range [][]byte{
+		pdu.NewSynchronize(testServerShareID, testServerIOChannelID).Serialize(),
+		pdu.NewControl(testServerShareID, testServerIOChannelID, pdu.ControlActionCooperate).Serialize(),
+		pdu.NewControl(testServerShareID, testServerIOChannelID, pdu.ControlActionGrantedControl).Serialize(),
+		fontMap,
+	} {
+		if err := s.sendData(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// testDomainPDU is an MCS domain PDU from the client. For Send Data
+// Requests, data holds the user data.
+type testDomainPDU struct {
+	application uint8
+	data        []byte
+}
+
+func (s *testServer) readDomainPDU() (*testDomainPDU, error) {
+	data, err := s.readX224()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty domain PDU")
+	}
+
+	p := &testDomainPDU{application: data[0] >> 2, data: data[1:]}
+	if p.application == uint8(mcs.SendDataRequest) {
+		wire := bytes.NewReader(data)
+		var resp mcs.DomainPDU
+		if err := resp.Deserialize(wire); err != nil {
+			return nil, err
+		}
+		p.data, _ = io.ReadAll(wire)
+	}
+	return p, nil
+}
+
+// sendData sends data to the client on the I/O channel
+func (s *testServer) sendData(data []byte) error {
+	return s.sendDataOn(testServerIOChannelID, data)
+}
+
+// sendDataOn sends data to the client on the given channel
+func (s *testServer) sendDataOn(channelID uint16, data []byte) error {
+	buf := new(bytes.Buffer)
+	buf.WriteByte(uint8(mcs.SendDataIndication) << 2)
+	_ = binary.Write(buf, binary.BigEndian, testServerUserID-1001)
+	_ = binary.Write(buf, binary.BigEndian, channelID)
+	buf.WriteByte(0x70)                             // dataPriority high, segmentation begin and end
+	encoding.PerWriteLength(uint16(len(data)), buf) // #nosec G115
+	buf.Write(data)
+	return s.writeX224(buf.Bytes())
+}
+
+// readX224 reads an X.224 Data TPDU, returning its user data
+func (s *testServer) readX224() ([]byte, error) {
+	data, err := s.readTPKT()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 3 || data[1] != 0xF0 {
+		return nil, fmt.Errorf("unexpected X.224 TPDU % X", data[:min(len(data), 3)])
+	}
+	return data[3:], nil
+}
+
+func (s *testServer) writeX224(data []byte) error {
+	return s.writeTPKT(append([]byte{0x02, 0xF0, 0x80}, data...))
+}
+
+func (s *testServer) readTPKT() ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(s.r, header[:]); err != nil {
+		return nil, err
+	}
+	length := int(binary.BigEndian.Uint16(header[2:]))
+	if header[0] != 0x03 || length < len(header) {
+		return nil, fmt.Errorf("bad TPKT header % X", header)
+	}
+	data := make([]byte, length-len(header))
+	_, err := io.ReadFull(s.r, data)
+	return data, err
+}
+
+// writeTPKT sends one TPKT in a single write, as the client's TPKT layer
+// expects each read to return a whole packet
+func (s *testServer) writeTPKT(data []byte) error {
+	packet := []byte{0x03, 0x00}
+	packet = binary.BigEndian.AppendUint16(packet, uint16(4+len(data))) // #nosec G115
+	_, err := s.conn.Write(append(packet, data...))
+	return err
+}
+
+// clientChannelNames returns the channels of the Client Network Data in an
+// MCS Connect Initial
+func clientChannelNames(connectInitial []byte) ([]string, error) {
+	block, err := clientDataBlock(connectInitial, 0xC003) // CS_NET
+	if block == nil {
+		return nil, err
+	}
+	count := int(binary.LittleEndian.Uint32(block))
+	names := make([]string, 0, count)
+	for i := range count {
+		def := block[4+12*i:]
+		names = append(names, string(bytes.TrimRight(def[:8], "\x00")))
+	}
+	return names, nil
+}
+
+// clientDataBlock returns the body of the client data block of the given
+// type in an MCS Connect Initial, found after the H.221 client key, or nil
+// if the client did not send one
+func clientDataBlock(connectInitial []byte, blockType uint16) ([]byte, error) {
+	idx := bytes.Index(connectInitial, []byte("Duca"))
+	if idx == -1 {
+		return nil, errors.New("no client data in connect initial")
+	}
+	wire := bytes.NewReader(connectInitial[idx+4:])
+	if _, err := encoding.PerReadLength(wire); err != nil {
+		return nil, err
+	}
+	blocks, _ := io.ReadAll(wire)
+
+	for len(blocks) >= 4 {
+		typ := binary.LittleEndian.Uint16(blocks)
+		blockLen := int(binary.LittleEndian.Uint16(blocks[2:]))
+		if blockLen < 4 || blockLen > len(blocks) {
+			return nil, fmt.Errorf("bad client data block 0x%04X", typ)
+		}
+		if typ == blockType {
+			return blocks[4:blockLen], nil
+		}
+		blocks = blocks[blockLen:]
+	}
+	return nil, nil
+}
+
+func writeDataBlock(buf *bytes.Buffer, blockType uint16, data []byte) {
+	_ = binary.Write(buf, binary.LittleEndian, blockType)
+	_ = binary.Write(buf, binary.LittleEndian, uint16(4+len(data))) // #nosec G115
+	buf.Write(data)
+}
+
+func decodeTestUnicode(data []byte) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		units = append(units, binary.LittleEndian.Uint16(data[i:]))
+	}
+	return string(utf16.Decode(units))
+}
+
+func testServerCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "rdp.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
@@ -31,10 +31,10 @@ func (c *Client) StartTLS() error {
 	}
 
 	if cfg != nil {
-		if !insecureSkipVerify {
+		if !c.tlsConfigSet && !insecureSkipVerify {
 			insecureSkipVerify = cfg.Security.SkipTLSValidation
 		}
-		if serverName == "" {
+		if !c.tlsConfigSet && serverName == "" {
 			serverName = cfg.Security.TLSServerName
 		}
 		allowAnyServer = cfg.Security.AllowAnyTLSServer
@@ -61,6 +61,9 @@ func (c *Client) StartTLS() error {
 		MaxVersion:         tls.VersionTLS13,
 		ServerName:         serverName,
 	}
+	if c.clientCertificate != nil {
+		tlsConfig.Certificates = []tls.Certificate{*c.clientCertificate}
+	}
 
 	// When skipping validation or allowing any server, ensure we still set an SNI value
 	if (tlsConfig.InsecureSkipVerify || allowAnyServer) && tlsConfig.ServerName == "" {
@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"encoding/binary"
 	"io"
+
+	"github.com/rcarmo/go-rdp/internal/logging"
+	"github.com/rcarmo/go-rdp/internal/protocol/pdu"
 )
 
 // ChannelFlag represents flags for RDP virtual channel PDUs.
@@ -72,3 +75,41 @@ func (h *ChannelPDUHeader) Deserialize(wire io.Reader) error {
 
 	return nil
 }
+
+// SetMaxChannels caps the static virtual channels the client requests and
+// joins. Zero, or a value above pdu.MaxStaticChannels, uses the protocol
+// maximum. It must be called before Connect.
+func (c *Client) SetMaxChannels(n int) {
+	c.maxChannels = n
+}
+
+// channelLimit returns the number of static virtual channels to request.
+func (c *Client) channelLimit() int {
+	if c.maxChannels <= 0 || c.maxChannels > pdu.MaxStaticChannels {
+		return pdu.MaxStaticChannels
+	}
+	return c.maxChannels
+}
+
+// limitChannels drops the channels beyond the limit, keeping the ones
+// enabled first.
+func (c *Client) limitChannels() {
+	limit := c.channelLimit()
+	if len(c.channels) <= limit {
+		return
+	}
+	logging.Warn("Requesting %d of %d virtual channels, dropping %v", limit, len(c.channels), c.channels[limit:])
+	c.channels = c.channels[:limit]
+}
+
+// limitChannelIDs truncates the channel IDs the server assigned to the
+// channels requested, so a server listing more never causes extra joins.
+func (c *Client) limitChannelIDs(networkData *pdu.ServerNetworkData) {
+	if len(networkData.ChannelIdArray) <= len(c.channels) {
+		return
+	}
+	logging.Warn("Server assigned %d channel IDs for %d requested channels, ignoring the rest",
+		len(networkData.ChannelIdArray), len(c.channels))
+	networkData.ChannelIdArray = networkData.ChannelIdArray[:len(c.channels)]
+	networkData.ChannelCount = uint16(len(c.channels)) // #nosec G115 -- at most pdu.MaxStaticChannels
+}
@@ -1,6 +1,11 @@
 package rdp
 
-// Write writes raw bytes to the underlying RDP connection.
+// Write writes raw bytes to the underlying RDP connection. Every layer
+// writes a whole PDU per call, and calls are serialized so PDUs sent from
+// the input, clipboard and channel goroutines are never interleaved on the
+// wire.
 func (c *Client) Write(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
 	return c.conn.Write(b)
 }
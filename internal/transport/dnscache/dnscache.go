@@ -0,0 +1,155 @@
+// Package dnscache caches host lookups for the RDP dial path, so that a
+// gateway fronting a few hosts does not resolve the same names for every
+// connection.
+package dnscache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxEntries bounds the names held, so clients naming many hosts cannot
+// grow the cache without limit.
+const maxEntries = 256
+
+// Resolver looks up the addresses of a host. *net.Resolver implements it.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+type entry struct {
+	addrs   []string
+	err     error
+	expires time.Time
+}
+
+// Cache is a Resolver that remembers successful lookups for a TTL and
+// names that do not exist for a negative TTL. Other failures, such as
+// timeouts, are not cached.
+type Cache struct {
+	resolver    Resolver
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	// Dialer dials the resolved addresses; nil uses a zero net.Dialer
+	Dialer *net.Dialer
+
+	mu      sync.Mutex
+	now     func() time.Time
+	entries map[string]entry
+}
+
+// New creates a cache in front of resolver, net.DefaultResolver when nil.
+// A zero ttl or negativeTTL disables caching of that kind of result.
+func New(resolver Resolver, ttl, negativeTTL time.Duration) *Cache {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &Cache{
+		resolver:    resolver,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		now:         time.Now,
+		entries:     make(map[string]entry),
+	}
+}
+
+// TTLs returns the positive and negative TTLs the cache was created with.
+func (c *Cache) TTLs() (ttl, negativeTTL time.Duration) {
+	return c.ttl, c.negativeTTL
+}
+
+// LookupHost returns the addresses of host, from the cache while its entry
+// is fresh. IP literals are returned as is.
+func (c *Cache) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	c.mu.Lock()
+	e, ok := c.entries[host]
+	now := c.now()
+	if ok && now.Before(e.expires) {
+		c.mu.Unlock()
+		return e.addrs, e.err
+	}
+	c.mu.Unlock()
+
+	addrs, err := c.resolver.LookupHost(ctx, host)
+
+	var ttl time.Duration
+	switch {
+	case err == nil:
+		ttl = c.ttl
+	case isNotFound(err):
+		ttl = c.negativeTTL
+	}
+	if ttl > 0 {
+		c.store(host, entry{addrs: addrs, err: err, expires: now.Add(ttl)})
+	}
+	return addrs, err
+}
+
+func (c *Cache) store(host string, e entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= maxEntries {
+		now := c.now()
+		for name, old := range c.entries {
+			if !now.Before(old.expires) {
+				delete(c.entries, name)
+			}
+		}
+		// Still full of fresh entries: make room by evicting any one
+		for name := range c.entries {
+			if len(c.entries) < maxEntries {
+				break
+			}
+			delete(c.entries, name)
+		}
+	}
+	c.entries[host] = e
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// DialContext resolves the host of address through the cache and dials its
+// addresses in turn, returning the first connection established.
+func (c *Cache) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := c.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("dial %s: no addresses for %s", network, host)
+	}
+
+	dialer := c.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	var errs []error
+	for _, addr := range addrs {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,151 @@
+package dnscache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeResolver answers from a table and counts lookups per host
+type fakeResolver struct {
+	addrs   map[string][]string
+	errs    map[string]error
+	lookups map[string]int
+}
+
+func newFakeResolver() *fakeResolver {
+	return &fakeResolver{addrs: map[string][]string{}, errs: map[string]error{}, lookups: map[string]int{}}
+}
+
+func (r *fakeResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	r.lookups[host]++
+	if err, ok := r.errs[host]; ok {
+		return nil, err
+	}
+	return r.addrs[host], nil
+}
+
+// newTestCache returns a cache with a clock advanced by the returned func
+func newTestCache(r Resolver, ttl, negativeTTL time.Duration) (*Cache, func(time.Duration)) {
+	c := New(r, ttl, negativeTTL)
+	now := time.Unix(1700000000, 0)
+	c.now = func() time.Time { return now }
+	return c, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestCache_Hit(t *testing.T) {
+	r := newFakeResolver()
+	r.addrs["rdp.example"] = []string{"10.0.0.5"}
+	c, _ := newTestCache(r, time.Minute, 0)
+
+	for i := 0; i < 3; i++ {
+		addrs, err := c.LookupHost(context.Background(), "rdp.example")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"10.0.0.5"}, addrs)
+	}
+	assert.Equal(t, 1, r.lookups["rdp.example"])
+}
+
+func TestCache_Expiry(t *testing.T) {
+	r := newFakeResolver()
+	r.addrs["rdp.example"] = []string{"10.0.0.5"}
+	c, advance := newTestCache(r, time.Minute, 0)
+
+	_, err := c.LookupHost(context.Background(), "rdp.example")
+	require.NoError(t, err)
+
+	r.addrs["rdp.example"] = []string{"10.0.0.6"}
+	advance(59 * time.Second)
+	addrs, _ := c.LookupHost(context.Background(), "rdp.example")
+	assert.Equal(t, []string{"10.0.0.5"}, addrs, "fresh entry")
+
+	advance(time.Second)
+	addrs, _ = c.LookupHost(context.Background(), "rdp.example")
+	assert.Equal(t, []string{"10.0.0.6"}, addrs, "expired entry is resolved again")
+	assert.Equal(t, 2, r.lookups["rdp.example"])
+}
+
+func TestCache_NegativeCaching(t *testing.T) {
+	r := newFakeResolver()
+	r.errs["missing.example"] = &net.DNSError{Err: "no such host", Name: "missing.example", IsNotFound: true}
+	r.errs["flaky.example"] = &net.DNSError{Err: "i/o timeout", Name: "flaky.example", IsTimeout: true}
+	c, advance := newTestCache(r, time.Minute, 5*time.Second)
+
+	for i := 0; i < 2; i++ {
+		_, err := c.LookupHost(context.Background(), "missing.example")
+		var dnsErr *net.DNSError
+		require.True(t, errors.As(err, &dnsErr))
+		assert.True(t, dnsErr.IsNotFound)
+
+		_, err = c.LookupHost(context.Background(), "flaky.example")
+		require.Error(t, err)
+	}
+	assert.Equal(t, 1, r.lookups["missing.example"])
+	assert.Equal(t, 2, r.lookups["flaky.example"], "timeouts are not cached")
+
+	advance(5 * time.Second)
+	_, _ = c.LookupHost(context.Background(), "missing.example")
+	assert.Equal(t, 2, r.lookups["missing.example"])
+}
+
+func TestCache_Disabled(t *testing.T) {
+	r := newFakeResolver()
+	r.addrs["rdp.example"] = []string{"10.0.0.5"}
+	c, _ := newTestCache(r, 0, 0)
+
+	_, _ = c.LookupHost(context.Background(), "rdp.example")
+	_, _ = c.LookupHost(context.Background(), "rdp.example")
+	assert.Equal(t, 2, r.lookups["rdp.example"])
+}
+
+func TestCache_IPLiteral(t *testing.T) {
+	r := newFakeResolver()
+	c, _ := newTestCache(r, time.Minute, 0)
+
+	addrs, err := c.LookupHost(context.Background(), "2001:db8::1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2001:db8::1"}, addrs)
+	assert.Empty(t, r.lookups)
+}
+
+func TestCache_Bounded(t *testing.T) {
+	r := newFakeResolver()
+	c, _ := newTestCache(r, time.Minute, 0)
+
+	for i := 0; i < maxEntries+10; i++ {
+		host := fmt.Sprintf("host%d.example", i)
+		r.addrs[host] = []string{"10.0.0.1"}
+		_, _ = c.LookupHost(context.Background(), host)
+	}
+	assert.LessOrEqual(t, len(c.entries), maxEntries)
+}
+
+func TestCache_DialContext(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = ln.Close() }()
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			_ = conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	r := newFakeResolver()
+	r.addrs["rdp.example"] = []string{"127.0.0.1"}
+	c, _ := newTestCache(r, time.Minute, 0)
+
+	conn, err := c.DialContext(context.Background(), "tcp", net.JoinHostPort("rdp.example", port))
+	require.NoError(t, err)
+	_ = conn.Close()
+
+	r.addrs["empty.example"] = nil
+	_, err = c.DialContext(context.Background(), "tcp", "empty.example:3389")
+	assert.Error(t, err)
+}
@@ -0,0 +1,181 @@
+package rdg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httputil"
+	"sync"
+	"time"
+
+	"github.com/rcarmo/go-rdp/internal/logging"
+)
+
+// closeTimeout bounds sending the close packet when the tunnel is closed
+const closeTimeout = time.Second
+
+// Conn is an RDP connection tunnelled through the gateway. Writes go out as
+// data packets on the IN channel; reads return the data packets of the OUT
+// channel.
+type Conn struct {
+	in      net.Conn
+	inBody  io.WriteCloser
+	out     *outChannel
+	writeMu sync.Mutex
+
+	// pending is the unread part of the last data packet
+	pending []byte
+	closed  bool
+
+	tunnelID  uint32
+	channelID uint32
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func newConn(in net.Conn, out *outChannel) *Conn {
+	return &Conn{in: in, inBody: httputil.NewChunkedWriter(in), out: out}
+}
+
+// openChannel runs the tunnel handshake and opens the channel to host:port
+func (c *Conn) openChannel(clientName, host string, port uint16) error {
+	if err := c.exchange(handshakeRequest(), pktTypeHandshakeResponse, func(body []byte) error {
+		return parseHandshakeResponse(body)
+	}); err != nil {
+		return err
+	}
+
+	if err := c.exchange(tunnelCreate(), pktTypeTunnelResponse, func(body []byte) (err error) {
+		c.tunnelID, err = parseTunnelResponse(body)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := c.exchange(tunnelAuth(clientName), pktTypeTunnelAuthResponse, func(body []byte) error {
+		idleTimeout, err := parseTunnelAuthResponse(body)
+		if idleTimeout > 0 {
+			logging.Debug("RD Gateway idle timeout: %d minutes", idleTimeout)
+		}
+		return err
+	}); err != nil {
+		return err
+	}
+
+	return c.exchange(channelCreate(host, port), pktTypeChannelResponse, func(body []byte) (err error) {
+		c.channelID, err = parseChannelResponse(body)
+		return err
+	})
+}
+
+// exchange sends a request packet and passes the body of the response,
+// which must have type want, to handle. Keepalives are skipped.
+func (c *Conn) exchange(request []byte, want uint16, handle func(body []byte) error) error {
+	if err := c.writePacket(request); err != nil {
+		return err
+	}
+	for {
+		p, err := readPacket(c.out.body)
+		if err != nil {
+			return err
+		}
+		switch p.typ {
+		case pktTypeKeepalive:
+			continue
+		case want:
+			return handle(p.body)
+		default:
+			return fmt.Errorf("%w: type 0x%02X, expected 0x%02X", ErrUnexpectedPacket, p.typ, want)
+		}
+	}
+}
+
+// writePacket sends one packet as a chunk of the IN channel body
+func (c *Conn) writePacket(p []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.inBody.Write(p)
+	return err
+}
+
+// Read returns data sent by the RDP server. It returns io.EOF once the
+// gateway closes the channel.
+func (c *Conn) Read(b []byte) (int, error) {
+	for len(c.pending) == 0 {
+		if c.closed {
+			return 0, io.EOF
+		}
+		p, err := readPacket(c.out.body)
+		if err != nil {
+			return 0, err
+		}
+		switch p.typ {
+		case pktTypeData:
+			if c.pending, err = parseData(p.body); err != nil {
+				return 0, err
+			}
+		case pktTypeCloseChannel:
+			logging.Debug("RD Gateway closed channel %d", c.channelID)
+			_ = c.writePacket(encodePacket(pktTypeCloseChannelResponse, make([]byte, 4)))
+			c.closed = true
+		case pktTypeServiceMessage:
+			logging.Info("RD Gateway message: %s", parseServiceMessage(p.body))
+		case pktTypeKeepalive:
+		default:
+			logging.Debug("RD Gateway: ignoring packet type 0x%02X", p.typ)
+		}
+	}
+
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write sends data to the RDP server, split into data packets as needed.
+func (c *Conn) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		n := min(len(b)-written, maxDataLength)
+		if err := c.writePacket(dataPacket(b[written : written+n])); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// Close asks the gateway to close the channel and closes both connections.
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		_ = c.in.SetWriteDeadline(time.Now().Add(closeTimeout))
+		if err := c.writePacket(closeChannel(0)); err == nil {
+			// Terminate the chunked IN channel body
+			_ = c.inBody.Close()
+		}
+		c.closeErr = c.closeChannels()
+	})
+	return c.closeErr
+}
+
+func (c *Conn) closeChannels() error {
+	return errors.Join(c.in.Close(), c.out.Close())
+}
+
+// LocalAddr returns the local address of the OUT channel.
+func (c *Conn) LocalAddr() net.Addr { return c.out.conn.LocalAddr() }
+
+// RemoteAddr returns the gateway address.
+func (c *Conn) RemoteAddr() net.Addr { return c.out.conn.RemoteAddr() }
+
+// SetDeadline sets the read and write deadlines.
+func (c *Conn) SetDeadline(t time.Time) error {
+	return errors.Join(c.SetReadDeadline(t), c.SetWriteDeadline(t))
+}
+
+// SetReadDeadline sets the deadline for reads from the OUT channel.
+func (c *Conn) SetReadDeadline(t time.Time) error { return c.out.conn.SetReadDeadline(t) }
+
+// SetWriteDeadline sets the deadline for writes to the IN channel.
+func (c *Conn) SetWriteDeadline(t time.Time) error { return c.in.SetWriteDeadline(t) }
@@ -0,0 +1,202 @@
+package rdg
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rcarmo/go-rdp/internal/auth"
+)
+
+// HTTP methods of the two channels
+const (
+	methodOutData = "RDG_OUT_DATA"
+	methodInData  = "RDG_IN_DATA"
+)
+
+const (
+	gatewayPath      = "/remoteDesktopGateway/"
+	gatewayUserAgent = "MS-RDGateway/1.0"
+
+	// gatewayDialTimeout bounds the TCP connect when the context has no deadline
+	gatewayDialTimeout = 10 * time.Second
+)
+
+// noDeadline clears a connection deadline
+var noDeadline time.Time
+
+// channel is an authenticated HTTPS connection to the gateway
+type channel struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// openOutChannel authenticates the OUT channel, returning a reader over the
+// body of the gateway's response, which carries the server packets
+func (d *Dialer) openOutChannel(ctx context.Context, connectionID string) (*outChannel, error) {
+	ch, err := d.authenticate(ctx, methodOutData, connectionID, "Content-Length: 0")
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.ReadResponse(ch.reader, nil)
+	if err != nil {
+		_ = ch.conn.Close()
+		return nil, err
+	}
+	if err := checkStatus(resp); err != nil {
+		_ = resp.Body.Close()
+		_ = ch.conn.Close()
+		return nil, err
+	}
+	_ = ch.conn.SetDeadline(noDeadline)
+	return &outChannel{conn: ch.conn, body: bufio.NewReader(resp.Body)}, nil
+}
+
+// openInChannel authenticates the IN channel, whose chunked request body
+// then carries the client packets. The gateway answers that request only
+// when the tunnel closes.
+func (d *Dialer) openInChannel(ctx context.Context, connectionID string) (net.Conn, error) {
+	ch, err := d.authenticate(ctx, methodInData, connectionID, "Transfer-Encoding: chunked")
+	if err != nil {
+		return nil, err
+	}
+	_ = ch.conn.SetDeadline(noDeadline)
+	return ch.conn, nil
+}
+
+// authenticate connects to the gateway and performs the NTLM exchange on
+// method, leaving the authenticated request sent with bodyHeader
+func (d *Dialer) authenticate(ctx context.Context, method, connectionID, bodyHeader string) (*channel, error) {
+	ch, err := d.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	domain, user := d.credentials()
+	ntlm := auth.NewNTLMv2(domain, user, d.Password)
+
+	if err := ch.writeRequest(d.Gateway, method, connectionID, ntlm.GetNegotiateMessage(), "Content-Length: 0"); err != nil {
+		_ = ch.conn.Close()
+		return nil, err
+	}
+	challenge, err := ch.readChallenge()
+	if err != nil {
+		_ = ch.conn.Close()
+		return nil, err
+	}
+
+	authenticate, _ := ntlm.GetAuthenticateMessage(challenge)
+	if authenticate == nil {
+		_ = ch.conn.Close()
+		return nil, fmt.Errorf("%w: invalid NTLM challenge", ErrAuthenticationFailed)
+	}
+	if err := ch.writeRequest(d.Gateway, method, connectionID, authenticate, bodyHeader); err != nil {
+		_ = ch.conn.Close()
+		return nil, err
+	}
+	return ch, nil
+}
+
+// connect opens a TLS connection to the gateway
+func (d *Dialer) connect(ctx context.Context) (*channel, error) {
+	dial := d.DialGateway
+	if dial == nil {
+		dialer := &net.Dialer{Timeout: gatewayDialTimeout}
+		dial = dialer.DialContext
+	}
+	address := d.gatewayAddress()
+	raw, err := dial(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("connect %s: %w", address, err)
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if d.TLSConfig != nil {
+		config = d.TLSConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName, _, _ = net.SplitHostPort(address)
+	}
+	conn := tls.Client(raw, config)
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if err := conn.HandshakeContext(ctx); err != nil {
+		_ = raw.Close()
+		return nil, fmt.Errorf("TLS handshake with %s: %w", address, err)
+	}
+	return &channel{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// writeRequest sends a channel request carrying an NTLM token
+func (ch *channel) writeRequest(gateway, method, connectionID string, token []byte, bodyHeader string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\n", method, gatewayPath)
+	fmt.Fprintf(&b, "Host: %s\r\n", gateway)
+	b.WriteString("Accept: */*\r\n")
+	b.WriteString("Cache-Control: no-cache\r\n")
+	b.WriteString("Pragma: no-cache\r\n")
+	b.WriteString("Connection: Keep-Alive\r\n")
+	fmt.Fprintf(&b, "User-Agent: %s\r\n", gatewayUserAgent)
+	fmt.Fprintf(&b, "RDG-Connection-Id: %s\r\n", connectionID)
+	fmt.Fprintf(&b, "Authorization: NTLM %s\r\n", base64.StdEncoding.EncodeToString(token))
+	fmt.Fprintf(&b, "%s\r\n\r\n", bodyHeader)
+
+	_, err := io.WriteString(ch.conn, b.String())
+	return err
+}
+
+// readChallenge reads the 401 response carrying the NTLM challenge
+func (ch *channel) readChallenge() ([]byte, error) {
+	resp, err := http.ReadResponse(ch.reader, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	// Drain the body so the next response can be read from the connection
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		return nil, fmt.Errorf("expected NTLM challenge, gateway returned %s", resp.Status)
+	}
+	for _, value := range resp.Header.Values("WWW-Authenticate") {
+		if token, ok := strings.CutPrefix(value, "NTLM "); ok {
+			challenge, err := base64.StdEncoding.DecodeString(strings.TrimSpace(token))
+			if err != nil {
+				return nil, fmt.Errorf("%w: malformed NTLM challenge", ErrAuthenticationFailed)
+			}
+			return challenge, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: gateway does not offer NTLM", ErrAuthenticationFailed)
+}
+
+// checkStatus maps the response to the authenticated request to an error
+func checkStatus(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %s", ErrAuthenticationFailed, resp.Status)
+	default:
+		return fmt.Errorf("gateway returned %s", resp.Status)
+	}
+}
+
+// outChannel reads the server packets from the OUT channel response body
+type outChannel struct {
+	conn net.Conn
+	body *bufio.Reader
+}
+
+func (o *outChannel) Close() error {
+	return o.conn.Close()
+}
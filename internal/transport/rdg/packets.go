@@ -0,0 +1,248 @@
+package rdg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unicode/utf16"
+)
+
+// Packet types of the HTTP transport (HTTP_PACKET_HEADER packetType)
+const (
+	pktTypeHandshakeRequest     uint16 = 0x01
+	pktTypeHandshakeResponse    uint16 = 0x02
+	pktTypeExtendedAuthMsg      uint16 = 0x03
+	pktTypeTunnelCreate         uint16 = 0x04
+	pktTypeTunnelResponse       uint16 = 0x05
+	pktTypeTunnelAuth           uint16 = 0x06
+	pktTypeTunnelAuthResponse   uint16 = 0x07
+	pktTypeChannelCreate        uint16 = 0x08
+	pktTypeChannelResponse      uint16 = 0x09
+	pktTypeData                 uint16 = 0x0A
+	pktTypeServiceMessage       uint16 = 0x0B
+	pktTypeReauthMessage        uint16 = 0x0C
+	pktTypeKeepalive            uint16 = 0x0D
+	pktTypeCloseChannel         uint16 = 0x10
+	pktTypeCloseChannelResponse uint16 = 0x11
+)
+
+const (
+	// packetHeaderLength is the size of HTTP_PACKET_HEADER
+	packetHeaderLength = 8
+
+	// maxPacketLength bounds the packets accepted from the gateway; data
+	// packets carry at most 64 KiB and the others are far smaller
+	maxPacketLength = 128 * 1024
+
+	// maxDataLength is the most data one HTTP_DATA_PACKET carries (cbDataLen is 16 bits)
+	maxDataLength = 0xFFFF
+
+	// httpExtendedAuthNone HTTP_EXTENDED_AUTH_NONE: authentication is done by the HTTP layer
+	httpExtendedAuthNone uint16 = 0x0000
+
+	// httpCapabilityIdleTimeout HTTP_CAPABILITY_IDLE_TIMEOUT
+	httpCapabilityIdleTimeout uint32 = 0x00000002
+
+	// Optional fields of the tunnel and channel responses
+	httpTunnelResponseFieldTunnelID    uint16 = 0x0001
+	httpChannelResponseFieldChannelID  uint16 = 0x0001
+	httpTunnelAuthResponseFieldRedir   uint16 = 0x0001
+	httpTunnelAuthResponseFieldTimeout uint16 = 0x0002
+
+	// rdpProtocol is the protocol of HTTP_CHANNEL_PACKET, always 3 for RDP
+	rdpProtocol uint16 = 3
+)
+
+// packet is an HTTP transport packet without its header
+type packet struct {
+	typ  uint16
+	body []byte
+}
+
+// readPacket reads one packet from the OUT channel
+func readPacket(r io.Reader) (*packet, error) {
+	var header [packetHeaderLength]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	length := binary.LittleEndian.Uint32(header[4:])
+	if length < packetHeaderLength || length > maxPacketLength {
+		return nil, fmt.Errorf("%w: packet length %d", ErrMalformedPacket, length)
+	}
+
+	p := &packet{typ: binary.LittleEndian.Uint16(header[0:]), body: make([]byte, length-packetHeaderLength)}
+	if _, err := io.ReadFull(r, p.body); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedPacket, err)
+	}
+	return p, nil
+}
+
+// encodePacket prefixes body with an HTTP_PACKET_HEADER
+func encodePacket(typ uint16, body []byte) []byte {
+	buf := make([]byte, packetHeaderLength, packetHeaderLength+len(body))
+	binary.LittleEndian.PutUint16(buf[0:], typ)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(packetHeaderLength+len(body))) // #nosec G115
+	return append(buf, body...)
+}
+
+// handshakeRequest encodes HTTP_HANDSHAKE_REQUEST_PACKET for version 1.0
+func handshakeRequest() []byte {
+	body := new(bytes.Buffer)
+	body.Write([]byte{0x01, 0x00})                                    // verMajor, verMinor
+	_ = binary.Write(body, binary.LittleEndian, uint16(0))            // clientVersion
+	_ = binary.Write(body, binary.LittleEndian, httpExtendedAuthNone) // extendedAuth
+	return encodePacket(pktTypeHandshakeRequest, body.Bytes())
+}
+
+// tunnelCreate encodes HTTP_TUNNEL_PACKET without a PAA cookie
+func tunnelCreate() []byte {
+	body := new(bytes.Buffer)
+	_ = binary.Write(body, binary.LittleEndian, httpCapabilityIdleTimeout) // capsFlags
+	_ = binary.Write(body, binary.LittleEndian, uint16(0))                 // fieldsPresent
+	_ = binary.Write(body, binary.LittleEndian, uint16(0))                 // reserved
+	return encodePacket(pktTypeTunnelCreate, body.Bytes())
+}
+
+// tunnelAuth encodes HTTP_TUNNEL_AUTH_PACKET naming the client
+func tunnelAuth(clientName string) []byte {
+	name := encodeUnicodeString(clientName)
+	body := new(bytes.Buffer)
+	_ = binary.Write(body, binary.LittleEndian, uint16(0))         // fieldsPresent
+	_ = binary.Write(body, binary.LittleEndian, uint16(len(name))) // #nosec G115 -- cbClientName
+	body.Write(name)
+	return encodePacket(pktTypeTunnelAuth, body.Bytes())
+}
+
+// channelCreate encodes HTTP_CHANNEL_PACKET asking for a channel to host:port
+func channelCreate(host string, port uint16) []byte {
+	name := encodeUnicodeString(host)
+	body := new(bytes.Buffer)
+	body.Write([]byte{0x01, 0x00}) // numResources, numAltResources
+	_ = binary.Write(body, binary.LittleEndian, port)
+	_ = binary.Write(body, binary.LittleEndian, rdpProtocol)
+	_ = binary.Write(body, binary.LittleEndian, uint16(len(name))) // #nosec G115
+	body.Write(name)
+	return encodePacket(pktTypeChannelCreate, body.Bytes())
+}
+
+// dataPacket encodes HTTP_DATA_PACKET; data must fit in maxDataLength
+func dataPacket(data []byte) []byte {
+	body := make([]byte, 2, 2+len(data))
+	binary.LittleEndian.PutUint16(body, uint16(len(data))) // #nosec G115
+	return encodePacket(pktTypeData, append(body, data...))
+}
+
+// closeChannel encodes HTTP_CLOSE_PACKET
+func closeChannel(status uint32) []byte {
+	body := make([]byte, 4)
+	binary.LittleEndian.PutUint32(body, status)
+	return encodePacket(pktTypeCloseChannel, body)
+}
+
+// parseHandshakeResponse checks HTTP_HANDSHAKE_RESPONSE_PACKET
+func parseHandshakeResponse(body []byte) error {
+	if len(body) < 10 {
+		return fmt.Errorf("%w: handshake response of %d bytes", ErrMalformedPacket, len(body))
+	}
+	if code := binary.LittleEndian.Uint32(body); code != 0 {
+		return fmt.Errorf("%w: handshake: HRESULT 0x%08X", ErrGatewayRejected, code)
+	}
+	return nil
+}
+
+// parseTunnelResponse checks HTTP_TUNNEL_RESPONSE and returns the tunnel ID, if sent
+func parseTunnelResponse(body []byte) (uint32, error) {
+	if len(body) < 10 {
+		return 0, fmt.Errorf("%w: tunnel response of %d bytes", ErrMalformedPacket, len(body))
+	}
+	if code := binary.LittleEndian.Uint32(body[2:]); code != 0 {
+		return 0, fmt.Errorf("%w: tunnel create: HRESULT 0x%08X", ErrGatewayRejected, code)
+	}
+	fields := binary.LittleEndian.Uint16(body[6:])
+	if fields&httpTunnelResponseFieldTunnelID != 0 && len(body) >= 14 {
+		return binary.LittleEndian.Uint32(body[10:]), nil
+	}
+	return 0, nil
+}
+
+// parseTunnelAuthResponse checks HTTP_TUNNEL_AUTH_RESPONSE and returns the
+// idle timeout in minutes the gateway enforces, if sent
+func parseTunnelAuthResponse(body []byte) (uint32, error) {
+	if len(body) < 8 {
+		return 0, fmt.Errorf("%w: tunnel auth response of %d bytes", ErrMalformedPacket, len(body))
+	}
+	if code := binary.LittleEndian.Uint32(body); code != 0 {
+		return 0, fmt.Errorf("%w: tunnel auth: HRESULT 0x%08X", ErrGatewayRejected, code)
+	}
+
+	fields := binary.LittleEndian.Uint16(body[4:])
+	off := 8
+	if fields&httpTunnelAuthResponseFieldRedir != 0 {
+		off += 4 // redirFlags
+	}
+	if fields&httpTunnelAuthResponseFieldTimeout != 0 && len(body) >= off+4 {
+		return binary.LittleEndian.Uint32(body[off:]), nil
+	}
+	return 0, nil
+}
+
+// parseChannelResponse checks HTTP_CHANNEL_RESPONSE and returns the channel ID, if sent
+func parseChannelResponse(body []byte) (uint32, error) {
+	if len(body) < 8 {
+		return 0, fmt.Errorf("%w: channel response of %d bytes", ErrMalformedPacket, len(body))
+	}
+	if code := binary.LittleEndian.Uint32(body); code != 0 {
+		return 0, fmt.Errorf("%w: channel create: HRESULT 0x%08X", ErrGatewayRejected, code)
+	}
+	fields := binary.LittleEndian.Uint16(body[4:])
+	if fields&httpChannelResponseFieldChannelID != 0 && len(body) >= 12 {
+		return binary.LittleEndian.Uint32(body[8:]), nil
+	}
+	return 0, nil
+}
+
+// parseData returns the payload of HTTP_DATA_PACKET
+func parseData(body []byte) ([]byte, error) {
+	if len(body) < 2 {
+		return nil, fmt.Errorf("%w: data packet of %d bytes", ErrMalformedPacket, len(body))
+	}
+	n := int(binary.LittleEndian.Uint16(body))
+	if 2+n > len(body) {
+		return nil, fmt.Errorf("%w: data length %d exceeds packet", ErrMalformedPacket, n)
+	}
+	return body[2 : 2+n], nil
+}
+
+// parseServiceMessage decodes HTTP_SERVICE_MESSAGE, a message for the user
+func parseServiceMessage(body []byte) string {
+	if len(body) < 2 {
+		return ""
+	}
+	n := int(binary.LittleEndian.Uint16(body))
+	return decodeUnicodeString(body[2:min(2+n, len(body))])
+}
+
+// encodeUnicodeString encodes a null-terminated UTF-16LE string
+func encodeUnicodeString(s string) []byte {
+	units := append(utf16.Encode([]rune(s)), 0)
+	data := make([]byte, 2*len(units))
+	for i, unit := range units {
+		binary.LittleEndian.PutUint16(data[2*i:], unit)
+	}
+	return data
+}
+
+// decodeUnicodeString decodes a UTF-16LE string, stopping at the first null
+func decodeUnicodeString(data []byte) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		unit := binary.LittleEndian.Uint16(data[i:])
+		if unit == 0 {
+			break
+		}
+		units = append(units, unit)
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,151 @@
+// Package rdg tunnels RDP connections through a Remote Desktop Gateway using
+// the HTTP transport of the Terminal Services Gateway protocol (MS-TSGU).
+// Two HTTPS connections to the gateway, authenticated with NTLM, carry the
+// tunnel: the IN channel sends client data and the OUT channel receives
+// server data.
+//
+// Reference: [MS-TSGU] Terminal Services Gateway Server Protocol
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-tsgu/
+package rdg
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/rcarmo/go-rdp/internal/logging"
+)
+
+var (
+	// ErrAuthenticationFailed is returned when the gateway rejects the credentials
+	ErrAuthenticationFailed = errors.New("gateway authentication failed")
+
+	// ErrGatewayRejected is returned when the gateway refuses the tunnel or
+	// the channel to the RDP server
+	ErrGatewayRejected = errors.New("gateway rejected the request")
+
+	// ErrMalformedPacket is returned for a packet that cannot be decoded
+	ErrMalformedPacket = errors.New("malformed gateway packet")
+
+	// ErrUnexpectedPacket is returned when the gateway answers a request
+	// with a packet of the wrong type
+	ErrUnexpectedPacket = errors.New("unexpected gateway packet")
+)
+
+const (
+	// defaultGatewayPort is used when the gateway address names no port
+	defaultGatewayPort = "443"
+
+	// defaultClientName identifies the client to the gateway when none is set
+	defaultClientName = "go-rdp"
+)
+
+// Dialer opens connections to RDP servers through an RD Gateway.
+type Dialer struct {
+	// Gateway is the gateway host, optionally with a port (default 443)
+	Gateway string
+
+	// Username, Password and Domain authenticate to the gateway. The user
+	// name may also carry the domain as DOMAIN\user or user@domain.
+	Username string
+	Password string
+	Domain   string
+
+	// TLSConfig configures the HTTPS connections to the gateway. When nil
+	// the gateway certificate is verified against the system roots.
+	TLSConfig *tls.Config
+
+	// ClientName identifies the client to the gateway (default "go-rdp")
+	ClientName string
+
+	// DialGateway opens the TCP connections to the gateway; nil uses net.Dialer
+	DialGateway func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// DialContext opens a tunnel through the gateway to address, the host:port
+// of an RDP server. Its signature matches the dialer taken by
+// rdp.NewClientWithDialContext.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if network != "tcp" {
+		return nil, fmt.Errorf("rdg: unsupported network %q", network)
+	}
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("rdg: %w", err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("rdg: invalid port %q", portStr)
+	}
+
+	connectionID, err := newConnectionID()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := d.openOutChannel(ctx, connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("rdg: OUT channel: %w", err)
+	}
+	in, err := d.openInChannel(ctx, connectionID)
+	if err != nil {
+		_ = out.Close()
+		return nil, fmt.Errorf("rdg: IN channel: %w", err)
+	}
+
+	c := newConn(in, out)
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.SetDeadline(deadline)
+	}
+	if err := c.openChannel(d.clientName(), host, uint16(port)); err != nil {
+		_ = c.closeChannels()
+		return nil, fmt.Errorf("rdg: %w", err)
+	}
+	_ = c.SetDeadline(noDeadline)
+
+	logging.Info("RD Gateway %s: tunnel %d, channel %d to %s", d.Gateway, c.tunnelID, c.channelID, address)
+	return c, nil
+}
+
+// gatewayAddress returns the gateway as host:port
+func (d *Dialer) gatewayAddress() string {
+	if _, _, err := net.SplitHostPort(d.Gateway); err == nil {
+		return d.Gateway
+	}
+	return net.JoinHostPort(strings.Trim(d.Gateway, "[]"), defaultGatewayPort)
+}
+
+func (d *Dialer) clientName() string {
+	if d.ClientName != "" {
+		return d.ClientName
+	}
+	return defaultClientName
+}
+
+// credentials splits the domain from the user name, as NLA does
+func (d *Dialer) credentials() (domain, user string) {
+	if idx := strings.Index(d.Username, "\\"); idx != -1 {
+		return d.Username[:idx], d.Username[idx+1:]
+	}
+	if idx := strings.Index(d.Username, "@"); idx != -1 {
+		return d.Username[idx+1:], d.Username[:idx]
+	}
+	return d.Domain, d.Username
+}
+
+// newConnectionID returns a random GUID in registry format, sent as
+// RDG-Connection-Id to tie the IN and OUT channels together
+func newConnectionID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0F | 0x40 // version 4
+	b[8] = b[8]&0x3F | 0x80 // variant
+	return fmt.Sprintf("{%X-%X-%X-%X-%X}", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,310 @@
+package rdg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rcarmo/go-rdp/internal/auth"
+)
+
+const (
+	testUser     = "alice"
+	testPassword = "s3cret"
+	testDomain   = "CORP"
+)
+
+// fakeGateway is a minimal RD Gateway speaking the HTTP transport. It
+// authenticates both channels with NTLM and echoes data packets back.
+type fakeGateway struct {
+	t        *testing.T
+	listener net.Listener
+	outConns chan net.Conn
+
+	// channelStatus is returned in the channel response
+	channelStatus uint32
+
+	// target receives the host:port the client asked the channel for
+	target chan string
+}
+
+func newFakeGateway(t *testing.T) *fakeGateway {
+	t.Helper()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{selfSignedCertificate(t)},
+		MinVersion:   tls.VersionTLS12,
+	})
+	require.NoError(t, err)
+
+	g := &fakeGateway{
+		t:        t,
+		listener: listener,
+		outConns: make(chan net.Conn, 1),
+		target:   make(chan string, 1),
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go g.serve()
+	return g
+}
+
+func (g *fakeGateway) dialer(password string) *Dialer {
+	return &Dialer{
+		Gateway:   g.listener.Addr().String(),
+		Username:  testDomain + `\` + testUser,
+		Password:  password,
+		TLSConfig: &tls.Config{InsecureSkipVerify: true}, // #nosec G402 -- self-signed test certificate
+	}
+}
+
+func (g *fakeGateway) serve() {
+	for {
+		conn, err := g.listener.Accept()
+		if err != nil {
+			return
+		}
+		go g.handle(conn)
+	}
+}
+
+// handle authenticates one channel connection
+func (g *fakeGateway) handle(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	server, err := auth.NewServerNTLMv2(testDomain, "GATEWAY")
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	negotiate, err := readAuthorizedRequest(reader)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	challenge, err := server.BuildChallengeMessage(negotiate.token)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	fmt.Fprintf(conn, "HTTP/1.1 401 Unauthorized\r\nWWW-Authenticate: NTLM %s\r\nContent-Length: 0\r\n\r\n",
+		base64.StdEncoding.EncodeToString(challenge))
+
+	authenticate, err := readAuthorizedRequest(reader)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	if _, _, err := server.VerifyAuthenticateMessage(authenticate.token, testUser, testPassword, testDomain); err != nil {
+		_, _ = io.WriteString(conn, "HTTP/1.1 401 Unauthorized\r\nContent-Length: 0\r\n\r\n")
+		_ = conn.Close()
+		return
+	}
+
+	switch authenticate.req.Method {
+	case methodOutData:
+		_, _ = io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\n\r\n")
+		g.outConns <- conn
+	case methodInData:
+		out := <-g.outConns
+		g.tunnel(authenticate.req.Body, out)
+		_ = out.Close()
+		_ = conn.Close()
+	default:
+		_ = conn.Close()
+	}
+}
+
+// tunnel answers the client packets read from the IN channel body
+func (g *fakeGateway) tunnel(in io.Reader, out io.Writer) {
+	for {
+		p, err := readPacket(in)
+		if err != nil {
+			return
+		}
+		var reply []byte
+		switch p.typ {
+		case pktTypeHandshakeRequest:
+			reply = encodePacket(pktTypeHandshakeResponse, make([]byte, 10))
+		case pktTypeTunnelCreate:
+			body := make([]byte, 14)
+			binary.LittleEndian.PutUint16(body[6:], httpTunnelResponseFieldTunnelID)
+			binary.LittleEndian.PutUint32(body[10:], 7)
+			reply = encodePacket(pktTypeTunnelResponse, body)
+		case pktTypeTunnelAuth:
+			reply = encodePacket(pktTypeTunnelAuthResponse, make([]byte, 8))
+		case pktTypeChannelCreate:
+			port := binary.LittleEndian.Uint16(p.body[2:])
+			g.target <- net.JoinHostPort(decodeUnicodeString(p.body[8:]), fmt.Sprint(port))
+			body := make([]byte, 12)
+			binary.LittleEndian.PutUint32(body, g.channelStatus)
+			binary.LittleEndian.PutUint16(body[4:], httpChannelResponseFieldChannelID)
+			binary.LittleEndian.PutUint32(body[8:], 9)
+			reply = encodePacket(pktTypeChannelResponse, body)
+		case pktTypeData:
+			data, err := parseData(p.body)
+			if err != nil {
+				return
+			}
+			// A keepalive first checks the client skips it
+			reply = append(encodePacket(pktTypeKeepalive, nil), dataPacket(data)...)
+		case pktTypeCloseChannel:
+			_, _ = out.Write(encodePacket(pktTypeCloseChannelResponse, make([]byte, 4)))
+			return
+		}
+		if _, err := out.Write(reply); err != nil {
+			return
+		}
+	}
+}
+
+type authorizedRequest struct {
+	req   *http.Request
+	token []byte
+}
+
+func readAuthorizedRequest(r *bufio.Reader) (*authorizedRequest, error) {
+	req, err := http.ReadRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := strings.CutPrefix(req.Header.Get("Authorization"), "NTLM ")
+	if !ok {
+		return nil, fmt.Errorf("missing NTLM authorization")
+	}
+	token, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return &authorizedRequest{req: req, token: token}, nil
+}
+
+func selfSignedCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gateway.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestDialContext_TunnelsData(t *testing.T) {
+	g := newFakeGateway(t)
+
+	conn, err := g.dialer(testPassword).DialContext(testContext(t), "tcp", "rdp.internal:3389")
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	assert.Equal(t, "rdp.internal:3389", <-g.target)
+
+	c := conn.(*Conn)
+	assert.Equal(t, uint32(7), c.tunnelID)
+	assert.Equal(t, uint32(9), c.channelID)
+
+	// Larger than one data packet, so the write is split
+	payload := bytes.Repeat([]byte("rdp"), maxDataLength)
+	n, err := conn.Write(payload)
+	require.NoError(t, err)
+	assert.Equal(t, len(payload), n)
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	echoed := make([]byte, len(payload))
+	_, err = io.ReadFull(conn, echoed)
+	require.NoError(t, err)
+	assert.Equal(t, payload, echoed)
+}
+
+func TestDialContext_BadPassword(t *testing.T) {
+	g := newFakeGateway(t)
+
+	_, err := g.dialer("wrong").DialContext(testContext(t), "tcp", "rdp.internal:3389")
+	assert.ErrorIs(t, err, ErrAuthenticationFailed)
+}
+
+func TestDialContext_ChannelRejected(t *testing.T) {
+	g := newFakeGateway(t)
+	g.channelStatus = 0x800759DA // E_PROXY_RAP_ACCESSDENIED
+
+	_, err := g.dialer(testPassword).DialContext(testContext(t), "tcp", "rdp.internal:3389")
+	assert.ErrorIs(t, err, ErrGatewayRejected)
+}
+
+func TestDialContext_InvalidAddress(t *testing.T) {
+	d := &Dialer{Gateway: "gateway.test"}
+
+	_, err := d.DialContext(context.Background(), "tcp", "rdp.internal")
+	assert.Error(t, err)
+	_, err = d.DialContext(context.Background(), "udp", "rdp.internal:3389")
+	assert.Error(t, err)
+}
+
+func TestReadPacket_RejectsBadLength(t *testing.T) {
+	header := make([]byte, packetHeaderLength)
+	binary.LittleEndian.PutUint16(header, pktTypeData)
+	binary.LittleEndian.PutUint32(header[4:], maxPacketLength+1)
+
+	_, err := readPacket(bytes.NewReader(header))
+	assert.ErrorIs(t, err, ErrMalformedPacket)
+
+	binary.LittleEndian.PutUint32(header[4:], 4)
+	_, err = readPacket(bytes.NewReader(header))
+	assert.ErrorIs(t, err, ErrMalformedPacket)
+}
+
+func TestParseData_RejectsOverlongLength(t *testing.T) {
+	_, err := parseData([]byte{0x10, 0x00, 0x01})
+	assert.ErrorIs(t, err, ErrMalformedPacket)
+}
+
+func TestDialer_Credentials(t *testing.T) {
+	tests := []struct {
+		username, domain string
+		wantDomain       string
+		wantUser         string
+	}{
+		{`CORP\alice`, "", "CORP", "alice"},
+		{"alice@corp.example", "", "corp.example", "alice"},
+		{"alice", "CORP", "CORP", "alice"},
+	}
+	for _, tt := range tests {
+		d := &Dialer{Username: tt.username, Domain: tt.domain}
+		domain, user := d.credentials()
+		assert.Equal(t, tt.wantDomain, domain, tt.username)
+		assert.Equal(t, tt.wantUser, user, tt.username)
+	}
+}
+
+func TestDialer_GatewayAddress(t *testing.T) {
+	assert.Equal(t, "gateway.test:443", (&Dialer{Gateway: "gateway.test"}).gatewayAddress())
+	assert.Equal(t, "gateway.test:8443", (&Dialer{Gateway: "gateway.test:8443"}).gatewayAddress())
+	assert.Equal(t, "[::1]:443", (&Dialer{Gateway: "[::1]"}).gatewayAddress())
+}
@@ -11,8 +11,12 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	"log"
 	"math/big"
 	"net"
+	"os"
+	"sort"
 	"sync"
 	"time"
 
@@ -67,6 +71,18 @@ const (
 	// DefaultReceiveWindowSize is the default receive buffer size in packets
 	DefaultReceiveWindowSize = 64
 
+	// DefaultMinReceiveWindowSize is the smallest receive window, in packets,
+	// a DefaultConfig connection advertises while received data waits to be read
+	DefaultMinReceiveWindowSize = 16
+
+	// DefaultMaxReceiveWindowSize is the largest receive window, in packets,
+	// a DefaultConfig connection grows to while the reader keeps up
+	DefaultMaxReceiveWindowSize = receiveQueueSize
+
+	// receiveQueueSize is how many in-order datagrams wait for Read before
+	// more are dropped, which caps the receive window
+	receiveQueueSize = 256
+
 	// MaxRetransmitCount is the max SYN/SYN+ACK retransmit attempts (3-5 per spec)
 	MaxRetransmitCount = 3
 
@@ -94,9 +110,30 @@ const (
 	// Per MS-RDPEUDP Section 3.1.6.3
 	DelayedACKTimeout = 200 * time.Millisecond
 
+	// MinDelayedACKTimeout is the shortest delayed ACK timeout a Config may
+	// set; below it ACKs would go out for nearly every packet
+	MinDelayedACKTimeout = 10 * time.Millisecond
+
+	// ImmediateACKDivisor sends a pending ACK without waiting for the delayed
+	// ACK timer once received datagrams waiting to be read or reordered fill
+	// 1/ImmediateACKDivisor of the receive window
+	ImmediateACKDivisor = 4
+
+	// InitialCongestionWindow is the congestion window, in packets, of a new connection
+	InitialCongestionWindow = 16
+
+	// InitialSlowStartThreshold is the congestion window, in packets, up to
+	// which it grows exponentially until the first congestion event
+	InitialSlowStartThreshold = DefaultReceiveWindowSize
+
 	// ConnectionTimeout is the max time to wait for connection establishment
 	ConnectionTimeout = 10 * time.Second
 
+	// CloseLinger is how long Close keeps resending the FIN of an established
+	// connection, until the peer answers with its own, before closing the
+	// socket. The FIN goes out MaxRetransmitCount times at most.
+	CloseLinger = 300 * time.Millisecond
+
 	// LostPacketThreshold is number of later packets received before marking lost
 	// Per MS-RDPEUDP Section 3.1.1.4.1: "three other datagrams"
 	LostPacketThreshold = 3
@@ -131,9 +168,22 @@ type Config struct {
 	// MTU is the maximum transmission unit (1132-1232)
 	MTU uint16
 
-	// ReceiveWindowSize is the receive buffer size in packets
+	// ReceiveWindowSize is the receive buffer size in packets, advertised in
+	// the SYN and as the initial receive window
 	ReceiveWindowSize uint16
 
+	// MinReceiveWindowSize and MaxReceiveWindowSize bound the receive window
+	// advertised in ACKs, which shrinks while received datagrams wait to be
+	// read and grows while the reader keeps up. A zero bound is
+	// ReceiveWindowSize, so leaving both zero keeps the window fixed.
+	MinReceiveWindowSize uint16
+	MaxReceiveWindowSize uint16
+
+	// DelayedACKTimeout is how long an ACK may be held back to cover later
+	// packets. Zero is the spec's 200ms; shorter values, down to
+	// MinDelayedACKTimeout, cut latency on fast links.
+	DelayedACKTimeout time.Duration
+
 	// Reliable enables reliable transport mode (RDP-UDP-R)
 	// If false, uses lossy transport mode (RDP-UDP-L)
 	Reliable bool
@@ -149,14 +199,18 @@ type Config struct {
 // DefaultConfig returns a Config with default values
 func DefaultConfig() *Config {
 	return &Config{
-		MTU:               DefaultMTU,
-		ReceiveWindowSize: DefaultReceiveWindowSize,
-		Reliable:          true,
-		ProtocolVersion:   rdpeudp.ProtocolVersion2,
+		MTU:                  DefaultMTU,
+		ReceiveWindowSize:    DefaultReceiveWindowSize,
+		MinReceiveWindowSize: DefaultMinReceiveWindowSize,
+		MaxReceiveWindowSize: DefaultMaxReceiveWindowSize,
+		DelayedACKTimeout:    DelayedACKTimeout,
+		Reliable:             true,
+		ProtocolVersion:      rdpeudp.ProtocolVersion2,
 	}
 }
 
-// Connection represents an RDPEUDP connection
+// Connection represents an RDPEUDP connection. It implements net.Conn,
+// so an established connection can stand in for a TCP transport.
 type Connection struct {
 	mu sync.RWMutex
 
@@ -180,6 +234,15 @@ type Connection struct {
 	highestRecvSeq uint32 // Highest sequence number received (for ACK vector)
 	pendingAck     bool   // Whether we have a pending ACK to send
 
+	// Sequence ranges selectively acknowledged via ACK vectors
+	ackedRanges ackRanges
+
+	// Receive window advertised in the last ACK, in packets
+	receiveWindow uint16
+
+	// Receive window the peer last advertised, in packets (0 = not yet known)
+	peerReceiveWindow uint16
+
 	// MTU negotiation results
 	upstreamMTU   uint16
 	downstreamMTU uint16
@@ -195,20 +258,41 @@ type Connection struct {
 
 	// Congestion control
 	congestionWindow int      // Current congestion window size
+	ssthresh         int      // Slow start threshold
+	windowAcked      int      // Packets acknowledged toward the next additive increase
 	congestionNotify bool     // Need to send CN flag
 
 	// Receive buffer for out-of-order packets
 	recvBuffer map[uint32][]byte
 
-	// Send buffer for retransmission
+	// Send buffer for retransmission, holding at most sendWindow packets
 	sendBuffer map[uint32]*sentPacket
 
+	// sendSpace is closed and replaced when acknowledgements free send
+	// buffer slots, waking blocked Writes
+	sendSpace chan struct{}
+
+	// readMu serializes Reads; readBuf holds the unread rest of the last
+	// datagram Read returned
+	readMu  sync.Mutex
+	readBuf []byte
+
+	// Deadlines set through SetDeadline, SetReadDeadline and SetWriteDeadline
+	readDeadline  connDeadline
+	writeDeadline connDeadline
+
 	// Channels
 	recvChan    chan []byte
 	closeChan   chan struct{}
 	closedOnce  sync.Once
 	established chan struct{}
 
+	// peerFin is closed when the peer's FIN arrives while Close lingers
+	peerFin chan struct{}
+
+	// socketOnce closes the UDP socket once Close is done with it
+	socketOnce sync.Once
+
 	// Timers
 	keepaliveTimer    *time.Timer
 	retransmitTimer   *time.Timer
@@ -237,6 +321,9 @@ type ConnectionStats struct {
 	PacketsLost       uint64
 	RTT               time.Duration // Current RTT estimate
 	CongestionEvents  uint64
+	SlowStartThreshold int    // Current slow start threshold, in packets
+	ReceiveWindow      uint16 // Receive window last advertised, in packets
+	InvalidAcks        uint64 // ACKs ignored for acknowledging data never sent
 }
 
 // NewConnection creates a new RDPEUDP connection
@@ -252,18 +339,27 @@ func NewConnection(config *Config) (*Connection, error) {
 	if config.MTU == 0 {
 		config.MTU = DefaultMTU
 	}
+	receiveWindow := config.ReceiveWindowSize
+	if receiveWindow == 0 {
+		receiveWindow = DefaultReceiveWindowSize
+	}
 
 	c := &Connection{
 		config:           config,
 		state:            StateClosed,
 		recvBuffer:       make(map[uint32][]byte),
 		sendBuffer:       make(map[uint32]*sentPacket),
-		recvChan:         make(chan []byte, 256),
+		sendSpace:        make(chan struct{}),
+		recvChan:         make(chan []byte, receiveQueueSize),
 		closeChan:        make(chan struct{}),
 		established:      make(chan struct{}),
 		rtt:              RetransmitTimeoutV2, // Initial estimate
-		congestionWindow: 16, // Initial cwnd
+		congestionWindow: InitialCongestionWindow,
+		ssthresh:         InitialSlowStartThreshold,
+		receiveWindow:    receiveWindow,
 	}
+	c.stats.SlowStartThreshold = c.ssthresh
+	c.stats.ReceiveWindow = c.receiveWindow
 
 	// Generate random initial sequence number per spec Section 3.1.5.1.1
 	c.localSeqNum = generateInitialSequenceNumber()
@@ -324,6 +420,13 @@ func (c *Connection) Connect(ctx context.Context) error {
 	c.state = StateSynSent
 	c.mu.Unlock()
 
+	// Track the connection for diagnostics until it closes by any path
+	registerConnection(c)
+	go func() {
+		<-c.closeChan
+		unregisterConnection(c)
+	}()
+
 	// Start receive goroutine
 	go c.receiveLoop()
 
@@ -397,19 +500,21 @@ func (c *Connection) sendSyn(ctx context.Context) error {
 // Per MS-RDPEUDP Section 3.1.6.1
 func (c *Connection) getRetransmitTimeout() time.Duration {
 	c.mu.RLock()
-	version := c.config.ProtocolVersion
-	rtt := c.rtt
-	c.mu.RUnlock()
+	defer c.mu.RUnlock()
+	return c.retransmitTimeoutLocked()
+}
 
+// retransmitTimeoutLocked is getRetransmitTimeout for callers holding c.mu
+func (c *Connection) retransmitTimeoutLocked() time.Duration {
 	var minTimeout time.Duration
-	if version >= rdpeudp.ProtocolVersion2 {
+	if c.config.ProtocolVersion >= rdpeudp.ProtocolVersion2 {
 		minTimeout = RetransmitTimeoutV2
 	} else {
 		minTimeout = RetransmitTimeoutV1
 	}
 
 	// Per spec: "minimum retransmit time-out or twice the RTT, whichever is longer"
-	rttTimeout := 2 * rtt
+	rttTimeout := 2 * c.rtt
 	if rttTimeout > minTimeout {
 		return rttTimeout
 	}
@@ -470,6 +575,11 @@ func (c *Connection) handleReceivedPacket(data []byte) {
 		c.handleSynSentState(packet)
 	case StateEstablished:
 		c.handleEstablishedState(packet)
+	case StateClosed:
+		if c.peerFin != nil && packet.Header.HasFlag(rdpeudp.FlagFIN) {
+			close(c.peerFin)
+			c.peerFin = nil
+		}
 	}
 }
 
@@ -493,6 +603,10 @@ func (c *Connection) handleSynSentState(packet *rdpeudp.Packet) {
 		c.stats.RTT = c.rtt
 	}
 
+	if window := packet.Header.SourceAckReceiveWindowSize; window > 0 {
+		c.peerReceiveWindow = window
+	}
+
 	// Store remote sequence number
 	if packet.SynData != nil {
 		c.remoteSeqNum = packet.SynData.SnInitialSequenceNumber
@@ -514,6 +628,9 @@ func (c *Connection) handleSynSentState(packet *rdpeudp.Packet) {
 	// Send ACK to complete handshake
 	c.state = StateEstablished
 	c.nextSendSeq = c.localSeqNum + 1
+	// The SYN+ACK acknowledged our SYN, so ACKs are ordered from the ISN
+	// rather than from zero, which would read as stale for half of all ISNs
+	c.lastAckedSeq = c.localSeqNum
 
 	// Signal established
 	close(c.established)
@@ -549,10 +666,13 @@ func (c *Connection) handleEstablishedState(packet *rdpeudp.Packet) {
 		c.processData(packet)
 	}
 
-	// Process FIN
+	// Process FIN, answering with our own so a peer lingering in Close can
+	// close its socket
 	if packet.Header.HasFlag(rdpeudp.FlagFIN) {
+		c.stopTimers()
 		c.state = StateClosed
 		c.closedOnce.Do(func() { close(c.closeChan) })
+		go c.sendPacket(rdpeudp.NewFINPacket(c.highestRecvSeq)) // #nosec G104 -- best-effort
 	}
 }
 
@@ -564,26 +684,120 @@ func (c *Connection) handleCongestionNotification() {
 	if c.congestionWindow < 1 {
 		c.congestionWindow = 1
 	}
+
+	// Grow additively from here on rather than slow starting back into loss
+	c.ssthresh = c.congestionWindow
+	c.stats.SlowStartThreshold = c.ssthresh
+	c.windowAcked = 0
 	c.stats.CongestionEvents++
 }
 
+// growCongestionWindow opens the congestion window for newly acknowledged
+// packets. Below ssthresh (slow start) each acknowledgement adds a packet,
+// doubling the window every round trip; from there on (congestion
+// avoidance) a window's worth of acknowledgements, about one round trip,
+// adds a single packet.
+func (c *Connection) growCongestionWindow(acked int) {
+	for ; acked > 0; acked-- {
+		if c.congestionWindow < c.ssthresh {
+			c.congestionWindow++
+			continue
+		}
+		c.windowAcked++
+		if c.windowAcked >= c.congestionWindow {
+			c.windowAcked = 0
+			c.congestionWindow++
+		}
+	}
+}
+
+// updateRTT folds an RTT sample into the smoothed estimate, weighting it by
+// 1/8 as TCP does (RFC 6298)
+func (c *Connection) updateRTT(sample time.Duration) {
+	c.rtt += (sample - c.rtt) / 8
+	c.stats.RTT = c.rtt
+}
+
 // processAck processes acknowledgment in received packet
 func (c *Connection) processAck(packet *rdpeudp.Packet) {
 	ackSeq := packet.Header.SnSourceAck
-	if ackSeq > c.lastAckedSeq {
-		c.lastAckedSeq = ackSeq
-
-		// Remove acknowledged packets from send buffer
-		for seq := range c.sendBuffer {
-			if seq <= ackSeq {
-				delete(c.sendBuffer, seq)
-			}
-		}
+	if seqBefore(ackSeq, c.lastAckedSeq) {
+		return // Stale ACK, reordered behind a newer one
+	}
+	// The ACK vector runs back from snSourceAck, so a snSourceAck past the
+	// last packet sent makes the whole vector describe packets that do not
+	// exist. That is a protocol violation; acting on it would free send
+	// buffer slots and retransmit for data the peer cannot have seen.
+	if !c.sentSeq(ackSeq) {
+		c.stats.InvalidAcks++
+		log.Printf("udp: ignoring ACK for sequence %d, never sent (next %d)", ackSeq, c.nextSendSeq)
+		return
+	}
+	c.lastAckedSeq = ackSeq
+	outstanding := len(c.sendBuffer)
+	if window := packet.Header.SourceAckReceiveWindowSize; window > 0 {
+		c.peerReceiveWindow = window
 	}
 
-	// Process ACK vector for selective ACK
 	if packet.AckVector != nil {
+		// Process ACK vector for selective ACK
 		c.processAckVector(packet.AckVector)
+	} else {
+		// Without an ACK vector, snSourceAck is cumulative
+		c.ackThrough(ackSeq)
+	}
+
+	c.growCongestionWindow(outstanding - len(c.sendBuffer))
+	if len(c.sendBuffer) < c.sendWindow() {
+		c.wakeWriters()
+	}
+}
+
+// sendWindow returns how many packets may await acknowledgement: the
+// congestion window, further limited by the receive window the peer
+// advertised. Callers must hold c.mu.
+func (c *Connection) sendWindow() int {
+	window := c.congestionWindow
+	if c.peerReceiveWindow > 0 {
+		window = min(window, int(c.peerReceiveWindow))
+	}
+	return max(window, 1)
+}
+
+// wakeWriters wakes Writes blocked on a full send buffer so they check the
+// window again. Callers must hold c.mu.
+func (c *Connection) wakeWriters() {
+	close(c.sendSpace)
+	c.sendSpace = make(chan struct{})
+}
+
+// sentSeq reports whether seq is the SYN or a data packet already sent,
+// allowing for wrap-around
+func (c *Connection) sentSeq(seq uint32) bool {
+	return seq-c.localSeqNum < c.nextSendSeq-c.localSeqNum || seq == c.localSeqNum
+}
+
+// ackThrough removes packets up to and including seq from the send buffer
+func (c *Connection) ackThrough(seq uint32) {
+	for s := range c.sendBuffer {
+		if !seqBefore(seq, s) {
+			c.ackPacket(s)
+		}
+	}
+	c.ackedRanges = c.ackedRanges.pruneBefore(seq + 1)
+}
+
+// ackPacket removes an acknowledged packet from the send buffer, sampling
+// the RTT from it unless it was retransmitted, since the acknowledgement
+// could then be for either transmission (Karn's algorithm)
+func (c *Connection) ackPacket(seq uint32) {
+	pkt, ok := c.sendBuffer[seq]
+	if !ok {
+		return
+	}
+	delete(c.sendBuffer, seq)
+	if pkt.retryCount == 0 && !pkt.sentTime.IsZero() {
+		c.updateRTT(time.Since(pkt.sentTime))
 	}
 }
 
@@ -595,36 +809,60 @@ func (c *Connection) processAckVector(ackVector *rdpeudp.AckVector) {
 	}
 
 	// ACK vector is RLE-encoded starting from snSourceAck and going backwards
-	// Each element: 2 bits state, 6 bits length
-	currentSeq := c.lastAckedSeq
-	lostPackets := make([]uint32, 0)
-
+	// Each element: 2 bits state, 6 bits length; received runs become ranges
+	seq := c.lastAckedSeq
 	for _, element := range ackVector.AckVectorElements {
-		state := (element >> 6) & 0x03  // Top 2 bits
-		length := int(element & 0x3F)   // Bottom 6 bits (0-63)
-
-		// Process 'length + 1' packets with this state
-		for i := 0; i <= length; i++ {
-			switch state {
-			case AckStateReceived:
-				// Packet received, remove from send buffer
-				delete(c.sendBuffer, currentSeq)
-			case AckStateNotReceived:
-				// Packet not received, schedule retransmission
-				if pkt, ok := c.sendBuffer[currentSeq]; ok {
-					lostPackets = append(lostPackets, pkt.seqNum)
+		state := (element >> 6) & 0x03    // Top 2 bits
+		count := uint32(element&0x3F) + 1 // Bottom 6 bits (0-63) encode length-1
+		start := seq - count + 1
+
+		if state == AckStateReceived {
+			c.ackedRanges = c.ackedRanges.add(start, seq)
+			for s := start; ; s++ {
+				c.ackPacket(s)
+				if s == seq {
+					break
 				}
 			}
-			currentSeq-- // ACK vector goes backwards
 		}
+		seq = start - 1
 	}
 
-	// Retransmit lost packets
-	for _, seqNum := range lostPackets {
+	// The receiver describes everything from its next expected sequence
+	// number up to snSourceAck, so anything older has been delivered
+	c.ackThrough(seq)
+
+	// Retransmit only the gaps between acknowledged ranges
+	for _, seqNum := range c.pendingRetransmits() {
 		c.retransmitPacket(seqNum)
 	}
 }
 
+// pendingRetransmits returns unacknowledged packets that fall in a gap below
+// the newest acknowledged range, oldest first. Packets already retransmitted
+// and still within their retransmit timeout are not repeated.
+// Callers must hold c.mu.
+func (c *Connection) pendingRetransmits() []uint32 {
+	highest, ok := c.ackedRanges.highest()
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	var lost []uint32
+	for seq, pkt := range c.sendBuffer {
+		if !seqBefore(seq, highest) || c.ackedRanges.contains(seq) {
+			continue
+		}
+		if pkt.retryCount > 0 && now.Before(pkt.nextRetry) {
+			continue
+		}
+		lost = append(lost, seq)
+	}
+	sort.Slice(lost, func(i, j int) bool { return seqBefore(lost[i], lost[j]) })
+	return lost
+}
+
 // retransmitPacket retransmits a packet by sequence number
 func (c *Connection) retransmitPacket(seqNum uint32) {
 	pkt, ok := c.sendBuffer[seqNum]
@@ -642,7 +880,7 @@ func (c *Connection) retransmitPacket(seqNum uint32) {
 
 	pkt.retryCount++
 	pkt.sentTime = time.Now()
-	pkt.nextRetry = time.Now().Add(c.getRetransmitTimeout())
+	pkt.nextRetry = time.Now().Add(c.retransmitTimeoutLocked())
 	c.stats.Retransmits++
 
 	// Re-send the packet data
@@ -722,7 +960,7 @@ func (c *Connection) sendAck() error {
 func (c *Connection) buildAckPacket() *rdpeudp.Packet {
 	packet := rdpeudp.NewACKPacket(
 		c.highestRecvSeq, // ACK the highest received sequence
-		c.config.ReceiveWindowSize,
+		c.adjustReceiveWindow(),
 	)
 
 	// Add congestion notification if we detected loss
@@ -737,6 +975,49 @@ func (c *Connection) buildAckPacket() *rdpeudp.Packet {
 	return packet
 }
 
+// adjustReceiveWindow returns the receive window to advertise, adapted to
+// the received datagrams still waiting to be read or reordered. The window
+// halves while they fill half of it, since the reader is falling behind,
+// and doubles once the reader has drained them all, within the configured
+// minimum and maximum.
+func (c *Connection) adjustReceiveWindow() uint16 {
+	lo, hi := c.receiveWindowBounds()
+	window := int(c.receiveWindow)
+	queued := len(c.recvChan) + len(c.recvBuffer)
+
+	switch {
+	case queued*2 >= window:
+		window /= 2
+	case queued == 0:
+		window *= 2
+	}
+	window = max(lo, min(window, hi))
+
+	c.receiveWindow = uint16(window) // #nosec G115 -- at most receiveQueueSize
+	c.stats.ReceiveWindow = c.receiveWindow
+	return c.receiveWindow
+}
+
+// receiveWindowBounds returns the smallest and largest receive window to
+// advertise. Neither exceeds the receive queue, where datagrams past it are
+// dropped.
+func (c *Connection) receiveWindowBounds() (lo, hi int) {
+	size := int(c.config.ReceiveWindowSize)
+	if size == 0 {
+		size = DefaultReceiveWindowSize
+	}
+	lo, hi = int(c.config.MinReceiveWindowSize), int(c.config.MaxReceiveWindowSize)
+	if lo == 0 {
+		lo = size
+	}
+	if hi == 0 {
+		hi = size
+	}
+	hi = min(hi, receiveQueueSize)
+	lo = max(1, min(lo, hi))
+	return lo, hi
+}
+
 // buildAckVector builds an RLE-encoded ACK vector
 // Per MS-RDPEUDP Section 3.1.1.4.1
 func (c *Connection) buildAckVector() *rdpeudp.AckVector {
@@ -842,7 +1123,10 @@ func (c *Connection) receiveLoop() {
 	for {
 		select {
 		case <-c.closeChan:
-			return
+			// Keep reading while Close lingers for the peer's FIN
+			if !c.lingering() {
+				return
+			}
 		default:
 		}
 
@@ -871,82 +1155,182 @@ func (c *Connection) receiveLoop() {
 	}
 }
 
-// Read reads data from the connection
+var (
+	_ net.Conn      = (*Connection)(nil)
+	_ io.WriterTo   = (*Connection)(nil)
+	_ io.ReaderFrom = (*Connection)(nil)
+)
+
+// Read reads data from the connection. A datagram larger than b is returned
+// over several Reads. Once the read deadline passes, Read returns an error
+// wrapping os.ErrDeadlineExceeded, including a Read already blocked when
+// the deadline is set.
 func (c *Connection) Read(b []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	timeout := c.readDeadline.wait()
+	if isClosedChan(timeout) {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	if len(c.readBuf) > 0 {
+		n := copy(b, c.readBuf)
+		c.readBuf = c.readBuf[n:]
+		return n, nil
+	}
+
 	select {
 	case data := <-c.recvChan:
 		n := copy(b, data)
+		c.readBuf = data[n:]
 		return n, nil
 	case <-c.closeChan:
 		return 0, ErrClosed
+	case <-timeout:
+		return 0, os.ErrDeadlineExceeded
 	}
 }
 
-// Write sends data over the connection
+// Write sends b in datagrams of at most MaxPayload bytes, blocking while the
+// send window is full of unacknowledged packets. Once the write deadline
+// passes, Write returns an error wrapping os.ErrDeadlineExceeded, including
+// a Write already blocked.
 func (c *Connection) Write(b []byte) (int, error) {
+	maxPayload := c.MaxPayload()
+	written := 0
+	for {
+		chunk := b[written:min(len(b), written+maxPayload)]
+		if err := c.writeDatagram(chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		if written == len(b) {
+			return written, nil
+		}
+	}
+}
+
+// writeDatagram sends b as one data packet, keeping it for retransmission.
+// While the send buffer holds a full send window of unacknowledged packets
+// it blocks until acknowledgements free a slot, the connection closes or the
+// write deadline passes.
+func (c *Connection) writeDatagram(b []byte) error {
 	c.mu.Lock()
-	if c.state != StateEstablished {
+	for {
+		if c.state != StateEstablished {
+			c.mu.Unlock()
+			return ErrInvalidState
+		}
+		if c.writeDeadline.exceeded() {
+			c.mu.Unlock()
+			return os.ErrDeadlineExceeded
+		}
+		if len(c.sendBuffer) < c.sendWindow() {
+			break
+		}
+
+		space := c.sendSpace
 		c.mu.Unlock()
-		return 0, ErrInvalidState
+		select {
+		case <-space:
+		case <-c.closeChan:
+			return ErrClosed
+		case <-c.writeDeadline.wait():
+			return os.ErrDeadlineExceeded
+		}
+		c.mu.Lock()
 	}
 
 	seqNum := c.nextSendSeq
 	c.nextSendSeq++
-	c.mu.Unlock()
-
 	packet := rdpeudp.NewDataPacket(seqNum, seqNum, b)
 
 	// Serialize the packet for potential retransmission
 	data, err := packet.Serialize()
 	if err != nil {
-		return 0, err
+		c.mu.Unlock()
+		return err
 	}
 
-	// Add to send buffer for potential retransmission
+	// Add to send buffer for potential retransmission; the slot is taken
+	// before the lock is released so concurrent Writes cannot overfill it
 	now := time.Now()
-	c.mu.Lock()
 	c.sendBuffer[seqNum] = &sentPacket{
 		data:      data,
 		seqNum:    seqNum,
 		sentTime:  now,
-		nextRetry: now.Add(c.getRetransmitTimeout()),
+		nextRetry: now.Add(c.retransmitTimeoutLocked()),
 	}
 	// Start retransmit timer if not running
 	c.startRetransmitTimer()
 	c.mu.Unlock()
 
-	if err := c.sendPacket(packet); err != nil {
-		return 0, err
-	}
-
-	return len(b), nil
+	return c.sendPacket(packet)
 }
 
-// Close closes the connection
+// Close closes the connection. An established connection first tells the
+// peer with a FIN, lingering up to CloseLinger for the peer's FIN in reply.
+// Reads and Writes fail with ErrClosed as soon as Close starts. The socket
+// is closed even when the connection had already ended, such as on the
+// peer's FIN.
 func (c *Connection) Close() error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if c.state == StateClosed {
-		return nil
-	}
-
-	// Stop all timers
 	c.stopTimers()
 
-	// Send FIN if established
-	if c.state == StateEstablished {
-		finPacket := rdpeudp.NewFINPacket(c.nextSendSeq)
-		go c.sendPacket(finPacket)
+	var fin *rdpeudp.Packet
+	var peerFin chan struct{}
+	if c.state == StateEstablished && c.conn != nil {
+		fin = rdpeudp.NewFINPacket(c.highestRecvSeq)
+		peerFin = make(chan struct{})
+		c.peerFin = peerFin
 	}
 
 	c.state = StateClosed
 	c.closedOnce.Do(func() { close(c.closeChan) })
+	conn := c.conn
+	c.mu.Unlock()
 
-	if c.conn != nil {
-		return c.conn.Close()
+	if fin != nil {
+		c.linger(fin, peerFin)
 	}
-	return nil
+
+	var err error
+	if conn != nil {
+		c.socketOnce.Do(func() { err = conn.Close() })
+	}
+	return err
+}
+
+// linger sends fin until the peer answers with its FIN, spreading at most
+// MaxRetransmitCount copies over CloseLinger in case some are lost
+func (c *Connection) linger(fin *rdpeudp.Packet, peerFin <-chan struct{}) {
+	defer func() {
+		c.mu.Lock()
+		c.peerFin = nil
+		c.mu.Unlock()
+	}()
+
+	interval := CloseLinger / MaxRetransmitCount
+	for i := 0; i < MaxRetransmitCount; i++ {
+		if err := c.sendPacket(fin); err != nil {
+			return
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-peerFin:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// lingering reports whether Close is waiting for the peer's FIN
+func (c *Connection) lingering() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.peerFin != nil
 }
 
 // LocalAddr returns the local network address
@@ -965,6 +1349,82 @@ func (c *Connection) RemoteAddr() net.Addr {
 	return nil
 }
 
+// SetDeadline sets the read and write deadlines. A zero time clears them.
+func (c *Connection) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// SetReadDeadline sets the deadline for Read, including a Read that is
+// already blocked. A zero time clears it.
+func (c *Connection) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for Write, including a Write that is
+// already in progress. A zero time clears it.
+func (c *Connection) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// MaxPayload returns the largest Write that fits in one datagram of the
+// negotiated upstream MTU.
+func (c *Connection) MaxPayload() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	mtu := c.upstreamMTU
+	if mtu == 0 {
+		mtu = c.config.MTU
+	}
+	return int(mtu) - rdpeudp.FECHeaderSize - rdpeudp.SourcePayloadHeaderSize
+}
+
+// WriteTo implements io.WriterTo, writing the data received to w until the
+// connection closes.
+func (c *Connection) WriteTo(w io.Writer) (int64, error) {
+	buf := make([]byte, 64*1024)
+	var total int64
+	for {
+		n, err := c.Read(buf)
+		if errors.Is(err, ErrClosed) {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+		written, err := w.Write(buf[:n])
+		total += int64(written)
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// ReadFrom implements io.ReaderFrom, sending the data read from r until EOF
+// one datagram at a time.
+func (c *Connection) ReadFrom(r io.Reader) (int64, error) {
+	buf := make([]byte, c.MaxPayload())
+	var total int64
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, werr := c.Write(buf[:n]); werr != nil {
+				return total, werr
+			}
+			total += int64(n)
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
 // Helper functions
 
 func minUint16(a, b uint16) uint16 {
@@ -1030,15 +1490,41 @@ func (c *Connection) onKeepaliveTimer() {
 
 // startDelayedAckTimer starts the delayed ACK timer
 // Per MS-RDPEUDP Section 3.1.6.3
+// While received data backs up the ACK goes out at once instead, so the
+// peer learns of the shrinking window and the delivered packets sooner.
 func (c *Connection) startDelayedAckTimer() {
+	if c.receiveBacklogged() {
+		if c.delayedAckTimer != nil && !c.delayedAckTimer.Stop() {
+			return // Already firing
+		}
+		c.delayedAckTimer = time.AfterFunc(0, c.onDelayedAckTimer)
+		return
+	}
 	if c.delayedAckTimer != nil {
 		return // Already running
 	}
-	c.delayedAckTimer = time.AfterFunc(DelayedACKTimeout, func() {
+	c.delayedAckTimer = time.AfterFunc(c.delayedAckTimeout(), func() {
 		c.onDelayedAckTimer()
 	})
 }
 
+// delayedAckTimeout returns the configured delayed ACK timeout, no shorter
+// than MinDelayedACKTimeout
+func (c *Connection) delayedAckTimeout() time.Duration {
+	timeout := c.config.DelayedACKTimeout
+	if timeout == 0 {
+		return DelayedACKTimeout
+	}
+	return max(timeout, MinDelayedACKTimeout)
+}
+
+// receiveBacklogged reports whether received datagrams waiting to be read
+// or reordered fill 1/ImmediateACKDivisor of the receive window
+func (c *Connection) receiveBacklogged() bool {
+	queued := len(c.recvChan) + len(c.recvBuffer)
+	return queued*ImmediateACKDivisor >= max(int(c.receiveWindow), 1)
+}
+
 // onDelayedAckTimer handles delayed ACK timer expiration
 func (c *Connection) onDelayedAckTimer() {
 	c.mu.Lock()
@@ -1057,7 +1543,7 @@ func (c *Connection) startRetransmitTimer() {
 	if c.retransmitTimer != nil {
 		return
 	}
-	timeout := c.getRetransmitTimeout()
+	timeout := c.retransmitTimeoutLocked()
 	c.retransmitTimer = time.AfterFunc(timeout, func() {
 		c.onRetransmitTimer()
 	})
@@ -1075,7 +1561,6 @@ func (c *Connection) onRetransmitTimer() {
 	}
 
 	now := time.Now()
-	hasOutstanding := false
 
 	// Check all packets in send buffer for retransmission
 	for seqNum, pkt := range c.sendBuffer {
@@ -1090,7 +1575,7 @@ func (c *Connection) onRetransmitTimer() {
 			// Retransmit
 			pkt.retryCount++
 			pkt.sentTime = now
-			pkt.nextRetry = now.Add(c.getRetransmitTimeout())
+			pkt.nextRetry = now.Add(c.retransmitTimeoutLocked())
 			c.stats.Retransmits++
 
 			if c.conn != nil && len(pkt.data) > 0 {
@@ -1098,14 +1583,12 @@ func (c *Connection) onRetransmitTimer() {
 			}
 		}
 
-		if pkt.seqNum > c.lastAckedSeq {
-			hasOutstanding = true
-		}
 		_ = seqNum // Silence unused warning
 	}
 
-	// Restart timer if we still have outstanding packets
-	if hasOutstanding {
+	// Restart timer if we still have outstanding packets; anything left in
+	// the send buffer is unacknowledged, including gaps below lastAckedSeq
+	if len(c.sendBuffer) > 0 {
 		c.startRetransmitTimer()
 	}
 }
@@ -1,7 +1,13 @@
 package udp
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
 	"testing"
 	"time"
 
@@ -193,6 +199,10 @@ func TestDefaultConfig(t *testing.T) {
 	if cfg.ReceiveWindowSize != DefaultReceiveWindowSize {
 		t.Errorf("ReceiveWindowSize = %d, want %d", cfg.ReceiveWindowSize, DefaultReceiveWindowSize)
 	}
+	if cfg.MinReceiveWindowSize != DefaultMinReceiveWindowSize || cfg.MaxReceiveWindowSize != DefaultMaxReceiveWindowSize {
+		t.Errorf("receive window bounds = %d-%d, want %d-%d", cfg.MinReceiveWindowSize, cfg.MaxReceiveWindowSize,
+			DefaultMinReceiveWindowSize, DefaultMaxReceiveWindowSize)
+	}
 	if !cfg.Reliable {
 		t.Error("Reliable should be true by default")
 	}
@@ -582,6 +592,120 @@ func TestHandleCongestionNotification_MinWindow(t *testing.T) {
 	}
 }
 
+func TestHandleCongestionNotification_SetsSlowStartThreshold(t *testing.T) {
+	conn, _ := NewConnection(nil)
+	if got := conn.Stats().SlowStartThreshold; got != InitialSlowStartThreshold {
+		t.Errorf("Initial SlowStartThreshold = %d, want %d", got, InitialSlowStartThreshold)
+	}
+
+	conn.congestionWindow = 40
+	conn.handleCongestionNotification()
+
+	if conn.ssthresh != 20 {
+		t.Errorf("ssthresh = %d, want 20 (half of 40)", conn.ssthresh)
+	}
+	if got := conn.Stats().SlowStartThreshold; got != 20 {
+		t.Errorf("Stats().SlowStartThreshold = %d, want 20", got)
+	}
+}
+
+// markSent records first through last as the data packets sent so far, as
+// if after a SYN with sequence number first-1
+func markSent(conn *Connection, first, last uint32) {
+	conn.localSeqNum = first - 1
+	conn.nextSendSeq = last + 1
+}
+
+// ackNext buffers n packets after the connection's last acknowledged
+// sequence number and acknowledges them cumulatively
+func ackNext(conn *Connection, n int) {
+	start := conn.lastAckedSeq + 1
+	for i := 0; i < n; i++ {
+		seq := start + uint32(i) // #nosec G115
+		conn.sendBuffer[seq] = &sentPacket{seqNum: seq}
+	}
+	markSent(conn, start, start+uint32(n)-1) // #nosec G115
+	conn.processAck(&rdpeudp.Packet{Header: rdpeudp.FECHeader{SnSourceAck: start + uint32(n) - 1}}) // #nosec G115
+}
+
+func TestCongestionWindow_SlowStart(t *testing.T) {
+	conn, _ := NewConnection(nil)
+	conn.lastAckedSeq = 100
+
+	// Each acknowledged packet adds one, doubling the window per round trip
+	ackNext(conn, InitialCongestionWindow)
+	if conn.congestionWindow != 2*InitialCongestionWindow {
+		t.Errorf("Congestion window = %d, want %d", conn.congestionWindow, 2*InitialCongestionWindow)
+	}
+
+	// Growth turns additive once the window reaches ssthresh
+	ackNext(conn, 2*InitialCongestionWindow)
+	if conn.congestionWindow != InitialSlowStartThreshold {
+		t.Errorf("Congestion window = %d, want ssthresh %d", conn.congestionWindow, InitialSlowStartThreshold)
+	}
+}
+
+func TestCongestionWindow_AdditiveIncreaseAfterLoss(t *testing.T) {
+	conn, _ := NewConnection(nil)
+	conn.lastAckedSeq = 100
+	conn.congestionWindow = 20
+	conn.handleCongestionNotification()
+
+	// A full window of acknowledgements, one round trip, adds one packet
+	ackNext(conn, 9)
+	if conn.congestionWindow != 10 {
+		t.Errorf("Congestion window = %d, want 10 before a full window is acked", conn.congestionWindow)
+	}
+	ackNext(conn, 1)
+	if conn.congestionWindow != 11 {
+		t.Errorf("Congestion window = %d, want 11 after one round trip", conn.congestionWindow)
+	}
+
+	// Throughput recovers past the window in use before the loss
+	for i := 0; i < 12; i++ {
+		ackNext(conn, conn.congestionWindow)
+	}
+	if conn.congestionWindow <= 20 {
+		t.Errorf("Congestion window = %d, want it to recover past 20", conn.congestionWindow)
+	}
+}
+
+func TestCongestionWindow_GrowsFromMinWindow(t *testing.T) {
+	conn, _ := NewConnection(nil)
+	conn.lastAckedSeq = 100
+	conn.congestionWindow = 1
+	conn.handleCongestionNotification()
+
+	ackNext(conn, 1)
+	if conn.congestionWindow != 2 {
+		t.Errorf("Congestion window = %d, want 2", conn.congestionWindow)
+	}
+}
+
+func TestProcessAck_SmoothsRTT(t *testing.T) {
+	conn, _ := NewConnection(nil)
+	conn.lastAckedSeq = 10
+	conn.rtt = 100 * time.Millisecond
+	markSent(conn, 11, 12)
+
+	// Retransmitted packets give no sample
+	conn.sendBuffer[11] = &sentPacket{seqNum: 11, sentTime: time.Now().Add(-time.Second), retryCount: 1}
+	conn.processAck(&rdpeudp.Packet{Header: rdpeudp.FECHeader{SnSourceAck: 11}})
+	if conn.rtt != 100*time.Millisecond {
+		t.Errorf("RTT = %v, want 100ms unchanged by a retransmitted packet", conn.rtt)
+	}
+
+	// A sample moves the estimate an eighth of the way toward it
+	conn.sendBuffer[12] = &sentPacket{seqNum: 12, sentTime: time.Now().Add(-900 * time.Millisecond)}
+	conn.processAck(&rdpeudp.Packet{Header: rdpeudp.FECHeader{SnSourceAck: 12}})
+	if conn.rtt < 200*time.Millisecond || conn.rtt > 220*time.Millisecond {
+		t.Errorf("RTT = %v, want about 200ms", conn.rtt)
+	}
+	if conn.stats.RTT != conn.rtt {
+		t.Errorf("Stats RTT = %v, want %v", conn.stats.RTT, conn.rtt)
+	}
+}
+
 // ============================================================================
 // Keepalive Timer Tests
 // Reference: MS-RDPEUDP Section 3.1.1.9 and 3.1.6.2
@@ -1119,6 +1243,7 @@ func TestConnection_ProcessAck(t *testing.T) {
 	conn.sendBuffer[10] = &sentPacket{seqNum: 10}
 	conn.sendBuffer[11] = &sentPacket{seqNum: 11}
 	conn.sendBuffer[12] = &sentPacket{seqNum: 12}
+	markSent(conn, 10, 12)
 
 	// Process ACK for sequence 11
 	ackPacket := &rdpeudp.Packet{
@@ -1312,6 +1437,75 @@ func TestConnection_DelayedAckTimer(t *testing.T) {
 	conn.stopTimers()
 }
 
+// TestConnection_DelayedAckTimeout validates the configured delayed ACK
+// timeout, its default and its floor
+func TestConnection_DelayedAckTimeout(t *testing.T) {
+	tests := []struct {
+		configured time.Duration
+		want       time.Duration
+	}{
+		{0, DelayedACKTimeout},
+		{DelayedACKTimeout, DelayedACKTimeout},
+		{40 * time.Millisecond, 40 * time.Millisecond},
+		{time.Millisecond, MinDelayedACKTimeout},
+	}
+	for _, tt := range tests {
+		conn, _ := NewConnection(&Config{DelayedACKTimeout: tt.configured})
+		if got := conn.delayedAckTimeout(); got != tt.want {
+			t.Errorf("delayedAckTimeout() with %v configured = %v, want %v", tt.configured, got, tt.want)
+		}
+	}
+	if got := DefaultConfig().DelayedACKTimeout; got != DelayedACKTimeout {
+		t.Errorf("DefaultConfig().DelayedACKTimeout = %v, want %v", got, DelayedACKTimeout)
+	}
+}
+
+// TestConnection_ImmediateAckWhenBacklogged validates that the pending ACK
+// goes out without waiting for the delayed ACK timer once unread datagrams
+// fill a quarter of the receive window
+func TestConnection_ImmediateAckWhenBacklogged(t *testing.T) {
+	conn, _ := NewConnection(&Config{ReceiveWindowSize: 32, DelayedACKTimeout: time.Hour})
+	conn.state = StateEstablished
+	conn.nextExpectSeq = 100
+	conn.highestRecvSeq = 99
+	t.Cleanup(func() { _ = conn.Close() })
+
+	receive := func(seq uint32) {
+		conn.mu.Lock()
+		conn.processData(rdpeudp.NewDataPacket(seq, seq, []byte{byte(seq)}))
+		conn.mu.Unlock()
+	}
+	acksSent := func() uint64 {
+		conn.mu.RLock()
+		defer conn.mu.RUnlock()
+		return conn.stats.PacketsSent
+	}
+
+	for seq := uint32(100); seq < 107; seq++ {
+		receive(seq)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := acksSent(); got != 0 {
+		t.Fatalf("%d ACKs sent with 7 datagrams queued, want the ACK delayed", got)
+	}
+
+	receive(107) // 8 queued, a quarter of the window
+	deadline := time.Now().Add(time.Second)
+	for acksSent() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := acksSent(); got != 1 {
+		t.Fatalf("%d ACKs sent with 8 datagrams queued, want 1", got)
+	}
+
+	conn.mu.RLock()
+	pending := conn.pendingAck
+	conn.mu.RUnlock()
+	if pending {
+		t.Error("pendingAck still set after the immediate ACK")
+	}
+}
+
 // TestConnection_StopTimers validates timer cleanup
 func TestConnection_StopTimers(t *testing.T) {
 	conn, _ := NewConnection(nil)
@@ -1393,3 +1587,616 @@ func TestConnection_BuildAckPacket_CongestionNotify(t *testing.T) {
 		t.Error("ACK packet should have CN flag when congestionNotify is true")
 	}
 }
+
+// TestConnection_BuildAckPacket_ReceiveWindowFollowsOccupancy validates that
+// the advertised receive window shrinks while received datagrams wait to be
+// read and grows back once the reader drains them
+func TestConnection_BuildAckPacket_ReceiveWindowFollowsOccupancy(t *testing.T) {
+	conn, _ := NewConnection(&Config{
+		ReceiveWindowSize:    64,
+		MinReceiveWindowSize: 16,
+		MaxReceiveWindowSize: 128,
+	})
+	conn.highestRecvSeq = 100
+	conn.nextExpectSeq = 101
+
+	window := func() uint16 {
+		return conn.buildAckPacket().Header.SourceAckReceiveWindowSize
+	}
+
+	for i := 0; i < 40; i++ {
+		conn.recvChan <- []byte{byte(i)}
+	}
+	if got := window(); got != 32 {
+		t.Errorf("window with 40 datagrams queued = %d, want 32", got)
+	}
+	if got := window(); got != 16 {
+		t.Errorf("window still backed up = %d, want 16", got)
+	}
+	if got := window(); got != 16 {
+		t.Errorf("window = %d, want the minimum 16", got)
+	}
+
+	// Partly drained: hold the window
+	for i := 0; i < 35; i++ {
+		<-conn.recvChan
+	}
+	if got := window(); got != 16 {
+		t.Errorf("window with 5 datagrams queued = %d, want 16", got)
+	}
+
+	for len(conn.recvChan) > 0 {
+		<-conn.recvChan
+	}
+	for _, want := range []uint16{32, 64, 128, 128} {
+		if got := window(); got != want {
+			t.Errorf("window with the reader caught up = %d, want %d", got, want)
+		}
+	}
+	if conn.Stats().ReceiveWindow != 128 {
+		t.Errorf("Stats().ReceiveWindow = %d, want 128", conn.Stats().ReceiveWindow)
+	}
+
+	// Out-of-order datagrams held for reordering count as well
+	for seq := uint32(200); seq < 264; seq++ {
+		conn.recvBuffer[seq] = []byte{0}
+	}
+	if got := window(); got != 64 {
+		t.Errorf("window with 64 datagrams awaiting reordering = %d, want 64", got)
+	}
+}
+
+// TestConnection_BuildAckPacket_FixedReceiveWindow validates that without
+// bounds the advertised window stays at ReceiveWindowSize
+func TestConnection_BuildAckPacket_FixedReceiveWindow(t *testing.T) {
+	conn, _ := NewConnection(&Config{ReceiveWindowSize: 32})
+	conn.recvChan <- []byte{0}
+	for i := 0; i < 20; i++ {
+		conn.recvChan <- []byte{0}
+		if got := conn.buildAckPacket().Header.SourceAckReceiveWindowSize; got != 32 {
+			t.Fatalf("window = %d, want 32", got)
+		}
+	}
+}
+
+// newEstablishedConnection returns an established connection without a
+// socket, so writes are only recorded in the send buffer
+func newEstablishedConnection(t *testing.T) *Connection {
+	t.Helper()
+	conn, err := NewConnection(nil)
+	if err != nil {
+		t.Fatalf("NewConnection() error = %v", err)
+	}
+	conn.state = StateEstablished
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// sentPayloads returns the payloads of the data packets in the send buffer,
+// in sequence order
+func sentPayloads(t *testing.T, conn *Connection) [][]byte {
+	t.Helper()
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	var payloads [][]byte
+	for seq := conn.localSeqNum; seq != conn.nextSendSeq; seq++ {
+		sent, ok := conn.sendBuffer[seq]
+		if !ok {
+			t.Fatalf("packet %d missing from the send buffer", seq)
+		}
+		var packet rdpeudp.Packet
+		if err := packet.Deserialize(sent.data); err != nil {
+			t.Fatalf("Deserialize() error = %v", err)
+		}
+		payloads = append(payloads, packet.Data)
+	}
+	return payloads
+}
+
+func TestConnection_ReadShortBuffer(t *testing.T) {
+	conn, _ := NewConnection(nil)
+	conn.recvChan <- []byte("0123456789")
+
+	buf := make([]byte, 4)
+	var got []byte
+	for len(got) < 10 {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		got = append(got, buf[:n]...)
+	}
+	if string(got) != "0123456789" {
+		t.Errorf("Read() data = %q, want the whole datagram", got)
+	}
+}
+
+func TestConnection_ReadDeadline(t *testing.T) {
+	conn, _ := NewConnection(nil)
+	buf := make([]byte, 16)
+
+	// A deadline in the past fails at once
+	_ = conn.SetReadDeadline(time.Now().Add(-time.Second))
+	_, err := conn.Read(buf)
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Read() past the deadline error = %v, want os.ErrDeadlineExceeded", err)
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("Read() error %v is not a net.Error timeout", err)
+	}
+
+	// A blocked Read returns when the deadline passes
+	_ = conn.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	start := time.Now()
+	if _, err := conn.Read(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Read() error = %v, want os.ErrDeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Read() returned after %v, want about 20ms", elapsed)
+	}
+
+	// Clearing the deadline lets Read wait for data again
+	_ = conn.SetDeadline(time.Time{})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		conn.recvChan <- []byte("data")
+	}()
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "data" {
+		t.Errorf("Read() = %q, %v after clearing the deadline", buf[:n], err)
+	}
+}
+
+func TestConnection_SetReadDeadlineWhileBlocked(t *testing.T) {
+	conn, _ := NewConnection(nil)
+	buf := make([]byte, 16)
+
+	// A deadline set after Read blocked still ends it
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(buf)
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	select {
+	case err := <-done:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("Read() error = %v, want os.ErrDeadlineExceeded", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read() still blocked after its deadline passed")
+	}
+
+	// Clearing a pending deadline keeps a blocked Read waiting for data
+	_ = conn.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	go func() {
+		n, err := conn.Read(buf)
+		if err == nil && string(buf[:n]) != "late" {
+			err = fmt.Errorf("read %q", buf[:n])
+		}
+		done <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	_ = conn.SetReadDeadline(time.Time{})
+	select {
+	case err := <-done:
+		t.Fatalf("Read() returned %v after its deadline was cleared", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	conn.recvChan <- []byte("late")
+	if err := <-done; err != nil {
+		t.Errorf("Read() error = %v", err)
+	}
+}
+
+func TestConnection_WriteDeadline(t *testing.T) {
+	conn := newEstablishedConnection(t)
+
+	_ = conn.SetWriteDeadline(time.Now().Add(-time.Second))
+	if _, err := conn.Write([]byte("late")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Write() past the deadline error = %v, want os.ErrDeadlineExceeded", err)
+	}
+
+	_ = conn.SetWriteDeadline(time.Now().Add(time.Minute))
+	if _, err := conn.Write([]byte("early")); err != nil {
+		t.Fatalf("Write() before the deadline error = %v", err)
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(-time.Second))
+	_ = conn.SetWriteDeadline(time.Time{})
+	if _, err := conn.Write([]byte("cleared")); err != nil {
+		t.Fatalf("Write() after clearing the deadline error = %v", err)
+	}
+
+	payloads := sentPayloads(t, conn)
+	if len(payloads) != 2 || string(payloads[0]) != "early" || string(payloads[1]) != "cleared" {
+		t.Errorf("sent %q, want the writes before the deadline and after clearing it", payloads)
+	}
+}
+
+func TestConnection_WriteBlocksOnFullSendWindow(t *testing.T) {
+	conn := newEstablishedConnection(t)
+	conn.congestionWindow = 4
+	conn.peerReceiveWindow = 2 // the smaller window applies
+
+	for _, payload := range []string{"one", "two"} {
+		if _, err := conn.Write([]byte(payload)); err != nil {
+			t.Fatalf("Write(%q) error = %v", payload, err)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.Write([]byte("three"))
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Write() returned %v with the send window full, want it to block", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Acknowledging the first packet frees a slot
+	conn.mu.Lock()
+	first := conn.localSeqNum // newEstablishedConnection sent no SYN
+	conn.lastAckedSeq = first - 1
+	conn.processAck(&rdpeudp.Packet{Header: rdpeudp.FECHeader{SnSourceAck: first, SourceAckReceiveWindowSize: 2}})
+	conn.mu.Unlock()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Write() after the ACK error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Write() still blocked after an ACK freed the window")
+	}
+
+	conn.mu.Lock()
+	outstanding := len(conn.sendBuffer)
+	conn.mu.Unlock()
+	if outstanding != 2 {
+		t.Errorf("send buffer holds %d packets, want 2", outstanding)
+	}
+}
+
+func TestConnection_WriteBlockedUntilDeadline(t *testing.T) {
+	conn := newEstablishedConnection(t)
+	conn.congestionWindow = 1
+
+	if _, err := conn.Write([]byte("fills the window")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	_ = conn.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+	start := time.Now()
+	if _, err := conn.Write([]byte("blocked")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Write() error = %v, want os.ErrDeadlineExceeded", err)
+	}
+	if waited := time.Since(start); waited < 40*time.Millisecond {
+		t.Errorf("Write() returned after %v, want it to wait for the deadline", waited)
+	}
+
+	// Closing the connection also ends a blocked Write
+	_ = conn.SetWriteDeadline(time.Time{})
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.Write([]byte("blocked"))
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	_ = conn.Close()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Write() succeeded after Close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Write() still blocked after Close")
+	}
+}
+
+func TestConnection_ReadFrom(t *testing.T) {
+	conn := newEstablishedConnection(t)
+	conn.upstreamMTU = MinMTU
+
+	data := make([]byte, 3000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	// io.Copy uses ReadFrom for a source without WriteTo
+	n, err := io.Copy(conn, io.LimitReader(bytes.NewReader(data), int64(len(data))))
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("io.Copy() = %d, %v", n, err)
+	}
+
+	payloads := sentPayloads(t, conn)
+	if len(payloads) != 3 {
+		t.Fatalf("sent %d datagrams, want 3", len(payloads))
+	}
+	for _, payload := range payloads {
+		if len(payload) > conn.MaxPayload() {
+			t.Errorf("datagram of %d bytes exceeds MaxPayload %d", len(payload), conn.MaxPayload())
+		}
+	}
+	if got := bytes.Join(payloads, nil); !bytes.Equal(got, data) {
+		t.Error("datagrams do not reassemble into the data written")
+	}
+}
+
+func TestConnection_WriteSplitsDatagrams(t *testing.T) {
+	conn := newEstablishedConnection(t)
+
+	data := bytes.Repeat([]byte{0x5A}, 2*conn.MaxPayload()+1)
+	n, err := conn.Write(data)
+	if err != nil || n != len(data) {
+		t.Fatalf("Write() = %d, %v", n, err)
+	}
+
+	payloads := sentPayloads(t, conn)
+	if len(payloads) != 3 {
+		t.Fatalf("sent %d datagrams, want 3", len(payloads))
+	}
+	if len(payloads[0]) != conn.MaxPayload() || len(payloads[1]) != conn.MaxPayload() || len(payloads[2]) != 1 {
+		t.Errorf("sent datagrams of %d, %d and %d bytes, want two full and one of 1 byte",
+			len(payloads[0]), len(payloads[1]), len(payloads[2]))
+	}
+}
+
+func TestConnection_WriteTo(t *testing.T) {
+	conn := newEstablishedConnection(t)
+	conn.recvChan <- []byte("hello, ")
+	conn.recvChan <- []byte("world")
+
+	go func() {
+		for len(conn.recvChan) > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		_ = conn.Close()
+	}()
+
+	var out bytes.Buffer
+	n, err := io.Copy(&out, conn)
+	if err != nil {
+		t.Fatalf("io.Copy() error = %v", err)
+	}
+	if n != 12 || out.String() != "hello, world" {
+		t.Errorf("io.Copy() = %d, %q", n, out.String())
+	}
+}
+
+// connectToPeer establishes a connection with a peer socket standing in for
+// the server, answering the SYN with a SYN+ACK from initial sequence number
+// peerSeq. It returns the connection and the peer's socket and address.
+func connectToPeer(t *testing.T, peerSeq uint32) (*Connection, *net.UDPConn, *net.UDPAddr) {
+	t.Helper()
+	return connectToPeerWithISN(t, generateInitialSequenceNumber(), peerSeq)
+}
+
+// connectToPeerWithISN is connectToPeer with a chosen initial sequence number
+func connectToPeerWithISN(t *testing.T, isn, peerSeq uint32) (*Connection, *net.UDPConn, *net.UDPAddr) {
+	t.Helper()
+	peer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = peer.Close() })
+
+	cfg := DefaultConfig()
+	cfg.RemoteAddr = peer.LocalAddr().(*net.UDPAddr)
+	conn, _ := NewConnection(cfg)
+	conn.localSeqNum = isn
+	conn.nextSendSeq = isn
+
+	connected := make(chan error, 1)
+	go func() { connected <- conn.Connect(context.Background()) }()
+
+	syn, from := readPeerPacket(t, peer)
+	if !syn.Header.HasFlag(rdpeudp.FlagSYN) {
+		t.Fatalf("first packet flags = %s, want SYN", rdpeudp.FlagsString(syn.Header.Flags))
+	}
+	synAck := rdpeudp.NewSYNACKPacket(peerSeq, syn.SynData.SnInitialSequenceNumber, DefaultMTU, DefaultMTU)
+	writePeerPacket(t, peer, from, synAck)
+
+	if err := <-connected; err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	// Skip the ACK completing the handshake
+	readPeerPacket(t, peer)
+	return conn, peer, from
+}
+
+// readPeerPacket reads the next packet the peer socket receives
+func readPeerPacket(t *testing.T, peer *net.UDPConn) (*rdpeudp.Packet, *net.UDPAddr) {
+	t.Helper()
+	buf := make([]byte, 2048)
+	_ = peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, from, err := peer.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("peer read: %v", err)
+	}
+	packet := &rdpeudp.Packet{}
+	if err := packet.Deserialize(buf[:n]); err != nil {
+		t.Fatalf("Deserialize() error = %v", err)
+	}
+	return packet, from
+}
+
+func writePeerPacket(t *testing.T, peer *net.UDPConn, to *net.UDPAddr, packet *rdpeudp.Packet) {
+	t.Helper()
+	data, err := packet.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize() error = %v", err)
+	}
+	if _, err := peer.WriteToUDP(data, to); err != nil {
+		t.Fatalf("peer write: %v", err)
+	}
+}
+
+// TestConnection_CloseSendsFIN validates that Close tells the peer with a
+// FIN acknowledging the last packet received, and returns as soon as the
+// peer answers with its own FIN
+func TestConnection_CloseSendsFIN(t *testing.T) {
+	conn, peer, from := connectToPeer(t, 7000)
+
+	closed := make(chan error, 1)
+	start := time.Now()
+	go func() { closed <- conn.Close() }()
+
+	fin, _ := readPeerPacket(t, peer)
+	if !fin.Header.HasFlag(rdpeudp.FlagFIN) {
+		t.Fatalf("teardown flags = %s, want FIN", rdpeudp.FlagsString(fin.Header.Flags))
+	}
+	if fin.Header.SnSourceAck != 7000 {
+		t.Errorf("FIN snSourceAck = %d, want 7000, the last sequence number received", fin.Header.SnSourceAck)
+	}
+
+	writePeerPacket(t, peer, from, rdpeudp.NewFINPacket(fin.Header.SnSourceAck))
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close() did not return")
+	}
+	if elapsed := time.Since(start); elapsed >= CloseLinger {
+		t.Errorf("Close() took %v, want it to stop lingering at the peer's FIN", elapsed)
+	}
+	if conn.State() != StateClosed {
+		t.Errorf("State() = %v, want CLOSED", conn.State())
+	}
+}
+
+// TestConnection_CloseLingersForSilentPeer validates that Close resends the
+// FIN to a peer that does not answer and gives up after CloseLinger
+func TestConnection_CloseLingersForSilentPeer(t *testing.T) {
+	conn, peer, _ := connectToPeer(t, 7000)
+
+	start := time.Now()
+	if err := conn.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < CloseLinger/2 || elapsed > 2*CloseLinger {
+		t.Errorf("Close() took %v, want about CloseLinger (%v)", elapsed, CloseLinger)
+	}
+
+	for i := 0; i < MaxRetransmitCount; i++ {
+		fin, _ := readPeerPacket(t, peer)
+		if !fin.Header.HasFlag(rdpeudp.FlagFIN) {
+			t.Errorf("teardown packet %d flags = %s, want FIN", i, rdpeudp.FlagsString(fin.Header.Flags))
+		}
+	}
+}
+
+// TestConnection_AnswersPeerFIN validates that a FIN from the peer closes
+// the connection and is answered with a FIN
+func TestConnection_AnswersPeerFIN(t *testing.T) {
+	conn, peer, from := connectToPeer(t, 7000)
+
+	writePeerPacket(t, peer, from, rdpeudp.NewFINPacket(conn.localSeqNum))
+
+	fin, _ := readPeerPacket(t, peer)
+	if !fin.Header.HasFlag(rdpeudp.FlagFIN) {
+		t.Fatalf("reply flags = %s, want FIN", rdpeudp.FlagsString(fin.Header.Flags))
+	}
+	if _, err := conn.Read(make([]byte, 16)); !errors.Is(err, ErrClosed) {
+		t.Errorf("Read() after the peer's FIN error = %v, want ErrClosed", err)
+	}
+	if err := conn.Close(); err != nil {
+		t.Errorf("Close() after the peer's FIN error = %v", err)
+	}
+}
+
+// TestConnection_AcksWithHighISN validates that ACKs are accepted when the
+// initial sequence number is in the upper half of the sequence space, where
+// comparing against an unseeded lastAckedSeq of zero reads them as stale
+func TestConnection_AcksWithHighISN(t *testing.T) {
+	conn, peer, from := connectToPeerWithISN(t, 0x90000000, 7000)
+
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	data, _ := readPeerPacket(t, peer)
+	if data.SourcePayload == nil || data.SourcePayload.SnSourceStart != 0x90000001 {
+		t.Fatalf("data packet = %+v, want sequence 0x90000001", data.SourcePayload)
+	}
+
+	writePeerPacket(t, peer, from, rdpeudp.NewACKPacket(data.SourcePayload.SnSourceStart, 64))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn.mu.Lock()
+		outstanding := len(conn.sendBuffer)
+		acked := conn.lastAckedSeq
+		conn.mu.Unlock()
+		if outstanding == 0 {
+			if acked != 0x90000001 {
+				t.Errorf("lastAckedSeq = %#x, want 0x90000001", acked)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("send buffer holds %d packets after the ACK, want 0 (lastAckedSeq %#x)", outstanding, acked)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestConnection_WriteBlocksAcrossSequenceWrap validates that a Write
+// blocked on a full send window is released by the peer's ACK when the
+// window straddles the wrap of the sequence space
+func TestConnection_WriteBlocksAcrossSequenceWrap(t *testing.T) {
+	conn, peer, from := connectToPeerWithISN(t, 0xFFFFFFFE, 7000)
+	conn.mu.Lock()
+	conn.peerReceiveWindow = 3
+	conn.mu.Unlock()
+
+	want := []uint32{0xFFFFFFFF, 0, 1}
+	for i, seq := range want {
+		if _, err := conn.Write([]byte{byte(i)}); err != nil {
+			t.Fatalf("Write(%d) error = %v", i, err)
+		}
+		data, _ := readPeerPacket(t, peer)
+		if data.SourcePayload == nil || data.SourcePayload.SnSourceStart != seq {
+			t.Fatalf("data packet %d = %+v, want sequence %#x", i, data.SourcePayload, seq)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.Write([]byte("blocked"))
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Write() returned %v with the send window full, want it to block", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// A cumulative ACK for sequence 0 frees the two slots either side of the wrap
+	writePeerPacket(t, peer, from, rdpeudp.NewACKPacket(0, 3))
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Write() after the ACK error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Write() still blocked after an ACK freed the window")
+	}
+
+	conn.mu.Lock()
+	outstanding := len(conn.sendBuffer)
+	conn.mu.Unlock()
+	if outstanding != 2 {
+		t.Errorf("send buffer holds %d packets, want 2", outstanding)
+	}
+}
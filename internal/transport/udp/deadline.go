@@ -0,0 +1,78 @@
+package udp
+
+import (
+	"sync"
+	"time"
+)
+
+// connDeadline is a read or write deadline that blocked calls can wait on.
+// Its cancel channel is closed once the deadline passes. Setting a new
+// deadline rearms the timer without replacing an open channel, so calls
+// already waiting observe the new deadline, and clearing the deadline leaves
+// them blocked. The zero value has no deadline.
+type connDeadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{}
+}
+
+// set sets the deadline to t. A zero t clears it.
+func (d *connDeadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cancel == nil {
+		d.cancel = make(chan struct{})
+	}
+	// A timer that already fired has closed cancel or is about to
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel
+	}
+	d.timer = nil
+
+	closed := isClosedChan(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	if wait := time.Until(t); wait > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(wait, func() { close(cancel) })
+		return
+	}
+
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+// wait returns a channel that is closed when the deadline passes
+func (d *connDeadline) wait() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cancel == nil {
+		d.cancel = make(chan struct{})
+	}
+	return d.cancel
+}
+
+// exceeded reports whether the deadline has passed
+func (d *connDeadline) exceeded() bool {
+	return isClosedChan(d.wait())
+}
+
+func isClosedChan(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
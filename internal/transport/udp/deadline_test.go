@@ -0,0 +1,44 @@
+package udp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConnDeadline(t *testing.T) {
+	var d connDeadline
+	if d.exceeded() {
+		t.Fatal("zero deadline exceeded")
+	}
+
+	d.set(time.Now().Add(-time.Second))
+	if !d.exceeded() {
+		t.Fatal("past deadline not exceeded")
+	}
+
+	// Clearing an exceeded deadline opens a new channel
+	d.set(time.Time{})
+	if d.exceeded() {
+		t.Fatal("cleared deadline exceeded")
+	}
+
+	// Waiters keep their channel when the deadline moves
+	wait := d.wait()
+	d.set(time.Now().Add(time.Hour))
+	d.set(time.Now().Add(10 * time.Millisecond))
+	select {
+	case <-wait:
+	case <-time.After(time.Second):
+		t.Fatal("waiter not woken by the moved deadline")
+	}
+
+	// A cleared pending deadline never fires
+	d.set(time.Now().Add(10 * time.Millisecond))
+	wait = d.wait()
+	d.set(time.Time{})
+	select {
+	case <-wait:
+		t.Fatal("cleared deadline fired")
+	case <-time.After(30 * time.Millisecond):
+	}
+}
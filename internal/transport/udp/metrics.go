@@ -0,0 +1,80 @@
+package udp
+
+import (
+	"sync"
+	"time"
+)
+
+// ConnectionSnapshot is a point-in-time view of a connection's transport
+// state, used for runtime diagnostics.
+type ConnectionSnapshot struct {
+	LocalAddr        string
+	RemoteAddr       string
+	State            string
+	Stats            ConnectionStats
+	CongestionWindow int
+	RTT              time.Duration
+	LastRecvTime     time.Time
+}
+
+// registry tracks connections between Connect and Close
+var registry = struct {
+	mu    sync.Mutex
+	conns map[*Connection]struct{}
+}{conns: make(map[*Connection]struct{})}
+
+func registerConnection(c *Connection) {
+	registry.mu.Lock()
+	registry.conns[c] = struct{}{}
+	registry.mu.Unlock()
+}
+
+func unregisterConnection(c *Connection) {
+	registry.mu.Lock()
+	delete(registry.conns, c)
+	registry.mu.Unlock()
+}
+
+// Snapshot returns the connection's current statistics and congestion state.
+// It holds the read lock only long enough to copy the fields.
+func (c *Connection) Snapshot() ConnectionSnapshot {
+	c.mu.RLock()
+	snap := ConnectionSnapshot{
+		State:            c.state.String(),
+		Stats:            c.stats,
+		CongestionWindow: c.congestionWindow,
+		RTT:              c.rtt,
+		LastRecvTime:     c.lastRecvTime,
+	}
+	conn := c.conn
+	c.mu.RUnlock()
+
+	if conn != nil {
+		if addr := conn.LocalAddr(); addr != nil {
+			snap.LocalAddr = addr.String()
+		}
+		if addr := conn.RemoteAddr(); addr != nil {
+			snap.RemoteAddr = addr.String()
+		}
+	}
+	return snap
+}
+
+// ActiveConnections returns snapshots of all open connections.
+func ActiveConnections() []ConnectionSnapshot {
+	// Copy the set first so the registry lock is not held while each
+	// Snapshot takes its connection's lock; connections unregister from the
+	// goroutine waiting on closeChan, which then never waits on a snapshot
+	registry.mu.Lock()
+	conns := make([]*Connection, 0, len(registry.conns))
+	for c := range registry.conns {
+		conns = append(conns, c)
+	}
+	registry.mu.Unlock()
+
+	snaps := make([]ConnectionSnapshot, 0, len(conns))
+	for _, c := range conns {
+		snaps = append(snaps, c.Snapshot())
+	}
+	return snaps
+}
@@ -0,0 +1,95 @@
+package udp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnection_Snapshot(t *testing.T) {
+	conn, _ := NewConnection(nil)
+	conn.state = StateEstablished
+	conn.congestionWindow = 8
+	conn.rtt = 40 * time.Millisecond
+	conn.lastRecvTime = time.Unix(1700000000, 0)
+	conn.stats.Retransmits = 3
+
+	snap := conn.Snapshot()
+	if snap.State != "ESTABLISHED" {
+		t.Errorf("State = %q, want ESTABLISHED", snap.State)
+	}
+	if snap.CongestionWindow != 8 {
+		t.Errorf("CongestionWindow = %d, want 8", snap.CongestionWindow)
+	}
+	if snap.RTT != 40*time.Millisecond {
+		t.Errorf("RTT = %v, want 40ms", snap.RTT)
+	}
+	if !snap.LastRecvTime.Equal(conn.lastRecvTime) {
+		t.Errorf("LastRecvTime = %v, want %v", snap.LastRecvTime, conn.lastRecvTime)
+	}
+	if snap.Stats.Retransmits != 3 {
+		t.Errorf("Stats.Retransmits = %d, want 3", snap.Stats.Retransmits)
+	}
+}
+
+func TestActiveConnections_TracksLifecycle(t *testing.T) {
+	// A silent peer keeps the connection in SYN_SENT until the context ends
+	peer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer peer.Close()
+
+	cfg := DefaultConfig()
+	cfg.RemoteAddr = peer.LocalAddr().(*net.UDPAddr)
+	conn, _ := NewConnection(cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		_ = conn.Connect(ctx)
+		close(done)
+	}()
+
+	if !waitFor(func() bool { return isActive(conn) }) {
+		t.Fatal("connection not listed while connecting")
+	}
+
+	var found bool
+	for _, snap := range ActiveConnections() {
+		if snap.RemoteAddr == peer.LocalAddr().String() {
+			found = true
+			if snap.State != "SYN_SENT" {
+				t.Errorf("State = %q, want SYN_SENT", snap.State)
+			}
+		}
+	}
+	if !found {
+		t.Error("snapshot for the connection not found")
+	}
+
+	cancel()
+	<-done
+	if !waitFor(func() bool { return !isActive(conn) }) {
+		t.Error("connection still listed after close")
+	}
+}
+
+func isActive(c *Connection) bool {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	_, ok := registry.conns[c]
+	return ok
+}
+
+func waitFor(cond func() bool) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package udp
+
+import "sort"
+
+// seqBefore reports whether sequence number a precedes b, allowing for
+// wrap-around at 0xFFFFFFFF (serial number arithmetic, RFC 1982).
+func seqBefore(a, b uint32) bool {
+	return int32(a-b) < 0 // #nosec G115 -- intentional two's complement distance
+}
+
+// seqRange is an inclusive range of sequence numbers.
+type seqRange struct {
+	start, end uint32
+}
+
+// ackRanges is the set of sequence numbers acknowledged by the peer above
+// the cumulative acknowledgment point, kept sorted and merged.
+type ackRanges []seqRange
+
+// add records [start, end] as acknowledged, merging adjacent ranges.
+func (r ackRanges) add(start, end uint32) ackRanges {
+	r = append(r, seqRange{start: start, end: end})
+	sort.Slice(r, func(i, j int) bool { return seqBefore(r[i].start, r[j].start) })
+
+	merged := r[:1]
+	for _, next := range r[1:] {
+		last := &merged[len(merged)-1]
+		if seqBefore(last.end+1, next.start) {
+			merged = append(merged, next)
+			continue
+		}
+		if seqBefore(last.end, next.end) {
+			last.end = next.end
+		}
+	}
+	return merged
+}
+
+// contains reports whether seq has been acknowledged.
+func (r ackRanges) contains(seq uint32) bool {
+	i := sort.Search(len(r), func(i int) bool { return !seqBefore(r[i].end, seq) })
+	return i < len(r) && !seqBefore(seq, r[i].start)
+}
+
+// highest returns the newest acknowledged sequence number.
+func (r ackRanges) highest() (uint32, bool) {
+	if len(r) == 0 {
+		return 0, false
+	}
+	return r[len(r)-1].end, true
+}
+
+// pruneBefore drops ranges that end before seq. They carry no information
+// once every packet they could fill a gap for has been acknowledged.
+func (r ackRanges) pruneBefore(seq uint32) ackRanges {
+	i := sort.Search(len(r), func(i int) bool { return !seqBefore(r[i].end, seq) })
+	return r[i:]
+}
@@ -0,0 +1,233 @@
+package udp
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rcarmo/go-rdp/internal/protocol/rdpeudp"
+)
+
+func TestSeqBefore(t *testing.T) {
+	tests := []struct {
+		a, b uint32
+		want bool
+	}{
+		{1, 2, true},
+		{2, 1, false},
+		{5, 5, false},
+		{0xFFFFFFFF, 0, true},
+		{0xFFFFFFF0, 3, true},
+		{3, 0xFFFFFFF0, false},
+	}
+	for _, tc := range tests {
+		if got := seqBefore(tc.a, tc.b); got != tc.want {
+			t.Errorf("seqBefore(0x%08X, 0x%08X) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestAckRanges_AddMerges(t *testing.T) {
+	var r ackRanges
+	r = r.add(10, 12)
+	r = r.add(20, 25)
+	r = r.add(13, 15) // adjacent to the first range
+	r = r.add(24, 30) // overlaps the second range
+
+	want := ackRanges{{10, 15}, {20, 30}}
+	if !reflect.DeepEqual(r, want) {
+		t.Fatalf("ranges = %v, want %v", r, want)
+	}
+
+	if !r.contains(14) || !r.contains(20) || r.contains(16) || r.contains(31) {
+		t.Error("contains() does not match the merged ranges")
+	}
+
+	r = r.pruneBefore(16)
+	if !reflect.DeepEqual(r, ackRanges{{20, 30}}) {
+		t.Errorf("after pruneBefore(16) ranges = %v", r)
+	}
+}
+
+func TestAckRanges_WrapAround(t *testing.T) {
+	var r ackRanges
+	r = r.add(0, 2)
+	r = r.add(0xFFFFFFFD, 0xFFFFFFFF)
+
+	want := ackRanges{{0xFFFFFFFD, 2}}
+	if !reflect.DeepEqual(r, want) {
+		t.Fatalf("ranges = %v, want %v", r, want)
+	}
+	if !r.contains(0xFFFFFFFE) || !r.contains(1) || r.contains(3) {
+		t.Error("contains() wrong across the wrap")
+	}
+	if highest, _ := r.highest(); highest != 2 {
+		t.Errorf("highest() = %d, want 2", highest)
+	}
+}
+
+func TestPendingRetransmits_WrapAround(t *testing.T) {
+	conn, _ := NewConnection(nil)
+	conn.state = StateEstablished
+
+	for _, seq := range []uint32{0xFFFFFFFC, 0xFFFFFFFD, 0xFFFFFFFE, 0xFFFFFFFF, 0, 1, 2, 3} {
+		conn.sendBuffer[seq] = &sentPacket{seqNum: seq, nextRetry: time.Now().Add(time.Hour)}
+	}
+	markSent(conn, 0xFFFFFFFC, 3)
+
+	// Peer received 0xFFFFFFFD-0xFFFFFFFE and 0-2 but not 0xFFFFFFFF
+	conn.processAck(&rdpeudp.Packet{
+		Header: rdpeudp.FECHeader{SnSourceAck: 2},
+		AckVector: &rdpeudp.AckVector{
+			AckVectorElements: []uint8{
+				(AckStateReceived << 6) | 2,    // 2, 1, 0
+				(AckStateNotReceived << 6) | 0, // 0xFFFFFFFF
+				(AckStateReceived << 6) | 1,    // 0xFFFFFFFE, 0xFFFFFFFD
+			},
+		},
+	})
+
+	if conn.stats.Retransmits != 1 {
+		t.Errorf("Retransmits = %d, want 1", conn.stats.Retransmits)
+	}
+	if len(conn.sendBuffer) != 2 {
+		t.Errorf("send buffer holds %d packets, want 0xFFFFFFFF and 3", len(conn.sendBuffer))
+	}
+	if _, ok := conn.sendBuffer[0xFFFFFFFF]; !ok {
+		t.Error("lost packet 0xFFFFFFFF should remain buffered")
+	}
+	if _, ok := conn.sendBuffer[0xFFFFFFFC]; ok {
+		t.Error("packet older than the ACK vector should be cumulatively acknowledged")
+	}
+
+	// The retransmission is in flight, so it is not repeated yet
+	if got := conn.pendingRetransmits(); len(got) != 0 {
+		t.Errorf("pendingRetransmits() = %v while retransmission in flight", got)
+	}
+
+	conn.sendBuffer[0xFFFFFFFF].nextRetry = time.Now().Add(-time.Millisecond)
+	if got := conn.pendingRetransmits(); !reflect.DeepEqual(got, []uint32{0xFFFFFFFF}) {
+		t.Errorf("pendingRetransmits() = %v, want [0xFFFFFFFF]", got)
+	}
+}
+
+// TestSelectiveRetransmit_Loss sends data through a receiver that drops 30%
+// of packets and ACKs every arrival. Each lost packet should be retransmitted
+// once, not once per ACK that reports the gap.
+func TestSelectiveRetransmit_Loss(t *testing.T) {
+	sender, _ := NewConnection(nil)
+	sender.state = StateEstablished
+	receiver, _ := NewConnection(nil)
+	receiver.state = StateEstablished
+
+	const base, count = uint32(1000), 100
+	receiver.nextExpectSeq = base
+	receiver.highestRecvSeq = base - 1
+	markSent(sender, base, base+count-1)
+
+	dropped := func(i int) bool { return i%10 == 2 || i%10 == 5 || i%10 == 8 }
+
+	// The receiver may ACK from its delayed ACK timer meanwhile, so feed it
+	// under its lock
+	receive := func(seq uint32, i int) {
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+		receiver.processData(rdpeudp.NewDataPacket(seq, seq, []byte{byte(i)}))
+	}
+	ack := func() *rdpeudp.Packet {
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+		return receiver.buildAckPacket()
+	}
+	t.Cleanup(func() {
+		receiver.mu.Lock()
+		receiver.stopTimers()
+		receiver.mu.Unlock()
+	})
+
+	lost := 0
+	for i := 0; i < count; i++ {
+		seq := base + uint32(i) // #nosec G115
+		sender.sendBuffer[seq] = &sentPacket{seqNum: seq, data: []byte{byte(i)}, nextRetry: time.Now().Add(time.Hour)}
+		if dropped(i) {
+			lost++
+			continue
+		}
+		receive(seq, i)
+		sender.processAck(ack())
+	}
+
+	if got := sender.stats.Retransmits; got != uint64(lost) {
+		t.Errorf("Retransmits = %d, want %d (one per lost packet)", got, lost)
+	}
+	if len(sender.sendBuffer) != lost {
+		t.Errorf("send buffer holds %d packets, want the %d lost ones", len(sender.sendBuffer), lost)
+	}
+
+	// Deliver the retransmissions; everything is then acknowledged
+	for i := 0; i < count; i++ {
+		if dropped(i) {
+			seq := base + uint32(i) // #nosec G115
+			receive(seq, i)
+		}
+	}
+	sender.processAck(ack())
+
+	if len(sender.sendBuffer) != 0 {
+		t.Errorf("send buffer holds %d packets after recovery, want 0", len(sender.sendBuffer))
+	}
+	if len(sender.ackedRanges) != 0 {
+		t.Errorf("ackedRanges = %v after recovery, want none", sender.ackedRanges)
+	}
+}
+
+// TestProcessAck_IgnoresNeverSentSequences feeds an ACK vector acknowledging
+// sequence numbers past the last packet sent. It must be counted and
+// otherwise ignored rather than acknowledge or retransmit anything.
+func TestProcessAck_IgnoresNeverSentSequences(t *testing.T) {
+	conn, _ := NewConnection(nil)
+	conn.state = StateEstablished
+	conn.lastAckedSeq = 499
+
+	for seq := uint32(500); seq <= 503; seq++ {
+		conn.sendBuffer[seq] = &sentPacket{seqNum: seq, nextRetry: time.Now().Add(-time.Millisecond)}
+	}
+	markSent(conn, 500, 503)
+
+	// Claims 510-508 and 504-503 arrived, with 507-505 missing
+	conn.processAck(&rdpeudp.Packet{
+		Header: rdpeudp.FECHeader{SnSourceAck: 510},
+		AckVector: &rdpeudp.AckVector{
+			AckVectorElements: []uint8{
+				(AckStateReceived << 6) | 2,    // 510, 509, 508
+				(AckStateNotReceived << 6) | 2, // 507, 506, 505
+				(AckStateReceived << 6) | 1,    // 504, 503
+			},
+		},
+	})
+
+	if conn.stats.InvalidAcks != 1 {
+		t.Errorf("InvalidAcks = %d, want 1", conn.stats.InvalidAcks)
+	}
+	if conn.lastAckedSeq != 499 {
+		t.Errorf("lastAckedSeq = %d, want 499 unchanged", conn.lastAckedSeq)
+	}
+	if len(conn.sendBuffer) != 4 {
+		t.Errorf("send buffer holds %d packets, want all 4", len(conn.sendBuffer))
+	}
+	if len(conn.ackedRanges) != 0 {
+		t.Errorf("ackedRanges = %v, want none", conn.ackedRanges)
+	}
+	if conn.stats.Retransmits != 0 {
+		t.Errorf("Retransmits = %d, want 0", conn.stats.Retransmits)
+	}
+
+	// A consistent ACK is still processed
+	conn.processAck(&rdpeudp.Packet{Header: rdpeudp.FECHeader{SnSourceAck: 501}})
+	if len(conn.sendBuffer) != 2 {
+		t.Errorf("send buffer holds %d packets after a valid ACK, want 2", len(conn.sendBuffer))
+	}
+	if conn.stats.InvalidAcks != 1 {
+		t.Errorf("InvalidAcks = %d, want still 1", conn.stats.InvalidAcks)
+	}
+}
@@ -235,11 +235,13 @@ func (tm *TunnelManager) establishTunnel(
 	// Create secure connection config
 	secureConfig := &SecureConfig{
 		UDPConfig: &Config{
-			RemoteAddr:        serverAddr,
-			MTU:               DefaultMTU,
-			ReceiveWindowSize: DefaultReceiveWindowSize,
-			Reliable:          tunnel.Reliable,
-			ProtocolVersion:   version,
+			RemoteAddr:           serverAddr,
+			MTU:                  DefaultMTU,
+			ReceiveWindowSize:    DefaultReceiveWindowSize,
+			MinReceiveWindowSize: DefaultMinReceiveWindowSize,
+			MaxReceiveWindowSize: DefaultMaxReceiveWindowSize,
+			Reliable:             tunnel.Reliable,
+			ProtocolVersion:      version,
 		},
 		Reliable:       tunnel.Reliable,
 		RequestID:      tunnel.RequestID,
@@ -61,7 +61,7 @@ func RLEDecompress24(src []byte, dst []byte, rowDelta int) bool {
 
 // DecodePlanar decodes RDP6/RDPGFX Planar codec data to RGBA pixels.
 func DecodePlanar(src []byte, width, height int) []byte {
-	return internalcodec.DecompressPlanar(src, width, height)
+	return internalcodec.DecodePlanar(src, width, height)
 }
 
 // RDPGFX codec identifiers used by WireToSurface PDUs (MS-RDPEGFX).
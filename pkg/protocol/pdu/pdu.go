@@ -5,6 +5,13 @@ import internal "github.com/rcarmo/go-rdp/internal/protocol/pdu"
 
 type CapabilitySet = internal.CapabilitySet
 
+type RFXCodecMode = internal.RFXCodecMode
+
+const (
+	RFXCodecModeVideo = internal.RFXCodecModeVideo
+	RFXCodecModeImage = internal.RFXCodecModeImage
+)
+
 var (
 	ErrInvalidCorrelationID = internal.ErrInvalidCorrelationID
 	ErrDeactivateAll        = internal.ErrDeactivateAll
@@ -12,4 +19,7 @@ var (
 	RemoteFXImageGUID       = internal.RemoteFXImageGUID
 )
 
-var NewBitmapCodecsWithRFXCapabilitySet = internal.NewBitmapCodecsWithRFXCapabilitySet
+var (
+	NewBitmapCodecsWithRFXCapabilitySet     = internal.NewBitmapCodecsWithRFXCapabilitySet
+	NewBitmapCodecsWithRFXModeCapabilitySet = internal.NewBitmapCodecsWithRFXModeCapabilitySet
+)
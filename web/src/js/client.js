@@ -12,6 +12,7 @@ import { GraphicsMixin } from './graphics.js';
 import { ClipboardMixin } from './clipboard.js';
 import { UIMixin } from './ui.js';
 import AudioMixin from './audio.js';
+import MicrophoneMixin from './microphone.js';
 import { parseUpdateHeader, parseNewPointerUpdate, parseCachedPointerUpdate, parsePointerPositionUpdate } from './protocol.js';
 
 // Re-export Logger for external use
@@ -56,6 +57,7 @@ function Client(websocketURL, canvasID, hostID, userID, passwordID) {
     this.initGraphics();
     this.initUI();
     this.initAudio();
+    this.initMicrophone();
     
     // Bind core methods
     this.initialize = this.initialize.bind(this);
@@ -78,6 +80,7 @@ applyMixin(GraphicsMixin);
 applyMixin(ClipboardMixin);
 applyMixin(UIMixin);
 applyMixin(AudioMixin);
+applyMixin(MicrophoneMixin);
 
 /**
  * Connect to RDP server
@@ -124,6 +127,8 @@ Client.prototype.connect = function() {
     url.searchParams.set('width', screenWidth);
     url.searchParams.set('height', screenHeight);
     url.searchParams.set('colorDepth', colorDepth);
+    // Lets the gateway collapse duplicate connections (e.g. double-clicks)
+    url.searchParams.set('nonce', this.sessionId);
     if (disableNLA) {
         url.searchParams.set('disableNLA', 'true');
         Logger.debug("Connection", "NLA disabled");
@@ -132,6 +137,12 @@ Client.prototype.connect = function() {
     url.searchParams.set('audio', 'true');
     this.enableAudio();
     Logger.debug("Audio", "Audio redirection enabled");
+    // Microphone redirection is opt-in (see setMicrophoneEnabled)
+    if (this.microphoneEnabled) {
+        url.searchParams.set('microphone', 'true');
+    }
+    this.applyReconnectCookie(url);
+    this.applyForceCodec(url);
 
     // Store credentials to send after connection opens
     this._pendingCredentials = { host, user, password };
@@ -220,11 +231,23 @@ Client.prototype.connect = function() {
             this.showUserError('Connection closed abnormally: Check your network connection');
         } else if (e.code === 1015) {
             this.showUserError('TLS handshake failed: Certificate validation error');
+        } else if (e.code === 4000) {
+            this.showUserSuccess('Session ended by the remote computer');
+        } else if (e.code === 4001) {
+            this.showUserError('Authentication failed: Invalid username or password');
+        } else if (e.code === 4002) {
+            this.showUserError(`Server not reachable: ${e.reason || 'Check the server address'}`);
+        } else if (e.code === 4003) {
+            this.showUserError('Connection refused by gateway policy');
+        } else if (e.code === 4004) {
+            this.showUserError('Connection closed: Idle timeout');
         } else {
             this.showUserError(`Connection lost (code: ${e.code})`);
         }
         
-        if (!this.manualDisconnect && this.reconnectAttempts < this.maxReconnectAttempts) {
+        // Logoff, rejected credentials and policy refusals would fail again
+        const finalClose = e.code === 4000 || e.code === 4001 || e.code === 4003;
+        if (!finalClose && !this.manualDisconnect && this.reconnectAttempts < this.maxReconnectAttempts) {
             // Harmonize backoff with session.js (uses attempts-1 for first retry)
             const exponent = Math.max(0, this.reconnectAttempts - 1);
             const exponentialDelay = this.reconnectDelay * Math.pow(2, exponent);
@@ -362,6 +385,7 @@ Client.prototype.deinitialize = function() {
     this.clearAllTimeouts();
     this.clearBitmapCache();
     this.disableAudio();
+    this.stopMicrophone();
     if (this.renderer && typeof this.renderer.destroy === 'function') {
         this.renderer.destroy();
     }
@@ -397,6 +421,33 @@ Client.prototype.handleMessage = function(arrayBuffer) {
     // Check for special message types first
     const firstByte = new Uint8Array(arrayBuffer)[0];
     
+    // Fragment of an update too large for one message (0xF9 marker):
+    // [0xF9][flags][chunk], flags bit 0 marks the last fragment
+    if (firstByte === 0xF9) {
+        const bytes = new Uint8Array(arrayBuffer);
+        this.updateFragments = this.updateFragments || [];
+        this.updateFragments.push(bytes.subarray(2));
+        if ((bytes[1] & 0x01) === 0) {
+            return;
+        }
+        const total = this.updateFragments.reduce((sum, chunk) => sum + chunk.length, 0);
+        const update = new Uint8Array(total);
+        let offset = 0;
+        for (const chunk of this.updateFragments) {
+            update.set(chunk, offset);
+            offset += chunk.length;
+        }
+        this.updateFragments = [];
+        this.handleMessage(update.buffer);
+        return;
+    }
+    
+    // Fills and screen-to-screen copies from drawing orders (0xF8 marker)
+    if (firstByte === 0xF8) {
+        this.handleDrawingOps(new Uint8Array(arrayBuffer));
+        return;
+    }
+    
     // Audio data (0xFE marker)
     if (firstByte === 0xFE && this.audioEnabled) {
         Logger.debug('Audio', `Received audio message: ${arrayBuffer.byteLength} bytes`);
@@ -404,6 +455,12 @@ Client.prototype.handleMessage = function(arrayBuffer) {
         return;
     }
     
+    // Remote clipboard text (0xFC marker)
+    if (firstByte === 0xFC) {
+        this.handleClipboardMessage(new Uint8Array(arrayBuffer));
+        return;
+    }
+    
     // Capabilities/JSON message (0xFF marker)
     if (firstByte === 0xFF) {
         // Limit JSON message size to prevent DoS (1MB max)
@@ -411,35 +468,18 @@ Client.prototype.handleMessage = function(arrayBuffer) {
             Logger.warn("Message", "JSON message too large, ignoring");
             return;
         }
+        // A 0x01 flag after the marker means the JSON is gzip-compressed
+        if (arrayBuffer.byteLength > 1 && new Uint8Array(arrayBuffer)[1] === 0x01) {
+            this.decompressControlMessage(arrayBuffer.slice(2))
+                .then(text => this.handleControlMessage(JSON.parse(text)))
+                .catch(e => Logger.warn("Message", `Failed to decompress 0xFF message: ${e.message}`));
+            return;
+        }
         try {
             // Strip the 0xFF marker and parse JSON
             const jsonData = arrayBuffer.slice(1);
             const text = new TextDecoder().decode(jsonData);
-            const message = JSON.parse(text);
-            
-            if (message.type === 'capabilities') {
-                // Sync log level with backend
-                if (message.logLevel) {
-                    Logger.setLevel(message.logLevel);
-                }
-                // Log server-negotiated session parameters
-                // Filter out 'Ignore' codec as it's just a placeholder
-                const serverCodecs = (message.codecs || []).filter(c => c !== 'Ignore');
-                console.info(
-                    '%c[RDP Session] Negotiated',
-                    'color: #2196F3; font-weight: bold',
-                    '\n  NLA:', message.useNLA ? 'enabled' : 'disabled',
-                    '\n  Audio:', message.audioEnabled ? 'enabled' : 'disabled',
-                    '\n  Color:', `${message.colorDepth}bpp`,
-                    '\n  Desktop:', message.desktopSize,
-                    '\n  Server codecs:', serverCodecs.join(', ') || 'none',
-                    '\n  Channels:', message.channels?.join(', ') || 'none'
-                );
-                this.serverCapabilities = message;
-            } else if (message.type === 'error') {
-                this.showUserError(message.message);
-                this.emitEvent('error', {message: message.message});
-            }
+            this.handleControlMessage(JSON.parse(text));
             return;
         } catch (e) {
             Logger.warn("Message", `Failed to parse 0xFF message: ${e.message}`);
@@ -520,6 +560,110 @@ Client.prototype.handleMessage = function(arrayBuffer) {
     Logger.debug("Update", `Unknown update code: ${header.updateCode}`);
 };
 
+/**
+ * Inflate a gzip-compressed control message payload to text
+ * @param {ArrayBuffer} data - gzip data following the 0xFF marker and flag
+ * @returns {Promise<string>}
+ */
+Client.prototype.decompressControlMessage = function(data) {
+    const stream = new Blob([data]).stream().pipeThrough(new DecompressionStream('gzip'));
+    return new Response(stream).text();
+};
+
+/**
+ * Dispatch a parsed 0xFF control message
+ * @param {Object} message - Decoded JSON control message
+ */
+Client.prototype.handleControlMessage = function(message) {
+    if (message.type === 'capabilities') {
+        // Sync log level with backend
+        if (message.logLevel) {
+            Logger.setLevel(message.logLevel);
+        }
+        // Log server-negotiated session parameters
+        // Filter out 'Ignore' codec as it's just a placeholder
+        const serverCodecs = (message.codecs || []).filter(c => c !== 'Ignore');
+        console.info(
+            '%c[RDP Session] Negotiated',
+            'color: #2196F3; font-weight: bold',
+            '\n  NLA:', message.useNLA ? 'enabled' : 'disabled',
+            '\n  Audio:', message.audioEnabled ? 'enabled' : 'disabled',
+            '\n  Color:', `${message.colorDepth}bpp`,
+            '\n  Desktop:', message.desktopSize,
+            '\n  Server codecs:', serverCodecs.join(', ') || 'none',
+            '\n  Advertised codecs:', message.advertisedCodecs?.join(', ') || 'none',
+            '\n  Channels:', message.channels?.join(', ') || 'none'
+        );
+        this.serverCapabilities = message;
+    } else if (message.type === 'error') {
+        this.showUserError(message.message);
+        this.emitEvent('error', {message: message.message});
+    } else if (message.type === 'warning') {
+        this.showUserWarning(message.message);
+        this.emitEvent('warning', {reason: message.reason, message: message.message});
+    } else if (message.type === 'microphone') {
+        this.handleMicrophoneMessage(message);
+    } else if (message.type === 'monitorLayout') {
+        // Rectangles in desktop coordinates; embedders arrange canvases from these
+        this.monitorLayout = message.monitors || [];
+        Logger.debug("Session", `Monitor layout: ${this.monitorLayout.length} monitor(s)`);
+        this.emitEvent('monitorlayout', {monitors: this.monitorLayout});
+    } else if (message.type === 'reconnectCookie') {
+        this.setReconnectCookie(message.cookie);
+        Logger.debug("Session", "Auto-reconnect cookie received");
+    } else if (message.type === 'logonError') {
+        // Failed logons are shown; notifications such as "the logon continues" are only logged
+        if (message.failed) {
+            this.showUserError(`Logon failed: ${message.reason}`);
+        } else {
+            Logger.info("Session", `Logon notification: ${message.reason}`);
+        }
+        this.emitEvent('logonerror', {
+            reason: message.reason,
+            failed: message.failed,
+            notificationType: message.notificationType,
+            notificationData: message.notificationData
+        });
+    } else if (message.type === 'cursor') {
+        // Pointer updates translated by the gateway: hide, default, or a decoded shape
+        if (message.shape) {
+            this.setPointerShape(message.shape);
+        } else {
+            this.setPointerVisible(message.visible);
+        }
+    } else if (message.type === 'connecting') {
+        // Periodic progress from the gateway while the screen is still blank
+        this.showUserInfo(`${message.message} (${message.elapsed}s)`);
+        Logger.debug("Session", `Still connecting: stage=${message.stage} elapsed=${message.elapsed}s`);
+        this.emitEvent('connecting', {
+            stage: message.stage,
+            message: message.message,
+            elapsed: message.elapsed
+        });
+    } else if (message.type === 'connectPhase') {
+        // Connection sequence milestones; a failed one is the last phase reached
+        this.connectPhase = message.phase;
+        if (message.failed) {
+            Logger.warn("Session", `Connection failed after ${message.phase} (${message.elapsedMs}ms)`);
+        } else {
+            Logger.debug("Session", `Connection phase: ${message.phase} (${message.elapsedMs}ms)`);
+        }
+        this.emitEvent('connectphase', {
+            phase: message.phase,
+            elapsedMs: message.elapsedMs,
+            failed: !!message.failed
+        });
+    } else if (message.type === 'statusInfo') {
+        // Connection progress from the server, e.g. while a broker wakes a VM
+        this.showUserInfo(message.message);
+        Logger.info("Session", `Server status: ${message.message}`);
+        this.emitEvent('statusinfo', {
+            message: message.message,
+            code: message.code
+        });
+    }
+};
+
 /**
  * Disconnect from server
  */
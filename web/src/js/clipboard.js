@@ -1,6 +1,7 @@
 /**
  * Clipboard handling for RDP client
- * Provides clipboard buffer UI integration for text transfer to remote
+ * Provides clipboard buffer UI integration for text transfer to remote,
+ * using the cliprdr channel when the server supports it
  * @module clipboard
  */
 
@@ -168,6 +169,55 @@ export const ClipboardMixin = {
         return specialMap[char] || null;
     },
     
+    /**
+     * Check whether the server negotiated the cliprdr clipboard channel
+     * @returns {boolean}
+     */
+    hasClipboardChannel() {
+        return !!(this.serverCapabilities && this.serverCapabilities.clipboardEnabled);
+    },
+    
+    /**
+     * Offer text to the remote clipboard so it can be pasted there
+     * Message format: [0xFC][UTF-8 text]
+     * @param {string} text
+     * @returns {boolean} true if the text was sent
+     */
+    sendClipboardText(text) {
+        if (!this.connected || !this.socket || !this.hasClipboardChannel()) return false;
+        
+        const encoded = new TextEncoder().encode(text);
+        const msg = new Uint8Array(1 + encoded.length);
+        msg[0] = 0xFC;
+        msg.set(encoded, 1);
+        this.socket.send(msg.buffer);
+        
+        Logger.debug("Clipboard", `Sent ${text.length} chars to remote clipboard`);
+        return true;
+    },
+    
+    /**
+     * Handle a clipboard message from the server
+     * @param {Uint8Array} data - [0xFC][UTF-8 text]
+     */
+    handleClipboardMessage(data) {
+        const text = new TextDecoder().decode(data.subarray(1));
+        Logger.debug("Clipboard", `Received ${text.length} chars from remote clipboard`);
+        this.handleRemoteClipboard(text);
+    },
+    
+    /**
+     * Store remote clipboard text and mirror it to the local clipboard
+     * @param {string} text
+     */
+    handleRemoteClipboard(text) {
+        this.remoteClipboardText = text;
+        this.emitEvent('clipboard', {text: text});
+        // Browsers may refuse clipboard writes without focus or a user gesture;
+        // the text remains available via remoteClipboardText
+        this.copyToLocalClipboard(text);
+    },
+    
     /**
      * Copy text to local clipboard (for UI use)
      * @param {string} text
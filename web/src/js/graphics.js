@@ -7,7 +7,7 @@
 import { Logger } from './logger.js';
 import { WASMCodec, RFXDecoder } from './wasm.js';
 import { FallbackCodec } from './codec-fallback.js';
-import { parseNewPointerUpdate, parseCachedPointerUpdate, parsePointerPositionUpdate, parseBitmapUpdate, parseSurfaceCommands } from './protocol.js';
+import { NewPointerUpdate, parseNewPointerUpdate, parseColorPointerUpdate, parseLargePointerUpdate, parseCachedPointerUpdate, parsePointerPositionUpdate, parseBitmapUpdate, parseSurfaceCommands } from './protocol.js';
 import { CanvasRenderer } from './renderer.js';
 import { WebGLRenderer } from './webgl-renderer.js';
 
@@ -546,6 +546,71 @@ export const GraphicsMixin = {
         };
     },
     
+    /**
+     * Cache a pointer image as a CSS cursor class and show it
+     * @param {NewPointerUpdate} pointer
+     */
+    setPointer(pointer) {
+        Logger.debug("Cursor", `New cursor: cache=${pointer.cacheIndex}, hotspot=(${pointer.x},${pointer.y}), size=${pointer.width}x${pointer.height}, bpp=${pointer.xorBpp}`);
+        // Resize canvas to match cursor dimensions (also clears it)
+        this.pointerCacheCanvas.width = pointer.width;
+        this.pointerCacheCanvas.height = pointer.height;
+        this.pointerCacheCanvasCtx.putImageData(pointer.getImageData(this.pointerCacheCanvasCtx), 0, 0);
+
+        this.cachePointerCursor(pointer);
+    },
+
+    /**
+     * Cache a pointer shape decoded by the gateway and show it
+     * @param {{cacheIndex: number, x: number, y: number, width: number, height: number, rgba: string}} shape
+     *   RGBA pixels are base64 encoded
+     */
+    setPointerShape(shape) {
+        Logger.debug("Cursor", `Gateway cursor: cache=${shape.cacheIndex}, hotspot=(${shape.x},${shape.y}), size=${shape.width}x${shape.height}`);
+        const binary = atob(shape.rgba);
+        const pixels = new Uint8ClampedArray(binary.length);
+        for (let i = 0; i < binary.length; i++) {
+            pixels[i] = binary.charCodeAt(i);
+        }
+        const pointer = new NewPointerUpdate(shape.cacheIndex, shape.x, shape.y, shape.width, shape.height, 32, null, null);
+
+        this.pointerCacheCanvas.width = pointer.width;
+        this.pointerCacheCanvas.height = pointer.height;
+        this.pointerCacheCanvasCtx.putImageData(new ImageData(pixels, pointer.width, pointer.height), 0, 0);
+        this.cachePointerCursor(pointer);
+    },
+
+    /**
+     * Turn the image drawn on the pointer cache canvas into the CSS cursor
+     * class of the pointer's cache index and apply it
+     * @param {NewPointerUpdate} pointer
+     */
+    cachePointerCursor(pointer) {
+        const url = this.pointerCacheCanvas.toDataURL('image/png');
+
+        if (this.pointerCache.hasOwnProperty(pointer.cacheIndex)) {
+            document.getElementsByTagName('head')[0].removeChild(this.pointerCache[pointer.cacheIndex]);
+            delete this.pointerCache[pointer.cacheIndex];
+        }
+
+        const style = document.createElement('style');
+        const className = 'pointer-cache-' + pointer.cacheIndex;
+        style.innerHTML = '.' + className + ' {cursor:' + pointer.cssCursor(url) + ' !important}';
+
+        document.getElementsByTagName('head')[0].appendChild(style);
+        this.pointerCache[pointer.cacheIndex] = style;
+        this.canvas.className = className;
+    },
+
+    /**
+     * Hide the pointer, or show the system default one
+     * @param {boolean} visible
+     */
+    setPointerVisible(visible) {
+        Logger.debug("Cursor", visible ? "Default" : "Hidden");
+        this.canvas.className = visible ? 'pointer-cache-default' : 'pointer-cache-null';
+    },
+
     /**
      * Handle pointer/cursor update
      * @param {Object} header
@@ -556,43 +621,27 @@ export const GraphicsMixin = {
             Logger.debug("Cursor", `Update type: ${header.updateCode}`);
             
             if (header.isPTRNull()) {
-                Logger.debug("Cursor", "Hidden");
-                this.canvas.className = 'pointer-cache-null';
+                this.setPointerVisible(false);
                 return;
             }
 
             if (header.isPTRDefault()) {
-                Logger.debug("Cursor", "Default");
-                this.canvas.className = 'pointer-cache-default';
+                this.setPointerVisible(true);
                 return;
             }
 
             if (header.isPTRColor()) {
+                this.setPointer(parseColorPointerUpdate(r));
                 return;
             }
 
             if (header.isPTRNew()) {
-                const newPointerUpdate = parseNewPointerUpdate(r);
-                Logger.debug("Cursor", `New cursor: cache=${newPointerUpdate.cacheIndex}, hotspot=(${newPointerUpdate.x},${newPointerUpdate.y}), size=${newPointerUpdate.width}x${newPointerUpdate.height}`);
-                // Resize canvas to match cursor dimensions (also clears it)
-                this.pointerCacheCanvas.width = newPointerUpdate.width;
-                this.pointerCacheCanvas.height = newPointerUpdate.height;
-                this.pointerCacheCanvasCtx.putImageData(newPointerUpdate.getImageData(this.pointerCacheCanvasCtx), 0, 0);
-
-                const url = this.pointerCacheCanvas.toDataURL('image/png');
-
-                if (this.pointerCache.hasOwnProperty(newPointerUpdate.cacheIndex)) {
-                    document.getElementsByTagName('head')[0].removeChild(this.pointerCache[newPointerUpdate.cacheIndex]);
-                    delete this.pointerCache[newPointerUpdate.cacheIndex];
-                }
-
-                const style = document.createElement('style');
-                const className = 'pointer-cache-' + newPointerUpdate.cacheIndex;
-                style.innerHTML = '.' + className + ' {cursor:url("' + url + '") ' + newPointerUpdate.x + ' ' + newPointerUpdate.y + ', auto !important}';
+                this.setPointer(parseNewPointerUpdate(r));
+                return;
+            }
 
-                document.getElementsByTagName('head')[0].appendChild(style);
-                this.pointerCache[newPointerUpdate.cacheIndex] = style;
-                this.canvas.className = className;
+            if (header.isLargePointer()) {
+                this.setPointer(parseLargePointerUpdate(r));
                 return;
             }
 
@@ -780,10 +829,94 @@ export const GraphicsMixin = {
                     }
                 }
             }
-            // frameMarker: informational
+            if (type === 'frameMarker' && !command.isStart) {
+                // The frame is drawn; let the server send the next one
+                this.sendFrameAcknowledge(command.frameID);
+            }
         }
     },
 
+    /**
+     * Handle drawing operations translated from drawing orders (0xF8 marker):
+     * [0xF8][count:2] then per operation, little-endian:
+     *   fill: [0x01][left:2][top:2][width:2][height:2][r][g][b]
+     *   copy: [0x02][srcX:2][srcY:2][left:2][top:2][width:2][height:2]
+     * @param {Uint8Array} data
+     */
+    handleDrawingOps(data) {
+        if (!this.renderer || data.length < 3) {
+            return;
+        }
+        const view = new DataView(data.buffer, data.byteOffset, data.byteLength);
+        const count = view.getUint16(1, true);
+        const useBatching = count > 1 && typeof this.renderer.beginBatch === 'function';
+        if (useBatching) {
+            this.renderer.beginBatch();
+        }
+
+        let offset = 3;
+        for (let i = 0; i < count; i++) {
+            const op = data[offset];
+            if (op === 0x01 && offset + 12 <= data.length) {
+                const left = view.getInt16(offset + 1, true);
+                const top = view.getInt16(offset + 3, true);
+                const rect = this.clipToCanvas(left, top, left, top,
+                    view.getUint16(offset + 5, true), view.getUint16(offset + 7, true));
+                if (rect) {
+                    this.renderer.fillRect(rect.x, rect.y, rect.width, rect.height,
+                        data[offset + 9], data[offset + 10], data[offset + 11]);
+                }
+                offset += 12;
+            } else if (op === 0x02 && offset + 13 <= data.length) {
+                const rect = this.clipToCanvas(
+                    view.getInt16(offset + 1, true), view.getInt16(offset + 3, true),
+                    view.getInt16(offset + 5, true), view.getInt16(offset + 7, true),
+                    view.getUint16(offset + 9, true), view.getUint16(offset + 11, true)
+                );
+                if (rect) {
+                    this.renderer.copyRect(rect.srcX, rect.srcY, rect.x, rect.y, rect.width, rect.height);
+                }
+                offset += 13;
+            } else {
+                Logger.debug("Orders", `Malformed drawing operation 0x${(op ?? 0).toString(16)}`);
+                break;
+            }
+        }
+
+        if (useBatching) {
+            this.renderer.flush();
+        }
+    },
+
+    /**
+     * Clip a destination rectangle, and the source it is copied from, to
+     * the canvas. Returns null when nothing is left.
+     */
+    clipToCanvas(srcX, srcY, x, y, width, height) {
+        const dx = Math.max(0, -x, -srcX);
+        const dy = Math.max(0, -y, -srcY);
+        width = Math.min(width - dx, this.canvas.width - (x + dx), this.canvas.width - (srcX + dx));
+        height = Math.min(height - dy, this.canvas.height - (y + dy), this.canvas.height - (srcY + dy));
+        if (width <= 0 || height <= 0) {
+            return null;
+        }
+        return { srcX: srcX + dx, srcY: srcY + dy, x: x + dx, y: y + dy, width, height };
+    },
+
+    /**
+     * Acknowledge a rendered frame: [0xFA][frameId:4, little-endian]
+     * @param {number} frameID
+     */
+    sendFrameAcknowledge(frameID) {
+        if (!this.socket || this.socket.readyState !== WebSocket.OPEN) {
+            return;
+        }
+        const msg = new Uint8Array(5);
+        msg[0] = 0xFA;
+        new DataView(msg.buffer).setUint32(1, frameID, true);
+        this.socket.send(msg.buffer);
+    },
+
     /**
      * Handle a NSCodec-encoded surface command.
      * @param {SetSurfaceBitsCommand} cmd
@@ -862,6 +995,7 @@ export const GraphicsMixin = {
         // Parse RFX message blocks
         let offset = 0;
         let quantTables = [];
+        let rects = null;
 
         while (offset + 6 <= data.length) {
             const blockType = data[offset] | (data[offset + 1] << 8);
@@ -870,15 +1004,97 @@ export const GraphicsMixin = {
 
             if (blockLen < 6 || offset + blockLen > data.length) break;
 
-            if (blockType === this._RFX_WBT_TILESET) {
-                this._parseAndRenderTileset(data, offset, blockLen, destLeft, destTop, quantTables);
+            if (blockType === this._RFX_WBT_SYNC) {
+                // Codec reset: channels and context are sent again after it
+                this._rfxSurfaceWidth = 0;
+                this._rfxSurfaceHeight = 0;
+                this._rfxEntropyMode = 0;
+            } else if (blockType === this._RFX_WBT_CONTEXT && blockLen >= 13) {
+                // properties bits 9-12 hold the entropy algorithm (0x01 RLGR1, 0x04 RLGR3)
+                const properties = data[offset + 11] | (data[offset + 12] << 8);
+                const et = (properties >> 9) & 0x0F;
+                this._rfxEntropyMode = et === 0x01 ? 1 : et === 0x04 ? 3 : 0;
+            } else if (blockType === this._RFX_WBT_CHANNELS && blockLen >= 12 && data[offset + 6] > 0) {
+                // First channel's surface size bounds tile positions
+                this._rfxSurfaceWidth = data[offset + 8] | (data[offset + 9] << 8);
+                this._rfxSurfaceHeight = data[offset + 10] | (data[offset + 11] << 8);
+            } else if (blockType === this._RFX_WBT_REGION) {
+                rects = this._parseRFXRegion(data, offset, blockLen);
+            } else if (blockType === this._RFX_WBT_TILESET) {
+                this._parseAndRenderTileset(data, offset, blockLen, destLeft, destTop, quantTables, rects);
             }
-            // SYNC, CODEC_VERSIONS, CHANNELS, CONTEXT, FRAME_BEGIN, REGION, FRAME_END: skip
+            // CODEC_VERSIONS, FRAME_BEGIN, FRAME_END: skip
 
             offset += blockLen;
         }
     },
 
+    /**
+     * Parse the rectangles of a TS_RFX_REGION block.
+     * @param {Uint8Array} data - Full RFX message
+     * @param {number} blockOffset - Offset of region block
+     * @param {number} blockLen - Length of region block
+     * @returns {Array|null} [{ x, y, width, height }] or null if malformed
+     */
+    _parseRFXRegion(data, blockOffset, blockLen) {
+        // Header: blockType(2) + blockLen(4) + regionFlags(1) + numRects(2)
+        if (blockLen < 9) return null;
+        let off = blockOffset + 7;
+        const numRects = data[off] | (data[off + 1] << 8); off += 2;
+        if (9 + numRects * 8 > blockLen) {
+            Logger.warn("RFX", `Region declares ${numRects} rects but is ${blockLen} bytes`);
+            return null;
+        }
+
+        const rects = [];
+        for (let i = 0; i < numRects; i++, off += 8) {
+            rects.push({
+                x: data[off] | (data[off + 1] << 8),
+                y: data[off + 2] | (data[off + 3] << 8),
+                width: data[off + 4] | (data[off + 5] << 8),
+                height: data[off + 6] | (data[off + 7] << 8)
+            });
+        }
+        return rects;
+    },
+
+    /**
+     * Draw a decoded 64×64 tile, clipped to the region rectangles.
+     * Mirrors Frame.Updates in internal/codec/rfx.
+     * @param {number} destLeft - Region origin X
+     * @param {number} destTop - Region origin Y
+     * @param {Object} result - { x, y, width, height } from the decoder
+     * @param {Uint8ClampedArray} rgba - Tile pixels
+     * @param {Array|null} rects - Region rectangles, or null to draw the whole tile
+     */
+    _drawRFXTile(destLeft, destTop, result, rgba, rects) {
+        if (!rects) {
+            this.renderer.drawRGBA(destLeft + result.x, destTop + result.y, result.width, result.height, rgba);
+            return;
+        }
+
+        for (const r of rects) {
+            const left = Math.max(result.x, r.x);
+            const top = Math.max(result.y, r.y);
+            const right = Math.min(result.x + result.width, r.x + r.width);
+            const bottom = Math.min(result.y + result.height, r.y + r.height);
+            if (left >= right || top >= bottom) continue;
+
+            const w = right - left;
+            const h = bottom - top;
+            let pixels = rgba;
+            if (w !== result.width || h !== result.height) {
+                // Crop the covered rows out of the tile
+                pixels = new Uint8ClampedArray(w * h * 4);
+                for (let row = 0; row < h; row++) {
+                    const src = ((top - result.y + row) * result.width + (left - result.x)) * 4;
+                    pixels.set(rgba.subarray(src, src + w * 4), row * w * 4);
+                }
+            }
+            this.renderer.drawRGBA(destLeft + left, destTop + top, w, h, pixels);
+        }
+    },
+
     /**
      * Parse a TS_RFX_TILESET block and decode+render its tiles.
      * @param {Uint8Array} data - Full RFX message
@@ -887,8 +1103,9 @@ export const GraphicsMixin = {
      * @param {number} destLeft - Destination X offset from surface command
      * @param {number} destTop - Destination Y offset from surface command
      * @param {Array} quantTables - Output: parsed quant tables
+     * @param {Array|null} rects - Region rectangles that clip the tiles
      */
-    _parseAndRenderTileset(data, blockOffset, blockLen, destLeft, destTop, quantTables) {
+    _parseAndRenderTileset(data, blockOffset, blockLen, destLeft, destTop, quantTables, rects) {
         // TS_RFX_TILESET header: blockType(2) + blockLen(4) + subtype(2) + idx(2) + flags(2)
         //   + numQuant(1) + tileSize(1) + numTiles(2) + tileDataSize(4)
         const hdrSize = 22;
@@ -942,18 +1159,13 @@ export const GraphicsMixin = {
 
             // Pass the full tile block (including CBT_TILE header) to WASM decoder
             const tileData = data.subarray(off, off + tileBlockLen);
-            const result = WASMCodec.decodeRFXTile(tileData, this.rfxDecoder.tileBuffer);
+            const result = WASMCodec.decodeRFXTile(tileData, this.rfxDecoder.tileBuffer,
+                this._rfxSurfaceWidth || 0, this._rfxSurfaceHeight || 0, this._rfxEntropyMode || 0);
 
             if (result) {
                 const rgba = new Uint8ClampedArray(this.rfxDecoder.tileBuffer.buffer,
                     this.rfxDecoder.tileBuffer.byteOffset, this.rfxDecoder.tileBuffer.byteLength);
-                this.renderer.drawRGBA(
-                    destLeft + result.x,
-                    destTop + result.y,
-                    result.width,
-                    result.height,
-                    rgba
-                );
+                this._drawRFXTile(destLeft, destTop, result, rgba, rects);
                 decoded++;
             } else {
                 failed++;
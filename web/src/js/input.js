@@ -11,7 +11,8 @@ import {
     MouseMoveEvent, 
     MouseDownEvent, 
     MouseUpEvent, 
-    MouseWheelEvent 
+    MouseWheelEvent,
+    unicodeInputMessage
 } from './protocol.js';
 
 /**
@@ -48,6 +49,20 @@ export function mouseButtonMap(button) {
     }
 }
 
+/**
+ * Whether a keydown should be typed as a Unicode character rather than a
+ * scancode: a single printable character without shortcut modifiers, so
+ * non-US layouts type what the user sees. AltGr combinations count as
+ * typing, since they produce characters.
+ * @param {KeyboardEvent} e
+ * @returns {boolean}
+ */
+export function isUnicodeKey(e) {
+    if (Array.from(e.key).length !== 1 || e.key < ' ') return false;
+    const altGraph = e.getModifierState && e.getModifierState('AltGraph');
+    return altGraph || !(e.ctrlKey || e.altKey || e.metaKey);
+}
+
 /**
  * Input handling mixin - adds input functionality to Client
  */
@@ -64,6 +79,8 @@ export const InputMixin = {
         this.lastMouseSendTime = 0;
         this.lastActivityUpdate = null;
         this.lastTouchUpdate = null;
+        this.wheelRemainder = { x: 0, y: 0 };
+        this.unicodeKeys = new Set();
         
         // Bind event handlers
         this.handleKeyDown = this.handleKeyDown.bind(this);
@@ -161,6 +178,15 @@ export const InputMixin = {
 
         this.updateActivity();
 
+        // Unicode key strokes carry both press and release, so the matching
+        // keyup is swallowed
+        if (isUnicodeKey(e)) {
+            this.unicodeKeys.add(e.code);
+            this.queueInput(unicodeInputMessage(e.key), false);
+            e.preventDefault();
+            return false;
+        }
+
         const event = new KeyboardEventKeyDown(e.code);
 
         if (event.keyCode === undefined) {
@@ -193,6 +219,11 @@ export const InputMixin = {
 
         this.updateActivity();
 
+        if (this.unicodeKeys.delete(e.code)) {
+            e.preventDefault();
+            return false;
+        }
+
         const event = new KeyboardEventKeyUp(e.code);
 
         if (event.keyCode === undefined) {
@@ -278,17 +309,45 @@ export const InputMixin = {
         this.updateActivity();
 
         const pos = this.screenToDesktop(e.clientX, e.clientY);
-        const isHorizontal = Math.abs(e.deltaX) > Math.abs(e.deltaY);
-        const delta = isHorizontal ? e.deltaX : e.deltaY;
-        const step = Math.round(Math.abs(delta) * 15 / 8);
 
-        const event = new MouseWheelEvent(pos.x, pos.y, step, delta > 0, isHorizontal);
-        const data = event.serialize();
-        this.queueInput(data, false);
+        // Browsers scroll down/right for positive deltas; RDP wheel rotation
+        // is positive for up and right
+        const vertical = this.wheelRotation('y', -e.deltaY, e.deltaMode);
+        const horizontal = this.wheelRotation('x', e.deltaX, e.deltaMode);
+
+        if (vertical !== 0) {
+            this.queueInput(new MouseWheelEvent(pos.x, pos.y, vertical, false).serialize(), false);
+        }
+        if (horizontal !== 0) {
+            this.queueInput(new MouseWheelEvent(pos.x, pos.y, horizontal, true).serialize(), false);
+        }
 
         e.preventDefault();
         return false;
     },
+
+    /**
+     * Convert a wheel delta to whole rotation units (1/120 of a detent),
+     * carrying the fractional part of high-resolution deltas over to the
+     * next event so slow trackpad scrolling is not lost
+     * @param {'x'|'y'} axis
+     * @param {number} delta
+     * @param {number} deltaMode - WheelEvent.DOM_DELTA_PIXEL, _LINE or _PAGE
+     * @returns {number}
+     */
+    wheelRotation(axis, delta, deltaMode) {
+        let units;
+        switch (deltaMode) {
+            case 1: units = delta * 40; break;   // 3 lines per detent
+            case 2: units = delta * 120; break;  // one detent per page
+            default: units = delta * 15 / 8;     // 64 pixels per detent
+        }
+
+        const total = this.wheelRemainder[axis] + units;
+        const whole = Math.trunc(total);
+        this.wheelRemainder[axis] = total - whole;
+        return whole;
+    },
     
     /**
      * Handle touch start event
@@ -0,0 +1,159 @@
+// Microphone module - captures browser audio for RDP audio input (MS-RDPEAI)
+// The gateway announces the negotiated PCM format with a "microphone" control
+// message once the server opens the AUDIO_INPUT channel; captured audio is
+// resampled to that format and sent as [0xFD][16-bit little-endian PCM].
+
+import { Logger } from './logger.js';
+
+// Marker prefixing microphone audio sent to the gateway
+const MICROPHONE_MARKER = 0xFD;
+// Packet duration used when the server does not ask for a frame count
+const DEFAULT_PACKET_MS = 20;
+// ScriptProcessor buffer size in frames (~85ms at 48kHz)
+const CAPTURE_BUFFER_FRAMES = 4096;
+
+const MicrophoneMixin = {
+    initMicrophone() {
+        this.microphoneEnabled = false;
+        this._micStream = null;
+        this._micContext = null;
+        this._micProcessor = null;
+        this._micFormat = null;
+        this._micPending = [];   // interleaved samples awaiting a full packet
+        this._micPhase = 0;      // fractional read position carried between buffers
+        this._micLast = null;    // last input frame, for interpolation across buffers
+    },
+
+    /**
+     * Opt in to microphone redirection. Takes effect on the next connection;
+     * disabling stops any capture in progress.
+     * @param {boolean} enabled
+     */
+    setMicrophoneEnabled(enabled) {
+        this.microphoneEnabled = !!enabled;
+        if (!this.microphoneEnabled) {
+            this.stopMicrophone();
+        }
+    },
+
+    /**
+     * Handle the gateway's "microphone" control message by (re)starting capture
+     * @param {{sampleRate: number, channels: number, bitsPerSample: number, framesPerPacket: number}} message
+     */
+    async handleMicrophoneMessage(message) {
+        if (!this.microphoneEnabled) return;
+        if (message.bitsPerSample !== 16 || !message.sampleRate || !(message.channels === 1 || message.channels === 2)) {
+            Logger.warn('Microphone', `Unsupported capture format: ${JSON.stringify(message)}`);
+            return;
+        }
+
+        this._micFormat = {
+            sampleRate: message.sampleRate,
+            channels: message.channels,
+            framesPerPacket: message.framesPerPacket || Math.round(message.sampleRate * DEFAULT_PACKET_MS / 1000),
+        };
+        this._micPending = [];
+        this._micPhase = 0;
+        this._micLast = null;
+
+        if (this._micStream) {
+            Logger.debug('Microphone', `Capture format changed: ${message.sampleRate}Hz ${message.channels}ch`);
+            return;
+        }
+
+        try {
+            this._micStream = await navigator.mediaDevices.getUserMedia({
+                audio: { channelCount: message.channels, echoCancellation: true, noiseSuppression: true },
+            });
+        } catch (e) {
+            Logger.warn('Microphone', `Capture not permitted: ${e.message}`);
+            this._micStream = null;
+            return;
+        }
+        if (!this.connected || !this.microphoneEnabled) {
+            this.stopMicrophone();
+            return;
+        }
+
+        const context = new (window.AudioContext || window.webkitAudioContext)();
+        const source = context.createMediaStreamSource(this._micStream);
+        const processor = context.createScriptProcessor(CAPTURE_BUFFER_FRAMES, message.channels, message.channels);
+        processor.onaudioprocess = (event) => this._captureMicrophone(event.inputBuffer);
+        source.connect(processor);
+        // ScriptProcessor only runs while connected to the graph; its output stays silent
+        processor.connect(context.destination);
+
+        this._micContext = context;
+        this._micProcessor = processor;
+        Logger.info('Microphone', `Capturing at ${context.sampleRate}Hz, sending ${message.sampleRate}Hz ${message.channels}ch`);
+    },
+
+    stopMicrophone() {
+        if (this._micProcessor) {
+            this._micProcessor.onaudioprocess = null;
+            this._micProcessor.disconnect();
+            this._micProcessor = null;
+        }
+        if (this._micContext) {
+            this._micContext.close();
+            this._micContext = null;
+        }
+        if (this._micStream) {
+            this._micStream.getTracks().forEach(track => track.stop());
+            this._micStream = null;
+        }
+        this._micFormat = null;
+        this._micPending = [];
+    },
+
+    /**
+     * Resample one captured buffer to the negotiated rate and send full packets
+     * @param {AudioBuffer} input
+     */
+    _captureMicrophone(input) {
+        const format = this._micFormat;
+        if (!format || !this.connected || !this.socket) return;
+
+        const channels = [];
+        for (let c = 0; c < format.channels; c++) {
+            channels.push(input.getChannelData(Math.min(c, input.numberOfChannels - 1)));
+        }
+
+        // Linear interpolation; position -1 refers to the last frame of the previous buffer
+        const step = input.sampleRate / format.sampleRate;
+        const sampleAt = (c, i) => (i < 0 ? (this._micLast ? this._micLast[c] : channels[c][0]) : channels[c][i]);
+        let pos = this._micPhase;
+        while (pos < input.length - 1) {
+            const i = Math.floor(pos);
+            const frac = pos - i;
+            for (let c = 0; c < format.channels; c++) {
+                const s = sampleAt(c, i) * (1 - frac) + sampleAt(c, i + 1) * frac;
+                this._micPending.push(Math.max(-1, Math.min(1, s)));
+            }
+            pos += step;
+        }
+        this._micPhase = pos - input.length;
+        this._micLast = channels.map(data => data[input.length - 1]);
+
+        const packetSamples = format.framesPerPacket * format.channels;
+        while (this._micPending.length >= packetSamples) {
+            this._sendMicrophonePacket(this._micPending.splice(0, packetSamples));
+        }
+    },
+
+    /**
+     * Send interleaved float samples as [0xFD][int16 LE PCM]
+     * @param {number[]} samples
+     */
+    _sendMicrophonePacket(samples) {
+        const msg = new Uint8Array(1 + samples.length * 2);
+        const view = new DataView(msg.buffer);
+        msg[0] = MICROPHONE_MARKER;
+        for (let i = 0; i < samples.length; i++) {
+            view.setInt16(1 + i * 2, Math.round(samples[i] * 0x7FFF), true);
+        }
+        this.socket.send(msg.buffer);
+    },
+};
+
+export default MicrophoneMixin;
@@ -0,0 +1,94 @@
+/**
+ * Tests for pointer update parsing
+ * Run with: node --test pointer.test.js
+ * @module pointer.test
+ */
+
+import { describe, it } from 'node:test';
+import assert from 'node:assert/strict';
+
+import BinaryReader from './binary.js';
+import { parseColorPointerUpdate, parseNewPointerUpdate, parseLargePointerUpdate } from './protocol.js';
+
+/**
+ * Build a pointer update body
+ * @param {Object} opts
+ * @returns {BinaryReader}
+ */
+function pointerBody({ xorBpp, cacheIndex, x, y, width, height, andMask, xorMask, large = false }) {
+    const maskLenSize = large ? 4 : 2;
+    const headerSize = (xorBpp === undefined ? 0 : 2) + 10 + 2 * maskLenSize;
+    const buffer = new ArrayBuffer(headerSize + xorMask.length + andMask.length + 1);
+    const view = new DataView(buffer);
+    let offset = 0;
+    const u16 = (v) => { view.setUint16(offset, v, true); offset += 2; };
+    const len = (v) => {
+        if (large) {
+            view.setUint32(offset, v, true);
+            offset += 4;
+        } else {
+            u16(v);
+        }
+    };
+
+    if (xorBpp !== undefined) {
+        u16(xorBpp);
+    }
+    u16(cacheIndex);
+    u16(x);
+    u16(y);
+    u16(width);
+    u16(height);
+    len(andMask.length);
+    len(xorMask.length);
+    new Uint8Array(buffer, offset).set(xorMask);
+    new Uint8Array(buffer, offset + xorMask.length).set(andMask);
+    return new BinaryReader(buffer);
+}
+
+describe('Pointer updates', () => {
+    it('parses the hotspot of a color pointer update', () => {
+        const pointer = parseColorPointerUpdate(pointerBody({
+            cacheIndex: 3, x: 5, y: 7, width: 8, height: 8,
+            andMask: new Uint8Array(16), xorMask: new Uint8Array(8 * 24)
+        }));
+
+        assert.equal(pointer.cacheIndex, 3);
+        assert.equal(pointer.xorBpp, 24);
+        assert.deepEqual(pointer.hotspot(), { x: 5, y: 7 });
+        assert.equal(pointer.cssCursor('data:x'), 'url("data:x") 5 7, auto');
+    });
+
+    it('parses the hotspot of a new pointer update', () => {
+        const pointer = parseNewPointerUpdate(pointerBody({
+            xorBpp: 32, cacheIndex: 1, x: 10, y: 2, width: 32, height: 32,
+            andMask: new Uint8Array(128), xorMask: new Uint8Array(32 * 32 * 4)
+        }));
+
+        assert.equal(pointer.xorBpp, 32);
+        assert.equal(pointer.width, 32);
+        assert.deepEqual(pointer.hotspot(), { x: 10, y: 2 });
+        assert.equal(pointer.xorMask.length, 32 * 32 * 4);
+    });
+
+    it('parses the hotspot of a large pointer update', () => {
+        const pointer = parseLargePointerUpdate(pointerBody({
+            xorBpp: 32, cacheIndex: 2, x: 200, y: 150, width: 384, height: 384,
+            andMask: new Uint8Array(48 * 384), xorMask: new Uint8Array(384 * 384 * 4), large: true
+        }));
+
+        assert.equal(pointer.width, 384);
+        assert.equal(pointer.andMask.length, 48 * 384);
+        assert.deepEqual(pointer.hotspot(), { x: 200, y: 150 });
+    });
+
+    it('clamps a hotspot outside the cursor image', () => {
+        const pointer = parseColorPointerUpdate(pointerBody({
+            cacheIndex: 0, x: 40, y: 32, width: 32, height: 32,
+            andMask: new Uint8Array(128), xorMask: new Uint8Array(32 * 96)
+        }));
+
+        assert.deepEqual(pointer.hotspot(), { x: 31, y: 31 });
+        assert.equal(pointer.cssCursor('data:x'), 'url("data:x") 31 31, auto');
+    });
+});
@@ -27,6 +27,8 @@ const PTRFLAGS_BUTTON1 = 0x1000;
 const PTRFLAGS_BUTTON2 = 0x2000;
 const PTRFLAGS_BUTTON3 = 0x4000;
 const WheelRotationMask = 0x01FF;
+const WHEEL_ROTATION_MAX = 255;
+const WHEEL_ROTATION_MIN = -256;
 
 // ============================================================================
 // Keyboard Scancode Mapping (from input/keymap.js)
@@ -277,24 +279,44 @@ export class MouseUpEvent {
     }
 }
 
+/**
+ * Marker prefixing typed characters sent to the gateway, which forwards
+ * each UTF-16 code unit as a Unicode keyboard event
+ */
+const UNICODE_INPUT_MARKER = 0xFB;
+
+/**
+ * Build a Unicode input message: [0xFB][UTF-16LE code units]
+ * @param {string} text
+ * @returns {ArrayBuffer}
+ */
+export function unicodeInputMessage(text) {
+    const data = new ArrayBuffer(1 + text.length * 2);
+    const view = new DataView(data);
+
+    view.setUint8(0, UNICODE_INPUT_MARKER);
+    for (let i = 0; i < text.length; i++) {
+        view.setUint16(1 + i * 2, text.charCodeAt(i), true);
+    }
+
+    return data;
+}
+
 /**
  * Mouse wheel event
+ * Rotation is in 1/120 detent units: positive scrolls up (vertical) or
+ * right (horizontal). It is clamped to the 9-bit two's complement field,
+ * whose sign bit is PTRFLAGS_WHEEL_NEGATIVE.
  */
 export class MouseWheelEvent {
-    constructor(xPos, yPos, step, isNegative, isHorizontal) {
+    constructor(xPos, yPos, rotation, isHorizontal) {
         this.xPos = xPos;
         this.yPos = yPos;
 
-        this.pointerFlags = PTRFLAGS_WHEEL;
-        if (isHorizontal) {
-            this.pointerFlags = PTRFLAGS_HWHEEL;
-        }
+        this.pointerFlags = isHorizontal ? PTRFLAGS_HWHEEL : PTRFLAGS_WHEEL;
 
-        if (isNegative) {
-            this.pointerFlags |= PTRFLAGS_WHEEL_NEGATIVE;
-        }
-
-        this.pointerFlags |= (step & WheelRotationMask);
+        const clamped = Math.max(WHEEL_ROTATION_MIN, Math.min(WHEEL_ROTATION_MAX, Math.trunc(rotation)));
+        this.pointerFlags |= (clamped & WheelRotationMask);
     }
 
     serialize() {
@@ -580,6 +602,28 @@ export class NewPointerUpdate {
         this.xorMask = xorMask;
     }
 
+    /**
+     * Hotspot for the CSS cursor property. Browsers reject a cursor whose
+     * hotspot lies outside the image, so it is clamped to the last pixel.
+     * @returns {{x: number, y: number}}
+     */
+    hotspot() {
+        return {
+            x: Math.min(this.x, Math.max(this.width - 1, 0)),
+            y: Math.min(this.y, Math.max(this.height - 1, 0))
+        };
+    }
+
+    /**
+     * CSS cursor value showing the image at url with this pointer's hotspot
+     * @param {string} url
+     * @returns {string}
+     */
+    cssCursor(url) {
+        const { x, y } = this.hotspot();
+        return `url("${url}") ${x} ${y}, auto`;
+    }
+
     getImageData(ctx) {
         const imageData = ctx.createImageData(this.width, this.height);
         const data = imageData.data;
@@ -646,20 +690,66 @@ export class NewPointerUpdate {
     }
 }
 
+/**
+ * Parse the TS_COLORPOINTERATTRIBUTE body shared by color and new pointer
+ * updates. xPos/yPos are the cursor hotspot.
+ * @param {BinaryReader} r
+ * @param {number} xorBpp
+ * @returns {NewPointerUpdate}
+ */
+function parseColorPointerAttribute(r, xorBpp) {
+    const cacheIndex = r.uint16(true);
+    const x = r.uint16(true);
+    const y = r.uint16(true);
+    const width = r.uint16(true);
+    const height = r.uint16(true);
+    const andMaskLen = r.uint16(true);
+    const xorMaskLen = r.uint16(true);
+
+    const xorMask = r.blob(xorMaskLen);
+    const andMask = r.blob(andMaskLen);
+
+    if (r.remaining() > 0) {
+        r.skip(1);
+    }
+
+    return new NewPointerUpdate(cacheIndex, x, y, width, height, xorBpp, andMask, xorMask);
+}
+
 /**
  * Parse new pointer update
  * @param {BinaryReader} r
  * @returns {NewPointerUpdate}
  */
 export function parseNewPointerUpdate(r) {
+    const xorBpp = r.uint16(true);
+    return parseColorPointerAttribute(r, xorBpp);
+}
+
+/**
+ * Parse color pointer update (TS_COLORPOINTERATTRIBUTE), always 24 bpp
+ * @param {BinaryReader} r
+ * @returns {NewPointerUpdate}
+ */
+export function parseColorPointerUpdate(r) {
+    return parseColorPointerAttribute(r, 24);
+}
+
+/**
+ * Parse large pointer update (TS_LARGEPOINTERATTRIBUTE), for cursors up to
+ * 384x384 with 32-bit mask lengths
+ * @param {BinaryReader} r
+ * @returns {NewPointerUpdate}
+ */
+export function parseLargePointerUpdate(r) {
     const xorBpp = r.uint16(true);
     const cacheIndex = r.uint16(true);
     const x = r.uint16(true);
     const y = r.uint16(true);
     const width = r.uint16(true);
     const height = r.uint16(true);
-    const andMaskLen = r.uint16(true);
-    const xorMaskLen = r.uint16(true);
+    const andMaskLen = r.uint32(true);
+    const xorMaskLen = r.uint32(true);
 
     const xorMask = r.blob(xorMaskLen);
     const andMask = r.blob(andMaskLen);
@@ -27,6 +27,25 @@ export class CanvasRenderer {
         return true;
     }
 
+    fillRect(x, y, width, height, r, g, b) {
+        if (!this.ctx) {
+            return false;
+        }
+        this.ctx.fillStyle = `rgb(${r}, ${g}, ${b})`;
+        this.ctx.fillRect(x, y, width, height);
+        return true;
+    }
+
+    copyRect(srcX, srcY, x, y, width, height) {
+        if (!this.ctx) {
+            return false;
+        }
+        // Drawing a canvas onto itself copies the source first, so overlapping
+        // rectangles (scrolling) are safe
+        this.ctx.drawImage(this.canvas, srcX, srcY, width, height, x, y, width, height);
+        return true;
+    }
+
     clear() {
         if (!this.ctx) {
             return;
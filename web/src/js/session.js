@@ -32,6 +32,9 @@ export const SessionMixin = {
         this.lastConnectionTime = null;
         this.manualDisconnect = false;
         this.sessionId = generateSessionId();
+        // Auto-reconnect cookie from the server, kept in memory only
+        this.reconnectCookie = null;
+        this.reconnectCookieHost = null;
         
         // Session timeout and idle detection
         this.maxSessionTime = 8 * 60 * 60 * 1000; // 8 hours
@@ -104,6 +107,38 @@ export const SessionMixin = {
         this.manualDisconnect = true;
     },
     
+    /**
+     * Remember the server's auto-reconnect cookie for the current host
+     * @param {string} cookie - Base64 ARC_SC_PRIVATE_PACKET
+     */
+    setReconnectCookie(cookie) {
+        this.reconnectCookie = cookie || null;
+        this.reconnectCookieHost = this.hostEl.value;
+    },
+    
+    /**
+     * Add the auto-reconnect cookie to a connect URL so the server can skip
+     * a full logon. Cookies are only reused for the host that issued them.
+     * @param {URL} url
+     */
+    applyReconnectCookie(url) {
+        if (this.reconnectCookie && this.reconnectCookieHost === this.hostEl.value) {
+            url.searchParams.set('reconnect', this.reconnectCookie);
+        }
+    },
+    
+    /**
+     * Pass a forceCodec parameter from the page URL (nscodec, rfx or none)
+     * through to the connect URL, to debug codec-specific rendering.
+     * @param {URL} url
+     */
+    applyForceCodec(url) {
+        const forceCodec = new URLSearchParams(window.location.search).get('forceCodec');
+        if (forceCodec) {
+            url.searchParams.set('forceCodec', forceCodec);
+        }
+    },
+    
     /**
      * Schedule a reconnection attempt
      * @param {number} delay - Delay in milliseconds
@@ -149,6 +184,9 @@ export const SessionMixin = {
         url.searchParams.set('width', this.canvas.width);
         url.searchParams.set('height', this.canvas.height);
         url.searchParams.set('sessionId', this.sessionId);
+        url.searchParams.set('nonce', this.sessionId);
+        this.applyReconnectCookie(url);
+        this.applyForceCodec(url);
         
         // Get password from input (don't persist it)
         const password = this.passwordEl ? this.passwordEl.value : '';
@@ -26,6 +26,12 @@ export function isWASMSupported() {
     return false;
 }
 
+/**
+ * Marker for the set of functions the WASM module exports on goRLE.
+ * Must match abiMarker in web/src/wasm/main.go; bump both when exports change.
+ */
+export const WASM_ABI_MARKER = 'go-rdp-wasm-abi:4';
+
 /**
  * WASM Codec interface
  * Provides access to Go-implemented codec functions
@@ -95,6 +101,12 @@ export const WASMCodec = {
                 Logger.error('WASM', this.initError);
                 return false;
             }
+
+            if (goRLE.abi !== WASM_ABI_MARKER) {
+                this.initError = `WASM ABI mismatch: expected ${WASM_ABI_MARKER}, got ${goRLE.abi || 'none'}. Rebuild the frontend.`;
+                Logger.error('WASM', this.initError);
+                return false;
+            }
             
             this.ready = true;
             this.initError = null;
@@ -221,6 +233,20 @@ export const WASMCodec = {
         return goRLE.decodeNSCodec(src, width, height, dst);
     },
     
+    /**
+     * Decode an AVC420 (H.264) bitmap stream to RGBA. Pixels outside the
+     * stream's region rectangles are left transparent.
+     * @param {Uint8Array} src - RFX_AVC420_METABLOCK followed by the H.264 stream
+     * @param {number} width
+     * @param {number} height
+     * @param {Uint8Array} dst
+     * @returns {boolean} false if the stream uses unsupported H.264 features
+     */
+    decodeAVC420(src, width, height, dst) {
+        if (!this.isReady()) return false;
+        return goRLE.decodeAVC420(src, width, height, dst);
+    },
+    
     /**
      * Set palette colors
      * @param {Uint8Array} data - Palette data (RGB triples)
@@ -250,12 +276,15 @@ export const WASMCodec = {
      * Decode a single RFX tile
      * @param {Uint8Array} tileData - Compressed tile data (CBT_TILE block)
      * @param {Uint8Array} outputBuffer - Output buffer (16384 bytes for 64x64 RGBA)
+     * @param {number} [surfaceWidth] - Surface width; tiles starting beyond it are rejected
+     * @param {number} [surfaceHeight] - Surface height; tiles starting beyond it are rejected
+     * @param {number} [entropyMode] - 1 (RLGR1) or 3 (RLGR3) from the context block; 0 for the default
      * @returns {Object|null} { x, y, width, height } or null on error
      */
-    decodeRFXTile(tileData, outputBuffer) {
+    decodeRFXTile(tileData, outputBuffer, surfaceWidth = 0, surfaceHeight = 0, entropyMode = 0) {
         if (!this.isReady()) return null;
         
-        const result = goRLE.decodeRFXTile(tileData, outputBuffer);
+        const result = goRLE.decodeRFXTile(tileData, outputBuffer, surfaceWidth, surfaceHeight, entropyMode);
         
         // Result is [x, y, width, height] array or null
         if (result === null || result === undefined) {
@@ -270,6 +299,33 @@ export const WASMCodec = {
         };
     },
     
+    /**
+     * Decode the first quality pass of an RFX Progressive tile
+     * @param {Uint8Array} tileData - TILE_SIMPLE or TILE_FIRST block data
+     * @param {Uint8Array} outputBuffer - Output buffer (16384 bytes for 64x64 RGBA)
+     * @param {number} regionFlags - Flags of the enclosing region block
+     * @param {Uint8Array} [progQuant] - 16-byte progressive quant for the tile's quality
+     * @param {number} [surfaceWidth] - Surface width; tiles starting beyond it are rejected
+     * @param {number} [surfaceHeight] - Surface height; tiles starting beyond it are rejected
+     * @returns {Object|null} { x, y, width, height } or null on error
+     */
+    decodeRFXProgressiveTile(tileData, outputBuffer, regionFlags, progQuant, surfaceWidth = 0, surfaceHeight = 0) {
+        if (!this.isReady()) return null;
+        
+        const result = goRLE.decodeRFXProgressiveTile(tileData, outputBuffer, regionFlags, progQuant || null,
+            surfaceWidth, surfaceHeight);
+        if (result === null || result === undefined) {
+            return null;
+        }
+        
+        return {
+            x: result[0],
+            y: result[1],
+            width: result[2],
+            height: result[3]
+        };
+    },
+    
     /**
      * RFX tile constants
      */
@@ -14,6 +14,7 @@ export class WebGLRenderer {
         this.texture = null;
         this.positionBuffer = null;
         this.texCoordBuffer = null;
+        this.readFramebuffer = null;
         this.uResolution = null;
         this.uSampler = null;
         this.aPosition = -1;
@@ -96,6 +97,7 @@ export class WebGLRenderer {
         this._onContextRestored = () => {
             Logger.info('Renderer', 'WebGL context restored, reinitializing');
             this.contextLost = false;
+            this.readFramebuffer = null;
             // Reinitialize GL state
             if (!this._initProgram()) {
                 Logger.error('Renderer', 'Failed to reinitialize after context restore');
@@ -177,6 +179,40 @@ export class WebGLRenderer {
         return true;
     }
 
+    /**
+     * Fill a rectangle with a solid color
+     */
+    fillRect(x, y, width, height, r, g, b) {
+        const rgba = new Uint8Array(width * height * 4);
+        for (let i = 0; i < rgba.length; i += 4) {
+            rgba[i] = r;
+            rgba[i + 1] = g;
+            rgba[i + 2] = b;
+            rgba[i + 3] = 255;
+        }
+        return this.drawRGBA(x, y, width, height, rgba);
+    }
+
+    /**
+     * Copy a rectangle of the screen to another position, reading the
+     * source back from the screen texture first
+     */
+    copyRect(srcX, srcY, x, y, width, height) {
+        if (!this.isContextValid() || !this.texture) {
+            return false;
+        }
+        const gl = this.gl;
+        if (!this.readFramebuffer) {
+            this.readFramebuffer = gl.createFramebuffer();
+        }
+        gl.bindFramebuffer(gl.FRAMEBUFFER, this.readFramebuffer);
+        gl.framebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, this.texture, 0);
+        const rgba = new Uint8Array(width * height * 4);
+        gl.readPixels(srcX, srcY, width, height, gl.RGBA, gl.UNSIGNED_BYTE, rgba);
+        gl.bindFramebuffer(gl.FRAMEBUFFER, null);
+        return this.drawRGBA(x, y, width, height, rgba);
+    }
+
     /**
      * Begin batching texture uploads. Call flush() to render.
      * Use when processing multiple rectangles in a single frame.
@@ -264,6 +300,10 @@ export class WebGLRenderer {
             gl.deleteTexture(this.texture);
             this.texture = null;
         }
+        if (this.readFramebuffer) {
+            gl.deleteFramebuffer(this.readFramebuffer);
+            this.readFramebuffer = null;
+        }
         if (this.positionBuffer) {
             gl.deleteBuffer(this.positionBuffer);
             this.positionBuffer = null;
@@ -1,13 +1,13 @@
 const CACHE_NAME = 'rdp-pwa-v1';
 const ASSETS = [
-  '/',
-  '/index.html',
-  '/manifest.webmanifest',
-  '/js/client.bundle.min.js?v=2',
-  '/js/rle/wasm_exec.js',
-  '/js/rle/rle.wasm',
-  '/pwa/icon-192x192.png',
-  '/pwa/icon-512x512.png'
+  './',
+  'index.html',
+  'manifest.webmanifest',
+  'js/client.bundle.min.js?v=2',
+  'js/rle/wasm_exec.js',
+  'js/rle/rle.wasm',
+  'pwa/icon-192x192.png',
+  'pwa/icon-512x512.png'
 ];
 
 self.addEventListener('install', (event) => {
@@ -35,7 +35,7 @@ self.addEventListener('fetch', (event) => {
     return;
   }
   if (event.request.mode === 'navigate') {
-    event.respondWith(fetch(event.request).catch(() => caches.match('/')));
+    event.respondWith(fetch(event.request).catch(() => caches.match('./')));
     return;
   }
   event.respondWith(
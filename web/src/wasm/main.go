@@ -182,6 +182,32 @@ func jsDecodeNSCodec(this js.Value, args []js.Value) interface{} {
 	return true
 }
 
+// jsDecodeAVC420 is the JS wrapper for DecodeAVC420ToRGBA
+// Returns false for streams using unsupported H.264 features, so the caller
+// can fall back to another codec.
+func jsDecodeAVC420(this js.Value, args []js.Value) interface{} {
+	if len(args) < 4 {
+		return false
+	}
+
+	srcArray := args[0]
+	width := args[1].Int()
+	height := args[2].Int()
+	dstArray := args[3]
+
+	srcLen := srcArray.Get("length").Int()
+	src := make([]byte, srcLen)
+	js.CopyBytesToGo(src, srcArray)
+
+	rgba := codec.DecodeAVC420ToRGBA(src, width, height)
+	if rgba == nil {
+		return false
+	}
+
+	js.CopyBytesToJS(dstArray, rgba)
+	return true
+}
+
 // jsSetPalette updates the 256-color palette from server data
 func jsSetPalette(this js.Value, args []js.Value) interface{} {
 	if len(args) < 2 {
@@ -211,7 +237,10 @@ var (
 	rfxCrCoeff = make([]int16, rfx.TilePixels)
 )
 
-// jsDecodeRFXTile decodes a single RemoteFX tile
+// jsDecodeRFXTile decodes a single RemoteFX tile. The optional args[2] and
+// args[3] give the surface size; tiles starting outside it are rejected.
+// The optional args[4] is the entropy mode from the context block (1 for
+// RLGR1, 3 for RLGR3).
 // Returns: { x: pixelX, y: pixelY, width: 64, height: 64 } on success
 // Returns: null on error
 func jsDecodeRFXTile(this js.Value, args []js.Value) interface{} {
@@ -244,9 +273,17 @@ func jsDecodeRFXTile(this js.Value, args []js.Value) interface{} {
 		quantCr = rfx.DefaultQuant()
 	}
 
+	mode := rfx.DefaultEntropyMode
+	if len(args) > 4 && args[4].Type() == js.TypeNumber {
+		if m := args[4].Int(); m == rfx.RLGR1 || m == rfx.RLGR3 {
+			mode = m
+		}
+	}
+
 	// Decode using pre-allocated buffers
 	xIdx, yIdx, err := rfx.DecodeTileWithBuffers(
 		rfxInputBuffer[:srcLen],
+		mode,
 		quantY, quantCb, quantCr,
 		rfxYCoeff, rfxCbCoeff, rfxCrCoeff,
 		rfxOutputBuffer,
@@ -256,6 +293,12 @@ func jsDecodeRFXTile(this js.Value, args []js.Value) interface{} {
 		return nil
 	}
 
+	// Reject tiles outside the surface before handing pixels to the browser
+	width, height := surfaceSize(args, 2)
+	if rfx.CheckTileBounds(xIdx, yIdx, width, height) != nil {
+		return nil
+	}
+
 	js.CopyBytesToJS(dstArray, rfxOutputBuffer)
 
 	// Return result as array [x, y, width, height] - more efficient than map
@@ -267,6 +310,15 @@ func jsDecodeRFXTile(this js.Value, args []js.Value) interface{} {
 	}
 }
 
+// surfaceSize returns the optional surface width and height passed at
+// args[i] and args[i+1]. Zero means the size is unknown.
+func surfaceSize(args []js.Value, i int) (width, height int) {
+	if len(args) < i+2 || args[i].Type() != js.TypeNumber || args[i+1].Type() != js.TypeNumber {
+		return 0, 0
+	}
+	return args[i].Int(), args[i+1].Int()
+}
+
 // jsSetRFXQuant sets quantization values for subsequent decodes
 func jsSetRFXQuant(this js.Value, args []js.Value) interface{} {
 	if len(args) < 1 {
@@ -284,21 +336,94 @@ func jsSetRFXQuant(this js.Value, args []js.Value) interface{} {
 	return true
 }
 
+// rfxProgQuantBuffer holds the progressive quant entry of the tile being decoded
+var rfxProgQuantBuffer = make([]byte, rfx.ProgressiveQuantSize)
+
+// jsDecodeRFXProgressiveTile decodes the first quality pass of a RemoteFX
+// Progressive tile (TILE_SIMPLE or TILE_FIRST block). Quant tables come from
+// setRFXQuant, packed in progressive order. args[2] holds the region flags;
+// the optional args[3] is the 16-byte progressive quant entry for the tile's
+// quality, omitted for full quality. The optional args[4] and args[5] give
+// the surface size, as for jsDecodeRFXTile.
+func jsDecodeRFXProgressiveTile(this js.Value, args []js.Value) interface{} {
+	if len(args) < 3 {
+		return nil
+	}
+
+	srcArray := args[0]
+	dstArray := args[1]
+	regionFlags := uint8(args[2].Int())
+
+	srcLen := srcArray.Get("length").Int()
+	if srcLen > len(rfxInputBuffer) {
+		return nil
+	}
+
+	js.CopyBytesToGo(rfxInputBuffer[:srcLen], srcArray)
+
+	quantY, _ := rfx.ParseProgressiveQuantValues(rfxQuantBuffer[0:5])
+	quantCb, _ := rfx.ParseProgressiveQuantValues(rfxQuantBuffer[5:10])
+	quantCr, _ := rfx.ParseProgressiveQuantValues(rfxQuantBuffer[10:15])
+
+	var progQuant *rfx.ProgressiveQuant
+	if len(args) > 3 && args[3].Truthy() {
+		if args[3].Get("length").Int() < rfx.ProgressiveQuantSize {
+			return nil
+		}
+		js.CopyBytesToGo(rfxProgQuantBuffer, args[3])
+		progQuant, _ = rfx.ParseProgressiveQuant(rfxProgQuantBuffer)
+	}
+
+	xIdx, yIdx, err := rfx.DecodeProgressiveTileWithBuffers(
+		rfxInputBuffer[:srcLen],
+		quantY, quantCb, quantCr,
+		progQuant, regionFlags,
+		rfxYCoeff, rfxCbCoeff, rfxCrCoeff,
+		rfxOutputBuffer,
+	)
+
+	if err != nil {
+		return nil
+	}
+
+	width, height := surfaceSize(args, 4)
+	if rfx.CheckTileBounds(xIdx, yIdx, width, height) != nil {
+		return nil
+	}
+
+	js.CopyBytesToJS(dstArray, rfxOutputBuffer)
+
+	return []interface{}{
+		int(xIdx) * rfx.TileSize,
+		int(yIdx) * rfx.TileSize,
+		rfx.TileSize,
+		rfx.TileSize,
+	}
+}
+
+// abiMarker identifies the set of functions exported on goRLE. It must match
+// WASM_ABI_MARKER in web/src/js/wasm.js; bump both when the exports change.
+// The server compares the two in the embedded assets at startup.
+const abiMarker = "go-rdp-wasm-abi:4"
+
 func main() {
 	c := make(chan struct{}, 0)
 
 	// Register functions
 	js.Global().Set("goRLE", js.ValueOf(map[string]interface{}{
-		"decompressRLE16": js.FuncOf(jsDecompressRLE16),
-		"flipVertical":    js.FuncOf(jsFlipVertical),
-		"rgb565toRGBA":    js.FuncOf(jsRGB565toRGBA),
-		"bgr24toRGBA":     js.FuncOf(jsBGR24toRGBA),
-		"bgra32toRGBA":    js.FuncOf(jsBGRA32toRGBA),
-		"processBitmap":   js.FuncOf(jsProcessBitmap),
-		"decodeNSCodec":   js.FuncOf(jsDecodeNSCodec),
-		"setPalette":      js.FuncOf(jsSetPalette),
-		"decodeRFXTile":   js.FuncOf(jsDecodeRFXTile),
-		"setRFXQuant":     js.FuncOf(jsSetRFXQuant),
+		"decompressRLE16":          js.FuncOf(jsDecompressRLE16),
+		"flipVertical":             js.FuncOf(jsFlipVertical),
+		"rgb565toRGBA":             js.FuncOf(jsRGB565toRGBA),
+		"bgr24toRGBA":              js.FuncOf(jsBGR24toRGBA),
+		"bgra32toRGBA":             js.FuncOf(jsBGRA32toRGBA),
+		"processBitmap":            js.FuncOf(jsProcessBitmap),
+		"decodeNSCodec":            js.FuncOf(jsDecodeNSCodec),
+		"decodeAVC420":             js.FuncOf(jsDecodeAVC420),
+		"setPalette":               js.FuncOf(jsSetPalette),
+		"decodeRFXTile":            js.FuncOf(jsDecodeRFXTile),
+		"setRFXQuant":              js.FuncOf(jsSetRFXQuant),
+		"decodeRFXProgressiveTile": js.FuncOf(jsDecodeRFXProgressiveTile),
+		"abi":                      abiMarker,
 	}))
 
 	println("Go WASM RLE module loaded (with RFX support)")